@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// loopSimilarityThreshold is the keyword overlap above which two questions
+// count as variations of each other.
+const loopSimilarityThreshold = 0.5
+
+// ErrThrottled is returned for escalations from a client that is paused
+// after an anomaly.
+var ErrThrottled = errors.New("escalations from this client are paused")
+
+// EscalationMonitor tracks how often each client escalates and flags
+// anomalies: too many escalations in a window, or the same question asked
+// over and over, which usually means an agent is stuck in a loop. Runaway
+// loops are the main cause of surprise bills, so a flagged client can
+// optionally be throttled.
+type EscalationMonitor struct {
+	window     time.Duration
+	maxCalls   int
+	maxSimilar int
+	throttle   time.Duration
+	webhook    string
+	httpClient *http.Client
+	now        func() time.Time
+	store      *CounterStore
+
+	mu      sync.Mutex
+	clients map[string]*clientActivity
+}
+
+type clientActivity struct {
+	calls          []monitoredCall
+	alertedUntil   time.Time
+	throttledUntil time.Time
+}
+
+type monitoredCall struct {
+	at       time.Time
+	keywords []string
+}
+
+// Anomaly describes a flagged client. It is also the webhook payload.
+type Anomaly struct {
+	Client         string    `json:"client"`
+	Kind           string    `json:"kind"` // "rate" or "loop"
+	Tool           string    `json:"tool"`
+	Question       string    `json:"question,omitempty"`
+	Calls          int       `json:"calls"`
+	Window         string    `json:"window"`
+	DetectedAt     time.Time `json:"detected_at"`
+	ThrottledUntil time.Time `json:"throttled_until,omitzero"`
+}
+
+func (a *Anomaly) String() string {
+	var s string
+	if a.Kind == "loop" {
+		s = fmt.Sprintf("client %s asked %d variations of the same question in %s", a.Client, a.Calls, a.Window)
+	} else {
+		s = fmt.Sprintf("client %s made %d escalations in %s", a.Client, a.Calls, a.Window)
+	}
+	if !a.ThrottledUntil.IsZero() {
+		s += fmt.Sprintf("; escalations paused until %s", a.ThrottledUntil.Local().Format("15:04:05"))
+	}
+	return s
+}
+
+// NewEscalationMonitor flags a client making maxCalls escalations, or
+// maxSimilar variations of one question, within window. Zero disables
+// either check.
+func NewEscalationMonitor(window time.Duration, maxCalls, maxSimilar int) *EscalationMonitor {
+	return &EscalationMonitor{
+		window:     window,
+		maxCalls:   maxCalls,
+		maxSimilar: maxSimilar,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		now:        time.Now,
+		clients:    make(map[string]*clientActivity),
+	}
+}
+
+// WithThrottle pauses a flagged client's escalations for d.
+func (m *EscalationMonitor) WithThrottle(d time.Duration) *EscalationMonitor {
+	m.throttle = d
+	return m
+}
+
+// WithWebhook posts each anomaly as JSON to url.
+func (m *EscalationMonitor) WithWebhook(url string) *EscalationMonitor {
+	m.webhook = url
+	return m
+}
+
+// WithStore keeps each client's recent escalations and throttle in store,
+// so restarting the server doesn't clear them.
+func (m *EscalationMonitor) WithStore(store *CounterStore) *EscalationMonitor {
+	m.store = store
+	return m
+}
+
+// activity returns client's activity, from the store when there is one.
+// Callers hold mu.
+func (m *EscalationMonitor) activity(client string) *clientActivity {
+	if m.store != nil {
+		stored, err := m.store.Activity(client)
+		if err != nil {
+			slog.Warn("Couldn't read client activity", "client", client, "error", err)
+		} else {
+			if stored == nil {
+				stored = &clientActivity{}
+			}
+			m.clients[client] = stored
+		}
+	}
+	activity, ok := m.clients[client]
+	if !ok {
+		activity = &clientActivity{}
+		m.clients[client] = activity
+	}
+	return activity
+}
+
+// Observe records an escalation by client. It returns the anomaly this
+// call revealed, if any, and ErrThrottled (without recording the call)
+// while the client is paused.
+func (m *EscalationMonitor) Observe(client, tool, question string) (*Anomaly, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	activity := m.activity(client)
+	if now.Before(activity.throttledUntil) {
+		return nil, fmt.Errorf("%w until %s", ErrThrottled, activity.throttledUntil.Local().Format("15:04:05"))
+	}
+
+	kept := activity.calls[:0]
+	for _, call := range activity.calls {
+		if now.Sub(call.at) < m.window {
+			kept = append(kept, call)
+		}
+	}
+	current := monitoredCall{at: now, keywords: questionKeywords(question)}
+	activity.calls = append(kept, current)
+	if m.store != nil {
+		defer func() {
+			if err := m.store.SaveActivity(client, activity, now); err != nil {
+				slog.Warn("Couldn't record client activity", "client", client, "error", err)
+			}
+		}()
+	}
+
+	anomaly := m.detect(activity.calls, current)
+	if anomaly == nil || now.Before(activity.alertedUntil) {
+		return nil, nil
+	}
+	anomaly.Client = client
+	anomaly.Tool = tool
+	anomaly.Question = question
+	anomaly.DetectedAt = now
+	activity.alertedUntil = now.Add(m.window)
+	if m.throttle > 0 {
+		activity.throttledUntil = now.Add(m.throttle)
+		anomaly.ThrottledUntil = activity.throttledUntil
+		// Start afresh once the pause is over.
+		activity.calls = nil
+	}
+
+	slog.Warn("Escalation anomaly", "client", anomaly.Client, "tool", anomaly.Tool, "kind", anomaly.Kind, "detail", anomaly.String())
+	if m.webhook != "" {
+		go m.post(*anomaly)
+	}
+	return anomaly, nil
+}
+
+// detect checks the calls in the window, ending with current, for a loop
+// and then for an excessive rate.
+func (m *EscalationMonitor) detect(calls []monitoredCall, current monitoredCall) *Anomaly {
+	window := m.window.String()
+	if m.maxSimilar > 0 && len(current.keywords) > 0 {
+		similar := 0
+		for _, call := range calls {
+			if keywordSimilarity(call.keywords, current.keywords) >= loopSimilarityThreshold {
+				similar++
+			}
+		}
+		if similar >= m.maxSimilar {
+			return &Anomaly{Kind: "loop", Calls: similar, Window: window}
+		}
+	}
+	if m.maxCalls > 0 && len(calls) >= m.maxCalls {
+		return &Anomaly{Kind: "rate", Calls: len(calls), Window: window}
+	}
+	return nil
+}
+
+// keywordSimilarity is the Jaccard similarity of two keyword sets.
+func keywordSimilarity(a, b []string) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	set := make(map[string]bool, len(a))
+	for _, word := range a {
+		set[word] = true
+	}
+	shared := 0
+	for _, word := range b {
+		if set[word] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+func (m *EscalationMonitor) post(anomaly Anomaly) {
+	body, err := json.Marshal(anomaly)
+	if err != nil {
+		slog.Error("Couldn't encode anomaly", "error", err)
+		return
+	}
+	resp, err := m.httpClient.Post(m.webhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		slog.Warn("Couldn't post anomaly to webhook", "error", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		slog.Warn("Anomaly webhook rejected the anomaly", "status", resp.Status)
+	}
+}
+
+// escalatingTools are the tools that call a model, and so are monitored.
+var escalatingTools = map[string]bool{
+	"get_help":           true,
+	"get_second_opinion": true,
+	"get_help_batch":     true,
+	"brainstorm_options": true,
+	"reask_escalation":   true,
+}
+
+// observeEscalation reports a tool call to the monitor and the topic
+// cooldown. An anomaly is sent to the client as a warning; a throttled call,
+// or one on a topic that is cooling down, gets the content to return instead
+// of running the tool.
+func (s *MCPServer) observeEscalation(client, toolName string, arguments map[string]interface{}) ([]map[string]interface{}, error) {
+	if !escalatingTools[toolName] {
+		return nil, nil
+	}
+	if s.cooldown != nil {
+		override, _ := arguments[cooldownOverrideArgument].(bool)
+		if err := s.cooldown.Check(escalationQuestion(arguments), override); err != nil {
+			slog.Warn("Refusing escalation", "tool", toolName, "client", client, "error", err)
+			return textContent(fmt.Sprintf("Error: %v. Escalating the same problem again won't get a better answer: change strategy, gather new evidence, or ask a human. If the question really is new, call again with %s: true.", err, cooldownOverrideArgument)), err
+		}
+	}
+	if s.monitor == nil {
+		return nil, nil
+	}
+	anomaly, err := s.monitor.Observe(client, toolName, escalationQuestion(arguments))
+	if err != nil {
+		slog.Warn("Refusing escalation", "tool", toolName, "client", client, "error", err)
+		return textContent(fmt.Sprintf("Error: %v. Repeated escalations of the same question suggest a loop: step back, rethink the approach, or ask a human.", err)), err
+	}
+	if anomaly != nil && s.notify != nil {
+		s.notify("notifications/message", map[string]interface{}{
+			"level":  "warning",
+			"logger": "escalator",
+			"data":   "Escalation anomaly: " + anomaly.String(),
+		})
+	}
+	return nil, nil
+}
+
+// escalationQuestion returns the text an escalation asks about, for
+// comparing calls.
+func escalationQuestion(arguments map[string]interface{}) string {
+	for _, key := range []string{"question", "problem"} {
+		if text, ok := arguments[key].(string); ok && text != "" {
+			return text
+		}
+	}
+	return strings.Join(stringListArgument(arguments, "questions"), "\n")
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func newTestMonitor(maxCalls, maxSimilar int) (*EscalationMonitor, *time.Time) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	monitor := NewEscalationMonitor(10*time.Minute, maxCalls, maxSimilar)
+	monitor.now = func() time.Time { return now }
+	return monitor, &now
+}
+
+func TestEscalationMonitor_Loop(t *testing.T) {
+	monitor, now := newTestMonitor(0, 3)
+	questions := []string{
+		"Why does the checkout handler deadlock on the inventory mutex?",
+		"How do I fix the deadlock in the checkout handler inventory mutex?",
+		"Unrelated: which logging library should we use?",
+		"checkout handler deadlock inventory mutex - why?",
+	}
+
+	var anomalies []*Anomaly
+	for _, q := range questions {
+		*now = now.Add(time.Minute)
+		anomaly, err := monitor.Observe("agent", "get_help", q)
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if anomaly != nil {
+			anomalies = append(anomalies, anomaly)
+		}
+	}
+	if len(anomalies) != 1 || anomalies[0].Kind != "loop" || anomalies[0].Calls != 3 {
+		t.Fatalf("Expected one loop anomaly on the third variation, got %+v", anomalies)
+	}
+	if anomalies[0].Client != "agent" || anomalies[0].Question != questions[3] {
+		t.Errorf("Expected the anomaly to name the client and question, got %+v", anomalies[0])
+	}
+
+	// Already alerted for this window.
+	*now = now.Add(time.Minute)
+	if anomaly, _ := monitor.Observe("agent", "get_help", questions[0]); anomaly != nil {
+		t.Errorf("Expected no repeat alert within the window, got %+v", anomaly)
+	}
+	// Other clients are tracked separately.
+	if anomaly, _ := monitor.Observe("other", "get_help", questions[0]); anomaly != nil {
+		t.Errorf("Expected no anomaly for another client, got %+v", anomaly)
+	}
+}
+
+func TestEscalationMonitor_RateWindow(t *testing.T) {
+	monitor, now := newTestMonitor(3, 0)
+	for i := 0; i < 2; i++ {
+		if anomaly, _ := monitor.Observe("agent", "get_help", "q"); anomaly != nil {
+			t.Fatalf("Expected no anomaly yet, got %+v", anomaly)
+		}
+	}
+	// Calls outside the window no longer count.
+	*now = now.Add(11 * time.Minute)
+	if anomaly, _ := monitor.Observe("agent", "get_help", "q"); anomaly != nil {
+		t.Fatalf("Expected old calls to expire, got %+v", anomaly)
+	}
+	monitor.Observe("agent", "get_help", "q")
+	anomaly, _ := monitor.Observe("agent", "get_help", "q")
+	if anomaly == nil || anomaly.Kind != "rate" || anomaly.Calls != 3 {
+		t.Errorf("Expected a rate anomaly, got %+v", anomaly)
+	}
+}
+
+func TestEscalationMonitor_Throttle(t *testing.T) {
+	monitor, now := newTestMonitor(2, 0)
+	monitor.WithThrottle(5 * time.Minute)
+
+	monitor.Observe("agent", "get_help", "q")
+	anomaly, _ := monitor.Observe("agent", "get_help", "q")
+	if anomaly == nil || anomaly.ThrottledUntil.IsZero() {
+		t.Fatalf("Expected a throttling anomaly, got %+v", anomaly)
+	}
+	if _, err := monitor.Observe("agent", "get_help", "q"); !errors.Is(err, ErrThrottled) {
+		t.Errorf("Expected the client to be throttled, got %v", err)
+	}
+
+	*now = now.Add(6 * time.Minute)
+	if _, err := monitor.Observe("agent", "get_help", "q"); err != nil {
+		t.Errorf("Expected the throttle to lift, got %v", err)
+	}
+}
+
+func TestEscalationMonitor_Webhook(t *testing.T) {
+	received := make(chan Anomaly, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var anomaly Anomaly
+		json.NewDecoder(r.Body).Decode(&anomaly)
+		received <- anomaly
+	}))
+	defer srv.Close()
+
+	monitor, _ := newTestMonitor(1, 0)
+	monitor.WithWebhook(srv.URL)
+	monitor.Observe("agent", "get_help", "q")
+
+	select {
+	case anomaly := <-received:
+		if anomaly.Client != "agent" || anomaly.Kind != "rate" {
+			t.Errorf("Expected the anomaly to be posted, got %+v", anomaly)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a webhook call")
+	}
+}
+
+func TestMCPServer_HandleToolsCall_Throttled(t *testing.T) {
+	calls := 0
+	tool := NewGetHelpTool("", "o3")
+	tool.LLM().WithProvider(CompletionFunc(func(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error) {
+		calls++
+		return &Completion{Answer: "answer", Model: req.Model}, nil
+	}))
+	monitor, _ := newTestMonitor(0, 2)
+	monitor.WithThrottle(time.Hour)
+
+	server := NewMCPServer("test", "1.0.0").WithMonitor(monitor)
+	server.RegisterTool(tool)
+	server.recordClientCapabilities(json.RawMessage(`{"capabilities":{},"clientInfo":{"name":"looping-agent"}}`))
+	var warnings []interface{}
+	server.notify = func(method string, params interface{}) {
+		if p, ok := params.(map[string]interface{}); ok && p["level"] == "warning" {
+			warnings = append(warnings, p["data"])
+		}
+	}
+
+	params := json.RawMessage(`{"name":"get_help","arguments":{"question":"Why does the cache return stale entries?","summary":"s","fresh":true}}`)
+	for i := 0; i < 3; i++ {
+		server.HandleToolsCall(params)
+	}
+	result, _ := server.HandleToolsCall(params)
+	if !result.IsError {
+		t.Errorf("Expected the throttled call to fail, got %+v", result)
+	}
+	if calls != 2 {
+		t.Errorf("Expected throttled calls not to reach the model, got %d calls", calls)
+	}
+	if len(warnings) != 1 {
+		t.Errorf("Expected one warning notification, got %v", warnings)
+	}
+
+	// Non-escalating tools are never throttled.
+	server.RegisterTool(NewResetSessionTool(NewSessionStore(time.Hour)))
+	if result, _ := server.HandleToolsCall(json.RawMessage(`{"name":"reset_session","arguments":{"session_id":"s"}}`)); result.IsError {
+		t.Error("Expected reset_session not to be throttled")
+	}
+}
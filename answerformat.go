@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// Response formats get_help answers in.
+const (
+	responseFormatText = "text"
+	responseFormatJSON = "json"
+)
+
+// ArchitectAnswer is an answer given in JSON mode, for coding agents that
+// act on the answer rather than read it.
+type ArchitectAnswer struct {
+	Diagnosis  string   `json:"diagnosis"`
+	FixPlan    []string `json:"fix_plan"`
+	RiskLevel  string   `json:"risk_level"`
+	Confidence string   `json:"confidence"`
+}
+
+// architectAnswerSchema is the JSON schema answers are constrained to in
+// JSON mode. Strict schemas require every property.
+var architectAnswerSchema = json.RawMessage(`{
+  "type": "object",
+  "properties": {
+    "diagnosis": {"type": "string", "description": "What is wrong and why: the root cause, grounded in the code and context provided"},
+    "fix_plan": {"type": "array", "items": {"type": "string"}, "description": "Concrete, ordered steps to fix the problem, each naming the files, functions or commands involved"},
+    "risk_level": {"type": "string", "enum": ["low", "medium", "high"], "description": "Risk of the fix breaking something else"},
+    "confidence": {"type": "string", "enum": ["high", "medium", "low"], "description": "Confidence that the diagnosis is correct and complete for this specific project"}
+  },
+  "required": ["diagnosis", "fix_plan", "risk_level", "confidence"],
+  "additionalProperties": false
+}`)
+
+// architectResponseFormat asks OpenAI to enforce architectAnswerSchema.
+var architectResponseFormat = &openai.ChatCompletionResponseFormat{
+	Type: openai.ChatCompletionResponseFormatTypeJSONSchema,
+	JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{
+		Name:   "architect_answer",
+		Schema: architectAnswerSchema,
+		Strict: true,
+	},
+}
+
+var riskLevels = map[string]bool{"low": true, "medium": true, "high": true}
+
+// parseArchitectAnswer checks an answer against architectAnswerSchema.
+// OpenAI enforces the schema, but fallback models and gateways may not.
+func parseArchitectAnswer(text string) (*ArchitectAnswer, error) {
+	decoder := json.NewDecoder(strings.NewReader(text))
+	decoder.DisallowUnknownFields()
+	var answer ArchitectAnswer
+	if err := decoder.Decode(&answer); err != nil {
+		return nil, fmt.Errorf("answer is not the expected JSON: %w", err)
+	}
+	switch {
+	case strings.TrimSpace(answer.Diagnosis) == "":
+		return nil, fmt.Errorf("answer has no diagnosis")
+	case answer.FixPlan == nil:
+		return nil, fmt.Errorf("answer has no fix_plan")
+	case !riskLevels[answer.RiskLevel]:
+		return nil, fmt.Errorf("answer has an invalid risk_level %q", answer.RiskLevel)
+	}
+	if _, ok := confidenceLevels[answer.Confidence]; !ok {
+		return nil, fmt.Errorf("answer has an invalid confidence %q", answer.Confidence)
+	}
+	return &answer, nil
+}
+
+// jsonAnswer reports whether a call asks for a JSON answer with the
+// response_format argument, defaulting to the server's format.
+func (t *GetHelpTool) jsonAnswer(arguments map[string]interface{}) (bool, error) {
+	format, _ := arguments["response_format"].(string)
+	if format == "" {
+		format = t.responseFormat
+	}
+	switch format {
+	case responseFormatText, "":
+		return false, nil
+	case responseFormatJSON:
+		return true, nil
+	}
+	return false, fmt.Errorf("unknown response format %q (want text or json)", format)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestParseArchitectAnswer(t *testing.T) {
+	tests := []struct {
+		answer, err string
+	}{
+		{`{"diagnosis": "Replicas race.", "fix_plan": ["Take a lock."], "risk_level": "low", "confidence": "high"}`, ""},
+		{`{"diagnosis": "d", "fix_plan": [], "risk_level": "low", "confidence": "high", "notes": "n"}`, "not the expected JSON"},
+		{`{"diagnosis": "d", "fix_plan": [], "risk_level": "severe", "confidence": "high"}`, `invalid risk_level "severe"`},
+		{`{"diagnosis": " ", "fix_plan": [], "risk_level": "low", "confidence": "high"}`, "no diagnosis"},
+		{`{"diagnosis": "d", "risk_level": "low", "confidence": "high"}`, "no fix_plan"},
+		{`{"diagnosis": "d", "fix_plan": [], "risk_level": "low", "confidence": "sure"}`, `invalid confidence "sure"`},
+		{"Take a lock.", "not the expected JSON"},
+	}
+	for i, tt := range tests {
+		_, err := parseArchitectAnswer(tt.answer)
+		if tt.err == "" && err != nil {
+			t.Errorf("%d: expected no error, got %v", i, err)
+		}
+		if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("%d: expected an error containing %q, got %v", i, tt.err, err)
+		}
+	}
+}
+
+func TestGetHelpTool_JSONResponseFormat(t *testing.T) {
+	answer := `{"diagnosis": "Two replicas reconcile at once.", "fix_plan": ["Take an advisory lock.", "Add a test."], "risk_level": "medium", "confidence": "high"}`
+	var requests []openai.ChatCompletionRequest
+	tool := NewGetHelpTool("", "o3").WithCache(NewResponseCache(10, 0))
+	tool.LLM().WithProvider(CompletionFunc(func(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error) {
+		requests = append(requests, req)
+		if req.ResponseFormat != nil {
+			return &Completion{Answer: answer, Model: req.Model}, nil
+		}
+		return &Completion{Answer: "Take a lock.\n\nCONFIDENCE: low", Model: req.Model}, nil
+	}))
+	server := NewMCPServer("test", "1.0.0")
+	server.RegisterTool(tool)
+
+	want := map[string]interface{}{
+		"answer":               answer,
+		"confidence":           "high",
+		"suggested_next_steps": []string{"Take an advisory lock.", "Add a test."},
+		"references":           []string{},
+		"diagnosis":            "Two replicas reconcile at once.",
+		"risk_level":           "medium",
+	}
+	for _, call := range []string{"asked", "cached"} {
+		result, _ := server.HandleToolsCall(json.RawMessage(`{"name":"get_help","arguments":{"question":"Why?","summary":"s","response_format":"json"}}`))
+		if !reflect.DeepEqual(result.StructuredContent, want) {
+			t.Errorf("%s: expected structured content %v, got %v", call, want, result.StructuredContent)
+		}
+	}
+	if len(requests) != 1 {
+		t.Fatalf("Expected the second call to be cached, got %d requests", len(requests))
+	}
+	if requests[0].ResponseFormat != architectResponseFormat {
+		t.Errorf("Expected the answer schema to be enforced, got %+v", requests[0].ResponseFormat)
+	}
+	if prompt := requests[0].Messages[len(requests[0].Messages)-1].Content; strings.Contains(prompt, confidenceInstruction) {
+		t.Errorf("Expected no confidence instruction in JSON mode, got %q", prompt)
+	}
+
+	// A text answer to the same question isn't served the cached JSON.
+	result, _ := server.HandleToolsCall(json.RawMessage(`{"name":"get_help","arguments":{"question":"Why?","summary":"s"}}`))
+	if len(requests) != 2 || result.Content[0]["text"] != "Take a lock." {
+		t.Errorf("Expected a separate text answer, got %v", result.Content)
+	}
+}
+
+func TestGetHelpTool_JSONResponseFormat_Errors(t *testing.T) {
+	tool := NewGetHelpTool("", "o3").WithResponseFormat(responseFormatJSON)
+	tool.LLM().WithProvider(CompletionFunc(func(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error) {
+		return &Completion{Answer: "Take a lock.", Model: req.Model}, nil
+	}))
+
+	_, err := tool.Call(map[string]interface{}{"question": "Why?", "summary": "s"})
+	if err == nil || !strings.Contains(err.Error(), "didn't follow the response schema") {
+		t.Errorf("Expected a schema error for a prose answer, got %v", err)
+	}
+
+	_, err = tool.Call(map[string]interface{}{"question": "Why?", "summary": "s", "response_format": "yaml"})
+	if err == nil || !strings.Contains(err.Error(), `unknown response format "yaml"`) {
+		t.Errorf("Expected an unknown format error, got %v", err)
+	}
+}
@@ -0,0 +1,421 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+var (
+	// ErrApprovalPending is returned when a request held for approval
+	// wasn't decided in time. Asking again with the same request waits for
+	// the same approval.
+	ErrApprovalPending = errors.New("escalation is awaiting approval")
+	// ErrApprovalDenied is returned for a request an approver denied.
+	ErrApprovalDenied = errors.New("escalation was denied")
+)
+
+const (
+	// approvalCompletionEstimate is the completion size, in tokens, assumed
+	// when estimating a request's cost before it is sent.
+	approvalCompletionEstimate = 1000
+	// approvalRetention is how long approval requests and decisions are
+	// kept, so an escalation approved after its caller gave up waiting can
+	// be asked again.
+	approvalRetention = 24 * time.Hour
+	// maxApprovalExcerpt bounds the part of the request shown to approvers.
+	maxApprovalExcerpt = 1500
+)
+
+// ApprovalGate holds model requests that cost more than a threshold or
+// contain flagged content until a human approves them, through Slack or the
+// admin API. Some organizations require sign-off before code is sent to an
+// external provider.
+type ApprovalGate struct {
+	costThreshold float64
+	patterns      []*regexp.Regexp
+	wait          time.Duration
+	slackWebhook  string
+	slackSecret   string
+	adminToken    string
+	httpClient    *http.Client
+	now           func() time.Time
+
+	mu       sync.Mutex
+	requests map[string]*ApprovalRequest
+}
+
+// ApprovalRequest is a model request held for approval. It is also the
+// admin API's representation.
+type ApprovalRequest struct {
+	ID            string    `json:"id"`
+	Model         string    `json:"model"`
+	EstimatedCost float64   `json:"estimated_cost_usd"`
+	Reasons       []string  `json:"reasons"`
+	Excerpt       string    `json:"excerpt"`
+	RequestedAt   time.Time `json:"requested_at"`
+	Status        string    `json:"status"` // "pending", "approved" or "denied"
+	DecidedBy     string    `json:"decided_by,omitempty"`
+	DecidedAt     time.Time `json:"decided_at,omitzero"`
+
+	decided chan struct{}
+}
+
+// NewApprovalGate holds requests whose estimated cost is at least
+// costThreshold (zero disables the check) or that match any of patterns,
+// waiting up to wait for a decision before giving up.
+func NewApprovalGate(costThreshold float64, patterns []*regexp.Regexp, wait time.Duration) *ApprovalGate {
+	return &ApprovalGate{
+		costThreshold: costThreshold,
+		patterns:      patterns,
+		wait:          wait,
+		httpClient:    &http.Client{Timeout: 10 * time.Second},
+		now:           time.Now,
+		requests:      make(map[string]*ApprovalRequest),
+	}
+}
+
+// WithSlack posts each approval request with Approve and Deny buttons to a
+// Slack incoming webhook. Button clicks arrive at the handler's
+// /approvals/slack endpoint, signed with signingSecret.
+func (g *ApprovalGate) WithSlack(webhook, signingSecret string) *ApprovalGate {
+	g.slackWebhook = webhook
+	g.slackSecret = signingSecret
+	return g
+}
+
+// WithAdminToken enables the admin API for callers presenting token as a
+// bearer token.
+func (g *ApprovalGate) WithAdminToken(token string) *ApprovalGate {
+	g.adminToken = token
+	return g
+}
+
+// Approve returns nil when req may be sent to model: it needs no approval,
+// or an approver allowed it. Otherwise it waits for a decision and returns
+// an error wrapping ErrApprovalDenied or ErrApprovalPending.
+func (g *ApprovalGate) Approve(ctx context.Context, model string, req openai.ChatCompletionRequest) error {
+	text := requestText(req)
+	cost := estimateCost(model, estimateTokens(text), approvalCompletionEstimate)
+	var reasons []string
+	if g.costThreshold > 0 && cost >= g.costThreshold {
+		reasons = append(reasons, fmt.Sprintf("estimated cost $%.4f is at least $%.2f", cost, g.costThreshold))
+	}
+	for _, pattern := range g.patterns {
+		if pattern.MatchString(text) {
+			reasons = append(reasons, fmt.Sprintf("matches flagged pattern %q", pattern.String()))
+		}
+	}
+	if len(reasons) == 0 {
+		return nil
+	}
+
+	sum := sha256.Sum256([]byte(model + "\x00" + text))
+	id := hex.EncodeToString(sum[:8])
+
+	g.mu.Lock()
+	g.expire()
+	request, ok := g.requests[id]
+	if !ok {
+		request = &ApprovalRequest{
+			ID:            id,
+			Model:         model,
+			EstimatedCost: cost,
+			Reasons:       reasons,
+			Excerpt:       truncateMiddle(lastMessage(req), maxApprovalExcerpt),
+			RequestedAt:   g.now(),
+			Status:        "pending",
+			decided:       make(chan struct{}),
+		}
+		g.requests[id] = request
+	}
+	g.mu.Unlock()
+
+	if !ok {
+		slog.Info("Holding request for approval", "approval_id", id, "reasons", strings.Join(reasons, "; "))
+		if g.slackWebhook != "" {
+			go g.postToSlack(*request)
+		}
+	}
+
+	timer := time.NewTimer(g.wait)
+	defer timer.Stop()
+	select {
+	case <-request.decided:
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	switch request.Status {
+	case "approved":
+		// An approval covers one request.
+		delete(g.requests, id)
+		return nil
+	case "denied":
+		return fmt.Errorf("%w by %s (id %s)", ErrApprovalDenied, request.DecidedBy, id)
+	default:
+		return fmt.Errorf("%w (id %s); ask again once it is approved", ErrApprovalPending, id)
+	}
+}
+
+// Decide approves or denies the pending request id.
+func (g *ApprovalGate) Decide(id string, approved bool, by string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	request, ok := g.requests[id]
+	if !ok {
+		return fmt.Errorf("no approval request %s", id)
+	}
+	if request.Status != "pending" {
+		return fmt.Errorf("approval request %s was already %s by %s", id, request.Status, request.DecidedBy)
+	}
+	request.Status = "denied"
+	if approved {
+		request.Status = "approved"
+	}
+	request.DecidedBy = by
+	request.DecidedAt = g.now()
+	close(request.decided)
+	slog.Info("Approval request decided", "approval_id", id, "status", request.Status, "by", by)
+	return nil
+}
+
+// Requests returns the retained approval requests, oldest first.
+func (g *ApprovalGate) Requests() []ApprovalRequest {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.expire()
+	requests := make([]ApprovalRequest, 0, len(g.requests))
+	for _, request := range g.requests {
+		requests = append(requests, *request)
+	}
+	sort.Slice(requests, func(i, j int) bool { return requests[i].RequestedAt.Before(requests[j].RequestedAt) })
+	return requests
+}
+
+// expire drops requests older than approvalRetention. Callers hold mu.
+func (g *ApprovalGate) expire() {
+	cutoff := g.now().Add(-approvalRetention)
+	for id, request := range g.requests {
+		if request.RequestedAt.Before(cutoff) {
+			delete(g.requests, id)
+		}
+	}
+}
+
+// requestText joins the text of every message in req.
+func requestText(req openai.ChatCompletionRequest) string {
+	var b strings.Builder
+	for _, message := range req.Messages {
+		b.WriteString(message.Content)
+		for _, part := range message.MultiContent {
+			b.WriteString(part.Text)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func lastMessage(req openai.ChatCompletionRequest) string {
+	if len(req.Messages) == 0 {
+		return ""
+	}
+	return req.Messages[len(req.Messages)-1].Content
+}
+
+// Handler serves the admin API and the Slack interactivity endpoint:
+//
+//	GET  /approvals              lists approval requests
+//	POST /approvals/{id}/approve approves a request
+//	POST /approvals/{id}/deny    denies a request
+//	POST /approvals/slack        receives Slack button clicks
+func (g *ApprovalGate) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /approvals", g.admin(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(g.Requests())
+	}))
+	mux.HandleFunc("POST /approvals/{id}/approve", g.admin(g.handleDecision(true)))
+	mux.HandleFunc("POST /approvals/{id}/deny", g.admin(g.handleDecision(false)))
+	mux.HandleFunc("POST /approvals/slack", g.handleSlack)
+	return mux
+}
+
+// admin requires the admin token.
+func (g *ApprovalGate) admin(next http.HandlerFunc) http.HandlerFunc {
+	return adminOnly(g.adminToken, next)
+}
+
+// adminOnly requires callers to present token as a bearer token, and
+// refuses everyone when it isn't set.
+func adminOnly(adminToken string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if adminToken == "" {
+			http.Error(w, "the admin API is disabled; set ESCALATOR_ADMIN_TOKEN", http.StatusForbidden)
+			return
+		}
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (g *ApprovalGate) handleDecision(approved bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		by := r.URL.Query().Get("by")
+		if by == "" {
+			by = "admin API"
+		}
+		if err := g.Decide(r.PathValue("id"), approved, by); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// slackTimestampTolerance is how old a signed Slack request may be.
+const slackTimestampTolerance = 5 * time.Minute
+
+// slackAction is the part of a Slack block_actions payload the gate reads.
+type slackAction struct {
+	User struct {
+		Username string `json:"username"`
+	} `json:"user"`
+	ResponseURL string `json:"response_url"`
+	Actions     []struct {
+		ActionID string `json:"action_id"`
+		Value    string `json:"value"`
+	} `json:"actions"`
+}
+
+func (g *ApprovalGate) handleSlack(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, "couldn't read request", http.StatusBadRequest)
+		return
+	}
+	if !g.validSlackSignature(r.Header, body) {
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	var action slackAction
+	if err := json.Unmarshal([]byte(r.PostFormValue("payload")), &action); err != nil || len(action.Actions) == 0 {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+
+	approved := action.Actions[0].ActionID == "approve"
+	id := action.Actions[0].Value
+	text := fmt.Sprintf("Escalation %s approved by %s.", id, action.User.Username)
+	if !approved {
+		text = fmt.Sprintf("Escalation %s denied by %s.", id, action.User.Username)
+	}
+	if err := g.Decide(id, approved, action.User.Username); err != nil {
+		text = capitalize(err.Error()) + "."
+	}
+	if action.ResponseURL != "" {
+		go g.postJSON(action.ResponseURL, map[string]interface{}{"replace_original": true, "text": text})
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// validSlackSignature verifies Slack's request signature: an HMAC-SHA256 of
+// "v0:<timestamp>:<body>" keyed with the signing secret.
+func (g *ApprovalGate) validSlackSignature(header http.Header, body []byte) bool {
+	if g.slackSecret == "" {
+		return false
+	}
+	timestamp := header.Get("X-Slack-Request-Timestamp")
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	if age := g.now().Sub(time.Unix(seconds, 0)); age > slackTimestampTolerance || age < -slackTimestampTolerance {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(g.slackSecret))
+	fmt.Fprintf(mac, "v0:%s:%s", timestamp, body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(expected), []byte(header.Get("X-Slack-Signature")))
+}
+
+func (g *ApprovalGate) postToSlack(request ApprovalRequest) {
+	summary := fmt.Sprintf("*Escalation awaiting approval* (`%s`)\nModel: %s, estimated cost: $%.4f\nReason: %s",
+		request.ID, request.Model, request.EstimatedCost, strings.Join(request.Reasons, "; "))
+	g.postJSON(g.slackWebhook, map[string]interface{}{
+		"text": summary,
+		"blocks": []map[string]interface{}{
+			{"type": "section", "text": map[string]string{"type": "mrkdwn", "text": summary}},
+			{"type": "section", "text": map[string]string{"type": "mrkdwn", "text": "```" + strings.ReplaceAll(request.Excerpt, "```", "'''") + "```"}},
+			{"type": "actions", "elements": []map[string]interface{}{
+				{"type": "button", "action_id": "approve", "value": request.ID, "style": "primary", "text": map[string]string{"type": "plain_text", "text": "Approve"}},
+				{"type": "button", "action_id": "deny", "value": request.ID, "style": "danger", "text": map[string]string{"type": "plain_text", "text": "Deny"}},
+			}},
+		},
+	})
+}
+
+func (g *ApprovalGate) postJSON(url string, payload interface{}) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		slog.Error("Couldn't encode Slack message", "error", err)
+		return
+	}
+	resp, err := g.httpClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		slog.Warn("Couldn't post to Slack", "error", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		slog.Warn("Slack rejected the message", "status", resp.Status)
+	}
+}
+
+// patternFlag collects repeated flags whose values are regular expressions.
+type patternFlag []*regexp.Regexp
+
+func (p *patternFlag) repeatable() {}
+
+func (p *patternFlag) String() string {
+	patterns := make([]string, len(*p))
+	for i, re := range *p {
+		patterns[i] = re.String()
+	}
+	return strings.Join(patterns, ", ")
+}
+
+func (p *patternFlag) Set(value string) error {
+	re, err := regexp.Compile(value)
+	if err != nil {
+		return err
+	}
+	*p = append(*p, re)
+	return nil
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// waitForApprovalRequest returns the first pending request once the gate
+// holds one.
+func waitForApprovalRequest(t *testing.T, gate *ApprovalGate) ApprovalRequest {
+	t.Helper()
+	for range 200 {
+		if requests := gate.Requests(); len(requests) > 0 {
+			return requests[0]
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("Expected a request held for approval")
+	return ApprovalRequest{}
+}
+
+func TestApprovalGate(t *testing.T) {
+	gate := NewApprovalGate(0.1, []*regexp.Regexp{regexp.MustCompile(`(?i)confidential`)}, time.Second)
+	ctx := context.Background()
+
+	if err := gate.Approve(ctx, "o3", userRequest("Why does the reconciler deadlock?")); err != nil {
+		t.Errorf("Expected an ordinary request to pass, got %v", err)
+	}
+
+	flagged := userRequest("// CONFIDENTIAL: pricing engine\nfunc price() {}")
+	done := make(chan error)
+	go func() { done <- gate.Approve(ctx, "o3", flagged) }()
+	request := waitForApprovalRequest(t, gate)
+	if request.Status != "pending" || !strings.Contains(request.Reasons[0], "confidential") || !strings.Contains(request.Excerpt, "pricing engine") {
+		t.Errorf("Unexpected approval request %+v", request)
+	}
+	if err := gate.Decide(request.ID, true, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Expected the approved request to pass, got %v", err)
+	}
+	if len(gate.Requests()) != 0 {
+		t.Error("Expected an approval to be used up by its request")
+	}
+
+	// Large prompts cost more than the threshold; a denial is remembered.
+	large := userRequest(strings.Repeat("x", 400000))
+	go func() { done <- gate.Approve(ctx, "o3", large) }()
+	request = waitForApprovalRequest(t, gate)
+	if !strings.Contains(request.Reasons[0], "estimated cost") {
+		t.Errorf("Expected the cost to be the reason, got %v", request.Reasons)
+	}
+	gate.Decide(request.ID, false, "bob")
+	if err := <-done; !errors.Is(err, ErrApprovalDenied) || !strings.Contains(err.Error(), "bob") {
+		t.Errorf("Expected the request to be denied by bob, got %v", err)
+	}
+	if err := gate.Approve(ctx, "o3", large); !errors.Is(err, ErrApprovalDenied) {
+		t.Errorf("Expected the same request to stay denied, got %v", err)
+	}
+	if err := gate.Decide(request.ID, true, "carol"); err == nil {
+		t.Error("Expected a decided request not to be decided again")
+	}
+}
+
+func TestApprovalGate_Pending(t *testing.T) {
+	gate := NewApprovalGate(0, []*regexp.Regexp{regexp.MustCompile(`secret-project`)}, 10*time.Millisecond)
+	req := userRequest("secret-project question")
+
+	err := gate.Approve(context.Background(), "o3", req)
+	if !errors.Is(err, ErrApprovalPending) {
+		t.Fatalf("Expected the request to be pending, got %v", err)
+	}
+	requests := gate.Requests()
+	if len(requests) != 1 || !strings.Contains(err.Error(), requests[0].ID) {
+		t.Fatalf("Expected the pending request's id in the error, got %v and %+v", err, requests)
+	}
+
+	// Approved after the caller gave up: asking again goes through.
+	gate.Decide(requests[0].ID, true, "alice")
+	if err := gate.Approve(context.Background(), "o3", req); err != nil {
+		t.Errorf("Expected the re-asked request to pass, got %v", err)
+	}
+}
+
+func TestLLM_Generate_Approval(t *testing.T) {
+	calls := 0
+	gate := NewApprovalGate(0, []*regexp.Regexp{regexp.MustCompile(`internal-only`)}, 10*time.Millisecond)
+	llm := NewLLM("o3").WithApproval(gate).WithProvider(CompletionFunc(func(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error) {
+		calls++
+		return &Completion{Answer: "answer", Model: req.Model}, nil
+	}))
+
+	if _, err := llm.Generate(context.Background(), userRequest("internal-only code"), nil); !errors.Is(err, ErrApprovalPending) || calls != 0 {
+		t.Errorf("Expected the request to be held without calling the provider, got %v after %d calls", err, calls)
+	}
+	if _, err := llm.ForModel("gpt-4o").Generate(context.Background(), userRequest("public code"), nil); err != nil || calls != 1 {
+		t.Errorf("Expected an ordinary request to be sent, got %v after %d calls", err, calls)
+	}
+
+	content := failureContent(fmt.Errorf("wrapped: %w", ErrApprovalDenied))
+	if !strings.Contains(content[0]["text"].(string), "denied") {
+		t.Errorf("Expected a denial to be reported, got %v", content)
+	}
+}
+
+func TestApprovalGate_AdminAPI(t *testing.T) {
+	gate := NewApprovalGate(0, []*regexp.Regexp{regexp.MustCompile(`flagged`)}, time.Second).WithAdminToken("admin-token")
+	srv := httptest.NewServer(gate.Handler())
+	defer srv.Close()
+
+	do := func(method, path, token string) *http.Response {
+		req, _ := http.NewRequest(method, srv.URL+path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	done := make(chan error)
+	go func() { done <- gate.Approve(context.Background(), "o3", userRequest("flagged")) }()
+	request := waitForApprovalRequest(t, gate)
+
+	if resp := do("GET", "/approvals", "wrong"); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected a wrong token to be refused, got %s", resp.Status)
+	}
+	req, _ := http.NewRequest("GET", srv.URL+"/approvals", nil)
+	req.Header.Set("Authorization", "Bearer admin-token")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var listed []ApprovalRequest
+	json.NewDecoder(resp.Body).Decode(&listed)
+	resp.Body.Close()
+	if len(listed) != 1 || listed[0].ID != request.ID {
+		t.Errorf("Expected the pending request to be listed, got %+v", listed)
+	}
+
+	if resp := do("POST", "/approvals/"+request.ID+"/deny?by=security", "admin-token"); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected the denial to succeed, got %s", resp.Status)
+	}
+	if err := <-done; !errors.Is(err, ErrApprovalDenied) || !strings.Contains(err.Error(), "security") {
+		t.Errorf("Expected the request to be denied by security, got %v", err)
+	}
+	if resp := do("POST", "/approvals/"+request.ID+"/approve", "admin-token"); resp.StatusCode != http.StatusConflict {
+		t.Errorf("Expected approving a denied request to conflict, got %s", resp.Status)
+	}
+
+	disabled := httptest.NewServer(NewApprovalGate(1, nil, time.Second).Handler())
+	defer disabled.Close()
+	if resp, _ := http.Get(disabled.URL + "/approvals"); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected the admin API to be disabled without a token, got %s", resp.Status)
+	}
+}
+
+func TestApprovalGate_Slack(t *testing.T) {
+	var mu sync.Mutex
+	var posted []map[string]interface{}
+	slack := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var message map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&message)
+		mu.Lock()
+		posted = append(posted, message)
+		mu.Unlock()
+	}))
+	defer slack.Close()
+
+	gate := NewApprovalGate(0, []*regexp.Regexp{regexp.MustCompile(`flagged`)}, time.Second).WithSlack(slack.URL, "signing-secret")
+	srv := httptest.NewServer(gate.Handler())
+	defer srv.Close()
+
+	done := make(chan error)
+	go func() { done <- gate.Approve(context.Background(), "o3", userRequest("flagged code")) }()
+	request := waitForApprovalRequest(t, gate)
+
+	payload, _ := json.Marshal(map[string]interface{}{
+		"user":         map[string]string{"username": "alice"},
+		"response_url": slack.URL,
+		"actions":      []map[string]string{{"action_id": "approve", "value": request.ID}},
+	})
+	body := url.Values{"payload": {string(payload)}}.Encode()
+	click := func(secret string) int {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		mac := hmac.New(sha256.New, []byte(secret))
+		fmt.Fprintf(mac, "v0:%s:%s", timestamp, body)
+		req, _ := http.NewRequest("POST", srv.URL+"/approvals/slack", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("X-Slack-Request-Timestamp", timestamp)
+		req.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if code := click("forged"); code != http.StatusUnauthorized {
+		t.Errorf("Expected a forged click to be refused, got %d", code)
+	}
+	if code := click("signing-secret"); code != http.StatusOK {
+		t.Errorf("Expected the click to be accepted, got %d", code)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Expected the request to be approved, got %v", err)
+	}
+
+	for range 200 {
+		mu.Lock()
+		n := len(posted)
+		mu.Unlock()
+		if n >= 2 {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	var texts []string
+	for _, message := range posted {
+		texts = append(texts, message["text"].(string))
+	}
+	all := strings.Join(texts, "\n")
+	if !strings.Contains(all, "*Escalation awaiting approval* (`"+request.ID+"`)") || !strings.Contains(all, "Escalation "+request.ID+" approved by alice.") {
+		t.Errorf("Expected the request and the decision to be posted to Slack, got %v", texts)
+	}
+}
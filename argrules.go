@@ -0,0 +1,160 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"regexp"
+)
+
+// ArgumentRule transforms one tool argument before the tool sees it. Tool
+// "*" (or empty) matches every tool. Actions:
+//
+//   - drop removes the argument
+//   - mask replaces the value with [REDACTED]
+//   - hash replaces the value with [HASH:<12 hex digits of its SHA-256>], so
+//     equal values stay recognizably equal
+//   - replace substitutes Replacement (default [REDACTED]), which may refer
+//     to submatches as $1
+//
+// With a Pattern, mask, hash and replace apply only to the matching parts
+// of the value, e.g. to hash every file path in relevant_code.
+type ArgumentRule struct {
+	Tool        string `json:"tool"`
+	Argument    string `json:"argument"`
+	Action      string `json:"action"`
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement"`
+
+	pattern *regexp.Regexp
+}
+
+// ArgumentRules are the argument rules applied to every tool call, in
+// order, before it is monitored, logged, recorded or sent to a model.
+type ArgumentRules struct {
+	rules []ArgumentRule
+}
+
+// LoadArgumentRules reads a JSON array of rules from path.
+func LoadArgumentRules(path string) (*ArgumentRules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []ArgumentRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("couldn't parse argument rules: %w", err)
+	}
+	return NewArgumentRules(rules)
+}
+
+// NewArgumentRules validates rules and compiles their patterns.
+func NewArgumentRules(rules []ArgumentRule) (*ArgumentRules, error) {
+	for i := range rules {
+		rule := &rules[i]
+		if rule.Argument == "" {
+			return nil, fmt.Errorf("rule %d: argument is required", i+1)
+		}
+		switch rule.Action {
+		case "drop":
+			if rule.Pattern != "" {
+				return nil, fmt.Errorf("rule %d: drop takes no pattern", i+1)
+			}
+		case "mask", "hash":
+		case "replace":
+			if rule.Pattern == "" {
+				return nil, fmt.Errorf("rule %d: replace needs a pattern", i+1)
+			}
+		default:
+			return nil, fmt.Errorf("rule %d: unknown action %q (want drop, mask, hash or replace)", i+1, rule.Action)
+		}
+		if rule.Pattern != "" {
+			pattern, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d: %w", i+1, err)
+			}
+			rule.pattern = pattern
+		}
+	}
+	return &ArgumentRules{rules: rules}, nil
+}
+
+// Apply returns the arguments of a call to tool with the matching rules
+// applied. The caller's map is left untouched.
+func (r *ArgumentRules) Apply(tool string, arguments map[string]interface{}) map[string]interface{} {
+	if r == nil || arguments == nil {
+		return arguments
+	}
+	applied, cloned := arguments, false
+	for _, rule := range r.rules {
+		if rule.Tool != "" && rule.Tool != "*" && rule.Tool != tool {
+			continue
+		}
+		value, ok := applied[rule.Argument]
+		if !ok {
+			continue
+		}
+		if !cloned {
+			applied, cloned = maps.Clone(arguments), true
+		}
+		if rule.Action == "drop" {
+			delete(applied, rule.Argument)
+		} else {
+			applied[rule.Argument] = rule.transformValue(value)
+		}
+		slog.Info("Applied argument rule", "action", rule.Action, "tool", tool, "argument", rule.Argument)
+	}
+	return applied
+}
+
+// transformValue applies the rule to a string, or to each string in a
+// list. Other values are transformed as their JSON text.
+func (rule ArgumentRule) transformValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		return rule.transform(v)
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = rule.transformValue(item)
+		}
+		return out
+	case []string:
+		out := make([]string, len(v))
+		for i, item := range v {
+			out[i] = rule.transform(item)
+		}
+		return out
+	default:
+		text, _ := json.Marshal(v)
+		return rule.transform(string(text))
+	}
+}
+
+func (rule ArgumentRule) transform(text string) string {
+	replace := func(match string) string {
+		switch rule.Action {
+		case "hash":
+			sum := sha256.Sum256([]byte(match))
+			return "[HASH:" + hex.EncodeToString(sum[:6]) + "]"
+		case "mask":
+			return "[REDACTED]"
+		}
+		return match
+	}
+	if rule.pattern == nil {
+		return replace(text)
+	}
+	if rule.Action == "replace" {
+		replacement := rule.Replacement
+		if replacement == "" {
+			replacement = "[REDACTED]"
+		}
+		return rule.pattern.ReplaceAllString(text, replacement)
+	}
+	return rule.pattern.ReplaceAllStringFunc(text, replace)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestArgumentRules_Apply(t *testing.T) {
+	rules, err := NewArgumentRules([]ArgumentRule{
+		{Tool: "get_help", Argument: "environment", Action: "drop"},
+		{Argument: "relevant_code", Action: "hash", Pattern: `(?:[\w.-]+/)+[\w.-]+\.go`},
+		{Tool: "*", Argument: "question", Action: "replace", Pattern: `ACME-(\d+)`, Replacement: "TICKET-$1"},
+		{Argument: "resource_uris", Action: "mask"},
+		{Tool: "brainstorm_options", Argument: "summary", Action: "mask"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	arguments := map[string]interface{}{
+		"question":      "Why does ACME-42 fail?",
+		"summary":       "Inventory service",
+		"environment":   "prod-eu-1",
+		"relevant_code": "// internal/store/a.go\nfunc A() {}\n// internal/store/a.go again",
+		"resource_uris": []interface{}{"file:///home/me/secret.go"},
+	}
+	applied := rules.Apply("get_help", arguments)
+
+	hashed := rules.rules[1].transform("internal/store/a.go")
+	want := map[string]interface{}{
+		"question":      "Why does TICKET-42 fail?",
+		"summary":       "Inventory service",
+		"relevant_code": "// " + hashed + "\nfunc A() {}\n// " + hashed + " again",
+		"resource_uris": []interface{}{"[REDACTED]"},
+	}
+	if !reflect.DeepEqual(applied, want) {
+		t.Errorf("Expected %v, got %v", want, applied)
+	}
+	if !strings.HasPrefix(hashed, "[HASH:") || len(hashed) != len("[HASH:]")+12 {
+		t.Errorf("Expected a 12-digit hash, got %q", hashed)
+	}
+	if arguments["environment"] != "prod-eu-1" {
+		t.Error("Expected the caller's arguments to be left untouched")
+	}
+
+	if applied := rules.Apply("brainstorm_options", map[string]interface{}{"summary": "s", "environment": "prod"}); applied["summary"] != "[REDACTED]" || applied["environment"] != "prod" {
+		t.Errorf("Expected only the rules for brainstorm_options to apply, got %v", applied)
+	}
+	var none *ArgumentRules
+	if applied := none.Apply("get_help", arguments); !reflect.DeepEqual(applied, arguments) {
+		t.Error("Expected no rules to leave the arguments alone")
+	}
+}
+
+func TestLoadArgumentRules(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		rules, err string
+	}{
+		{`[{"tool": "get_help", "argument": "environment", "action": "drop"}]`, ""},
+		{`[{"argument": "question", "action": "encrypt"}]`, `unknown action "encrypt"`},
+		{`[{"argument": "question", "action": "replace"}]`, "needs a pattern"},
+		{`[{"action": "drop"}]`, "argument is required"},
+		{`[{"argument": "question", "action": "mask", "pattern": "("}]`, "rule 1:"},
+		{`{"argument": "question"}`, "couldn't parse"},
+	}
+	for i, tt := range tests {
+		path := filepath.Join(dir, "rules.json")
+		os.WriteFile(path, []byte(tt.rules), 0644)
+		_, err := LoadArgumentRules(path)
+		if tt.err == "" && err != nil {
+			t.Errorf("%d: expected no error, got %v", i, err)
+		}
+		if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("%d: expected an error containing %q, got %v", i, tt.err, err)
+		}
+	}
+}
+
+func TestMCPServer_ArgumentRules(t *testing.T) {
+	var prompt string
+	tool := NewGetHelpTool("", "o3")
+	tool.LLM().WithProvider(CompletionFunc(func(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error) {
+		prompt = req.Messages[len(req.Messages)-1].Content
+		return &Completion{Answer: "answer", Model: req.Model}, nil
+	}))
+	history := openTestHistory(t)
+	tool.WithHistory(history)
+
+	rules, _ := NewArgumentRules([]ArgumentRule{{Argument: "relevant_code", Action: "replace", Pattern: `customer-\d+`}})
+	server := NewMCPServer("test", "1.0.0").WithArgumentRules(rules)
+	server.RegisterTool(tool)
+	server.HandleToolsCall(json.RawMessage(`{"name":"get_help","arguments":{"question":"q","summary":"s","relevant_code":"load(customer-1234)"}}`))
+
+	if strings.Contains(prompt, "customer-1234") || !strings.Contains(prompt, "load([REDACTED])") {
+		t.Errorf("Expected the rule applied before the model call, got %q", prompt)
+	}
+	records, _ := history.Recent(1, "")
+	if len(records) != 1 || records[0].Arguments["relevant_code"] != "load([REDACTED])" {
+		t.Errorf("Expected the rule applied before recording, got %+v", records)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+// intArgument reads an integer tool argument, which arrives from JSON as a
+// float64, falling back to def when it is absent or not a number.
+func intArgument(arguments map[string]interface{}, key string, def int) int {
+	if v, ok := arguments[key].(float64); ok {
+		return int(v)
+	}
+	if v, ok := arguments[key].(int); ok {
+		return v
+	}
+	return def
+}
+
+// stringListArgument reads an array-of-strings tool argument, skipping any
+// non-string or empty entries.
+func stringListArgument(arguments map[string]interface{}, key string) []string {
+	var values []string
+	switch list := arguments[key].(type) {
+	case []interface{}:
+		for _, item := range list {
+			if s, ok := item.(string); ok && s != "" {
+				values = append(values, s)
+			}
+		}
+	case []string:
+		for _, s := range list {
+			if s != "" {
+				values = append(values, s)
+			}
+		}
+	}
+	return values
+}
+
+func clampInt(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
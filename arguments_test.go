@@ -0,0 +1,31 @@
+package main
+
+import "testing"
+
+func TestIntArgument(t *testing.T) {
+	args := map[string]interface{}{"n": float64(5), "s": "x"}
+	if intArgument(args, "n", 1) != 5 {
+		t.Error("Expected float64 argument to be read")
+	}
+	if intArgument(args, "s", 1) != 1 {
+		t.Error("Expected default for non-numeric argument")
+	}
+	if clampInt(10, 2, 6) != 6 || clampInt(0, 2, 6) != 2 {
+		t.Error("Expected clampInt to clamp to range")
+	}
+}
+
+func TestStringListArgument(t *testing.T) {
+	args := map[string]interface{}{
+		"uris":  []interface{}{"file:///a.go", 3, "", "file:///b.go"},
+		"plain": "not a list",
+	}
+
+	got := stringListArgument(args, "uris")
+	if len(got) != 2 || got[0] != "file:///a.go" || got[1] != "file:///b.go" {
+		t.Errorf("Expected two string entries, got %v", got)
+	}
+	if got := stringListArgument(args, "plain"); len(got) != 0 {
+		t.Errorf("Expected no entries for non-list argument, got %v", got)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// askSummary is the caller summary of a question asked from the terminal,
+// which has no agent to describe the project; the summary file still does.
+const askSummary = "Asked from the terminal with escalator ask, without an agent's summary."
+
+// runAsk answers a one-shot question with the fully configured get_help
+// tool, as if an MCP client had called it, and prints the answer. Code
+// piped to stdin is sent as the relevant code. The model, tokens and cost
+// go to errOut, so the answer can be redirected on its own.
+func runAsk(ctx context.Context, server *MCPServer, tool Tool, args []string, stdin io.Reader, out, errOut io.Writer) int {
+	question := strings.TrimSpace(strings.Join(args, " "))
+	if question == "" {
+		fmt.Fprintln(errOut, "Usage: escalator ask [flags] question  (code piped to stdin is sent as relevant code)")
+		return 2
+	}
+	arguments := map[string]interface{}{"question": question, "summary": askSummary}
+	if file, ok := stdin.(*os.File); stdin != nil && !(ok && isTerminal(file)) {
+		code, err := io.ReadAll(stdin)
+		if err != nil {
+			fmt.Fprintf(errOut, "Couldn't read relevant code from stdin: %v\n", err)
+			return 1
+		}
+		if text := strings.TrimSpace(string(code)); text != "" {
+			arguments["relevant_code"] = text
+		}
+	}
+
+	content, err := server.callTool(ctx, tool, arguments, nil)
+	meta := takeMeta(content)
+	var answer strings.Builder
+	for _, block := range content {
+		if text, ok := block["text"].(string); ok {
+			answer.WriteString(text)
+		}
+	}
+	if err != nil {
+		if answer.Len() > 0 {
+			fmt.Fprintln(errOut, answer.String())
+		}
+		fmt.Fprintf(errOut, "Couldn't get an answer: %v\n", err)
+		return 1
+	}
+
+	text := answer.String()
+	if color, _ := useColor("auto", out); color {
+		text = renderMarkdown(text)
+	}
+	fmt.Fprintln(out, strings.TrimRight(text, "\n"))
+	if usage, ok := meta["usage"].(*TokenUsage); ok {
+		fmt.Fprintf(errOut, "\n%s: %d prompt + %d completion tokens, $%.4f%s\n", usage.Model, usage.PromptTokens, usage.CompletionTokens, usage.CostUSD, cachedNote(usage))
+	}
+	return 0
+}
+
+func cachedNote(usage *TokenUsage) string {
+	if usage.Cached {
+		return " (cached)"
+	}
+	return ""
+}
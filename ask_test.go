@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestRunAsk(t *testing.T) {
+	var prompt string
+	tool := NewGetHelpTool("", "o3")
+	tool.LLM().WithProvider(CompletionFunc(func(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error) {
+		prompt = req.Messages[len(req.Messages)-1].Content
+		return &Completion{Answer: "Close the body.\nCONFIDENCE: high", Model: req.Model, PromptTokens: 1200, CompletionTokens: 80}, nil
+	}))
+	server := NewMCPServer("test", "1.0.0").WithTool(tool)
+
+	var out, errOut bytes.Buffer
+	stdin := strings.NewReader("resp, _ := http.Get(url)\n")
+	if code := runAsk(context.Background(), server, tool, []string{"Why", "does", "this", "leak?"}, stdin, &out, &errOut); code != 0 {
+		t.Fatalf("Expected an answer, got %d: %s", code, errOut.String())
+	}
+	if out.String() != "Close the body.\n" {
+		t.Errorf("Expected only the answer on stdout, got %q", out.String())
+	}
+	if !strings.Contains(prompt, "Why does this leak?") || !strings.Contains(prompt, "http.Get(url)") {
+		t.Errorf("Expected the question and piped code in the prompt, got:\n%s", prompt)
+	}
+	if !strings.Contains(errOut.String(), "o3: 1200 prompt + 80 completion tokens") {
+		t.Errorf("Expected the usage on stderr, got %q", errOut.String())
+	}
+
+	errOut.Reset()
+	if code := runAsk(context.Background(), server, tool, nil, nil, &out, &errOut); code != 2 || !strings.Contains(errOut.String(), "Usage: escalator ask") {
+		t.Errorf("Expected usage for a missing question, got %d: %s", code, errOut.String())
+	}
+}
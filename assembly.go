@@ -0,0 +1,201 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// PromptAssembly records the decisions that shaped a get_help prompt: the
+// context sources asked and what each returned, how the context compared
+// with the prompt budget, and what was sent of each section and why. It is
+// stored with the escalation, so `escalator explain` can answer "why did
+// it ignore my code" long after the fact.
+type PromptAssembly struct {
+	Sources []SourceDecision `json:"sources"`
+	// Budget is nil for session follow-ups, whose context isn't fitted.
+	Budget   *BudgetDecision   `json:"budget,omitempty"`
+	Sections []SectionDecision `json:"sections"`
+	// SummarySections ranks the summary's sections by their relevance to
+	// the question, the order in which they're dropped to fit.
+	SummarySections []SummaryDecision `json:"summary_sections,omitempty"`
+	FollowUp        bool              `json:"follow_up,omitempty"`
+}
+
+// SourceDecision is what one context source contributed.
+type SourceDecision struct {
+	Name      string `json:"name"`
+	Blocks    int    `json:"blocks"`
+	ElapsedMS int64  `json:"elapsed_ms"`
+}
+
+// BudgetDecision compares the prompt as first rendered with the limit.
+type BudgetDecision struct {
+	LimitBytes    int `json:"limit_bytes"`
+	RenderedBytes int `json:"rendered_bytes"`
+	FinalBytes    int `json:"final_bytes"`
+	// Condensed is set when the context was replaced by a digest.
+	Condensed bool `json:"condensed,omitempty"`
+}
+
+// SectionDecision is what was sent of one context section.
+type SectionDecision struct {
+	Name          string  `json:"name"`
+	Source        string  `json:"source,omitempty"`
+	Priority      int     `json:"priority,omitempty"`
+	Score         float64 `json:"score,omitempty"`
+	Provenance    string  `json:"provenance,omitempty"`
+	OriginalBytes int     `json:"original_bytes"`
+	SentBytes     int     `json:"sent_bytes"`
+	// Action is how the section was cut, as in ContextOmission, or empty
+	// when it was sent whole.
+	Action string `json:"action,omitempty"`
+}
+
+// SummaryDecision is one section of the summary file.
+type SummaryDecision struct {
+	Heading   string  `json:"heading"`
+	Relevance float64 `json:"relevance"`
+	Kept      bool    `json:"kept"`
+}
+
+// recordSection adds a context section as sent.
+func (a *PromptAssembly) recordSection(section *promptSection, omission *ContextOmission) {
+	decision := SectionDecision{
+		Name:          section.Name,
+		Source:        section.Source,
+		Priority:      section.Priority,
+		Score:         section.Score,
+		Provenance:    section.Provenance,
+		OriginalBytes: len(section.original),
+		SentBytes:     len(section.Text),
+	}
+	if omission != nil {
+		decision.Action = omission.Action
+	}
+	a.Sections = append(a.Sections, decision)
+}
+
+// recordSummary ranks the summary's sections as dropIrrelevantSections
+// does and notes which of them were sent.
+func (a *PromptAssembly) recordSummary(summary *promptSection, question string) {
+	sections := splitMarkdownSections(summary.original)
+	if len(sections) < 2 {
+		return
+	}
+	keywords := questionKeywords(question)
+	for _, section := range sections[1:] {
+		heading, _, _ := strings.Cut(section, "\n")
+		a.SummarySections = append(a.SummarySections, SummaryDecision{
+			Heading:   strings.TrimSpace(heading),
+			Relevance: relevance(section, keywords),
+			Kept:      strings.Contains(summary.Text, section),
+		})
+	}
+	sort.SliceStable(a.SummarySections, func(i, j int) bool {
+		return a.SummarySections[i].Relevance > a.SummarySections[j].Relevance
+	})
+}
+
+// formatAssembly explains how an escalation's prompt was put together.
+func formatAssembly(rec EscalationRecord) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Escalation %s (%s, %s, %s)\n", rec.ID, rec.Tool, rec.Model, rec.CreatedAt.Local().Format("2006-01-02 15:04"))
+	fmt.Fprintf(&b, "Question: %s\n", rec.Question)
+	a := rec.Assembly
+	if a == nil {
+		b.WriteString("\nNo assembly record: the escalation was made by an older version, imported, or answered without a prompt.\n")
+		return b.String()
+	}
+	if a.FollowUp {
+		b.WriteString("\nA follow-up in a session: the earlier turns carry the project context, so only the question and new context were added, without fitting to the budget.\n")
+	}
+
+	b.WriteString("\nContext sources asked:\n")
+	for _, source := range a.Sources {
+		note := ""
+		if source.Blocks == 0 {
+			note = "  (nothing to add for this question)"
+		}
+		fmt.Fprintf(&b, "  %-14s %3d blocks %6dms%s\n", source.Name, source.Blocks, source.ElapsedMS, note)
+	}
+
+	if budget := a.Budget; budget != nil {
+		b.WriteString("\nBudget:\n")
+		if excess := budget.RenderedBytes - budget.LimitBytes; excess > 0 {
+			fmt.Fprintf(&b, "  The prompt came to %d bytes against a limit of %d, %d over.\n", budget.RenderedBytes, budget.LimitBytes, excess)
+			if budget.Condensed {
+				b.WriteString("  The context was condensed into a digest by the compressor model.\n")
+			} else {
+				b.WriteString("  Context was cut by priority, lowest first. Within the highest priority, the summary's least\n  relevant sections were dropped before the largest sections were cut from the middle.\n")
+			}
+			fmt.Fprintf(&b, "  The prompt sent was %d bytes.\n", budget.FinalBytes)
+		} else {
+			fmt.Fprintf(&b, "  The prompt came to %d bytes against a limit of %d, so nothing was cut.\n", budget.RenderedBytes, budget.LimitBytes)
+		}
+	}
+
+	b.WriteString("\nSections, in prompt order:\n")
+	fmt.Fprintf(&b, "  %-36s %-14s %8s %6s %10s %10s  %s\n", "NAME", "SOURCE", "PRIORITY", "SCORE", "SENT", "ORIGINAL", "ACTION")
+	for _, section := range a.Sections {
+		score := ""
+		if section.Score != 0 {
+			score = fmt.Sprintf("%.2f", section.Score)
+		}
+		priority := ""
+		if section.Priority != 0 {
+			priority = fmt.Sprint(section.Priority)
+		}
+		action := section.Action
+		if action == "" {
+			action = "sent whole"
+		}
+		fmt.Fprintf(&b, "  %-36s %-14s %8s %6s %10d %10d  %s\n",
+			section.Name, section.Source, priority, score, section.SentBytes, section.OriginalBytes, action)
+		if section.Provenance != "" {
+			fmt.Fprintf(&b, "    labeled %s\n", section.Provenance)
+		}
+	}
+
+	if len(a.SummarySections) > 0 {
+		b.WriteString("\nSummary sections, most relevant to the question first:\n")
+		for _, section := range a.SummarySections {
+			kept := "kept"
+			if !section.Kept {
+				kept = "dropped"
+			}
+			fmt.Fprintf(&b, "  %.2f  %-8s %s\n", section.Relevance, kept, section.Heading)
+		}
+	}
+	return b.String()
+}
+
+// runExplainCommand implements `escalator explain id`.
+func runExplainCommand(args []string, out io.Writer) int {
+	fs := flag.NewFlagSet("explain", flag.ContinueOnError)
+	fs.SetOutput(out)
+	dbPath := fs.String("db", defaultHistoryPath(), "Path to the history database")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(out, "Usage: escalator explain [-db path] id")
+		return 2
+	}
+
+	store, err := OpenHistory(*dbPath)
+	if err != nil {
+		fmt.Fprintf(out, "Couldn't open history: %v\n", err)
+		return 1
+	}
+	defer store.Close()
+	rec, err := store.Get(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(out, "Couldn't find escalation %s: %v\n", fs.Arg(0), err)
+		return 1
+	}
+	fmt.Fprint(out, formatAssembly(*rec))
+	return 0
+}
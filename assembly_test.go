@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestGetHelpTool_RecordsAssembly(t *testing.T) {
+	dir := t.TempDir()
+	summaryPath := filepath.Join(dir, "PROJECT.md")
+	os.WriteFile(summaryPath, []byte("# Shop\nA web shop.\n## Billing\nInvoices are sent nightly.\n## Deploys\nBlue-green.\n"), 0644)
+	dbPath := filepath.Join(dir, "history.db")
+	history, err := OpenHistory(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tool := NewGetHelpTool(summaryPath, "o3").
+		WithHistory(history).
+		WithContextSource(&staticSource{blocks: []ContextBlock{
+			{Name: "wiki Billing", Text: strings.Repeat("Old billing notes. ", promptTextLimit/10), Priority: PriorityRetrieved, Score: 0.42},
+		}})
+	tool.LLM().WithProvider(CompletionFunc(func(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error) {
+		return &Completion{Answer: "Retry the invoice job.", Model: req.Model}, nil
+	}))
+	content, err := tool.Call(map[string]interface{}{"question": "Why do invoices fail?", "summary": "s", "relevant_code": "func send() {}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	history.Close()
+	id, _ := takeMeta(content)["escalation_id"].(string)
+
+	var out bytes.Buffer
+	if code := runExplainCommand([]string{"-db", dbPath, id}, &out); code != 0 {
+		t.Fatalf("Expected explain to succeed, got %d: %s", code, out.String())
+	}
+	got := out.String()
+	for _, want := range []string{
+		"Question: Why do invoices fail?",
+		"static           1 blocks",
+		"over.",
+		"wiki Billing",
+		"0.42",
+		"truncated",
+		"relevant_code",
+		"sent whole",
+		"## Billing",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Expected %q in the explanation:\n%s", want, got)
+		}
+	}
+}
+
+func TestFormatAssembly_NoRecord(t *testing.T) {
+	got := formatAssembly(EscalationRecord{ID: "abc", Tool: "get_help", Question: "q"})
+	if !strings.Contains(got, "No assembly record") {
+		t.Errorf("Expected records without an assembly to say so, got %q", got)
+	}
+}
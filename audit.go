@@ -0,0 +1,282 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// Kinds of audit entries.
+const (
+	auditToolCall  = "tool_call"
+	auditModelCall = "model_call"
+)
+
+// AuditEntry is one line of the audit log. A tool_call entry is what a
+// caller asked and was answered; a model_call entry is a request exactly as
+// it was sent to a model provider, and the reply.
+type AuditEntry struct {
+	Time      time.Time `json:"time"`
+	Kind      string    `json:"kind"`
+	RequestID string    `json:"request_id,omitempty"`
+	Client    string    `json:"client,omitempty"`
+	Tool      string    `json:"tool,omitempty"`
+	Model     string    `json:"model,omitempty"`
+	// Arguments are a tool call's arguments after argument rules.
+	Arguments map[string]interface{} `json:"arguments,omitempty"`
+	// Messages are a model call's prompt.
+	Messages         []AuditMessage `json:"messages,omitempty"`
+	Answer           string         `json:"answer,omitempty"`
+	PromptTokens     int            `json:"prompt_tokens,omitempty"`
+	CompletionTokens int            `json:"completion_tokens,omitempty"`
+	Error            string         `json:"error,omitempty"`
+	// Masked counts, by kind, what was masked from a model call's prompt
+	// before it was sent: secrets, and PII as pii:email and so on.
+	Masked map[string]int `json:"masked,omitempty"`
+	// Redactions counts secrets replaced in this entry by the audit log's
+	// own scanners.
+	Redactions int `json:"redactions,omitempty"`
+}
+
+// AuditMessage is one message of a model call's prompt.
+type AuditMessage struct {
+	Role    string `json:"role"`
+	Name    string `json:"name,omitempty"`
+	Content string `json:"content"`
+}
+
+// AuditLog records every escalation's full prompt and answer, with the
+// caller, as JSON lines, so compliance can show exactly what source code
+// was sent to a model provider. A nil *AuditLog records nothing. Entries
+// that can't be written are logged; auditing never fails an escalation.
+type AuditLog struct {
+	mu       sync.Mutex
+	out      io.Writer
+	redactor *Redactor
+}
+
+// OpenAuditLog appends to the file at path, rotated by size as for
+// -log-file, or, when path is a directory, to one file per day in it.
+func OpenAuditLog(path string, maxBytes int64, keep int) (*AuditLog, error) {
+	if info, err := os.Stat(path); (err == nil && info.IsDir()) || strings.HasSuffix(path, string(os.PathSeparator)) || strings.HasSuffix(path, "/") {
+		if err := os.MkdirAll(path, 0700); err != nil {
+			return nil, err
+		}
+		return &AuditLog{out: &dailyFile{dir: path}}, nil
+	}
+	file, err := OpenRotatingFile(path, maxBytes, keep)
+	if err != nil {
+		return nil, err
+	}
+	return &AuditLog{out: file}, nil
+}
+
+// WithRedactor replaces the secrets redactor's scanners find in entries
+// before they're written.
+func (a *AuditLog) WithRedactor(redactor *Redactor) *AuditLog {
+	a.redactor = redactor
+	return a
+}
+
+// Close closes the current file.
+func (a *AuditLog) Close() error {
+	if closer, ok := a.out.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// callerInfo identifies the tool call a model call is made for.
+type callerInfo struct {
+	RequestID string
+	Client    string
+	Tool      string
+}
+
+type callerContextKey struct{}
+
+func withCaller(ctx context.Context, caller callerInfo) context.Context {
+	return context.WithValue(ctx, callerContextKey{}, caller)
+}
+
+func callerFrom(ctx context.Context) callerInfo {
+	caller, _ := ctx.Value(callerContextKey{}).(callerInfo)
+	return caller
+}
+
+// ToolCall records a finished tool call and its answer.
+func (a *AuditLog) ToolCall(ctx context.Context, arguments map[string]interface{}, content []map[string]interface{}, meta map[string]interface{}, err error) {
+	if a == nil {
+		return
+	}
+	caller := callerFrom(ctx)
+	entry := AuditEntry{
+		Kind:      auditToolCall,
+		RequestID: caller.RequestID,
+		Client:    caller.Client,
+		Tool:      caller.Tool,
+		Arguments: arguments,
+		Answer:    contentText(content),
+	}
+	if usage, ok := meta["usage"].(*TokenUsage); ok {
+		entry.Model = usage.Model
+		entry.PromptTokens = usage.PromptTokens
+		entry.CompletionTokens = usage.CompletionTokens
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	a.write(ctx, entry)
+}
+
+// ModelCall records a request sent to a model, with the counts of what was
+// masked from it, and its reply or error.
+func (a *AuditLog) ModelCall(ctx context.Context, req openai.ChatCompletionRequest, completion *Completion, masked map[string]int, err error) {
+	if a == nil {
+		return
+	}
+	caller := callerFrom(ctx)
+	entry := AuditEntry{
+		Kind:      auditModelCall,
+		RequestID: caller.RequestID,
+		Client:    caller.Client,
+		Tool:      caller.Tool,
+		Model:     req.Model,
+	}
+	if len(masked) > 0 {
+		entry.Masked = masked
+	}
+	for _, message := range req.Messages {
+		content := message.Content
+		for _, part := range message.MultiContent {
+			if part.Type == openai.ChatMessagePartTypeText {
+				content += part.Text
+			}
+		}
+		entry.Messages = append(entry.Messages, AuditMessage{Role: message.Role, Name: message.Name, Content: content})
+	}
+	if completion != nil {
+		entry.Model = completion.Model
+		entry.Answer = completion.Answer
+		entry.PromptTokens = completion.PromptTokens
+		entry.CompletionTokens = completion.CompletionTokens
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	a.write(ctx, entry)
+}
+
+func (a *AuditLog) write(ctx context.Context, entry AuditEntry) {
+	entry.Time = time.Now().UTC()
+	if a.redactor != nil {
+		if err := a.redact(context.WithoutCancel(ctx), &entry); err != nil {
+			// An entry that can't be scanned isn't written at all rather
+			// than written with secrets in it.
+			slog.Error("Couldn't scan an audit entry for secrets; it was not written", "kind", entry.Kind, "tool", entry.Tool, "error", err)
+			return
+		}
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		slog.Error("Couldn't encode an audit entry", "kind", entry.Kind, "tool", entry.Tool, "error", err)
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, err := a.out.Write(append(line, '\n')); err != nil {
+		slog.Error("Couldn't write an audit entry", "kind", entry.Kind, "tool", entry.Tool, "error", err)
+	}
+}
+
+// redact replaces secrets in every text the entry carries.
+func (a *AuditLog) redact(ctx context.Context, entry *AuditEntry) error {
+	redact := func(text string) (string, error) {
+		redacted, findings, err := a.redactor.Redact(ctx, text)
+		entry.Redactions += len(findings)
+		return redacted, err
+	}
+	var err error
+	for i := range entry.Messages {
+		if entry.Messages[i].Content, err = redact(entry.Messages[i].Content); err != nil {
+			return err
+		}
+	}
+	if entry.Answer, err = redact(entry.Answer); err != nil {
+		return err
+	}
+	if entry.Arguments != nil {
+		arguments, err := redactValue(entry.Arguments, redact)
+		if err != nil {
+			return err
+		}
+		entry.Arguments = arguments.(map[string]interface{})
+	}
+	return nil
+}
+
+// redactValue redacts every string in a decoded JSON value.
+func redactValue(value interface{}, redact func(string) (string, error)) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		return redact(v)
+	case []interface{}:
+		redacted := make([]interface{}, len(v))
+		for i, item := range v {
+			var err error
+			if redacted[i], err = redactValue(item, redact); err != nil {
+				return nil, err
+			}
+		}
+		return redacted, nil
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			var err error
+			if redacted[key], err = redactValue(item, redact); err != nil {
+				return nil, err
+			}
+		}
+		return redacted, nil
+	}
+	return value, nil
+}
+
+// dailyFile writes to audit-YYYY-MM-DD.jsonl in dir, by UTC date, moving
+// on to a new file at midnight.
+type dailyFile struct {
+	dir  string
+	day  string
+	file *os.File
+}
+
+func (d *dailyFile) Write(p []byte) (int, error) {
+	if day := time.Now().UTC().Format("2006-01-02"); day != d.day || d.file == nil {
+		if d.file != nil {
+			d.file.Close()
+		}
+		file, err := os.OpenFile(filepath.Join(d.dir, fmt.Sprintf("audit-%s.jsonl", day)), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			d.file = nil
+			return 0, err
+		}
+		d.file, d.day = file, day
+	}
+	return d.file.Write(p)
+}
+
+func (d *dailyFile) Close() error {
+	if d.file == nil {
+		return nil
+	}
+	return d.file.Close()
+}
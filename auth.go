@@ -0,0 +1,333 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// APIKey is a static credential for the HTTP endpoints. The key can be
+// given as its SHA-256 instead, so the keys file needn't hold secrets.
+type APIKey struct {
+	Name      string `json:"name"`
+	Key       string `json:"key,omitempty"`
+	KeySHA256 string `json:"key_sha256,omitempty"`
+}
+
+// LoadAPIKeys reads a JSON array of API keys.
+func LoadAPIKeys(path string) ([]APIKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var keys []APIKey
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("couldn't parse %s: %w", path, err)
+	}
+	names := make(map[string]bool)
+	for i, key := range keys {
+		if key.Name == "" || (key.Key == "") == (key.KeySHA256 == "") {
+			return nil, fmt.Errorf("%s: key %d needs a name and either key or key_sha256", path, i+1)
+		}
+		if names[key.Name] {
+			return nil, fmt.Errorf("%s: two keys are named %q; names identify callers in logs and metrics", path, key.Name)
+		}
+		names[key.Name] = true
+	}
+	return keys, nil
+}
+
+// HTTPAuth authenticates callers of the HTTP endpoints with a bearer token:
+// a static API key, also accepted as X-API-Key, or an OAuth 2 access token
+// issued for this server. The caller is identified by the key's name or the
+// token's client, which stands in for X-Client-Name in logs, throttling and
+// feature flags. A nil *HTTPAuth lets everyone in.
+type HTTPAuth struct {
+	// keys maps the SHA-256 of each key to its name.
+	keys    map[string]string
+	oauth   *OAuthValidator
+	metrics *Metrics
+}
+
+func NewHTTPAuth() *HTTPAuth {
+	return &HTTPAuth{keys: make(map[string]string)}
+}
+
+// WithKeys accepts the given API keys.
+func (a *HTTPAuth) WithKeys(keys []APIKey) *HTTPAuth {
+	for _, key := range keys {
+		hash := strings.ToLower(key.KeySHA256)
+		if key.Key != "" {
+			sum := sha256.Sum256([]byte(key.Key))
+			hash = hex.EncodeToString(sum[:])
+		}
+		a.keys[hash] = key.Name
+	}
+	return a
+}
+
+// WithOAuth accepts access tokens the validator accepts.
+func (a *HTTPAuth) WithOAuth(validator *OAuthValidator) *HTTPAuth {
+	a.oauth = validator
+	return a
+}
+
+// WithMetrics counts authentications by caller and result.
+func (a *HTTPAuth) WithMetrics(metrics *Metrics) *HTTPAuth {
+	a.metrics = metrics
+	return a
+}
+
+type principalContextKey struct{}
+
+// principalFrom returns the authenticated caller of an HTTP request, or ""
+// when the server doesn't authenticate.
+func principalFrom(ctx context.Context) string {
+	principal, _ := ctx.Value(principalContextKey{}).(string)
+	return principal
+}
+
+// Require refuses requests without valid credentials, with a
+// WWW-Authenticate challenge pointing OAuth clients at the server's
+// protected resource metadata.
+func (a *HTTPAuth) Require(next http.HandlerFunc) http.HandlerFunc {
+	if a == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, err := a.authenticate(r)
+		if err != nil {
+			a.metrics.Auth("none", false)
+			slog.Warn("Refused an unauthenticated HTTP request", "path", r.URL.Path, "remote", r.RemoteAddr, "error", err)
+			challenge := `Bearer realm="escalator"`
+			if a.oauth != nil {
+				challenge += fmt.Sprintf(`, resource_metadata=%q`, a.oauth.metadataURL())
+			}
+			if !errors.Is(err, errNoCredentials) {
+				challenge += `, error="invalid_token"`
+			}
+			w.Header().Set("WWW-Authenticate", challenge)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		a.metrics.Auth(principal, true)
+		next(w, r.WithContext(context.WithValue(r.Context(), principalContextKey{}, principal)))
+	}
+}
+
+var errNoCredentials = errors.New("no credentials")
+
+// authenticate returns the caller's name: the API key's name, or
+// oauth:<client> for an access token.
+func (a *HTTPAuth) authenticate(r *http.Request) (string, error) {
+	token := r.Header.Get("X-API-Key")
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		token = strings.TrimSpace(bearer)
+	}
+	if token == "" {
+		return "", errNoCredentials
+	}
+	sum := sha256.Sum256([]byte(token))
+	if name, ok := a.keys[hex.EncodeToString(sum[:])]; ok {
+		return name, nil
+	}
+	if a.oauth == nil {
+		return "", errors.New("unknown API key")
+	}
+	client, err := a.oauth.Validate(r.Context(), token)
+	if err != nil {
+		return "", err
+	}
+	return "oauth:" + client, nil
+}
+
+// oauthCacheTTL caps how long an introspected token is trusted without
+// asking again, so revocations take effect.
+const oauthCacheTTL = 5 * time.Minute
+
+// OAuthValidator checks OAuth 2 access tokens for the server as an MCP
+// authorization resource server: tokens are introspected (RFC 7662) at the
+// authorization server, and must be active and issued for this server's
+// resource URL.
+type OAuthValidator struct {
+	issuer           string
+	resource         string
+	introspectionURL string
+	clientID         string
+	clientSecret     string
+	httpClient       *http.Client
+
+	mu    sync.Mutex
+	cache map[string]introspectedToken
+}
+
+type introspectedToken struct {
+	client  string
+	expires time.Time
+}
+
+// NewOAuthValidator accepts tokens from the authorization server at issuer
+// for resource, the server's own URL.
+func NewOAuthValidator(issuer, resource string) *OAuthValidator {
+	return &OAuthValidator{
+		issuer:     strings.TrimSuffix(issuer, "/"),
+		resource:   strings.TrimSuffix(resource, "/"),
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		cache:      make(map[string]introspectedToken),
+	}
+}
+
+// WithIntrospection sets the introspection endpoint and the client
+// credentials the server authenticates to it with.
+func (v *OAuthValidator) WithIntrospection(endpoint, clientID, clientSecret string) *OAuthValidator {
+	v.introspectionURL = endpoint
+	v.clientID = clientID
+	v.clientSecret = clientSecret
+	return v
+}
+
+// Discover finds the introspection endpoint in the authorization server's
+// metadata (RFC 8414) when none was given.
+func (v *OAuthValidator) Discover(ctx context.Context) error {
+	if v.introspectionURL != "" {
+		return nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.issuer+"/.well-known/oauth-authorization-server", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := v.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("authorization server metadata: %s", resp.Status)
+	}
+	var metadata struct {
+		IntrospectionEndpoint string `json:"introspection_endpoint"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&metadata); err != nil {
+		return fmt.Errorf("authorization server metadata: %w", err)
+	}
+	if metadata.IntrospectionEndpoint == "" {
+		return errors.New("the authorization server doesn't advertise an introspection endpoint")
+	}
+	v.introspectionURL = metadata.IntrospectionEndpoint
+	return nil
+}
+
+// Validate returns the client a token was issued to.
+func (v *OAuthValidator) Validate(ctx context.Context, token string) (string, error) {
+	sum := sha256.Sum256([]byte(token))
+	key := hex.EncodeToString(sum[:])
+	v.mu.Lock()
+	cached, ok := v.cache[key]
+	v.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.client, nil
+	}
+
+	form := url.Values{"token": {token}, "token_type_hint": {"access_token"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.introspectionURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if v.clientID != "" {
+		req.SetBasicAuth(url.QueryEscape(v.clientID), url.QueryEscape(v.clientSecret))
+	}
+	resp, err := v.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("couldn't introspect the token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("couldn't introspect the token: %s", resp.Status)
+	}
+	var introspection struct {
+		Active   bool            `json:"active"`
+		ClientID string          `json:"client_id"`
+		Subject  string          `json:"sub"`
+		Audience json.RawMessage `json:"aud"`
+		Expires  int64           `json:"exp"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&introspection); err != nil {
+		return "", fmt.Errorf("couldn't introspect the token: %w", err)
+	}
+	if !introspection.Active {
+		return "", errors.New("the token isn't active")
+	}
+	if !v.forResource(introspection.Audience) {
+		return "", fmt.Errorf("the token wasn't issued for %s", v.resource)
+	}
+
+	client := introspection.ClientID
+	if client == "" {
+		client = introspection.Subject
+	}
+	expires := time.Now().Add(oauthCacheTTL)
+	if introspection.Expires > 0 && time.Unix(introspection.Expires, 0).Before(expires) {
+		expires = time.Unix(introspection.Expires, 0)
+	}
+	v.mu.Lock()
+	for k, t := range v.cache {
+		if time.Now().After(t.expires) {
+			delete(v.cache, k)
+		}
+	}
+	v.cache[key] = introspectedToken{client: client, expires: expires}
+	v.mu.Unlock()
+	return client, nil
+}
+
+// forResource reports whether aud, a string or a list of them, names the
+// server's resource. Tokens meant for another service are refused, so one
+// can't be replayed here.
+func (v *OAuthValidator) forResource(aud json.RawMessage) bool {
+	var audiences []string
+	if json.Unmarshal(aud, &audiences) != nil {
+		var single string
+		if json.Unmarshal(aud, &single) != nil {
+			return false
+		}
+		audiences = []string{single}
+	}
+	for _, audience := range audiences {
+		if strings.TrimSuffix(audience, "/") == v.resource {
+			return true
+		}
+	}
+	return false
+}
+
+// protectedResourcePath is where OAuth clients find which authorization
+// server issues tokens for the server (RFC 9728).
+const protectedResourcePath = "/.well-known/oauth-protected-resource"
+
+func (v *OAuthValidator) metadataURL() string {
+	return v.resource + protectedResourcePath
+}
+
+// MetadataHandler serves the protected resource metadata.
+func (v *OAuthValidator) MetadataHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"resource":                 v.resource,
+			"authorization_servers":    []string{v.issuer},
+			"bearer_methods_supported": []string{"header"},
+		})
+	})
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// newAuthTestHandler serves get_help behind auth, with a client answering
+// with the caller's name.
+func newAuthTestHandler(auth *HTTPAuth) http.HandlerFunc {
+	tool := NewGetHelpTool("", "o3")
+	tool.LLM().WithProvider(CompletionFunc(func(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error) {
+		return &Completion{Answer: "Add an index.", Model: req.Model}, nil
+	}))
+	server := NewMCPServer("test", "1.0.0")
+	server.RegisterTool(tool)
+	return auth.Require(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Caller", httpClientName(r))
+		server.HandleHTTP(w, r)
+	})
+}
+
+func authRequest(handler http.HandlerFunc, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/get_help", strings.NewReader(`{"question":"Why is it slow?","summary":"s"}`))
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+func TestHTTPAuth_APIKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	sum := sha256.Sum256([]byte("deploy-key"))
+	os.WriteFile(path, []byte(`[{"name": "ci", "key": "ci-key"}, {"name": "deploy", "key_sha256": "`+hex.EncodeToString(sum[:])+`"}]`), 0600)
+	keys, err := LoadAPIKeys(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics := NewMetrics()
+	handler := newAuthTestHandler(NewHTTPAuth().WithKeys(keys).WithMetrics(metrics))
+
+	rec := authRequest(handler, nil)
+	if rec.Code != http.StatusUnauthorized || !strings.HasPrefix(rec.Header().Get("WWW-Authenticate"), "Bearer") {
+		t.Errorf("Expected a request without a key refused with a challenge, got %d %q", rec.Code, rec.Header().Get("WWW-Authenticate"))
+	}
+	if rec := authRequest(handler, map[string]string{"Authorization": "Bearer wrong"}); rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Header().Get("WWW-Authenticate"), "invalid_token") {
+		t.Errorf("Expected an unknown key refused as an invalid token, got %d %q", rec.Code, rec.Header().Get("WWW-Authenticate"))
+	}
+
+	rec = authRequest(handler, map[string]string{"Authorization": "Bearer ci-key", "X-Client-Name": "spoofed"})
+	if rec.Code != http.StatusOK || rec.Header().Get("X-Caller") != "ci" {
+		t.Errorf("Expected the caller identified by the key's name, got %d %q", rec.Code, rec.Header().Get("X-Caller"))
+	}
+	if rec := authRequest(handler, map[string]string{"X-API-Key": "deploy-key"}); rec.Code != http.StatusOK || rec.Header().Get("X-Caller") != "deploy" {
+		t.Errorf("Expected a hashed key accepted as X-API-Key, got %d %q", rec.Code, rec.Header().Get("X-Caller"))
+	}
+
+	got := scrape(t, metrics)
+	for _, want := range []string{
+		`escalator_http_auth_total{principal="ci",result="ok"} 1`,
+		`escalator_http_auth_total{principal="deploy",result="ok"} 1`,
+		`escalator_http_auth_total{principal="none",result="denied"} 2`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Expected %q in the metrics:\n%s", want, got)
+		}
+	}
+
+	os.WriteFile(path, []byte(`[{"name": "ci", "key": "a"}, {"name": "ci", "key": "b"}]`), 0600)
+	if _, err := LoadAPIKeys(path); err == nil {
+		t.Error("Expected two keys with one name to be refused")
+	}
+}
+
+func TestHTTPAuth_OAuth(t *testing.T) {
+	const resource = "https://escalator.internal"
+	introspections := 0
+	var issuer *httptest.Server
+	issuer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/oauth-authorization-server":
+			json.NewEncoder(w).Encode(map[string]string{"issuer": issuer.URL, "introspection_endpoint": issuer.URL + "/introspect"})
+		case "/introspect":
+			introspections++
+			if id, secret, _ := r.BasicAuth(); id != "escalator" || secret != "s3cret" {
+				http.Error(w, "bad client", http.StatusUnauthorized)
+				return
+			}
+			switch r.FormValue("token") {
+			case "good":
+				json.NewEncoder(w).Encode(map[string]interface{}{"active": true, "client_id": "claude-code", "aud": []string{resource}})
+			case "elsewhere":
+				json.NewEncoder(w).Encode(map[string]interface{}{"active": true, "client_id": "claude-code", "aud": "https://other.internal"})
+			default:
+				json.NewEncoder(w).Encode(map[string]interface{}{"active": false})
+			}
+		}
+	}))
+	defer issuer.Close()
+
+	validator := NewOAuthValidator(issuer.URL, resource).WithIntrospection("", "escalator", "s3cret")
+	if err := validator.Discover(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	handler := newAuthTestHandler(NewHTTPAuth().WithOAuth(validator))
+
+	rec := authRequest(handler, nil)
+	if challenge := rec.Header().Get("WWW-Authenticate"); rec.Code != http.StatusUnauthorized || !strings.Contains(challenge, `resource_metadata="https://escalator.internal/.well-known/oauth-protected-resource"`) {
+		t.Errorf("Expected the challenge to point at the resource metadata, got %d %q", rec.Code, challenge)
+	}
+	for _, token := range []string{"elsewhere", "revoked"} {
+		if rec := authRequest(handler, map[string]string{"Authorization": "Bearer " + token}); rec.Code != http.StatusUnauthorized {
+			t.Errorf("Expected token %q refused, got %d", token, rec.Code)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if rec := authRequest(handler, map[string]string{"Authorization": "Bearer good"}); rec.Code != http.StatusOK || rec.Header().Get("X-Caller") != "oauth:claude-code" {
+			t.Errorf("Expected a token for this server accepted, got %d %q", rec.Code, rec.Header().Get("X-Caller"))
+		}
+	}
+	if introspections != 3 {
+		t.Errorf("Expected an accepted token introspected once, got %d introspections", introspections)
+	}
+
+	rec = httptest.NewRecorder()
+	validator.MetadataHandler().ServeHTTP(rec, httptest.NewRequest("GET", protectedResourcePath, nil))
+	var metadata struct {
+		Resource             string   `json:"resource"`
+		AuthorizationServers []string `json:"authorization_servers"`
+	}
+	json.NewDecoder(rec.Body).Decode(&metadata)
+	if metadata.Resource != resource || len(metadata.AuthorizationServers) != 1 || metadata.AuthorizationServers[0] != issuer.URL {
+		t.Errorf("Expected the protected resource metadata, got %+v", metadata)
+	}
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	minBatchQuestions = 2
+	maxBatchQuestions = 8
+
+	// batchCombineTokens is how many prompt tokens of repeated context a
+	// combined call must save before mode auto prefers it to asking each
+	// question on its own.
+	batchCombineTokens = 4000
+)
+
+// Ways of answering a batch.
+const (
+	batchModeAuto     = "auto"
+	batchModeParallel = "parallel"
+	batchModeCombined = "combined"
+)
+
+// BatchHelpTool answers several independent questions that share one
+// context, for agents that collect blockers before escalating. Questions
+// are asked in parallel, each with the full context, or together in one
+// call that sends the context once.
+type BatchHelpTool struct {
+	help *GetHelpTool
+}
+
+func NewBatchHelpTool(help *GetHelpTool) *BatchHelpTool {
+	return &BatchHelpTool{help: help}
+}
+
+// batchAnswer is the result for one question of a batch.
+type batchAnswer struct {
+	Question   string
+	Answer     string
+	Confidence string
+	Err        error
+
+	calls []*Completion
+}
+
+func (t *BatchHelpTool) Name() string {
+	return "get_help_batch"
+}
+
+func (t *BatchHelpTool) Category() string {
+	return "escalation"
+}
+
+func (t *BatchHelpTool) Description() string {
+	return "Ask several independent questions about the same context at once and get an answer for each"
+}
+
+func (t *BatchHelpTool) Schema() map[string]interface{} {
+	schema := t.help.Schema()
+	properties := make(map[string]interface{})
+	for name, prop := range schema["properties"].(map[string]interface{}) {
+		properties[name] = prop
+	}
+	// Batches are one-off questions answered fresh by the server's models,
+	// in prose.
+	delete(properties, "question")
+	delete(properties, "model")
+	delete(properties, "session_id")
+	delete(properties, "response_format")
+	delete(properties, "fresh")
+	properties["questions"] = map[string]interface{}{
+		"type":        "array",
+		"items":       map[string]interface{}{"type": "string"},
+		"minItems":    minBatchQuestions,
+		"maxItems":    maxBatchQuestions,
+		"description": fmt.Sprintf("The questions, %d-%d, each answerable on its own; the summary, code and other context are shared by all of them", minBatchQuestions, maxBatchQuestions),
+	}
+	properties["mode"] = map[string]interface{}{
+		"type":        "string",
+		"enum":        []string{batchModeAuto, batchModeParallel, batchModeCombined},
+		"description": "\"parallel\" asks each question separately with the full context, \"combined\" asks them all in one call that sends the context once, \"auto\" combines them when that saves a large context from being repeated (default: auto)",
+	}
+
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+		"required":   []string{"questions", "summary"},
+	}
+}
+
+// OutputSchema describes the per-question results.
+func (t *BatchHelpTool) OutputSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"mode": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{batchModeParallel, batchModeCombined},
+				"description": "How the batch was answered",
+			},
+			"answers": map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"question":   map[string]interface{}{"type": "string"},
+						"answer":     map[string]interface{}{"type": "string"},
+						"confidence": map[string]interface{}{"type": "string", "enum": []string{"high", "medium", "low"}},
+						"error":      map[string]interface{}{"type": "string", "description": "Why the question wasn't answered; ask it again on its own"},
+					},
+					"required": []string{"question"},
+				},
+				"description": "One result per question, in the order asked",
+			},
+		},
+		"required": []string{"mode", "answers"},
+	}
+}
+
+func (t *BatchHelpTool) Call(arguments map[string]interface{}) ([]map[string]interface{}, error) {
+	return t.CallContext(context.Background(), arguments, nil)
+}
+
+// CallContext behaves like Call, with the model calls made under ctx, so
+// they join its trace and are logged with its caller.
+func (t *BatchHelpTool) CallContext(ctx context.Context, arguments map[string]interface{}, _ func(string)) ([]map[string]interface{}, error) {
+	questions := stringListArgument(arguments, "questions")
+	if len(questions) < minBatchQuestions || len(questions) > maxBatchQuestions {
+		return textContent(fmt.Sprintf("Error: questions must list %d to %d questions, got %d", minBatchQuestions, maxBatchQuestions, len(questions))), fmt.Errorf("invalid questions")
+	}
+	mode, _ := arguments["mode"].(string)
+	if mode == "" {
+		mode = batchModeAuto
+	}
+	if mode != batchModeAuto && mode != batchModeParallel && mode != batchModeCombined {
+		return textContent("Error: mode must be \"auto\", \"parallel\" or \"combined\""), fmt.Errorf("invalid mode %q", mode)
+	}
+
+	// The shared prompt carries every question, so retrieval and the other
+	// context sources see all of them.
+	listed := numberedQuestions(questions)
+	shared := maps.Clone(arguments)
+	shared["question"] = listed
+	prepared, errContent, err := t.help.preparePrompt(ctx, shared)
+	if err != nil {
+		return errContent, err
+	}
+	usage := &TokenUsage{}
+	for _, call := range prepared.Calls {
+		usage.add(call)
+	}
+
+	if mode == batchModeAuto {
+		mode = batchModeParallel
+		repeated := (len(questions) - 1) * (len(prepared.Text) - len(listed)) / 4
+		if repeated >= batchCombineTokens {
+			mode = batchModeCombined
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Minute)
+	defer cancel()
+
+	answers := make([]batchAnswer, len(questions))
+	for i, question := range questions {
+		answers[i].Question = question
+	}
+	if mode == batchModeCombined {
+		completion, err := t.askCombined(ctx, prepared.Text, answers)
+		if completion != nil {
+			usage.add(completion)
+		}
+		if err != nil {
+			slog.WarnContext(ctx, "Combined batch call failed, asking each question separately", "tool", t.Name(), "error", err)
+		}
+	}
+	// Questions the combined call left unanswered are asked on their own.
+	var pending []int
+	for i, a := range answers {
+		if a.Answer == "" {
+			pending = append(pending, i)
+		}
+	}
+	t.askEach(ctx, arguments, answers, pending)
+
+	var failure error
+	results := make([]interface{}, len(answers))
+	for i, a := range answers {
+		for _, call := range a.calls {
+			usage.add(call)
+		}
+		result := map[string]interface{}{"question": a.Question}
+		if a.Err != nil {
+			slog.WarnContext(ctx, "Batch question failed", "tool", t.Name(), "question", i+1, "error", a.Err)
+			result["error"] = failureContent(a.Err)[0]["text"]
+			if failure == nil {
+				failure = a.Err
+			}
+		} else {
+			result["answer"] = a.Answer
+			if _, ok := confidenceLevels[a.Confidence]; ok {
+				result["confidence"] = a.Confidence
+			}
+		}
+		results[i] = result
+	}
+	logUsage(ctx, t.Name(), usage)
+	if allFailed(answers) {
+		return failureContent(failure), fmt.Errorf("every question failed: %w", failure)
+	}
+
+	structured := map[string]interface{}{"mode": mode, "answers": results}
+	return withMeta(withStructuredContent(textContent(formatBatchAnswers(answers)), structured), map[string]interface{}{"usage": usage, "batch_mode": mode}), nil
+}
+
+// askCombined asks every question in one call and fills in the answers the
+// reply gives. The completion is returned even when its reply can't be
+// used, since it was paid for.
+func (t *BatchHelpTool) askCombined(ctx context.Context, prompt string, answers []batchAnswer) (*Completion, error) {
+	req := t.help.currentPersona().promptRequest(nil, prompt+fmt.Sprintf(combinedBatchInstructions, len(answers)))
+	req.ResponseFormat = &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject}
+	completion, err := t.help.llm.Generate(ctx, req, nil)
+	if err != nil {
+		return nil, err
+	}
+	var reply struct {
+		Answers []struct {
+			Question   int    `json:"question"`
+			Answer     string `json:"answer"`
+			Confidence string `json:"confidence"`
+		} `json:"answers"`
+	}
+	if err := json.Unmarshal([]byte(completion.Answer), &reply); err != nil {
+		return completion, fmt.Errorf("%s didn't answer with the batch's JSON: %w", completion.Model, err)
+	}
+	for _, a := range reply.Answers {
+		if a.Question < 1 || a.Question > len(answers) || strings.TrimSpace(a.Answer) == "" {
+			continue
+		}
+		answers[a.Question-1].Answer = a.Answer
+		answers[a.Question-1].Confidence = strings.ToLower(a.Confidence)
+	}
+	return completion, nil
+}
+
+const combinedBatchInstructions = `
+
+The question above lists %d independent questions. Answer each one on its own, as fully as if it had been asked alone. Respond with a JSON object of this exact shape:
+{"answers": [{"question": 1, "answer": "...", "confidence": "high"}]}
+with one entry per question, numbered as listed. "answer" is markdown, and "confidence" is high, medium or low.`
+
+// askEach asks the questions at the given indexes concurrently, each with
+// its own prompt and the full context.
+func (t *BatchHelpTool) askEach(ctx context.Context, arguments map[string]interface{}, answers []batchAnswer, indexes []int) {
+	var wg sync.WaitGroup
+	for _, i := range indexes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a := &answers[i]
+			single := maps.Clone(arguments)
+			single["question"] = a.Question
+			prepared, _, err := t.help.preparePrompt(ctx, single)
+			if err != nil {
+				a.Err = err
+				return
+			}
+			a.calls = prepared.Calls
+			completion, err := t.help.generate(ctx, nil, nil, prepared.Text, false, nil)
+			if err != nil {
+				a.Err = err
+				return
+			}
+			a.calls = append(a.calls, completion)
+			a.Answer, a.Confidence = completion.Answer, completion.Confidence
+		}()
+	}
+	wg.Wait()
+}
+
+func allFailed(answers []batchAnswer) bool {
+	for _, a := range answers {
+		if a.Err == nil {
+			return false
+		}
+	}
+	return true
+}
+
+func numberedQuestions(questions []string) string {
+	var b strings.Builder
+	for i, question := range questions {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "%d. %s", i+1, question)
+	}
+	return b.String()
+}
+
+func formatBatchAnswers(answers []batchAnswer) string {
+	var b strings.Builder
+	for i, a := range answers {
+		if i > 0 {
+			b.WriteString("\n\n")
+		}
+		fmt.Fprintf(&b, "## %d. %s\n\n", i+1, a.Question)
+		if a.Err != nil {
+			fmt.Fprintf(&b, "_%s Ask this question again on its own._", strings.TrimPrefix(failureContent(a.Err)[0]["text"].(string), "Error: "))
+		} else {
+			b.WriteString(a.Answer)
+		}
+	}
+	return b.String()
+}
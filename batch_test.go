@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// newBatchTestTool answers combined calls with reply and other calls by
+// echoing the question, recording every prompt.
+func newBatchTestTool(t *testing.T, reply string) (*BatchHelpTool, *[]string) {
+	t.Helper()
+	withFastRetries(t)
+	var mu sync.Mutex
+	var prompts []string
+	help := NewGetHelpTool(writeTestSummary(t), "o3")
+	help.LLM().WithProvider(CompletionFunc(func(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error) {
+		prompt := req.Messages[len(req.Messages)-1].Content
+		mu.Lock()
+		prompts = append(prompts, prompt)
+		mu.Unlock()
+		if req.ResponseFormat != nil {
+			return &Completion{Answer: reply, Model: req.Model, PromptTokens: 100, CompletionTokens: 50}, nil
+		}
+		switch {
+		case strings.Contains(prompt, "Why does the cache miss?"):
+			return &Completion{Answer: "The key includes a timestamp.\nCONFIDENCE: high", Model: req.Model, PromptTokens: 100, CompletionTokens: 50}, nil
+		case strings.Contains(prompt, "How should retries back off?"):
+			return &Completion{Answer: "Exponentially, with jitter.", Model: req.Model, PromptTokens: 100, CompletionTokens: 50}, nil
+		}
+		return nil, context.DeadlineExceeded
+	}))
+	return NewBatchHelpTool(help), &prompts
+}
+
+func TestBatchHelpTool_Parallel(t *testing.T) {
+	tool, prompts := newBatchTestTool(t, "")
+
+	content, err := tool.Call(map[string]interface{}{
+		"questions": []interface{}{"Why does the cache miss?", "How should retries back off?"},
+		"summary":   "s",
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(*prompts) != 2 {
+		t.Fatalf("Expected a call per question for a small context, got %d", len(*prompts))
+	}
+	for _, prompt := range *prompts {
+		if strings.Contains(prompt, "Why does the cache miss?") == strings.Contains(prompt, "How should retries back off?") {
+			t.Errorf("Expected each prompt to ask one question, got:\n%s", prompt)
+		}
+	}
+
+	structured := takeStructuredContent(content)
+	text := content[0]["text"].(string)
+	if !strings.Contains(text, "## 1. Why does the cache miss?\n\nThe key includes a timestamp.") || !strings.Contains(text, "## 2. How should retries back off?\n\nExponentially, with jitter.") {
+		t.Errorf("Expected an answer under each question, got:\n%s", text)
+	}
+	answers := structured["answers"].([]interface{})
+	if first := answers[0].(map[string]interface{}); first["confidence"] != "high" || structured["mode"] != batchModeParallel {
+		t.Errorf("Expected per-question results, got %+v", structured)
+	}
+	if usage := takeMeta(content)["usage"].(*TokenUsage); usage.TotalTokens != 300 {
+		t.Errorf("Expected usage summed over both calls, got %+v", usage)
+	}
+}
+
+func TestBatchHelpTool_Combined(t *testing.T) {
+	tool, prompts := newBatchTestTool(t, `{"answers": [{"question": 1, "answer": "The key includes a timestamp.", "confidence": "HIGH"}]}`)
+
+	content, err := tool.Call(map[string]interface{}{
+		"questions":     []interface{}{"Why does the cache miss?", "How should retries back off?"},
+		"summary":       "s",
+		"relevant_code": strings.Repeat("func cacheKey(r *Request) string { return r.Path + time.Now().String() }\n", 250),
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	// The combined call answered the first question; the second was asked
+	// on its own.
+	if len(*prompts) != 2 || !strings.Contains((*prompts)[0], "1. Why does the cache miss?\n2. How should retries back off?") {
+		t.Fatalf("Expected one combined call and one retry, got %d prompts", len(*prompts))
+	}
+	if strings.Contains((*prompts)[1], "Why does the cache miss?") {
+		t.Error("Expected only the unanswered question asked again")
+	}
+
+	structured := takeStructuredContent(content)
+	answers := structured["answers"].([]interface{})
+	if structured["mode"] != batchModeCombined || answers[0].(map[string]interface{})["confidence"] != "high" || answers[1].(map[string]interface{})["answer"] != "Exponentially, with jitter." {
+		t.Errorf("Expected both questions answered, got %+v", structured)
+	}
+}
+
+func TestBatchHelpTool_Failures(t *testing.T) {
+	tool, _ := newBatchTestTool(t, "")
+
+	content, err := tool.Call(map[string]interface{}{
+		"questions": []interface{}{"Why does the cache miss?", "What is unknowable?"},
+		"summary":   "s",
+		"mode":      "parallel",
+	})
+	if err != nil {
+		t.Fatalf("Expected a partial failure to succeed, got: %v", err)
+	}
+	structured := takeStructuredContent(content)
+	if second := structured["answers"].([]interface{})[1].(map[string]interface{}); second["error"] == nil || second["answer"] != nil {
+		t.Errorf("Expected the failed question to carry an error, got %+v", second)
+	}
+	if text := content[0]["text"].(string); !strings.Contains(text, "Ask this question again on its own.") {
+		t.Errorf("Expected the failure noted under its question, got:\n%s", text)
+	}
+
+	if _, err := tool.Call(map[string]interface{}{"questions": []interface{}{"What is unknowable?", "What else?"}, "summary": "s"}); err == nil {
+		t.Error("Expected an error when every question fails")
+	}
+	for _, args := range []map[string]interface{}{
+		{"questions": []interface{}{"Only one?"}, "summary": "s"},
+		{"questions": []interface{}{"a", "b"}, "summary": "s", "mode": "serial"},
+		{"questions": []interface{}{"a", "b"}},
+	} {
+		if _, err := tool.Call(args); err == nil {
+			t.Errorf("Expected %v to be refused", args)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	defaultBrainstormOptions = 3
+	maxBrainstormOptions     = 6
+	defaultBrainstormSeconds = 90
+	maxBrainstormSeconds     = 180
+)
+
+// BrainstormTool asks the architect for several distinct approaches to a
+// design problem, returned as structured JSON rather than a single
+// prescriptive answer.
+type BrainstormTool struct {
+	llm *LLM
+}
+
+func NewBrainstormTool(llm *LLM) *BrainstormTool {
+	return &BrainstormTool{llm: llm}
+}
+
+// BrainstormResult is the JSON document returned by brainstorm_options.
+type BrainstormResult struct {
+	Options        []BrainstormOption `json:"options"`
+	Recommendation struct {
+		Option    int    `json:"option"`
+		Rationale string `json:"rationale"`
+	} `json:"recommendation"`
+}
+
+type BrainstormOption struct {
+	Rank    int      `json:"rank"`
+	Title   string   `json:"title"`
+	Summary string   `json:"summary"`
+	Pros    []string `json:"pros"`
+	Cons    []string `json:"cons"`
+}
+
+func (t *BrainstormTool) Name() string {
+	return "brainstorm_options"
+}
+
+func (t *BrainstormTool) Category() string {
+	return "design"
+}
+
+func (t *BrainstormTool) Description() string {
+	return "Ask for several distinct, ranked approaches to a design problem with pros, cons and a recommendation (structured JSON)"
+}
+
+func (t *BrainstormTool) Schema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"problem": map[string]interface{}{
+				"type":        "string",
+				"description": "The design problem you need approaches for",
+			},
+			"summary": map[string]interface{}{
+				"type":        "string",
+				"description": "Brief summary of your project context (optional)",
+			},
+			"constraints": map[string]interface{}{
+				"type":        "string",
+				"description": "Constraints any approach must respect (optional)",
+			},
+			"num_options": map[string]interface{}{
+				"type":        "integer",
+				"description": fmt.Sprintf("Number of distinct approaches to return (2-%d, default %d)", maxBrainstormOptions, defaultBrainstormOptions),
+			},
+			"time_budget_seconds": map[string]interface{}{
+				"type":        "integer",
+				"description": fmt.Sprintf("Maximum time to spend brainstorming (default %d, max %d)", defaultBrainstormSeconds, maxBrainstormSeconds),
+			},
+		},
+		"required": []string{"problem"},
+	}
+}
+
+func (t *BrainstormTool) Call(arguments map[string]interface{}) ([]map[string]interface{}, error) {
+	return t.CallContext(context.Background(), arguments, nil)
+}
+
+// CallContext behaves like Call, with the model calls made under ctx, so
+// they join its trace and are logged with its caller.
+func (t *BrainstormTool) CallContext(ctx context.Context, arguments map[string]interface{}, _ func(string)) ([]map[string]interface{}, error) {
+	problem, _ := arguments["problem"].(string)
+	summary, _ := arguments["summary"].(string)
+	constraints, _ := arguments["constraints"].(string)
+
+	if problem == "" {
+		return textContent("Error: Missing required field: problem"), fmt.Errorf("missing required fields")
+	}
+
+	numOptions := clampInt(intArgument(arguments, "num_options", defaultBrainstormOptions), 2, maxBrainstormOptions)
+	budget := clampInt(intArgument(arguments, "time_budget_seconds", defaultBrainstormSeconds), 1, maxBrainstormSeconds)
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(budget)*time.Second)
+	defer cancel()
+
+	completion, err := t.llm.Generate(ctx, openai.ChatCompletionRequest{
+		Messages: []openai.ChatCompletionMessage{
+			{
+				Role:    openai.ChatMessageRoleUser,
+				Content: buildBrainstormPrompt(problem, summary, constraints, numOptions),
+			},
+		},
+		ResponseFormat: &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject},
+	}, nil)
+	if err != nil {
+		slog.ErrorContext(ctx, "Brainstorm call failed", "tool", "brainstorm_options", "error", err)
+		return failureContent(err), err
+	}
+
+	usage := usageOf(completion)
+	logUsage(ctx, t.Name(), usage)
+
+	result, err := parseBrainstormResult(completion.Answer)
+	if err != nil {
+		slog.ErrorContext(ctx, "Couldn't parse brainstorm result", "tool", "brainstorm_options", "error", err)
+		return textContent("Error: The architect returned malformed options. Please try again."), err
+	}
+
+	formatted, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return textContent("Error: Couldn't encode brainstorm result"), err
+	}
+
+	return withMeta(textContent(string(formatted)), map[string]interface{}{"usage": usage}), nil
+}
+
+func buildBrainstormPrompt(problem, summary, constraints string, numOptions int) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "As a software architect, propose %d genuinely distinct approaches to this design problem. ", numOptions)
+	b.WriteString("Do not commit to a single answer prematurely; rank the approaches from most to least recommended.\n\n")
+	fmt.Fprintf(&b, "**Problem:** %s\n", problem)
+	if summary != "" {
+		fmt.Fprintf(&b, "\n<summary>\n%s\n</summary>\n", summary)
+	}
+	if constraints != "" {
+		fmt.Fprintf(&b, "\n**Constraints:** %s\n", constraints)
+	}
+	b.WriteString(`
+Respond with a JSON object of this exact shape:
+{
+  "options": [
+    {"rank": 1, "title": "...", "summary": "...", "pros": ["..."], "cons": ["..."]}
+  ],
+  "recommendation": {"option": 1, "rationale": "..."}
+}
+"recommendation.option" is the rank of the approach you recommend.`)
+
+	return b.String()
+}
+
+func parseBrainstormResult(answer string) (*BrainstormResult, error) {
+	var result BrainstormResult
+	if err := json.Unmarshal([]byte(answer), &result); err != nil {
+		return nil, err
+	}
+	if len(result.Options) == 0 {
+		return nil, fmt.Errorf("no options in brainstorm result")
+	}
+	return &result, nil
+}
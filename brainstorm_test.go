@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestBrainstormTool_Call(t *testing.T) {
+	srv := newFakeOpenAI(t, func(model string) string {
+		return `{"options":[{"rank":1,"title":"Queue","summary":"Use a queue","pros":["decoupled"],"cons":["ops"]},` +
+			`{"rank":2,"title":"Cron","summary":"Poll","pros":["simple"],"cons":["latency"]}],` +
+			`"recommendation":{"option":1,"rationale":"scales"}}`
+	})
+
+	tool := NewBrainstormTool(NewLLM("gpt-4o").WithClientOptions(ClientOptions{BaseURL: srv.URL}))
+	content, err := tool.Call(map[string]interface{}{
+		"problem":     "How should we process uploads?",
+		"num_options": float64(2),
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	var result BrainstormResult
+	if err := json.Unmarshal([]byte(content[0]["text"].(string)), &result); err != nil {
+		t.Fatalf("Expected JSON result, got: %v", err)
+	}
+	if len(result.Options) != 2 {
+		t.Errorf("Expected 2 options, got %d", len(result.Options))
+	}
+	if result.Recommendation.Option != 1 {
+		t.Errorf("Expected recommendation 1, got %d", result.Recommendation.Option)
+	}
+}
+
+func TestBrainstormTool_Call_MissingProblem(t *testing.T) {
+	tool := NewBrainstormTool(NewLLM("gpt-4o"))
+	if _, err := tool.Call(map[string]interface{}{}); err == nil {
+		t.Error("Expected error for missing problem")
+	}
+}
+
+func TestBuildBrainstormPrompt(t *testing.T) {
+	prompt := buildBrainstormPrompt("Pick a cache", "Go service", "no new infra", 4)
+
+	for _, want := range []string{"4 genuinely distinct approaches", "Pick a cache", "Go service", "no new infra", `"recommendation"`} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("Expected prompt to contain %q", want)
+		}
+	}
+}
+
+func TestParseBrainstormResult_Invalid(t *testing.T) {
+	if _, err := parseBrainstormResult("not json"); err == nil {
+		t.Error("Expected error for invalid JSON")
+	}
+	if _, err := parseBrainstormResult(`{"options":[]}`); err == nil {
+		t.Error("Expected error for empty options")
+	}
+}
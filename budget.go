@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// ErrBudgetExhausted is returned instead of calling a model once the spend
+// cap for the current period has been reached.
+var ErrBudgetExhausted = errors.New("budget exhausted")
+
+// Budget caps the estimated spend on model calls per calendar day and month
+// (local time). Spend resets automatically when a new period starts. A zero
+// cap means no limit for that period.
+type Budget struct {
+	mu      sync.Mutex
+	daily   float64
+	monthly float64
+	now     func() time.Time
+	store   *CounterStore
+
+	day        string
+	month      string
+	spentDay   float64
+	spentMonth float64
+}
+
+func NewBudget(daily, monthly float64) *Budget {
+	return &Budget{daily: daily, monthly: monthly, now: time.Now}
+}
+
+// WithStore keeps the spend in store, so it survives restarts and is shared
+// by servers using the same database.
+func (b *Budget) WithStore(store *CounterStore) *Budget {
+	b.store = store
+	return b
+}
+
+// rollover resets the spend of any period that has ended, and reads the
+// current periods' spend from the store, if any. Callers hold mu.
+func (b *Budget) rollover() time.Time {
+	now := b.now()
+	if day := now.Format("2006-01-02"); day != b.day {
+		b.day, b.spentDay = day, 0
+	}
+	if month := now.Format("2006-01"); month != b.month {
+		b.month, b.spentMonth = month, 0
+	}
+	if b.store != nil {
+		// The in-memory spend stands in while the store can't be read.
+		if spent, err := b.store.Spent(b.day); err != nil {
+			slog.Warn("Couldn't read the day's spend", "error", err)
+		} else {
+			b.spentDay = spent
+		}
+		if spent, err := b.store.Spent(b.month); err != nil {
+			slog.Warn("Couldn't read the month's spend", "error", err)
+		} else {
+			b.spentMonth = spent
+		}
+	}
+	return now
+}
+
+// Check returns an error wrapping ErrBudgetExhausted when a cap has been
+// reached.
+func (b *Budget) Check() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.rollover()
+	if b.daily > 0 && b.spentDay >= b.daily {
+		tomorrow := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+		return fmt.Errorf("%w: daily spend of $%.2f has reached the $%.2f cap; it resets at %s",
+			ErrBudgetExhausted, b.spentDay, b.daily, tomorrow.Format("2006-01-02 15:04 MST"))
+	}
+	if b.monthly > 0 && b.spentMonth >= b.monthly {
+		nextMonth := time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, now.Location())
+		return fmt.Errorf("%w: monthly spend of $%.2f has reached the $%.2f cap; it resets at %s",
+			ErrBudgetExhausted, b.spentMonth, b.monthly, nextMonth.Format("2006-01-02 15:04 MST"))
+	}
+	return nil
+}
+
+// Spend adds the estimated cost of a completed call to the current periods.
+func (b *Budget) Spend(cost float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.rollover()
+	b.spentDay += cost
+	b.spentMonth += cost
+	if b.store != nil {
+		if spent, err := b.store.AddSpend(b.day, cost); err != nil {
+			slog.Warn("Couldn't record spend", "error", err)
+		} else {
+			b.spentDay = spent
+		}
+		if spent, err := b.store.AddSpend(b.month, cost); err != nil {
+			slog.Warn("Couldn't record spend", "error", err)
+		} else {
+			b.spentMonth = spent
+		}
+	}
+	if b.daily > 0 && b.spentDay >= b.daily {
+		slog.Warn("Daily budget exhausted", "budget_usd", b.daily, "spent_usd", b.spentDay)
+	}
+	if b.monthly > 0 && b.spentMonth >= b.monthly {
+		slog.Warn("Monthly budget exhausted", "budget_usd", b.monthly, "spent_usd", b.spentMonth)
+	}
+}
+
+// failureContent is the tool result for a failed model call. Budget
+// exhaustion, approval decisions and open circuits are reported as such so
+// callers know why; other failures get the generic message.
+func failureContent(err error) []map[string]interface{} {
+	if errors.Is(err, ErrBudgetExhausted) || errors.Is(err, ErrApprovalPending) || errors.Is(err, ErrApprovalDenied) || errors.Is(err, ErrCircuitOpen) {
+		return textContent("Error: " + err.Error())
+	}
+	return textContent("The architect is currently unavailable. Please try again later.")
+}
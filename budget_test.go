@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBudget_DailyResets(t *testing.T) {
+	budget := NewBudget(1.00, 0)
+	now := time.Date(2025, 3, 10, 23, 0, 0, 0, time.UTC)
+	budget.now = func() time.Time { return now }
+
+	budget.Spend(0.60)
+	if err := budget.Check(); err != nil {
+		t.Fatalf("Expected budget to have room, got: %v", err)
+	}
+	budget.Spend(0.50)
+	err := budget.Check()
+	if !errors.Is(err, ErrBudgetExhausted) {
+		t.Fatalf("Expected ErrBudgetExhausted, got: %v", err)
+	}
+	if !strings.Contains(err.Error(), "daily") || !strings.Contains(err.Error(), "2025-03-11 00:00") {
+		t.Errorf("Expected the daily cap and reset time in the error, got %q", err)
+	}
+
+	now = now.Add(2 * time.Hour)
+	if err := budget.Check(); err != nil {
+		t.Errorf("Expected the budget to reset the next day, got: %v", err)
+	}
+}
+
+func TestBudget_Monthly(t *testing.T) {
+	budget := NewBudget(0, 2.00)
+	now := time.Date(2025, 3, 31, 12, 0, 0, 0, time.UTC)
+	budget.now = func() time.Time { return now }
+
+	budget.Spend(2.00)
+	if err := budget.Check(); !errors.Is(err, ErrBudgetExhausted) || !strings.Contains(err.Error(), "monthly") {
+		t.Fatalf("Expected monthly cap to be hit, got: %v", err)
+	}
+
+	now = time.Date(2025, 4, 1, 0, 0, 1, 0, time.UTC)
+	if err := budget.Check(); err != nil {
+		t.Errorf("Expected the budget to reset the next month, got: %v", err)
+	}
+}
+
+func TestGetHelpTool_Call_BudgetExhausted(t *testing.T) {
+	calls := 0
+	srv := newFakeOpenAI(t, func(model string) string {
+		calls++
+		return "answer"
+	})
+
+	// Each fake call costs $0.006 at o3 prices.
+	tool := NewGetHelpTool("", "o3").
+		WithClientOptions(ClientOptions{BaseURL: srv.URL}).
+		WithBudget(NewBudget(0.01, 0))
+
+	for i := 0; i < 2; i++ {
+		if _, err := tool.Call(map[string]interface{}{"question": "q", "summary": "s"}); err != nil {
+			t.Fatalf("Call %d: expected no error, got: %v", i, err)
+		}
+	}
+
+	content, err := tool.Call(map[string]interface{}{"question": "q", "summary": "s"})
+	if !errors.Is(err, ErrBudgetExhausted) {
+		t.Fatalf("Expected ErrBudgetExhausted, got: %v", err)
+	}
+	if text := content[0]["text"].(string); !strings.HasPrefix(text, "Error: budget exhausted: daily spend") {
+		t.Errorf("Expected a clear budget error, got %q", text)
+	}
+	if calls != 2 {
+		t.Errorf("Expected no model call once the budget is exhausted, got %d calls", calls)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// ResponseCache is an in-memory LRU of answers keyed by prompt hash, so
+// repeated identical escalations return instantly without another charge.
+type ResponseCache struct {
+	mu       sync.Mutex
+	capacity int
+	ttl      time.Duration
+	order    *list.List // front is most recently used
+	entries  map[string]*list.Element
+	now      func() time.Time
+}
+
+type cacheEntry struct {
+	key       string
+	answer    CachedAnswer
+	expiresAt time.Time
+}
+
+// CachedAnswer is an answer as kept in the cache. Past StaleAt the answer is
+// still served, but the referenced code has probably changed since.
+type CachedAnswer struct {
+	Answer       string
+	Confidence   string
+	EscalationID string
+	AnsweredAt   time.Time
+	StaleAt      time.Time
+}
+
+// Stale reports whether the answer is past its freshness window at now.
+func (a CachedAnswer) Stale(now time.Time) bool {
+	return !a.StaleAt.IsZero() && now.After(a.StaleAt)
+}
+
+func NewResponseCache(capacity int, ttl time.Duration) *ResponseCache {
+	return &ResponseCache{
+		capacity: capacity,
+		ttl:      ttl,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+		now:      time.Now,
+	}
+}
+
+// cacheKey hashes everything that determines the answer.
+func cacheKey(model, prompt string) string {
+	sum := sha256.Sum256([]byte(model + "\x00" + prompt))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *ResponseCache) Get(key string) (CachedAnswer, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return CachedAnswer{}, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if c.ttl > 0 && c.now().After(entry.expiresAt) {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return CachedAnswer{}, false
+	}
+
+	c.order.MoveToFront(elem)
+	return entry.answer, true
+}
+
+func (c *ResponseCache) Put(key string, answer CachedAnswer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*cacheEntry)
+		entry.answer = answer
+		entry.expiresAt = c.now().Add(c.ttl)
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, answer: answer, expiresAt: c.now().Add(c.ttl)})
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+func (c *ResponseCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResponseCache_LRUEviction(t *testing.T) {
+	cache := NewResponseCache(2, time.Hour)
+	cache.Put("a", CachedAnswer{Answer: "1"})
+	cache.Put("b", CachedAnswer{Answer: "2"})
+	cache.Get("a") // a is now most recently used
+	cache.Put("c", CachedAnswer{Answer: "3"})
+
+	if _, ok := cache.Get("b"); ok {
+		t.Error("Expected least recently used entry to be evicted")
+	}
+	if v, ok := cache.Get("a"); !ok || v.Answer != "1" {
+		t.Errorf("Expected 'a' to survive eviction, got %q, %v", v.Answer, ok)
+	}
+	if cache.Len() != 2 {
+		t.Errorf("Expected 2 entries, got %d", cache.Len())
+	}
+}
+
+func TestResponseCache_TTL(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := NewResponseCache(10, time.Minute)
+	cache.now = func() time.Time { return now }
+
+	cache.Put("k", CachedAnswer{Answer: "v"})
+	now = now.Add(30 * time.Second)
+	if _, ok := cache.Get("k"); !ok {
+		t.Error("Expected entry to be valid before TTL")
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok := cache.Get("k"); ok {
+		t.Error("Expected entry to expire after TTL")
+	}
+	if cache.Len() != 0 {
+		t.Errorf("Expected expired entry to be removed, got %d entries", cache.Len())
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	if cacheKey("o3", "prompt") == cacheKey("gpt-4o", "prompt") {
+		t.Error("Expected model to be part of the cache key")
+	}
+	if cacheKey("o3", "prompt") != cacheKey("o3", "prompt") {
+		t.Error("Expected cache key to be deterministic")
+	}
+}
+
+func TestGetHelpTool_Call_Cache(t *testing.T) {
+	calls := 0
+	srv := newFakeOpenAI(t, func(model string) string {
+		calls++
+		return "answer"
+	})
+
+	tool := NewGetHelpTool("", "o3").
+		WithClientOptions(ClientOptions{BaseURL: srv.URL}).
+		WithCache(NewResponseCache(10, time.Hour))
+	args := map[string]interface{}{"question": "q", "summary": "s"}
+
+	for i := 0; i < 2; i++ {
+		if _, err := tool.Call(args); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("Expected repeated escalation to hit the cache, got %d calls", calls)
+	}
+
+	tool.Call(map[string]interface{}{"question": "q", "summary": "s", "fresh": true})
+	if calls != 2 {
+		t.Errorf("Expected fresh=true to bypass the cache, got %d calls", calls)
+	}
+
+	// A new persona, as after a reload, gives different answers.
+	tool.WithPersona(&Persona{Name: "reviewer", Instructions: "Review the code."})
+	tool.Call(args)
+	if calls != 3 {
+		t.Errorf("Expected a persona change to miss the cache, got %d calls", calls)
+	}
+}
+
+func TestGetHelpTool_Call_UsageMeta(t *testing.T) {
+	srv := newFakeOpenAI(t, func(model string) string { return "answer" })
+	tool := NewGetHelpTool("", "o3").
+		WithClientOptions(ClientOptions{BaseURL: srv.URL}).
+		WithCache(NewResponseCache(10, time.Hour))
+	args := map[string]interface{}{"question": "q", "summary": "s"}
+
+	content, err := tool.Call(args)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	usage := takeMeta(content)["usage"].(*TokenUsage)
+	if usage.Model != "o3" || usage.PromptTokens != 1000 || usage.CompletionTokens != 500 || usage.CostUSD != estimateCost("o3", 1000, 500) {
+		t.Errorf("Unexpected usage: %+v", usage)
+	}
+
+	content, _ = tool.Call(args)
+	usage = takeMeta(content)["usage"].(*TokenUsage)
+	if !usage.Cached || usage.TotalTokens != 0 || usage.CostUSD != 0 {
+		t.Errorf("Expected a cached answer to cost nothing, got %+v", usage)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const confidenceInstruction = `
+
+After your answer, on a final line by itself, rate your confidence that the answer is correct and complete for this specific project as exactly one of:
+CONFIDENCE: high
+CONFIDENCE: medium
+CONFIDENCE: low`
+
+// minCascadeAnswerLength is the shortest cheap answer accepted without
+// re-escalating; very short answers are usually deflections.
+const minCascadeAnswerLength = 80
+
+var confidenceLevels = map[string]int{"low": 1, "medium": 2, "high": 3}
+
+// Cascade answers with a cheap model first and only re-escalates to the
+// expensive architect model when the cheap model is not confident enough.
+type Cascade struct {
+	llm           *LLM
+	minConfidence string
+}
+
+func NewCascade(llm *LLM, minConfidence string) *Cascade {
+	if _, ok := confidenceLevels[minConfidence]; !ok {
+		minConfidence = "high"
+	}
+	return &Cascade{llm: llm, minConfidence: minConfidence}
+}
+
+// Try asks the cheap model and reports whether its answer is good enough to
+// return without escalating. The request must ask for a confidence rating,
+// with withConfidenceInstruction or as a field of a JSON answer.
+func (c *Cascade) Try(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, bool) {
+	completion, err := c.llm.Generate(ctx, req, nil)
+	if err != nil {
+		slog.WarnContext(ctx, "Cascade model failed, escalating", "error", err)
+		return nil, false
+	}
+
+	answer, confidence := splitConfidence(completion.Answer)
+	if req.ResponseFormat != nil {
+		answer, confidence = completion.Answer, ""
+		if parsed, err := parseArchitectAnswer(completion.Answer); err == nil {
+			confidence = parsed.Confidence
+		}
+	}
+	if confidenceLevels[confidence] < confidenceLevels[c.minConfidence] {
+		slog.InfoContext(ctx, "Cascade model confidence too low, escalating", "confidence", confidence, "min_confidence", c.minConfidence)
+		return nil, false
+	}
+	if len(answer) < minCascadeAnswerLength {
+		slog.InfoContext(ctx, "Cascade answer too short, escalating", "chars", len(answer))
+		return nil, false
+	}
+
+	slog.InfoContext(ctx, "Cascade model answered", "confidence", confidence)
+	completion.Answer = answer
+	completion.Confidence = confidence
+	return completion, true
+}
+
+// splitConfidence removes the trailing CONFIDENCE line from an answer and
+// returns the answer and the lower-cased level ("" when missing).
+func splitConfidence(answer string) (string, string) {
+	trimmed := strings.TrimRight(answer, " \n\t")
+	idx := strings.LastIndex(trimmed, "\n")
+	lastLine := trimmed[idx+1:]
+
+	level, ok := strings.CutPrefix(strings.TrimSpace(lastLine), "CONFIDENCE:")
+	if !ok {
+		return answer, ""
+	}
+
+	level = strings.ToLower(strings.Trim(strings.TrimSpace(level), "*`."))
+	if idx < 0 {
+		return "", level
+	}
+	return strings.TrimRight(trimmed[:idx], " \n\t"), level
+}
+
+// withConfidenceInstruction asks for a confidence rating after the answer,
+// adding the instruction to the request's last message.
+func withConfidenceInstruction(req openai.ChatCompletionRequest) openai.ChatCompletionRequest {
+	messages := append([]openai.ChatCompletionMessage(nil), req.Messages...)
+	messages[len(messages)-1].Content += confidenceInstruction
+	req.Messages = messages
+	return req
+}
+
+// withoutConfidenceLine streams text through onDelta, holding back a line
+// that may turn out to be the trailing CONFIDENCE line. The returned flush
+// sends what is held back, unless it was that line, once the answer is
+// complete.
+func withoutConfidenceLine(onDelta func(string)) (func(string), func()) {
+	if onDelta == nil {
+		return nil, func() {}
+	}
+	var held string
+	stream := func(delta string) {
+		held += delta
+		start := strings.LastIndex(held, "\n") + 1
+		line := strings.TrimSpace(held[start:])
+		if strings.HasPrefix("CONFIDENCE:", line) || strings.HasPrefix(line, "CONFIDENCE:") {
+			if start > 0 {
+				onDelta(held[:start])
+				held = held[start:]
+			}
+			return
+		}
+		onDelta(held)
+		held = ""
+	}
+	flush := func() {
+		if _, confidence := splitConfidence(held); confidence == "" && held != "" {
+			onDelta(held)
+		}
+		held = ""
+	}
+	return stream, flush
+}
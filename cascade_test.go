@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestSplitConfidence(t *testing.T) {
+	tests := []struct {
+		input      string
+		answer     string
+		confidence string
+	}{
+		{"Use a mutex.\nCONFIDENCE: high", "Use a mutex.", "high"},
+		{"Use a mutex.\n\nCONFIDENCE: **Medium**\n", "Use a mutex.", "medium"},
+		{"Use a mutex.", "Use a mutex.", ""},
+		{"CONFIDENCE: low", "", "low"},
+	}
+
+	for _, tt := range tests {
+		answer, confidence := splitConfidence(tt.input)
+		if answer != tt.answer || confidence != tt.confidence {
+			t.Errorf("splitConfidence(%q) = (%q, %q), expected (%q, %q)", tt.input, answer, confidence, tt.answer, tt.confidence)
+		}
+	}
+}
+
+func TestGetHelpTool_Cascade(t *testing.T) {
+	longAnswer := strings.Repeat("Guard the map with a sync.RWMutex. ", 5)
+
+	tests := []struct {
+		name           string
+		cheapReply     string
+		expectAnswer   string
+		expectEscalate bool
+	}{
+		{"confident cheap answer", longAnswer + "\nCONFIDENCE: high", strings.TrimSpace(longAnswer), false},
+		{"low confidence escalates", longAnswer + "\nCONFIDENCE: low", "architect answer", true},
+		{"missing confidence escalates", longAnswer, "architect answer", true},
+		{"short answer escalates", "Not sure.\nCONFIDENCE: high", "architect answer", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			escalated := false
+			srv := newFakeOpenAI(t, func(model string) string {
+				if model == "cheap" {
+					return tt.cheapReply
+				}
+				escalated = true
+				return "architect answer"
+			})
+			opts := ClientOptions{BaseURL: srv.URL}
+
+			tool := NewGetHelpTool("", "expensive").
+				WithClientOptions(opts).
+				WithCascade(NewCascade(NewLLM("cheap").WithClientOptions(opts), "high"))
+
+			answer, err := tool.askOpenAI(context.Background(), "prompt")
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			if answer != tt.expectAnswer {
+				t.Errorf("Expected answer %q, got %q", tt.expectAnswer, answer)
+			}
+			if escalated != tt.expectEscalate {
+				t.Errorf("Expected escalated=%v, got %v", tt.expectEscalate, escalated)
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Cassette is a recording of provider HTTP interactions, replayed in place
+// of the provider so the whole pipeline can run deterministically without
+// an API key.
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RecordedRequest holds what a request is matched on. Headers, including
+// the API key, are never recorded.
+type RecordedRequest struct {
+	Method string          `json:"method"`
+	Path   string          `json:"path"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+type RecordedResponse struct {
+	Status      int    `json:"status"`
+	ContentType string `json:"content_type,omitempty"`
+	Body        string `json:"body"`
+}
+
+// CassetteTransport records provider interactions to a cassette file, or
+// replays them from one.
+type CassetteTransport struct {
+	base   http.RoundTripper
+	path   string
+	record bool
+
+	mu       sync.Mutex
+	cassette Cassette
+	used     []bool
+}
+
+// NewCassetteTransport opens the cassette at path. In record mode requests
+// go to the provider and every interaction is appended to the file; in
+// replay mode ("replay") requests are answered from the file and never
+// reach the network.
+func NewCassetteTransport(path, mode string) (*CassetteTransport, error) {
+	t := &CassetteTransport{base: http.DefaultTransport, path: path}
+
+	switch mode {
+	case "record":
+		t.record = true
+	case "replay":
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &t.cassette); err != nil {
+			return nil, fmt.Errorf("couldn't parse cassette %s: %w", path, err)
+		}
+		t.used = make([]bool, len(t.cassette.Interactions))
+	default:
+		return nil, fmt.Errorf("cassette mode must be \"record\" or \"replay\", got %q", mode)
+	}
+
+	return t, nil
+}
+
+func (t *CassetteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	recorded, err := recordRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	if t.record {
+		return t.recordRoundTrip(req, recorded)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// Identical requests are answered in the order they were recorded.
+	for i, interaction := range t.cassette.Interactions {
+		if !t.used[i] && sameRequest(interaction.Request, recorded) {
+			t.used[i] = true
+			return interaction.Response.httpResponse(req), nil
+		}
+	}
+	return nil, fmt.Errorf("cassette %s has no unused interaction for %s %s", t.path, recorded.Method, recorded.Path)
+}
+
+func (t *CassetteTransport) recordRoundTrip(req *http.Request, recorded RecordedRequest) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.cassette.Interactions = append(t.cassette.Interactions, Interaction{
+		Request: recorded,
+		Response: RecordedResponse{
+			Status:      resp.StatusCode,
+			ContentType: resp.Header.Get("Content-Type"),
+			Body:        string(body),
+		},
+	})
+	if err := t.save(); err != nil {
+		return nil, fmt.Errorf("couldn't save cassette: %w", err)
+	}
+	return resp, nil
+}
+
+func (t *CassetteTransport) save() error {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(t.cassette); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(t.path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(t.path, buf.Bytes(), 0644)
+}
+
+// recordRequest captures a request's method, path and body, restoring the
+// body so the request can still be sent.
+func recordRequest(req *http.Request) (RecordedRequest, error) {
+	recorded := RecordedRequest{Method: req.Method, Path: req.URL.Path}
+	if req.Body == nil {
+		return recorded, nil
+	}
+
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return recorded, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	if len(body) > 0 {
+		recorded.Body = normalizeJSON(body)
+	}
+	return recorded, nil
+}
+
+// normalizeJSON re-encodes JSON with sorted keys so semantically identical
+// bodies compare equal. Non-JSON bodies are kept as a JSON string.
+func normalizeJSON(body []byte) json.RawMessage {
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		quoted, _ := json.Marshal(string(body))
+		return quoted
+	}
+	normalized, _ := json.Marshal(v)
+	return normalized
+}
+
+func sameRequest(a, b RecordedRequest) bool {
+	return a.Method == b.Method && a.Path == b.Path &&
+		bytes.Equal(normalizeJSON(a.Body), normalizeJSON(b.Body))
+}
+
+func (r RecordedResponse) httpResponse(req *http.Request) *http.Response {
+	header := make(http.Header)
+	if r.ContentType != "" {
+		header.Set("Content-Type", r.ContentType)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", r.Status, http.StatusText(r.Status)),
+		StatusCode:    r.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewBufferString(r.Body)),
+		ContentLength: int64(len(r.Body)),
+		Request:       req,
+	}
+}
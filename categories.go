@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// toolCategory returns the tool's category, or "" for tools without one.
+func toolCategory(tool Tool) string {
+	categorized, ok := tool.(CategorizedTool)
+	if !ok {
+		return ""
+	}
+	return strings.Trim(categorized.Category(), "/")
+}
+
+// inCategories reports whether category is one of categories or nested
+// under one of them. Every category matches an empty filter.
+func inCategories(category string, categories []string) bool {
+	if len(categories) == 0 {
+		return true
+	}
+	for _, want := range categories {
+		if category == want || strings.HasPrefix(category, want+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// parseToolsListFilter reads the category filter of a tools/list request:
+// a category, or a list of them, each matching its nested categories too.
+func parseToolsListFilter(params json.RawMessage) ([]string, error) {
+	if len(params) == 0 || string(params) == "null" {
+		return nil, nil
+	}
+	var filter struct {
+		Category json.RawMessage `json:"category"`
+	}
+	if err := json.Unmarshal(params, &filter); err != nil {
+		return nil, err
+	}
+	if len(filter.Category) == 0 || string(filter.Category) == "null" {
+		return nil, nil
+	}
+	var categories []string
+	if err := json.Unmarshal(filter.Category, &categories); err != nil {
+		var category string
+		if json.Unmarshal(filter.Category, &category) != nil {
+			return nil, fmt.Errorf("category must be a string or a list of strings")
+		}
+		categories = []string{category}
+	}
+	for i, category := range categories {
+		categories[i] = strings.Trim(category, "/")
+		if categories[i] == "" {
+			return nil, fmt.Errorf("category must not be empty")
+		}
+	}
+	return categories, nil
+}
+
+// ToolCategory is one category in tools/list's _meta, with the number of
+// tools in it, counting those in categories nested under it.
+type ToolCategory struct {
+	Name  string `json:"name"`
+	Tools int    `json:"tools"`
+}
+
+// toolCategories lists every category of the registered tools, parents
+// included, so that clients can show the tree before asking for a branch.
+func (s *MCPServer) toolCategories() []ToolCategory {
+	counts := make(map[string]int)
+	for _, tool := range s.server.Tools() {
+		category := toolCategory(tool)
+		for category != "" {
+			counts[category]++
+			slash := strings.LastIndex(category, "/")
+			if slash < 0 {
+				break
+			}
+			category = category[:slash]
+		}
+	}
+	categories := make([]ToolCategory, 0, len(counts))
+	for name, tools := range counts {
+		categories = append(categories, ToolCategory{Name: name, Tools: tools})
+	}
+	sort.Slice(categories, func(i, j int) bool { return categories[i].Name < categories[j].Name })
+	return categories
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"testing"
+
+	"github.com/dratner/code-escalator/pkg/mcp"
+)
+
+func listedNames(t *testing.T, resp JsonRPCResponse) []string {
+	t.Helper()
+	if resp.Error != nil {
+		t.Fatalf("Expected tools, got error %v", resp.Error)
+	}
+	var names []string
+	for _, entry := range resp.Result.(*mcp.ListToolsResult).Tools {
+		names = append(names, entry.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestMCPServer_ToolsListCategories(t *testing.T) {
+	server := NewMCPServer("test", "1.0.0")
+	helpTool := NewGetHelpTool("", "o3")
+	server.RegisterTool(helpTool)
+	server.RegisterTool(NewGenerateTestsTool(helpTool.LLM()))
+	server.RegisterTool(NewSecurityAuditTool(helpTool.LLM()))
+	server.RegisterTool(&fakeStreamingTool{})
+
+	list := func(params string) JsonRPCResponse {
+		return server.ProcessRequest(JsonRPCRequest{Jsonrpc: "2.0", ID: 1, Method: "tools/list", Params: json.RawMessage(params)})
+	}
+
+	if got := listedNames(t, list(`{}`)); len(got) != 4 {
+		t.Errorf("Expected every tool without a filter, got %v", got)
+	}
+	if got := listedNames(t, list(`{"category":"code"}`)); len(got) != 2 || got[0] != "generate_tests" || got[1] != "security_audit" {
+		t.Errorf("Expected the code namespace and its branches, got %v", got)
+	}
+	if got := listedNames(t, list(`{"category":["code/review","escalation"]}`)); len(got) != 2 || got[0] != "get_help" || got[1] != "security_audit" {
+		t.Errorf("Expected either category, got %v", got)
+	}
+	if got := listedNames(t, list(`{"category":"cod"}`)); len(got) != 0 {
+		t.Errorf("Expected categories to match whole segments, got %v", got)
+	}
+	if resp := list(`{"category":7}`); resp.Error == nil {
+		t.Errorf("Expected invalid params for a category that isn't a string, got %+v", resp.Result)
+	}
+
+	resp := list(`{"category":"code/tests"}`)
+	result := resp.Result.(*mcp.ListToolsResult)
+	if entry := result.Tools[0]; entry.Meta["category"] != "code/tests" {
+		t.Errorf("Expected the tool's category in its _meta, got %v", entry)
+	}
+	categories := result.Meta["categories"].([]ToolCategory)
+	want := []ToolCategory{{"code", 2}, {"code/review", 1}, {"code/tests", 1}, {"escalation", 1}}
+	if len(categories) != len(want) {
+		t.Fatalf("Expected every category, parents included, got %v", categories)
+	}
+	for i := range want {
+		if categories[i] != want[i] {
+			t.Errorf("Expected %v, got %v", want[i], categories[i])
+		}
+	}
+}
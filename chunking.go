@@ -0,0 +1,350 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dratner/code-escalator/pkg/mcp"
+)
+
+// Ways long answers are delivered.
+const (
+	chunkModeBlocks    = "blocks"
+	chunkModeResources = "resources"
+)
+
+const (
+	// maxStoredAnswers bounds the answers whose parts are kept for
+	// resources/read; the oldest go first.
+	maxStoredAnswers = 50
+	answerPartsTTL   = time.Hour
+	answerPartScheme = "escalator://answers/"
+)
+
+// AnswerChunker delivers answers longer than a size limit in parts, for
+// clients that can't take large messages or content blocks. An index block
+// comes first, listing the parts in order. In blocks mode every part
+// follows as its own content block; in resources mode only the first does,
+// and the rest are kept as resources the client reads one at a time.
+type AnswerChunker struct {
+	size int
+	mode string
+
+	mu     sync.Mutex
+	stored map[string]*storedAnswer
+	order  []string
+}
+
+type storedAnswer struct {
+	parts   []string
+	created time.Time
+}
+
+func NewAnswerChunker(size int, mode string) (*AnswerChunker, error) {
+	if size < 1000 {
+		return nil, fmt.Errorf("chunk size must be at least 1000 characters, got %d", size)
+	}
+	if mode != chunkModeBlocks && mode != chunkModeResources {
+		return nil, fmt.Errorf("unknown chunk mode %q (want blocks or resources)", mode)
+	}
+	return &AnswerChunker{size: size, mode: mode, stored: make(map[string]*storedAnswer)}, nil
+}
+
+// servesResources reports whether parts are read as resources.
+func (c *AnswerChunker) servesResources() bool {
+	return c != nil && c.mode == chunkModeResources
+}
+
+// Chunk splits content holding a single text block longer than the limit.
+// It returns the content to send, the parts, and in resources mode the URIs
+// of the parts after the first. resourceLinks adds a resource_link block
+// per stored part, for clients that understand them. Other content is
+// returned as-is with no parts.
+func (c *AnswerChunker) Chunk(content []map[string]interface{}, resourceLinks bool) ([]map[string]interface{}, []string, []string) {
+	if c == nil || len(content) != 1 || content[0]["type"] != "text" {
+		return content, nil, nil
+	}
+	text, _ := content[0]["text"].(string)
+	if utf8.RuneCountInString(text) <= c.size {
+		return content, nil, nil
+	}
+	parts := splitAnswer(text, c.size)
+
+	var uris []string
+	if c.mode == chunkModeResources {
+		id := c.store(parts)
+		for i := 2; i <= len(parts); i++ {
+			uris = append(uris, answerPartURI(id, i))
+		}
+	}
+
+	chunked := textContent(answerIndex(text, parts, uris))
+	for i, part := range parts {
+		if i > 0 && c.mode == chunkModeResources {
+			break
+		}
+		chunked = append(chunked, textContent(partLabel(i+1, len(parts))+part)...)
+	}
+	if resourceLinks {
+		for i, uri := range uris {
+			chunked = append(chunked, map[string]interface{}{
+				"type":        "resource_link",
+				"uri":         uri,
+				"name":        fmt.Sprintf("answer-part-%d", i+2),
+				"description": fmt.Sprintf("Part %d of %d of the answer", i+2, len(parts)),
+				"mimeType":    "text/markdown",
+			})
+		}
+	}
+	slog.Info("Split an answer into parts", "chars", utf8.RuneCountInString(text), "parts", len(parts), "mode", c.mode)
+	return chunked, parts, uris
+}
+
+func partLabel(n, total int) string {
+	return fmt.Sprintf("[Part %d/%d]\n\n", n, total)
+}
+
+func answerPartURI(id string, n int) string {
+	return fmt.Sprintf("%s%s/part/%d", answerPartScheme, id, n)
+}
+
+// answerIndex describes how the answer was split: its length and each
+// part's first line, with the URI to read it from when it isn't included.
+func answerIndex(text string, parts, uris []string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "This answer is %d characters long, so it is delivered in %d parts. Read them in order:\n", utf8.RuneCountInString(text), len(parts))
+	for i, part := range parts {
+		fmt.Fprintf(&b, "\n%d. %s", i+1, partHeadline(part))
+		if i > 0 && len(uris) >= i {
+			fmt.Fprintf(&b, " (read %s)", uris[i-1])
+		}
+	}
+	return b.String()
+}
+
+// partHeadline is a part's first non-empty line, without Markdown heading
+// marks, cut to 80 characters.
+func partHeadline(part string) string {
+	for _, line := range strings.Split(part, "\n") {
+		line = strings.TrimSpace(strings.TrimLeft(line, "#"))
+		if line == "" || strings.HasPrefix(line, "```") {
+			continue
+		}
+		if utf8.RuneCountInString(line) > 80 {
+			line = string([]rune(line)[:77]) + "..."
+		}
+		return line
+	}
+	return "(code)"
+}
+
+// splitAnswer splits text into parts of at most size characters, between
+// paragraphs where possible. Code blocks are kept whole when they fit;
+// one that doesn't is split between lines, closing the fence at the end of
+// one part and reopening it at the start of the next.
+func splitAnswer(text string, size int) []string {
+	var parts []string
+	var current strings.Builder
+	flush := func() {
+		if part := strings.Trim(current.String(), "\n"); part != "" {
+			parts = append(parts, part)
+		}
+		current.Reset()
+	}
+	add := func(unit string) {
+		if current.Len() > 0 && utf8.RuneCountInString(current.String())+2+utf8.RuneCountInString(unit) > size {
+			flush()
+		}
+		if current.Len() > 0 {
+			current.WriteString("\n\n")
+		}
+		current.WriteString(unit)
+	}
+
+	for _, unit := range answerUnits(text) {
+		if utf8.RuneCountInString(unit) <= size {
+			add(unit)
+			continue
+		}
+		flush()
+		for _, piece := range splitUnit(unit, size) {
+			add(piece)
+			flush()
+		}
+	}
+	flush()
+	return parts
+}
+
+// answerUnits splits text into paragraphs, keeping each fenced code block
+// (blank lines and all) in one unit.
+func answerUnits(text string) []string {
+	var units, lines []string
+	inFence := false
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inFence = !inFence
+		}
+		if strings.TrimSpace(line) == "" && !inFence {
+			if len(lines) > 0 {
+				units = append(units, strings.Join(lines, "\n"))
+				lines = nil
+			}
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) > 0 {
+		units = append(units, strings.Join(lines, "\n"))
+	}
+	return units
+}
+
+// splitUnit splits a paragraph or code block too long for one part between
+// lines, and a line too long on its own between characters.
+func splitUnit(unit string, size int) []string {
+	lines := strings.Split(unit, "\n")
+	fence := ""
+	if strings.HasPrefix(strings.TrimSpace(lines[0]), "```") {
+		fence = strings.TrimSpace(lines[0])
+		lines = lines[1:]
+		if len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "```" {
+			lines = lines[:len(lines)-1]
+		}
+	}
+	// Room for the fence lines around each piece.
+	room := size
+	if fence != "" {
+		room -= utf8.RuneCountInString(fence) + len("\n\n```")
+	}
+
+	var pieces []string
+	var current []string
+	length := 0
+	emit := func() {
+		if len(current) == 0 {
+			return
+		}
+		piece := strings.Join(current, "\n")
+		if fence != "" {
+			piece = fence + "\n" + piece + "\n```"
+		}
+		pieces = append(pieces, piece)
+		current, length = nil, 0
+	}
+	for _, line := range lines {
+		for utf8.RuneCountInString(line) > room {
+			emit()
+			runes := []rune(line)
+			current, length = []string{string(runes[:room])}, room
+			emit()
+			line = string(runes[room:])
+		}
+		n := utf8.RuneCountInString(line)
+		if len(current) > 0 && length+1+n > room {
+			emit()
+		}
+		if len(current) > 0 {
+			length++
+		}
+		current = append(current, line)
+		length += n
+	}
+	emit()
+	return pieces
+}
+
+// store keeps an answer's parts for resources/read and returns its ID.
+func (c *AnswerChunker) store(parts []string) string {
+	raw := make([]byte, 8)
+	rand.Read(raw)
+	id := hex.EncodeToString(raw)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expire()
+	c.stored[id] = &storedAnswer{parts: parts, created: time.Now()}
+	c.order = append(c.order, id)
+	for len(c.order) > maxStoredAnswers {
+		delete(c.stored, c.order[0])
+		c.order = c.order[1:]
+	}
+	return id
+}
+
+// expire drops answers older than answerPartsTTL. The caller holds c.mu.
+func (c *AnswerChunker) expire() {
+	for len(c.order) > 0 && time.Since(c.stored[c.order[0]].created) > answerPartsTTL {
+		delete(c.stored, c.order[0])
+		c.order = c.order[1:]
+	}
+}
+
+// ReadPart returns the stored part a URI names, labelled like the parts
+// sent inline.
+func (c *AnswerChunker) ReadPart(uri string) (string, bool) {
+	rest, ok := strings.CutPrefix(uri, answerPartScheme)
+	if !ok {
+		return "", false
+	}
+	id, number, ok := strings.Cut(rest, "/part/")
+	n, err := strconv.Atoi(number)
+	if !ok || err != nil {
+		return "", false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expire()
+	answer, ok := c.stored[id]
+	if !ok || n < 1 || n > len(answer.parts) {
+		return "", false
+	}
+	return partLabel(n, len(answer.parts)) + answer.parts[n-1], true
+}
+
+// Resources lists the stored parts, newest answer first.
+func (c *AnswerChunker) Resources() []mcp.Resource {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expire()
+	resources := []mcp.Resource{}
+	for i := len(c.order) - 1; i >= 0; i-- {
+		id := c.order[i]
+		parts := c.stored[id].parts
+		for n := 2; n <= len(parts); n++ {
+			resources = append(resources, mcp.Resource{
+				URI:         answerPartURI(id, n),
+				Name:        fmt.Sprintf("answer-part-%d", n),
+				Description: fmt.Sprintf("Part %d of %d: %s", n, len(parts), partHeadline(parts[n-1])),
+				MimeType:    "text/markdown",
+			})
+		}
+	}
+	return resources
+}
+
+// HandleResourcesRead serves the parts of chunked answers.
+func (s *MCPServer) HandleResourcesRead(params json.RawMessage) (*mcp.ReadResourceResult, *mcp.RPCError) {
+	var readParams struct {
+		URI string `json:"uri"`
+	}
+	if err := json.Unmarshal(params, &readParams); err != nil {
+		return nil, mcp.NewError(mcp.CodeInvalidParams, "Invalid params")
+	}
+	text, ok := s.chunker.ReadPart(readParams.URI)
+	if !ok {
+		return nil, &mcp.RPCError{Code: mcp.CodeResourceNotFound, Message: "Resource not found", Data: map[string]string{"uri": readParams.URI}}
+	}
+	return &mcp.ReadResourceResult{
+		Contents: []mcp.ResourceContents{{URI: readParams.URI, MimeType: "text/markdown", Text: text}},
+	}, nil
+}
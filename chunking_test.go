@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/dratner/code-escalator/pkg/mcp"
+	"github.com/sashabaranov/go-openai"
+)
+
+// longAnswer is about 4,500 characters: paragraphs and a code block with a
+// blank line in it.
+func longAnswer() string {
+	var b strings.Builder
+	b.WriteString("## Cause\n\n")
+	for i := 1; i <= 8; i++ {
+		fmt.Fprintf(&b, "Paragraph %d. %s\n\n", i, strings.Repeat("The reconciler runs on every replica. ", 10))
+	}
+	b.WriteString("```go\nfunc reserve() {\n\tlock()\n\n\tdefer unlock()\n}\n```\n\n")
+	b.WriteString("## Fix\n\nTake an advisory lock.")
+	return b.String()
+}
+
+func TestSplitAnswer(t *testing.T) {
+	text := longAnswer()
+	parts := splitAnswer(text, 1000)
+	if len(parts) < 4 {
+		t.Fatalf("Expected at least 4 parts, got %d", len(parts))
+	}
+	for i, part := range parts {
+		if n := utf8.RuneCountInString(part); n > 1000 {
+			t.Errorf("Part %d is %d characters, over the limit", i+1, n)
+		}
+		if strings.Count(part, "```")%2 != 0 {
+			t.Errorf("Part %d leaves a code fence open:\n%s", i+1, part)
+		}
+	}
+	if got := strings.Join(parts, "\n\n"); got != strings.TrimSpace(text) {
+		t.Errorf("Expected the parts to join back into the answer, got:\n%s", got)
+	}
+
+	// A code block too long for one part is split between lines, each
+	// piece fenced.
+	code := "```go\n" + strings.Repeat("x := compute(1, 2, 3) // a line of code\n", 60) + "```"
+	parts = splitAnswer("Intro.\n\n"+code, 1000)
+	if parts[0] != "Intro." {
+		t.Errorf("Expected the intro on its own, got %q", parts[0])
+	}
+	for i, part := range parts[1:] {
+		if !strings.HasPrefix(part, "```go\n") || !strings.HasSuffix(part, "\n```") || utf8.RuneCountInString(part) > 1000 {
+			t.Errorf("Piece %d isn't a fenced block within the limit:\n%s", i+1, part)
+		}
+	}
+
+	// A line too long on its own is cut between characters.
+	for _, part := range splitAnswer(strings.Repeat("é", 2500), 1000) {
+		if n := utf8.RuneCountInString(part); n > 1000 {
+			t.Errorf("Expected parts within the limit, got %d characters", n)
+		}
+	}
+}
+
+func TestNewAnswerChunker_Invalid(t *testing.T) {
+	if _, err := NewAnswerChunker(999, chunkModeBlocks); err == nil {
+		t.Error("Expected an error for a size under 1000")
+	}
+	if _, err := NewAnswerChunker(4000, "pages"); err == nil {
+		t.Error("Expected an error for an unknown mode")
+	}
+}
+
+func TestAnswerChunker_Blocks(t *testing.T) {
+	chunker, _ := NewAnswerChunker(1000, chunkModeBlocks)
+	if content, parts, _ := chunker.Chunk(textContent("Short."), true); len(parts) != 0 || len(content) != 1 {
+		t.Errorf("Expected a short answer unchanged, got %v", content)
+	}
+
+	content, parts, uris := chunker.Chunk(textContent(longAnswer()), true)
+	if len(content) != len(parts)+1 || len(uris) != 0 {
+		t.Fatalf("Expected an index and every part as blocks, got %d blocks for %d parts", len(content), len(parts))
+	}
+	index := content[0]["text"].(string)
+	if !strings.Contains(index, fmt.Sprintf("delivered in %d parts", len(parts))) || !strings.Contains(index, "1. Cause") {
+		t.Errorf("Expected an index of the parts, got:\n%s", index)
+	}
+	for i, block := range content[1:] {
+		if want := fmt.Sprintf("[Part %d/%d]\n\n", i+1, len(parts)); !strings.HasPrefix(block["text"].(string), want) {
+			t.Errorf("Expected block %d labelled %q, got %q", i+1, want, block["text"])
+		}
+	}
+}
+
+func TestMCPServer_ChunkedResources(t *testing.T) {
+	answer := longAnswer()
+	tool := NewGetHelpTool("", "o3")
+	tool.LLM().WithProvider(CompletionFunc(func(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error) {
+		return &Completion{Answer: answer, Model: req.Model}, nil
+	}))
+	chunker, _ := NewAnswerChunker(1000, chunkModeResources)
+	server := NewMCPServer("test", "1.0.0").WithChunker(chunker)
+	server.RegisterTool(tool)
+
+	init := server.ProcessRequest(JsonRPCRequest{Method: "initialize", Params: json.RawMessage(`{"protocolVersion":"2025-06-18","capabilities":{}}`)})
+	if init.Result.(*mcp.InitializeResult).Capabilities.Resources == nil {
+		t.Error("Expected the resources capability in resources mode")
+	}
+
+	result, _ := server.HandleToolsCall(json.RawMessage(`{"name":"get_help","arguments":{"question":"Why?","summary":"s"}}`))
+	content := result.Content
+	parts := result.Meta["parts"].(int)
+	if parts < 4 || len(content) != 2+parts-1 {
+		t.Fatalf("Expected an index, part 1 and a link per other part, got %d blocks for %d parts", len(content), parts)
+	}
+	if !strings.HasPrefix(content[1]["text"].(string), fmt.Sprintf("[Part 1/%d]", parts)) {
+		t.Errorf("Expected part 1 inline, got %q", content[1]["text"])
+	}
+	link := content[2]
+	uri, _ := link["uri"].(string)
+	if link["type"] != "resource_link" || !strings.HasSuffix(uri, "/part/2") {
+		t.Errorf("Expected a resource_link to part 2, got %v", link)
+	}
+	if !strings.Contains(content[0]["text"].(string), "(read "+uri+")") {
+		t.Errorf("Expected the index to name the part URIs, got:\n%s", content[0]["text"])
+	}
+
+	structured := result.StructuredContent
+	if answerParts, _ := structured["answer_parts"].([]string); len(answerParts) != parts-1 || answerParts[0] != uri {
+		t.Errorf("Expected answer_parts to list the stored parts, got %v", structured["answer_parts"])
+	}
+	if strings.Contains(structured["answer"].(string), "## Fix") {
+		t.Error("Expected the structured answer to hold only the first part")
+	}
+
+	read := server.ProcessRequest(JsonRPCRequest{Method: "resources/read", Params: json.RawMessage(`{"uri":"` + uri + `"}`)})
+	contents := read.Result.(*mcp.ReadResourceResult).Contents
+	if !strings.HasPrefix(contents[0].Text, fmt.Sprintf("[Part 2/%d]", parts)) {
+		t.Errorf("Expected part 2, got %v", contents)
+	}
+	if missing := server.ProcessRequest(JsonRPCRequest{Method: "resources/read", Params: json.RawMessage(`{"uri":"escalator://answers/nope/part/2"}`)}); missing.Error == nil || missing.Error.Code != mcp.CodeResourceNotFound {
+		t.Error("Expected an error for an unknown part")
+	}
+
+	list := server.ProcessRequest(JsonRPCRequest{Method: "resources/list"})
+	if resources := list.Result.(*mcp.ListResourcesResult).Resources; len(resources) != parts-1 {
+		t.Errorf("Expected the stored parts listed, got %v", resources)
+	}
+}
+
+func TestMCPServer_ChunkedResources_OlderClient(t *testing.T) {
+	tool := NewGetHelpTool("", "o3")
+	tool.LLM().WithProvider(CompletionFunc(func(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error) {
+		return &Completion{Answer: longAnswer(), Model: req.Model}, nil
+	}))
+	chunker, _ := NewAnswerChunker(1000, chunkModeResources)
+	server := NewMCPServer("test", "1.0.0").WithChunker(chunker)
+	server.RegisterTool(tool)
+	server.recordClientCapabilities(json.RawMessage(`{"protocolVersion":"2025-03-26"}`))
+
+	result, _ := server.HandleToolsCall(json.RawMessage(`{"name":"get_help","arguments":{"question":"Why?","summary":"s"}}`))
+	for _, block := range result.Content {
+		if block["type"] != "text" {
+			t.Errorf("Expected only text blocks for a client without resource links, got %v", block)
+		}
+	}
+
+	if resp := NewMCPServer("test", "1.0.0").ProcessRequest(JsonRPCRequest{Method: "resources/read"}); resp.Error == nil {
+		t.Error("Expected resources/read not found without resources mode")
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned instead of calling a model whose circuit is
+// open.
+var ErrCircuitOpen = errors.New("the architect is temporarily down")
+
+// CircuitOpenError reports a call short-circuited by an open circuit, and
+// when the model will be tried again.
+type CircuitOpenError struct {
+	Model      string
+	Failures   int
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("%v: %s failed %d times in a row; retry after %s", ErrCircuitOpen, e.Model, e.Failures, e.RetryAfter)
+}
+
+func (e *CircuitOpenError) Unwrap() error { return ErrCircuitOpen }
+
+// CircuitBreaker stops calling a model that keeps failing. After threshold
+// consecutive failed calls, each already retried, a model's circuit opens
+// and calls to it fail at once for cooldown, so a provider outage costs
+// callers an immediate error (or a fallback model) rather than the full
+// retry and timeout budget each. Once the cooldown is over the circuit is
+// half-open: one call is let through as a probe, and its outcome closes the
+// circuit or opens it for another cooldown. A nil *CircuitBreaker never
+// opens.
+type CircuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+	metrics   *Metrics
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+type circuit struct {
+	failures  int
+	openUntil time.Time
+	// probing is set while the half-open probe is in flight.
+	probing bool
+}
+
+// NewCircuitBreaker opens a model's circuit after threshold consecutive
+// failures, for cooldown.
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+		circuits:  make(map[string]*circuit),
+	}
+}
+
+// WithMetrics counts circuits opening and closing, and the calls
+// short-circuited while they're open.
+func (b *CircuitBreaker) WithMetrics(metrics *Metrics) *CircuitBreaker {
+	b.metrics = metrics
+	return b
+}
+
+// Allow reports whether model may be called now, returning a
+// *CircuitOpenError when its circuit is open. A caller that is allowed must
+// Record the outcome.
+func (b *CircuitBreaker) Allow(model string) error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.circuits[model]
+	if c == nil || c.failures < b.threshold {
+		return nil
+	}
+	now := b.now()
+	if now.Before(c.openUntil) || c.probing {
+		b.metrics.CircuitEvent(model, "short_circuited")
+		retryAfter := max(c.openUntil.Sub(now).Round(time.Second), time.Second)
+		return &CircuitOpenError{Model: model, Failures: c.failures, RetryAfter: retryAfter}
+	}
+	c.probing = true
+	slog.Info("Probing a model whose circuit is half-open", "model", model)
+	return nil
+}
+
+// Record notes the outcome of an allowed call. Calls the caller abandoned
+// say nothing about the model, and failures that are the request's fault,
+// such as a 400, don't count against it.
+func (b *CircuitBreaker) Record(model string, err error) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.circuits[model]
+	if c == nil {
+		c = &circuit{}
+		b.circuits[model] = c
+	}
+	probe := c.probing
+	c.probing = false
+	switch {
+	case err == nil:
+		if c.failures >= b.threshold {
+			slog.Info("Closed a model's circuit", "model", model)
+			b.metrics.CircuitEvent(model, "closed")
+		}
+		c.failures = 0
+	case errors.Is(err, context.Canceled) || !isOutage(err):
+		return
+	default:
+		c.failures++
+		if c.failures == b.threshold || probe {
+			c.openUntil = b.now().Add(b.cooldown)
+			slog.Error("Opened a model's circuit after repeated failures", "model", model, "failures", c.failures, "cooldown", b.cooldown, "error", err)
+			b.metrics.CircuitEvent(model, "opened")
+		}
+	}
+}
+
+// isOutage reports whether a failed model call suggests the provider is
+// down, rather than that the request was refused on its merits.
+func isOutage(err error) bool {
+	code, convErr := strconv.Atoi(providerErrorCode(err))
+	if convErr != nil {
+		return true
+	}
+	return code < 400 || code >= 500 || code == 408 || code == 429
+}
+
+// writeCircuitOpen answers a legacy HTTP request that failed on an open
+// circuit with 503 and a Retry-After header, reporting whether it did.
+func writeCircuitOpen(w http.ResponseWriter, err error) bool {
+	var open *CircuitOpenError
+	if !errors.As(err, &open) {
+		return false
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(open.RetryAfter)))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	json.NewEncoder(w).Encode(map[string]string{"error": capitalize(err.Error())})
+	return true
+}
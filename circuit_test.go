@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestCircuitBreaker_OpensAndProbes(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	breaker := NewCircuitBreaker(2, 30*time.Second)
+	breaker.now = func() time.Time { return now }
+	outage := &openai.APIError{HTTPStatusCode: 503, Message: "overloaded"}
+
+	// Refusals on the request's merits don't count.
+	breaker.Record("o3", &openai.APIError{HTTPStatusCode: 400, Message: "bad request"})
+	breaker.Record("o3", outage)
+	if err := breaker.Allow("o3"); err != nil {
+		t.Fatalf("Expected the circuit closed below the threshold, got %v", err)
+	}
+	breaker.Record("o3", outage)
+	var open *CircuitOpenError
+	if err := breaker.Allow("o3"); !errors.As(err, &open) || open.RetryAfter != 30*time.Second {
+		t.Fatalf("Expected the circuit open for 30s, got %v", err)
+	}
+	if err := breaker.Allow("gpt-4o"); err != nil {
+		t.Errorf("Expected other models unaffected, got %v", err)
+	}
+
+	// Half-open: one probe at a time, and a failed probe reopens.
+	now = now.Add(31 * time.Second)
+	if err := breaker.Allow("o3"); err != nil {
+		t.Fatalf("Expected a probe let through, got %v", err)
+	}
+	if err := breaker.Allow("o3"); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Expected calls during the probe short-circuited, got %v", err)
+	}
+	breaker.Record("o3", outage)
+	if err := breaker.Allow("o3"); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Expected a failed probe to reopen the circuit, got %v", err)
+	}
+
+	now = now.Add(31 * time.Second)
+	breaker.Allow("o3")
+	breaker.Record("o3", nil)
+	if err := breaker.Allow("o3"); err != nil {
+		t.Errorf("Expected a successful probe to close the circuit, got %v", err)
+	}
+}
+
+func TestLLM_Generate_ShortCircuits(t *testing.T) {
+	withFastRetries(t)
+	calls := map[string]int{}
+	llm := NewLLM("o3").WithCircuitBreaker(NewCircuitBreaker(1, time.Minute)).WithProvider(CompletionFunc(func(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error) {
+		calls[req.Model]++
+		if req.Model == "o3" {
+			return nil, &openai.APIError{HTTPStatusCode: 500, Message: "server error"}
+		}
+		return &Completion{Answer: "fallback answer", Model: req.Model}, nil
+	}))
+
+	if _, err := llm.Generate(context.Background(), userRequest("q"), nil); err == nil {
+		t.Fatal("Expected the failing model to fail")
+	}
+	tried := calls["o3"]
+	_, err := llm.Generate(context.Background(), userRequest("q"), nil)
+	if !errors.Is(err, ErrCircuitOpen) || calls["o3"] != tried {
+		t.Fatalf("Expected the second call short-circuited without reaching the model, got %v after %d calls", err, calls["o3"])
+	}
+	if text := failureContent(err)[0]["text"].(string); !strings.Contains(text, "temporarily down") || !strings.Contains(text, "retry after 1m0s") {
+		t.Errorf("Expected a clear error with when to retry, got %q", text)
+	}
+
+	// With a fallback model, an open circuit moves straight on to it.
+	completion, err := llm.WithPrimary("o3").WithFallbackModels([]string{"gpt-4o"}).Generate(context.Background(), userRequest("q"), nil)
+	if err != nil || completion.Answer != "fallback answer" || calls["o3"] != tried {
+		t.Errorf("Expected the fallback model to answer, got %+v, %v", completion, err)
+	}
+}
+
+func TestWriteCircuitOpen(t *testing.T) {
+	w := httptest.NewRecorder()
+	if !writeCircuitOpen(w, &CircuitOpenError{Model: "o3", Failures: 5, RetryAfter: 20 * time.Second}) {
+		t.Fatal("Expected an open circuit answered")
+	}
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "20" || !strings.Contains(w.Body.String(), "The architect is temporarily down") {
+		t.Errorf("Expected 503 with Retry-After, got %d %v %s", w.Code, w.Header(), w.Body)
+	}
+	if writeCircuitOpen(httptest.NewRecorder(), errors.New("other")) {
+		t.Error("Expected other errors left to the caller")
+	}
+}
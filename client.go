@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// ClientOptions customizes how the OpenAI client is constructed so the
+// escalator can talk to OpenAI-compatible gateways (OpenRouter, vLLM,
+// LiteLLM, corporate proxies) instead of api.openai.com.
+type ClientOptions struct {
+	BaseURL string
+	OrgID   string
+	Project string
+	Headers map[string]string
+
+	// Transport replaces the default HTTP transport, e.g. with a cassette
+	// for recorded integration tests.
+	Transport http.RoundTripper
+}
+
+// NewClient builds an OpenAI client using OPENAI_API_KEY and the options.
+func (o ClientOptions) NewClient() *openai.Client {
+	config := openai.DefaultConfig(os.Getenv("OPENAI_API_KEY"))
+	if o.BaseURL != "" {
+		config.BaseURL = strings.TrimRight(o.BaseURL, "/")
+	}
+	if o.OrgID != "" {
+		config.OrgID = o.OrgID
+	}
+
+	headers := make(map[string]string, len(o.Headers)+1)
+	for name, value := range o.Headers {
+		headers[name] = value
+	}
+	if o.Project != "" {
+		headers["OpenAI-Project"] = o.Project
+	}
+	transport := o.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	if len(headers) > 0 {
+		transport = &headerTransport{base: transport, headers: headers}
+	}
+	config.HTTPClient = &http.Client{Transport: &retryAfterTransport{base: transport}}
+
+	return openai.NewClientWithConfig(config)
+}
+
+// headerTransport adds a fixed set of headers to every outgoing request.
+type headerTransport struct {
+	base    http.RoundTripper
+	headers map[string]string
+}
+
+func (h *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for name, value := range h.headers {
+		req.Header.Set(name, value)
+	}
+	return h.base.RoundTrip(req)
+}
+
+// headerFlag collects repeated -header "Name: value" flags.
+type headerFlag map[string]string
+
+func (h headerFlag) repeatable() {}
+
+func (h headerFlag) String() string {
+	pairs := make([]string, 0, len(h))
+	for name, value := range h {
+		pairs = append(pairs, name+": "+value)
+	}
+	return strings.Join(pairs, ", ")
+}
+
+func (h headerFlag) Set(value string) error {
+	name, val, ok := strings.Cut(value, ":")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" {
+		return fmt.Errorf("header must be in the form \"Name: value\", got %q", value)
+	}
+	h[name] = strings.TrimSpace(val)
+	return nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestClientOptions_NewClient_CustomBaseURLAndHeaders(t *testing.T) {
+	var got http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		if r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("Expected path '/v1/chat/completions', got %s", r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{
+				{"message": map[string]string{"role": "assistant", "content": "ok"}},
+			},
+		})
+	}))
+	defer srv.Close()
+
+	opts := ClientOptions{
+		BaseURL: srv.URL + "/v1/",
+		OrgID:   "org-123",
+		Project: "proj-456",
+		Headers: map[string]string{"X-Gateway-Key": "secret"},
+	}
+	client := opts.NewClient()
+
+	resp, err := client.CreateChatCompletion(context.Background(), openai.ChatCompletionRequest{
+		Model:    "test",
+		Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hi"}},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if resp.Choices[0].Message.Content != "ok" {
+		t.Errorf("Expected content 'ok', got %q", resp.Choices[0].Message.Content)
+	}
+	if got.Get("OpenAI-Organization") != "org-123" {
+		t.Errorf("Expected organization header 'org-123', got %q", got.Get("OpenAI-Organization"))
+	}
+	if got.Get("OpenAI-Project") != "proj-456" {
+		t.Errorf("Expected project header 'proj-456', got %q", got.Get("OpenAI-Project"))
+	}
+	if got.Get("X-Gateway-Key") != "secret" {
+		t.Errorf("Expected extra header 'secret', got %q", got.Get("X-Gateway-Key"))
+	}
+}
+
+func TestHeaderFlag_Set(t *testing.T) {
+	h := headerFlag{}
+	if err := h.Set("X-Team: platform"); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if h["X-Team"] != "platform" {
+		t.Errorf("Expected 'platform', got %q", h["X-Team"])
+	}
+
+	if err := h.Set("no-colon"); err == nil {
+		t.Error("Expected error for header without colon")
+	}
+	if err := h.Set(": value"); err == nil {
+		t.Error("Expected error for header without name")
+	}
+}
+
+// newFakeOpenAI starts a chat completions stub that answers with reply(model)
+// or fails with HTTP 500 when reply returns an empty string.
+func newFakeOpenAI(t *testing.T, reply func(model string) string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openai.ChatCompletionRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		answer := reply(req.Model)
+		if answer == "" {
+			http.Error(w, `{"error":{"message":"unavailable"}}`, http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"model": req.Model,
+			"choices": []map[string]interface{}{
+				{"message": map[string]string{"role": "assistant", "content": answer}},
+			},
+			"usage": map[string]int{"prompt_tokens": 1000, "completion_tokens": 500, "total_tokens": 1500},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// withFastRetries shrinks the retry backoff for the duration of a test.
+func withFastRetries(t *testing.T) {
+	t.Helper()
+	original := defaultRetryPolicy
+	defaultRetryPolicy.BaseDelay = time.Millisecond
+	t.Cleanup(func() { defaultRetryPolicy = original })
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	minComparedApproaches = 2
+	maxComparedApproaches = 4
+)
+
+// Ratings in a comparison's tradeoff matrix, best first. "fails" marks an
+// approach that breaks a hard constraint.
+var comparisonRatings = []string{"strong", "adequate", "weak", "fails"}
+
+// CompareApproachesTool asks the architect to weigh two to four candidate
+// designs against the constraints, returning a tradeoff matrix and a
+// recommendation as structured JSON.
+type CompareApproachesTool struct {
+	llm *LLM
+}
+
+func NewCompareApproachesTool(llm *LLM) *CompareApproachesTool {
+	return &CompareApproachesTool{llm: llm}
+}
+
+// Approach is one candidate design.
+type Approach struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// ComparisonResult is the JSON document returned by compare_approaches.
+type ComparisonResult struct {
+	Matrix         []ComparisonRow `json:"matrix"`
+	Recommendation struct {
+		Approach        string `json:"approach"`
+		Rationale       string `json:"rationale"`
+		ChooseOtherwise string `json:"choose_otherwise_if"`
+	} `json:"recommendation"`
+}
+
+// ComparisonRow rates every approach against one criterion.
+type ComparisonRow struct {
+	Criterion string             `json:"criterion"`
+	Ratings   []ComparisonRating `json:"ratings"`
+}
+
+type ComparisonRating struct {
+	Approach string `json:"approach"`
+	Rating   string `json:"rating"`
+	Note     string `json:"note"`
+}
+
+func (t *CompareApproachesTool) Name() string {
+	return "compare_approaches"
+}
+
+func (t *CompareApproachesTool) Category() string {
+	return "design"
+}
+
+func (t *CompareApproachesTool) Description() string {
+	return "Compare 2-4 candidate designs against your constraints: returns a tradeoff matrix and a recommendation (structured JSON)"
+}
+
+func (t *CompareApproachesTool) Schema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"decision": map[string]interface{}{
+				"type":        "string",
+				"description": "The decision to make, e.g. \"How should the reconciler avoid double-processing?\"",
+			},
+			"approaches": map[string]interface{}{
+				"type":     "array",
+				"minItems": minComparedApproaches,
+				"maxItems": maxComparedApproaches,
+				"items": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"name": map[string]interface{}{
+							"type":        "string",
+							"description": "Short name for the approach (optional; A, B, ... by default)",
+						},
+						"description": map[string]interface{}{
+							"type":        "string",
+							"description": "How the approach works, with code or sketches if they help",
+						},
+					},
+					"required": []string{"description"},
+				},
+				"description": fmt.Sprintf("The candidate designs (%d-%d)", minComparedApproaches, maxComparedApproaches),
+			},
+			"constraints": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "Requirements and priorities the approaches are judged against, e.g. \"no new infrastructure\"; each becomes a row of the matrix (optional)",
+			},
+			"summary": map[string]interface{}{
+				"type":        "string",
+				"description": "Brief summary of your project context (optional)",
+			},
+		},
+		"required": []string{"decision", "approaches"},
+	}
+}
+
+func (t *CompareApproachesTool) Call(arguments map[string]interface{}) ([]map[string]interface{}, error) {
+	return t.CallContext(context.Background(), arguments, nil)
+}
+
+// CallContext behaves like Call, with the model calls made under ctx, so
+// they join its trace and are logged with its caller.
+func (t *CompareApproachesTool) CallContext(ctx context.Context, arguments map[string]interface{}, _ func(string)) ([]map[string]interface{}, error) {
+	decision, _ := arguments["decision"].(string)
+	summary, _ := arguments["summary"].(string)
+	constraints := stringListArgument(arguments, "constraints")
+
+	if decision == "" {
+		return textContent("Error: Missing required field: decision"), fmt.Errorf("missing required fields")
+	}
+	approaches, err := approachesArgument(arguments)
+	if err != nil {
+		return textContent("Error: " + err.Error()), err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Minute)
+	defer cancel()
+
+	completion, err := t.llm.Generate(ctx, openai.ChatCompletionRequest{
+		Messages: []openai.ChatCompletionMessage{
+			{
+				Role:    openai.ChatMessageRoleUser,
+				Content: buildComparePrompt(decision, summary, approaches, constraints),
+			},
+		},
+		ResponseFormat: &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject},
+	}, nil)
+	if err != nil {
+		slog.ErrorContext(ctx, "Comparison call failed", "tool", "compare_approaches", "error", err)
+		return failureContent(err), err
+	}
+
+	usage := usageOf(completion)
+	logUsage(ctx, t.Name(), usage)
+
+	result, err := parseComparisonResult(completion.Answer, approaches)
+	if err != nil {
+		slog.ErrorContext(ctx, "Couldn't parse comparison result", "tool", "compare_approaches", "error", err)
+		return textContent("Error: The architect returned a malformed comparison. Please try again."), err
+	}
+
+	formatted, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return textContent("Error: Couldn't encode comparison result"), err
+	}
+
+	return withMeta(textContent(string(formatted)), map[string]interface{}{"usage": usage}), nil
+}
+
+// approachesArgument reads the candidate designs, naming unnamed ones A, B,
+// and so on.
+func approachesArgument(arguments map[string]interface{}) ([]Approach, error) {
+	list, _ := arguments["approaches"].([]interface{})
+	if len(list) < minComparedApproaches || len(list) > maxComparedApproaches {
+		return nil, fmt.Errorf("approaches must list %d to %d designs, got %d", minComparedApproaches, maxComparedApproaches, len(list))
+	}
+	var approaches []Approach
+	seen := make(map[string]bool)
+	for i, item := range list {
+		var approach Approach
+		switch v := item.(type) {
+		case string:
+			approach.Description = v
+		case map[string]interface{}:
+			approach.Name, _ = v["name"].(string)
+			approach.Description, _ = v["description"].(string)
+		}
+		approach.Name = strings.TrimSpace(approach.Name)
+		if strings.TrimSpace(approach.Description) == "" {
+			return nil, fmt.Errorf("approach %d has no description", i+1)
+		}
+		if approach.Name == "" {
+			approach.Name = string(rune('A' + i))
+		}
+		if seen[strings.ToLower(approach.Name)] {
+			return nil, fmt.Errorf("two approaches are named %q", approach.Name)
+		}
+		seen[strings.ToLower(approach.Name)] = true
+		approaches = append(approaches, approach)
+	}
+	return approaches, nil
+}
+
+func buildComparePrompt(decision, summary string, approaches []Approach, constraints []string) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "As a software architect, compare these %d approaches and recommend one. ", len(approaches))
+	b.WriteString("Judge each on its merits for this project; don't favour an approach because it is listed first or described at more length.\n\n")
+	fmt.Fprintf(&b, "**Decision:** %s\n", decision)
+	if summary != "" {
+		fmt.Fprintf(&b, "\n<summary>\n%s\n</summary>\n", summary)
+	}
+	for _, approach := range approaches {
+		fmt.Fprintf(&b, "\n<approach name=%q>\n%s\n</approach>\n", approach.Name, approach.Description)
+	}
+	if len(constraints) > 0 {
+		b.WriteString("\n**Constraints:**\n")
+		for _, constraint := range constraints {
+			fmt.Fprintf(&b, "- %s\n", constraint)
+		}
+		b.WriteString("\nMake each constraint a row of the matrix, then add the other criteria that matter most for this decision (such as complexity, failure modes and operational cost).\n")
+	} else {
+		b.WriteString("\nChoose the criteria that matter most for this decision (such as correctness, complexity, failure modes and operational cost).\n")
+	}
+	fmt.Fprintf(&b, `
+Respond with a JSON object of this exact shape:
+{
+  "matrix": [
+    {"criterion": "...", "ratings": [{"approach": "...", "rating": "strong", "note": "..."}]}
+  ],
+  "recommendation": {"approach": "...", "rationale": "...", "choose_otherwise_if": "..."}
+}
+Every row rates every approach, by its exact name. "rating" is one of %s; use "fails" when the approach breaks a hard constraint.
+"choose_otherwise_if" says what would change the recommendation, and to which approach.`, strings.Join(comparisonRatings, ", "))
+
+	return b.String()
+}
+
+func parseComparisonResult(answer string, approaches []Approach) (*ComparisonResult, error) {
+	var result ComparisonResult
+	if err := json.Unmarshal([]byte(answer), &result); err != nil {
+		return nil, err
+	}
+	if len(result.Matrix) == 0 {
+		return nil, fmt.Errorf("no criteria in comparison result")
+	}
+	names := make([]string, len(approaches))
+	for i, approach := range approaches {
+		names[i] = approach.Name
+	}
+	if !slices.Contains(names, result.Recommendation.Approach) {
+		return nil, fmt.Errorf("recommended approach %q isn't one of %s", result.Recommendation.Approach, strings.Join(names, ", "))
+	}
+	for _, row := range result.Matrix {
+		for _, rating := range row.Ratings {
+			if !slices.Contains(names, rating.Approach) {
+				return nil, fmt.Errorf("%s: rated unknown approach %q", row.Criterion, rating.Approach)
+			}
+			if !slices.Contains(comparisonRatings, rating.Rating) {
+				return nil, fmt.Errorf("%s: unknown rating %q", row.Criterion, rating.Rating)
+			}
+		}
+	}
+	return &result, nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const testComparison = `{"matrix":[` +
+	`{"criterion":"No new infrastructure","ratings":[{"approach":"Advisory lock","rating":"strong","note":"Postgres only"},{"approach":"B","rating":"fails","note":"needs Redis"}]},` +
+	`{"criterion":"Complexity","ratings":[{"approach":"Advisory lock","rating":"adequate","note":"one query"},{"approach":"B","rating":"weak","note":"lease renewal"}]}],` +
+	`"recommendation":{"approach":"Advisory lock","rationale":"meets every constraint","choose_otherwise_if":"you add Redis anyway: B"}}`
+
+func TestCompareApproachesTool_Call(t *testing.T) {
+	var prompt string
+	tool := NewCompareApproachesTool(NewLLM("o3").WithProvider(CompletionFunc(func(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error) {
+		prompt = req.Messages[len(req.Messages)-1].Content
+		return &Completion{Answer: testComparison, Model: req.Model}, nil
+	})))
+
+	content, err := tool.Call(map[string]interface{}{
+		"decision": "How should the reconciler avoid double-processing?",
+		"approaches": []interface{}{
+			map[string]interface{}{"name": "Advisory lock", "description": "pg_try_advisory_lock before each run"},
+			map[string]interface{}{"description": "A Redis lease renewed every 10s"},
+		},
+		"constraints": []interface{}{"No new infrastructure"},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var result ComparisonResult
+	if err := json.Unmarshal([]byte(content[0]["text"].(string)), &result); err != nil {
+		t.Fatalf("Expected a JSON result, got %v", err)
+	}
+	if len(result.Matrix) != 2 || result.Recommendation.Approach != "Advisory lock" || result.Recommendation.ChooseOtherwise == "" {
+		t.Errorf("Expected the matrix and recommendation, got %+v", result)
+	}
+	for _, want := range []string{
+		"compare these 2 approaches",
+		`<approach name="Advisory lock">`,
+		`<approach name="B">`,
+		"- No new infrastructure",
+		"Make each constraint a row",
+	} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("Expected the prompt to contain %q, got:\n%s", want, prompt)
+		}
+	}
+}
+
+func TestCompareApproachesTool_Call_Invalid(t *testing.T) {
+	tool := NewCompareApproachesTool(NewLLM("o3"))
+	one := []interface{}{"Use a lock"}
+	five := []interface{}{"a", "b", "c", "d", "e"}
+	duplicate := []interface{}{
+		map[string]interface{}{"name": "Lock", "description": "a"},
+		map[string]interface{}{"name": "lock", "description": "b"},
+	}
+	empty := []interface{}{"a", map[string]interface{}{"name": "B"}}
+	for _, arguments := range []map[string]interface{}{
+		{"approaches": []interface{}{"a", "b"}},
+		{"decision": "d", "approaches": one},
+		{"decision": "d", "approaches": five},
+		{"decision": "d", "approaches": duplicate},
+		{"decision": "d", "approaches": empty},
+	} {
+		if _, err := tool.Call(arguments); err == nil {
+			t.Errorf("Expected an error for %v", arguments)
+		}
+	}
+}
+
+func TestParseComparisonResult_Invalid(t *testing.T) {
+	approaches := []Approach{{Name: "Advisory lock"}, {Name: "B"}}
+	for _, answer := range []string{
+		"not json",
+		`{"matrix":[],"recommendation":{"approach":"B"}}`,
+		strings.Replace(testComparison, `"approach":"Advisory lock","rationale"`, `"approach":"C","rationale"`, 1),
+		strings.Replace(testComparison, `"rating":"weak"`, `"rating":"meh"`, 1),
+		strings.Replace(testComparison, `{"approach":"B","rating":"fails"`, `{"approach":"Z","rating":"fails"`, 1),
+	} {
+		if _, err := parseComparisonResult(answer, approaches); err == nil {
+			t.Errorf("Expected an error for %s", answer)
+		}
+	}
+	if _, err := parseComparisonResult(testComparison, approaches); err != nil {
+		t.Errorf("Expected the test comparison to parse, got %v", err)
+	}
+}
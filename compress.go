@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// Compressor condenses context too large for the prompt into the facts the
+// question needs, using a cheap model with a larger context window. It is
+// the first stage of a summarize-then-ask pipeline: the architect model
+// then sees the condensed context instead of a trimmed one.
+type Compressor struct {
+	llm *LLM
+
+	// digests remembers recent results by input, so asking the same
+	// question again produces the same prompt and can hit the cache.
+	mu      sync.Mutex
+	digests map[string]string
+}
+
+// maxDigests bounds the remembered digests; the memo is cleared when full.
+const maxDigests = 100
+
+func NewCompressor(llm *LLM) *Compressor {
+	return &Compressor{llm: llm, digests: make(map[string]string)}
+}
+
+// Compress condenses the summary and code sections into at most about limit
+// characters. Context that doesn't fit even the cheap model's window is
+// trimmed first. The completion, when non-nil, is the model call to count
+// towards usage.
+func (c *Compressor) Compress(ctx context.Context, question string, summary *promptSection, code []*promptSection, limit int) (string, *Completion, error) {
+	// Work on copies so the originals stay intact if compression fails.
+	summaryCopy := *summary
+	sections := make([]*promptSection, len(code))
+	for i, s := range code {
+		copied := *s
+		sections[i] = &copied
+	}
+
+	// Leave a tenth of the window for the instructions and the answer.
+	window := contextWindowFor(c.llm.modelChain()[0]) * 4 * 9 / 10
+	prompt := buildCompressPrompt(question, &summaryCopy, sections, limit)
+	if excess := len(prompt) - window; excess > 0 {
+		fitContext(excess, question, &summaryCopy, sections)
+		prompt = buildCompressPrompt(question, &summaryCopy, sections, limit)
+	}
+
+	key := contextHash(prompt)
+	c.mu.Lock()
+	digest, ok := c.digests[key]
+	c.mu.Unlock()
+	if ok {
+		return digest, nil, nil
+	}
+
+	completion, err := c.llm.Generate(ctx, userRequest(prompt), nil)
+	if err != nil {
+		return "", nil, err
+	}
+	digest = strings.TrimSpace(completion.Answer)
+	if digest == "" {
+		return "", completion, fmt.Errorf("empty condensed context")
+	}
+	slog.InfoContext(ctx, "Condensed context", "tokens_before", estimateTokens(prompt), "tokens_after", estimateTokens(digest))
+	digest = truncateMiddle(digest, limit)
+
+	c.mu.Lock()
+	if len(c.digests) >= maxDigests {
+		clear(c.digests)
+	}
+	c.digests[key] = digest
+	c.mu.Unlock()
+	return digest, completion, nil
+}
+
+func buildCompressPrompt(question string, summary *promptSection, code []*promptSection, limit int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "A software architect will be asked the question below, but the project context is too large to send along. Condense it into what the architect needs to answer: the relevant parts of the architecture and conventions, and the code involved, quoting the key lines, signatures and error messages verbatim. Leave out anything unrelated to the question. Use at most %d words, and respond with only the condensed context.\n\n**Question:** %s\n", limit/6, question)
+	if summary.Text != "" {
+		fmt.Fprintf(&b, "\n<context name=\"summary\">\n%s\n</context>\n", summary.Text)
+	}
+	for _, s := range code {
+		if s.Text != "" {
+			fmt.Fprintf(&b, "\n<context name=%q>\n%s\n</context>\n", s.Name, s.Text)
+		}
+	}
+	return b.String()
+}
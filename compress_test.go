@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// writeTestSummary writes a short summary file, for tests that need the
+// prompt to fit without depending on the size of the repository's README.
+func writeTestSummary(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "PROJECT.md")
+	if err := os.WriteFile(path, []byte("# Shop\nA web shop written in Go.\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestGetHelpTool_Call_CompressesOversizedContext(t *testing.T) {
+	compressions := 0
+	compressor := NewCompressor(NewLLM("cheap").WithProvider(CompletionFunc(func(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error) {
+		compressions++
+		if !strings.Contains(req.Messages[0].Content, "process(i)") {
+			t.Errorf("Expected the cheap model to see the code, got %q", req.Messages[0].Content[:200])
+		}
+		return &Completion{Answer: "DIGEST: process is slow because of N+1 queries", Model: req.Model, PromptTokens: 30000, CompletionTokens: 100}, nil
+	})))
+
+	var prompts []string
+	tool := NewGetHelpTool("", "o3").
+		WithCache(NewResponseCache(10, time.Hour)).
+		WithCompressor(compressor)
+	tool.LLM().WithProvider(CompletionFunc(func(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error) {
+		prompts = append(prompts, req.Messages[len(req.Messages)-1].Content)
+		return &Completion{Answer: "Batch the queries", Model: req.Model, PromptTokens: 100, CompletionTokens: 50}, nil
+	}))
+
+	args := map[string]interface{}{
+		"question":      "Why is this slow?",
+		"summary":       "A service.",
+		"relevant_code": strings.Repeat("for i := range items { process(i) }\n", 3000),
+	}
+	content, err := tool.Call(args)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(prompts) != 1 || !strings.Contains(prompts[0], "DIGEST:") || strings.Contains(prompts[0], "process(i)") {
+		t.Fatalf("Expected the architect to get the digest instead of the code, got %v", prompts)
+	}
+
+	meta := content[0]["_meta"].(map[string]interface{})
+	if usage := meta["usage"].(*TokenUsage); usage.PromptTokens != 30100 {
+		t.Errorf("Expected the compression call in the usage, got %+v", usage)
+	}
+	var names []string
+	for _, section := range meta["context_usage"].(*ContextUsage).Sections {
+		names = append(names, section.Name)
+	}
+	if fmt.Sprint(names) != "[summary question relevant_code digest]" {
+		t.Errorf("Expected a digest section, got %v", names)
+	}
+
+	// The same context is condensed once, so the answer comes from cache.
+	if _, err := tool.Call(args); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if compressions != 1 || len(prompts) != 1 {
+		t.Errorf("Expected a repeat to hit the cache, got %d compressions and %d architect calls", compressions, len(prompts))
+	}
+}
+
+func TestGetHelpTool_Call_CompressionFailureRefuses(t *testing.T) {
+	withFastRetries(t)
+	compressor := NewCompressor(NewLLM("cheap").WithProvider(CompletionFunc(func(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error) {
+		return nil, fmt.Errorf("unavailable")
+	})))
+
+	tool := NewGetHelpTool("", "o3").WithCompressor(compressor)
+	tool.LLM().WithProvider(CompletionFunc(func(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error) {
+		t.Error("Expected no architect call for a prompt over the limit")
+		return &Completion{Answer: "answer", Model: req.Model}, nil
+	}))
+
+	content, err := tool.Call(map[string]interface{}{
+		"question":      "Why is this slow?",
+		"summary":       "A service.",
+		"relevant_code": strings.Repeat("for i := range items { process(i) }\n", 3000),
+	})
+	if err == nil || !strings.Contains(content[0]["text"].(string), "allow_large=true") {
+		t.Errorf("Expected the caller's code, left whole, to need allow_large, got %v", content)
+	}
+}
+
+func TestGetHelpTool_Call_SmallContextNotCompressed(t *testing.T) {
+	compressor := NewCompressor(NewLLM("cheap").WithProvider(CompletionFunc(func(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error) {
+		t.Error("Expected no compression for context that fits")
+		return nil, fmt.Errorf("unexpected")
+	})))
+	tool := NewGetHelpTool(writeTestSummary(t), "o3").WithCompressor(compressor)
+	tool.LLM().WithProvider(CompletionFunc(func(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error) {
+		return &Completion{Answer: "answer", Model: req.Model}, nil
+	}))
+	if _, err := tool.Call(map[string]interface{}{"question": "q", "summary": "s"}); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+}
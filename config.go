@@ -0,0 +1,416 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// configEnvPrefix names the environment variables that set flags:
+// ESCALATOR_BUDGET_DAILY sets -budget-daily.
+const configEnvPrefix = "ESCALATOR_"
+
+// ConfigSetting is one setting read from a config file. Key is the flag
+// it sets; the sections it was nested in are joined to it with hyphens,
+// so budget.daily sets -budget-daily.
+type ConfigSetting struct {
+	Key    string
+	Values []string
+	Line   int
+}
+
+// LoadConfig reads the settings of a YAML (.yaml, .yml) or TOML (.toml)
+// config file. Only the parts of either format that flags need are read:
+// nested sections, strings, numbers, booleans and lists of them.
+func LoadConfig(path string) ([]ConfigSetting, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var settings []ConfigSetting
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		settings, err = parseYAMLConfig(data)
+	case ".toml":
+		settings, err = parseTOMLConfig(data)
+	default:
+		return nil, fmt.Errorf("%s: unknown config format %q; want .yaml, .yml or .toml", path, ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return settings, nil
+}
+
+// configKey joins a setting's sections and name into a flag name.
+func configKey(parts ...string) string {
+	var kept []string
+	for _, part := range parts {
+		if part != "" {
+			kept = append(kept, strings.ReplaceAll(part, "_", "-"))
+		}
+	}
+	return strings.Join(kept, "-")
+}
+
+// configEnvName is the environment variable that sets a flag.
+func configEnvName(flagName string) string {
+	return configEnvPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// ApplyConfig sets the flags of fs that weren't given on the command line
+// from the environment and then from the config file at path, if any, so
+// flags take precedence over the environment, and the environment over
+// the file. A setting for a flag that doesn't exist is an error, so a
+// typo doesn't go unnoticed.
+func ApplyConfig(fs *flag.FlagSet, path string, lookupEnv func(string) (string, bool)) error {
+	given := givenFlags(fs)
+
+	var problems []string
+	fs.VisitAll(func(f *flag.Flag) {
+		if given[f.Name] || f.Name == "config" {
+			return
+		}
+		name := configEnvName(f.Name)
+		if value, ok := lookupEnv(name); ok {
+			if err := fs.Set(f.Name, value); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %v", name, err))
+			}
+			given[f.Name] = true
+		}
+	})
+
+	if path != "" {
+		settings, err := LoadConfig(path)
+		if err != nil {
+			return err
+		}
+		for _, setting := range settings {
+			if err := checkConfigSetting(fs, setting); err != nil {
+				problems = append(problems, fmt.Sprintf("%s:%d: %v", path, setting.Line, err))
+				continue
+			}
+			if given[setting.Key] {
+				continue
+			}
+			if err := setConfigFlag(fs, setting); err != nil {
+				problems = append(problems, fmt.Sprintf("%s:%d: %v", path, setting.Line, err))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// checkConfigSetting checks that a setting names a flag that can be set
+// from a file.
+func checkConfigSetting(fs *flag.FlagSet, setting ConfigSetting) error {
+	f := fs.Lookup(setting.Key)
+	if f == nil {
+		return fmt.Errorf("unknown setting %q", setting.Key)
+	}
+	if f.Name == "config" {
+		return fmt.Errorf("a config file can't name another config file")
+	}
+	return nil
+}
+
+// repeatableFlag is implemented by flag values that collect every value
+// they are set to, rather than keeping the last.
+type repeatableFlag interface {
+	flag.Value
+	repeatable()
+}
+
+// setConfigFlag sets a flag from a setting. A repeatable flag is set once
+// per value; other flags get a list as one comma-separated value.
+func setConfigFlag(fs *flag.FlagSet, setting ConfigSetting) error {
+	f := fs.Lookup(setting.Key)
+	values := setting.Values
+	if _, ok := f.Value.(repeatableFlag); !ok {
+		values = []string{strings.Join(values, ",")}
+	}
+	for _, value := range values {
+		if err := fs.Set(setting.Key, value); err != nil {
+			return fmt.Errorf("%s: %v", setting.Key, err)
+		}
+	}
+	return nil
+}
+
+// parseYAMLConfig reads block mappings nested by indentation, with scalar
+// values, flow lists ([a, b]) and block lists ("- a").
+func parseYAMLConfig(data []byte) ([]ConfigSetting, error) {
+	type section struct {
+		indent int
+		key    string
+	}
+	var stack []section
+	var settings []ConfigSetting
+	// list is the setting whose block list is being read, if any.
+	var list *ConfigSetting
+	listIndent := -1
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := stripConfigComment(scanner.Text())
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || trimmed == "---" {
+			continue
+		}
+		if strings.Contains(line, "\t") && strings.TrimLeft(line, "\t") != line {
+			return nil, fmt.Errorf("line %d: indent with spaces, not tabs", n)
+		}
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+
+		if item, ok := strings.CutPrefix(trimmed, "-"); ok && (item == "" || item[0] == ' ') {
+			if list == nil || indent < listIndent {
+				return nil, fmt.Errorf("line %d: list item outside a list", n)
+			}
+			value, err := parseConfigScalar(strings.TrimSpace(item))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", n, err)
+			}
+			list.Values = append(list.Values, value)
+			continue
+		}
+		if list != nil {
+			settings = append(settings, *list)
+			list, listIndent = nil, -1
+		}
+
+		key, value, ok := strings.Cut(trimmed, ":")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("line %d: expected key: value", n)
+		}
+		key, value = strings.Trim(strings.TrimSpace(key), `"'`), strings.TrimSpace(value)
+		for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+		parts := make([]string, 0, len(stack)+1)
+		for _, s := range stack {
+			parts = append(parts, s.key)
+		}
+		full := configKey(append(parts, key)...)
+
+		switch {
+		case value == "":
+			// A section, or a setting whose block list follows.
+			stack = append(stack, section{indent: indent, key: key})
+			list, listIndent = &ConfigSetting{Key: full, Line: n}, indent
+		case value == "|" || value == ">" || strings.HasPrefix(value, "|-") || strings.HasPrefix(value, ">-"):
+			return nil, fmt.Errorf("line %d: block text isn't supported; put the text in a file and name the file", n)
+		case strings.HasPrefix(value, "["):
+			values, err := parseConfigList(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", n, err)
+			}
+			settings = append(settings, ConfigSetting{Key: full, Values: values, Line: n})
+		default:
+			scalar, err := parseConfigScalar(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", n, err)
+			}
+			settings = append(settings, ConfigSetting{Key: full, Values: []string{scalar}, Line: n})
+		}
+	}
+	if list != nil {
+		settings = append(settings, *list)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	// Sections are only their settings; an empty one sets nothing.
+	var kept []ConfigSetting
+	for _, setting := range settings {
+		if len(setting.Values) > 0 {
+			kept = append(kept, setting)
+		}
+	}
+	return kept, nil
+}
+
+// parseTOMLConfig reads [section] tables and key = value pairs with
+// scalar or array values, which may span lines.
+func parseTOMLConfig(data []byte) ([]ConfigSetting, error) {
+	var settings []ConfigSetting
+	table := ""
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(stripConfigComment(scanner.Text()))
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && !strings.Contains(line, "=") {
+			name, ok := strings.CutSuffix(strings.TrimPrefix(line, "["), "]")
+			if !ok || strings.HasPrefix(name, "[") {
+				return nil, fmt.Errorf("line %d: expected [table]", n)
+			}
+			table = configKey(strings.Split(strings.TrimSpace(name), ".")...)
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("line %d: expected key = value", n)
+		}
+		start := n
+		value = strings.TrimSpace(value)
+		for strings.HasPrefix(value, "[") && !strings.HasSuffix(value, "]") && scanner.Scan() {
+			n++
+			value += " " + strings.TrimSpace(stripConfigComment(scanner.Text()))
+		}
+		full := configKey(append([]string{table}, strings.Split(strings.Trim(strings.TrimSpace(key), `"'`), ".")...)...)
+
+		var values []string
+		var err error
+		if strings.HasPrefix(value, "[") {
+			values, err = parseConfigList(value)
+		} else {
+			var scalar string
+			scalar, err = parseConfigScalar(value)
+			values = []string{scalar}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", start, err)
+		}
+		settings = append(settings, ConfigSetting{Key: full, Values: values, Line: start})
+	}
+	return settings, scanner.Err()
+}
+
+// stripConfigComment drops a # comment that isn't inside quotes.
+func stripConfigComment(line string) string {
+	var quote rune
+	escaped := false
+	for i, r := range line {
+		switch {
+		case escaped:
+			escaped = false
+		case quote == '"' && r == '\\':
+			escaped = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// parseConfigScalar reads a quoted or plain value.
+func parseConfigScalar(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, `"`):
+		unquoted, err := strconv.Unquote(value)
+		if err != nil {
+			return "", fmt.Errorf("bad string %s", value)
+		}
+		return unquoted, nil
+	case strings.HasPrefix(value, "'"):
+		if len(value) < 2 || !strings.HasSuffix(value, "'") {
+			return "", fmt.Errorf("bad string %s", value)
+		}
+		return strings.ReplaceAll(value[1:len(value)-1], "''", "'"), nil
+	case value == "~" || value == "null":
+		return "", nil
+	}
+	return value, nil
+}
+
+// parseConfigList reads a one-line list of scalars, such as [a, "b, c"].
+func parseConfigList(value string) ([]string, error) {
+	inner, ok := strings.CutSuffix(strings.TrimPrefix(value, "["), "]")
+	if !ok {
+		return nil, fmt.Errorf("unterminated list %s", value)
+	}
+	var values []string
+	var item strings.Builder
+	var quote rune
+	flush := func() error {
+		text := strings.TrimSpace(item.String())
+		item.Reset()
+		if text == "" {
+			return nil
+		}
+		scalar, err := parseConfigScalar(text)
+		if err != nil {
+			return err
+		}
+		values = append(values, scalar)
+		return nil
+	}
+	escaped := false
+	for _, r := range inner {
+		switch {
+		case escaped:
+			escaped = false
+		case quote == '"' && r == '\\':
+			escaped = true
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote == 0 && (r == '"' || r == '\''):
+			quote = r
+		case quote == 0 && r == ',':
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		item.WriteRune(r)
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// runConfigCommand implements `escalator config validate`, which checks a
+// config file and the ESCALATOR_ environment against the server's flags
+// without starting it.
+func runConfigCommand(args []string, flags *flag.FlagSet, out io.Writer) int {
+	if len(args) == 0 || args[0] != "validate" {
+		fmt.Fprintln(out, "Usage: escalator config validate [-config path | path]")
+		return 2
+	}
+	fs := flag.NewFlagSet("config validate", flag.ContinueOnError)
+	fs.SetOutput(out)
+	path := fs.String("config", os.Getenv(configEnvPrefix+"CONFIG"), "Config file to check (default: $ESCALATOR_CONFIG)")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if fs.NArg() > 0 {
+		*path = fs.Arg(0)
+	}
+	if *path == "" {
+		fmt.Fprintln(out, "No config file given")
+		return 2
+	}
+	if err := ApplyConfig(flags, *path, os.LookupEnv); err != nil {
+		fmt.Fprintln(out, capitalize(err.Error()))
+		return 1
+	}
+
+	var set []string
+	flags.Visit(func(f *flag.Flag) {
+		source := *path
+		if _, ok := os.LookupEnv(configEnvName(f.Name)); ok {
+			source = configEnvName(f.Name)
+		}
+		set = append(set, fmt.Sprintf("  -%s (from %s)", f.Name, source))
+	})
+	fmt.Fprintf(out, "%s is valid; it sets:\n%s\n", *path, strings.Join(set, "\n"))
+	return 0
+}
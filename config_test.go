@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// configFlags is a flag set like the server's, covering each kind of flag.
+func configFlags() *flag.FlagSet {
+	fs := flag.NewFlagSet("escalator", flag.ContinueOnError)
+	fs.String("config", "", "")
+	fs.String("model", "o3", "")
+	fs.String("fallback-models", "", "")
+	fs.Float64("budget-daily", 0, "")
+	fs.Duration("cache-ttl", time.Hour, "")
+	fs.Bool("sse", false, "")
+	fs.String("base-url", "", "")
+	fs.Var(&commandFlag{}, "context-source-cmd", "External context source command")
+	return fs
+}
+
+func writeConfig(t *testing.T, name, text string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	want := []ConfigSetting{
+		{Key: "model", Values: []string{"gpt-4o"}},
+		{Key: "fallback-models", Values: []string{"o3", "gpt-4o-mini"}},
+		{Key: "budget-daily", Values: []string{"20"}},
+		{Key: "base-url", Values: []string{"http://localhost:11434/v1#x"}},
+		{Key: "context-source-cmd", Values: []string{"wiki.sh --space INV", "runbooks.sh"}},
+	}
+	yaml := `# Escalator settings
+model: gpt-4o
+fallback_models: [o3, "gpt-4o-mini"]
+budget:
+  daily: 20   # USD
+base_url: "http://localhost:11434/v1#x"
+context:
+  source_cmd:
+    - wiki.sh --space INV
+    - 'runbooks.sh'
+`
+	toml := `model = "gpt-4o"
+fallback_models = [
+  "o3",  # the default
+  "gpt-4o-mini",
+]
+
+[budget]
+daily = 20
+
+[base]
+url = 'http://localhost:11434/v1#x'
+
+[context]
+source_cmd = ["wiki.sh --space INV", "runbooks.sh"]
+`
+	for name, text := range map[string]string{"escalator.yaml": yaml, "escalator.toml": toml} {
+		settings, err := LoadConfig(writeConfig(t, name, text))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		for i := range settings {
+			settings[i].Line = 0
+		}
+		if !reflect.DeepEqual(settings, want) {
+			t.Errorf("%s: got %+v, want %+v", name, settings, want)
+		}
+	}
+
+	if _, err := LoadConfig(writeConfig(t, "escalator.yaml", "persona: |\n  You are terse.\n")); err == nil {
+		t.Error("Expected an error for block text")
+	}
+	if _, err := LoadConfig(writeConfig(t, "escalator.ini", "model=o3")); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
+
+func TestApplyConfig_Precedence(t *testing.T) {
+	path := writeConfig(t, "escalator.yaml", "model: gpt-4o\nbudget:\n  daily: 20\ncache_ttl: 10m\nsse: true\ncontext_source_cmd: [a.sh, b.sh]\n")
+	fs := configFlags()
+	if err := fs.Parse([]string{"-model", "o3-pro"}); err != nil {
+		t.Fatal(err)
+	}
+	env := map[string]string{"ESCALATOR_BUDGET_DAILY": "5", "ESCALATOR_CONFIG": "ignored.yaml"}
+	lookup := func(name string) (string, bool) { value, ok := env[name]; return value, ok }
+	if err := ApplyConfig(fs, path, lookup); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]string{
+		"model":              "o3-pro",
+		"budget-daily":       "5",
+		"cache-ttl":          "10m0s",
+		"sse":                "true",
+		"context-source-cmd": "a.sh; b.sh",
+	} {
+		if got := fs.Lookup(name).Value.String(); got != want {
+			t.Errorf("-%s = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestApplyConfig_Invalid(t *testing.T) {
+	path := writeConfig(t, "escalator.toml", "modle = \"o3\"\n\n[budget]\ndaily = \"lots\"\n")
+	err := ApplyConfig(configFlags(), path, func(string) (string, bool) { return "", false })
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+	for _, want := range []string{path + `:1: unknown setting "modle"`, path + ":4: budget-daily"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected %q in %q", want, err)
+		}
+	}
+}
+
+func TestRunConfigCommand(t *testing.T) {
+	path := writeConfig(t, "escalator.yaml", "model: gpt-4o\n")
+	var out bytes.Buffer
+	if code := runConfigCommand([]string{"validate", path}, configFlags(), &out); code != 0 {
+		t.Fatalf("Expected a valid config, got %d: %s", code, out.String())
+	}
+	if !strings.Contains(out.String(), "-model (from "+path+")") {
+		t.Errorf("Expected the settings listed, got %q", out.String())
+	}
+
+	out.Reset()
+	path = writeConfig(t, "escalator.yaml", "sse: maybe\n")
+	if code := runConfigCommand([]string{"validate", "-config", path}, configFlags(), &out); code != 1 {
+		t.Errorf("Expected an invalid config to exit 1, got %d: %s", code, out.String())
+	}
+}
@@ -0,0 +1,448 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ContextSource contributes context to get_help prompts. The built-in
+// sources read what the caller names (resources, files, URLs, Sentry
+// issues) and what the server knows (the code index, git); teams add their
+// own, such as an internal wiki, with WithContextSource or as external
+// commands.
+type ContextSource interface {
+	Name() string
+
+	// Gather returns the blocks relevant to an escalation. An error fails
+	// the escalation, so sources whose context is merely helpful should log
+	// failures and return no blocks instead.
+	Gather(ctx context.Context, question string, arguments map[string]interface{}) ([]ContextBlock, error)
+}
+
+// ContextBlock is a named piece of prompt context. When the prompt is too
+// long, blocks with lower priority are trimmed first.
+type ContextBlock struct {
+	Name     string `json:"name"`
+	Text     string `json:"text"`
+	Priority int    `json:"priority,omitempty"`
+	// Score is how relevant the source judged the block, for sources that
+	// rank what they return. It is kept for `escalator explain`.
+	Score float64 `json:"score,omitempty"`
+	// Provenance labels the block in the prompt with where it came from and
+	// how fresh it is, such as "WIKI Payments/Retries (edited 3 days ago)".
+	// Blocks without one are labeled with their source's name.
+	Provenance string `json:"provenance,omitempty"`
+}
+
+// Block priorities of the built-in sources.
+const (
+	// PriorityEditor is the code selected or around the cursor in the
+	// caller's editor: what the question is about, so it's trimmed last.
+	PriorityEditor = 200
+	// PriorityNamed is context the caller asked for by name.
+	PriorityNamed = 100
+	// PriorityDefault is the default for everything else.
+	PriorityDefault = 50
+	// PriorityRetrieved is context found by similarity search, which is
+	// the likeliest to be off-topic.
+	PriorityRetrieved = 30
+)
+
+// gatherTimeout bounds how long all sources together may take.
+const gatherTimeout = 30 * time.Second
+
+// contextSources returns the built-in sources enabled by the tool's
+// configuration, followed by the added ones.
+func (t *GetHelpTool) contextSources() []ContextSource {
+	sources := []ContextSource{
+		&editorSource{},
+		&resourceSource{reader: t.resources},
+		&fileSource{repo: t.repo},
+	}
+	if t.web != nil {
+		sources = append(sources, t.web)
+	}
+	sources = append(sources, &sentrySource{client: t.sentry}, &pullRequestSource{fetcher: t.pulls})
+	if t.index != nil {
+		sources = append(sources, &retrievalSource{index: t.index, k: t.retrieveK, repo: t.repo})
+	}
+	if t.lsp != nil {
+		sources = append(sources, &lspSource{client: t.lsp})
+	}
+	if t.git != nil {
+		sources = append(sources, &gitSource{git: t.git})
+	}
+	if t.examples != nil && t.exampleK > 0 {
+		sources = append(sources, &exampleSource{history: t.examples, k: t.exampleK})
+	}
+	return append(sources, t.sources...)
+}
+
+// gatherContext asks every source for blocks concurrently and returns them
+// as prompt sections, in source order, with what each source contributed.
+func (t *GetHelpTool) gatherContext(ctx context.Context, question string, arguments map[string]interface{}) ([]*promptSection, []SourceDecision, []map[string]interface{}, error) {
+	ctx, cancel := context.WithTimeout(ctx, gatherTimeout)
+	defer cancel()
+
+	sources := t.contextSources()
+	blocks := make([][]ContextBlock, len(sources))
+	errs := make([]error, len(sources))
+	elapsed := make([]time.Duration, len(sources))
+	var wg sync.WaitGroup
+	for i, source := range sources {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			blocks[i], errs[i] = source.Gather(ctx, question, arguments)
+			elapsed[i] = time.Since(start)
+		}()
+	}
+	wg.Wait()
+
+	var sections []*promptSection
+	decisions := make([]SourceDecision, len(sources))
+	for i, err := range errs {
+		if err != nil {
+			slog.WarnContext(ctx, "Couldn't gather context", "source", sources[i].Name(), "error", err)
+			return nil, nil, textContent("Error: " + capitalize(err.Error())), err
+		}
+		decisions[i] = SourceDecision{Name: sources[i].Name(), ElapsedMS: elapsed[i].Milliseconds()}
+		for _, block := range blocks[i] {
+			if block.Text == "" {
+				continue
+			}
+			section := newPromptSection(block.Name, block.Text)
+			section.Source = sources[i].Name()
+			section.Score = block.Score
+			section.Provenance = block.Provenance
+			if section.Provenance == "" {
+				section.Provenance = "CONTEXT from " + sources[i].Name()
+			}
+			section.Priority = block.Priority
+			if section.Priority == 0 {
+				section.Priority = PriorityDefault
+			}
+			sections = append(sections, section)
+			decisions[i].Blocks++
+		}
+	}
+	return sections, decisions, nil, nil
+}
+
+func capitalize(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+	return string(unicode.ToUpper(r)) + s[size:]
+}
+
+// resourceSource reads the client resources named by resource_uris.
+type resourceSource struct {
+	reader ResourceReader
+}
+
+func (s *resourceSource) Name() string { return "resources" }
+
+func (s *resourceSource) Gather(ctx context.Context, question string, arguments map[string]interface{}) ([]ContextBlock, error) {
+	var blocks []ContextBlock
+	for _, uri := range stringListArgument(arguments, "resource_uris") {
+		if s.reader == nil {
+			return nil, fmt.Errorf("reading client resources is not supported by this server")
+		}
+		text, err := s.reader.ReadResource(ctx, uri)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't read resource %s: %w", uri, err)
+		}
+		blocks = append(blocks, ContextBlock{
+			Name:       "resource " + uri,
+			Text:       fmt.Sprintf("**Resource %s:**\n```\n%s\n```", uri, text),
+			Priority:   PriorityNamed,
+			Provenance: fmt.Sprintf("RESOURCE %s (read from the client just now)", uri),
+		})
+	}
+	return blocks, nil
+}
+
+// fileSource reads the repository files named by the files argument.
+type fileSource struct {
+	repo *Repository
+}
+
+func (s *fileSource) Name() string { return "files" }
+
+func (s *fileSource) Gather(ctx context.Context, question string, arguments map[string]interface{}) ([]ContextBlock, error) {
+	patterns := stringListArgument(arguments, "files")
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+	if s.repo == nil {
+		return nil, fmt.Errorf("reading repository files is not configured (start the server with -repo)")
+	}
+	files, err := s.repo.Resolve(patterns)
+	if err != nil {
+		return nil, err
+	}
+
+	var blocks []ContextBlock
+	for _, file := range files {
+		text, err := s.repo.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't read %s: %w", file, err)
+		}
+		blocks = append(blocks, ContextBlock{
+			Name:       "file " + file,
+			Text:       fmt.Sprintf("**File %s:**\n```\n%s\n```", file, text),
+			Priority:   PriorityNamed,
+			Provenance: s.repo.provenance(file, 1, lineCount(text)),
+		})
+	}
+	return blocks, nil
+}
+
+// sentrySource fetches the Sentry issue named by sentry_issue_id.
+type sentrySource struct {
+	client *SentryClient
+}
+
+func (s *sentrySource) Name() string { return "sentry" }
+
+func (s *sentrySource) Gather(ctx context.Context, question string, arguments map[string]interface{}) ([]ContextBlock, error) {
+	id, _ := arguments["sentry_issue_id"].(string)
+	if id == "" {
+		return nil, nil
+	}
+	if s.client == nil {
+		return nil, fmt.Errorf("Sentry integration is not configured (set SENTRY_AUTH_TOKEN)")
+	}
+	event, err := s.client.FetchIssue(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't fetch Sentry issue %s: %w", id, err)
+	}
+	return []ContextBlock{{
+		Name:       "sentry",
+		Text:       fmt.Sprintf("**Production Error (Sentry issue %s):**\n```\n%s\n```", id, event),
+		Priority:   PriorityNamed,
+		Provenance: fmt.Sprintf("SENTRY issue %s (fetched just now)", id),
+	}}, nil
+}
+
+// retrievalSource searches the code index for the chunks most relevant to
+// the question, skipping files the caller already named. Retrieval is
+// best-effort.
+type retrievalSource struct {
+	index *CodeIndex
+	k     int
+	repo  *Repository
+}
+
+func (s *retrievalSource) Name() string { return "retrieval" }
+
+func (s *retrievalSource) Gather(ctx context.Context, question string, arguments map[string]interface{}) ([]ContextBlock, error) {
+	chunks, err := s.index.Search(ctx, question, s.k)
+	if err != nil {
+		slog.WarnContext(ctx, "Couldn't search the code index", "error", err)
+		return nil, nil
+	}
+
+	named := make(map[string]bool)
+	if s.repo != nil {
+		files, _ := s.repo.Resolve(stringListArgument(arguments, "files"))
+		for _, file := range files {
+			named[file] = true
+		}
+	}
+	var blocks []ContextBlock
+	for _, chunk := range chunks {
+		if named[chunk.Path] {
+			continue
+		}
+		location := fmt.Sprintf("%s:%d-%d", chunk.Path, chunk.StartLine, chunk.EndLine)
+		provenance := fmt.Sprintf("INDEX %s %s (as last indexed)", chunk.Path, lineRange(chunk.StartLine, chunk.EndLine))
+		if s.repo != nil {
+			provenance = fmt.Sprintf("INDEX %s %s (as last indexed; file %s)", chunk.Path, lineRange(chunk.StartLine, chunk.EndLine), s.repo.modified(chunk.Path))
+		}
+		blocks = append(blocks, ContextBlock{
+			Name:       "retrieved " + location,
+			Text:       fmt.Sprintf("**Retrieved from %s:**\n```\n%s\n```", location, chunk.Content),
+			Priority:   PriorityRetrieved,
+			Score:      chunk.Score,
+			Provenance: provenance,
+		})
+	}
+	return blocks, nil
+}
+
+// gitSource describes the git checkout. It is best-effort.
+type gitSource struct {
+	git *GitContext
+}
+
+func (s *gitSource) Name() string { return "git" }
+
+func (s *gitSource) Gather(ctx context.Context, question string, arguments map[string]interface{}) ([]ContextBlock, error) {
+	sections, err := s.git.Sections(ctx)
+	if err != nil {
+		slog.WarnContext(ctx, "Couldn't read git context", "error", err)
+		return nil, nil
+	}
+	blocks := make([]ContextBlock, len(sections))
+	for i, section := range sections {
+		blocks[i] = ContextBlock{
+			Name:       section.Name,
+			Text:       section.Text,
+			Priority:   PriorityDefault,
+			Provenance: "GIT " + strings.TrimPrefix(section.Name, "git ") + " (read just now)",
+		}
+	}
+	return blocks, nil
+}
+
+// maxWebPageSize bounds how much of a page is read.
+const maxWebPageSize = 1 << 20
+
+// WebSource fetches the http(s) pages named by the urls argument, such as
+// library documentation or an issue, and includes their text.
+type WebSource struct {
+	client *http.Client
+}
+
+func NewWebSource() *WebSource {
+	return &WebSource{client: &http.Client{Timeout: 20 * time.Second}}
+}
+
+func (s *WebSource) Name() string { return "web" }
+
+func (s *WebSource) Gather(ctx context.Context, question string, arguments map[string]interface{}) ([]ContextBlock, error) {
+	var blocks []ContextBlock
+	for _, raw := range stringListArgument(arguments, "urls") {
+		text, err := s.fetch(ctx, raw)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't fetch %s: %w", raw, err)
+		}
+		blocks = append(blocks, ContextBlock{
+			Name:       "url " + raw,
+			Text:       fmt.Sprintf("**Page %s:**\n```\n%s\n```", raw, text),
+			Priority:   PriorityNamed,
+			Provenance: fmt.Sprintf("PAGE %s (fetched just now)", raw),
+		})
+	}
+	return blocks, nil
+}
+
+func (s *WebSource) fetch(ctx context.Context, raw string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return "", fmt.Errorf("only http and https URLs are supported")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("server returned %s", resp.Status)
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if contentType != "" && !strings.HasPrefix(contentType, "text/") && !strings.Contains(contentType, "json") && !strings.Contains(contentType, "xml") {
+		return "", fmt.Errorf("unsupported content type %s", contentType)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxWebPageSize))
+	if err != nil {
+		return "", err
+	}
+	if strings.HasPrefix(contentType, "text/html") {
+		return htmlText(string(body)), nil
+	}
+	return string(body), nil
+}
+
+var (
+	htmlHidden     = regexp.MustCompile(`(?is)<(script|style|head|noscript)\b.*?</(script|style|head|noscript)>`)
+	htmlBreaks     = regexp.MustCompile(`(?i)<(br|/p|/div|/li|/h[1-6]|/tr|/pre)\b[^>]*>`)
+	htmlTags       = regexp.MustCompile(`(?s)<[^>]*>`)
+	htmlBlankLines = regexp.MustCompile(`\n\s*\n\s*`)
+)
+
+// htmlText reduces an HTML page to its visible text, keeping line breaks
+// between blocks.
+func htmlText(page string) string {
+	text := htmlHidden.ReplaceAllString(page, "")
+	text = htmlBreaks.ReplaceAllString(text, "\n")
+	text = htmlTags.ReplaceAllString(text, "")
+	text = html.UnescapeString(text)
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.Join(strings.Fields(line), " ")
+	}
+	return strings.TrimSpace(htmlBlankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+}
+
+// execSource is a context source plugin run as an external command. The
+// command reads {"question": ..., "arguments": {...}} as JSON on stdin and
+// prints a JSON array of blocks ({"name", "text", "priority", "provenance"}). Plugins are
+// best-effort: a failing command is logged and contributes nothing.
+type execSource struct {
+	name    string
+	command []string
+}
+
+// NewExecContextSource runs command (split on spaces) for every escalation.
+func NewExecContextSource(command string) (ContextSource, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil, fmt.Errorf("empty context source command")
+	}
+	return &execSource{name: filepath.Base(args[0]), command: args}, nil
+}
+
+func (s *execSource) Name() string { return s.name }
+
+func (s *execSource) Gather(ctx context.Context, question string, arguments map[string]interface{}) ([]ContextBlock, error) {
+	input, err := json.Marshal(map[string]interface{}{"question": question, "arguments": arguments})
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.CommandContext(ctx, s.command[0], s.command[1:]...)
+	cmd.Stdin = bytes.NewReader(input)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		slog.WarnContext(ctx, "Context source failed", "source", s.name, "error", err, "stderr", strings.TrimSpace(stderr.String()))
+		return nil, nil
+	}
+
+	var blocks []ContextBlock
+	if trimmed := bytes.TrimSpace(out); len(trimmed) > 0 {
+		if err := json.Unmarshal(trimmed, &blocks); err != nil {
+			slog.WarnContext(ctx, "Couldn't parse context source output", "source", s.name, "error", err)
+			return nil, nil
+		}
+	}
+	for i := range blocks {
+		blocks[i].Name = s.name + " " + blocks[i].Name
+		if blocks[i].Provenance == "" {
+			blocks[i].Provenance = "PLUGIN " + blocks[i].Name
+		}
+	}
+	return blocks, nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// staticSource is a context source returning fixed blocks, or an error.
+type staticSource struct {
+	blocks []ContextBlock
+	err    error
+}
+
+func (s *staticSource) Name() string { return "static" }
+
+func (s *staticSource) Gather(ctx context.Context, question string, arguments map[string]interface{}) ([]ContextBlock, error) {
+	return s.blocks, s.err
+}
+
+func TestGetHelpTool_Call_ContextSource(t *testing.T) {
+	var prompt string
+	tool := NewGetHelpTool("", "o3").WithContextSource(&staticSource{blocks: []ContextBlock{
+		{Name: "wiki Checkout", Text: "**Wiki: Checkout**\nReservations expire after 15 minutes."},
+		{Name: "wiki Empty"},
+	}})
+	tool.LLM().WithProvider(CompletionFunc(func(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error) {
+		prompt = req.Messages[len(req.Messages)-1].Content
+		return &Completion{Answer: "answer", Model: req.Model}, nil
+	}))
+
+	content, err := tool.Call(map[string]interface{}{"question": "q", "summary": "s"})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if !strings.Contains(prompt, "Reservations expire after 15 minutes.") {
+		t.Errorf("Expected the source's block in the prompt, got %q", prompt)
+	}
+	var names []string
+	for _, section := range content[0]["_meta"].(map[string]interface{})["context_usage"].(*ContextUsage).Sections {
+		names = append(names, section.Name)
+	}
+	if got := strings.Join(names, ","); !strings.Contains(got, "wiki Checkout") || strings.Contains(got, "wiki Empty") {
+		t.Errorf("Expected a section for the non-empty block only, got %v", names)
+	}
+
+	failing := NewGetHelpTool("", "o3").WithContextSource(&staticSource{err: errors.New("wiki is down")})
+	content, err = failing.Call(map[string]interface{}{"question": "q", "summary": "s"})
+	if err == nil || content[0]["text"] != "Error: Wiki is down" {
+		t.Errorf("Expected the source's error to fail the call, got %v", content)
+	}
+}
+
+func TestExecContextSource(t *testing.T) {
+	script := writeScript(t, `input=$(cat)
+case "$input" in
+  *'"question":"How do refunds work?"'*) ;;
+  *) echo "unexpected input: $input" >&2; exit 1 ;;
+esac
+echo '[{"name": "Refunds", "text": "Refunds go through the ledger.", "priority": 80}]'
+`)
+	source, err := NewExecContextSource(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks, err := source.Gather(context.Background(), "How do refunds work?", map[string]interface{}{"question": "How do refunds work?"})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(blocks) != 1 || blocks[0].Name != "scanner.sh Refunds" || blocks[0].Priority != 80 {
+		t.Errorf("Expected one named block, got %+v", blocks)
+	}
+
+	// A failing plugin contributes nothing rather than failing the call.
+	broken, _ := NewExecContextSource(writeScript(t, "exit 3\n"))
+	if blocks, err := broken.Gather(context.Background(), "q", nil); err != nil || len(blocks) != 0 {
+		t.Errorf("Expected no blocks and no error, got %+v, %v", blocks, err)
+	}
+}
+
+func TestWebSource(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/docs":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte("<html><head><title>x</title><style>p{}</style></head><body><h1>Retries</h1><p>Use   <b>backoff</b> &amp; jitter.</p><script>track()</script></body></html>"))
+		case "/image":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte("\x89PNG"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	source := NewWebSource()
+	blocks, err := source.Gather(context.Background(), "q", map[string]interface{}{"urls": []interface{}{srv.URL + "/docs"}})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(blocks) != 1 || !strings.Contains(blocks[0].Text, "Retries\nUse backoff & jitter.") || strings.Contains(blocks[0].Text, "track()") {
+		t.Errorf("Expected the page's visible text, got %+v", blocks)
+	}
+
+	for _, u := range []string{srv.URL + "/image", srv.URL + "/missing", "file:///etc/passwd"} {
+		if _, err := source.Gather(context.Background(), "q", map[string]interface{}{"urls": []interface{}{u}}); err == nil {
+			t.Errorf("Expected an error fetching %s", u)
+		}
+	}
+}
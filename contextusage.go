@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"strings"
+)
+
+// defaultContextWindow is assumed for models without a known context window.
+const defaultContextWindow = 128000
+
+// modelContextWindows lists context window sizes in tokens. Dated snapshots
+// are matched by their family prefix, as in modelPrices.
+var modelContextWindows = map[string]int{
+	"o3":           200000,
+	"o3-mini":      200000,
+	"o4-mini":      200000,
+	"o1":           200000,
+	"gpt-4o":       128000,
+	"gpt-4o-mini":  128000,
+	"gpt-4.1":      1047576,
+	"gpt-4.1-mini": 1047576,
+	"gpt-4.1-nano": 1047576,
+}
+
+// contextWindowFor returns the context window of model in tokens.
+func contextWindowFor(model string) int {
+	if name := longestModelPrefix(model, modelContextWindows); name != "" {
+		return modelContextWindows[name]
+	}
+	return defaultContextWindow
+}
+
+// ContextUsage reports how much of the model's context window an escalation
+// used, and how each prompt section contributed.
+type ContextUsage struct {
+	ContextWindow int            `json:"context_window"`
+	PromptTokens  int            `json:"prompt_tokens"`
+	Utilization   float64        `json:"utilization"`
+	Sections      []SectionUsage `json:"sections"`
+}
+
+// SectionUsage is the estimated size of one prompt section and how much was
+// trimmed from it to fit the budget.
+type SectionUsage struct {
+	Name          string `json:"name"`
+	Tokens        int    `json:"tokens"`
+	TrimmedTokens int    `json:"trimmed_tokens,omitempty"`
+}
+
+// Ways context is left out of a prompt to fit the budget.
+const (
+	omissionDropped   = "dropped"
+	omissionTruncated = "truncated"
+	omissionCondensed = "condensed"
+	// omissionReferenced marks a follow-up's context that an earlier
+	// message carries, which isn't sent again.
+	omissionReferenced = "referenced"
+)
+
+// ContextOmission records context that was left out of the prompt, so a
+// caller can tell an answer may be weak for want of it.
+type ContextOmission struct {
+	Section string `json:"section"`
+	Action  string `json:"action"`
+	// OmittedBytes of OriginalBytes were left out, net of the marker
+	// standing in for them.
+	OmittedBytes  int `json:"omitted_bytes"`
+	OriginalBytes int `json:"original_bytes"`
+	// Headings names the summary's sections left out in whole or part.
+	Headings []string `json:"headings,omitempty"`
+}
+
+// preparedPrompt is a rendered prompt together with the size of each section
+// that went into it, what was left out, and any model calls made to prepare
+// it.
+type preparedPrompt struct {
+	Text     string
+	Sections []SectionUsage
+	Omitted  []ContextOmission
+	Calls    []*Completion
+	// Assembly records how the prompt was put together, when it is kept.
+	Assembly *PromptAssembly
+	// Warning explains a prompt over the soft limit: what was trimmed to
+	// fit, or that it was sent whole.
+	Warning string
+	// condensed is set when the context was replaced by a digest.
+	condensed bool
+}
+
+// addSection records the estimated size of a prompt section. Empty sections
+// are skipped.
+func (p *preparedPrompt) addSection(name, text string) {
+	if text == "" {
+		return
+	}
+	p.Sections = append(p.Sections, SectionUsage{Name: name, Tokens: estimateTokens(text)})
+}
+
+// addContext records the size of a context section as sent, and how much
+// was trimmed from it.
+func (p *preparedPrompt) addContext(section *promptSection) {
+	if section.original == "" {
+		return
+	}
+	usage := SectionUsage{Name: section.Name, Tokens: estimateTokens(section.Text)}
+	if !section.referenced {
+		usage.TrimmedTokens = section.trimmedTokens()
+	}
+	p.Sections = append(p.Sections, usage)
+	omission := section.omission(p.condensed)
+	// Referenced context isn't missing from the conversation.
+	if omission != nil && omission.Action != omissionReferenced {
+		p.Omitted = append(p.Omitted, *omission)
+	}
+	if p.Assembly != nil {
+		p.Assembly.recordSection(section, omission)
+	}
+}
+
+// omission describes what was left out of the section, or is nil when it
+// is sent whole. An emptied section was dropped, or condensed into the
+// digest when condensed is set.
+func (s *promptSection) omission(condensed bool) *ContextOmission {
+	if s.Text == s.original {
+		return nil
+	}
+	o := &ContextOmission{
+		Section:       s.Name,
+		Action:        omissionTruncated,
+		OmittedBytes:  len(s.original) - len(s.Text),
+		OriginalBytes: len(s.original),
+	}
+	switch {
+	case s.referenced:
+		o.Action = omissionReferenced
+	case s.Text == "" && condensed:
+		o.Action = omissionCondensed
+	case s.Text == "":
+		o.Action = omissionDropped
+	case s.Name == "summary":
+		// The summary's least relevant sections are dropped before it is
+		// cut, so name those missing in whole or part.
+		for _, section := range splitMarkdownSections(s.original)[1:] {
+			if !strings.Contains(s.Text, section) {
+				heading, _, _ := strings.Cut(section, "\n")
+				o.Headings = append(o.Headings, strings.TrimSpace(heading))
+			}
+		}
+	}
+	return o
+}
+
+// contextUsage measures the prompt against model's context window, using the
+// provider's prompt token count when it reported one.
+func (p *preparedPrompt) contextUsage(model string, promptTokens int) *ContextUsage {
+	if promptTokens == 0 {
+		promptTokens = estimateTokens(p.Text)
+	}
+	window := contextWindowFor(model)
+	return &ContextUsage{
+		ContextWindow: window,
+		PromptTokens:  promptTokens,
+		Utilization:   float64(promptTokens) / float64(window),
+		Sections:      p.Sections,
+	}
+}
+
+// logContextUsage writes a one-line utilization summary to the log.
+func logContextUsage(ctx context.Context, model string, usage *ContextUsage) {
+	parts := make([]string, len(usage.Sections))
+	for i, section := range usage.Sections {
+		parts[i] = fmt.Sprintf("%s=%d", section.Name, section.Tokens)
+		if section.TrimmedTokens > 0 {
+			parts[i] += fmt.Sprintf("(-%d)", section.TrimmedTokens)
+		}
+	}
+	slog.InfoContext(ctx, "Context usage", "model", model, "prompt_tokens", usage.PromptTokens, "context_window", usage.ContextWindow,
+		"utilization_pct", math.Round(1000*usage.Utilization)/10, "sections", strings.Join(parts, " "))
+}
+
+// formatContextStats summarizes context utilization across escalations so
+// summaries and budgets can be tuned from real data. Records without usage
+// data (imported or from older versions) are skipped.
+func formatContextStats(records []EscalationRecord) string {
+	type sectionStats struct {
+		count, tokens, maxTokens, trimmed int
+	}
+
+	var measured, nearFull int
+	var totalUtilization, maxUtilization float64
+	sections := make(map[string]*sectionStats)
+	var order []string
+	for _, rec := range records {
+		usage := rec.ContextUsage
+		if usage == nil {
+			continue
+		}
+		measured++
+		totalUtilization += usage.Utilization
+		maxUtilization = max(maxUtilization, usage.Utilization)
+		if usage.Utilization >= 0.8 {
+			nearFull++
+		}
+		for _, section := range usage.Sections {
+			// Resources, files, retrieved chunks and examples are
+			// named individually; aggregate them.
+			name := section.Name
+			if strings.HasPrefix(name, "resource ") {
+				name = "resources"
+			} else if strings.HasPrefix(name, "file ") {
+				name = "files"
+			} else if strings.HasPrefix(name, "retrieved ") {
+				name = "retrieved"
+			} else if strings.HasPrefix(name, "example ") {
+				name = "examples"
+			}
+			stats, ok := sections[name]
+			if !ok {
+				stats = &sectionStats{}
+				sections[name] = stats
+				order = append(order, name)
+			}
+			stats.count++
+			stats.tokens += section.Tokens
+			stats.maxTokens = max(stats.maxTokens, section.Tokens)
+			stats.trimmed += section.TrimmedTokens
+		}
+	}
+
+	if measured == 0 {
+		return "No escalations with context usage data.\n"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Escalations:        %d\n", measured)
+	fmt.Fprintf(&b, "Mean utilization:   %.1f%%\n", 100*totalUtilization/float64(measured))
+	fmt.Fprintf(&b, "Max utilization:    %.1f%%\n", 100*maxUtilization)
+	fmt.Fprintf(&b, "At least 80%% full:  %d\n\n", nearFull)
+	fmt.Fprintf(&b, "%-16s %8s %10s %10s %10s\n", "SECTION", "USED IN", "MEAN TOK", "MAX TOK", "TRIMMED")
+	for _, name := range order {
+		stats := sections[name]
+		fmt.Fprintf(&b, "%-16s %8d %10d %10d %10d\n", name, stats.count, stats.tokens/stats.count, stats.maxTokens, stats.trimmed)
+	}
+	return b.String()
+}
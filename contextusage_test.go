@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestContextWindowFor(t *testing.T) {
+	if got := contextWindowFor("gpt-4o-mini-2024-07-18"); got != 128000 {
+		t.Errorf("Expected 128000, got %d", got)
+	}
+	if got := contextWindowFor("o3"); got != 200000 {
+		t.Errorf("Expected 200000, got %d", got)
+	}
+	if got := contextWindowFor("my-local-model"); got != defaultContextWindow {
+		t.Errorf("Expected default window, got %d", got)
+	}
+}
+
+func TestPreparedPrompt_ContextUsage(t *testing.T) {
+	prepared := &preparedPrompt{Text: strings.Repeat("a", 4000)}
+	prepared.addSection("summary", strings.Repeat("a", 3000))
+	prepared.addSection("relevant_code", "")
+	prepared.addSection("question", strings.Repeat("a", 1000))
+
+	usage := prepared.contextUsage("o3", 0)
+	if usage.PromptTokens != 1000 || usage.ContextWindow != 200000 || usage.Utilization != 0.005 {
+		t.Errorf("Unexpected usage from estimate: %+v", usage)
+	}
+	if len(usage.Sections) != 2 || usage.Sections[0].Tokens != 750 {
+		t.Errorf("Expected empty sections to be skipped, got %+v", usage.Sections)
+	}
+
+	// The provider's count wins over the estimate.
+	if usage := prepared.contextUsage("o3", 50000); usage.Utilization != 0.25 {
+		t.Errorf("Expected reported prompt tokens to be used, got %+v", usage)
+	}
+}
+
+func TestPreparedPrompt_Omitted(t *testing.T) {
+	summary := newPromptSection("summary", "# Shop\nA web shop.\n## Billing\nInvoices.\n## Deploys\nBlue-green.\n")
+	summary.Text = dropIrrelevantSections(summary.Text, "Why do invoices fail?", 40)
+	dropped := newPromptSection("retrieved internal/cart.go:1-40", "func Add() {}")
+	dropped.Text = ""
+	kept := newPromptSection("relevant_code", "func f() {}")
+
+	prepared := &preparedPrompt{}
+	for _, section := range []*promptSection{summary, dropped, kept} {
+		prepared.addContext(section)
+	}
+	if len(prepared.Omitted) != 2 {
+		t.Fatalf("Expected only trimmed sections to be listed, got %+v", prepared.Omitted)
+	}
+	if o := prepared.Omitted[0]; o.Action != omissionTruncated || len(o.Headings) != 1 || o.Headings[0] != "## Deploys" || o.OmittedBytes != len("## Deploys\nBlue-green.\n") {
+		t.Errorf("Expected the dropped summary section to be named, got %+v", o)
+	}
+	if o := prepared.Omitted[1]; o.Action != omissionDropped || o.OmittedBytes != o.OriginalBytes {
+		t.Errorf("Expected the emptied section to be dropped, got %+v", o)
+	}
+
+	condensed := &preparedPrompt{condensed: true}
+	condensed.addContext(dropped)
+	if o := condensed.Omitted[0]; o.Action != omissionCondensed {
+		t.Errorf("Expected a section replaced by the digest to be condensed, got %+v", o)
+	}
+}
+
+func TestGetHelpTool_ContextUsageMeta(t *testing.T) {
+	srv := newFakeOpenAI(t, func(model string) string { return "answer" })
+	server := NewMCPServer("test", "1.0.0")
+	server.RegisterTool(NewGetHelpTool("", "o3").WithClientOptions(ClientOptions{BaseURL: srv.URL}))
+
+	result, errResp := server.HandleToolsCall(json.RawMessage(`{"name":"get_help","arguments":{"question":"q","summary":"s","relevant_code":"func f() {}"}}`))
+	if errResp != nil {
+		t.Fatalf("Unexpected error: %v", errResp)
+	}
+
+	content := result.Content
+	if _, ok := content[0]["_meta"]; ok {
+		t.Error("Expected metadata to be moved out of the content block")
+	}
+	meta := result.Meta
+	if meta == nil {
+		t.Fatalf("Expected _meta in result, got %v", result)
+	}
+	usage := meta["context_usage"].(*ContextUsage)
+	if usage.PromptTokens != 1000 || usage.ContextWindow != 200000 {
+		t.Errorf("Expected reported prompt tokens against the o3 window, got %+v", usage)
+	}
+	names := make([]string, len(usage.Sections))
+	for i, section := range usage.Sections {
+		names[i] = section.Name
+	}
+	if strings.Join(names, ",") != "summary,question,relevant_code" {
+		t.Errorf("Unexpected sections: %v", names)
+	}
+}
+
+func TestFormatContextStats(t *testing.T) {
+	records := []EscalationRecord{
+		{ContextUsage: &ContextUsage{Utilization: 0.9, Sections: []SectionUsage{{Name: "summary", Tokens: 100}, {Name: "resource file:///a.go", Tokens: 40, TrimmedTokens: 10}}}},
+		{ContextUsage: &ContextUsage{Utilization: 0.1, Sections: []SectionUsage{{Name: "summary", Tokens: 300}, {Name: "resource file:///b.go", Tokens: 20}}}},
+		{Question: "imported without usage"},
+	}
+
+	stats := formatContextStats(records)
+	for _, want := range []string{"Escalations:        2", "Mean utilization:   50.0%", "Max utilization:    90.0%", "At least 80% full:  1"} {
+		if !strings.Contains(stats, want) {
+			t.Errorf("Expected %q in stats, got:\n%s", want, stats)
+		}
+	}
+	if !strings.Contains(stats, "summary                 2        200        300          0") {
+		t.Errorf("Expected summary row, got:\n%s", stats)
+	}
+	if !strings.Contains(stats, "resources               2         30         40         10") {
+		t.Errorf("Expected resources aggregated, got:\n%s", stats)
+	}
+
+	if got := formatContextStats(nil); !strings.Contains(got, "No escalations") {
+		t.Errorf("Expected empty message, got %q", got)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrCoolingDown is returned for an escalation of a topic that has been
+// escalated too often lately.
+var ErrCoolingDown = errors.New("this topic is cooling down")
+
+// cooldownOverrideArgument lets a caller escalate a topic that is cooling
+// down, when it has changed strategy and knows the question is new.
+const cooldownOverrideArgument = "override_cooldown"
+
+// TopicCooldown limits how often one topic can be escalated, whoever asks.
+// Questions are clustered into topics by keyword similarity, so rewording
+// a question doesn't start a new topic; once a topic has had its quota of
+// escalations within the window, further ones are refused until the oldest
+// leaves the window, unless the caller overrides the cooldown. An agent
+// looping on the same failing area has to change strategy instead of
+// spending the budget on it.
+type TopicCooldown struct {
+	max        int
+	window     time.Duration
+	similarity float64
+	now        func() time.Time
+
+	mu     sync.Mutex
+	topics []*cooldownTopic
+}
+
+// cooldownTopic is a cluster of similar questions and when they were asked.
+type cooldownTopic struct {
+	question string
+	calls    []topicCall
+}
+
+type topicCall struct {
+	at       time.Time
+	keywords []string
+}
+
+// NewTopicCooldown allows max escalations of a topic within window.
+// Questions whose keywords overlap by at least similarity (0-1) share a
+// topic.
+func NewTopicCooldown(max int, window time.Duration, similarity float64) *TopicCooldown {
+	return &TopicCooldown{
+		max:        max,
+		window:     window,
+		similarity: similarity,
+		now:        time.Now,
+	}
+}
+
+// Check records an escalation of question, refusing it with ErrCoolingDown
+// when its topic is cooling down and override is false. Questions without
+// keywords can't be clustered and are always allowed.
+func (c *TopicCooldown) Check(question string, override bool) error {
+	keywords := questionKeywords(question)
+	if len(keywords) == 0 {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	c.expire(now)
+
+	topic := c.topicOf(keywords)
+	if topic == nil {
+		topic = &cooldownTopic{question: question}
+		c.topics = append(c.topics, topic)
+	}
+	if len(topic.calls) >= c.max {
+		if !override {
+			until := topic.calls[0].at.Add(c.window)
+			return fmt.Errorf("%w: it has been escalated %d times in the last %s (first as %q), and can be escalated again at %s",
+				ErrCoolingDown, len(topic.calls), c.window, truncateQuestion(topic.question), until.Local().Format("15:04:05"))
+		}
+		slog.Warn("Escalation cooldown overridden", "topic", topic.question, "escalations", len(topic.calls), "window", c.window.String())
+	}
+	topic.calls = append(topic.calls, topicCall{at: now, keywords: keywords})
+	return nil
+}
+
+// topicOf returns the topic closest to keywords: the one with the most
+// similar recent question, if it's similar enough. Callers hold mu.
+func (c *TopicCooldown) topicOf(keywords []string) *cooldownTopic {
+	var best *cooldownTopic
+	bestSimilarity := c.similarity
+	for _, topic := range c.topics {
+		for _, call := range topic.calls {
+			if similarity := keywordSimilarity(call.keywords, keywords); similarity >= bestSimilarity {
+				best, bestSimilarity = topic, similarity
+			}
+		}
+	}
+	return best
+}
+
+// expire forgets escalations older than the window, and topics left with
+// none. Callers hold mu.
+func (c *TopicCooldown) expire(now time.Time) {
+	topics := c.topics[:0]
+	for _, topic := range c.topics {
+		calls := topic.calls[:0]
+		for _, call := range topic.calls {
+			if now.Sub(call.at) < c.window {
+				calls = append(calls, call)
+			}
+		}
+		topic.calls = calls
+		if len(calls) > 0 {
+			topics = append(topics, topic)
+		}
+	}
+	c.topics = topics
+}
+
+// truncateQuestion shortens a question for a message.
+func truncateQuestion(question string) string {
+	question = strings.Join(strings.Fields(question), " ")
+	if len(question) <= 80 {
+		return question
+	}
+	return question[:77] + "..."
+}
+
+// withCooldownOverride adds the override argument to an escalating tool's
+// input schema.
+func withCooldownOverride(schema map[string]interface{}) map[string]interface{} {
+	properties, ok := schema["properties"].(map[string]interface{})
+	if !ok {
+		return schema
+	}
+	copied := make(map[string]interface{}, len(schema))
+	for key, value := range schema {
+		copied[key] = value
+	}
+	withOverride := make(map[string]interface{}, len(properties)+1)
+	for name, prop := range properties {
+		withOverride[name] = prop
+	}
+	withOverride[cooldownOverrideArgument] = map[string]interface{}{
+		"type":        "boolean",
+		"description": "Escalate even though this topic has been escalated too often lately. Only set it after changing strategy, when the question is genuinely new (optional)",
+	}
+	copied["properties"] = withOverride
+	return copied
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func newTestCooldown(max int) (*TopicCooldown, *time.Time) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	cooldown := NewTopicCooldown(max, time.Hour, loopSimilarityThreshold)
+	cooldown.now = func() time.Time { return now }
+	return cooldown, &now
+}
+
+func TestTopicCooldown_ClustersSimilarQuestions(t *testing.T) {
+	cooldown, now := newTestCooldown(2)
+	for _, q := range []string{
+		"Why does the checkout handler deadlock on the inventory mutex?",
+		"Unrelated: which logging library should we use?",
+		"How do I fix the deadlock in the checkout handler inventory mutex?",
+	} {
+		*now = now.Add(time.Minute)
+		if err := cooldown.Check(q, false); err != nil {
+			t.Fatalf("Expected %q to be allowed, got: %v", q, err)
+		}
+	}
+
+	*now = now.Add(time.Minute)
+	err := cooldown.Check("checkout handler deadlock inventory mutex - why?", false)
+	if !errors.Is(err, ErrCoolingDown) || !strings.Contains(err.Error(), "escalated 2 times") || !strings.Contains(err.Error(), "Why does the checkout handler deadlock") {
+		t.Fatalf("Expected a third variation refused, got %v", err)
+	}
+	if err := cooldown.Check("Which logging library should we use?", false); err != nil {
+		t.Errorf("Expected another topic to be allowed, got %v", err)
+	}
+	if err := cooldown.Check("checkout handler deadlock inventory mutex - why?", true); err != nil {
+		t.Errorf("Expected an override to be allowed, got %v", err)
+	}
+
+	// The topic's first escalation leaves the window an hour after it was
+	// made, but the override and the second are still in it.
+	*now = now.Add(57 * time.Minute)
+	if err := cooldown.Check("checkout handler deadlock inventory mutex - why?", false); !errors.Is(err, ErrCoolingDown) {
+		t.Errorf("Expected the override to count toward the topic, got %v", err)
+	}
+	*now = now.Add(2 * time.Hour)
+	if err := cooldown.Check("checkout handler deadlock inventory mutex - why?", false); err != nil {
+		t.Errorf("Expected the cooldown to end, got %v", err)
+	}
+}
+
+func TestMCPServer_HandleToolsCall_CoolingDown(t *testing.T) {
+	calls := 0
+	tool := NewGetHelpTool("", "o3")
+	tool.LLM().WithProvider(CompletionFunc(func(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error) {
+		calls++
+		return &Completion{Answer: "answer", Model: req.Model}, nil
+	}))
+	cooldown, _ := newTestCooldown(1)
+	server := NewMCPServer("test", "1.0.0").WithCooldown(cooldown)
+	server.RegisterTool(tool)
+
+	schema := server.HandleToolsList().Tools[0].InputSchema
+	if _, ok := schema["properties"].(map[string]interface{})[cooldownOverrideArgument]; !ok {
+		t.Errorf("Expected escalating tools to advertise %s", cooldownOverrideArgument)
+	}
+
+	// Different clients share a topic's cooldown.
+	server.HandleToolsCall(json.RawMessage(`{"name":"get_help","arguments":{"question":"Why does the cache return stale entries?","summary":"s","fresh":true}}`))
+	server.recordClientCapabilities(json.RawMessage(`{"capabilities":{},"clientInfo":{"name":"other-agent"}}`))
+	result, _ := server.HandleToolsCall(json.RawMessage(`{"name":"get_help","arguments":{"question":"Stale entries returned by the cache: why?","summary":"s","fresh":true}}`))
+	if !result.IsError || !strings.Contains(result.Content[0]["text"].(string), "override_cooldown: true") {
+		t.Errorf("Expected the repeated topic refused with a hint, got %+v", result)
+	}
+	result, _ = server.HandleToolsCall(json.RawMessage(`{"name":"get_help","arguments":{"question":"Stale entries returned by the cache: why?","summary":"s","fresh":true,"override_cooldown":true}}`))
+	if result.IsError {
+		t.Errorf("Expected an override to be answered, got %+v", result)
+	}
+	if calls != 2 {
+		t.Errorf("Expected the refused call not to reach the model, got %d calls", calls)
+	}
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CounterStore keeps the budget's spend and each client's recent
+// escalations in a local SQLite database, so restarting the server neither
+// resets the day's spend nor lets a throttled client start afresh. Every
+// read goes to the database, so adjustments made with the counters
+// command take effect on a running server.
+type CounterStore struct {
+	db *sql.DB
+}
+
+const countersSchema = `
+CREATE TABLE IF NOT EXISTS spend (
+	period    TEXT PRIMARY KEY,
+	spent_usd REAL NOT NULL DEFAULT 0
+);
+CREATE TABLE IF NOT EXISTS client_activity (
+	client          TEXT PRIMARY KEY,
+	calls           TEXT NOT NULL DEFAULT '[]',
+	alerted_until   TIMESTAMP,
+	throttled_until TIMESTAMP,
+	updated_at      TIMESTAMP NOT NULL
+);
+`
+
+// defaultCountersPath is ~/.escalator/counters.db.
+func defaultCountersPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "escalator-counters.db"
+	}
+	return filepath.Join(home, ".escalator", "counters.db")
+}
+
+func OpenCounters(path string) (*CounterStore, error) {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, err
+		}
+	}
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(countersSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("couldn't initialize counters schema: %w", err)
+	}
+	return &CounterStore{db: db}, nil
+}
+
+func (c *CounterStore) Close() error {
+	return c.db.Close()
+}
+
+// Spent is the spend recorded for a period, a day as 2006-01-02 or a month
+// as 2006-01.
+func (c *CounterStore) Spent(period string) (float64, error) {
+	var spent float64
+	err := c.db.QueryRow(`SELECT spent_usd FROM spend WHERE period = ?`, period).Scan(&spent)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return spent, err
+}
+
+// AddSpend adds cost to a period's spend and returns the new total.
+func (c *CounterStore) AddSpend(period string, cost float64) (float64, error) {
+	var spent float64
+	err := c.db.QueryRow(`INSERT INTO spend (period, spent_usd) VALUES (?, ?)
+		ON CONFLICT (period) DO UPDATE SET spent_usd = spent_usd + excluded.spent_usd
+		RETURNING spent_usd`, period, cost).Scan(&spent)
+	return spent, err
+}
+
+// SetSpend overwrites a period's spend.
+func (c *CounterStore) SetSpend(period string, spent float64) error {
+	_, err := c.db.Exec(`INSERT INTO spend (period, spent_usd) VALUES (?, ?)
+		ON CONFLICT (period) DO UPDATE SET spent_usd = excluded.spent_usd`, period, spent)
+	return err
+}
+
+// PeriodSpend is one period's recorded spend.
+type PeriodSpend struct {
+	Period string
+	Spent  float64
+}
+
+// AllSpend lists the recorded spend, most recent period first.
+func (c *CounterStore) AllSpend() ([]PeriodSpend, error) {
+	rows, err := c.db.Query(`SELECT period, spent_usd FROM spend ORDER BY period DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var spend []PeriodSpend
+	for rows.Next() {
+		var p PeriodSpend
+		if err := rows.Scan(&p.Period, &p.Spent); err != nil {
+			return nil, err
+		}
+		spend = append(spend, p)
+	}
+	return spend, rows.Err()
+}
+
+// storedCall is a monitoredCall as kept in the database.
+type storedCall struct {
+	At       time.Time `json:"at"`
+	Keywords []string  `json:"keywords,omitempty"`
+}
+
+// Activity returns a client's recent escalations, alert and throttle, or
+// nil if none are recorded.
+func (c *CounterStore) Activity(client string) (*clientActivity, error) {
+	var calls string
+	var alerted, throttled sql.NullTime
+	err := c.db.QueryRow(`SELECT calls, alerted_until, throttled_until FROM client_activity WHERE client = ?`, client).
+		Scan(&calls, &alerted, &throttled)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var stored []storedCall
+	if err := json.Unmarshal([]byte(calls), &stored); err != nil {
+		return nil, fmt.Errorf("couldn't parse the calls of %s: %w", client, err)
+	}
+	activity := &clientActivity{alertedUntil: alerted.Time, throttledUntil: throttled.Time}
+	for _, call := range stored {
+		activity.calls = append(activity.calls, monitoredCall{at: call.At, keywords: call.Keywords})
+	}
+	return activity, nil
+}
+
+// SaveActivity replaces a client's recorded activity.
+func (c *CounterStore) SaveActivity(client string, activity *clientActivity, now time.Time) error {
+	stored := make([]storedCall, 0, len(activity.calls))
+	for _, call := range activity.calls {
+		stored = append(stored, storedCall{At: call.at, Keywords: call.keywords})
+	}
+	calls, err := json.Marshal(stored)
+	if err != nil {
+		return err
+	}
+	_, err = c.db.Exec(`INSERT INTO client_activity (client, calls, alerted_until, throttled_until, updated_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (client) DO UPDATE SET calls = excluded.calls, alerted_until = excluded.alerted_until,
+			throttled_until = excluded.throttled_until, updated_at = excluded.updated_at`,
+		client, string(calls), nullTime(activity.alertedUntil), nullTime(activity.throttledUntil), now)
+	return err
+}
+
+// ResetActivity forgets a client's escalations and lifts any throttle,
+// reporting false if none were recorded.
+func (c *CounterStore) ResetActivity(client string) (bool, error) {
+	result, err := c.db.Exec(`DELETE FROM client_activity WHERE client = ?`, client)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// ClientCounters summarizes a client's recorded activity.
+type ClientCounters struct {
+	Client         string
+	Calls          int
+	ThrottledUntil time.Time
+	UpdatedAt      time.Time
+}
+
+// Clients lists the clients with recorded activity, most recently active
+// first.
+func (c *CounterStore) Clients() ([]ClientCounters, error) {
+	rows, err := c.db.Query(`SELECT client, calls, throttled_until, updated_at FROM client_activity ORDER BY updated_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var clients []ClientCounters
+	for rows.Next() {
+		var cc ClientCounters
+		var calls string
+		var throttled sql.NullTime
+		if err := rows.Scan(&cc.Client, &calls, &throttled, &cc.UpdatedAt); err != nil {
+			return nil, err
+		}
+		var stored []storedCall
+		json.Unmarshal([]byte(calls), &stored)
+		cc.Calls = len(stored)
+		cc.ThrottledUntil = throttled.Time
+		clients = append(clients, cc)
+	}
+	return clients, rows.Err()
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+// runCountersCommand inspects and adjusts the persisted counters.
+func runCountersCommand(args []string, out io.Writer) int {
+	usage := "Usage: escalator counters list [-db path]\n" +
+		"       escalator counters set-spend [-db path] period amount\n" +
+		"       escalator counters reset-client [-db path] client"
+	if len(args) == 0 {
+		fmt.Fprintln(out, usage)
+		return 2
+	}
+
+	fs := flag.NewFlagSet("counters "+args[0], flag.ContinueOnError)
+	fs.SetOutput(out)
+	dbPath := fs.String("db", defaultCountersPath(), "Path to the counters database")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	store, err := OpenCounters(*dbPath)
+	if err != nil {
+		fmt.Fprintf(out, "Couldn't open counters: %v\n", err)
+		return 1
+	}
+	defer store.Close()
+
+	switch args[0] {
+	case "list":
+		spend, err := store.AllSpend()
+		if err != nil {
+			fmt.Fprintf(out, "Couldn't query counters: %v\n", err)
+			return 1
+		}
+		clients, err := store.Clients()
+		if err != nil {
+			fmt.Fprintf(out, "Couldn't query counters: %v\n", err)
+			return 1
+		}
+		fmt.Fprintln(out, "Spend:")
+		for _, p := range spend {
+			fmt.Fprintf(out, "  %-10s  $%.4f\n", p.Period, p.Spent)
+		}
+		fmt.Fprintln(out, "Clients:")
+		now := time.Now()
+		for _, cc := range clients {
+			line := fmt.Sprintf("  %s  %d recent calls, last seen %s", cc.Client, cc.Calls, cc.UpdatedAt.Local().Format("2006-01-02 15:04"))
+			if cc.ThrottledUntil.After(now) {
+				line += ", throttled until " + cc.ThrottledUntil.Local().Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintln(out, line)
+		}
+	case "set-spend":
+		if fs.NArg() != 2 {
+			fmt.Fprintln(out, usage)
+			return 2
+		}
+		period := fs.Arg(0)
+		if _, dayErr := time.Parse("2006-01-02", period); dayErr != nil {
+			if _, monthErr := time.Parse("2006-01", period); monthErr != nil {
+				fmt.Fprintf(out, "Period must be a day (2006-01-02) or a month (2006-01), got %q\n", period)
+				return 2
+			}
+		}
+		amount, err := strconv.ParseFloat(strings.TrimPrefix(fs.Arg(1), "$"), 64)
+		if err != nil || amount < 0 {
+			fmt.Fprintf(out, "Amount must be a non-negative number of USD, got %q\n", fs.Arg(1))
+			return 2
+		}
+		if err := store.SetSpend(period, amount); err != nil {
+			fmt.Fprintf(out, "Couldn't set spend: %v\n", err)
+			return 1
+		}
+		fmt.Fprintf(out, "Spend for %s set to $%.4f\n", period, amount)
+	case "reset-client":
+		if fs.NArg() != 1 {
+			fmt.Fprintln(out, usage)
+			return 2
+		}
+		found, err := store.ResetActivity(fs.Arg(0))
+		if err != nil {
+			fmt.Fprintf(out, "Couldn't reset %s: %v\n", fs.Arg(0), err)
+			return 1
+		}
+		if !found {
+			fmt.Fprintf(out, "No activity recorded for %s\n", fs.Arg(0))
+			return 1
+		}
+		fmt.Fprintf(out, "Reset %s's escalations and throttle\n", fs.Arg(0))
+	default:
+		fmt.Fprintln(out, usage)
+		return 2
+	}
+	return 0
+}
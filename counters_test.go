@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func openTestCounters(t *testing.T, path string) *CounterStore {
+	t.Helper()
+	store, err := OpenCounters(path)
+	if err != nil {
+		t.Fatalf("Expected counters to open, got: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestBudget_PersistsAcrossRestarts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "counters.db")
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	newBudget := func() *Budget {
+		budget := NewBudget(1.00, 5.00).WithStore(openTestCounters(t, path))
+		budget.now = func() time.Time { return now }
+		return budget
+	}
+
+	newBudget().Spend(1.10)
+	if err := newBudget().Check(); !errors.Is(err, ErrBudgetExhausted) {
+		t.Fatalf("Expected the spend to survive a restart, got: %v", err)
+	}
+
+	// Adjusting the counters takes effect on a running server.
+	budget := newBudget()
+	store := openTestCounters(t, path)
+	if err := store.SetSpend("2025-03-10", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := budget.Check(); err != nil {
+		t.Errorf("Expected the adjusted spend to be read, got: %v", err)
+	}
+	if spent, _ := store.Spent("2025-03"); spent != 1.10 {
+		t.Errorf("Expected the month's spend to be kept, got %v", spent)
+	}
+}
+
+func TestEscalationMonitor_ThrottlePersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "counters.db")
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	newMonitor := func() *EscalationMonitor {
+		monitor := NewEscalationMonitor(10*time.Minute, 3, 0).WithThrottle(time.Hour).WithStore(openTestCounters(t, path))
+		monitor.now = func() time.Time { return now }
+		return monitor
+	}
+
+	monitor := newMonitor()
+	monitor.Observe("agent", "get_help", "first")
+	monitor.Observe("agent", "get_help", "second")
+	// Two calls recorded before the restart count towards the limit after it.
+	if anomaly, _ := newMonitor().Observe("agent", "get_help", "third"); anomaly == nil || anomaly.Kind != "rate" {
+		t.Fatalf("Expected a rate anomaly counting calls from before the restart, got %+v", anomaly)
+	}
+	if _, err := newMonitor().Observe("agent", "get_help", "fourth"); !errors.Is(err, ErrThrottled) {
+		t.Errorf("Expected the throttle to survive a restart, got %v", err)
+	}
+
+	var out bytes.Buffer
+	if code := runCountersCommand([]string{"list", "-db", path}, &out); code != 0 || !strings.Contains(out.String(), "agent") {
+		t.Errorf("Expected the client to be listed, got %d: %s", code, out.String())
+	}
+	out.Reset()
+	if code := runCountersCommand([]string{"reset-client", "-db", path, "agent"}, &out); code != 0 {
+		t.Fatalf("Expected reset-client to succeed, got %d: %s", code, out.String())
+	}
+	if _, err := monitor.Observe("agent", "get_help", "fifth"); err != nil {
+		t.Errorf("Expected the reset to lift the throttle on a running server, got %v", err)
+	}
+}
+
+func TestRunCountersCommand(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "counters.db")
+	var out bytes.Buffer
+	if code := runCountersCommand([]string{"set-spend", "-db", path, "2025-03", "$2.50"}, &out); code != 0 {
+		t.Fatalf("Expected set-spend to succeed, got %d: %s", code, out.String())
+	}
+	out.Reset()
+	if code := runCountersCommand([]string{"list", "-db", path}, &out); code != 0 || !strings.Contains(out.String(), "2025-03     $2.5000") {
+		t.Errorf("Expected the month's spend to be listed, got %d: %s", code, out.String())
+	}
+
+	for _, args := range [][]string{
+		{"set-spend", "-db", path, "March", "1"},
+		{"set-spend", "-db", path, "2025-03-10", "-1"},
+		{"set-spend", "-db", path, "2025-03-10"},
+		{"reset-client", "-db", path},
+		{"bogus", "-db", path},
+	} {
+		if code := runCountersCommand(args, &out); code != 2 {
+			t.Errorf("Expected a usage error for %v, got %d", args, code)
+		}
+	}
+	if code := runCountersCommand([]string{"reset-client", "-db", path, "nobody"}, &out); code != 1 {
+		t.Errorf("Expected an error for an unknown client, got %d", code)
+	}
+}
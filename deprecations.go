@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ModelDeprecation records that a provider is retiring a model, and the
+// model that replaces it.
+type ModelDeprecation struct {
+	Model     string `json:"model"`
+	Successor string `json:"successor"`
+	// Retires is the day the model stops answering, as YYYY-MM-DD (optional).
+	Retires string `json:"retires,omitempty"`
+}
+
+// knownDeprecations are retirements the provider has announced. A
+// -model-deprecations file adds to them and overrides them.
+var knownDeprecations = []ModelDeprecation{
+	{Model: "gpt-4-vision-preview", Successor: "gpt-4o", Retires: "2024-12-06"},
+	{Model: "gpt-4-32k", Successor: "gpt-4o", Retires: "2025-06-06"},
+	{Model: "gpt-4.5-preview", Successor: "gpt-4.1", Retires: "2025-07-14"},
+	{Model: "o1-preview", Successor: "o3", Retires: "2025-07-28"},
+	{Model: "o1-mini", Successor: "o4-mini", Retires: "2025-10-27"},
+}
+
+// LoadModelDeprecations reads a JSON array of deprecations.
+func LoadModelDeprecations(path string) ([]ModelDeprecation, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var deprecations []ModelDeprecation
+	if err := json.Unmarshal(data, &deprecations); err != nil {
+		return nil, fmt.Errorf("couldn't parse %s: %w", path, err)
+	}
+	for i, d := range deprecations {
+		if d.Model == "" {
+			return nil, fmt.Errorf("%s: deprecation %d has no model", path, i+1)
+		}
+		if d.Retires != "" {
+			if _, err := time.Parse(time.DateOnly, d.Retires); err != nil {
+				return nil, fmt.Errorf("%s: %s retires on %q, want YYYY-MM-DD", path, d.Model, d.Retires)
+			}
+		}
+	}
+	return deprecations, nil
+}
+
+// ModelStatus is what a check found about one configured model.
+type ModelStatus struct {
+	Model      string
+	State      string // "ok", "deprecated", "retired" or "missing"
+	Successor  string
+	Retires    string
+	MigratedTo string
+}
+
+// ModelWatcher checks the configured models against the provider's model
+// list and the known deprecations, warning about models that are being
+// retired or are gone. With auto-migration, calls to a retired or missing
+// model go to its successor instead, so a retirement doesn't turn into
+// every escalation failing. A nil *ModelWatcher leaves models as they are.
+type ModelWatcher struct {
+	models       []string
+	list         func(ctx context.Context) ([]string, error)
+	deprecations map[string]ModelDeprecation
+	autoMigrate  bool
+	notify       func(message string)
+	now          func() time.Time
+
+	mu       sync.RWMutex
+	migrated map[string]string
+	reported map[string]string
+}
+
+// NewModelWatcher watches models, listing the provider's models with list.
+func NewModelWatcher(models []string, list func(ctx context.Context) ([]string, error)) *ModelWatcher {
+	w := &ModelWatcher{
+		list:         list,
+		deprecations: make(map[string]ModelDeprecation),
+		now:          time.Now,
+		migrated:     make(map[string]string),
+		reported:     make(map[string]string),
+	}
+	for _, model := range models {
+		if model != "" && !slices.Contains(w.models, model) {
+			w.models = append(w.models, model)
+		}
+	}
+	return w.WithDeprecations(knownDeprecations)
+}
+
+// WithDeprecations adds deprecations, replacing known ones for the same
+// models.
+func (w *ModelWatcher) WithDeprecations(deprecations []ModelDeprecation) *ModelWatcher {
+	for _, d := range deprecations {
+		w.deprecations[d.Model] = d
+	}
+	return w
+}
+
+// WithAutoMigrate sends calls to a retired or missing model's successor.
+func (w *ModelWatcher) WithAutoMigrate(autoMigrate bool) *ModelWatcher {
+	w.autoMigrate = autoMigrate
+	return w
+}
+
+// WithNotify also sends each warning and migration to notify, such as the
+// MCP client.
+func (w *ModelWatcher) WithNotify(notify func(message string)) *ModelWatcher {
+	w.notify = notify
+	return w
+}
+
+// Resolve returns the model to call in place of model.
+func (w *ModelWatcher) Resolve(model string) string {
+	if w == nil {
+		return model
+	}
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if successor, ok := w.migrated[model]; ok {
+		return successor
+	}
+	return model
+}
+
+// Check lists the provider's models and reports on each configured model.
+// A model is missing when the provider doesn't list it; retired models are
+// past their retirement day. Each change of a model's state is logged once.
+func (w *ModelWatcher) Check(ctx context.Context) ([]ModelStatus, error) {
+	available, err := w.list(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't list the provider's models: %w", err)
+	}
+	listed := make(map[string]bool, len(available))
+	for _, model := range available {
+		listed[model] = true
+	}
+	today := w.now().UTC().Format(time.DateOnly)
+
+	var statuses []ModelStatus
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, model := range w.models {
+		status := ModelStatus{Model: model, State: "ok"}
+		if d, ok := w.deprecations[model]; ok {
+			status.Successor, status.Retires = d.Successor, d.Retires
+			status.State = "deprecated"
+			if d.Retires != "" && d.Retires <= today {
+				status.State = "retired"
+			}
+		}
+		if !listed[model] {
+			status.State = "missing"
+		}
+		if w.autoMigrate && (status.State == "retired" || status.State == "missing") && status.Successor != "" && listed[status.Successor] {
+			status.MigratedTo = status.Successor
+			w.migrated[model] = status.Successor
+		} else {
+			delete(w.migrated, model)
+		}
+		w.report(status)
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// report logs a model's status when it has changed since the last check.
+// Callers hold mu.
+func (w *ModelWatcher) report(status ModelStatus) {
+	key := status.State + ">" + status.MigratedTo
+	if w.reported[status.Model] == key {
+		return
+	}
+	w.reported[status.Model] = key
+
+	var message string
+	switch {
+	case status.MigratedTo != "":
+		message = fmt.Sprintf("Model %s is %s; calls to it now go to %s. Update the configuration to use %s directly.", status.Model, status.State, status.MigratedTo, status.MigratedTo)
+		slog.Error("Migrated a retired model to its successor", "model", status.Model, "state", status.State, "successor", status.MigratedTo)
+	case status.State == "deprecated":
+		message = fmt.Sprintf("Model %s is deprecated", status.Model)
+		if status.Retires != "" {
+			message += " and retires on " + status.Retires
+		}
+		if status.Successor != "" {
+			message += "; switch to " + status.Successor
+		}
+		message += "."
+		slog.Warn("Configured model is deprecated", "model", status.Model, "retires", status.Retires, "successor", status.Successor)
+	case status.State == "retired" || status.State == "missing":
+		message = fmt.Sprintf("Model %s is %s, and calls to it will fail", status.Model, status.State)
+		if status.Successor != "" {
+			message += "; switch to " + status.Successor
+		}
+		message += "."
+		slog.Error("Configured model is unavailable", "model", status.Model, "state", status.State, "successor", status.Successor)
+	default:
+		return
+	}
+	if w.notify != nil {
+		w.notify(message)
+	}
+}
+
+// Run checks the models now and then every interval until ctx is done.
+func (w *ModelWatcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		checkCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		if _, err := w.Check(checkCtx); err != nil {
+			slog.Warn("Couldn't check the configured models", "error", err)
+		}
+		cancel()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ModelLister is implemented by providers that can list their models.
+type ModelLister interface {
+	ListModels(ctx context.Context) ([]string, error)
+}
+
+func (p *openAIProvider) ListModels(ctx context.Context) ([]string, error) {
+	list, err := p.Client.ListModels(ctx)
+	if err != nil {
+		return nil, err
+	}
+	models := make([]string, len(list.Models))
+	for i, model := range list.Models {
+		models[i] = model.ID
+	}
+	sort.Strings(models)
+	return models, nil
+}
+
+// ListModels lists the models the backend's provider offers.
+func (l *LLM) ListModels(ctx context.Context) ([]string, error) {
+	provider := l.provider
+	if provider == nil {
+		provider = newOpenAIProvider(l.clientOptions)
+	}
+	lister, ok := provider.(ModelLister)
+	if !ok {
+		return nil, fmt.Errorf("the model provider can't list its models")
+	}
+	return lister.ListModels(ctx)
+}
+
+// notifyWarning sends a warning log message to the MCP client, when the
+// transport can deliver one.
+func (s *MCPServer) notifyWarning(message string) {
+	if s.notify == nil {
+		return
+	}
+	s.notify("notifications/message", map[string]interface{}{
+		"level":  "warning",
+		"logger": "escalator",
+		"data":   message,
+	})
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestModelWatcher_Check(t *testing.T) {
+	available := []string{"gpt-4o", "o3", "gpt-4.1", "gpt-4.5-preview"}
+	list := func(ctx context.Context) ([]string, error) { return available, nil }
+	var notes []string
+	watcher := NewModelWatcher([]string{"gpt-4o", "o1-preview", "gpt-4.5-preview", "ft:legacy", "gpt-4o"}, list).
+		WithDeprecations([]ModelDeprecation{{Model: "ft:legacy", Successor: "gpt-4o"}}).
+		WithAutoMigrate(true).
+		WithNotify(func(message string) { notes = append(notes, message) })
+	watcher.now = func() time.Time { return time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC) }
+
+	statuses, err := watcher.Check(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"gpt-4o": "ok", "o1-preview": "missing", "gpt-4.5-preview": "deprecated", "ft:legacy": "missing"}
+	if len(statuses) != len(want) {
+		t.Fatalf("Expected each model checked once, got %+v", statuses)
+	}
+	for _, status := range statuses {
+		if status.State != want[status.Model] {
+			t.Errorf("Expected %s to be %s, got %+v", status.Model, want[status.Model], status)
+		}
+	}
+	for model, successor := range map[string]string{"o1-preview": "o3", "ft:legacy": "gpt-4o", "gpt-4.5-preview": "gpt-4.5-preview", "gpt-4o": "gpt-4o"} {
+		if got := watcher.Resolve(model); got != successor {
+			t.Errorf("Expected %s to resolve to %s, got %s", model, successor, got)
+		}
+	}
+	if len(notes) != 3 || !strings.Contains(strings.Join(notes, "\n"), "gpt-4.5-preview is deprecated and retires on 2025-07-14; switch to gpt-4.1") {
+		t.Errorf("Expected a notification per model needing attention, got %q", notes)
+	}
+
+	// Nothing changed, so nothing is reported again; a retirement day
+	// passing is.
+	watcher.Check(context.Background())
+	watcher.now = func() time.Time { return time.Date(2025, 7, 14, 0, 0, 0, 0, time.UTC) }
+	watcher.Check(context.Background())
+	if len(notes) != 4 || !strings.Contains(notes[3], "gpt-4.5-preview is retired; calls to it now go to gpt-4.1") {
+		t.Errorf("Expected only the retirement reported, got %q", notes)
+	}
+}
+
+func TestModelWatcher_WarnsWithoutMigrating(t *testing.T) {
+	list := func(ctx context.Context) ([]string, error) { return []string{"gpt-4o"}, nil }
+	watcher := NewModelWatcher([]string{"o1-mini"}, list)
+	statuses, err := watcher.Check(context.Background())
+	if err != nil || statuses[0].State != "missing" || statuses[0].MigratedTo != "" || watcher.Resolve("o1-mini") != "o1-mini" {
+		t.Errorf("Expected a missing model left alone without auto-migration, got %+v, %v", statuses, err)
+	}
+	// The successor must be available to migrate to it.
+	watcher.WithAutoMigrate(true).Check(context.Background())
+	if watcher.Resolve("o1-mini") != "o1-mini" {
+		t.Error("Expected no migration to an unavailable successor")
+	}
+}
+
+func TestLLM_GenerateUsesMigratedModel(t *testing.T) {
+	list := func(ctx context.Context) ([]string, error) { return []string{"o3"}, nil }
+	watcher := NewModelWatcher([]string{"o1-preview"}, list).WithAutoMigrate(true)
+	watcher.Check(context.Background())
+
+	var asked []string
+	llm := NewLLM("o1-preview").WithModelWatcher(watcher).WithProvider(CompletionFunc(func(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error) {
+		asked = append(asked, req.Model)
+		return &Completion{Answer: "ok", Model: req.Model}, nil
+	}))
+	if _, err := llm.ForModel("o1-preview").Generate(context.Background(), userRequest("q"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(asked) != 1 || asked[0] != "o3" {
+		t.Errorf("Expected the call sent to the successor, got %v", asked)
+	}
+}
+
+func TestLoadModelDeprecations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deprecations.json")
+	os.WriteFile(path, []byte(`[{"model": "gpt-4o-2024-05-13", "successor": "gpt-4o", "retires": "2026-03"}]`), 0644)
+	if _, err := LoadModelDeprecations(path); err == nil {
+		t.Error("Expected a malformed retirement day refused")
+	}
+	os.WriteFile(path, []byte(`[{"model": "gpt-4o-2024-05-13", "successor": "gpt-4o", "retires": "2026-03-01"}]`), 0644)
+	if deprecations, err := LoadModelDeprecations(path); err != nil || deprecations[0].Successor != "gpt-4o" {
+		t.Errorf("Expected the deprecation loaded, got %+v, %v", deprecations, err)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// doctorCheck is one line of the doctor report. Warnings describe degraded
+// but working setups; failures prevent the server from answering.
+type doctorCheck struct {
+	name    string
+	status  string // "OK", "WARN" or "FAIL"
+	message string
+}
+
+// runDoctorCommand implements `escalator doctor`, which checks the
+// configuration the server would start with and reports problems.
+func runDoctorCommand(args []string, out io.Writer) int {
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	fs.SetOutput(out)
+	summaryPath := fs.String("summary", "", "Path to project summary file (default: ./README.md)")
+	historyPath := fs.String("history-db", defaultHistoryPath(), "SQLite file recording every escalation (empty disables history)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	checks := []doctorCheck{
+		checkAPIKey(),
+		checkSummary(NewGetHelpTool(*summaryPath, "")),
+		checkHistory(*historyPath),
+	}
+
+	failed := false
+	for _, check := range checks {
+		fmt.Fprintf(out, "%-4s %-8s %s\n", check.status, check.name, check.message)
+		if check.status == "FAIL" {
+			failed = true
+		}
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+func checkAPIKey() doctorCheck {
+	if os.Getenv("OPENAI_API_KEY") == "" {
+		return doctorCheck{"api-key", "FAIL", "OPENAI_API_KEY is not set"}
+	}
+	return doctorCheck{"api-key", "OK", "OPENAI_API_KEY is set"}
+}
+
+func checkSummary(tool *GetHelpTool) doctorCheck {
+	if err := tool.CheckSummary(); err != nil {
+		return doctorCheck{"summary", "WARN", fmt.Sprintf("Couldn't read %s (%v); get_help will use only the caller-provided summary", tool.SummaryPath(), err)}
+	}
+	return doctorCheck{"summary", "OK", tool.SummaryPath()}
+}
+
+func checkHistory(path string) doctorCheck {
+	if path == "" {
+		return doctorCheck{"history", "OK", "disabled"}
+	}
+	store, err := OpenHistory(path)
+	if err != nil {
+		return doctorCheck{"history", "WARN", fmt.Sprintf("Couldn't open %s (%v); escalations won't be recorded", path, err)}
+	}
+	store.Close()
+	return doctorCheck{"history", "OK", path}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunDoctorCommand(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "x")
+	db := filepath.Join(t.TempDir(), "history.db")
+
+	var out bytes.Buffer
+	if code := runDoctorCommand([]string{"-summary", "/nonexistent/summary.md", "-history-db", db}, &out); code != 0 {
+		t.Fatalf("Expected a missing summary to only warn, got %d: %s", code, out.String())
+	}
+	if !strings.Contains(out.String(), "WARN summary") {
+		t.Errorf("Expected summary warning, got %q", out.String())
+	}
+
+	t.Setenv("OPENAI_API_KEY", "")
+	out.Reset()
+	if code := runDoctorCommand([]string{"-history-db", ""}, &out); code != 1 {
+		t.Errorf("Expected failure without an API key, got %d: %s", code, out.String())
+	}
+}
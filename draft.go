@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// Draft is a get_help request assembled but not sent, kept so the caller
+// can review it and send it unchanged with send_draft.
+type Draft struct {
+	ID    string
+	Model string
+	// Request is exactly what will be sent: secrets redacted, personal data
+	// masked and the prompt adapted to the model's family.
+	Request               openai.ChatCompletionRequest
+	EstimatedPromptTokens int
+	// EstimatedCostUSD prices the prompt plus a 1,000-token answer at list
+	// prices, as approvals do.
+	EstimatedCostUSD float64
+	CreatedAt        time.Time
+
+	// What the answer is recorded with once the draft is sent.
+	jsonAnswer bool
+	prepared   *preparedPrompt
+	arguments  map[string]interface{}
+	sessionID  string
+	// cacheKey is empty for follow-ups, whose answers aren't cached.
+	cacheKey string
+	freshFor time.Duration
+}
+
+// DraftStore keeps drafts in memory until they are sent or expire ttl after
+// they were drafted.
+type DraftStore struct {
+	mu     sync.Mutex
+	drafts map[string]*Draft
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+func NewDraftStore(ttl time.Duration) *DraftStore {
+	return &DraftStore{
+		drafts: make(map[string]*Draft),
+		ttl:    ttl,
+		now:    time.Now,
+	}
+}
+
+// Add keeps the draft under a new ID, which it returns.
+func (s *DraftStore) Add(draft *Draft) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, d := range s.drafts {
+		if s.expired(d) {
+			delete(s.drafts, id)
+		}
+	}
+	draft.ID = newEscalationID()
+	draft.CreatedAt = s.now()
+	s.drafts[draft.ID] = draft
+	return draft.ID
+}
+
+// Get returns a draft, or nil when it doesn't exist or has expired.
+func (s *DraftStore) Get(id string) *Draft {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	draft, ok := s.drafts[id]
+	if !ok {
+		return nil
+	}
+	if s.expired(draft) {
+		delete(s.drafts, id)
+		return nil
+	}
+	return draft
+}
+
+// Remove forgets a draft once it has been sent.
+func (s *DraftStore) Remove(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.drafts, id)
+}
+
+// ExpiresAt is when a draft created at createdAt is dropped.
+func (s *DraftStore) ExpiresAt(createdAt time.Time) time.Time {
+	if s.ttl <= 0 {
+		return time.Time{}
+	}
+	return createdAt.Add(s.ttl)
+}
+
+func (s *DraftStore) expired(draft *Draft) bool {
+	return s.ttl > 0 && s.now().Sub(draft.CreatedAt) > s.ttl
+}
+
+// draft assembles the request get_help would send for the prepared prompt
+// and keeps it in the draft store instead of sending it. The content shows
+// every message as it will be sent, with its estimated cost.
+func (t *GetHelpTool) draft(ctx context.Context, override *LLM, prior []openai.ChatCompletionMessage, prepared *preparedPrompt, jsonAnswer bool, arguments map[string]interface{}, key string) ([]map[string]interface{}, error) {
+	llm := t.llm
+	if override != nil {
+		llm = override
+	}
+	model := llm.watcher.Resolve(llm.modelChain()[0])
+
+	req, _, err := llm.mask(ctx, t.request(prior, prepared.Text, jsonAnswer))
+	if err != nil {
+		slog.WarnContext(ctx, "Couldn't draft the request", "tool", t.Name(), "error", err)
+		return textContent("Error: " + capitalize(err.Error())), err
+	}
+	if adapted, err := t.promptVariants.Adapt(model, req); err != nil {
+		slog.WarnContext(ctx, "Drafting the prompt unadapted", "model", model, "error", err)
+	} else {
+		req = adapted
+	}
+	req.Model = model
+
+	sessionID, _ := arguments["session_id"].(string)
+	tokens := estimateTokens(requestText(req))
+	draft := &Draft{
+		Model:                 model,
+		Request:               req,
+		EstimatedPromptTokens: tokens,
+		EstimatedCostUSD:      estimateCost(model, tokens, approvalCompletionEstimate),
+		jsonAnswer:            jsonAnswer,
+		prepared:              prepared,
+		arguments:             reaskArguments(arguments),
+		sessionID:             sessionID,
+		cacheKey:              key,
+		freshFor:              freshnessFor(t.referencedPaths(arguments)),
+	}
+	id := t.drafts.Add(draft)
+	slog.InfoContext(ctx, "Drafted a request", "tool", t.Name(), "draft_id", id, "model", model, "estimated_tokens", tokens)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Draft %s for %s, not sent. About %d prompt tokens, estimated cost $%.4f with a 1,000-token answer.\n", id, model, tokens, draft.EstimatedCostUSD)
+	if len(llm.fallbackModels) > 0 {
+		fmt.Fprintf(&b, "If %s fails, the same messages go to %s.\n", model, strings.Join(llm.fallbackModels, ", "))
+	}
+	fmt.Fprintf(&b, "Call send_draft with id %s to send it unchanged.\n", id)
+	for _, message := range req.Messages {
+		fmt.Fprintf(&b, "\n--- %s ---\n%s\n", message.Role, message.Content)
+	}
+
+	info := map[string]interface{}{
+		"id":                      id,
+		"model":                   model,
+		"estimated_prompt_tokens": tokens,
+		"estimated_cost_usd":      draft.EstimatedCostUSD,
+	}
+	if expires := t.drafts.ExpiresAt(draft.CreatedAt); !expires.IsZero() {
+		info["expires_at"] = expires
+	}
+	meta := map[string]interface{}{"draft": info}
+	if len(prepared.Omitted) > 0 {
+		meta["context_omitted"] = prepared.Omitted
+	}
+	structured := map[string]interface{}{
+		"answer":               b.String(),
+		"suggested_next_steps": []string{fmt.Sprintf("Review the draft, then call send_draft with id %s", id)},
+		"references":           []string{},
+		"draft_id":             id,
+	}
+	return withMeta(withStructuredContent(textContent(b.String()), structured), meta), nil
+}
+
+// sendDraft sends a draft's request unchanged to its model, falling back
+// like get_help does, and records the answer as get_help would have. The
+// cascade and repository tools are skipped, since either would send
+// something other than the draft.
+func (t *GetHelpTool) sendDraft(ctx context.Context, draft *Draft, onDelta func(string)) ([]map[string]interface{}, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Minute)
+	defer cancel()
+
+	start := time.Now()
+	stream, flush := onDelta, func() {}
+	if !draft.jsonAnswer {
+		stream, flush = withoutConfidenceLine(onDelta)
+	}
+	completion, err := t.llm.WithPrimary(draft.Model).Generate(ctx, draft.Request, stream)
+	if err == nil {
+		flush()
+		completion, err = readConfidence(completion, draft.jsonAnswer)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Model call failed", "tool", "send_draft", "model", draft.Model, "draft_id", draft.ID, "duration_ms", time.Since(start).Milliseconds(), "error", err)
+		return failureContent(err), err
+	}
+	slog.InfoContext(ctx, "Model call completed", "tool", "send_draft", "model", completion.Model, "draft_id", draft.ID, "duration_ms", time.Since(start).Milliseconds())
+
+	usage := draft.prepared.contextUsage(completion.Model, completion.PromptTokens)
+	logContextUsage(ctx, completion.Model, usage)
+	tokens := usageOf(completion)
+	logUsage(ctx, "send_draft", tokens)
+
+	answeredAt := time.Now()
+	staleAt := answeredAt.Add(draft.freshFor)
+	var escalationID string
+	if t.history != nil {
+		question, _ := draft.arguments["question"].(string)
+		escalationID = t.history.Record(EscalationRecord{
+			Tool:         t.Name(),
+			Question:     question,
+			ContextUsage: usage,
+			Arguments:    draft.arguments,
+			StaleAt:      staleAt,
+			Assembly:     draft.prepared.Assembly,
+		}, draft.prepared.Text, completion, time.Since(start))
+	}
+	if t.cache != nil && draft.cacheKey != "" {
+		t.cache.Put(draft.cacheKey, CachedAnswer{Answer: completion.Answer, Confidence: completion.Confidence, EscalationID: escalationID, AnsweredAt: answeredAt, StaleAt: staleAt})
+	}
+	if draft.sessionID != "" && t.sessions != nil {
+		t.sessions.Append(draft.sessionID, draft.prepared.Text, completion.Answer)
+	}
+
+	meta := map[string]interface{}{"context_usage": usage, "usage": tokens, "stale_at": staleAt, "draft_id": draft.ID}
+	structured := answerStructuredContent(completion.Answer, completion.Confidence, draft.jsonAnswer, usage)
+	if escalationID != "" {
+		structured["escalation_id"] = escalationID
+		meta["escalation_id"] = escalationID
+	}
+	return withMeta(withStructuredContent(textContent(completion.Answer), structured), meta), nil
+}
+
+// SendDraftTool sends a request drafted with get_help's draft argument,
+// exactly as it was shown.
+type SendDraftTool struct {
+	help   *GetHelpTool
+	drafts *DraftStore
+}
+
+func NewSendDraftTool(help *GetHelpTool, drafts *DraftStore) *SendDraftTool {
+	return &SendDraftTool{help: help, drafts: drafts}
+}
+
+func (t *SendDraftTool) Name() string {
+	return "send_draft"
+}
+
+func (t *SendDraftTool) Category() string {
+	return "escalation"
+}
+
+func (t *SendDraftTool) Description() string {
+	return "Send a request drafted with get_help's draft argument, unchanged, after reviewing it"
+}
+
+func (t *SendDraftTool) Schema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"id": map[string]interface{}{
+				"type":        "string",
+				"description": "ID of the draft, from get_help with draft set",
+			},
+		},
+		"required": []string{"id"},
+	}
+}
+
+func (t *SendDraftTool) Call(arguments map[string]interface{}) ([]map[string]interface{}, error) {
+	return t.CallStream(arguments, nil)
+}
+
+// CallStream streams the answer like get_help does.
+func (t *SendDraftTool) CallStream(arguments map[string]interface{}, onDelta func(string)) ([]map[string]interface{}, error) {
+	return t.CallContext(context.Background(), arguments, onDelta)
+}
+
+// CallContext behaves like CallStream, with the model call recorded in the
+// trace of ctx.
+func (t *SendDraftTool) CallContext(ctx context.Context, arguments map[string]interface{}, onDelta func(string)) ([]map[string]interface{}, error) {
+	id, _ := arguments["id"].(string)
+	if id == "" {
+		return textContent("Error: Missing required field: id"), fmt.Errorf("missing required fields")
+	}
+	draft := t.drafts.Get(id)
+	if draft == nil {
+		return textContent(fmt.Sprintf("Error: No draft with ID %s (it may have expired or already been sent); draft the question again", id)), fmt.Errorf("no draft %s", id)
+	}
+	// A draft that failed, e.g. while held for approval, can be sent again.
+	content, err := t.help.sendDraft(ctx, draft, onDelta)
+	if err == nil {
+		t.drafts.Remove(id)
+	}
+	return content, err
+}
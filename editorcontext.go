@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// editorRange is a span of a file in the caller's editor, from the
+// selection or cursor_context argument.
+type editorRange struct {
+	File      string
+	StartLine int
+	EndLine   int
+	// Line is the cursor's line, for cursor_context.
+	Line int
+	Text string
+}
+
+// editorRangeArgument reads an editor range argument, or returns nil when
+// it is absent.
+func editorRangeArgument(arguments map[string]interface{}, key string) (*editorRange, error) {
+	value, ok := arguments[key].(map[string]interface{})
+	if !ok {
+		return nil, nil
+	}
+	r := &editorRange{
+		StartLine: intArgument(value, "start_line", 0),
+		EndLine:   intArgument(value, "end_line", 0),
+		Line:      intArgument(value, "line", 0),
+	}
+	r.File, _ = value["file"].(string)
+	r.Text, _ = value["text"].(string)
+	r.Text = strings.TrimRight(r.Text, "\n")
+	if strings.TrimSpace(r.Text) == "" {
+		return nil, fmt.Errorf("%s has no text", key)
+	}
+	lines := strings.Count(r.Text, "\n") + 1
+	if r.StartLine > 0 && r.EndLine == 0 {
+		r.EndLine = r.StartLine + lines - 1
+	}
+	if r.EndLine < r.StartLine || r.StartLine < 0 {
+		return nil, fmt.Errorf("%s ends before it starts (lines %d-%d)", key, r.StartLine, r.EndLine)
+	}
+	if r.Line != 0 && (r.StartLine == 0 || r.Line < r.StartLine || r.Line > r.EndLine) {
+		return nil, fmt.Errorf("%s line %d isn't within its text", key, r.Line)
+	}
+	return r, nil
+}
+
+// location is the range's file and lines, as far as they are known.
+func (r *editorRange) location() string {
+	location := r.File
+	if r.StartLine > 0 {
+		lines := fmt.Sprintf("%d-%d", r.StartLine, r.EndLine)
+		if r.StartLine == r.EndLine {
+			lines = fmt.Sprint(r.StartLine)
+		}
+		if location == "" {
+			return "lines " + lines
+		}
+		location += ":" + lines
+	}
+	return location
+}
+
+// provenance labels the range as the caller's editor buffer, which may
+// hold unsaved edits and so is the freshest view of the file.
+func (r *editorRange) provenance() string {
+	label := "EDITOR"
+	if r.File != "" {
+		label += " " + r.File
+	}
+	if r.StartLine > 0 {
+		label += " " + lineRange(r.StartLine, r.EndLine)
+	}
+	return label + " (the caller's open buffer, current)"
+}
+
+// numbered is the range's text with line numbers when they are known, so
+// "this line" can be matched to the code, marking the cursor's line with >.
+func (r *editorRange) numbered() string {
+	if r.StartLine == 0 {
+		return r.Text
+	}
+	lines := strings.Split(r.Text, "\n")
+	width := len(fmt.Sprint(r.EndLine))
+	for i, line := range lines {
+		n := r.StartLine + i
+		marker := " "
+		if n == r.Line {
+			marker = ">"
+		}
+		lines[i] = fmt.Sprintf("%s%*d | %s", marker, width, n, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// editorSource includes the code selected in the caller's editor and the
+// code around the cursor, which editor-integrated clients fill in. Most
+// questions asked from an editor are about that code, so it has the
+// highest priority.
+type editorSource struct{}
+
+func (s *editorSource) Name() string { return "editor" }
+
+func (s *editorSource) Gather(ctx context.Context, question string, arguments map[string]interface{}) ([]ContextBlock, error) {
+	var blocks []ContextBlock
+	selection, err := editorRangeArgument(arguments, "selection")
+	if err != nil {
+		return nil, err
+	}
+	if selection != nil {
+		heading := "**Selected code"
+		if location := selection.location(); location != "" {
+			heading += " (" + location + ")"
+		}
+		blocks = append(blocks, ContextBlock{
+			Name:       strings.TrimSpace("selection " + selection.location()),
+			Text:       fmt.Sprintf("%s, which the question is about:**\n```\n%s\n```", heading, selection.numbered()),
+			Priority:   PriorityEditor,
+			Provenance: selection.provenance(),
+		})
+	}
+
+	cursor, err := editorRangeArgument(arguments, "cursor_context")
+	if err != nil {
+		return nil, err
+	}
+	if cursor != nil {
+		heading := "**Code around the cursor"
+		if location := cursor.location(); location != "" {
+			heading += " (" + location + ")"
+		}
+		if cursor.Line > 0 {
+			heading += fmt.Sprintf(", on line %d, marked >", cursor.Line)
+		}
+		blocks = append(blocks, ContextBlock{
+			Name:       strings.TrimSpace("cursor " + cursor.location()),
+			Text:       fmt.Sprintf("%s:**\n```\n%s\n```", heading, cursor.numbered()),
+			Priority:   PriorityEditor,
+			Provenance: cursor.provenance(),
+		})
+	}
+	return blocks, nil
+}
+
+// editorRangeSchema describes the selection and cursor_context arguments.
+func editorRangeSchema(description string, cursor bool) map[string]interface{} {
+	properties := map[string]interface{}{
+		"file": map[string]interface{}{
+			"type":        "string",
+			"description": "Path of the file, relative to the workspace root (optional)",
+		},
+		"start_line": map[string]interface{}{
+			"type":        "integer",
+			"description": "Line number of the first line of text, from 1 (optional)",
+		},
+		"end_line": map[string]interface{}{
+			"type":        "integer",
+			"description": "Line number of the last line of text (optional)",
+		},
+		"text": map[string]interface{}{
+			"type":        "string",
+			"description": "The text of those lines",
+		},
+	}
+	if cursor {
+		properties["line"] = map[string]interface{}{
+			"type":        "integer",
+			"description": "Line number the cursor is on (optional; needs start_line)",
+		}
+	}
+	return map[string]interface{}{
+		"type":        "object",
+		"properties":  properties,
+		"required":    []string{"text"},
+		"description": description,
+	}
+}
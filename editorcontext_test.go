@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestEditorRangeArgument(t *testing.T) {
+	r, err := editorRangeArgument(map[string]interface{}{"cursor_context": map[string]interface{}{
+		"file":       "internal/store/a.go",
+		"start_line": float64(9),
+		"line":       float64(10),
+		"text":       "func Reserve() {\n\ts.held[id] += n\n}\n",
+	}}, "cursor_context")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if r.location() != "internal/store/a.go:9-11" {
+		t.Errorf("Expected the end line worked out from the text, got %q", r.location())
+	}
+	want := "  9 | func Reserve() {\n>10 | \ts.held[id] += n\n 11 | }"
+	if got := r.numbered(); got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+
+	if r, _ := editorRangeArgument(map[string]interface{}{}, "selection"); r != nil {
+		t.Error("Expected nothing without the argument")
+	}
+	for _, value := range []map[string]interface{}{
+		{"file": "a.go"},
+		{"text": "x", "start_line": float64(5), "end_line": float64(3)},
+		{"text": "x", "line": float64(3)},
+		{"text": "x\ny", "start_line": float64(1), "line": float64(3)},
+	} {
+		if _, err := editorRangeArgument(map[string]interface{}{"selection": value}, "selection"); err == nil {
+			t.Errorf("Expected an error for %v", value)
+		}
+	}
+}
+
+func TestGetHelpTool_Call_Selection(t *testing.T) {
+	var prompt string
+	tool := NewGetHelpTool("", "o3")
+	tool.LLM().WithProvider(CompletionFunc(func(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error) {
+		prompt = req.Messages[len(req.Messages)-1].Content
+		return &Completion{Answer: "held is nil.", Model: req.Model}, nil
+	}))
+
+	content, err := tool.Call(map[string]interface{}{
+		"question":      "What's wrong with this line?",
+		"summary":       "s",
+		"relevant_code": strings.Repeat("// unrelated helper code\n", 4000),
+		"allow_large":   true,
+		"selection": map[string]interface{}{
+			"file":       "internal/store/a.go",
+			"start_line": float64(10),
+			"text":       "s.held[id] += n",
+		},
+		"cursor_context": map[string]interface{}{
+			"file":       "internal/store/a.go",
+			"start_line": float64(9),
+			"line":       float64(10),
+			"text":       "func (s *Store) Reserve(id, n int) {\n\ts.held[id] += n\n}",
+		},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	for _, want := range []string{
+		"**Selected code (internal/store/a.go:10), which the question is about:**\n```\n 10 | s.held[id] += n\n```",
+		"**Code around the cursor (internal/store/a.go:9-11), on line 10, marked >:**",
+		">10 | \ts.held[id] += n",
+	} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("Expected the prompt to contain %q", want)
+		}
+	}
+
+	// What the caller sent is never trimmed, the editor context included.
+	usage := takeMeta(content)["context_usage"].(*ContextUsage)
+	for _, section := range usage.Sections {
+		if section.TrimmedTokens != 0 {
+			t.Errorf("Expected %s kept whole, trimmed %d tokens", section.Name, section.TrimmedTokens)
+		}
+	}
+
+	if _, err := tool.Call(map[string]interface{}{"question": "q", "summary": "s", "selection": map[string]interface{}{"file": "a.go"}}); err == nil {
+		t.Error("Expected an error for a selection without text")
+	}
+}
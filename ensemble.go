@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SecondOpinionTool fans a get_help prompt out to several models at once and
+// returns every answer, a consensus synthesized by the architect model, or a
+// merge that separates shared advice from genuine disagreements.
+type SecondOpinionTool struct {
+	help   *GetHelpTool
+	models []string
+}
+
+func NewSecondOpinionTool(help *GetHelpTool, models []string) *SecondOpinionTool {
+	return &SecondOpinionTool{help: help, models: models}
+}
+
+// modelAnswer is one model's reply in an ensemble.
+type modelAnswer struct {
+	Model  string
+	Answer string
+	Err    error
+
+	completion *Completion
+}
+
+func (t *SecondOpinionTool) Name() string {
+	return "get_second_opinion"
+}
+
+func (t *SecondOpinionTool) Category() string {
+	return "escalation"
+}
+
+func (t *SecondOpinionTool) Description() string {
+	return "Ask several models the same question concurrently and return all answers or a synthesized consensus"
+}
+
+func (t *SecondOpinionTool) Schema() map[string]interface{} {
+	schema := t.help.Schema()
+	properties := make(map[string]interface{})
+	for name, prop := range schema["properties"].(map[string]interface{}) {
+		properties[name] = prop
+	}
+	// Models are chosen with the models array instead, second opinions are
+	// one-off questions, and answers are compared as prose.
+	delete(properties, "model")
+	delete(properties, "session_id")
+	delete(properties, "response_format")
+	properties["models"] = map[string]interface{}{
+		"type":        "array",
+		"items":       map[string]interface{}{"type": "string"},
+		"description": fmt.Sprintf("Models to consult, at most %d from the allowed models (optional, default: %s)", len(t.models), strings.Join(t.models, ", ")),
+	}
+	properties["mode"] = map[string]interface{}{
+		"type":        "string",
+		"enum":        []string{"consensus", "merged", "all"},
+		"description": "\"consensus\" returns one synthesized answer, \"merged\" lists shared advice once and highlights disagreements, \"all\" returns every model's answer with near-duplicates collapsed (default: consensus)",
+	}
+
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+		"required":   schema["required"],
+	}
+}
+
+func (t *SecondOpinionTool) Call(arguments map[string]interface{}) ([]map[string]interface{}, error) {
+	return t.CallContext(context.Background(), arguments, nil)
+}
+
+// CallContext behaves like Call, with the model calls made under ctx, so
+// they join its trace and are logged with its caller.
+func (t *SecondOpinionTool) CallContext(ctx context.Context, arguments map[string]interface{}, _ func(string)) ([]map[string]interface{}, error) {
+	models := stringListArgument(arguments, "models")
+	if len(models) == 0 {
+		models = t.models
+	} else {
+		// Overrides follow -allowed-models like get_help's model argument,
+		// and can't fan a prompt out wider than the configured ensemble.
+		if len(models) > len(t.models) {
+			return textContent(fmt.Sprintf("Error: At most %d models may be consulted", len(t.models))), fmt.Errorf("too many models: %d", len(models))
+		}
+		for _, model := range models {
+			if !t.help.modelAllowed(model) {
+				return textContent(fmt.Sprintf("Error: Model %q is not allowed. Allowed models: %s", model, strings.Join(t.help.allowedModels, ", "))), fmt.Errorf("model %q not allowed", model)
+			}
+		}
+	}
+	if len(models) < 2 {
+		return textContent("Error: A second opinion needs at least two models"), fmt.Errorf("not enough models")
+	}
+
+	mode, _ := arguments["mode"].(string)
+	if mode == "" {
+		mode = "consensus"
+	}
+	if mode != "consensus" && mode != "merged" && mode != "all" {
+		return textContent("Error: mode must be \"consensus\", \"merged\" or \"all\""), fmt.Errorf("invalid mode %q", mode)
+	}
+
+	prepared, errContent, err := t.help.preparePrompt(ctx, arguments)
+	if err != nil {
+		return errContent, err
+	}
+	prompt := prepared.Text
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Minute)
+	defer cancel()
+
+	answers := t.askAll(ctx, models, prompt)
+
+	usage := &TokenUsage{}
+	for _, call := range prepared.Calls {
+		usage.add(call)
+	}
+	var succeeded []modelAnswer
+	for _, a := range answers {
+		if a.Err != nil {
+			slog.WarnContext(ctx, "Ensemble model failed", "model", a.Model, "error", a.Err)
+			continue
+		}
+		usage.add(a.completion)
+		succeeded = append(succeeded, a)
+	}
+	// Every return below carries the usage of the calls made so far.
+	respond := func(text string) ([]map[string]interface{}, error) {
+		logUsage(ctx, t.Name(), usage)
+		return withMeta(textContent(text), map[string]interface{}{"usage": usage}), nil
+	}
+	if len(succeeded) == 0 {
+		return failureContent(answers[0].Err), fmt.Errorf("all models failed: %w", answers[0].Err)
+	}
+
+	// Near-identical answers add nothing but length.
+	groups := groupDuplicateAnswers(answers)
+	distinct := successfulGroups(groups)
+	if mode == "all" || len(distinct) == 1 {
+		return respond(formatAnswers(groups))
+	}
+
+	question, _ := arguments["question"].(string)
+	if mode == "merged" {
+		merged, completion, err := mergeAnswers(ctx, t.help.llm, question, distinct)
+		if completion != nil {
+			usage.add(completion)
+		}
+		if err != nil {
+			slog.WarnContext(ctx, "Merge call failed, returning individual answers", "error", err)
+			return respond(formatAnswers(groups))
+		}
+		return respond(formatMergedAnswer(merged))
+	}
+
+	consensus, err := t.help.llm.Generate(ctx, userRequest(buildConsensusPrompt(question, succeeded)), nil)
+	if err != nil {
+		slog.WarnContext(ctx, "Consensus call failed, returning individual answers", "error", err)
+		return respond(formatAnswers(groups))
+	}
+	usage.add(consensus)
+
+	consulted := make([]string, len(succeeded))
+	for i, a := range succeeded {
+		consulted[i] = a.Model
+	}
+	return respond(fmt.Sprintf("%s\n\n_Models consulted: %s_", consensus.Answer, strings.Join(consulted, ", ")))
+}
+
+// askAll sends the prompt to every model concurrently, preserving order.
+func (t *SecondOpinionTool) askAll(ctx context.Context, models []string, prompt string) []modelAnswer {
+	answers := make([]modelAnswer, len(models))
+
+	var wg sync.WaitGroup
+	for i, model := range models {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			completion, err := t.help.llm.ForModel(model).Generate(ctx, t.help.currentPersona().promptRequest(nil, prompt), nil)
+			if err != nil {
+				answers[i] = modelAnswer{Model: model, Err: err}
+				return
+			}
+			answers[i] = modelAnswer{Model: model, Answer: completion.Answer, completion: completion}
+		}()
+	}
+	wg.Wait()
+
+	return answers
+}
+
+// successfulGroups drops the groups of models that failed.
+func successfulGroups(groups []answerGroup) []answerGroup {
+	var ok []answerGroup
+	for _, g := range groups {
+		if g.Err == nil {
+			ok = append(ok, g)
+		}
+	}
+	return ok
+}
+
+func formatAnswers(groups []answerGroup) string {
+	var b strings.Builder
+	for i, a := range groups {
+		if i > 0 {
+			b.WriteString("\n\n")
+		}
+		fmt.Fprintf(&b, "## Answer from %s", a.Model)
+		if len(a.Also) > 0 {
+			fmt.Fprintf(&b, " (same answer from %s)", strings.Join(a.Also, ", "))
+		}
+		b.WriteString("\n\n")
+		if a.Err != nil {
+			b.WriteString("_This model was unavailable._")
+		} else {
+			b.WriteString(a.Answer)
+		}
+	}
+	return b.String()
+}
+
+func buildConsensusPrompt(question string, answers []modelAnswer) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "Several expert models independently answered the same software architecture question.\n\n**Question:** %s\n", question)
+	for i, a := range answers {
+		fmt.Fprintf(&b, "\n<answer index=\"%d\" model=\"%s\">\n%s\n</answer>\n", i+1, a.Model, a.Answer)
+	}
+	b.WriteString("\nSynthesize a single consensus answer. Keep the advice the answers agree on, resolve conflicts where one answer is clearly better, and explicitly call out any remaining disagreements so the reader can judge them.")
+
+	return b.String()
+}
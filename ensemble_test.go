@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func newEnsembleTestTool(t *testing.T) *SecondOpinionTool {
+	t.Helper()
+	withFastRetries(t)
+	srv := newFakeOpenAI(t, func(model string) string {
+		switch model {
+		case "judge":
+			return "synthesized consensus"
+		case "m1":
+			return "use a mutex"
+		case "m2":
+			return "use a channel"
+		}
+		return ""
+	})
+
+	help := NewGetHelpTool("", "judge").WithClientOptions(ClientOptions{BaseURL: srv.URL})
+	return NewSecondOpinionTool(help, []string{"m1", "m2"})
+}
+
+func TestSecondOpinionTool_Consensus(t *testing.T) {
+	tool := newEnsembleTestTool(t)
+
+	content, err := tool.Call(map[string]interface{}{"question": "q", "summary": "s"})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	text := content[0]["text"].(string)
+	if !strings.HasPrefix(text, "synthesized consensus") {
+		t.Errorf("Expected consensus answer, got %q", text)
+	}
+	if !strings.Contains(text, "m1, m2") {
+		t.Errorf("Expected consulted models to be listed, got %q", text)
+	}
+
+	// Two model answers and the consensus call, 1500 tokens each.
+	usage := takeMeta(content)["usage"].(*TokenUsage)
+	if usage.TotalTokens != 4500 || usage.Model != "" {
+		t.Errorf("Expected usage summed over every call, got %+v", usage)
+	}
+}
+
+func TestSecondOpinionTool_AllWithFailure(t *testing.T) {
+	tool := newEnsembleTestTool(t)
+	tool.help.WithAllowedModels([]string{"m1", "m2", "broken"})
+
+	content, err := tool.Call(map[string]interface{}{
+		"question": "q",
+		"summary":  "s",
+		"mode":     "all",
+		"models":   []interface{}{"m2", "broken"},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	text := content[0]["text"].(string)
+	for _, want := range []string{"## Answer from m2", "use a channel", "## Answer from broken", "unavailable"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Expected %q in answers, got:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, "m1") {
+		t.Errorf("Expected only the requested models, got:\n%s", text)
+	}
+	if strings.Index(text, "m2") > strings.Index(text, "broken") {
+		t.Error("Expected answers in the requested model order")
+	}
+}
+
+func TestSecondOpinionTool_Validation(t *testing.T) {
+	tool := NewSecondOpinionTool(NewGetHelpTool("", "gpt-4o"), []string{"only-one"})
+
+	if _, err := tool.Call(map[string]interface{}{"question": "q", "summary": "s"}); err == nil {
+		t.Error("Expected error with fewer than two models")
+	}
+	tool = NewSecondOpinionTool(NewGetHelpTool("", "gpt-4o"), []string{"a", "b"})
+	if _, err := tool.Call(map[string]interface{}{"question": "q", "summary": "s", "mode": "vote"}); err == nil || !strings.Contains(err.Error(), "invalid mode") {
+		t.Error("Expected error for unknown mode")
+	}
+}
+
+func TestSecondOpinionTool_ModelOverride(t *testing.T) {
+	tool := NewSecondOpinionTool(NewGetHelpTool("", "gpt-4o"), []string{"a", "b"})
+	args := func(models ...interface{}) map[string]interface{} {
+		return map[string]interface{}{"question": "q", "summary": "s", "models": models}
+	}
+
+	// Without -allowed-models no override is accepted, as with get_help.
+	if content, err := tool.Call(args("a", "b")); err == nil || !strings.Contains(content[0]["text"].(string), "not allowed") {
+		t.Errorf("Expected overrides refused without an allowlist, got %v", err)
+	}
+
+	tool.help.WithAllowedModels([]string{"a", "b", "c"})
+	if _, err := tool.Call(args("a", "b", "c")); err == nil || !strings.Contains(err.Error(), "too many models") {
+		t.Errorf("Expected more models than the ensemble refused, got %v", err)
+	}
+	if _, err := tool.Call(args("a", "z")); err == nil || !strings.Contains(err.Error(), "not allowed") {
+		t.Errorf("Expected a model outside the allowlist refused, got %v", err)
+	}
+}
+
+func TestSecondOpinionTool_Schema(t *testing.T) {
+	tool := NewSecondOpinionTool(NewGetHelpTool("", "gpt-4o"), []string{"a", "b"})
+	props := tool.Schema()["properties"].(map[string]interface{})
+
+	if props["question"] == nil || props["models"] == nil || props["mode"] == nil {
+		t.Errorf("Expected get_help properties plus models and mode, got %v", props)
+	}
+	if _, ok := NewGetHelpTool("", "").Schema()["properties"].(map[string]interface{})["models"]; ok {
+		t.Error("Expected get_help schema to be left unchanged")
+	}
+}
+
+func TestSecondOpinionTool_Merged(t *testing.T) {
+	withFastRetries(t)
+	var mergePrompt string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openai.ChatCompletionRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		answer := map[string]string{
+			"m1": "Use a mutex around the map to serialize writes.",
+			"m2": "Use a mutex around the map to serialize writes!",
+			"m3": "Use a channel owned by one goroutine.",
+		}[req.Model]
+		if req.Model == "judge" {
+			mergePrompt = req.Messages[0].Content
+			answer = `{"agreed":["Serialize writes"],"disagreements":[{"topic":"Mechanism","positions":[{"models":["m1","m2"],"position":"mutex"},{"models":["m3"],"position":"channel"}]}],"unique":[]}`
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{
+				{"message": map[string]string{"role": "assistant", "content": answer}},
+			},
+		})
+	}))
+	defer srv.Close()
+
+	help := NewGetHelpTool("", "judge").WithClientOptions(ClientOptions{BaseURL: srv.URL})
+	tool := NewSecondOpinionTool(help, []string{"m1", "m2", "m3"})
+
+	content, err := tool.Call(map[string]interface{}{"question": "q", "summary": "s", "mode": "merged"})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if strings.Count(mergePrompt, "<answer ") != 2 || !strings.Contains(mergePrompt, `models="m1,m2"`) {
+		t.Errorf("Expected duplicate answers to be collapsed before merging, got:\n%s", mergePrompt)
+	}
+
+	text := content[0]["text"].(string)
+	for _, want := range []string{"## Agreed", "- Serialize writes", "## Disagreements", "**Mechanism**", "- m1, m2: mutex", "- m3: channel"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Expected %q in merged answer, got:\n%s", want, text)
+		}
+	}
+}
+
+func TestGroupDuplicateAnswers(t *testing.T) {
+	groups := groupDuplicateAnswers([]modelAnswer{
+		{Model: "a", Answer: "Add an index on user_id and rerun the query."},
+		{Model: "b", Answer: "add an index on user_id, and rerun the query"},
+		{Model: "c", Answer: "Denormalize the table instead."},
+		{Model: "d", Err: errors.New("down")},
+	})
+
+	if len(groups) != 3 {
+		t.Fatalf("Expected 3 groups, got %+v", groups)
+	}
+	if groups[0].Model != "a" || len(groups[0].Also) != 1 || groups[0].Also[0] != "b" {
+		t.Errorf("Expected b to be collapsed into a, got %+v", groups[0])
+	}
+	if text := formatAnswers(groups); !strings.Contains(text, "## Answer from a (same answer from b)") {
+		t.Errorf("Expected collapsed models in heading, got:\n%s", text)
+	}
+}
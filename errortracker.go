@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	maxReportedMessage = 500
+	maxReportedFrames  = 30
+)
+
+// ErrorTracker reports server-side errors (provider failures and panics)
+// to Sentry or Rollbar, so operators of a shared server hear about them
+// without waiting for users. Reports never carry escalation content: the
+// message is scrubbed of secrets, quoted text and query strings, and stack
+// frames keep only function, file and line.
+type ErrorTracker struct {
+	service     string // "sentry" or "rollbar"
+	endpoint    string
+	auth        string
+	environment string
+	release     string
+	httpClient  *http.Client
+	scrubber    *Redactor
+	pending     sync.WaitGroup
+}
+
+// NewSentryTracker reports to the project of a Sentry DSN, e.g.
+// https://<key>@o123.ingest.sentry.io/456.
+func NewSentryTracker(dsn string) (*ErrorTracker, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Sentry DSN: %w", err)
+	}
+	path := strings.Trim(u.Path, "/")
+	slash := strings.LastIndex(path, "/")
+	projectID := path[slash+1:]
+	if u.User == nil || u.User.Username() == "" || projectID == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid Sentry DSN: want scheme://key@host/project")
+	}
+	prefix := ""
+	if slash >= 0 {
+		prefix = "/" + path[:slash]
+	}
+	return newErrorTracker("sentry",
+		fmt.Sprintf("%s://%s%s/api/%s/store/", u.Scheme, u.Host, prefix, projectID),
+		fmt.Sprintf("Sentry sentry_version=7, sentry_client=code-escalator/1.0, sentry_key=%s", u.User.Username())), nil
+}
+
+// NewRollbarTracker reports to the Rollbar project of a post_server_item
+// access token.
+func NewRollbarTracker(token string) *ErrorTracker {
+	return newErrorTracker("rollbar", "https://api.rollbar.com/api/1/item/", token)
+}
+
+func newErrorTracker(service, endpoint, auth string) *ErrorTracker {
+	return &ErrorTracker{
+		service:     service,
+		endpoint:    endpoint,
+		auth:        auth,
+		environment: "production",
+		httpClient:  &http.Client{Timeout: 10 * time.Second},
+		scrubber:    NewRedactor(regexScanner{}, entropyScanner{}),
+	}
+}
+
+// WithEnvironment tags every report with the deployment's environment and
+// the server's release.
+func (t *ErrorTracker) WithEnvironment(environment, release string) *ErrorTracker {
+	t.environment = environment
+	t.release = release
+	return t
+}
+
+// stackFrame is one frame of a reported stack trace.
+type stackFrame struct {
+	Function string
+	File     string
+	Line     int
+}
+
+// trackedError is a report before it's shaped for a service.
+type trackedError struct {
+	Level   string // "error" or "fatal"
+	Type    string
+	Message string
+	Frames  []stackFrame // outermost call first
+	Tags    map[string]string
+	Time    time.Time
+}
+
+// ReportError reports err in the background. Cancellations aren't errors
+// worth reporting and are skipped.
+func (t *ErrorTracker) ReportError(err error, tags map[string]string) {
+	if t == nil || err == nil || errors.Is(err, context.Canceled) {
+		return
+	}
+	root := err
+	for errors.Unwrap(root) != nil {
+		root = errors.Unwrap(root)
+	}
+	t.send(trackedError{
+		Level:   "error",
+		Type:    fmt.Sprintf("%T", root),
+		Message: t.scrub(err.Error()),
+		Frames:  callerFrames(3),
+		Tags:    tags,
+		Time:    time.Now(),
+	})
+}
+
+// Recover reports a panic in progress, waits for the report to be sent
+// and panics again, so a crash is reported without changing how it ends.
+// Call it deferred; on a nil tracker it does nothing.
+func (t *ErrorTracker) Recover(tags map[string]string) {
+	if t == nil {
+		return
+	}
+	value := recover()
+	if value == nil {
+		return
+	}
+	t.send(trackedError{
+		Level:   "fatal",
+		Type:    "panic",
+		Message: t.scrub(fmt.Sprint(value)),
+		Frames:  callerFrames(3),
+		Tags:    tags,
+		Time:    time.Now(),
+	})
+	t.Flush(5 * time.Second)
+	panic(value)
+}
+
+// Flush waits up to timeout for reports still being sent.
+func (t *ErrorTracker) Flush(timeout time.Duration) {
+	if t == nil {
+		return
+	}
+	done := make(chan struct{})
+	go func() {
+		t.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		slog.Warn("Gave up waiting for error reports", "timeout", timeout)
+	}
+}
+
+var (
+	quotedTextPattern  = regexp.MustCompile(`"(?:[^"\\]|\\.)*"|'[^'\n]*'|` + "`[^`\n]*`")
+	queryStringPattern = regexp.MustCompile(`(https?://[^\s?#]+)[?#][^\s]*`)
+)
+
+// scrub removes anything in an error message that may be escalation
+// content: secrets, quoted text (models and tools quote what they reject),
+// query strings, and all but the start of long messages.
+func (t *ErrorTracker) scrub(message string) string {
+	if scrubbed, _, err := t.scrubber.Redact(context.Background(), message); err == nil {
+		message = scrubbed
+	}
+	message = quotedTextPattern.ReplaceAllString(message, `"[SCRUBBED]"`)
+	message = queryStringPattern.ReplaceAllString(message, "$1")
+	if len(message) > maxReportedMessage {
+		message = strings.ToValidUTF8(message[:maxReportedMessage], "") + "..."
+	}
+	return message
+}
+
+// callerFrames returns the stack of the caller skip frames up, outermost
+// call first, leaving out the runtime's own frames.
+func callerFrames(skip int) []stackFrame {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(skip, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	var stack []stackFrame
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, "runtime.") {
+			stack = append(stack, stackFrame{Function: frame.Function, File: frame.File, Line: frame.Line})
+		}
+		if !more {
+			break
+		}
+	}
+	if len(stack) > maxReportedFrames {
+		stack = stack[:maxReportedFrames]
+	}
+	for i, j := 0, len(stack)-1; i < j; i, j = i+1, j-1 {
+		stack[i], stack[j] = stack[j], stack[i]
+	}
+	return stack
+}
+
+// send posts the report in the background, logging failures.
+func (t *ErrorTracker) send(report trackedError) {
+	body, err := json.Marshal(t.payload(report))
+	if err != nil {
+		slog.Error("Couldn't encode error report", "error", err)
+		return
+	}
+	t.pending.Add(1)
+	go func() {
+		defer t.pending.Done()
+		req, err := http.NewRequest(http.MethodPost, t.endpoint, bytes.NewReader(body))
+		if err != nil {
+			slog.Warn("Couldn't report error", "service", t.service, "error", err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if t.service == "sentry" {
+			req.Header.Set("X-Sentry-Auth", t.auth)
+		} else {
+			req.Header.Set("X-Rollbar-Access-Token", t.auth)
+		}
+		resp, err := t.httpClient.Do(req)
+		if err != nil {
+			slog.Warn("Couldn't report error", "service", t.service, "error", err)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			slog.Warn("Error report rejected", "service", t.service, "status", resp.Status)
+		}
+	}()
+}
+
+// payload shapes a report as the service's event format.
+func (t *ErrorTracker) payload(report trackedError) map[string]interface{} {
+	host, _ := os.Hostname()
+	if t.service == "sentry" {
+		frames := make([]map[string]interface{}, len(report.Frames))
+		for i, frame := range report.Frames {
+			frames[i] = map[string]interface{}{
+				"function": frame.Function,
+				"filename": frame.File,
+				"lineno":   frame.Line,
+				"in_app":   strings.HasPrefix(frame.Function, "main."),
+			}
+		}
+		id := make([]byte, 16)
+		rand.Read(id)
+		return map[string]interface{}{
+			"event_id":    hex.EncodeToString(id),
+			"timestamp":   report.Time.UTC().Format(time.RFC3339),
+			"level":       report.Level,
+			"platform":    "go",
+			"logger":      "escalator",
+			"server_name": host,
+			"environment": t.environment,
+			"release":     t.release,
+			"tags":        report.Tags,
+			"exception": map[string]interface{}{
+				"values": []map[string]interface{}{{
+					"type":       report.Type,
+					"value":      report.Message,
+					"stacktrace": map[string]interface{}{"frames": frames},
+				}},
+			},
+		}
+	}
+
+	frames := make([]map[string]interface{}, len(report.Frames))
+	for i, frame := range report.Frames {
+		frames[i] = map[string]interface{}{
+			"filename": frame.File,
+			"lineno":   frame.Line,
+			"method":   frame.Function,
+		}
+	}
+	level := report.Level
+	if level == "fatal" {
+		level = "critical"
+	}
+	return map[string]interface{}{
+		"data": map[string]interface{}{
+			"environment":  t.environment,
+			"level":        level,
+			"timestamp":    report.Time.Unix(),
+			"platform":     "go",
+			"language":     "go",
+			"code_version": t.release,
+			"server":       map[string]interface{}{"host": host},
+			"custom":       report.Tags,
+			"body": map[string]interface{}{
+				"trace": map[string]interface{}{
+					"frames":    frames,
+					"exception": map[string]interface{}{"class": report.Type, "message": report.Message},
+				},
+			},
+		},
+	}
+}
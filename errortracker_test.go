@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// errorReportServer collects the reports posted to it.
+type errorReportServer struct {
+	*httptest.Server
+	mu      sync.Mutex
+	reports []map[string]interface{}
+	headers []http.Header
+}
+
+func newErrorReportServer(t *testing.T) *errorReportServer {
+	s := &errorReportServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var report map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&report)
+		s.mu.Lock()
+		s.reports = append(s.reports, report)
+		s.headers = append(s.headers, r.Header)
+		s.mu.Unlock()
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestNewSentryTracker(t *testing.T) {
+	tests := []struct {
+		dsn, endpoint string
+	}{
+		{"https://abc123@o1.ingest.sentry.io/456", "https://o1.ingest.sentry.io/api/456/store/"},
+		{"https://abc123@sentry.example.com/sentry/7", "https://sentry.example.com/sentry/api/7/store/"},
+		{"https://sentry.example.com/7", ""},
+		{"https://abc123@sentry.example.com/", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		tracker, err := NewSentryTracker(tt.dsn)
+		if tt.endpoint == "" {
+			if err == nil {
+				t.Errorf("%q: expected an error", tt.dsn)
+			}
+			continue
+		}
+		if err != nil || tracker.endpoint != tt.endpoint || !strings.Contains(tracker.auth, "sentry_key=abc123") {
+			t.Errorf("%q: expected endpoint %s, got %+v (%v)", tt.dsn, tt.endpoint, tracker, err)
+		}
+	}
+}
+
+func TestErrorTracker_ScrubsContent(t *testing.T) {
+	server := newErrorReportServer(t)
+	tracker, _ := NewSentryTracker("http://abc123@" + strings.TrimPrefix(server.URL, "http://") + "/42")
+	tracker.WithEnvironment("staging", "escalator@1.0.0")
+
+	err := fmt.Errorf("o3 failed: %w", fmt.Errorf(`invalid 'messages[1].content': "why does reserve() deadlock?" (key sk-proj-abcdefghijklmnopqrstuvwx) at https://api.example.com/v1?user=alice`))
+	tracker.ReportError(err, map[string]string{"model": "o3"})
+	tracker.ReportError(context.Canceled, nil)
+	tracker.Flush(time.Second)
+
+	if len(server.reports) != 1 {
+		t.Fatalf("Expected one report (cancellations skipped), got %d", len(server.reports))
+	}
+	if auth := server.headers[0].Get("X-Sentry-Auth"); !strings.Contains(auth, "sentry_key=abc123") {
+		t.Errorf("Expected the DSN key in X-Sentry-Auth, got %q", auth)
+	}
+	report := server.reports[0]
+	exception := report["exception"].(map[string]interface{})["values"].([]interface{})[0].(map[string]interface{})
+	message := exception["value"].(string)
+	for _, leaked := range []string{"deadlock", "messages[1]", "sk-proj", "alice"} {
+		if strings.Contains(message, leaked) {
+			t.Errorf("Expected %q scrubbed from the report, got %q", leaked, message)
+		}
+	}
+	if !strings.HasPrefix(message, "o3 failed: invalid ") || !strings.Contains(message, "https://api.example.com/v1") {
+		t.Errorf("Expected the shape of the error kept, got %q", message)
+	}
+	if report["environment"] != "staging" || report["release"] != "escalator@1.0.0" || report["level"] != "error" {
+		t.Errorf("Expected the environment, release and level, got %v", report)
+	}
+	if tags := report["tags"].(map[string]interface{}); tags["model"] != "o3" {
+		t.Errorf("Expected the tags, got %v", tags)
+	}
+}
+
+func TestErrorTracker_Recover(t *testing.T) {
+	server := newErrorReportServer(t)
+	tracker := NewRollbarTracker("token")
+	tracker.endpoint = server.URL
+
+	crash := func() {
+		defer tracker.Recover(map[string]string{"tool": "get_help"})
+		var m map[string]int
+		m["question"]++
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("Expected the panic to go on after it was reported")
+			}
+		}()
+		crash()
+	}()
+
+	if len(server.reports) != 1 {
+		t.Fatalf("Expected the panic reported before it went on, got %d reports", len(server.reports))
+	}
+	if token := server.headers[0].Get("X-Rollbar-Access-Token"); token != "token" {
+		t.Errorf("Expected the access token, got %q", token)
+	}
+	data := server.reports[0]["data"].(map[string]interface{})
+	trace := data["body"].(map[string]interface{})["trace"].(map[string]interface{})
+	frames := trace["frames"].([]interface{})
+	last := frames[len(frames)-1].(map[string]interface{})
+	if data["level"] != "critical" || !strings.HasSuffix(last["method"].(string), "TestErrorTracker_Recover.func1") {
+		t.Errorf("Expected a critical report ending at the crash site, got level %v and frame %v", data["level"], last)
+	}
+
+	var none *ErrorTracker
+	func() {
+		defer func() { recover() }()
+		defer none.Recover(nil)
+		panic("ignored")
+	}()
+}
+
+func TestLLM_ReportsProviderFailures(t *testing.T) {
+	withFastRetries(t)
+	server := newErrorReportServer(t)
+	tracker := NewRollbarTracker("token")
+	tracker.endpoint = server.URL
+
+	llm := NewLLM("o3").WithFallbackModels([]string{"gpt-4o"}).WithErrorTracker(tracker).
+		WithProvider(CompletionFunc(func(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error) {
+			return nil, fmt.Errorf("status code: 503")
+		}))
+	if _, err := llm.Ask(context.Background(), "Why?", nil); err == nil {
+		t.Fatal("Expected the call to fail")
+	}
+	tracker.Flush(time.Second)
+
+	if len(server.reports) != 1 {
+		t.Fatalf("Expected one report for the whole chain, got %d", len(server.reports))
+	}
+	custom := server.reports[0]["data"].(map[string]interface{})["custom"].(map[string]interface{})
+	if custom["component"] != "provider" || custom["model"] != "o3" {
+		t.Errorf("Expected the provider and model tags, got %v", custom)
+	}
+}
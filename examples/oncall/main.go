@@ -0,0 +1,106 @@
+// Command oncall is an MCP server built on pkg/mcp: a who_is_on_call tool,
+// with a middleware that logs each call's duration, served over stdio and,
+// with -listen, over streamable HTTP as well.
+//
+//	go run ./examples/oncall -schedule "payments=alice,search=bob"
+//	claude mcp add oncall "go run ./examples/oncall -schedule payments=alice" -t stdio
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/dratner/code-escalator/pkg/mcp"
+)
+
+func main() {
+	schedule := flag.String("schedule", os.Getenv("ONCALL_SCHEDULE"), `Who is on call, as "service=person" pairs separated by commas`)
+	listen := flag.String("listen", "", "Also serve streamable HTTP at /mcp on this address")
+	flag.Parse()
+
+	// Stdout carries the protocol, so logs go to stderr.
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, nil)))
+
+	opts := []mcp.Option{
+		mcp.WithTool(NewOnCallTool(*schedule)),
+		mcp.WithMiddleware(timingMiddleware),
+		mcp.WithTransport(mcp.Stdio()),
+	}
+	if *listen != "" {
+		opts = append(opts, mcp.WithTransport(mcp.HTTP(*listen)))
+	}
+	server := mcp.NewServer("oncall", "1.0.0", opts...)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := server.Run(ctx); err != nil {
+		slog.Error("Server stopped", "error", err)
+		os.Exit(1)
+	}
+}
+
+// OnCallTool answers who is on call for a service, from a schedule of
+// "service=person" pairs. A real one would ask the paging system.
+type OnCallTool struct {
+	schedule map[string]string
+}
+
+func NewOnCallTool(schedule string) *OnCallTool {
+	t := &OnCallTool{schedule: make(map[string]string)}
+	for _, entry := range strings.Split(schedule, ",") {
+		if service, person, ok := strings.Cut(strings.TrimSpace(entry), "="); ok {
+			t.schedule[service] = person
+		}
+	}
+	return t
+}
+
+func (t *OnCallTool) Name() string {
+	return "who_is_on_call"
+}
+
+func (t *OnCallTool) Description() string {
+	return "Find who is on call for a service, to escalate to a person"
+}
+
+func (t *OnCallTool) Schema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"service": map[string]interface{}{
+				"type":        "string",
+				"description": "The service's name",
+			},
+		},
+		"required": []string{"service"},
+	}
+}
+
+func (t *OnCallTool) Call(arguments map[string]interface{}) ([]map[string]interface{}, error) {
+	service, _ := arguments["service"].(string)
+	if service == "" {
+		return mcp.TextContent("Error: Missing required field: service"), fmt.Errorf("missing required fields")
+	}
+	person, ok := t.schedule[service]
+	if !ok {
+		return mcp.TextContent(fmt.Sprintf("Nobody is on call for %s.", service)), nil
+	}
+	return mcp.TextContent(fmt.Sprintf("%s is on call for %s.", person, service)), nil
+}
+
+// timingMiddleware logs how long each tool call takes.
+func timingMiddleware(next mcp.ToolHandler) mcp.ToolHandler {
+	return func(ctx context.Context, tool mcp.Tool, arguments map[string]interface{}, onDelta func(string)) ([]map[string]interface{}, error) {
+		start := time.Now()
+		content, err := next(ctx, tool, arguments, onDelta)
+		slog.InfoContext(ctx, "Tool call timed", "tool", tool.Name(), "duration", time.Since(start), "error", err)
+		return content, err
+	}
+}
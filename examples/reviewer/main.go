@@ -0,0 +1,107 @@
+// Command reviewer is an MCP server built on pkg/mcp and pkg/llm: a
+// review_against_guidelines tool that asks a model to review code against
+// a team's guidelines, using the provider the server was built with. Swap
+// llm.NewOpenAI for an in-house gateway by implementing llm.Provider.
+//
+//	OPENAI_API_KEY=... go run ./examples/reviewer -guidelines ./GUIDELINES.md
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/dratner/code-escalator/pkg/llm"
+	"github.com/dratner/code-escalator/pkg/mcp"
+	"github.com/sashabaranov/go-openai"
+)
+
+func main() {
+	guidelinesPath := flag.String("guidelines", "GUIDELINES.md", "File of the guidelines code is reviewed against")
+	model := flag.String("model", "gpt-4o", "Model that reviews the code")
+	listen := flag.String("listen", "", "Serve streamable HTTP at /mcp on this address instead of stdio")
+	flag.Parse()
+
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, nil)))
+	guidelines, err := os.ReadFile(*guidelinesPath)
+	if err != nil {
+		slog.Error("Couldn't read the guidelines", "error", err)
+		os.Exit(1)
+	}
+
+	transport := mcp.Stdio()
+	if *listen != "" {
+		transport = mcp.HTTP(*listen)
+	}
+	server := mcp.NewServer("reviewer", "1.0.0",
+		mcp.WithTool(&ReviewTool{guidelines: string(guidelines), model: *model}),
+		mcp.WithProvider(llm.NewOpenAI(openai.NewClient(os.Getenv("OPENAI_API_KEY")))),
+		mcp.WithTransport(transport),
+	)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := server.Run(ctx); err != nil {
+		slog.Error("Server stopped", "error", err)
+		os.Exit(1)
+	}
+}
+
+// ReviewTool reviews code against the team's guidelines with the server's
+// model provider, streaming the review as progress when the client asks.
+type ReviewTool struct {
+	guidelines string
+	model      string
+}
+
+func (t *ReviewTool) Name() string {
+	return "review_against_guidelines"
+}
+
+func (t *ReviewTool) Description() string {
+	return "Review code against the team's coding guidelines before proposing it"
+}
+
+func (t *ReviewTool) Schema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"code": map[string]interface{}{
+				"type":        "string",
+				"description": "The code to review",
+			},
+		},
+		"required": []string{"code"},
+	}
+}
+
+func (t *ReviewTool) Call(arguments map[string]interface{}) ([]map[string]interface{}, error) {
+	return t.CallContext(context.Background(), arguments, nil)
+}
+
+func (t *ReviewTool) CallContext(ctx context.Context, arguments map[string]interface{}, onDelta func(string)) ([]map[string]interface{}, error) {
+	code, _ := arguments["code"].(string)
+	if code == "" {
+		return mcp.TextContent("Error: Missing required field: code"), fmt.Errorf("missing required fields")
+	}
+	provider, ok := llm.FromContext(ctx)
+	if !ok {
+		return mcp.TextContent("Error: No model is configured"), fmt.Errorf("no provider")
+	}
+
+	completion, err := llm.Generate(ctx, provider, openai.ChatCompletionRequest{
+		Model: t.model,
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: "Review the code against these guidelines. List each violation with the line and the fix; say so if there are none.\n\n" + t.guidelines},
+			{Role: openai.ChatMessageRoleUser, Content: code},
+		},
+	}, onDelta)
+	if err != nil {
+		return mcp.TextContent("Error: The review failed: " + err.Error()), err
+	}
+	return mcp.TextContent(completion.Answer), nil
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// Expert is another MCP server escalations on its subject are forwarded
+// to, such as a database specialist.
+type Expert struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Keywords    []string `json:"keywords"`
+	// Command runs the server over stdio; URL reaches it over streamable
+	// HTTP. Exactly one is set.
+	Command []string          `json:"command"`
+	Env     map[string]string `json:"env"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+	// Tool is the tool to call, which may be left out when the server has
+	// only one. Argument is the argument the question goes in.
+	Tool     string `json:"tool"`
+	Argument string `json:"argument"`
+
+	client *MCPClient
+}
+
+// ExpertRouter forwards escalations to the expert whose subject matches
+// the question. A classifier model picks the expert from their
+// descriptions; without one, the expert with the most keywords in the
+// question is chosen.
+type ExpertRouter struct {
+	experts    []*Expert
+	classifier *LLM
+	redactor   *Redactor
+	scrubber   *Redactor
+}
+
+// LoadExperts reads a JSON array of experts.
+func LoadExperts(path string) (*ExpertRouter, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var experts []*Expert
+	if err := json.Unmarshal(data, &experts); err != nil {
+		return nil, fmt.Errorf("couldn't parse %s: %w", path, err)
+	}
+	return NewExpertRouter(experts)
+}
+
+func NewExpertRouter(experts []*Expert) (*ExpertRouter, error) {
+	if len(experts) == 0 {
+		return nil, fmt.Errorf("no experts configured")
+	}
+	seen := make(map[string]bool)
+	for i, expert := range experts {
+		switch {
+		case expert.Name == "" || expert.Name == "none":
+			return nil, fmt.Errorf("expert %d needs a name other than none", i+1)
+		case seen[expert.Name]:
+			return nil, fmt.Errorf("two experts are named %q", expert.Name)
+		case (len(expert.Command) == 0) == (expert.URL == ""):
+			return nil, fmt.Errorf("expert %s needs either a command or a url", expert.Name)
+		case expert.Description == "" && len(expert.Keywords) == 0:
+			return nil, fmt.Errorf("expert %s needs a description or keywords to be matched by", expert.Name)
+		}
+		seen[expert.Name] = true
+		if expert.URL != "" {
+			expert.client = NewHTTPMCPClient(expert.URL, expert.Headers)
+		} else {
+			expert.client = NewStdioMCPClient(expert.Command, expert.Env)
+		}
+	}
+	return &ExpertRouter{experts: experts}, nil
+}
+
+// WithClassifier picks experts with a model, usually a cheap one, rather
+// than by keyword.
+func (r *ExpertRouter) WithClassifier(llm *LLM) *ExpertRouter {
+	r.classifier = llm
+	return r
+}
+
+// WithRedactor redacts secrets from what is forwarded to experts, as from
+// what is sent to the model.
+func (r *ExpertRouter) WithRedactor(redactor *Redactor) *ExpertRouter {
+	r.redactor = redactor
+	return r
+}
+
+// WithPIIScrubber masks personal data in what is forwarded to experts.
+func (r *ExpertRouter) WithPIIScrubber(scrubber *Redactor) *ExpertRouter {
+	r.scrubber = scrubber
+	return r
+}
+
+// Names lists the experts.
+func (r *ExpertRouter) Names() []string {
+	names := make([]string, len(r.experts))
+	for i, expert := range r.experts {
+		names[i] = expert.Name
+	}
+	return names
+}
+
+// Classify returns the expert for the question, or nil when none matches.
+// The classifier's completion is returned for usage accounting.
+func (r *ExpertRouter) Classify(ctx context.Context, question, code string) (*Expert, *Completion, error) {
+	if r.classifier == nil {
+		return r.matchKeywords(question + "\n" + code), nil, nil
+	}
+
+	var b strings.Builder
+	b.WriteString("Route this engineering question to the specialist best placed to answer it, or to none if no specialist clearly fits; general questions go to none.\n\nSpecialists:\n")
+	for _, expert := range r.experts {
+		fmt.Fprintf(&b, "- %s: %s", expert.Name, expert.Description)
+		if len(expert.Keywords) > 0 {
+			fmt.Fprintf(&b, " (topics: %s)", strings.Join(expert.Keywords, ", "))
+		}
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(&b, "\n<question>\n%s\n</question>\n", question)
+	if code != "" {
+		fmt.Fprintf(&b, "\n<code>\n%s\n</code>\n", truncateMiddle(code, 4000))
+	}
+	b.WriteString("\nRespond with a JSON object: {\"expert\": \"the specialist's name, or none\"}")
+
+	req := userRequest(b.String())
+	req.ResponseFormat = &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject}
+	completion, err := r.classifier.Generate(ctx, req, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	var choice struct {
+		Expert string `json:"expert"`
+	}
+	if err := json.Unmarshal([]byte(completion.Answer), &choice); err != nil {
+		return nil, completion, fmt.Errorf("couldn't parse the classification: %w", err)
+	}
+	for _, expert := range r.experts {
+		if strings.EqualFold(expert.Name, strings.TrimSpace(choice.Expert)) {
+			return expert, completion, nil
+		}
+	}
+	return nil, completion, nil
+}
+
+// matchKeywords returns the expert with the most distinct keywords in
+// text, the first listed on a tie, or nil when none has any.
+func (r *ExpertRouter) matchKeywords(text string) *Expert {
+	var best *Expert
+	bestScore := 0
+	for _, expert := range r.experts {
+		score := 0
+		for _, keyword := range expert.Keywords {
+			pattern := `(?i)\b` + regexp.QuoteMeta(strings.TrimSpace(keyword)) + `\b`
+			if matched, _ := regexp.MatchString(pattern, text); matched {
+				score++
+			}
+		}
+		if score > bestScore {
+			best, bestScore = expert, score
+		}
+	}
+	return best
+}
+
+// Ask forwards the escalation to the expert's tool. The question goes in
+// the expert's question argument; get_help arguments the tool also takes
+// (such as summary and relevant_code) are passed as they are, and the rest
+// of the context is added to the question.
+func (r *ExpertRouter) Ask(ctx context.Context, expert *Expert, arguments map[string]interface{}) ([]map[string]interface{}, error) {
+	tools, err := expert.client.Tools(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't list %s's tools: %w", expert.Name, err)
+	}
+	name := expert.Tool
+	if name == "" {
+		if len(tools) != 1 {
+			return nil, fmt.Errorf("%s has %d tools; configure which to call", expert.Name, len(tools))
+		}
+		for only := range tools {
+			name = only
+		}
+	}
+	schema, ok := tools[name]
+	if !ok {
+		return nil, fmt.Errorf("%s has no tool %q", expert.Name, name)
+	}
+	properties, _ := schema["properties"].(map[string]interface{})
+
+	target := expert.Argument
+	if target == "" {
+		target = questionArgument(schema)
+	}
+	if target == "" {
+		return nil, fmt.Errorf("%s's %s tool has no string argument for the question; configure one", expert.Name, name)
+	}
+
+	forwarded := make(map[string]interface{})
+	var extra []string
+	for _, key := range []string{"summary", "relevant_code"} {
+		value, _ := arguments[key].(string)
+		if value == "" {
+			continue
+		}
+		if _, ok := properties[key]; ok && key != target {
+			forwarded[key] = value
+			continue
+		}
+		extra = append(extra, fmt.Sprintf("<%s>\n%s\n</%s>", key, value, key))
+	}
+	question, _ := arguments["question"].(string)
+	forwarded[target] = strings.Join(append([]string{question}, extra...), "\n\n")
+
+	if r.redactor != nil {
+		for key, value := range forwarded {
+			redacted, findings, err := r.redactor.Redact(ctx, value.(string))
+			if err != nil {
+				return nil, fmt.Errorf("couldn't scan for secrets: %w", err)
+			}
+			if len(findings) > 0 {
+				slog.Info("Redacted secrets before forwarding to an expert", "secrets", len(findings), "argument", key, "expert", expert.Name)
+			}
+			forwarded[key] = redacted
+		}
+	}
+	if r.scrubber != nil {
+		for key, value := range forwarded {
+			scrubbed, findings, err := r.scrubber.Redact(ctx, value.(string))
+			if err != nil {
+				return nil, fmt.Errorf("couldn't scan for PII: %w", err)
+			}
+			if len(findings) > 0 {
+				slog.Info("Scrubbed PII before forwarding to an expert", "pii", len(findings), "argument", key, "expert", expert.Name)
+			}
+			forwarded[key] = scrubbed
+		}
+	}
+	return expert.client.CallTool(ctx, name, forwarded)
+}
+
+// questionArgument picks the argument a question goes in: one named like
+// a question, or else the only required string argument.
+func questionArgument(schema map[string]interface{}) string {
+	properties, _ := schema["properties"].(map[string]interface{})
+	for _, name := range []string{"question", "query", "prompt", "problem", "message"} {
+		if _, ok := properties[name]; ok {
+			return name
+		}
+	}
+	var required []string
+	switch list := schema["required"].(type) {
+	case []interface{}:
+		for _, item := range list {
+			if s, ok := item.(string); ok {
+				required = append(required, s)
+			}
+		}
+	case []string:
+		required = list
+	}
+	var candidates []string
+	for _, name := range required {
+		if prop, ok := properties[name].(map[string]interface{}); ok && prop["type"] == "string" {
+			candidates = append(candidates, name)
+		}
+	}
+	if len(candidates) == 1 {
+		return candidates[0]
+	}
+	return ""
+}
+
+// Close stops the experts' servers.
+func (r *ExpertRouter) Close() {
+	for _, expert := range r.experts {
+		expert.client.Close()
+	}
+}
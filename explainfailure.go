@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	// maxFailureChars caps the failure output sent, about 6,000 tokens,
+	// leaving the rest of the prompt for code and context.
+	maxFailureChars = 24000
+	maxFailureFiles = 5
+)
+
+// ExplainFailureTool diagnoses a compiler error, panic or test failure. It
+// frames the output for diagnosis and asks through get_help, so answers
+// get the project's context, caching and history, and repository files
+// named in the output are read into the prompt.
+type ExplainFailureTool struct {
+	help *GetHelpTool
+}
+
+func NewExplainFailureTool(help *GetHelpTool) *ExplainFailureTool {
+	return &ExplainFailureTool{help: help}
+}
+
+func (t *ExplainFailureTool) Name() string {
+	return "explain_failure"
+}
+
+func (t *ExplainFailureTool) Category() string {
+	return "code/debugging"
+}
+
+func (t *ExplainFailureTool) Description() string {
+	return "Diagnose a compiler error, panic stack trace or go test failure: returns the root cause and how to fix it"
+}
+
+func (t *ExplainFailureTool) Schema() map[string]interface{} {
+	help := t.help.Schema()["properties"].(map[string]interface{})
+	properties := map[string]interface{}{
+		"output": map[string]interface{}{
+			"type":        "string",
+			"description": "The failure output as printed: compiler errors, a panic and its stack trace, or go test output (passing tests are ignored)",
+		},
+		"summary": help["summary"],
+		"code": map[string]interface{}{
+			"type":        "string",
+			"description": "Code involved in the failure, such as the failing test and the function it calls (optional)",
+		},
+		"command": map[string]interface{}{
+			"type":        "string",
+			"description": "The command that failed, e.g. \"go test ./internal/store -run TestReserve\" (optional)",
+		},
+	}
+	// The answer options carry over from get_help.
+	for _, name := range []string{"files", "model", "fresh", "response_format"} {
+		if prop, ok := help[name]; ok {
+			properties[name] = prop
+		}
+	}
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+		"required":   []string{"output", "summary"},
+	}
+}
+
+// OutputSchema is get_help's: explanations are get_help answers.
+func (t *ExplainFailureTool) OutputSchema() map[string]interface{} {
+	return t.help.OutputSchema()
+}
+
+func (t *ExplainFailureTool) Call(arguments map[string]interface{}) ([]map[string]interface{}, error) {
+	return t.CallStream(arguments, nil)
+}
+
+func (t *ExplainFailureTool) CallStream(arguments map[string]interface{}, onDelta func(string)) ([]map[string]interface{}, error) {
+	return t.CallContext(context.Background(), arguments, onDelta)
+}
+
+// CallContext behaves like CallStream, asking get_help under ctx.
+func (t *ExplainFailureTool) CallContext(ctx context.Context, arguments map[string]interface{}, onDelta func(string)) ([]map[string]interface{}, error) {
+	output, _ := arguments["output"].(string)
+	summary, _ := arguments["summary"].(string)
+	if strings.TrimSpace(output) == "" || summary == "" {
+		return textContent("Error: Missing required fields: output and summary"), fmt.Errorf("missing required fields")
+	}
+	command, _ := arguments["command"].(string)
+	// Files are looked for in what's sent, not in omitted goroutines.
+	condensed := condenseFailure(output)
+
+	helpArguments := map[string]interface{}{
+		"question": failureQuestion(failureKind(output), condensed, command),
+		"summary":  summary,
+	}
+	if code, ok := arguments["code"].(string); ok {
+		helpArguments["relevant_code"] = code
+	}
+	for _, name := range []string{"model", "fresh", "response_format"} {
+		if value, ok := arguments[name]; ok {
+			helpArguments[name] = value
+		}
+	}
+	if t.help.repo != nil {
+		files := stringListArgument(arguments, "files")
+		named := failureFiles(condensed, t.help.repo)
+		if len(named) > 0 {
+			slog.InfoContext(ctx, "Including repository files named in the failure", "tool", "explain_failure", "files", named)
+		}
+		files = append(files, named...)
+		if len(files) > 0 {
+			helpArguments["files"] = files
+		}
+	}
+	return t.help.CallContext(ctx, helpArguments, onDelta)
+}
+
+// failureQuestion frames condensed failure output as a request for a
+// diagnosis.
+func failureQuestion(kind, condensed, command string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Diagnose this %s", kind)
+	if command != "" {
+		fmt.Fprintf(&b, " from `%s`", command)
+	}
+	b.WriteString(". Explain the root cause: which code is at fault and why it fails, not just what the message says. " +
+		"Then give the smallest fix that addresses the cause, and how to confirm it (the test or command to rerun). " +
+		"If the output isn't enough to be sure, say what to check next.\n\n")
+	fmt.Fprintf(&b, "<failure kind=%q>\n%s\n</failure>", kind, condensed)
+	return b.String()
+}
+
+var (
+	compilerErrorLine = regexp.MustCompile(`(?m)^\S+\.go:\d+(?::\d+)?: `)
+	goroutineHeader   = regexp.MustCompile(`^goroutine \d+ \[`)
+	testNoiseLine     = regexp.MustCompile(`^\s*(?:=== (?:RUN|PAUSE|CONT|NAME)\s|--- PASS: |PASS$|ok\s+\S+\s|\?\s+\S+\s+\[no test files\])`)
+	failureFileRef    = regexp.MustCompile(`((?:[A-Za-z]:)?[\w./\\-]*\w\.[A-Za-z]\w*):\d+`)
+)
+
+// failureKind names what the output shows, for the prompt.
+func failureKind(output string) string {
+	switch {
+	case strings.Contains(output, "panic: ") || strings.Contains(output, "fatal error: "):
+		return "panic"
+	case strings.Contains(output, "--- FAIL") || strings.Contains(output, "FAIL\t"):
+		return "test failure"
+	case compilerErrorLine.MatchString(output):
+		return "compiler error"
+	}
+	return "failure"
+}
+
+// condenseFailure drops what doesn't help a diagnosis: passing tests and
+// every goroutine of a panic's dump but the first, which panicked. Output
+// that is still too long loses its middle.
+func condenseFailure(output string) string {
+	var kept []string
+	goroutines, omitted := 0, 0
+	skipping := false
+	for _, line := range strings.Split(strings.TrimRight(output, "\n"), "\n") {
+		if goroutineHeader.MatchString(line) {
+			goroutines++
+			skipping = goroutines > 1
+			if skipping {
+				omitted++
+				continue
+			}
+		}
+		if skipping {
+			// A goroutine's frames end at a blank line; anything but
+			// another goroutine after it is output again.
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			if strings.HasPrefix(line, "\t") || strings.HasSuffix(line, ")") || strings.Contains(line, "created by ") {
+				continue
+			}
+			skipping = false
+		}
+		if testNoiseLine.MatchString(line) {
+			continue
+		}
+		kept = append(kept, line)
+	}
+	if omitted > 0 {
+		kept = append(kept, fmt.Sprintf("[%d other goroutines omitted]", omitted))
+	}
+	return truncateMiddle(strings.Join(kept, "\n"), maxFailureChars)
+}
+
+// failureFiles returns the repository files the output refers to as
+// path:line, in order, without duplicates. Absolute paths and paths from
+// another checkout (a CI runner's, say) are matched by their longest
+// suffix that names a file in the repository.
+func failureFiles(output string, repo *Repository) []string {
+	var files []string
+	seen := make(map[string]bool)
+	for _, m := range failureFileRef.FindAllStringSubmatch(output, -1) {
+		parts := strings.Split(strings.TrimPrefix(filepath.ToSlash(m[1]), "./"), "/")
+		for i := range parts {
+			candidate := strings.Join(parts[i:], "/")
+			if candidate == "" || candidate == "." || strings.HasPrefix(candidate, "..") {
+				continue
+			}
+			if repo.readable(candidate) {
+				if !seen[candidate] {
+					seen[candidate] = true
+					files = append(files, candidate)
+				}
+				break
+			}
+		}
+		if len(files) == maxFailureFiles {
+			break
+		}
+	}
+	return files
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const testPanicOutput = `=== RUN   TestReserve
+--- PASS: TestRelease (0.00s)
+panic: assignment to entry in nil map
+
+goroutine 7 [running]:
+example.com/inventory/internal/store.(*Store).Reserve(0xc000010000, {0x5, 0x1})
+	/ci/builds/inventory/internal/store/a.go:12 +0x1d
+example.com/inventory/internal/api.Handle(...)
+	/ci/builds/inventory/internal/api/handler.go:40
+created by testing.(*T).Run in goroutine 1
+	/usr/local/go/src/testing/testing.go:1742 +0x390
+
+goroutine 1 [chan receive]:
+testing.(*T).Run(0xc000007040, {0x5f1b2e, 0xb}, 0x60bb28)
+	/usr/local/go/src/testing/testing.go:1750 +0x3ab
+
+goroutine 8 [select]:
+example.com/inventory/internal/store.worker()
+	/ci/builds/inventory/internal/store/b.go:30 +0x9c
+exit status 2
+FAIL	example.com/inventory/internal/store	0.012s
+`
+
+func TestFailureKind(t *testing.T) {
+	for output, want := range map[string]string{
+		testPanicOutput: "panic",
+		"--- FAIL: TestReserve (0.00s)\n    a_test.go:9: got 1, want 2\nFAIL\n": "test failure",
+		"# example.com/inventory\n./a.go:12:3: undefined: reserve\n":            "compiler error",
+		"make: *** [build] Error 1":                                             "failure",
+	} {
+		if got := failureKind(output); got != want {
+			t.Errorf("Expected %q for %q, got %q", want, output, got)
+		}
+	}
+}
+
+func TestCondenseFailure(t *testing.T) {
+	condensed := condenseFailure(testPanicOutput)
+	for _, dropped := range []string{"=== RUN", "--- PASS", "chan receive", "worker()", "b.go:30"} {
+		if strings.Contains(condensed, dropped) {
+			t.Errorf("Expected %q dropped, got:\n%s", dropped, condensed)
+		}
+	}
+	for _, kept := range []string{"panic: assignment to entry in nil map", "internal/store/a.go:12", "exit status 2", "FAIL\texample.com", "[2 other goroutines omitted]"} {
+		if !strings.Contains(condensed, kept) {
+			t.Errorf("Expected %q kept, got:\n%s", kept, condensed)
+		}
+	}
+
+	long := strings.Repeat("--- FAIL: TestReserve (0.00s)\n", maxFailureChars/10)
+	if condensed := condenseFailure(long); len(condensed) > maxFailureChars || !strings.Contains(condensed, "trimmed") {
+		t.Errorf("Expected long output trimmed to %d characters, got %d", maxFailureChars, len(condensed))
+	}
+}
+
+func TestFailureFiles(t *testing.T) {
+	repo := testRepository(t)
+	output := testPanicOutput + "./main.go:3:1: syntax error\ndebug.log:1: ignored\nhttp://example.com:8080 refused\n"
+	want := []string{"internal/store/a.go", "internal/api/handler.go", "internal/store/b.go", "main.go"}
+	if got := failureFiles(output, repo); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestExplainFailureTool_Call(t *testing.T) {
+	var prompt string
+	help := NewGetHelpTool("", "o3").WithRepository(testRepository(t))
+	help.LLM().WithProvider(CompletionFunc(func(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error) {
+		prompt = req.Messages[len(req.Messages)-1].Content
+		return &Completion{Answer: "Reserve writes to a nil map.", Model: req.Model}, nil
+	}))
+	tool := NewExplainFailureTool(help)
+
+	if _, ok := tool.Schema()["properties"].(map[string]interface{})["files"]; !ok {
+		t.Error("Expected the files argument with a repository")
+	}
+
+	content, err := tool.Call(map[string]interface{}{
+		"output":  testPanicOutput,
+		"summary": "Inventory service",
+		"command": "go test ./internal/store",
+		"code":    "func (s *Store) Reserve(id, n int) { s.held[id] += n }",
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if content[0]["text"] != "Reserve writes to a nil map." {
+		t.Errorf("Expected the answer, got %v", content)
+	}
+	for _, want := range []string{
+		"Diagnose this panic from `go test ./internal/store`",
+		`<failure kind="panic">`,
+		"s.held[id] += n",
+		"**File internal/store/a.go:**",
+		"**File internal/api/handler.go:**",
+	} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("Expected the prompt to contain %q, got:\n%s", want, prompt)
+		}
+	}
+
+	if strings.Contains(prompt, "internal/store/b.go") {
+		t.Error("Expected files in omitted goroutines left out")
+	}
+
+	if _, err := tool.Call(map[string]interface{}{"summary": "s", "output": " "}); err == nil {
+		t.Error("Expected an error without output")
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dratner/code-escalator/pkg/mcp"
+)
+
+// ToolHandler and ToolMiddleware are defined by pkg/mcp. Middleware wraps
+// every tool call the server makes, whichever transport it came in on,
+// including pipeline steps.
+type (
+	ToolHandler    = mcp.ToolHandler
+	ToolMiddleware = mcp.ToolMiddleware
+)
+
+// An Extension adds proprietary tools, middleware or a provider to a build
+// of the escalator. It runs once at startup, after the built-in tools are
+// registered and the get_help tool configured from the flags.
+type Extension func(server *MCPServer, help *GetHelpTool) error
+
+var (
+	extensionsMu sync.Mutex
+	extensions   = make(map[string]Extension)
+)
+
+// RegisterExtension adds an extension to the binary. It is meant to be
+// called from the init function of a file compiled into the build, such as
+// one behind a build tag, and panics when name is already registered.
+func RegisterExtension(name string, extension Extension) {
+	extensionsMu.Lock()
+	defer extensionsMu.Unlock()
+	if _, ok := extensions[name]; ok {
+		panic(fmt.Sprintf("extension %q registered twice", name))
+	}
+	extensions[name] = extension
+}
+
+// applyExtensions runs the registered extensions in name order.
+func applyExtensions(server *MCPServer, help *GetHelpTool) error {
+	extensionsMu.Lock()
+	defer extensionsMu.Unlock()
+	names := make([]string, 0, len(extensions))
+	for name := range extensions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := extensions[name](server, help); err != nil {
+			return fmt.Errorf("extension %s: %w", name, err)
+		}
+		slog.Info("Applied extension", "name", name)
+	}
+	return nil
+}
+
+// WithTool registers tool, replacing any tool of the same name.
+func (s *MCPServer) WithTool(tool Tool) *MCPServer {
+	s.RegisterTool(tool)
+	return s
+}
+
+// WithMiddleware wraps every tool call in mw. Middleware added first runs
+// outermost.
+func (s *MCPServer) WithMiddleware(mw ToolMiddleware) *MCPServer {
+	s.server.Use(mw)
+	return s
+}
+
+// callTool runs tool through the server's middleware.
+func (s *MCPServer) callTool(ctx context.Context, tool Tool, arguments map[string]interface{}, onDelta func(string)) ([]map[string]interface{}, error) {
+	return s.server.CallTool(ctx, tool, arguments, onDelta)
+}
+
+// recordEscalations records the answer in the history when the tool
+// escalated without recording it. It is the outermost middleware, so it
+// records what the extensions' middleware returned.
+func (s *MCPServer) recordEscalations(next ToolHandler) ToolHandler {
+	return func(ctx context.Context, tool Tool, arguments map[string]interface{}, onDelta func(string)) ([]map[string]interface{}, error) {
+		start := time.Now()
+		content, err := next(ctx, tool, arguments, onDelta)
+		if err == nil {
+			s.recordEscalation(tool, arguments, content, time.Since(start))
+		}
+		return content, err
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestMCPServer_WithMiddleware(t *testing.T) {
+	tool := NewGetHelpTool("", "o3")
+	tool.LLM().WithProvider(CompletionFunc(func(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error) {
+		return &Completion{Answer: "answer", Model: req.Model}, nil
+	}))
+	var order []string
+	trace := func(name string) ToolMiddleware {
+		return func(next ToolHandler) ToolHandler {
+			return func(ctx context.Context, tool Tool, arguments map[string]interface{}, onDelta func(string)) ([]map[string]interface{}, error) {
+				order = append(order, name+" "+tool.Name())
+				return next(ctx, tool, arguments, onDelta)
+			}
+		}
+	}
+	refuse := func(next ToolHandler) ToolHandler {
+		return func(ctx context.Context, tool Tool, arguments map[string]interface{}, onDelta func(string)) ([]map[string]interface{}, error) {
+			if strings.Contains(fmt.Sprint(arguments["question"]), "secret") {
+				return textContent("Error: questions about secrets aren't escalated"), fmt.Errorf("refused")
+			}
+			return next(ctx, tool, arguments, onDelta)
+		}
+	}
+	server := NewMCPServer("test", "1.0.0").WithTool(tool).
+		WithMiddleware(trace("outer")).
+		WithMiddleware(refuse).
+		WithMiddleware(trace("inner"))
+
+	call := func(question string) JsonRPCResponse {
+		return server.ProcessRequest(JsonRPCRequest{Jsonrpc: "2.0", ID: 1, Method: "tools/call",
+			Params: json.RawMessage(`{"name":"get_help","arguments":{"question":"` + question + `","summary":"s"}}`)})
+	}
+	if resp := call("Why?"); resp.Error != nil {
+		t.Fatalf("Expected the call answered, got %+v", resp.Error)
+	}
+	if want := []string{"outer get_help", "inner get_help"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("Expected middleware outermost first, got %v", order)
+	}
+
+	order = nil
+	resp := call("Where is the secret?")
+	if data, _ := json.Marshal(resp); !strings.Contains(string(data), "aren't escalated") {
+		t.Errorf("Expected the call refused, got %s", data)
+	}
+	if want := []string{"outer get_help"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("Expected the refusal to stop the chain, got %v", order)
+	}
+}
+
+func TestApplyExtensions(t *testing.T) {
+	saved := extensions
+	defer func() { extensions = saved }()
+	extensions = make(map[string]Extension)
+
+	var applied []string
+	RegisterExtension("b", func(server *MCPServer, help *GetHelpTool) error {
+		applied = append(applied, "b")
+		server.WithTool(NewResetSessionTool(nil))
+		return nil
+	})
+	RegisterExtension("a", func(server *MCPServer, help *GetHelpTool) error {
+		applied = append(applied, "a")
+		help.LLM().WithProvider(CompletionFunc(func(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error) {
+			return &Completion{Answer: "in-house", Model: req.Model}, nil
+		}))
+		return nil
+	})
+	server := NewMCPServer("test", "1.0.0")
+	help := NewGetHelpTool("", "o3")
+	if err := applyExtensions(server, help); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := server.server.Tool("reset_session"); !reflect.DeepEqual(applied, []string{"a", "b"}) || !ok {
+		t.Errorf("Expected both extensions applied in name order, got %v", applied)
+	}
+	if result, err := help.Call(map[string]interface{}{"question": "q", "summary": "s"}); err != nil || result[0]["text"] != "in-house" {
+		t.Errorf("Expected the extension's provider used, got %v, %v", result, err)
+	}
+
+	RegisterExtension("c", func(*MCPServer, *GetHelpTool) error { return fmt.Errorf("no licence") })
+	if err := applyExtensions(server, help); err == nil || !strings.Contains(err.Error(), "extension c: no licence") {
+		t.Errorf("Expected the failing extension named, got %v", err)
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// gatedFeature is an experimental capability operators can roll out
+// gradually. gate adjusts or refuses a tool call for a client the feature
+// is off for; features checked elsewhere have none.
+type gatedFeature struct {
+	description string
+	gate        func(tool string, arguments map[string]interface{}) (map[string]interface{}, error)
+}
+
+var gatedFeatures = map[string]gatedFeature{
+	"consensus": {
+		description: "get_second_opinion's synthesized consensus and merged modes; without it every answer is returned",
+		gate: func(tool string, arguments map[string]interface{}) (map[string]interface{}, error) {
+			if tool != "get_second_opinion" {
+				return arguments, nil
+			}
+			if mode, _ := arguments["mode"].(string); mode == "all" {
+				return arguments, nil
+			}
+			arguments = maps.Clone(arguments)
+			arguments["mode"] = "all"
+			return arguments, nil
+		},
+	},
+	"web_context": {
+		description: "fetching the web pages named by the urls argument",
+		gate: func(tool string, arguments map[string]interface{}) (map[string]interface{}, error) {
+			if len(stringListArgument(arguments, "urls")) > 0 {
+				return nil, fmt.Errorf("fetching web pages is not enabled for this client")
+			}
+			return arguments, nil
+		},
+	},
+	"streaming": {
+		description: "streaming answers as progress notifications while they are written",
+	},
+}
+
+// FeatureRule says who a feature is on for: everyone when Enabled, and
+// otherwise the named clients plus Percent of the rest, chosen by a hash
+// of the client's name so each client sees the same behavior every time.
+type FeatureRule struct {
+	Enabled bool     `json:"enabled"`
+	Clients []string `json:"clients,omitempty"`
+	Percent int      `json:"percent,omitempty"`
+}
+
+// FeatureFlags gate experimental capabilities per deployment and per
+// client. Features without a rule are on, as they were before flags.
+// Rules come from a JSON file and can be changed at runtime through the
+// admin API; changes are written back to the file when one is set.
+type FeatureFlags struct {
+	mu         sync.RWMutex
+	rules      map[string]FeatureRule
+	path       string
+	adminToken string
+}
+
+// NewFeatureFlags checks rules name known features.
+func NewFeatureFlags(rules map[string]FeatureRule) (*FeatureFlags, error) {
+	for name, rule := range rules {
+		if err := validateFeatureRule(name, rule); err != nil {
+			return nil, err
+		}
+	}
+	if rules == nil {
+		rules = make(map[string]FeatureRule)
+	}
+	return &FeatureFlags{rules: rules}, nil
+}
+
+// LoadFeatureFlags reads rules from a JSON object of feature name to rule.
+func LoadFeatureFlags(path string) (*FeatureFlags, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules map[string]FeatureRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("couldn't parse %s: %w", path, err)
+	}
+	return NewFeatureFlags(rules)
+}
+
+func validateFeatureRule(name string, rule FeatureRule) error {
+	if _, ok := gatedFeatures[name]; !ok {
+		return fmt.Errorf("unknown feature %q (want %s)", name, strings.Join(featureNames(), ", "))
+	}
+	if rule.Percent < 0 || rule.Percent > 100 {
+		return fmt.Errorf("feature %s: percent must be between 0 and 100, got %d", name, rule.Percent)
+	}
+	return nil
+}
+
+func featureNames() []string {
+	names := make([]string, 0, len(gatedFeatures))
+	for name := range gatedFeatures {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// WithFile writes rules changed through the admin API back to path.
+func (f *FeatureFlags) WithFile(path string) *FeatureFlags {
+	f.path = path
+	return f
+}
+
+// WithAdminToken enables the admin API for callers presenting token.
+func (f *FeatureFlags) WithAdminToken(token string) *FeatureFlags {
+	f.adminToken = token
+	return f
+}
+
+// Enabled reports whether feature is on for client. A nil FeatureFlags has
+// everything on.
+func (f *FeatureFlags) Enabled(feature, client string) bool {
+	if f == nil {
+		return true
+	}
+	f.mu.RLock()
+	rule, ok := f.rules[feature]
+	f.mu.RUnlock()
+	switch {
+	case !ok, rule.Enabled, slices.Contains(rule.Clients, client):
+		return true
+	case rule.Percent > 0:
+		h := fnv.New32a()
+		h.Write([]byte(feature + "\x00" + client))
+		return int(h.Sum32()%100) < rule.Percent
+	}
+	return false
+}
+
+// Rules returns a copy of the current rules.
+func (f *FeatureFlags) Rules() map[string]FeatureRule {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return maps.Clone(f.rules)
+}
+
+// Set replaces a feature's rule.
+func (f *FeatureFlags) Set(name string, rule FeatureRule) error {
+	if err := validateFeatureRule(name, rule); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rules[name] = rule
+	return f.save()
+}
+
+// Delete removes a feature's rule, turning it on for everyone.
+func (f *FeatureFlags) Delete(name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.rules, name)
+	return f.save()
+}
+
+// save writes the rules to the file, if any. The caller holds f.mu.
+func (f *FeatureFlags) save() error {
+	if f.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(f.rules, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(f.path, append(data, '\n'), 0644)
+}
+
+// Handler serves the admin API:
+//
+//	GET    /features        lists the features, their rules and descriptions
+//	PUT    /features/{name} sets a feature's rule from a JSON body
+//	DELETE /features/{name} removes a feature's rule, turning it on for everyone
+func (f *FeatureFlags) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /features", adminOnly(f.adminToken, func(w http.ResponseWriter, r *http.Request) {
+		rules := f.Rules()
+		type listed struct {
+			Description string       `json:"description"`
+			Rule        *FeatureRule `json:"rule,omitempty"`
+		}
+		features := make(map[string]listed)
+		for name, feature := range gatedFeatures {
+			entry := listed{Description: feature.description}
+			if rule, ok := rules[name]; ok {
+				entry.Rule = &rule
+			}
+			features[name] = entry
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(features)
+	}))
+	mux.HandleFunc("PUT /features/{name}", adminOnly(f.adminToken, func(w http.ResponseWriter, r *http.Request) {
+		var rule FeatureRule
+		if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+			http.Error(w, "invalid rule: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := f.Set(r.PathValue("name"), rule); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		slog.Info("Feature rule set", "feature", r.PathValue("name"), "enabled", rule.Enabled, "clients", rule.Clients, "percent", rule.Percent)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	mux.HandleFunc("DELETE /features/{name}", adminOnly(f.adminToken, func(w http.ResponseWriter, r *http.Request) {
+		if err := f.Delete(r.PathValue("name")); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		slog.Info("Feature rule removed", "feature", r.PathValue("name"))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	return mux
+}
+
+// gateFeatures applies the features that are off for client to a tool
+// call, adjusting its arguments or refusing it.
+func (s *MCPServer) gateFeatures(client, toolName string, arguments map[string]interface{}) (map[string]interface{}, []map[string]interface{}, error) {
+	if s.features == nil {
+		return arguments, nil, nil
+	}
+	for _, name := range featureNames() {
+		feature := gatedFeatures[name]
+		if feature.gate == nil || s.features.Enabled(name, client) {
+			continue
+		}
+		var err error
+		if arguments, err = feature.gate(toolName, arguments); err != nil {
+			slog.Warn("Refusing call behind a disabled feature", "tool", toolName, "client", client, "feature", name, "error", err)
+			return nil, textContent("Error: " + capitalize(err.Error())), err
+		}
+	}
+	return arguments, nil, nil
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// modeTool stands in for get_second_opinion, recording the modes asked for.
+type modeTool struct {
+	modes []interface{}
+}
+
+func (m *modeTool) Name() string                   { return "get_second_opinion" }
+func (m *modeTool) Description() string            { return "Records modes" }
+func (m *modeTool) Schema() map[string]interface{} { return map[string]interface{}{"type": "object"} }
+
+func (m *modeTool) Call(arguments map[string]interface{}) ([]map[string]interface{}, error) {
+	m.modes = append(m.modes, arguments["mode"])
+	return textContent("opinions"), nil
+}
+
+func TestLoadFeatureFlags_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	for _, rules := range []string{
+		`{"time_travel": {"enabled": true}}`,
+		`{"consensus": {"percent": 101}}`,
+		`[]`,
+	} {
+		path := filepath.Join(dir, "features.json")
+		os.WriteFile(path, []byte(rules), 0644)
+		if _, err := LoadFeatureFlags(path); err == nil {
+			t.Errorf("Expected an error for %s", rules)
+		}
+	}
+}
+
+func TestFeatureFlags_Enabled(t *testing.T) {
+	features, err := NewFeatureFlags(map[string]FeatureRule{
+		"consensus":   {Clients: []string{"claude-code"}},
+		"streaming":   {Enabled: true},
+		"web_context": {Percent: 50},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !features.Enabled("consensus", "claude-code") || features.Enabled("consensus", "cursor") {
+		t.Error("Expected consensus only for the named client")
+	}
+	if !features.Enabled("streaming", "cursor") {
+		t.Error("Expected an enabled feature to be on for everyone")
+	}
+	if !(*FeatureFlags)(nil).Enabled("consensus", "cursor") {
+		t.Error("Expected everything on without flags")
+	}
+
+	on := 0
+	for i := 0; i < 1000; i++ {
+		client := "agent-" + strings.Repeat("x", i%7) + string(rune('a'+i%26)) + string(rune('a'+i/26))
+		if features.Enabled("web_context", client) != features.Enabled("web_context", client) {
+			t.Fatalf("Expected %s to get the same answer every time", client)
+		}
+		if features.Enabled("web_context", client) {
+			on++
+		}
+	}
+	if on < 400 || on > 600 {
+		t.Errorf("Expected about half the clients to get a 50%% feature, got %d of 1000", on)
+	}
+
+	features.Delete("consensus")
+	if !features.Enabled("consensus", "cursor") {
+		t.Error("Expected a feature without a rule to be on")
+	}
+}
+
+func TestMCPServer_HandleToolsCall_Features(t *testing.T) {
+	features, _ := NewFeatureFlags(map[string]FeatureRule{
+		"consensus":   {Clients: []string{"early-adopter"}},
+		"streaming":   {},
+		"web_context": {},
+	})
+	opinions := &modeTool{}
+	server := NewMCPServer("test", "1.0.0").WithFeatures(features)
+	server.RegisterTool(&fakeStreamingTool{chunks: []string{"a", "b"}})
+	server.RegisterTool(opinions)
+	var notifications int
+	server.notify = func(method string, params interface{}) { notifications++ }
+	server.recordClientCapabilities(json.RawMessage(`{"capabilities":{},"clientInfo":{"name":"cursor"}}`))
+
+	server.HandleToolsCall(json.RawMessage(`{"name":"get_second_opinion","arguments":{"question":"q","mode":"merged"}}`))
+	if result, _ := server.HandleToolsCall(json.RawMessage(`{"name":"fake_stream","arguments":{},"_meta":{"progressToken":"tok"}}`)); contentText(result.Content) != "ab" {
+		t.Errorf("Expected the whole answer, got %+v", result)
+	}
+	if notifications != 0 {
+		t.Errorf("Expected no progress notifications with streaming off, got %d", notifications)
+	}
+	if result, _ := server.HandleToolsCall(json.RawMessage(`{"name":"fake_stream","arguments":{"urls":["https://example.com"]}}`)); !result.IsError {
+		t.Errorf("Expected urls to be refused with web_context off, got %+v", result)
+	}
+
+	server.recordClientCapabilities(json.RawMessage(`{"capabilities":{},"clientInfo":{"name":"early-adopter"}}`))
+	server.HandleToolsCall(json.RawMessage(`{"name":"get_second_opinion","arguments":{"question":"q","mode":"merged"}}`))
+	if modes := opinions.modes; len(modes) != 2 || modes[0] != "all" || modes[1] != "merged" {
+		t.Errorf("Expected consensus only for the early adopter, got modes %v", modes)
+	}
+}
+
+func TestFeatureFlags_AdminAPI(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "features.json")
+	os.WriteFile(path, []byte(`{"consensus": {"enabled": false}}`), 0644)
+	features, err := LoadFeatureFlags(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(features.WithFile(path).WithAdminToken("admin-token").Handler())
+	defer srv.Close()
+
+	do := func(method, path, token, body string) *http.Response {
+		req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	if resp := do("PUT", "/features/consensus", "wrong", `{"enabled": true}`); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected a wrong token to be refused, got %s", resp.Status)
+	}
+	if resp := do("PUT", "/features/time_travel", "admin-token", `{"enabled": true}`); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected an unknown feature to be refused, got %s", resp.Status)
+	}
+	if resp := do("PUT", "/features/consensus", "admin-token", `{"clients": ["cursor"]}`); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Expected the rule to be set, got %s", resp.Status)
+	}
+	if !features.Enabled("consensus", "cursor") || features.Enabled("consensus", "zed") {
+		t.Error("Expected the new rule to take effect")
+	}
+	saved, err := LoadFeatureFlags(path)
+	if err != nil || !saved.Enabled("consensus", "cursor") {
+		t.Errorf("Expected the rule to be saved to the file, got %v", err)
+	}
+
+	var listed map[string]struct {
+		Description string       `json:"description"`
+		Rule        *FeatureRule `json:"rule"`
+	}
+	json.NewDecoder(do("GET", "/features", "admin-token", "").Body).Decode(&listed)
+	if listed["consensus"].Rule == nil || listed["streaming"].Rule != nil || listed["streaming"].Description == "" {
+		t.Errorf("Expected every feature with its rule, got %+v", listed)
+	}
+
+	if resp := do("DELETE", "/features/consensus", "admin-token", ""); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Expected the rule to be removed, got %s", resp.Status)
+	}
+	if !features.Enabled("consensus", "zed") {
+		t.Error("Expected the feature to be on for everyone without a rule")
+	}
+}
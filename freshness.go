@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultFreshness applies when an answer references no local files or
+	// their change rate is unknown.
+	defaultFreshness = 7 * 24 * time.Hour
+	minFreshness     = time.Hour
+	maxFreshness     = 30 * 24 * time.Hour
+
+	// churnWindow is how far back commits to referenced files are counted.
+	churnWindow = 30 * 24 * time.Hour
+)
+
+// referencedFiles returns the local paths of the file:// resources an
+// escalation referenced.
+func referencedFiles(arguments map[string]interface{}) []string {
+	var files []string
+	for _, uri := range stringListArgument(arguments, "resource_uris") {
+		u, err := url.Parse(uri)
+		if err != nil || u.Scheme != "file" || u.Path == "" {
+			continue
+		}
+		files = append(files, u.Path)
+	}
+	return files
+}
+
+// codeChurn counts the commits in the last churnWindow that touched any of
+// files, reporting false when git history isn't available for them.
+func codeChurn(ctx context.Context, files []string) (int, bool) {
+	commits := make(map[string]bool)
+	known := false
+	for _, file := range files {
+		cmd := exec.CommandContext(ctx, "git", "-C", filepath.Dir(file), "log",
+			fmt.Sprintf("--since=%d.seconds.ago", int(churnWindow.Seconds())), "--format=%H", "--", filepath.Base(file))
+		out, err := cmd.Output()
+		if err != nil {
+			continue
+		}
+		known = true
+		for _, hash := range strings.Fields(string(out)) {
+			commits[hash] = true
+		}
+	}
+	return len(commits), known
+}
+
+// answerFreshness estimates how long an answer stays trustworthy from how
+// often the code it references changes: an answer about files untouched for
+// a month keeps for the maximum, and each recent commit shortens it.
+func answerFreshness(arguments map[string]interface{}) time.Duration {
+	return freshnessFor(referencedFiles(arguments))
+}
+
+// freshnessFor is answerFreshness for a list of local files.
+func freshnessFor(files []string) time.Duration {
+	if len(files) == 0 {
+		return defaultFreshness
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	commits, ok := codeChurn(ctx, files)
+	if !ok {
+		return defaultFreshness
+	}
+
+	freshness := maxFreshness / time.Duration(1+commits)
+	return min(max(freshness, minFreshness), maxFreshness)
+}
+
+// staleNotice is appended to an answer served after its freshness window.
+// With an escalation ID it points at reask_escalation; otherwise at asking
+// again with fresh.
+func staleNotice(answeredAt time.Time, escalationID string) string {
+	notice := fmt.Sprintf("\n\n---\n_This answer is from %s and the code it refers to has probably changed since._ ", answeredAt.Local().Format("2006-01-02 15:04"))
+	if escalationID != "" {
+		return notice + fmt.Sprintf("_To re-ask with fresh context, call `reask_escalation` with `{\"id\": %q}`._", escalationID)
+	}
+	return notice + "_To re-ask with fresh context, call `get_help` again with `\"fresh\": true`._"
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReferencedFiles(t *testing.T) {
+	files := referencedFiles(map[string]interface{}{
+		"resource_uris": []interface{}{"file:///repo/store/stock.go", "editor://selection/1", "file:///repo/jobs/reconcile.go"},
+	})
+	if strings.Join(files, ",") != "/repo/store/stock.go,/repo/jobs/reconcile.go" {
+		t.Errorf("Expected only local file paths, got %v", files)
+	}
+}
+
+func TestAnswerFreshness_Churn(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	dir := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	git("init", "-q")
+
+	hot := filepath.Join(dir, "hot.go")
+	cold := filepath.Join(dir, "cold.go")
+	os.WriteFile(cold, []byte("package cold\n"), 0644)
+	for i := 0; i < 4; i++ {
+		os.WriteFile(hot, []byte(strings.Repeat("// change\n", i+1)), 0644)
+		git("add", ".")
+		git("commit", "-q", "-m", "change")
+	}
+
+	hotFreshness := answerFreshness(map[string]interface{}{"resource_uris": []interface{}{"file://" + hot}})
+	if hotFreshness != maxFreshness/5 {
+		t.Errorf("Expected 4 recent commits to cut freshness to %v, got %v", maxFreshness/5, hotFreshness)
+	}
+	coldFreshness := answerFreshness(map[string]interface{}{"resource_uris": []interface{}{"file://" + cold}})
+	if coldFreshness != maxFreshness/2 {
+		t.Errorf("Expected 1 commit to give %v, got %v", maxFreshness/2, coldFreshness)
+	}
+
+	if got := answerFreshness(map[string]interface{}{"resource_uris": []interface{}{"file:///nonexistent/dir/x.go"}}); got != defaultFreshness {
+		t.Errorf("Expected default freshness without git history, got %v", got)
+	}
+	if got := answerFreshness(map[string]interface{}{}); got != defaultFreshness {
+		t.Errorf("Expected default freshness without referenced files, got %v", got)
+	}
+}
+
+func TestGetHelpTool_Call_StaleCachedAnswer(t *testing.T) {
+	srv := newFakeOpenAI(t, func(model string) string { return "answer" })
+	store := openTestHistory(t)
+	cache := NewResponseCache(10, 365*24*time.Hour)
+	tool := NewGetHelpTool("", "o3").
+		WithClientOptions(ClientOptions{BaseURL: srv.URL}).
+		WithCache(cache).
+		WithHistory(store)
+	args := map[string]interface{}{"question": "q", "summary": "s"}
+
+	if _, err := tool.Call(args); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	content, _ := tool.Call(args)
+	if text := content[0]["text"].(string); text != "answer" {
+		t.Errorf("Expected a fresh cached answer without notice, got %q", text)
+	}
+
+	// Pretend the answer is older than its freshness window.
+	entry := cache.order.Front().Value.(*cacheEntry)
+	entry.answer.StaleAt = time.Now().Add(-time.Minute)
+	cached := entry.answer
+
+	content, _ = tool.Call(args)
+	text := content[0]["text"].(string)
+	if !strings.HasPrefix(text, "answer") || !strings.Contains(text, "reask_escalation") || !strings.Contains(text, cached.EscalationID) {
+		t.Errorf("Expected a re-ask suggestion, got %q", text)
+	}
+}
+
+func TestReaskEscalationTool_Call(t *testing.T) {
+	calls := 0
+	srv := newFakeOpenAI(t, func(model string) string {
+		calls++
+		return "answer"
+	})
+	store := openTestHistory(t)
+	help := NewGetHelpTool("", "o3").
+		WithClientOptions(ClientOptions{BaseURL: srv.URL}).
+		WithCache(NewResponseCache(10, time.Hour)).
+		WithHistory(store)
+	help.Call(map[string]interface{}{"question": "q", "summary": "s"})
+
+	records, _ := store.All()
+	if len(records) != 1 || records[0].Arguments["question"] != "q" {
+		t.Fatalf("Expected the arguments to be recorded, got %+v", records)
+	}
+
+	tool := NewReaskEscalationTool(store, help)
+	if _, err := tool.Call(map[string]interface{}{"id": records[0].ID}); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("Expected re-asking to bypass the cache, got %d calls", calls)
+	}
+
+	if _, err := tool.Call(map[string]interface{}{"id": "missing"}); err == nil {
+		t.Error("Expected error for unknown ID")
+	}
+	imported := store.Record(EscalationRecord{Tool: "get_help", Question: "q"}, "p", &Completion{Answer: "a", Model: "o3"}, time.Second)
+	if _, err := tool.Call(map[string]interface{}{"id": imported}); err == nil {
+		t.Error("Expected error for an escalation without stored arguments")
+	}
+}
+
+func TestListEscalationsTool_StaleNotice(t *testing.T) {
+	store := openTestHistory(t)
+	id := store.Record(EscalationRecord{
+		Tool:      "get_help",
+		Question:  "q",
+		Arguments: map[string]interface{}{"question": "q", "summary": "s"},
+		StaleAt:   time.Now().Add(-time.Hour),
+	}, "p", &Completion{Answer: "a", Model: "o3"}, time.Second)
+
+	content, err := NewListEscalationsTool(store).Call(map[string]interface{}{"id": id})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if text := content[0]["text"].(string); !strings.Contains(text, `reask_escalation`) {
+		t.Errorf("Expected a re-ask suggestion for a stale answer, got %q", text)
+	}
+
+	content, _ = NewListEscalationsTool(store).Call(map[string]interface{}{})
+	if text := content[0]["text"].(string); !strings.Contains(text, "[stale]") {
+		t.Errorf("Expected stale answers to be marked in listings, got %q", text)
+	}
+}
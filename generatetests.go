@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// testFocuses are the coverage focuses generate_tests accepts.
+var testFocuses = map[string]string{
+	"happy_path":  "the main behaviour with typical inputs",
+	"edge_cases":  "boundaries and unusual inputs: empty, zero, nil, maximum and minimum values, Unicode",
+	"errors":      "every error path: invalid input, failing dependencies, and the errors returned",
+	"concurrency": "concurrent use: run under the race detector where the language has one, and check invariants under contention",
+}
+
+// testLanguages maps file extensions to languages and their usual test
+// framework.
+var testLanguages = map[string]struct {
+	language, framework string
+}{
+	".go":   {"Go", "the standard testing package, with table-driven tests"},
+	".py":   {"Python", "pytest, with parametrized tests"},
+	".js":   {"JavaScript", "Jest, with test.each tables"},
+	".jsx":  {"JavaScript", "Jest, with test.each tables"},
+	".ts":   {"TypeScript", "Jest, with test.each tables"},
+	".tsx":  {"TypeScript", "Jest, with test.each tables"},
+	".rs":   {"Rust", "the built-in #[test] harness"},
+	".java": {"Java", "JUnit 5, with parameterized tests"},
+	".kt":   {"Kotlin", "JUnit 5, with parameterized tests"},
+	".rb":   {"Ruby", "RSpec"},
+	".cs":   {"C#", "xUnit, with theories"},
+}
+
+// snippetLanguages recognise a pasted snippet's language, in order.
+var snippetLanguages = []struct {
+	pattern *regexp.Regexp
+	ext     string
+}{
+	{regexp.MustCompile(`(?m)^package \w+\s*$|^func [\w(]|:= `), ".go"},
+	{regexp.MustCompile(`(?m)^\s*(?:pub )?fn \w+|^use \w+::|^impl\b`), ".rs"},
+	{regexp.MustCompile(`(?m)^\s*def \w+\(.*\)\s*(?:->.*)?:\s*$|^from \w+ import |^import \w+\s*$`), ".py"},
+	{regexp.MustCompile(`(?m)^\s*(?:public|private|protected) (?:static )?[\w<>\[\]]+ \w+\(`), ".java"},
+	{regexp.MustCompile(`(?m):\s*(?:string|number|boolean)\b|^\s*(?:export )?interface \w+|^\s*type \w+ = `), ".ts"},
+	{regexp.MustCompile(`(?m)\bfunction\b|=>|^\s*(?:const|let) \w+ =|require\(`), ".js"},
+	{regexp.MustCompile(`(?m)^\s*def \w+[^:]*$|^\s*end\s*$`), ".rb"},
+}
+
+// GenerateTestsTool writes tests for a code snippet or a repository file:
+// table-driven tests with the standard testing package for Go, and the
+// usual framework for other languages.
+type GenerateTestsTool struct {
+	llm  *LLM
+	repo *Repository
+}
+
+func NewGenerateTestsTool(llm *LLM) *GenerateTestsTool {
+	return &GenerateTestsTool{llm: llm}
+}
+
+// WithRepository lets callers name the file to test with the path
+// argument instead of pasting it.
+func (t *GenerateTestsTool) WithRepository(repo *Repository) *GenerateTestsTool {
+	t.repo = repo
+	return t
+}
+
+func (t *GenerateTestsTool) Name() string {
+	return "generate_tests"
+}
+
+func (t *GenerateTestsTool) Category() string {
+	return "code/tests"
+}
+
+func (t *GenerateTestsTool) Description() string {
+	return "Write tests for a code snippet or repository file: table-driven tests for Go, or tests in the code's language and framework"
+}
+
+func (t *GenerateTestsTool) Schema() map[string]interface{} {
+	properties := map[string]interface{}{
+		"code": map[string]interface{}{
+			"type":        "string",
+			"description": "The code to test: a function, a type and its methods, or a whole file",
+		},
+		"language": map[string]interface{}{
+			"type":        "string",
+			"description": "The code's language, e.g. \"Go\" or \"Python\" (optional; detected from the path or code)",
+		},
+		"framework": map[string]interface{}{
+			"type":        "string",
+			"description": "Test framework or style to use, e.g. \"testify\", \"pytest\", \"vitest\" (optional; the language's usual one by default)",
+		},
+		"focus": map[string]interface{}{
+			"type":        "array",
+			"items":       map[string]interface{}{"type": "string", "enum": []string{"happy_path", "edge_cases", "errors", "concurrency"}},
+			"description": "What the tests should concentrate on (optional; all of them by default)",
+		},
+		"context": map[string]interface{}{
+			"type":        "string",
+			"description": "What the code is for and anything the tests must respect, such as helpers to reuse or behaviour that is intended (optional)",
+		},
+	}
+	required := []string{"code"}
+	if t.repo != nil {
+		properties["path"] = map[string]interface{}{
+			"type":        "string",
+			"description": "Repository file to test, relative to the repository root, read by the server instead of pasted into code; its existing tests are included too",
+		}
+		properties["code"].(map[string]interface{})["description"] = "The code to test: a function, a type and its methods, or a whole file (or give path)"
+		required = nil
+	}
+	schema := map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+	if required != nil {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func (t *GenerateTestsTool) Call(arguments map[string]interface{}) ([]map[string]interface{}, error) {
+	return t.CallContext(context.Background(), arguments, nil)
+}
+
+// CallContext behaves like Call, with the model calls made under ctx, so
+// they join its trace and are logged with its caller.
+func (t *GenerateTestsTool) CallContext(ctx context.Context, arguments map[string]interface{}, _ func(string)) ([]map[string]interface{}, error) {
+	code, _ := arguments["code"].(string)
+	file, _ := arguments["path"].(string)
+	language, _ := arguments["language"].(string)
+	framework, _ := arguments["framework"].(string)
+	extra, _ := arguments["context"].(string)
+
+	if strings.TrimSpace(code) == "" && file == "" {
+		return textContent("Error: Missing required field: code or path"), fmt.Errorf("missing required fields")
+	}
+	focus := stringListArgument(arguments, "focus")
+	for _, f := range focus {
+		if _, ok := testFocuses[f]; !ok {
+			return textContent(fmt.Sprintf("Error: Unknown focus %q", f)), fmt.Errorf("unknown focus %q", f)
+		}
+	}
+
+	var existing string
+	if file != "" {
+		if t.repo == nil {
+			return textContent("Error: Reading repository files is not configured (start the server with -repo)"), fmt.Errorf("no repository")
+		}
+		text, tests, err := t.readSource(file)
+		if err != nil {
+			return textContent("Error: " + err.Error()), err
+		}
+		if strings.TrimSpace(code) == "" {
+			code = text
+		}
+		existing = tests
+	}
+
+	detected, defaultFramework := detectTestLanguage(file, code)
+	if language == "" {
+		language = detected
+	}
+	if framework == "" && strings.EqualFold(language, detected) {
+		framework = defaultFramework
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Minute)
+	defer cancel()
+
+	completion, err := t.llm.Generate(ctx, openai.ChatCompletionRequest{
+		Messages: []openai.ChatCompletionMessage{
+			{
+				Role:    openai.ChatMessageRoleUser,
+				Content: buildGenerateTestsPrompt(code, file, existing, language, framework, extra, focus),
+			},
+		},
+	}, nil)
+	if err != nil {
+		slog.ErrorContext(ctx, "Test generation failed", "tool", "generate_tests", "error", err)
+		return failureContent(err), err
+	}
+
+	usage := usageOf(completion)
+	logUsage(ctx, t.Name(), usage)
+
+	meta := map[string]interface{}{"usage": usage}
+	if language != "" {
+		meta["language"] = language
+	}
+	if testFile := testFileFor(file); testFile != "" {
+		meta["test_file"] = testFile
+	}
+	return withMeta(textContent(completion.Answer), meta), nil
+}
+
+// readSource reads the file to test and, for Go, the tests it already has,
+// so new tests reuse their helpers instead of redeclaring them.
+func (t *GenerateTestsTool) readSource(file string) (string, string, error) {
+	if strings.ContainsAny(file, "*?[") {
+		return "", "", fmt.Errorf("path must name a single file")
+	}
+	files, err := t.repo.Resolve([]string{file})
+	if err != nil {
+		return "", "", err
+	}
+	text, err := t.repo.ReadFile(files[0])
+	if err != nil {
+		return "", "", err
+	}
+	var existing string
+	if testFile := testFileFor(files[0]); testFile != "" && t.repo.readable(testFile) {
+		existing, _ = t.repo.ReadFile(testFile)
+	}
+	return text, existing, nil
+}
+
+// testFileFor is where Go tests for file belong, or "" for other files.
+func testFileFor(file string) string {
+	if path.Ext(file) != ".go" || strings.HasSuffix(file, "_test.go") {
+		return ""
+	}
+	return strings.TrimSuffix(file, ".go") + "_test.go"
+}
+
+// detectTestLanguage names the language of the file, or of the code when
+// there is no file, with its usual test framework. Both are empty when the
+// language isn't recognised.
+func detectTestLanguage(file, code string) (string, string) {
+	if lang, ok := testLanguages[strings.ToLower(path.Ext(file))]; ok {
+		return lang.language, lang.framework
+	}
+	for _, snippet := range snippetLanguages {
+		if snippet.pattern.MatchString(code) {
+			lang := testLanguages[snippet.ext]
+			return lang.language, lang.framework
+		}
+	}
+	return "", ""
+}
+
+func buildGenerateTestsPrompt(code, file, existing, language, framework, extra string, focus []string) string {
+	var b strings.Builder
+
+	b.WriteString("As a senior engineer, write tests for the code below. ")
+	if language != "" {
+		fmt.Fprintf(&b, "It is %s", language)
+		if framework != "" {
+			fmt.Fprintf(&b, "; use %s", framework)
+		}
+		b.WriteString(". ")
+	} else if framework != "" {
+		fmt.Fprintf(&b, "Use %s. ", framework)
+	}
+	if language == "Go" {
+		b.WriteString("Put the cases in a table of structs with a name field and run each with t.Run. Use the code's own package name. ")
+	}
+	b.WriteString("Test behaviour through the public API, not implementation details. Every case must assert something specific; don't write tests that only check that nothing panics.\n\n")
+
+	if len(focus) > 0 {
+		b.WriteString("Concentrate on:\n")
+		for _, f := range focus {
+			fmt.Fprintf(&b, "- %s\n", testFocuses[f])
+		}
+		b.WriteString("\n")
+	} else {
+		b.WriteString("Cover the main behaviour, edge cases and error paths.\n\n")
+	}
+
+	if extra != "" {
+		fmt.Fprintf(&b, "<context>\n%s\n</context>\n\n", extra)
+	}
+	if file != "" {
+		fmt.Fprintf(&b, "**File %s:**\n", file)
+	}
+	fmt.Fprintf(&b, "```\n%s\n```\n", strings.TrimRight(code, "\n"))
+	if existing != "" {
+		fmt.Fprintf(&b, "\nIts existing tests, in %s: reuse their helpers, don't repeat what they cover, and don't redeclare their names.\n```\n%s\n```\n", testFileFor(file), strings.TrimRight(existing, "\n"))
+	}
+
+	b.WriteString("\nReply with the complete test file in one fenced code block, ready to save and run. After it, list in at most three short lines any behaviour you couldn't test and why.")
+	return b.String()
+}
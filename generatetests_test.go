@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestDetectTestLanguage(t *testing.T) {
+	tests := []struct {
+		file, code, want string
+	}{
+		{"internal/store/a.go", "", "Go"},
+		{"app/views.py", "", "Python"},
+		{"", "func Reserve(id int) error {\n\treturn nil\n}", "Go"},
+		{"", "def reserve(item_id):\n    return None", "Python"},
+		{"", "pub fn reserve(id: u32) -> bool {\n    true\n}", "Rust"},
+		{"", "export function reserve(id: number): boolean {\n  return true\n}", "TypeScript"},
+		{"", "const reserve = (id) => id > 0", "JavaScript"},
+		{"", "SELECT * FROM reservations", ""},
+	}
+	for _, tt := range tests {
+		if got, _ := detectTestLanguage(tt.file, tt.code); got != tt.want {
+			t.Errorf("%q %q: expected %q, got %q", tt.file, tt.code, tt.want, got)
+		}
+	}
+}
+
+func TestGenerateTestsTool_Call(t *testing.T) {
+	var prompt string
+	llm := NewLLM("o3").WithProvider(CompletionFunc(func(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error) {
+		prompt = req.Messages[len(req.Messages)-1].Content
+		return &Completion{Answer: "```go\npackage store\n```", Model: req.Model}, nil
+	}))
+	root := writeTree(t, map[string]string{
+		"internal/store/store.go":      "package store\n\nfunc Reserve(n int) error { return nil }\n",
+		"internal/store/store_test.go": "package store\n\nfunc newTestStore() {}\n",
+	})
+	repo, err := OpenRepository(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tool := NewGenerateTestsTool(llm).WithRepository(repo)
+
+	content, err := tool.Call(map[string]interface{}{
+		"path":  "internal/store/store.go",
+		"focus": []interface{}{"edge_cases", "errors"},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if content[0]["text"] != "```go\npackage store\n```" {
+		t.Errorf("Expected the model's tests, got %v", content)
+	}
+	meta := takeMeta(content)
+	if meta["test_file"] != "internal/store/store_test.go" || meta["language"] != "Go" {
+		t.Errorf("Expected the test file and language in _meta, got %v", meta)
+	}
+	for _, want := range []string{
+		"It is Go; use the standard testing package, with table-driven tests",
+		"t.Run",
+		"**File internal/store/store.go:**",
+		"func Reserve(n int) error",
+		"func newTestStore()",
+		"boundaries and unusual inputs",
+		"every error path",
+	} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("Expected the prompt to contain %q, got:\n%s", want, prompt)
+		}
+	}
+	if strings.Contains(prompt, "concurrent use") {
+		t.Error("Expected only the requested focuses")
+	}
+
+	// An explicit framework and language are used as given.
+	tool.Call(map[string]interface{}{"code": "def reserve(n):\n    pass", "language": "Python", "framework": "unittest"})
+	if !strings.Contains(prompt, "It is Python; use unittest.") || strings.Contains(prompt, "pytest") {
+		t.Errorf("Expected the requested framework, got:\n%s", prompt)
+	}
+}
+
+func TestGenerateTestsTool_Call_Invalid(t *testing.T) {
+	tool := NewGenerateTestsTool(NewLLM("o3"))
+	for _, arguments := range []map[string]interface{}{
+		{},
+		{"code": "func f() {}", "focus": []interface{}{"speed"}},
+		{"path": "main.go"},
+	} {
+		if _, err := tool.Call(arguments); err == nil {
+			t.Errorf("Expected an error for %v", arguments)
+		}
+	}
+	if _, ok := tool.Schema()["properties"].(map[string]interface{})["path"]; ok {
+		t.Error("Expected no path argument without a repository")
+	}
+
+	tool.WithRepository(testRepository(t))
+	if _, err := tool.Call(map[string]interface{}{"path": "internal/store/*.go"}); err == nil {
+		t.Error("Expected an error for a glob")
+	}
+	if _, err := tool.Call(map[string]interface{}{"path": "secrets.env"}); err == nil {
+		t.Error("Expected an error for an ignored file")
+	}
+}
@@ -4,8 +4,13 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
+	"maps"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
 	"time"
 
 	"github.com/sashabaranov/go-openai"
@@ -13,26 +18,339 @@ import (
 
 type GetHelpTool struct {
 	summaryPath string
-	modelName   string
+	summaryMu   sync.Mutex
+	summary     *loadedSummary
+	llm         *LLM
+	cascade     *Cascade
+	translator  *Translator
+	compressor  *Compressor
+	repo        *Repository
+	index       *CodeIndex
+	git         *GitContext
+	lsp         *LSPClient
+	verifier    *AnswerVerifier
+	web         *WebSource
+	pulls       *PullRequestFetcher
+	repoTools   *RepoTools
+	sources     []ContextSource
+	sentry      *SentryClient
+	resources   ResourceReader
+	cache       *ResponseCache
+	history     *HistoryStore
+	sessions    *SessionStore
+	drafts      *DraftStore
+	inflight    callGroup
+	experts     *ExpertRouter
+	autoIssues  *GitHubIssues
+
+	// promptMu guards the persona, template and prompt variables, which a
+	// reload may replace while calls are in progress.
+	promptMu   sync.RWMutex
+	persona    *Persona
+	template   *template.Template
+	promptVars map[string]string
+
+	// responseFormat is the default answer format, text or json.
+	responseFormat string
+
+	// promptVariants adapt the prompt to each model's family.
+	promptVariants *PromptVariants
+
+	// requireSummary makes an unreadable summary file fail the call instead
+	// of falling back to the caller-provided summary.
+	requireSummary bool
+
+	// retrieveK is the number of indexed chunks retrieved per question.
+	retrieveK int
+
+	// examples supplies up to exampleK past escalations reported to have
+	// resolved a similar question.
+	examples *HistoryStore
+	exampleK int
+
+	// allowedModels lists the models a caller may select per request with
+	// the model argument. Empty disables per-request overrides.
+	allowedModels []string
+
+	// softLimit and hardLimit bound prompts, in estimated tokens. A prompt
+	// over the soft limit is refused unless the caller passes allow_large,
+	// and nothing beyond the hard limit is sent.
+	softLimit int
+	hardLimit int
+}
+
+// loadedSummary is the summary file as last read.
+type loadedSummary struct {
+	path    string
+	size    int64
+	modTime time.Time
+	text    string
 }
 
 func NewGetHelpTool(summaryPath, modelName string) *GetHelpTool {
 	return &GetHelpTool{
 		summaryPath: summaryPath,
-		modelName:   modelName,
+		llm:         NewLLM(modelName),
+		persona:     &Persona{Name: defaultPersona, Instructions: builtinPersonas[defaultPersona]},
+		template:    defaultPromptTemplate,
+		softLimit:   promptTokenBudget,
+		hardLimit:   defaultHardPromptLimit,
 	}
 }
 
+// WithPromptLimits sets the soft and hard prompt limits in tokens.
+func (t *GetHelpTool) WithPromptLimits(soft, hard int) *GetHelpTool {
+	t.softLimit = soft
+	t.hardLimit = hard
+	return t
+}
+
+// WithClientOptions sets the options used to construct the OpenAI client.
+func (t *GetHelpTool) WithClientOptions(opts ClientOptions) *GetHelpTool {
+	t.llm.WithClientOptions(opts)
+	return t
+}
+
+// WithFallbackModels sets the models tried, in order, when the primary
+// model still fails after retries.
+func (t *GetHelpTool) WithFallbackModels(models []string) *GetHelpTool {
+	t.llm.WithFallbackModels(models)
+	return t
+}
+
+// WithCascade makes the tool try a cheap model first and only escalate to
+// the architect model when the cheap answer is not confident enough.
+func (t *GetHelpTool) WithCascade(cascade *Cascade) *GetHelpTool {
+	t.cascade = cascade
+	return t
+}
+
+// WithTranslator asks non-English questions in English and translates the
+// answers back.
+func (t *GetHelpTool) WithTranslator(translator *Translator) *GetHelpTool {
+	t.translator = translator
+	return t
+}
+
+// WithCompressor condenses context that exceeds the prompt limit with a
+// cheap model instead of trimming it.
+func (t *GetHelpTool) WithCompressor(compressor *Compressor) *GetHelpTool {
+	t.compressor = compressor
+	return t
+}
+
+// WithRepository lets callers name repository files with the files
+// argument; they are read server-side and included in the prompt.
+func (t *GetHelpTool) WithRepository(repo *Repository) *GetHelpTool {
+	t.repo = repo
+	return t
+}
+
+// WithIndex includes the k indexed chunks most relevant to each question
+// in the prompt.
+func (t *GetHelpTool) WithIndex(index *CodeIndex, k int) *GetHelpTool {
+	t.index = index
+	t.retrieveK = k
+	return t
+}
+
+// WithGitContext includes the checkout's branch, uncommitted changes and
+// recent commits in every prompt.
+func (t *GetHelpTool) WithGitContext(git *GitContext) *GetHelpTool {
+	t.git = git
+	return t
+}
+
+// WithLSP looks up the symbols named in each question with a language
+// server and includes their definitions, documentation and references.
+func (t *GetHelpTool) WithLSP(client *LSPClient) *GetHelpTool {
+	t.lsp = client
+	return t
+}
+
+// WithVerifier checks the files and symbols each answer names against
+// the repository.
+func (t *GetHelpTool) WithVerifier(verifier *AnswerVerifier) *GetHelpTool {
+	t.verifier = verifier
+	return t
+}
+
+// WithWebSource lets callers name web pages with the urls argument; they
+// are fetched and included in the prompt.
+func (t *GetHelpTool) WithWebSource(web *WebSource) *GetHelpTool {
+	t.web = web
+	return t
+}
+
+// WithPullRequests lets callers name a GitHub pull request or GitLab merge
+// request whose diff and changed files are fetched into the prompt.
+func (t *GetHelpTool) WithPullRequests(fetcher *PullRequestFetcher) *GetHelpTool {
+	t.pulls = fetcher
+	return t
+}
+
+// WithRepoTools lets the model read, list and search repository files
+// with function calls while answering.
+func (t *GetHelpTool) WithRepoTools(tools *RepoTools) *GetHelpTool {
+	t.repoTools = tools
+	return t
+}
+
+// WithContextSource adds a source of prompt context after the built-in
+// ones.
+func (t *GetHelpTool) WithContextSource(source ContextSource) *GetHelpTool {
+	t.sources = append(t.sources, source)
+	return t
+}
+
+// WithPersona sets the system prompt answers are given with.
+func (t *GetHelpTool) WithPersona(persona *Persona) *GetHelpTool {
+	t.promptMu.Lock()
+	defer t.promptMu.Unlock()
+	t.persona = persona
+	return t
+}
+
+// currentPersona returns the persona answers are given as.
+func (t *GetHelpTool) currentPersona() *Persona {
+	t.promptMu.RLock()
+	defer t.promptMu.RUnlock()
+	return t.persona
+}
+
+// WithPromptTemplate renders prompts with tmpl instead of the built-in
+// template, with vars as the template's metadata.
+func (t *GetHelpTool) WithPromptTemplate(tmpl *template.Template, vars map[string]string) *GetHelpTool {
+	t.promptMu.Lock()
+	defer t.promptMu.Unlock()
+	t.template = tmpl
+	t.promptVars = vars
+	return t
+}
+
+// WithResponseFormat sets the format answers are given in when the caller
+// doesn't choose one: "text" for prose, or "json" for answers constrained
+// to architectAnswerSchema.
+func (t *GetHelpTool) WithResponseFormat(format string) *GetHelpTool {
+	t.responseFormat = format
+	return t
+}
+
+// WithPromptVariants adapts the prompt to the family of each model it is
+// sent to, including fallback and cascade models.
+func (t *GetHelpTool) WithPromptVariants(variants *PromptVariants) *GetHelpTool {
+	t.promptVariants = variants
+	return t
+}
+
+// WithCache enables answering repeated identical escalations from cache.
+func (t *GetHelpTool) WithCache(cache *ResponseCache) *GetHelpTool {
+	t.cache = cache
+	return t
+}
+
+// WithHistory records every answered escalation in the history store.
+func (t *GetHelpTool) WithHistory(history *HistoryStore) *GetHelpTool {
+	t.history = history
+	return t
+}
+
+// WithExamples adds up to k past escalations from history whose answers
+// were reported to have resolved a similar question to each prompt.
+func (t *GetHelpTool) WithExamples(history *HistoryStore, k int) *GetHelpTool {
+	t.examples = history
+	t.exampleK = k
+	return t
+}
+
+// WithSessions enables multi-turn conversations keyed by session_id.
+func (t *GetHelpTool) WithSessions(sessions *SessionStore) *GetHelpTool {
+	t.sessions = sessions
+	return t
+}
+
+// WithDrafts lets callers set draft to review a request before it is sent
+// with send_draft.
+func (t *GetHelpTool) WithDrafts(drafts *DraftStore) *GetHelpTool {
+	t.drafts = drafts
+	return t
+}
+
+// WithExperts forwards escalations on an expert's subject to that expert's
+// MCP server instead of the architect.
+func (t *GetHelpTool) WithExperts(experts *ExpertRouter) *GetHelpTool {
+	t.experts = experts
+	return t
+}
+
+// WithAutoIssues files a GitHub issue for every fresh answer the model
+// rates low confidence, so dead-end escalations become tracked work.
+func (t *GetHelpTool) WithAutoIssues(issues *GitHubIssues) *GetHelpTool {
+	t.autoIssues = issues
+	return t
+}
+
+// WithRequiredSummary controls whether get_help fails when the summary file
+// can't be read, rather than proceeding with the caller's summary.
+func (t *GetHelpTool) WithRequiredSummary(required bool) *GetHelpTool {
+	t.requireSummary = required
+	return t
+}
+
+// WithBudget makes the tool's model calls count against budget.
+func (t *GetHelpTool) WithBudget(budget *Budget) *GetHelpTool {
+	t.llm.WithBudget(budget)
+	return t
+}
+
+// WithAllowedModels sets the models a caller may select per request.
+func (t *GetHelpTool) WithAllowedModels(models []string) *GetHelpTool {
+	t.allowedModels = models
+	return t
+}
+
+// modelAllowed reports whether model may be selected per request.
+func (t *GetHelpTool) modelAllowed(model string) bool {
+	for _, allowed := range t.allowedModels {
+		if allowed == model {
+			return true
+		}
+	}
+	return false
+}
+
+// LLM returns the model backend used by the tool so other tools can share it.
+func (t *GetHelpTool) LLM() *LLM {
+	return t.llm
+}
+
+// WithResourceReader enables pulling client resources referenced by
+// resource_uris into the prompt.
+func (t *GetHelpTool) WithResourceReader(reader ResourceReader) *GetHelpTool {
+	t.resources = reader
+	return t
+}
+
+// WithSentry enables fetching Sentry issue data referenced by sentry_issue_id.
+func (t *GetHelpTool) WithSentry(client *SentryClient) *GetHelpTool {
+	t.sentry = client
+	return t
+}
+
 func (t *GetHelpTool) Name() string {
 	return "get_help"
 }
 
+func (t *GetHelpTool) Category() string {
+	return "escalation"
+}
+
 func (t *GetHelpTool) Description() string {
 	return "Escalate difficult problems to OpenAI for expert guidance"
 }
 
 func (t *GetHelpTool) Schema() map[string]interface{} {
-	return map[string]interface{}{
+	schema := map[string]interface{}{
 		"type": "object",
 		"properties": map[string]interface{}{
 			"question": map[string]interface{}{
@@ -47,14 +365,435 @@ func (t *GetHelpTool) Schema() map[string]interface{} {
 				"type":        "string",
 				"description": "Any relevant code snippets (optional)",
 			},
+			"selection":      editorRangeSchema("The code selected in the editor, which the question is about, e.g. for \"what's wrong with this line?\" (optional; filled in by editor-integrated clients)", false),
+			"cursor_context": editorRangeSchema("The code around the editor's cursor (optional; filled in by editor-integrated clients)", true),
+			"resource_uris": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "URIs of client-side resources (open files, selections) to include instead of pasting them (optional)",
+			},
+			"sentry_issue_id": map[string]interface{}{
+				"type":        "string",
+				"description": "Sentry issue ID whose latest event (stack trace, breadcrumbs, tags) should be included (optional)",
+			},
+			"fresh": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Bypass the response cache and always ask the model (optional)",
+			},
+			"session_id": map[string]interface{}{
+				"type":        "string",
+				"description": "Continue a conversation: earlier questions and answers with the same ID are kept, so follow-ups needn't repeat context (optional)",
+			},
+			"allow_large": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Send a prompt over the soft token limit, up to the hard limit, instead of refusing it (optional; costs more)",
+			},
+			"response_format": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{responseFormatText, responseFormatJSON},
+				"description": "\"json\" answers with a JSON object (diagnosis, fix_plan, risk_level, confidence) instead of prose (optional)",
+			},
 		},
 		"required": []string{"question", "summary"},
 	}
+	if t.repo != nil {
+		schema["properties"].(map[string]interface{})["files"] = map[string]interface{}{
+			"type":        "array",
+			"items":       map[string]interface{}{"type": "string"},
+			"description": "Repository files to include, as paths or globs relative to the repository root (e.g. \"internal/store/*.go\", \"**/handler.go\"); read by the server instead of pasted into relevant_code (optional)",
+		}
+	}
+	if t.web != nil {
+		schema["properties"].(map[string]interface{})["urls"] = map[string]interface{}{
+			"type":        "array",
+			"items":       map[string]interface{}{"type": "string"},
+			"description": "http(s) pages to include, such as library documentation or an issue; fetched by the server (optional)",
+		}
+	}
+	if t.pulls != nil {
+		schema["properties"].(map[string]interface{})["pull_request"] = map[string]interface{}{
+			"type":        "string",
+			"description": "URL of a GitHub pull request or GitLab merge request to review; its diff and changed files are fetched by the server instead of pasted (optional)",
+		}
+	}
+	if t.drafts != nil {
+		schema["properties"].(map[string]interface{})["draft"] = map[string]interface{}{
+			"type":        "boolean",
+			"description": "Return the full request and its estimated cost instead of sending it, to review before sending it unchanged with send_draft (optional)",
+		}
+	}
+	if len(t.allowedModels) > 0 {
+		schema["properties"].(map[string]interface{})["model"] = map[string]interface{}{
+			"type":        "string",
+			"enum":        t.allowedModels,
+			"description": "Model to use for this question instead of the server default (optional)",
+		}
+	}
+	return schema
 }
 
 func (t *GetHelpTool) Call(arguments map[string]interface{}) ([]map[string]interface{}, error) {
+	return t.CallStream(arguments, nil)
+}
+
+// CallStream behaves like Call but streams the answer from OpenAI, passing
+// each partial chunk to onDelta as it arrives. A nil onDelta disables
+// streaming.
+func (t *GetHelpTool) CallStream(arguments map[string]interface{}, onDelta func(string)) ([]map[string]interface{}, error) {
+	return t.CallContext(context.Background(), arguments, onDelta)
+}
+
+// CallContext behaves like CallStream, with the model calls recorded in
+// the trace of ctx.
+func (t *GetHelpTool) CallContext(ctx context.Context, arguments map[string]interface{}, onDelta func(string)) ([]map[string]interface{}, error) {
+	model := t.llm.modelName
+	var override *LLM
+	if requested, ok := arguments["model"].(string); ok && requested != "" {
+		model = requested
+		if !t.modelAllowed(model) {
+			return textContent(fmt.Sprintf("Error: Model %q is not allowed. Allowed models: %s", model, strings.Join(t.allowedModels, ", "))), fmt.Errorf("model %q not allowed", model)
+		}
+		override = t.llm.WithPrimary(model)
+	}
+
+	jsonAnswer, err := t.jsonAnswer(arguments)
+	if err != nil {
+		return textContent("Error: " + capitalize(err.Error())), err
+	}
+
+	draft, _ := arguments["draft"].(bool)
+	if draft && t.drafts == nil {
+		return textContent("Error: Drafts are not supported by this server"), fmt.Errorf("no draft store")
+	}
+
+	sessionID, _ := arguments["session_id"].(string)
+	var prior []openai.ChatCompletionMessage
+	if sessionID != "" {
+		if t.sessions == nil {
+			return textContent("Error: Sessions are not supported by this server"), fmt.Errorf("no session store")
+		}
+		prior = t.sessions.Messages(sessionID)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Minute)
+	defer cancel()
+
+	// Questions on an expert's subject go to the expert, unless the caller
+	// chose a model, wants JSON or is continuing a conversation with the
+	// architect. If the expert fails, the architect answers instead. Drafts
+	// are only ever sent to the architect.
+	if t.experts != nil && override == nil && !jsonAnswer && sessionID == "" && !draft {
+		if content, ok := t.askExpert(ctx, arguments, onDelta); ok {
+			return content, nil
+		}
+	}
+
+	// Non-English questions are asked in English and answered in the
+	// caller's language. The original arguments are kept for history.
+	// Drafts are asked as-is, since translating would call a model.
+	original := arguments
+	var translation *Translation
+	var translationCalls []*Completion
+	if t.translator != nil && !draft {
+		question, _ := arguments["question"].(string)
+		var completion *Completion
+		var err error
+		translation, completion, err = t.translator.ToEnglish(ctx, question)
+		if completion != nil {
+			translationCalls = append(translationCalls, completion)
+		}
+		if err != nil {
+			slog.WarnContext(ctx, "Couldn't translate the question, asking it as-is", "tool", t.Name(), "error", err)
+		}
+		if translation != nil {
+			arguments = maps.Clone(arguments)
+			arguments["question"] = translation.Question
+		}
+	}
+
+	// Follow-ups in a session already carry the project context.
+	var prepared *preparedPrompt
+	var errContent []map[string]interface{}
+	if len(prior) > 0 {
+		prepared, errContent, err = t.prepareFollowUp(ctx, arguments, prior)
+	} else {
+		prepared, errContent, err = t.preparePrompt(ctx, arguments)
+	}
+	if err != nil {
+		return errContent, err
+	}
+	prompt := prepared.Text
+
+	// Answers to follow-ups depend on the conversation, so only a session's
+	// first question is cached. The persona is sent as its own message, so
+	// it goes in the key too, or a reload would keep serving answers given
+	// as the old one; the prompt variant follows from the model.
+	keyModel := model + "\x00" + t.currentPersona().Instructions
+	if translation != nil {
+		keyModel += "\x00" + translation.Language
+	}
+	if jsonAnswer {
+		keyModel += "\x00" + responseFormatJSON
+	}
+	key := cacheKey(keyModel, prompt)
+	if draft {
+		if len(prior) > 0 {
+			key = ""
+		}
+		return t.draft(ctx, override, prior, prepared, jsonAnswer, original, key)
+	}
+	fresh, _ := arguments["fresh"].(bool)
+	if t.cache != nil && !fresh && len(prior) == 0 {
+		if cached, ok := t.cache.Get(key); ok {
+			slog.InfoContext(ctx, "Answering from cache", "tool", t.Name(), "model", model)
+			if sessionID != "" {
+				t.sessions.Append(sessionID, prompt, cached.Answer)
+			}
+			// A notice would break a JSON answer; stale_at still tells.
+			answer := cached.Answer
+			if cached.Stale(time.Now()) && !jsonAnswer {
+				answer += staleNotice(cached.AnsweredAt, cached.EscalationID)
+			}
+			if onDelta != nil {
+				onDelta(answer)
+			}
+			structured := answerStructuredContent(answer, cached.Confidence, jsonAnswer, nil)
+			meta := map[string]interface{}{
+				"usage":    &TokenUsage{Model: model, Cached: true},
+				"stale_at": cached.StaleAt,
+			}
+			if len(prepared.Omitted) > 0 {
+				meta["context_omitted"] = prepared.Omitted
+			}
+			if prepared.Warning != "" {
+				meta["prompt_warning"] = prepared.Warning
+			}
+			if cached.EscalationID != "" {
+				structured["escalation_id"] = cached.EscalationID
+				meta["escalation_id"] = cached.EscalationID
+			}
+			return withMeta(withStructuredContent(textContent(answer), structured), meta), nil
+		}
+	}
+
+	slog.DebugContext(ctx, "Calling the model", "tool", t.Name(), "model", model)
+
+	// Call OpenAI. An explicitly chosen model skips the cascade. A
+	// translated answer is sent once it is translated back, rather than
+	// streamed in English. JSON answers aren't translated.
+	start := time.Now()
+	stream := onDelta
+	if translation != nil && !jsonAnswer {
+		stream = nil
+	}
+	// Identical escalations in flight, such as parallel workers hitting
+	// the same failure, share one call. Follow-ups depend on the session.
+	generate := func() (*Completion, error) {
+		return t.generate(ctx, override, prior, prompt, jsonAnswer, stream)
+	}
+	var completion *Completion
+	shared := false
+	if len(prior) == 0 {
+		completion, shared, err = t.inflight.Do(ctx, key, generate)
+	} else {
+		completion, err = generate()
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Model call failed", "tool", t.Name(), "model", model, "duration_ms", time.Since(start).Milliseconds(), "error", err)
+		return failureContent(err), err
+	}
+
+	if shared {
+		// The tokens were paid for, and are counted, by the call shared.
+		slog.InfoContext(ctx, "Shared the answer of an identical escalation in flight", "tool", t.Name(), "model", completion.Model, "duration_ms", time.Since(start).Milliseconds())
+		copied := *completion
+		copied.PromptTokens, copied.CompletionTokens = 0, 0
+		completion = &copied
+		if stream != nil {
+			stream(completion.Answer)
+		}
+	} else {
+		slog.InfoContext(ctx, "Model call completed", "tool", t.Name(), "model", completion.Model, "duration_ms", time.Since(start).Milliseconds())
+	}
+
+	usage := prepared.contextUsage(completion.Model, completion.PromptTokens)
+	logContextUsage(ctx, completion.Model, usage)
+	tokens := usageOf(completion)
+	tokens.Shared = shared
+
+	// A revision is counted with the other calls; the answer delivered is
+	// the verified one.
+	var unverified *UnverifiedReferences
+	var revision *Completion
+	if t.verifier != nil {
+		completion, unverified, revision = t.verifyAnswer(ctx, override, prior, prompt, jsonAnswer, stream != nil, completion)
+		if stream != nil && unverified != nil && !jsonAnswer {
+			stream(unverified.note())
+		}
+	}
+
+	answer := completion.Answer
+	if translation != nil && !jsonAnswer {
+		translation.Answer = answer
+		back, err := t.translator.FromEnglish(ctx, answer, translation.Language)
+		if err != nil {
+			slog.WarnContext(ctx, "Couldn't translate the answer back, answering in English", "tool", t.Name(), "language", translation.Language, "error", err)
+		} else {
+			translationCalls = append(translationCalls, back)
+			answer = back.Answer
+		}
+		if onDelta != nil {
+			onDelta(answer)
+		}
+	}
+	calls := append(prepared.Calls, translationCalls...)
+	if revision != nil {
+		calls = append(calls, revision)
+	}
+	for _, call := range calls {
+		tokens.add(call)
+	}
+	logUsage(ctx, t.Name(), tokens)
+
+	answeredAt := time.Now()
+	staleAt := answeredAt.Add(freshnessFor(t.referencedPaths(arguments)))
+
+	var escalationID string
+	if t.history != nil {
+		question, _ := original["question"].(string)
+		delivered := *completion
+		delivered.Answer = answer
+		escalationID = t.history.Record(EscalationRecord{
+			Tool:         t.Name(),
+			Question:     question,
+			ContextUsage: usage,
+			Arguments:    reaskArguments(original),
+			StaleAt:      staleAt,
+			Translation:  translation,
+			Assembly:     prepared.Assembly,
+		}, prompt, &delivered, time.Since(start))
+	}
+	if t.cache != nil && len(prior) == 0 {
+		t.cache.Put(key, CachedAnswer{Answer: answer, Confidence: completion.Confidence, EscalationID: escalationID, AnsweredAt: answeredAt, StaleAt: staleAt})
+	}
+	if sessionID != "" {
+		t.sessions.Append(sessionID, prompt, completion.Answer)
+	}
+
+	meta := map[string]interface{}{"context_usage": usage, "usage": tokens, "stale_at": staleAt}
+	if len(prepared.Omitted) > 0 {
+		meta["context_omitted"] = prepared.Omitted
+	}
+	if prepared.Warning != "" {
+		meta["prompt_warning"] = prepared.Warning
+	}
+	if translation != nil {
+		meta["language"] = translation.Language
+	}
+	if unverified != nil {
+		meta["unverified_references"] = unverified
+	}
+	if t.autoIssues != nil && completion.Confidence == "low" {
+		question, _ := original["question"].(string)
+		summary, _ := original["summary"].(string)
+		code, _ := original["relevant_code"].(string)
+		issue, err := t.autoIssues.Create(ctx, issueTitle(question), issueBody(question, summary, code, answer, completion.Confidence, escalationID), []string{"low-confidence"})
+		if err != nil {
+			slog.WarnContext(ctx, "Couldn't file an issue for the low-confidence answer", "tool", t.Name(), "error", err)
+		} else {
+			slog.InfoContext(ctx, "Filed an issue for the low-confidence answer", "tool", t.Name(), "issue", issue.Number)
+			meta["issue"] = issue
+		}
+	}
+	structured := answerStructuredContent(answer, completion.Confidence, jsonAnswer, usage)
+	if escalationID != "" {
+		structured["escalation_id"] = escalationID
+		meta["escalation_id"] = escalationID
+	}
+	content := withStructuredContent([]map[string]interface{}{
+		{
+			"type": "text",
+			"text": answer,
+		},
+	}, structured)
+	return withMeta(content, meta), nil
+}
+
+// askExpert forwards the escalation to the matching expert, if there is
+// one. It reports false when no expert matched or the expert failed, and
+// the architect should answer.
+func (t *GetHelpTool) askExpert(ctx context.Context, arguments map[string]interface{}, onDelta func(string)) ([]map[string]interface{}, bool) {
+	question, _ := arguments["question"].(string)
+	code, _ := arguments["relevant_code"].(string)
+	if strings.TrimSpace(question) == "" {
+		return nil, false
+	}
+	expert, classification, err := t.experts.Classify(ctx, question, code)
+	if err != nil {
+		slog.WarnContext(ctx, "Couldn't classify the question for the experts", "tool", t.Name(), "error", err)
+		return nil, false
+	}
+	if expert == nil {
+		return nil, false
+	}
+
+	slog.InfoContext(ctx, "Forwarding the question to an expert", "tool", t.Name(), "expert", expert.Name)
+	start := time.Now()
+	content, err := t.experts.Ask(ctx, expert, arguments)
+	if err != nil {
+		slog.WarnContext(ctx, "Expert failed, asking the architect instead", "tool", t.Name(), "expert", expert.Name, "error", err)
+		return nil, false
+	}
+
+	var parts []string
+	for _, block := range content {
+		if text, ok := block["text"].(string); ok && block["type"] == "text" {
+			parts = append(parts, text)
+		}
+	}
+	answer := strings.Join(parts, "\n\n")
+	if onDelta != nil {
+		onDelta(answer)
+	}
+
+	meta := map[string]interface{}{"expert": expert.Name}
+	if classification != nil {
+		tokens := usageOf(classification)
+		logUsage(ctx, t.Name(), tokens)
+		meta["usage"] = tokens
+	}
+	structured := answerStructuredContent(answer, "", false, nil)
+	if t.history != nil {
+		escalationID := t.history.Record(EscalationRecord{
+			Tool:      t.Name(),
+			Question:  question,
+			Arguments: reaskArguments(arguments),
+		}, question, &Completion{Model: "expert:" + expert.Name, Answer: answer}, time.Since(start))
+		structured["escalation_id"] = escalationID
+		meta["escalation_id"] = escalationID
+	}
+	return withMeta(withStructuredContent(content, structured), meta), true
+}
+
+// reaskArguments are the arguments kept in history for re-asking: the
+// original request without per-call options.
+func reaskArguments(arguments map[string]interface{}) map[string]interface{} {
+	kept := make(map[string]interface{}, len(arguments))
+	for name, value := range arguments {
+		if name == "fresh" || name == "session_id" || name == "draft" {
+			continue
+		}
+		kept[name] = value
+	}
+	return kept
+}
+
+// preparePrompt validates the get_help arguments, gathers any referenced
+// context and builds the prompt. On failure it also returns the content to
+// send back to the caller.
+func (t *GetHelpTool) preparePrompt(ctx context.Context, arguments map[string]interface{}) (*preparedPrompt, []map[string]interface{}, error) {
 	var question, summary, relevantCode string
-	
+
 	if q, ok := arguments["question"].(string); ok {
 		question = q
 	}
@@ -66,7 +805,7 @@ func (t *GetHelpTool) Call(arguments map[string]interface{}) ([]map[string]inter
 	}
 
 	if question == "" || summary == "" {
-		return []map[string]interface{}{
+		return nil, []map[string]interface{}{
 			{
 				"type": "text",
 				"text": "Error: Missing required fields: question and summary",
@@ -74,11 +813,20 @@ func (t *GetHelpTool) Call(arguments map[string]interface{}) ([]map[string]inter
 		}, fmt.Errorf("missing required fields")
 	}
 
-	// Load project summary
+	// Load project summary, falling back to the caller's summary when the
+	// file is missing unless a summary file is required.
 	projectSummary, err := t.loadSummary()
+	summarySource := t.summaryProvenance()
+	callerSummary := false
+	if err != nil && !t.requireSummary {
+		slog.WarnContext(ctx, "Couldn't load the summary file, using the caller's summary", "tool", t.Name(), "error", err)
+		projectSummary, err = summary, nil
+		summarySource = "SUMMARY (provided by the caller, age unknown)"
+		callerSummary = true
+	}
 	if err != nil {
-		log.Printf("Couldn't load the summary file: %v", err)
-		return []map[string]interface{}{
+		slog.WarnContext(ctx, "Couldn't load the summary file", "tool", t.Name(), "error", err)
+		return nil, []map[string]interface{}{
 			{
 				"type": "text",
 				"text": "The architect is currently unavailable. Please try again later.",
@@ -86,123 +834,359 @@ func (t *GetHelpTool) Call(arguments map[string]interface{}) ([]map[string]inter
 		}, err
 	}
 
+	summarySection := newPromptSection("summary", projectSummary)
+	summarySection.Source = "summary file"
+	summarySection.Provenance = summarySource
+	codeSection := newPromptSection("relevant_code", relevantCode)
+	codeSection.Source = "caller"
+	codeSection.Priority = PriorityNamed
+
+	sections, sources, errContent, err := t.gatherContext(ctx, question, arguments)
+	if err != nil {
+		return nil, errContent, err
+	}
+
+	prepared := &preparedPrompt{Assembly: &PromptAssembly{Sources: sources}}
+
+	// Condense or trim the context rather than fail when it doesn't fit;
+	// only the question has to fit as-is.
+	overview := summarySection
+	code := append([]*promptSection{codeSection}, sections...)
+	data := func() PromptData {
+		source := overview.Provenance
+		if overview.Text == "" {
+			source = ""
+		}
+		return PromptData{
+			Summary:       overview.Text,
+			SummarySource: source,
+			Question:      question,
+			Code:          codeSection.Text,
+			Context:       sectionTexts(sections),
+		}
+	}
+	render := func() string {
+		prompt, _ := t.renderPromptData(data())
+		return prompt
+	}
+	// A prompt over the soft limit needs the caller to allow a large one,
+	// which may then take up to the hard limit. Only the context the
+	// escalator gathered itself, the summary file included, is trimmed to
+	// fit; what the caller sent is sent whole or not at all.
+	allowLarge, _ := arguments["allow_large"].(bool)
+	limit := promptTextBytes(t.softLimit)
+	if allowLarge {
+		limit = promptTextBytes(t.hardLimit)
+	}
+	rendered := len(render())
+	budget := &BudgetDecision{LimitBytes: limit, RenderedBytes: rendered}
+	prepared.Assembly.Budget = budget
+	// Condensing calls a model, so drafts are trimmed instead.
+	draft, _ := arguments["draft"].(bool)
+	if excess := rendered - limit; excess > 0 && t.compressor != nil && !draft {
+		digest, completion := t.compressContext(ctx, question, summarySection, code, excess)
+		if completion != nil {
+			prepared.Calls = append(prepared.Calls, completion)
+		}
+		if digest != nil {
+			overview = digest
+			rendered = len(render())
+		}
+	}
+	if excess := rendered - limit; excess > 0 {
+		gathered := overview
+		if callerSummary {
+			gathered = nil
+		}
+		if left := fitGathered(excess, question, gathered, code); left > 0 {
+			return nil, textContent(t.promptTooLarge(allowLarge, limit+left)), fmt.Errorf("prompt too large")
+		}
+		slog.InfoContext(ctx, "Trimmed the prompt's gathered context to fit", "tool", t.Name(), "excess_tokens", (excess+3)/4)
+		prepared.Warning = fmt.Sprintf("The prompt was ~%d tokens, over the %d token limit, so the context gathered for it (the summary file, retrieved code, git and plugin context) was trimmed to fit.", (rendered+3)/4, (limit+len(confidenceInstruction)+3)/4)
+	} else if allowLarge && rendered > promptTextBytes(t.softLimit) {
+		prepared.Warning = fmt.Sprintf("The prompt is ~%d tokens, over the %d token soft limit, and was sent whole as allow_large asked.", (rendered+3)/4, t.softLimit)
+	}
+
+	prepared.condensed = overview != summarySection
+	budget.Condensed = prepared.condensed
+	prepared.Assembly.recordSummary(summarySection, question)
+	prepared.addContext(summarySection)
+	prepared.addSection("question", question)
+	for _, section := range code {
+		prepared.addContext(section)
+	}
+	if overview != summarySection {
+		prepared.addContext(overview)
+	}
+
 	// Build prompt
-	prompt, err := t.buildPrompt(projectSummary, question, relevantCode)
+	prepared.Text, err = t.buildPromptData(data(), limit)
 	if err != nil {
-		log.Printf("Couldn't build the prompt: %v", err)
-		return []map[string]interface{}{
+		slog.ErrorContext(ctx, "Couldn't build the prompt", "tool", t.Name(), "error", err)
+		return nil, []map[string]interface{}{
 			{
 				"type": "text",
 				"text": "The architect is currently unavailable. Please try again later.",
 			},
 		}, err
 	}
+	budget.FinalBytes = len(prepared.Text)
+
+	return prepared, nil, nil
+}
+
+// promptTooLarge explains a prompt of size bytes that what the caller sent
+// keeps over the limit, and what the caller can do about it.
+func (t *GetHelpTool) promptTooLarge(allowLarge bool, size int) string {
+	tokens := (size + len(confidenceInstruction) + 3) / 4
+	if !allowLarge && tokens <= t.hardLimit {
+		return fmt.Sprintf("Error: The prompt is ~%d tokens, over the %d token soft limit. Pass allow_large=true to send prompts of up to %d tokens, or send less context", tokens, t.softLimit, t.hardLimit)
+	}
+	return fmt.Sprintf("Error: The prompt is ~%d tokens, over the %d token hard limit; send less context or shorten the question", tokens, t.hardLimit)
+}
 
-	log.Println("Ready to call OpenAI")
+// compressContext condenses the context with the compressor, leaving room
+// for the question and template. On success the original sections are
+// emptied, since the digest stands in for them, and the digest is returned
+// as a section to render in place of the summary.
+func (t *GetHelpTool) compressContext(ctx context.Context, question string, summary *promptSection, code []*promptSection, excess int) (*promptSection, *Completion) {
+	size := len(summary.Text)
+	for _, section := range code {
+		size += len(section.Text)
+	}
+	limit := size - excess
 
-	// Call OpenAI
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Minute)
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Minute)
 	defer cancel()
-	answer, err := t.askOpenAI(ctx, prompt)
+	digest, completion, err := t.compressor.Compress(ctx, question, summary, code, limit)
 	if err != nil {
-		log.Printf("OpenAI call failed: %v", err)
-		return []map[string]interface{}{
-			{
-				"type": "text",
-				"text": "The architect is currently unavailable. Please try again later.",
-			},
-		}, err
+		slog.WarnContext(ctx, "Couldn't condense the context, trimming it instead", "tool", t.Name(), "error", err)
+		return nil, completion
 	}
 
-	log.Printf("[%s] OpenAI call completed successfully", time.Now().Format(time.RFC3339))
-	
-	return []map[string]interface{}{
-		{
-			"type": "text",
-			"text": answer,
-		},
-	}, nil
+	summary.Text = ""
+	for _, section := range code {
+		section.Text = ""
+	}
+	section := newPromptSection("digest", digest)
+	section.Source = "compressor"
+	section.Provenance = "DIGEST (the summary and context, condensed just now)"
+	return section, completion
 }
 
-func (t *GetHelpTool) loadSummary() (string, error) {
-	path := t.summaryPath
-	if path == "" {
-		path = "./README.md"
+// SummaryPath returns the summary file the tool reads.
+func (t *GetHelpTool) SummaryPath() string {
+	t.summaryMu.Lock()
+	defer t.summaryMu.Unlock()
+	if t.summaryPath == "" {
+		return "./README.md"
+	}
+	return t.summaryPath
+}
+
+// SetSummaryPath switches the tool to another summary file.
+func (t *GetHelpTool) SetSummaryPath(path string) {
+	t.summaryMu.Lock()
+	defer t.summaryMu.Unlock()
+	t.summaryPath = path
+}
+
+// CheckSummary reports whether the summary file can be read.
+func (t *GetHelpTool) CheckSummary() error {
+	_, err := t.loadSummary()
+	return err
+}
+
+// referencedPaths returns the local paths of every file the escalation
+// referenced, through resource URIs or the files argument.
+func (t *GetHelpTool) referencedPaths(arguments map[string]interface{}) []string {
+	paths := referencedFiles(arguments)
+	if t.repo != nil {
+		files, _ := t.repo.Resolve(stringListArgument(arguments, "files"))
+		for _, file := range files {
+			paths = append(paths, filepath.Join(t.repo.Root(), filepath.FromSlash(file)))
+		}
+	}
+	return paths
+}
+
+// prepareFollowUp builds the prompt for a follow-up question in a session.
+// The project summary was sent with the first question, so only the
+// question, code and referenced context are included, and of those only
+// what isn't already in the conversation: code or context an earlier
+// message still carries is referred to rather than sent again.
+func (t *GetHelpTool) prepareFollowUp(ctx context.Context, arguments map[string]interface{}, prior []openai.ChatCompletionMessage) (*preparedPrompt, []map[string]interface{}, error) {
+	question, _ := arguments["question"].(string)
+	relevantCode, _ := arguments["relevant_code"].(string)
+	if question == "" {
+		return nil, textContent("Error: Missing required field: question"), fmt.Errorf("missing required fields")
+	}
+
+	sections, sources, errContent, err := t.gatherContext(ctx, question, arguments)
+	if err != nil {
+		return nil, errContent, err
+	}
+
+	prepared := &preparedPrompt{Assembly: &PromptAssembly{Sources: sources, FollowUp: true}}
+	prepared.addSection("question", question)
+	if !sentEarlier(prior, relevantCode) {
+		prepared.addSection("relevant_code", relevantCode)
+	}
+
+	prompt := "**Follow-up question:** " + question
+	if relevantCode != "" && sentEarlier(prior, relevantCode) {
+		prompt += "\n\n**Relevant Code:** " + unchangedContext
+	} else if relevantCode != "" {
+		prompt += "\n\n**Relevant Code:** " + relevantCode
 	}
+	for _, section := range sections {
+		if section.Text != "" && sentEarlier(prior, section.Text) {
+			section.Text = unchangedContext
+			section.referenced = true
+		}
+		prepared.addContext(section)
+		prompt += "\n\n" + section.labeledText()
+	}
+	prepared.Text = prompt
+	return prepared, nil, nil
+}
 
-	file, err := os.Open(path)
+// loadSummary reads the summary file, reusing the last read while the
+// file's size and modification time are unchanged.
+func (t *GetHelpTool) loadSummary() (string, error) {
+	file, err := os.Open(t.SummaryPath())
 	if err != nil {
 		return "", err
 	}
 	defer file.Close()
 
+	info, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+	t.summaryMu.Lock()
+	defer t.summaryMu.Unlock()
+	if cached := t.summary; cached != nil && cached.path == file.Name() && cached.size == info.Size() && cached.modTime.Equal(info.ModTime()) {
+		return cached.text, nil
+	}
+
 	content, err := io.ReadAll(file)
 	if err != nil {
 		return "", err
 	}
 
+	t.summary = &loadedSummary{path: file.Name(), size: info.Size(), modTime: info.ModTime(), text: string(content)}
 	return string(content), nil
 }
 
-func (t *GetHelpTool) buildPrompt(summary, question, relevantCode string) (string, error) {
-	template := `As a software architect, provide help with this issue:
-
-<summary>
-%s
-</summary>
-
----
-**Question:** %s
-
-**Relevant Code:** %s`
+// buildPrompt renders the prompt, failing if it exceeds the prompt limit.
+// Callers trim the context with fitContext first.
+func (t *GetHelpTool) buildPrompt(summary, question, relevantCode string, sections ...string) (string, error) {
+	return t.buildPromptData(PromptData{Summary: summary, Question: question, Code: relevantCode, Context: sections}, promptTextBytes(t.softLimit))
+}
 
-	prompt := fmt.Sprintf(template, summary, question, relevantCode)
+// buildPromptData is buildPrompt for labeled prompt data, failing if the
+// prompt is longer than limit bytes.
+func (t *GetHelpTool) buildPromptData(data PromptData, limit int) (string, error) {
+	prompt, err := t.renderPromptData(data)
+	if err != nil {
+		return "", err
+	}
 
 	// Check token limit (rough estimate: ~4 chars per token)
-	if len(prompt) > 80000 { // 20,000 tokens * 4 chars
-		return "", fmt.Errorf("prompt exceeds 20,000 token limit")
+	if len(prompt) > limit {
+		return "", fmt.Errorf("prompt exceeds %s token limit", groupThousands((limit+len(confidenceInstruction))/4))
 	}
 
 	return prompt, nil
 }
 
 func (t *GetHelpTool) askOpenAI(ctx context.Context, prompt string) (string, error) {
-	client := openai.NewClient(os.Getenv("OPENAI_API_KEY"))
-
-	maxRetries := 3
-	backoffDurations := []time.Duration{2 * time.Second, 4 * time.Second, 8 * time.Second}
+	return t.streamOpenAI(ctx, prompt, nil)
+}
 
-	model := t.modelName
-	if model == "" {
-		model = "o3" // default
+// streamOpenAI sends the prompt to OpenAI, streaming the response through
+// onDelta when it is non-nil. With a cascade configured, a confident answer
+// from the cheap model is returned without calling the architect model.
+func (t *GetHelpTool) streamOpenAI(ctx context.Context, prompt string, onDelta func(string)) (string, error) {
+	completion, err := t.generate(ctx, nil, nil, prompt, false, onDelta)
+	if err != nil {
+		return "", err
 	}
+	return completion.Answer, nil
+}
 
-	for attempt := range maxRetries {
-		resp, err := client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
-			Model: model,
-			Messages: []openai.ChatCompletionMessage{
-				{
-					Role:    openai.ChatMessageRoleUser,
-					Content: prompt,
-				},
-			},
-		})
+// generate asks the override backend when the caller chose a model, and
+// otherwise the cascade (if any) followed by the architect model. The
+// persona is the system message, and prior session messages are sent ahead
+// of the prompt; follow-ups skip the cascade. With repository tools the
+// model may read files before it answers. Models are asked to rate their
+// confidence: in prose answers on a final line, which is split off, and in
+// JSON answers as a field of the schema the answer must match.
+func (t *GetHelpTool) generate(ctx context.Context, override *LLM, prior []openai.ChatCompletionMessage, prompt string, jsonAnswer bool, onDelta func(string)) (*Completion, error) {
+	req := t.request(prior, prompt, jsonAnswer)
 
-		if err != nil {
-			// Check if it's a retryable error (429 or 5xx)
-			if attempt < maxRetries-1 {
-				time.Sleep(backoffDurations[attempt])
-				continue
+	llm := t.llm
+	if override != nil {
+		llm = override
+	} else if t.cascade != nil && len(prior) == 0 {
+		cascade := t.cascade
+		if t.promptVariants != nil {
+			c := *cascade
+			c.llm = c.llm.withPromptVariants(t.promptVariants)
+			cascade = &c
+		}
+		if completion, ok := cascade.Try(ctx, req); ok {
+			if onDelta != nil {
+				onDelta(completion.Answer)
 			}
-			return "", err
+			return completion, nil
 		}
+	}
 
-		if len(resp.Choices) == 0 {
-			return "", fmt.Errorf("no response from OpenAI")
-		}
+	llm = llm.withPromptVariants(t.promptVariants)
+
+	stream, flush := onDelta, func() {}
+	if !jsonAnswer {
+		stream, flush = withoutConfidenceLine(onDelta)
+	}
+	var completion *Completion
+	var err error
+	if t.repoTools != nil {
+		completion, err = t.repoTools.Generate(ctx, llm, req, stream)
+	} else {
+		completion, err = llm.Generate(ctx, req, stream)
+	}
+	if err != nil {
+		return nil, err
+	}
+	flush()
+	return readConfidence(completion, jsonAnswer)
+}
 
-		return resp.Choices[0].Message.Content, nil
+// request is the get_help request for prompt: the persona's instructions,
+// prior session messages and the prompt, asking for a confidence rating.
+func (t *GetHelpTool) request(prior []openai.ChatCompletionMessage, prompt string, jsonAnswer bool) openai.ChatCompletionRequest {
+	req := t.currentPersona().promptRequest(prior, prompt)
+	if jsonAnswer {
+		req.ResponseFormat = architectResponseFormat
+		return req
 	}
+	return withConfidenceInstruction(req)
+}
 
-	return "", fmt.Errorf("max retries exceeded")
-}
\ No newline at end of file
+// readConfidence fills in the completion's confidence: split off the last
+// line of a prose answer, or read from a JSON answer, which must match the
+// response schema.
+func readConfidence(completion *Completion, jsonAnswer bool) (*Completion, error) {
+	if !jsonAnswer {
+		completion.Answer, completion.Confidence = splitConfidence(completion.Answer)
+		return completion, nil
+	}
+	answer, err := parseArchitectAnswer(completion.Answer)
+	if err != nil {
+		return nil, fmt.Errorf("%s didn't follow the response schema: %w", completion.Model, err)
+	}
+	completion.Confidence = answer.Confidence
+	return completion, nil
+}
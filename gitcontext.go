@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// GitContext describes the state of a git checkout for the prompt: the
+// branch, uncommitted changes and recent commits. Most escalations are
+// about why the current change doesn't work, which the architect can't
+// see from the summary alone.
+type GitContext struct {
+	dir     string
+	commits int
+}
+
+// NewGitContext reads the checkout containing dir, including the last
+// commits commit messages.
+func NewGitContext(dir string, commits int) *GitContext {
+	return &GitContext{dir: dir, commits: commits}
+}
+
+// Sections returns the git state as prompt sections: "git status" with the
+// branch, changed files and recent commits, and "git diff" with the
+// working tree's changes against HEAD. The diff is a section of its own so
+// trimming a large diff leaves the branch and commits intact.
+func (g *GitContext) Sections(ctx context.Context) ([]*promptSection, error) {
+	branch, err := g.git(ctx, "rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		// A repository without commits has no HEAD yet.
+		if branch, err = g.git(ctx, "symbolic-ref", "--short", "HEAD"); err != nil {
+			return nil, err
+		}
+	}
+	status, err := g.git(ctx, "status", "--short")
+	if err != nil {
+		return nil, err
+	}
+	var log string
+	if g.commits > 0 {
+		// Fails harmlessly when there are no commits yet.
+		log, _ = g.git(ctx, "log", fmt.Sprintf("-%d", g.commits), "--format=%h %s (%an, %ar)")
+	}
+	diff, err := g.git(ctx, "diff", "HEAD")
+	if err != nil {
+		diff, _ = g.git(ctx, "diff", "--cached")
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "**Git branch:** %s\n", branch)
+	if status != "" {
+		fmt.Fprintf(&b, "\n**Changed files:**\n```\n%s\n```\n", status)
+	} else {
+		b.WriteString("\nThe working tree is clean.\n")
+	}
+	if log != "" {
+		fmt.Fprintf(&b, "\n**Recent commits:**\n```\n%s\n```\n", log)
+	}
+	sections := []*promptSection{newPromptSection("git status", strings.TrimRight(b.String(), "\n"))}
+	if diff != "" {
+		sections = append(sections, newPromptSection("git diff", fmt.Sprintf("**Uncommitted changes (git diff HEAD):**\n```diff\n%s\n```", diff)))
+	}
+	return sections, nil
+}
+
+func (g *GitContext) git(ctx context.Context, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", g.dir}, args...)...)
+	out, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			return "", fmt.Errorf("git %s: %s", args[0], strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", err
+	}
+	return strings.TrimRight(string(out), "\n"), nil
+}
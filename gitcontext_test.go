@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// newGitRepo initializes a repository on branch main in a temporary
+// directory and returns it with a function running git there.
+func newGitRepo(t *testing.T) (string, func(args ...string)) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	dir := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	git("init", "-q", "-b", "main")
+	return dir, git
+}
+
+func TestGitContext_Sections(t *testing.T) {
+	dir, git := newGitRepo(t)
+
+	// No commits yet: the branch is still known.
+	sections, err := NewGitContext(dir, 5).Sections(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error in an empty repository, got: %v", err)
+	}
+	if !strings.Contains(sections[0].Text, "**Git branch:** main") {
+		t.Errorf("Expected the branch, got %q", sections[0].Text)
+	}
+
+	os.WriteFile(filepath.Join(dir, "stock.go"), []byte("package stock\n\nfunc Reserve() {}\n"), 0644)
+	git("add", ".")
+	git("commit", "-q", "-m", "Add stock reservation")
+	git("checkout", "-q", "-b", "fix-deadlock")
+	os.WriteFile(filepath.Join(dir, "stock.go"), []byte("package stock\n\nfunc Reserve() { lock() }\n"), 0644)
+
+	sections, err = NewGitContext(dir, 5).Sections(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(sections) != 2 || sections[0].Name != "git status" || sections[1].Name != "git diff" {
+		t.Fatalf("Expected git status and git diff sections, got %+v", sections)
+	}
+	status := sections[0].Text
+	for _, want := range []string{"**Git branch:** fix-deadlock", "M stock.go", "Add stock reservation (test,"} {
+		if !strings.Contains(status, want) {
+			t.Errorf("Expected %q in the status, got %q", want, status)
+		}
+	}
+	if !strings.Contains(sections[1].Text, "+func Reserve() { lock() }") {
+		t.Errorf("Expected the uncommitted change in the diff, got %q", sections[1].Text)
+	}
+
+	if _, err := NewGitContext(t.TempDir(), 5).Sections(context.Background()); err == nil {
+		t.Error("Expected an error outside a git repository")
+	}
+}
+
+func TestGetHelpTool_Call_GitContext(t *testing.T) {
+	dir, git := newGitRepo(t)
+	os.WriteFile(filepath.Join(dir, "stock.go"), []byte("package stock\n"), 0644)
+	git("add", ".")
+	git("commit", "-q", "-m", "Add stock")
+	os.WriteFile(filepath.Join(dir, "stock.go"), []byte("package stock\n\nvar mu sync.Mutex\n"), 0644)
+
+	var prompt string
+	provider := CompletionFunc(func(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error) {
+		prompt = req.Messages[len(req.Messages)-1].Content
+		return &Completion{Answer: "answer", Model: req.Model}, nil
+	})
+	tool := NewGetHelpTool(writeTestSummary(t), "o3").WithGitContext(NewGitContext(dir, 5))
+	tool.LLM().WithProvider(provider)
+
+	content, err := tool.Call(map[string]interface{}{"question": "q", "summary": "s"})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if !strings.Contains(prompt, "**Git branch:** main") || !strings.Contains(prompt, "+var mu sync.Mutex") {
+		t.Errorf("Expected the branch and diff in the prompt, got %q", prompt)
+	}
+	var names []string
+	for _, section := range content[0]["_meta"].(map[string]interface{})["context_usage"].(*ContextUsage).Sections {
+		names = append(names, section.Name)
+	}
+	if !strings.Contains(strings.Join(names, ","), "git status,git diff") {
+		t.Errorf("Expected git sections in the context usage, got %v", names)
+	}
+
+	// Outside a repository the question is asked without git context.
+	outside := NewGetHelpTool("", "o3").WithGitContext(NewGitContext(t.TempDir(), 5))
+	outside.LLM().WithProvider(provider)
+	if _, err := outside.Call(map[string]interface{}{"question": "q", "summary": "s"}); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if strings.Contains(prompt, "Git branch") {
+		t.Errorf("Expected no git context, got %q", prompt)
+	}
+}
@@ -0,0 +1,731 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// EscalationRecord is one escalation as stored in history and exchanged in
+// JSONL exports between escalator instances.
+type EscalationRecord struct {
+	ID               string    `json:"id"`
+	CreatedAt        time.Time `json:"created_at"`
+	Tool             string    `json:"tool"`
+	Question         string    `json:"question"`
+	ContextHash      string    `json:"context_hash,omitempty"`
+	Model            string    `json:"model"`
+	Answer           string    `json:"answer"`
+	LatencyMS        int64     `json:"latency_ms,omitempty"`
+	PromptTokens     int       `json:"prompt_tokens,omitempty"`
+	CompletionTokens int       `json:"completion_tokens,omitempty"`
+	CostUSD          float64   `json:"cost_usd,omitempty"`
+	// ContextUsage records how much of the context window the prompt used.
+	ContextUsage *ContextUsage `json:"context_usage,omitempty"`
+	// Arguments are the tool arguments the escalation was made with, kept
+	// so it can be re-asked with fresh context.
+	Arguments map[string]interface{} `json:"arguments,omitempty"`
+	// StaleAt is when the referenced code has probably changed enough that
+	// the answer should be re-asked.
+	StaleAt time.Time `json:"stale_at,omitzero"`
+	// Translation keeps the English question and answer exchanged with the
+	// model when the question was asked in another language; Question and
+	// Answer are then in the caller's language.
+	Translation *Translation `json:"translation,omitempty"`
+	// Source names the escalator instance the record came from.
+	Source string `json:"source,omitempty"`
+	// Assembly records how the prompt was put together.
+	Assembly *PromptAssembly `json:"assembly,omitempty"`
+}
+
+// HistoryStore keeps escalation records in a local SQLite database.
+type HistoryStore struct {
+	db *sql.DB
+}
+
+const historySchema = `
+CREATE TABLE IF NOT EXISTS escalations (
+	id                TEXT PRIMARY KEY,
+	created_at        TIMESTAMP NOT NULL,
+	tool              TEXT NOT NULL,
+	question          TEXT NOT NULL,
+	context_hash      TEXT NOT NULL DEFAULT '',
+	model             TEXT NOT NULL,
+	answer            TEXT NOT NULL,
+	latency_ms        INTEGER NOT NULL DEFAULT 0,
+	prompt_tokens     INTEGER NOT NULL DEFAULT 0,
+	completion_tokens INTEGER NOT NULL DEFAULT 0,
+	cost_usd          REAL NOT NULL DEFAULT 0,
+	source            TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS escalations_created_at ON escalations (created_at);
+`
+
+// historyMigrations add columns introduced after the first schema, in order.
+var historyMigrations = []struct {
+	column     string
+	definition string
+}{
+	{"context_usage", "TEXT NOT NULL DEFAULT ''"},
+	{"arguments", "TEXT NOT NULL DEFAULT ''"},
+	{"stale_at", "TIMESTAMP"},
+	{"translation", "TEXT NOT NULL DEFAULT ''"},
+	{"assembly", "TEXT NOT NULL DEFAULT ''"},
+}
+
+// migrateHistory adds any columns missing from an older database.
+func migrateHistory(db *sql.DB) error {
+	rows, err := db.Query(`SELECT name FROM pragma_table_info('escalations')`)
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		existing[name] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, m := range historyMigrations {
+		if existing[m.column] {
+			continue
+		}
+		if _, err := db.Exec(fmt.Sprintf("ALTER TABLE escalations ADD COLUMN %s %s", m.column, m.definition)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// defaultHistoryPath is ~/.escalator/history.db.
+func defaultHistoryPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "escalator-history.db"
+	}
+	return filepath.Join(home, ".escalator", "history.db")
+}
+
+func OpenHistory(path string) (*HistoryStore, error) {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, err
+		}
+	}
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows a single writer; serializing through one connection
+	// avoids "database is locked" errors under concurrent tool calls.
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(historySchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("couldn't initialize history schema: %w", err)
+	}
+	if err := migrateHistory(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("couldn't migrate history schema: %w", err)
+	}
+	if _, err := db.Exec(outcomesSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("couldn't initialize outcomes schema: %w", err)
+	}
+
+	return &HistoryStore{db: db}, nil
+}
+
+// OpenHistoryReadOnly opens an existing history for listing and showing
+// escalations only; recording into it fails.
+func OpenHistoryReadOnly(path string) (*HistoryStore, error) {
+	db, err := openSQLiteReadOnly(path)
+	if err != nil {
+		return nil, err
+	}
+	return &HistoryStore{db: db}, nil
+}
+
+func (h *HistoryStore) Close() error {
+	return h.db.Close()
+}
+
+// Insert stores a record, reporting false when a record with the same ID
+// already exists.
+func (h *HistoryStore) Insert(rec EscalationRecord) (bool, error) {
+	var usage, arguments, translation, assembly []byte
+	var err error
+	if rec.ContextUsage != nil {
+		if usage, err = json.Marshal(rec.ContextUsage); err != nil {
+			return false, err
+		}
+	}
+	if rec.Arguments != nil {
+		if arguments, err = json.Marshal(rec.Arguments); err != nil {
+			return false, err
+		}
+	}
+	if rec.Translation != nil {
+		if translation, err = json.Marshal(rec.Translation); err != nil {
+			return false, err
+		}
+	}
+	if rec.Assembly != nil {
+		if assembly, err = json.Marshal(rec.Assembly); err != nil {
+			return false, err
+		}
+	}
+	var staleAt sql.NullTime
+	if !rec.StaleAt.IsZero() {
+		staleAt = sql.NullTime{Time: rec.StaleAt.UTC(), Valid: true}
+	}
+
+	// Large values are stored compressed, and decompressed as they're read.
+	packed := make(map[string]interface{}, len(compressedColumns))
+	for column, value := range map[string]string{"answer": rec.Answer, "arguments": string(arguments), "translation": string(translation), "assembly": string(assembly)} {
+		if packed[column], err = packColumn(value); err != nil {
+			return false, err
+		}
+	}
+
+	res, err := h.db.Exec(`INSERT OR IGNORE INTO escalations
+		(`+historyColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		rec.ID, rec.CreatedAt.UTC(), rec.Tool, rec.Question, rec.ContextHash, rec.Model, packed["answer"],
+		rec.LatencyMS, rec.PromptTokens, rec.CompletionTokens, rec.CostUSD, rec.Source, string(usage),
+		packed["arguments"], staleAt, packed["translation"], packed["assembly"])
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// newEscalationID returns a random 16-character hex ID.
+func newEscalationID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// contextHash identifies the full prompt without storing it.
+func contextHash(prompt string) string {
+	sum := sha256.Sum256([]byte(prompt))
+	return hex.EncodeToString(sum[:16])
+}
+
+// Record stores an answered escalation and returns its ID. The caller fills
+// in what it knows about the request (tool, question, arguments, usage);
+// the rest comes from the prompt and completion. Failures are logged rather
+// than returned so history never breaks an escalation.
+func (h *HistoryStore) Record(rec EscalationRecord, prompt string, completion *Completion, latency time.Duration) string {
+	rec.ContextHash = contextHash(prompt)
+	rec.Model = completion.Model
+	rec.Answer = completion.Answer
+	rec.PromptTokens = completion.PromptTokens
+	rec.CompletionTokens = completion.CompletionTokens
+	rec.CostUSD = estimateCost(completion.Model, completion.PromptTokens, completion.CompletionTokens)
+	return h.record(rec, latency)
+}
+
+// RecordUsage stores an escalation answered by a tool that may have made
+// several model calls, such as a second opinion or a brainstorm, with their
+// summed usage and cost, and returns its ID. The context hash covers the
+// tool's arguments, since the prompts aren't seen.
+func (h *HistoryStore) RecordUsage(rec EscalationRecord, answer string, usage *TokenUsage, latency time.Duration) string {
+	arguments, _ := json.Marshal(rec.Arguments)
+	rec.ContextHash = contextHash(rec.Tool + "\x00" + string(arguments))
+	rec.Model = usage.Model
+	if rec.Model == "" {
+		rec.Model = severalModels
+	}
+	rec.Answer = answer
+	rec.PromptTokens = usage.PromptTokens
+	rec.CompletionTokens = usage.CompletionTokens
+	rec.CostUSD = usage.CostUSD
+	return h.record(rec, latency)
+}
+
+func (h *HistoryStore) record(rec EscalationRecord, latency time.Duration) string {
+	rec.ID = newEscalationID()
+	rec.CreatedAt = time.Now()
+	rec.LatencyMS = latency.Milliseconds()
+	if _, err := h.Insert(rec); err != nil {
+		slog.Warn("Couldn't record escalation in history", "tool", rec.Tool, "error", err)
+	}
+	return rec.ID
+}
+
+// recordEscalation records a tool's answer when it made model calls of its
+// own and didn't record the escalation itself, as get_help does, and adds
+// the escalation_id to the result so outcomes can be reported against it.
+// Pipelines aren't recorded: each of their steps already is.
+func (s *MCPServer) recordEscalation(tool Tool, arguments map[string]interface{}, content []map[string]interface{}, latency time.Duration) {
+	if s.history == nil || toolCategory(tool) == "pipeline" {
+		return
+	}
+	meta := takeMeta(content)
+	defer func() {
+		if len(meta) > 0 {
+			withMeta(content, meta)
+		}
+	}()
+	usage, _ := meta["usage"].(*TokenUsage)
+	if _, recorded := meta["escalation_id"]; recorded || usage == nil || usage.Cached || usage.Shared || usage.TotalTokens == 0 {
+		return
+	}
+
+	escalationID := s.history.RecordUsage(EscalationRecord{
+		Tool:      tool.Name(),
+		Question:  historyQuestion(arguments),
+		Arguments: reaskArguments(arguments),
+	}, contentText(content), usage, latency)
+	meta["escalation_id"] = escalationID
+	if structured := takeStructuredContent(content); structured != nil {
+		structured["escalation_id"] = escalationID
+		withStructuredContent(content, structured)
+	}
+}
+
+// historyQuestion is what a tool was asked, for the history: the question
+// or problem, or else the decision, failure output or code it was given.
+func historyQuestion(arguments map[string]interface{}) string {
+	if question := escalationQuestion(arguments); question != "" {
+		return question
+	}
+	for _, name := range []string{"decision", "output", "code", "path"} {
+		if text, ok := arguments[name].(string); ok && strings.TrimSpace(text) != "" {
+			return text
+		}
+	}
+	return strings.Join(stringListArgument(arguments, "files"), "\n")
+}
+
+const historyColumns = `id, created_at, tool, question, context_hash, model, answer,
+	latency_ms, prompt_tokens, completion_tokens, cost_usd, source, context_usage, arguments, stale_at, translation, assembly`
+
+func scanRecords(rows *sql.Rows) ([]EscalationRecord, error) {
+	defer rows.Close()
+
+	var records []EscalationRecord
+	for rows.Next() {
+		var rec EscalationRecord
+		var usage, arguments, translation, assembly string
+		var staleAt sql.NullTime
+		if err := rows.Scan(&rec.ID, &rec.CreatedAt, &rec.Tool, &rec.Question, &rec.ContextHash, &rec.Model, &rec.Answer,
+			&rec.LatencyMS, &rec.PromptTokens, &rec.CompletionTokens, &rec.CostUSD, &rec.Source, &usage,
+			&arguments, &staleAt, &translation, &assembly); err != nil {
+			return nil, err
+		}
+		for _, stored := range []*string{&rec.Answer, &arguments, &translation, &assembly} {
+			value, err := unpackColumn(*stored)
+			if err != nil {
+				return nil, fmt.Errorf("record %s: %w", rec.ID, err)
+			}
+			*stored = value
+		}
+		if arguments != "" {
+			if err := json.Unmarshal([]byte(arguments), &rec.Arguments); err != nil {
+				return nil, fmt.Errorf("record %s: %w", rec.ID, err)
+			}
+		}
+		rec.StaleAt = staleAt.Time
+		if usage != "" {
+			rec.ContextUsage = &ContextUsage{}
+			if err := json.Unmarshal([]byte(usage), rec.ContextUsage); err != nil {
+				return nil, fmt.Errorf("record %s: %w", rec.ID, err)
+			}
+		}
+		if translation != "" {
+			rec.Translation = &Translation{}
+			if err := json.Unmarshal([]byte(translation), rec.Translation); err != nil {
+				return nil, fmt.Errorf("record %s: %w", rec.ID, err)
+			}
+		}
+		if assembly != "" {
+			rec.Assembly = &PromptAssembly{}
+			if err := json.Unmarshal([]byte(assembly), rec.Assembly); err != nil {
+				return nil, fmt.Errorf("record %s: %w", rec.ID, err)
+			}
+		}
+		records = append(records, rec)
+	}
+	return records, rows.Err()
+}
+
+// Recent returns up to limit records, newest first, whose question contains
+// query (case-insensitive) when query is non-empty.
+func (h *HistoryStore) Recent(limit int, query string) ([]EscalationRecord, error) {
+	rows, err := h.db.Query(`SELECT `+historyColumns+` FROM escalations
+		WHERE ? = '' OR question LIKE '%' || ? || '%'
+		ORDER BY created_at DESC, id LIMIT ?`, query, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanRecords(rows)
+}
+
+// Get returns the record with the given ID, or sql.ErrNoRows.
+func (h *HistoryStore) Get(id string) (*EscalationRecord, error) {
+	rows, err := h.db.Query(`SELECT `+historyColumns+` FROM escalations WHERE id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	records, err := scanRecords(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &records[0], nil
+}
+
+// All returns every record, oldest first.
+func (h *HistoryStore) All() ([]EscalationRecord, error) {
+	rows, err := h.db.Query(`SELECT ` + historyColumns + ` FROM escalations ORDER BY created_at, id`)
+	if err != nil {
+		return nil, err
+	}
+	return scanRecords(rows)
+}
+
+// stale reports whether the record is past its freshness window at now.
+func (rec EscalationRecord) stale(now time.Time) bool {
+	return !rec.StaleAt.IsZero() && now.After(rec.StaleAt)
+}
+
+// formatRecordLine renders a one-line summary of a record.
+func formatRecordLine(rec EscalationRecord) string {
+	question := strings.Join(strings.Fields(rec.Question), " ")
+	if len(question) > 80 {
+		question = question[:77] + "..."
+	}
+	if rec.stale(time.Now()) {
+		question = "[stale] " + question
+	}
+	return fmt.Sprintf("%s  %s  %-12s %-14s %6dms %6d tok  $%.4f  %s",
+		rec.ID, rec.CreatedAt.Local().Format("2006-01-02 15:04"), rec.Tool, rec.Model,
+		rec.LatencyMS, rec.PromptTokens+rec.CompletionTokens, rec.CostUSD, question)
+}
+
+// formatRecord renders a record in full.
+func formatRecord(rec EscalationRecord) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "ID:       %s\n", rec.ID)
+	fmt.Fprintf(&b, "Time:     %s\n", rec.CreatedAt.Local().Format(time.RFC3339))
+	fmt.Fprintf(&b, "Tool:     %s\n", rec.Tool)
+	fmt.Fprintf(&b, "Model:    %s\n", rec.Model)
+	fmt.Fprintf(&b, "Latency:  %dms\n", rec.LatencyMS)
+	fmt.Fprintf(&b, "Tokens:   %d prompt, %d completion\n", rec.PromptTokens, rec.CompletionTokens)
+	fmt.Fprintf(&b, "Cost:     $%.4f\n", rec.CostUSD)
+	if usage := rec.ContextUsage; usage != nil {
+		fmt.Fprintf(&b, "Context:  %d/%d tokens (%.1f%%)\n", usage.PromptTokens, usage.ContextWindow, 100*usage.Utilization)
+	}
+	if rec.Source != "" {
+		fmt.Fprintf(&b, "Source:   %s\n", rec.Source)
+	}
+	if !rec.StaleAt.IsZero() {
+		fmt.Fprintf(&b, "Fresh until: %s\n", rec.StaleAt.Local().Format(time.RFC3339))
+	}
+	if rec.Translation != nil {
+		fmt.Fprintf(&b, "Language: %s\n", rec.Translation.Language)
+	}
+	fmt.Fprintf(&b, "\nQuestion:\n%s\n\nAnswer:\n%s\n", rec.Question, rec.Answer)
+	if tr := rec.Translation; tr != nil {
+		fmt.Fprintf(&b, "\nQuestion (English, as asked):\n%s\n\nAnswer (English, as given):\n%s\n", tr.Question, tr.Answer)
+	}
+	return b.String()
+}
+
+// recordID derives a stable ID for records exported without one, so that
+// importing the same file twice does not duplicate entries.
+func recordID(rec EscalationRecord) string {
+	sum := sha256.Sum256([]byte(rec.CreatedAt.UTC().Format(time.RFC3339Nano) + "\x00" + rec.Question + "\x00" + rec.Answer))
+	return hex.EncodeToString(sum[:16])
+}
+
+// ImportResult summarizes a history import.
+type ImportResult struct {
+	Imported   int
+	Duplicates int
+}
+
+// ImportJSONL merges JSONL records into the store. Records lacking an ID get
+// a content-derived one; records lacking a source are tagged with source.
+func (h *HistoryStore) ImportJSONL(r io.Reader, source string) (ImportResult, error) {
+	var result ImportResult
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		var rec EscalationRecord
+		if err := json.Unmarshal([]byte(text), &rec); err != nil {
+			return result, fmt.Errorf("line %d: %w", line, err)
+		}
+		if rec.Question == "" || rec.Answer == "" {
+			return result, fmt.Errorf("line %d: record needs question and answer", line)
+		}
+		if rec.ID == "" {
+			rec.ID = recordID(rec)
+		}
+		if rec.CreatedAt.IsZero() {
+			rec.CreatedAt = time.Now()
+		}
+		if rec.Tool == "" {
+			rec.Tool = "get_help"
+		}
+		if rec.Source == "" {
+			rec.Source = source
+		}
+
+		inserted, err := h.Insert(rec)
+		if err != nil {
+			return result, fmt.Errorf("line %d: %w", line, err)
+		}
+		if inserted {
+			result.Imported++
+		} else {
+			result.Duplicates++
+		}
+	}
+
+	return result, scanner.Err()
+}
+
+// ExportJSONL writes every record as one JSON object per line.
+func (h *HistoryStore) ExportJSONL(w io.Writer) (int, error) {
+	records, err := h.All()
+	if err != nil {
+		return 0, err
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	for _, rec := range records {
+		if err := encoder.Encode(rec); err != nil {
+			return 0, err
+		}
+	}
+	return len(records), nil
+}
+
+// runHistoryCommand implements `escalator history list|show|stats|import|export|publish|compress`.
+func runHistoryCommand(args []string, out io.Writer) int {
+	usage := "Usage: escalator history list [-db path] [-limit n] [-query text]\n" +
+		"       escalator history show [-db path] [-color auto|always|never] [-no-pager] [-save-code dir] id\n" +
+		"       escalator history stats [-db path]\n" +
+		"       escalator history import [-db path] [-source name] file.jsonl...\n" +
+		"       escalator history export [-db path]\n" +
+		"       escalator history publish [-db path] [-title text] [-secret-scanners list] -out dir\n" +
+		"       escalator history compress [-db path]\n" +
+		"       escalator history digest [-db path] [-since duration]"
+	if len(args) == 0 {
+		fmt.Fprintln(out, usage)
+		return 2
+	}
+
+	fs := flag.NewFlagSet("history "+args[0], flag.ContinueOnError)
+	fs.SetOutput(out)
+	dbPath := fs.String("db", defaultHistoryPath(), "Path to the history database")
+	source := fs.String("source", "", "Source name recorded on imported entries that lack one (default: file name)")
+	limit := fs.Int("limit", 20, "Maximum number of escalations to list")
+	query := fs.String("query", "", "Only list escalations whose question contains this text")
+	outDir := fs.String("out", "", "Directory the published site is written to")
+	title := fs.String("title", "Architect Guidance", "Title of the published site")
+	colorMode := fs.String("color", "auto", "Highlight answers shown: auto (on a terminal, unless NO_COLOR is set), always or never")
+	noPager := fs.Bool("no-pager", false, "Print answers shown without a pager")
+	saveCode := fs.String("save-code", "", "Directory the code blocks of an answer shown are written to, one file each")
+	since := fs.Duration("since", 7*24*time.Hour, "How far back the office hours digest looks for escalations reported unresolved")
+	scannerNames := fs.String("secret-scanners", "regex", "Comma-separated built-in secret scanners (regex, entropy) whose findings are redacted from the published site")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	store, err := OpenHistory(*dbPath)
+	if err != nil {
+		fmt.Fprintf(out, "Couldn't open history: %v\n", err)
+		return 1
+	}
+	defer store.Close()
+
+	switch args[0] {
+	case "list":
+		records, err := store.Recent(*limit, *query)
+		if err != nil {
+			fmt.Fprintf(out, "Couldn't query history: %v\n", err)
+			return 1
+		}
+		for _, rec := range records {
+			fmt.Fprintln(out, formatRecordLine(rec))
+		}
+	case "show":
+		if fs.NArg() != 1 {
+			fmt.Fprintln(out, usage)
+			return 2
+		}
+		rec, err := store.Get(fs.Arg(0))
+		if err != nil {
+			fmt.Fprintf(out, "Couldn't find escalation %s: %v\n", fs.Arg(0), err)
+			return 1
+		}
+		color, err := useColor(*colorMode, out)
+		if err != nil {
+			fmt.Fprintln(out, err)
+			return 2
+		}
+		text := formatRecord(*rec)
+		if outcome, err := store.Outcome(rec.ID); err == nil && outcome != nil {
+			text += formatOutcome(outcome)
+		}
+		if *saveCode != "" {
+			paths, err := saveCodeBlocks(*saveCode, rec.ID, extractCodeBlocks(rec.Answer))
+			if err != nil {
+				fmt.Fprintf(out, "Couldn't save the answer's code: %v\n", err)
+				return 1
+			}
+			if len(paths) == 0 {
+				text += "\nThe answer has no code blocks to save.\n"
+			} else {
+				text += fmt.Sprintf("\nSaved %d code blocks:\n", len(paths))
+			}
+			for _, path := range paths {
+				text += "  " + path + "\n"
+			}
+		}
+		if color {
+			text = renderMarkdown(text)
+		}
+		pageOutput(out, text, !*noPager)
+	case "stats":
+		records, err := store.All()
+		if err != nil {
+			fmt.Fprintf(out, "Couldn't query history: %v\n", err)
+			return 1
+		}
+		outcomes, err := store.Outcomes()
+		if err != nil {
+			fmt.Fprintf(out, "Couldn't query outcomes: %v\n", err)
+			return 1
+		}
+		fmt.Fprint(out, formatContextStats(records))
+		fmt.Fprint(out, "\n"+formatOutcomeStats(records, outcomes))
+	case "import":
+		if fs.NArg() == 0 {
+			fmt.Fprintln(out, usage)
+			return 2
+		}
+		for _, path := range fs.Args() {
+			file, err := os.Open(path)
+			if err != nil {
+				fmt.Fprintf(out, "Couldn't open %s: %v\n", path, err)
+				return 1
+			}
+			name := *source
+			if name == "" {
+				name = filepath.Base(path)
+			}
+			result, err := store.ImportJSONL(file, name)
+			file.Close()
+			if err != nil {
+				fmt.Fprintf(out, "Import of %s failed after %d records: %v\n", path, result.Imported, err)
+				return 1
+			}
+			fmt.Fprintf(out, "%s: imported %d, skipped %d duplicates\n", path, result.Imported, result.Duplicates)
+		}
+	case "export":
+		if _, err := store.ExportJSONL(out); err != nil {
+			fmt.Fprintf(os.Stderr, "Export failed: %v\n", err)
+			return 1
+		}
+	case "publish":
+		if *outDir == "" {
+			fmt.Fprintln(out, usage)
+			return 2
+		}
+		// Publishing shares the history beyond the machine it was recorded
+		// on, so it is never done without redaction.
+		var scanners []SecretScanner
+		for _, name := range splitList(*scannerNames) {
+			scanner, err := secretScannerFor(name)
+			if err != nil {
+				fmt.Fprintln(out, err)
+				return 2
+			}
+			scanners = append(scanners, scanner)
+		}
+		if len(scanners) == 0 {
+			fmt.Fprintln(out, "Publishing needs at least one secret scanner")
+			return 2
+		}
+		records, err := store.All()
+		if err != nil {
+			fmt.Fprintf(out, "Couldn't query history: %v\n", err)
+			return 1
+		}
+		threads, err := buildThreads(context.Background(), records, NewRedactor(scanners...))
+		if err != nil {
+			fmt.Fprintf(out, "Couldn't redact history: %v\n", err)
+			return 1
+		}
+		if err := PublishHistory(threads, *outDir, *title); err != nil {
+			fmt.Fprintf(out, "Couldn't publish history: %v\n", err)
+			return 1
+		}
+		fmt.Fprintf(out, "Published %d questions (%d answers) to %s\n", len(threads), len(records), filepath.Join(*outDir, "index.html"))
+	case "compress":
+		before, _ := os.Stat(*dbPath)
+		compressed, err := store.Compress()
+		if err != nil {
+			fmt.Fprintf(out, "Compression failed after %d values: %v\n", compressed, err)
+			return 1
+		}
+		fmt.Fprintf(out, "Compressed %d values", compressed)
+		if after, err := os.Stat(*dbPath); err == nil && before != nil {
+			fmt.Fprintf(out, "; %s went from %d to %d bytes", *dbPath, before.Size(), after.Size())
+		}
+		fmt.Fprintln(out)
+	case "digest":
+		now := time.Now()
+		threads, err := store.Unresolved(now.Add(-*since))
+		if err != nil {
+			fmt.Fprintf(out, "Couldn't query unresolved escalations: %v\n", err)
+			return 1
+		}
+		fmt.Fprint(out, formatDigest(threads, now.Add(-*since), now))
+	default:
+		fmt.Fprintln(out, usage)
+		return 2
+	}
+
+	return 0
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func openTestHistory(t *testing.T) *HistoryStore {
+	t.Helper()
+	store, err := OpenHistory(filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatalf("Expected history to open, got: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestHistoryStore_ImportJSONL(t *testing.T) {
+	store := openTestHistory(t)
+
+	export := `{"id":"a1","created_at":"2025-01-02T03:04:05Z","tool":"get_help","question":"q1","model":"o3","answer":"a1","source":"team-a"}
+{"created_at":"2025-01-03T00:00:00Z","question":"q2","model":"gpt-4o","answer":"a2"}
+
+`
+	result, err := store.ImportJSONL(strings.NewReader(export), "legacy.jsonl")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if result.Imported != 2 || result.Duplicates != 0 {
+		t.Errorf("Expected 2 imported, got %+v", result)
+	}
+
+	// Re-importing the same export must not duplicate anything, including
+	// the record that had no ID.
+	result, err = store.ImportJSONL(strings.NewReader(export), "legacy.jsonl")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if result.Imported != 0 || result.Duplicates != 2 {
+		t.Errorf("Expected 2 duplicates on re-import, got %+v", result)
+	}
+
+	records, err := store.All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 records, got %d", len(records))
+	}
+	if records[0].Source != "team-a" {
+		t.Errorf("Expected original source to be kept, got %q", records[0].Source)
+	}
+	if records[1].Source != "legacy.jsonl" || records[1].Tool != "get_help" {
+		t.Errorf("Expected defaults for legacy record, got %+v", records[1])
+	}
+}
+
+func TestHistoryStore_ImportJSONL_Invalid(t *testing.T) {
+	store := openTestHistory(t)
+
+	if _, err := store.ImportJSONL(strings.NewReader("{not json}\n"), "x"); err == nil {
+		t.Error("Expected error for malformed line")
+	}
+	if _, err := store.ImportJSONL(strings.NewReader(`{"question":"q"}`+"\n"), "x"); err == nil {
+		t.Error("Expected error for record without answer")
+	}
+}
+
+func TestRunHistoryCommand_ImportExport(t *testing.T) {
+	dir := t.TempDir()
+	db := filepath.Join(dir, "history.db")
+	input := filepath.Join(dir, "instance-b.jsonl")
+	os.WriteFile(input, []byte(`{"id":"b1","created_at":"2025-01-02T03:04:05Z","question":"q","model":"o3","answer":"a"}`+"\n"), 0644)
+
+	var out bytes.Buffer
+	if code := runHistoryCommand([]string{"import", "-db", db, input}, &out); code != 0 {
+		t.Fatalf("Expected import to succeed, got %d: %s", code, out.String())
+	}
+	if !strings.Contains(out.String(), "imported 1") {
+		t.Errorf("Expected import summary, got %q", out.String())
+	}
+
+	out.Reset()
+	if code := runHistoryCommand([]string{"export", "-db", db}, &out); code != 0 {
+		t.Fatalf("Expected export to succeed, got %d", code)
+	}
+	if !strings.Contains(out.String(), `"id":"b1"`) || !strings.Contains(out.String(), `"source":"instance-b.jsonl"`) {
+		t.Errorf("Expected exported record, got %q", out.String())
+	}
+
+	if code := runHistoryCommand([]string{"import", "-db", db}, &out); code != 2 {
+		t.Errorf("Expected usage error without files, got %d", code)
+	}
+}
+
+func TestHistoryStore_RecentAndGet(t *testing.T) {
+	store := openTestHistory(t)
+
+	first := store.Record(EscalationRecord{Tool: "get_help", Question: "How do I shard the queue?"}, "prompt 1", &Completion{Answer: "a1", Model: "o3", PromptTokens: 1000, CompletionTokens: 500}, 1200*time.Millisecond)
+	time.Sleep(time.Millisecond)
+	second := store.Record(EscalationRecord{Tool: "get_help", Question: "Why is the cache cold?"}, "prompt 2", &Completion{Answer: "a2", Model: "gpt-4o"}, time.Second)
+
+	records, err := store.Recent(10, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].ID != second || records[1].ID != first {
+		t.Fatalf("Expected newest first, got %+v", records)
+	}
+
+	records, err = store.Recent(10, "SHARD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].ID != first {
+		t.Errorf("Expected query to match case-insensitively, got %+v", records)
+	}
+
+	rec, err := store.Get(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.LatencyMS != 1200 || rec.PromptTokens != 1000 || rec.ContextHash != contextHash("prompt 1") {
+		t.Errorf("Unexpected record: %+v", rec)
+	}
+	if rec.CostUSD != estimateCost("o3", 1000, 500) {
+		t.Errorf("Expected cost to be estimated, got %v", rec.CostUSD)
+	}
+
+	if _, err := store.Get("missing"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected sql.ErrNoRows, got %v", err)
+	}
+}
+
+func TestGetHelpTool_Call_RecordsHistory(t *testing.T) {
+	srv := newFakeOpenAI(t, func(model string) string { return "answer" })
+	store := openTestHistory(t)
+
+	tool := NewGetHelpTool("", "o3").
+		WithClientOptions(ClientOptions{BaseURL: srv.URL}).
+		WithHistory(store)
+	if _, err := tool.Call(map[string]interface{}{"question": "q", "summary": "s"}); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	records, err := store.All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("Expected 1 record, got %d", len(records))
+	}
+	rec := records[0]
+	if rec.Tool != "get_help" || rec.Question != "q" || rec.Answer != "answer" || rec.Model != "o3" {
+		t.Errorf("Unexpected record: %+v", rec)
+	}
+	if rec.PromptTokens != 1000 || rec.CompletionTokens != 500 || rec.CostUSD == 0 {
+		t.Errorf("Expected token usage and cost, got %+v", rec)
+	}
+}
+
+func TestMCPServer_RecordsEscalations(t *testing.T) {
+	withFastRetries(t)
+	srv := newFakeOpenAI(t, func(model string) string { return "answer from " + model })
+	store := openTestHistory(t)
+
+	help := NewGetHelpTool("", "o3").
+		WithClientOptions(ClientOptions{BaseURL: srv.URL}).
+		WithHistory(store)
+	server := NewMCPServer("test", "1.0.0").
+		WithTool(help).
+		WithTool(NewSecondOpinionTool(help, []string{"gpt-4o", "gpt-4o-mini"})).
+		WithHistory(store)
+
+	tool, _ := server.server.Tool("get_second_opinion")
+	content, err := server.callTool(context.Background(), tool, map[string]interface{}{"question": "q", "summary": "s", "mode": "all"}, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	id, _ := takeMeta(content)["escalation_id"].(string)
+	rec, err := store.Get(id)
+	if err != nil {
+		t.Fatalf("Expected the second opinion recorded, got %q, %v", id, err)
+	}
+	if rec.Tool != "get_second_opinion" || rec.Question != "q" || rec.Model != severalModels || !strings.Contains(rec.Answer, "answer from gpt-4o-mini") {
+		t.Errorf("Unexpected record: %+v", rec)
+	}
+	if rec.PromptTokens != 2000 || rec.CompletionTokens != 1000 || rec.CostUSD == 0 {
+		t.Errorf("Expected the usage of both models and its cost, got %+v", rec)
+	}
+
+	// get_help records its own escalations, with more detail.
+	content, err = server.callTool(context.Background(), help, map[string]interface{}{"question": "q2", "summary": "s"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, _ := store.All()
+	if len(records) != 2 || takeMeta(content)["escalation_id"] == nil {
+		t.Errorf("Expected get_help recorded once, got %d records", len(records))
+	}
+}
+
+func TestListEscalationsTool_Call(t *testing.T) {
+	store := openTestHistory(t)
+	id := store.Record(EscalationRecord{Tool: "get_help", Question: "How do I shard the queue?"}, "p", &Completion{Answer: "Use consistent hashing.", Model: "o3"}, time.Second)
+	tool := NewListEscalationsTool(store)
+
+	result, err := tool.Call(map[string]interface{}{"query": "shard"})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if text := result[0]["text"].(string); !strings.Contains(text, id) {
+		t.Errorf("Expected listing to include %s, got %q", id, text)
+	}
+
+	result, _ = tool.Call(map[string]interface{}{"query": "nothing like this"})
+	if result[0]["text"] != "No escalations found." {
+		t.Errorf("Expected empty listing, got %q", result[0]["text"])
+	}
+
+	result, err = tool.Call(map[string]interface{}{"id": id})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if text := result[0]["text"].(string); !strings.Contains(text, "Use consistent hashing.") {
+		t.Errorf("Expected full answer, got %q", text)
+	}
+
+	if _, err := tool.Call(map[string]interface{}{"id": "missing"}); err == nil {
+		t.Error("Expected error for unknown ID")
+	}
+}
+
+func TestRunHistoryCommand_ListShow(t *testing.T) {
+	db := filepath.Join(t.TempDir(), "history.db")
+	store, err := OpenHistory(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := store.Record(EscalationRecord{Tool: "get_help", Question: "How do I shard the queue?"}, "p", &Completion{Answer: "Use consistent hashing.", Model: "o3"}, time.Second)
+	store.Close()
+
+	var out bytes.Buffer
+	if code := runHistoryCommand([]string{"list", "-db", db, "-query", "shard"}, &out); code != 0 {
+		t.Fatalf("Expected list to succeed, got %d: %s", code, out.String())
+	}
+	if !strings.Contains(out.String(), id) {
+		t.Errorf("Expected listing to include %s, got %q", id, out.String())
+	}
+
+	out.Reset()
+	if code := runHistoryCommand([]string{"show", "-db", db, id}, &out); code != 0 {
+		t.Fatalf("Expected show to succeed, got %d: %s", code, out.String())
+	}
+	if !strings.Contains(out.String(), "Use consistent hashing.") {
+		t.Errorf("Expected full answer, got %q", out.String())
+	}
+
+	if code := runHistoryCommand([]string{"show", "-db", db, "missing"}, &out); code != 1 {
+		t.Errorf("Expected failure for unknown ID, got %d", code)
+	}
+}
+
+func TestHistoryStore_ContextUsage(t *testing.T) {
+	store := openTestHistory(t)
+	usage := &ContextUsage{ContextWindow: 200000, PromptTokens: 1000, Utilization: 0.005, Sections: []SectionUsage{{Name: "summary", Tokens: 800}}}
+	id := store.Record(EscalationRecord{Tool: "get_help", Question: "q", ContextUsage: usage}, "p", &Completion{Answer: "a", Model: "o3"}, time.Second)
+
+	rec, err := store.Get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.ContextUsage == nil || rec.ContextUsage.Sections[0].Tokens != 800 {
+		t.Errorf("Expected context usage to round-trip, got %+v", rec.ContextUsage)
+	}
+}
+
+func TestOpenHistory_MigratesOldSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The schema before context_usage was added.
+	_, err = db.Exec(`CREATE TABLE escalations (
+		id TEXT PRIMARY KEY, created_at TIMESTAMP NOT NULL, tool TEXT NOT NULL, question TEXT NOT NULL,
+		context_hash TEXT NOT NULL DEFAULT '', model TEXT NOT NULL, answer TEXT NOT NULL,
+		latency_ms INTEGER NOT NULL DEFAULT 0, prompt_tokens INTEGER NOT NULL DEFAULT 0,
+		completion_tokens INTEGER NOT NULL DEFAULT 0, cost_usd REAL NOT NULL DEFAULT 0, source TEXT NOT NULL DEFAULT '');
+		INSERT INTO escalations (id, created_at, tool, question, model, answer) VALUES ('old', '2025-01-01 00:00:00', 'get_help', 'q', 'o3', 'a');`)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := OpenHistory(path)
+	if err != nil {
+		t.Fatalf("Expected old database to be migrated, got: %v", err)
+	}
+	defer store.Close()
+
+	rec, err := store.Get("old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.ContextUsage != nil {
+		t.Errorf("Expected no usage for old record, got %+v", rec.ContextUsage)
+	}
+}
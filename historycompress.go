@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// compressedPrefix starts a history column stored compressed with DEFLATE.
+// Text and JSON never start with a NUL byte, so values written before
+// compression, or too small to compress, read as they always did.
+const compressedPrefix = "\x00z1"
+
+// compressMinBytes is the smallest value worth compressing. Short answers
+// gain little, and stay readable with the sqlite3 shell.
+const compressMinBytes = 1024
+
+// packColumn returns value as it is stored: compressed, as a blob, when
+// it's large and compression makes it smaller, and otherwise unchanged.
+func packColumn(value string) (interface{}, error) {
+	if len(value) < compressMinBytes {
+		return value, nil
+	}
+	var b bytes.Buffer
+	b.WriteString(compressedPrefix)
+	w, err := flate.NewWriter(&b, flate.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(w, value); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	if b.Len() >= len(value) {
+		return value, nil
+	}
+	return b.Bytes(), nil
+}
+
+// unpackColumn returns a stored value as it was written.
+func unpackColumn(stored string) (string, error) {
+	if !strings.HasPrefix(stored, compressedPrefix) {
+		return stored, nil
+	}
+	value, err := io.ReadAll(flate.NewReader(strings.NewReader(stored[len(compressedPrefix):])))
+	if err != nil {
+		return "", fmt.Errorf("couldn't decompress: %w", err)
+	}
+	return string(value), nil
+}
+
+// compressedColumns are the escalations columns large enough to compress.
+// The question is searched with LIKE, so it's always stored as text.
+var compressedColumns = []string{"answer", "arguments", "translation", "assembly"}
+
+// Compress compresses the large values written before compression was
+// added, and reclaims the space they took. It returns the number of values
+// compressed.
+func (h *HistoryStore) Compress() (int, error) {
+	compressed := 0
+	for _, column := range compressedColumns {
+		// Values are read one at a time, since the point is that they're
+		// large.
+		rows, err := h.db.Query(fmt.Sprintf(`SELECT id FROM escalations
+			WHERE length(CAST(%s AS BLOB)) >= ? AND substr(CAST(%[1]s AS BLOB), 1, 1) != x'00'`, column), compressMinBytes)
+		if err != nil {
+			return compressed, err
+		}
+		var ids []string
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return compressed, err
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return compressed, err
+		}
+
+		for _, id := range ids {
+			var value string
+			if err := h.db.QueryRow(fmt.Sprintf(`SELECT %s FROM escalations WHERE id = ?`, column), id).Scan(&value); err != nil {
+				return compressed, err
+			}
+			packed, err := packColumn(value)
+			if err != nil {
+				return compressed, err
+			}
+			if _, ok := packed.([]byte); !ok {
+				continue
+			}
+			if _, err := h.db.Exec(fmt.Sprintf(`UPDATE escalations SET %s = ? WHERE id = ?`, column), packed, id); err != nil {
+				return compressed, err
+			}
+			compressed++
+		}
+	}
+	if compressed > 0 {
+		if _, err := h.db.Exec(`VACUUM`); err != nil {
+			return compressed, err
+		}
+	}
+	return compressed, nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHistoryStore_CompressesLargeValues(t *testing.T) {
+	store := openTestHistory(t)
+	answer := strings.Repeat("Move the N+1 query out of the loop and batch it. ", 200)
+	code := strings.Repeat("for _, order := range orders { db.Query(order.ID) }\n", 200)
+	id := store.Record(EscalationRecord{Tool: "get_help", Question: "Why is checkout slow?", Arguments: map[string]interface{}{"relevant_code": code}},
+		"p", &Completion{Answer: answer, Model: "o3"}, time.Second)
+	short := store.Record(EscalationRecord{Tool: "get_help", Question: "q"}, "p", &Completion{Answer: "Short.", Model: "o3"}, time.Second)
+
+	var stored string
+	store.db.QueryRow(`SELECT answer FROM escalations WHERE id = ?`, id).Scan(&stored)
+	if !strings.HasPrefix(stored, compressedPrefix) || len(stored) >= len(answer)/10 {
+		t.Errorf("Expected the answer stored compressed, got %d bytes", len(stored))
+	}
+	store.db.QueryRow(`SELECT answer FROM escalations WHERE id = ?`, short).Scan(&stored)
+	if stored != "Short." {
+		t.Errorf("Expected a short answer stored as text, got %q", stored)
+	}
+
+	rec, err := store.Get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Answer != answer || rec.Arguments["relevant_code"] != code {
+		t.Error("Expected the answer and arguments to read back as written")
+	}
+	records, err := store.Recent(10, "checkout")
+	if err != nil || len(records) != 1 || records[0].Answer != answer {
+		t.Errorf("Expected the question to stay searchable, got %d records, %v", len(records), err)
+	}
+}
+
+func TestRunHistoryCommand_Compress(t *testing.T) {
+	db := filepath.Join(t.TempDir(), "history.db")
+	store, err := OpenHistory(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// An escalation recorded before compression was added.
+	answer := strings.Repeat("Shard the queue by tenant. ", 500)
+	store.db.Exec(`INSERT INTO escalations (id, created_at, tool, question, model, answer) VALUES ('old', '2025-01-01 00:00:00', 'get_help', 'q', 'o3', ?)`, answer)
+	store.Close()
+
+	var out bytes.Buffer
+	if code := runHistoryCommand([]string{"compress", "-db", db}, &out); code != 0 {
+		t.Fatalf("Expected compress to succeed, got %d: %s", code, out.String())
+	}
+	if !strings.Contains(out.String(), "Compressed 1 values") {
+		t.Errorf("Expected the old answer compressed, got %q", out.String())
+	}
+
+	store, err = OpenHistory(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if rec, err := store.Get("old"); err != nil || rec.Answer != answer {
+		t.Errorf("Expected the compressed answer to read back, got %v", err)
+	}
+	if compressed, err := store.Compress(); err != nil || compressed != 0 {
+		t.Errorf("Expected nothing left to compress, got %d, %v", compressed, err)
+	}
+}
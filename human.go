@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// slackSectionChars keeps each part of the message under Slack's 3,000
+// character limit for a section's text.
+const slackSectionChars = 2800
+
+var humanUrgencies = []string{"low", "normal", "high"}
+
+// HumanEscalationTool is the last rung of the escalation ladder: agent,
+// model, human. It posts a problem to a Slack channel along with the
+// model's best-effort answer, and returns a ticket the agent can cite
+// while it waits for a person to follow up.
+type HumanEscalationTool struct {
+	help     *GetHelpTool
+	webhook  string
+	channel  string
+	redactor *Redactor
+	client   *http.Client
+}
+
+// NewHumanEscalationTool posts to a Slack incoming webhook. help answers the
+// question first when the caller hasn't already got the model's answer.
+func NewHumanEscalationTool(help *GetHelpTool, webhook string) *HumanEscalationTool {
+	return &HumanEscalationTool{help: help, webhook: webhook, client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// WithChannel posts to channel instead of the webhook's default channel.
+func (t *HumanEscalationTool) WithChannel(channel string) *HumanEscalationTool {
+	t.channel = channel
+	return t
+}
+
+// WithRedactor redacts secrets from the message before it is posted.
+func (t *HumanEscalationTool) WithRedactor(redactor *Redactor) *HumanEscalationTool {
+	t.redactor = redactor
+	return t
+}
+
+func (t *HumanEscalationTool) Name() string {
+	return "escalate_to_human"
+}
+
+func (t *HumanEscalationTool) Category() string {
+	return "escalation/people"
+}
+
+func (t *HumanEscalationTool) Description() string {
+	return "Escalate a problem the model couldn't settle to a human engineer: posts the question, context and the model's best-effort answer to the team's Slack channel and returns a ticket ID"
+}
+
+func (t *HumanEscalationTool) Schema() map[string]interface{} {
+	help := t.help.Schema()["properties"].(map[string]interface{})
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"question":      help["question"],
+			"summary":       help["summary"],
+			"relevant_code": help["relevant_code"],
+			"attempts": map[string]interface{}{
+				"type":        "string",
+				"description": "What has been tried so far and why it didn't work (optional)",
+			},
+			"answer": map[string]interface{}{
+				"type":        "string",
+				"description": "The model's answer already received from get_help; when left out, get_help is asked first (optional)",
+			},
+			"urgency": map[string]interface{}{
+				"type":        "string",
+				"enum":        humanUrgencies,
+				"description": "How soon a human is needed (default: normal)",
+			},
+		},
+		"required": []string{"question"},
+	}
+}
+
+func (t *HumanEscalationTool) Call(arguments map[string]interface{}) ([]map[string]interface{}, error) {
+	question, _ := arguments["question"].(string)
+	if strings.TrimSpace(question) == "" {
+		return textContent("Error: Missing required field: question"), fmt.Errorf("missing required fields")
+	}
+	urgency, _ := arguments["urgency"].(string)
+	if urgency == "" {
+		urgency = "normal"
+	}
+	if !slices.Contains(humanUrgencies, urgency) {
+		return textContent(fmt.Sprintf("Error: Unknown urgency %q", urgency)), fmt.Errorf("unknown urgency %q", urgency)
+	}
+
+	// The human sees what the model made of the problem, so they can start
+	// from its answer rather than from scratch.
+	answer, _ := arguments["answer"].(string)
+	meta := map[string]interface{}{}
+	if strings.TrimSpace(answer) == "" {
+		asked := map[string]interface{}{}
+		for _, name := range []string{"question", "summary", "relevant_code"} {
+			if value, ok := arguments[name]; ok {
+				asked[name] = value
+			}
+		}
+		content, err := t.help.Call(asked)
+		if usage, ok := takeMeta(content)["usage"]; ok {
+			meta["usage"] = usage
+		}
+		if err != nil {
+			slog.Warn("Couldn't get the model's answer before escalating to a human", "tool", "escalate_to_human", "error", err)
+		} else {
+			answer = contentText(content)
+		}
+	}
+
+	ticket := "HUM-" + strings.ToUpper(newEscalationID()[:8])
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err := t.post(ctx, ticket, urgency, arguments, answer); err != nil {
+		slog.Error("Couldn't escalate to Slack", "tool", "escalate_to_human", "ticket", ticket, "error", err)
+		return textContent("Error: Couldn't post the escalation to Slack. Please try again."), err
+	}
+	slog.Info("Escalated to a human", "tool", "escalate_to_human", "ticket", ticket, "urgency", urgency)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Escalated to a human as ticket %s", ticket)
+	if t.channel != "" {
+		fmt.Fprintf(&b, " in %s", t.channel)
+	}
+	b.WriteString(". An engineer will follow up in Slack; cite the ticket when you report back.")
+	if answer != "" {
+		fmt.Fprintf(&b, "\n\nThe model's best-effort answer in the meantime:\n\n%s", answer)
+	}
+	meta["ticket"] = ticket
+	meta["urgency"] = urgency
+	return withMeta(textContent(b.String()), meta), nil
+}
+
+// post sends the escalation to Slack, each part in its own section.
+func (t *HumanEscalationTool) post(ctx context.Context, ticket, urgency string, arguments map[string]interface{}, answer string) error {
+	header := fmt.Sprintf("*Escalated to a human* (`%s`, urgency: %s)", ticket, urgency)
+	blocks := []map[string]interface{}{slackSection(header)}
+	for _, part := range []struct {
+		title string
+		text  string
+		code  bool
+	}{
+		{"Question", stringArgument(arguments, "question"), false},
+		{"Project", stringArgument(arguments, "summary"), false},
+		{"What was tried", stringArgument(arguments, "attempts"), false},
+		{"Code", stringArgument(arguments, "relevant_code"), true},
+		{"The model's best-effort answer", answer, false},
+	} {
+		if strings.TrimSpace(part.text) == "" {
+			continue
+		}
+		text := part.text
+		if t.redactor != nil {
+			redacted, findings, err := t.redactor.Redact(ctx, text)
+			if err != nil {
+				return fmt.Errorf("couldn't scan for secrets: %w", err)
+			}
+			if len(findings) > 0 {
+				slog.Info("Redacted secrets from the escalation", "tool", "escalate_to_human", "secrets", len(findings), "part", strings.ToLower(part.title))
+			}
+			text = redacted
+		}
+		text = truncateMiddle(text, slackSectionChars)
+		if part.code {
+			text = "```" + strings.ReplaceAll(text, "```", "'''") + "```"
+		}
+		blocks = append(blocks, slackSection(fmt.Sprintf("*%s*\n%s", part.title, text)))
+	}
+
+	payload := map[string]interface{}{"text": header, "blocks": blocks}
+	if t.channel != "" {
+		payload["channel"] = t.channel
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.webhook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		reply, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("slack returned %s: %s", resp.Status, strings.TrimSpace(string(reply)))
+	}
+	return nil
+}
+
+func slackSection(text string) map[string]interface{} {
+	return map[string]interface{}{"type": "section", "text": map[string]string{"type": "mrkdwn", "text": text}}
+}
+
+func stringArgument(arguments map[string]interface{}, name string) string {
+	value, _ := arguments[name].(string)
+	return value
+}
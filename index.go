@@ -0,0 +1,498 @@
+package main
+
+import (
+	"container/heap"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	// chunkLines and chunkOverlap split files into overlapping windows of
+	// lines, so code near a boundary appears whole in some chunk.
+	chunkLines   = 60
+	chunkOverlap = 10
+
+	// maxChunkChars keeps a chunk of long lines within the embedding
+	// model's input limit.
+	maxChunkChars = 6000
+
+	// embedBatchSize is the number of chunks embedded per request.
+	embedBatchSize = 64
+
+	// defaultEmbeddingModel is OpenAI's cheapest embedding model.
+	defaultEmbeddingModel = "text-embedding-3-small"
+)
+
+// Embedder turns texts into embedding vectors, one per text.
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// EmbedderFunc adapts a function to the Embedder interface.
+type EmbedderFunc func(ctx context.Context, texts []string) ([][]float32, error)
+
+func (f EmbedderFunc) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	return f(ctx, texts)
+}
+
+// openAIEmbedder embeds texts with the OpenAI embeddings API.
+type openAIEmbedder struct {
+	client *openai.Client
+	model  string
+}
+
+func NewOpenAIEmbedder(model string, opts ClientOptions) Embedder {
+	return &openAIEmbedder{client: opts.NewClient(), model: model}
+}
+
+func (e *openAIEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	resp, err := e.client.CreateEmbeddings(ctx, openai.EmbeddingRequestStrings{
+		Input: texts,
+		Model: openai.EmbeddingModel(e.model),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Data) != len(texts) {
+		return nil, fmt.Errorf("got %d embeddings for %d texts", len(resp.Data), len(texts))
+	}
+	vectors := make([][]float32, len(texts))
+	for _, d := range resp.Data {
+		if d.Index < 0 || d.Index >= len(texts) {
+			return nil, fmt.Errorf("embedding index %d out of range", d.Index)
+		}
+		vectors[d.Index] = d.Embedding
+	}
+	return vectors, nil
+}
+
+// CodeIndex is a local vector store of repository chunks. `escalator index`
+// fills it; get_help searches it for the chunks most relevant to a question
+// and includes them in the prompt.
+type CodeIndex struct {
+	db       *sql.DB
+	embedder Embedder
+	model    string
+
+	// chunks caches the stored chunks for searching; nil until first use
+	// and after an update.
+	mu     sync.Mutex
+	chunks []indexedChunk
+}
+
+type indexedChunk struct {
+	CodeChunk
+	vector []float32
+}
+
+// CodeChunk is a range of lines from one file.
+type CodeChunk struct {
+	Path      string
+	StartLine int
+	EndLine   int
+	Content   string
+}
+
+// RetrievedChunk is a chunk returned by a search, with its cosine
+// similarity to the query.
+type RetrievedChunk struct {
+	CodeChunk
+	Score float64
+}
+
+const indexSchema = `
+CREATE TABLE IF NOT EXISTS indexed_files (
+	path TEXT PRIMARY KEY,
+	hash TEXT NOT NULL,
+	model TEXT NOT NULL,
+	indexed_at TIMESTAMP NOT NULL
+);
+CREATE TABLE IF NOT EXISTS chunks (
+	path TEXT NOT NULL,
+	start_line INTEGER NOT NULL,
+	end_line INTEGER NOT NULL,
+	content TEXT NOT NULL,
+	embedding BLOB NOT NULL
+);
+CREATE INDEX IF NOT EXISTS chunks_path ON chunks(path);
+`
+
+// defaultIndexPath is ~/.escalator/index.db.
+func defaultIndexPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "escalator-index.db"
+	}
+	return filepath.Join(home, ".escalator", "index.db")
+}
+
+// OpenCodeIndex opens or creates the index at path. model names the
+// embedding model; files embedded with another model are re-embedded on
+// the next update.
+func OpenCodeIndex(path string, embedder Embedder, model string) (*CodeIndex, error) {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, err
+		}
+	}
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(indexSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("couldn't initialize index schema: %w", err)
+	}
+	return &CodeIndex{db: db, embedder: embedder, model: model}, nil
+}
+
+// OpenCodeIndexReadOnly opens an existing index for retrieval only;
+// updating it fails.
+func OpenCodeIndexReadOnly(path string, embedder Embedder, model string) (*CodeIndex, error) {
+	db, err := openSQLiteReadOnly(path)
+	if err != nil {
+		return nil, err
+	}
+	return &CodeIndex{db: db, embedder: embedder, model: model}, nil
+}
+
+func (x *CodeIndex) Close() error {
+	return x.db.Close()
+}
+
+// IndexStats reports what an update did.
+type IndexStats struct {
+	Files    int // files in the index after the update
+	Embedded int // files (re-)embedded because they were new or changed
+	Removed  int // files dropped because they no longer exist
+	Chunks   int // chunks embedded
+}
+
+// Update brings the index in line with repo: new and changed files are
+// chunked and embedded, and deleted ones removed. Binary and oversized
+// files are skipped.
+func (x *CodeIndex) Update(ctx context.Context, repo *Repository) (IndexStats, error) {
+	var stats IndexStats
+	files, err := repo.Files()
+	if err != nil {
+		return stats, err
+	}
+
+	known := make(map[string]string)
+	rows, err := x.db.Query(`SELECT path, hash FROM indexed_files WHERE model = ?`, x.model)
+	if err != nil {
+		return stats, err
+	}
+	for rows.Next() {
+		var path, hash string
+		if err := rows.Scan(&path, &hash); err != nil {
+			rows.Close()
+			return stats, err
+		}
+		known[path] = hash
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return stats, err
+	}
+
+	present := make(map[string]bool)
+	for _, file := range files {
+		text, err := repo.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		present[file] = true
+		sum := sha256.Sum256([]byte(text))
+		hash := hex.EncodeToString(sum[:])
+		if known[file] == hash {
+			continue
+		}
+
+		chunks := chunkFile(file, text)
+		vectors, err := x.embedChunks(ctx, chunks)
+		if err != nil {
+			return stats, fmt.Errorf("couldn't embed %s: %w", file, err)
+		}
+		if err := x.replaceFile(file, hash, chunks, vectors); err != nil {
+			return stats, err
+		}
+		stats.Embedded++
+		stats.Chunks += len(chunks)
+	}
+
+	stale, err := x.db.Query(`SELECT path FROM indexed_files`)
+	if err != nil {
+		return stats, err
+	}
+	var removed []string
+	for stale.Next() {
+		var path string
+		if err := stale.Scan(&path); err != nil {
+			stale.Close()
+			return stats, err
+		}
+		if !present[path] {
+			removed = append(removed, path)
+		}
+	}
+	stale.Close()
+	for _, path := range removed {
+		if err := x.replaceFile(path, "", nil, nil); err != nil {
+			return stats, err
+		}
+	}
+	stats.Removed = len(removed)
+	stats.Files = len(present)
+
+	x.mu.Lock()
+	x.chunks = nil
+	x.mu.Unlock()
+	return stats, nil
+}
+
+func (x *CodeIndex) embedChunks(ctx context.Context, chunks []CodeChunk) ([][]float32, error) {
+	var vectors [][]float32
+	for start := 0; start < len(chunks); start += embedBatchSize {
+		batch := chunks[start:min(start+embedBatchSize, len(chunks))]
+		texts := make([]string, len(batch))
+		for i, chunk := range batch {
+			// The path helps match questions that name a file or package.
+			texts[i] = chunk.Path + "\n" + chunk.Content
+		}
+		embedded, err := x.embedder.Embed(ctx, texts)
+		if err != nil {
+			return nil, err
+		}
+		if len(embedded) != len(texts) {
+			return nil, fmt.Errorf("got %d embeddings for %d chunks", len(embedded), len(texts))
+		}
+		vectors = append(vectors, embedded...)
+	}
+	return vectors, nil
+}
+
+// replaceFile swaps a file's chunks for new ones in one transaction. An
+// empty hash removes the file.
+func (x *CodeIndex) replaceFile(path, hash string, chunks []CodeChunk, vectors [][]float32) error {
+	tx, err := x.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM chunks WHERE path = ?`, path); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM indexed_files WHERE path = ?`, path); err != nil {
+		return err
+	}
+	if hash != "" {
+		for i, chunk := range chunks {
+			if _, err := tx.Exec(`INSERT INTO chunks (path, start_line, end_line, content, embedding) VALUES (?, ?, ?, ?, ?)`,
+				chunk.Path, chunk.StartLine, chunk.EndLine, chunk.Content, encodeVector(vectors[i])); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.Exec(`INSERT INTO indexed_files (path, hash, model, indexed_at) VALUES (?, ?, ?, ?)`,
+			path, hash, x.model, time.Now().UTC()); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Search returns the k chunks most similar to query, best first.
+func (x *CodeIndex) Search(ctx context.Context, query string, k int) ([]RetrievedChunk, error) {
+	chunks, err := x.load()
+	if err != nil {
+		return nil, err
+	}
+	if len(chunks) == 0 || k <= 0 {
+		return nil, nil
+	}
+	vectors, err := x.embedder.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, err
+	}
+	if len(vectors) != 1 {
+		return nil, fmt.Errorf("got %d embeddings for the query", len(vectors))
+	}
+
+	// Keep the best k in a min-heap.
+	best := &chunkHeap{}
+	for _, chunk := range chunks {
+		score := cosineSimilarity(vectors[0], chunk.vector)
+		if best.Len() < k {
+			heap.Push(best, RetrievedChunk{CodeChunk: chunk.CodeChunk, Score: score})
+		} else if score > (*best)[0].Score {
+			(*best)[0] = RetrievedChunk{CodeChunk: chunk.CodeChunk, Score: score}
+			heap.Fix(best, 0)
+		}
+	}
+	results := make([]RetrievedChunk, best.Len())
+	for i := len(results) - 1; i >= 0; i-- {
+		results[i] = heap.Pop(best).(RetrievedChunk)
+	}
+	return results, nil
+}
+
+// load reads every chunk into memory once; the index is small enough for
+// a linear scan, which avoids a vector database dependency.
+func (x *CodeIndex) load() ([]indexedChunk, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.chunks != nil {
+		return x.chunks, nil
+	}
+
+	rows, err := x.db.Query(`SELECT c.path, c.start_line, c.end_line, c.content, c.embedding
+		FROM chunks c JOIN indexed_files f ON f.path = c.path
+		WHERE f.model = ?`, x.model)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	chunks := []indexedChunk{}
+	for rows.Next() {
+		var chunk indexedChunk
+		var blob []byte
+		if err := rows.Scan(&chunk.Path, &chunk.StartLine, &chunk.EndLine, &chunk.Content, &blob); err != nil {
+			return nil, err
+		}
+		chunk.vector = decodeVector(blob)
+		chunks = append(chunks, chunk)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	x.chunks = chunks
+	return chunks, nil
+}
+
+// chunkFile splits text into overlapping windows of lines. Line numbers
+// are 1-based and inclusive.
+func chunkFile(path, text string) []CodeChunk {
+	text = strings.TrimRight(text, "\n")
+	if strings.TrimSpace(text) == "" {
+		return nil
+	}
+	lines := strings.Split(text, "\n")
+	var chunks []CodeChunk
+	for start := 0; start < len(lines); start += chunkLines - chunkOverlap {
+		end := min(start+chunkLines, len(lines))
+		content := strings.Join(lines[start:end], "\n")
+		if len(content) > maxChunkChars {
+			content = content[:maxChunkChars]
+		}
+		chunks = append(chunks, CodeChunk{Path: path, StartLine: start + 1, EndLine: end, Content: content})
+		if end == len(lines) {
+			break
+		}
+	}
+	return chunks
+}
+
+func encodeVector(v []float32) []byte {
+	b := make([]byte, 4*len(v))
+	for i, f := range v {
+		binary.LittleEndian.PutUint32(b[4*i:], math.Float32bits(f))
+	}
+	return b
+}
+
+func decodeVector(b []byte) []float32 {
+	v := make([]float32, len(b)/4)
+	for i := range v {
+		v[i] = math.Float32frombits(binary.LittleEndian.Uint32(b[4*i:]))
+	}
+	return v
+}
+
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(normA*normB)
+}
+
+// chunkHeap is a min-heap of retrieved chunks by score.
+type chunkHeap []RetrievedChunk
+
+func (h chunkHeap) Len() int           { return len(h) }
+func (h chunkHeap) Less(i, j int) bool { return h[i].Score < h[j].Score }
+func (h chunkHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *chunkHeap) Push(x any)        { *h = append(*h, x.(RetrievedChunk)) }
+func (h *chunkHeap) Pop() any {
+	old := *h
+	last := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return last
+}
+
+// runIndexCommand implements `escalator index`, which embeds a
+// repository's files into the index get_help retrieves context from.
+// Re-running it only embeds files that changed.
+func runIndexCommand(args []string, out io.Writer) int {
+	fs := flag.NewFlagSet("index", flag.ContinueOnError)
+	fs.SetOutput(out)
+	repoPath := fs.String("repo", ".", "Repository root to index")
+	dbPath := fs.String("db", defaultIndexPath(), "Path to the index database")
+	model := fs.String("model", defaultEmbeddingModel, "OpenAI embedding model")
+	baseURL := fs.String("base-url", "", "OpenAI-compatible API base URL (default: https://api.openai.com/v1)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if os.Getenv("OPENAI_API_KEY") == "" {
+		fmt.Fprintln(out, "OPENAI_API_KEY environment variable is required")
+		return 1
+	}
+
+	repo, err := OpenRepository(*repoPath)
+	if err != nil {
+		fmt.Fprintf(out, "Couldn't open repository: %v\n", err)
+		return 1
+	}
+	index, err := OpenCodeIndex(*dbPath, NewOpenAIEmbedder(*model, ClientOptions{BaseURL: *baseURL}), *model)
+	if err != nil {
+		fmt.Fprintf(out, "Couldn't open index: %v\n", err)
+		return 1
+	}
+	defer index.Close()
+
+	stats, err := index.Update(context.Background(), repo)
+	if err != nil {
+		fmt.Fprintf(out, "Couldn't update index: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(out, "Indexed %d files from %s (%d embedded as %d chunks, %d removed)\n",
+		stats.Files, repo.Root(), stats.Embedded, stats.Chunks, stats.Removed)
+	return 0
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// hashEmbedder embeds texts as bags of hashed words, so texts sharing words
+// are similar. It counts the texts it has embedded.
+type hashEmbedder struct {
+	embedded int
+}
+
+func (e *hashEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vector := make([]float32, 64)
+		for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+			return !('a' <= r && r <= 'z')
+		}) {
+			h := fnv.New32a()
+			h.Write([]byte(word))
+			vector[h.Sum32()%64]++
+		}
+		vectors[i] = vector
+	}
+	e.embedded += len(texts)
+	return vectors, nil
+}
+
+func openTestIndex(t *testing.T, embedder Embedder) *CodeIndex {
+	t.Helper()
+	index, err := OpenCodeIndex(filepath.Join(t.TempDir(), "index.db"), embedder, "test-embedding")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { index.Close() })
+	return index
+}
+
+func TestChunkFile(t *testing.T) {
+	var lines []string
+	for i := 1; i <= 120; i++ {
+		lines = append(lines, "line")
+	}
+	chunks := chunkFile("a.go", strings.Join(lines, "\n")+"\n")
+	var ranges []string
+	for _, chunk := range chunks {
+		ranges = append(ranges, fmt.Sprintf("%d-%d", chunk.StartLine, chunk.EndLine))
+	}
+	if got := strings.Join(ranges, " "); got != "1-60 51-110 101-120" {
+		t.Errorf("Expected overlapping chunks, got %s", got)
+	}
+	if chunks := chunkFile("empty.go", "\n\n"); len(chunks) != 0 {
+		t.Errorf("Expected no chunks for an empty file, got %d", len(chunks))
+	}
+}
+
+func TestCodeIndex_Update(t *testing.T) {
+	repo := testRepository(t)
+	embedder := &hashEmbedder{}
+	index := openTestIndex(t, embedder)
+
+	stats, err := index.Update(context.Background(), repo)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if stats.Files != 7 || stats.Embedded != 7 || stats.Removed != 0 {
+		t.Errorf("Expected 7 files embedded, got %+v", stats)
+	}
+
+	embedder.embedded = 0
+	if stats, _ = index.Update(context.Background(), repo); stats.Embedded != 0 || embedder.embedded != 0 {
+		t.Errorf("Expected unchanged files to be skipped, got %+v", stats)
+	}
+
+	os.WriteFile(filepath.Join(repo.Root(), "main.go"), []byte("package main\n\nfunc main() {}\n"), 0644)
+	os.Remove(filepath.Join(repo.Root(), "keep.log"))
+	stats, _ = index.Update(context.Background(), repo)
+	if stats.Files != 6 || stats.Embedded != 1 || stats.Removed != 1 {
+		t.Errorf("Expected one file re-embedded and one removed, got %+v", stats)
+	}
+
+	// Changing the embedding model re-embeds everything.
+	index.model = "other-embedding"
+	if stats, _ = index.Update(context.Background(), repo); stats.Embedded != 6 {
+		t.Errorf("Expected a new model to re-embed every file, got %+v", stats)
+	}
+}
+
+func TestCodeIndex_Search(t *testing.T) {
+	repo, _ := OpenRepository(writeTree(t, map[string]string{
+		"billing/invoice.go": "package billing\n\n// Invoice totals line items and applies tax.\nfunc InvoiceTotal(items []Item) Money\n",
+		"auth/session.go":    "package auth\n\n// Session tokens expire after an hour.\nfunc RefreshSession(token string) error\n",
+		"docs/notes.md":      "Deployment notes for the staging cluster.\n",
+	}))
+	index := openTestIndex(t, &hashEmbedder{})
+	if _, err := index.Update(context.Background(), repo); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := index.Search(context.Background(), "why do session tokens expire before refresh", 2)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 results, got %d", len(results))
+	}
+	if results[0].Path != "auth/session.go" || results[0].Score < results[1].Score {
+		t.Errorf("Expected auth/session.go first, got %+v", results)
+	}
+}
+
+func TestGetHelpTool_Call_RetrievesChunks(t *testing.T) {
+	repo, _ := OpenRepository(writeTree(t, map[string]string{
+		"billing/invoice.go": "package billing\n\n// Invoice totals line items and applies tax.\nfunc InvoiceTotal(items []Item) Money\n",
+		"auth/session.go":    "package auth\n\n// Session tokens expire after an hour.\nfunc RefreshSession(token string) error\n",
+	}))
+	index := openTestIndex(t, &hashEmbedder{})
+	if _, err := index.Update(context.Background(), repo); err != nil {
+		t.Fatal(err)
+	}
+
+	var prompt string
+	tool := NewGetHelpTool(writeTestSummary(t), "o3").WithRepository(repo).WithIndex(index, 1)
+	tool.LLM().WithProvider(CompletionFunc(func(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error) {
+		prompt = req.Messages[len(req.Messages)-1].Content
+		return &Completion{Answer: "answer", Model: req.Model}, nil
+	}))
+
+	content, err := tool.Call(map[string]interface{}{"question": "Why do session tokens expire?", "summary": "s"})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if !strings.Contains(prompt, "**Retrieved from auth/session.go:1-4:**") {
+		t.Errorf("Expected the retrieved chunk in the prompt, got %q", prompt)
+	}
+	sections := content[0]["_meta"].(map[string]interface{})["context_usage"].(*ContextUsage).Sections
+	if sections[len(sections)-1].Name != "retrieved auth/session.go:1-4" {
+		t.Errorf("Expected a retrieved section, got %+v", sections)
+	}
+
+	// A file the caller already named isn't retrieved again.
+	if _, err := tool.Call(map[string]interface{}{"question": "Why do session tokens expire?", "summary": "s", "files": []interface{}{"auth/session.go"}}); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if strings.Contains(prompt, "**Retrieved from") {
+		t.Errorf("Expected no duplicate of a named file, got %q", prompt)
+	}
+}
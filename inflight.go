@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// callGroup coalesces identical model calls in flight: while one caller's
+// call for a key is running, callers with the same key wait for it and
+// share its completion rather than paying for the same answer again.
+type callGroup struct {
+	mu    sync.Mutex
+	calls map[string]*groupCall
+}
+
+type groupCall struct {
+	done       chan struct{}
+	completion *Completion
+	err        error
+	// waiters counts the callers waiting for the call.
+	waiters int
+}
+
+// Do runs fn for key, unless a call for key is already in flight, in which
+// case it waits for that call instead. shared reports whether the result
+// came from another caller's call. A waiter whose call was abandoned by
+// the caller that made it, rather than failing, makes the call itself.
+func (g *callGroup) Do(ctx context.Context, key string, fn func() (*Completion, error)) (completion *Completion, shared bool, err error) {
+	for {
+		g.mu.Lock()
+		if g.calls == nil {
+			g.calls = make(map[string]*groupCall)
+		}
+		call, ok := g.calls[key]
+		if !ok {
+			call = &groupCall{done: make(chan struct{})}
+			g.calls[key] = call
+			g.mu.Unlock()
+
+			call.completion, call.err = fn()
+			g.mu.Lock()
+			delete(g.calls, key)
+			g.mu.Unlock()
+			close(call.done)
+			return call.completion, false, call.err
+		}
+		call.waiters++
+		g.mu.Unlock()
+
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		}
+		if errors.Is(call.err, context.Canceled) && ctx.Err() == nil {
+			continue
+		}
+		return call.completion, true, call.err
+	}
+}
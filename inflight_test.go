@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestGetHelpTool_Call_CoalescesIdenticalEscalations(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	tool := NewGetHelpTool("", "o3")
+	tool.LLM().WithProvider(CompletionFunc(func(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error) {
+		calls.Add(1)
+		<-release
+		return &Completion{Answer: "Guard the map with a mutex.", Model: req.Model, PromptTokens: 1000, CompletionTokens: 100}, nil
+	}))
+
+	const workers = 4
+	results := make([][]map[string]interface{}, workers)
+	var wg sync.WaitGroup
+	for i := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], _ = tool.Call(map[string]interface{}{"question": "Why does the cache race?", "summary": "s"})
+		}()
+	}
+	// Let every worker reach the call before it answers.
+	for waiting := 0; waiting < workers-1; time.Sleep(time.Millisecond) {
+		tool.inflight.mu.Lock()
+		waiting = 0
+		for _, call := range tool.inflight.calls {
+			waiting = call.waiters
+		}
+		tool.inflight.mu.Unlock()
+	}
+	close(release)
+	wg.Wait()
+
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("Expected one model call for %d identical escalations, got %d", workers, n)
+	}
+	shared, paid := 0, 0
+	for _, result := range results {
+		if result[0]["text"] != "Guard the map with a mutex." {
+			t.Errorf("Expected every worker to get the answer, got %v", result[0]["text"])
+		}
+		usage := result[0]["_meta"].(map[string]interface{})["usage"].(*TokenUsage)
+		if usage.Shared {
+			shared++
+		} else {
+			paid += usage.PromptTokens
+		}
+	}
+	if shared != workers-1 || paid != 1000 {
+		t.Errorf("Expected the tokens counted once and the rest shared, got %d shared and %d tokens", shared, paid)
+	}
+}
+
+func TestCallGroup_RetriesAbandonedCall(t *testing.T) {
+	var group callGroup
+	started := make(chan struct{})
+	go group.Do(context.Background(), "k", func() (*Completion, error) {
+		close(started)
+		time.Sleep(20 * time.Millisecond)
+		return nil, context.Canceled
+	})
+	<-started
+
+	completion, shared, err := group.Do(context.Background(), "k", func() (*Completion, error) {
+		return &Completion{Answer: "mine"}, nil
+	})
+	if err != nil || shared || completion.Answer != "mine" {
+		t.Errorf("Expected the waiter to make the call itself, got %v, %v, %v", completion, shared, err)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"text/template"
+)
+
+// initConfigTemplate is the config file written by `escalator init`. Paths
+// are single-quoted so Windows backslashes are read as they are.
+var initConfigTemplate = template.Must(template.New("config").Parse(`# Settings for the escalator, written by escalator init for {{.Platform}}.
+# Keys are flag names; run escalator -h for the full list. Secrets such as
+# OPENAI_API_KEY stay in the environment.
+
+model: o3
+# fallback_models: [gpt-4o, gpt-4o-mini]
+
+# The prompt sent to the model, and who answers it. Edit the files to change
+# them; escalator prompts test -prompt-template renders the template against
+# fixtures.
+prompt_template: '{{.PromptTemplate}}'
+persona: '{{.Persona}}'
+
+# Where the escalator keeps its data.
+history_db: '{{.HistoryDB}}'
+counters_db: '{{.CountersDB}}'
+# Logs go to {{.LogFile}} over stdio and to stderr with sse.
+# log_file: '{{.LogFile}}'
+# Run escalator index first to build it, then uncomment:
+# index_db: '{{.IndexDB}}'
+
+# budget:
+#   daily: 20
+#   monthly: 300
+# secret:
+#   scanners: regex,entropy
+# sse: true
+# listen: 127.0.0.1:9001
+`))
+
+// runInitCommand implements `escalator init`, which scaffolds a config
+// file, editable copies of the built-in prompt template and persona, and
+// the data directories, so a new install works without reading every flag.
+// Existing files are kept unless -force is given.
+func runInitCommand(args []string, out io.Writer) int {
+	fs := flag.NewFlagSet("init", flag.ContinueOnError)
+	fs.SetOutput(out)
+	dir := fs.String("dir", defaultDataDir(), "Directory the config, prompts and data are kept in")
+	force := fs.Bool("force", false, "Overwrite files that already exist")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(out, "Unexpected argument %q\n", fs.Arg(0))
+		return 2
+	}
+
+	root, err := filepath.Abs(*dir)
+	if err != nil {
+		fmt.Fprintf(out, "Couldn't resolve %s: %v\n", *dir, err)
+		return 1
+	}
+	if err := os.MkdirAll(filepath.Join(root, "prompts"), 0700); err != nil {
+		fmt.Fprintf(out, "Couldn't create %s: %v\n", root, err)
+		return 1
+	}
+
+	paths := map[string]string{
+		"Platform":       runtime.GOOS + "/" + runtime.GOARCH,
+		"PromptTemplate": filepath.Join(root, "prompts", "escalation.tmpl"),
+		"Persona":        filepath.Join(root, "prompts", defaultPersona+".md"),
+		"HistoryDB":      filepath.Join(root, "history.db"),
+		"CountersDB":     filepath.Join(root, "counters.db"),
+		"LogFile":        filepath.Join(root, "escalator.log"),
+		"IndexDB":        filepath.Join(root, "index.db"),
+	}
+	var config bytes.Buffer
+	if err := initConfigTemplate.Execute(&config, paths); err != nil {
+		fmt.Fprintf(out, "Couldn't render the config: %v\n", err)
+		return 1
+	}
+	configPath := filepath.Join(root, "escalator.yaml")
+	files := []struct {
+		path string
+		data string
+	}{
+		{configPath, config.String()},
+		{paths["PromptTemplate"], defaultPromptTemplateText},
+		{paths["Persona"], builtinPersonas[defaultPersona] + "\n"},
+	}
+	for _, file := range files {
+		if _, err := os.Stat(file.path); err == nil && !*force {
+			fmt.Fprintf(out, "Kept     %s\n", file.path)
+			continue
+		}
+		if err := os.WriteFile(file.path, []byte(file.data), 0600); err != nil {
+			fmt.Fprintf(out, "Couldn't write %s: %v\n", file.path, err)
+			return 1
+		}
+		fmt.Fprintf(out, "Created  %s\n", file.path)
+	}
+
+	fmt.Fprintf(out, "\nNext steps:\n")
+	if runtime.GOOS == "windows" {
+		fmt.Fprintf(out, "  setx OPENAI_API_KEY <your key>\n  setx ESCALATOR_CONFIG %s\n", configPath)
+	} else {
+		fmt.Fprintf(out, "  export OPENAI_API_KEY=<your key>\n  export ESCALATOR_CONFIG=%s\n", configPath)
+	}
+	fmt.Fprintf(out, "  escalator config validate %s\n  claude mcp add get_help \"escalator --config %s\" -t stdio\n", configPath, configPath)
+	return 0
+}
+
+// defaultDataDir is ~/.escalator, where the databases and log are kept by
+// default.
+func defaultDataDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".escalator"
+	}
+	return filepath.Join(home, ".escalator")
+}
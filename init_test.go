@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunInitCommand(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "escalator")
+	var out bytes.Buffer
+	if code := runInitCommand([]string{"-dir", dir}, &out); code != 0 {
+		t.Fatalf("Expected init to succeed, got %d:\n%s", code, out.String())
+	}
+
+	settings, err := LoadConfig(filepath.Join(dir, "escalator.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := make(map[string]string)
+	for _, setting := range settings {
+		values[setting.Key] = strings.Join(setting.Values, ",")
+	}
+	if values["history-db"] != filepath.Join(dir, "history.db") || values["model"] != "o3" {
+		t.Errorf("Expected the config to keep data under %s, got %v", dir, values)
+	}
+	if _, err := LoadPromptTemplate(values["prompt-template"], nil); err != nil {
+		t.Errorf("Expected the scaffolded prompt template to load, got %v", err)
+	}
+	if persona, err := LoadPersona(values["persona"]); err != nil || persona.Name != defaultPersona {
+		t.Errorf("Expected the scaffolded persona to load as %s, got %v, %v", defaultPersona, persona, err)
+	}
+
+	// Running it again keeps the files a user may have edited.
+	os.WriteFile(values["persona"], []byte("Answer tersely."), 0600)
+	out.Reset()
+	runInitCommand([]string{"-dir", dir}, &out)
+	if data, _ := os.ReadFile(values["persona"]); string(data) != "Answer tersely." || !strings.Contains(out.String(), "Kept") {
+		t.Errorf("Expected an edited persona kept, got %q:\n%s", data, out.String())
+	}
+	runInitCommand([]string{"-dir", dir, "-force"}, &out)
+	if data, _ := os.ReadFile(values["persona"]); string(data) == "Answer tersely." {
+		t.Error("Expected -force to overwrite the persona")
+	}
+}
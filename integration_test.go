@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Integration tests run the whole pipeline (prompt build, provider call,
+// post-processing) against recorded provider responses in
+// testdata/cassettes. To re-record them against the real provider:
+//
+//	ESCALATOR_CASSETTE_MODE=record OPENAI_API_KEY=sk-... go test -run Integration
+//
+// Re-record whenever a prompt template or request parameter changes, since
+// requests are matched on their exact body.
+
+const integrationSummary = "testdata/integration/summary.md"
+
+// cassetteOptions returns client options that replay the named cassette, or
+// record it when ESCALATOR_CASSETTE_MODE=record.
+func cassetteOptions(t *testing.T, name string) ClientOptions {
+	t.Helper()
+	withFastRetries(t)
+
+	mode := os.Getenv("ESCALATOR_CASSETTE_MODE")
+	if mode == "" {
+		mode = "replay"
+	}
+	// Requests are matched on their body, which labels the summary with its
+	// age, so pin the age whenever the file was checked out.
+	if info, err := os.Stat(integrationSummary); err == nil {
+		now := provenanceNow
+		provenanceNow = func() time.Time { return info.ModTime().Add(12 * 24 * time.Hour) }
+		t.Cleanup(func() { provenanceNow = now })
+	}
+
+	cassette, err := NewCassetteTransport(filepath.Join("testdata", "cassettes", name+".json"), mode)
+	if err != nil {
+		t.Fatalf("Couldn't open cassette: %v", err)
+	}
+	return ClientOptions{Transport: cassette}
+}
+
+func integrationGetHelpArgs() map[string]interface{} {
+	return map[string]interface{}{
+		"question":      "Stock levels are sometimes decremented twice after reconciliation. Why?",
+		"summary":       "inventory-service, Go + PostgreSQL",
+		"relevant_code": "func StartReconciler(ctx context.Context, db *pgxpool.Pool) {\n\tticker := time.NewTicker(time.Minute)\n\tfor range ticker.C {\n\t\treconcile(ctx, db)\n\t}\n}",
+	}
+}
+
+func integrationBrainstormArgs() map[string]interface{} {
+	return map[string]interface{}{
+		"problem":     "Background jobs run on every replica and must run once per cluster",
+		"constraints": "No new infrastructure beyond PostgreSQL",
+	}
+}
+
+func TestIntegration_GetHelp(t *testing.T) {
+	server := NewMCPServer("escalator", "1.0.0")
+	server.RegisterTool(NewGetHelpTool(integrationSummary, "o3").WithClientOptions(cassetteOptions(t, "get_help")))
+
+	params, _ := json.Marshal(map[string]interface{}{"name": "get_help", "arguments": integrationGetHelpArgs()})
+	result, errResp := server.HandleToolsCall(params)
+	if errResp != nil {
+		t.Fatalf("Unexpected error: %v", errResp)
+	}
+	if result.IsError {
+		t.Fatalf("Expected success, got %v", result.Content)
+	}
+
+	text := result.Content[0]["text"].(string)
+	if !strings.Contains(text, "pg_try_advisory_xact_lock") {
+		t.Errorf("Expected the recorded answer, got %q", text)
+	}
+
+	meta := result.Meta
+	usage := meta["usage"].(*TokenUsage)
+	if usage.Model != "o3" || usage.PromptTokens == 0 || usage.CostUSD == 0 {
+		t.Errorf("Expected usage from the provider response, got %+v", usage)
+	}
+	if context := meta["context_usage"].(*ContextUsage); context.PromptTokens != usage.PromptTokens {
+		t.Errorf("Expected context usage to use the reported prompt tokens, got %+v", context)
+	}
+}
+
+func TestIntegration_GetHelpStreaming(t *testing.T) {
+	tool := NewGetHelpTool(integrationSummary, "o3").WithClientOptions(cassetteOptions(t, "get_help_stream"))
+
+	var deltas []string
+	content, err := tool.CallStream(integrationGetHelpArgs(), func(delta string) {
+		deltas = append(deltas, delta)
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	text := content[0]["text"].(string)
+	if len(deltas) < 2 || strings.Join(deltas, "") != text {
+		t.Errorf("Expected the streamed chunks to add up to the answer, got %d chunks", len(deltas))
+	}
+	if usage := takeMeta(content)["usage"].(*TokenUsage); usage.CompletionTokens == 0 {
+		t.Errorf("Expected usage from the final stream chunk, got %+v", usage)
+	}
+}
+
+func TestIntegration_Brainstorm(t *testing.T) {
+	tool := NewBrainstormTool(NewLLM("o3").WithClientOptions(cassetteOptions(t, "brainstorm_options")))
+
+	content, err := tool.Call(integrationBrainstormArgs())
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	var result BrainstormResult
+	if err := json.Unmarshal([]byte(content[0]["text"].(string)), &result); err != nil {
+		t.Fatalf("Expected JSON result, got: %v", err)
+	}
+	if len(result.Options) != 3 || result.Recommendation.Option != 1 {
+		t.Errorf("Unexpected brainstorm result: %+v", result)
+	}
+}
+
+func TestCassetteTransport_ReplayMiss(t *testing.T) {
+	tool := NewGetHelpTool(integrationSummary, "o3").WithClientOptions(cassetteOptions(t, "get_help"))
+
+	args := integrationGetHelpArgs()
+	args["question"] = "A question that was never recorded"
+	if _, err := tool.Call(args); err == nil || !strings.Contains(err.Error(), "no unused interaction") {
+		t.Errorf("Expected an unrecorded request to fail, got: %v", err)
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const defaultGitHubAPI = "https://api.github.com"
+
+// maxIssueBodyChars keeps issue bodies under GitHub's 65,536 character
+// limit with room for the headings.
+const maxIssueBodyChars = 60000
+
+// GitHubIssues opens issues in one repository, authenticated with a token
+// that can write its issues.
+type GitHubIssues struct {
+	apiURL   string
+	repo     string
+	token    string
+	labels   []string
+	redactor *Redactor
+	client   *http.Client
+}
+
+// Issue is an opened GitHub issue.
+type Issue struct {
+	Number int    `json:"number"`
+	URL    string `json:"html_url"`
+}
+
+// NewGitHubIssues opens issues in repo, given as owner/name.
+func NewGitHubIssues(repo, token string) (*GitHubIssues, error) {
+	owner, name, ok := strings.Cut(repo, "/")
+	if !ok || owner == "" || name == "" || strings.Contains(name, "/") {
+		return nil, fmt.Errorf("GitHub repository must be owner/name, got %q", repo)
+	}
+	if token == "" {
+		return nil, fmt.Errorf("filing GitHub issues needs GITHUB_TOKEN")
+	}
+	return &GitHubIssues{apiURL: defaultGitHubAPI, repo: repo, token: token, client: &http.Client{Timeout: 30 * time.Second}}, nil
+}
+
+// WithAPIURL talks to another GitHub API, such as GitHub Enterprise's
+// https://github.example.com/api/v3.
+func (g *GitHubIssues) WithAPIURL(url string) *GitHubIssues {
+	g.apiURL = strings.TrimRight(url, "/")
+	return g
+}
+
+// WithLabels labels every issue opened.
+func (g *GitHubIssues) WithLabels(labels []string) *GitHubIssues {
+	g.labels = labels
+	return g
+}
+
+// WithRedactor redacts secrets from issues before they are opened.
+func (g *GitHubIssues) WithRedactor(redactor *Redactor) *GitHubIssues {
+	g.redactor = redactor
+	return g
+}
+
+// Repo is the repository issues are opened in.
+func (g *GitHubIssues) Repo() string {
+	return g.repo
+}
+
+// Create opens an issue with the configured labels and any extra ones.
+func (g *GitHubIssues) Create(ctx context.Context, title, body string, labels []string) (*Issue, error) {
+	if g.redactor != nil {
+		var findings []SecretFinding
+		var err error
+		if title, _, err = g.redactor.Redact(ctx, title); err != nil {
+			return nil, fmt.Errorf("couldn't scan for secrets: %w", err)
+		}
+		if body, findings, err = g.redactor.Redact(ctx, body); err != nil {
+			return nil, fmt.Errorf("couldn't scan for secrets: %w", err)
+		}
+		if len(findings) > 0 {
+			slog.Info("Redacted secrets from the issue", "secrets", len(findings))
+		}
+	}
+	payload, err := json.Marshal(map[string]interface{}{
+		"title":  title,
+		"body":   truncateMiddle(body, maxIssueBodyChars),
+		"labels": append(append([]string{}, g.labels...), labels...),
+	})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/repos/%s/issues", g.apiURL, g.repo), bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+g.token)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		reply, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("GitHub returned %s: %s", resp.Status, strings.TrimSpace(string(reply)))
+	}
+	var issue Issue
+	if err := json.NewDecoder(resp.Body).Decode(&issue); err != nil {
+		return nil, fmt.Errorf("couldn't parse the created issue: %w", err)
+	}
+	return &issue, nil
+}
+
+// issueTitle is the question's first line, shortened to fit an issue list.
+func issueTitle(question string) string {
+	title, _, _ := strings.Cut(strings.TrimSpace(question), "\n")
+	if len(title) > 100 {
+		title = title[:97] + "..."
+	}
+	return title
+}
+
+// issueBody lays an escalation out as a Markdown issue.
+func issueBody(question, summary, code, answer, confidence, escalationID string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "## Question\n\n%s\n", question)
+	if summary != "" {
+		fmt.Fprintf(&b, "\n## Project\n\n%s\n", summary)
+	}
+	if code != "" {
+		fmt.Fprintf(&b, "\n## Relevant code\n\n````\n%s\n````\n", strings.TrimRight(code, "\n"))
+	}
+	if answer != "" {
+		b.WriteString("\n## The model's answer")
+		if confidence != "" {
+			fmt.Fprintf(&b, " (confidence: %s)", confidence)
+		}
+		fmt.Fprintf(&b, "\n\n%s\n", answer)
+	}
+	if escalationID != "" {
+		fmt.Fprintf(&b, "\n---\nFiled from escalation `%s`.\n", escalationID)
+	}
+	return b.String()
+}
+
+// FileIssueTool turns an escalation that didn't settle the problem into
+// tracked work: it opens a GitHub issue with the question, the code and
+// the model's answer.
+type FileIssueTool struct {
+	help   *GetHelpTool
+	issues *GitHubIssues
+}
+
+func NewFileIssueTool(help *GetHelpTool, issues *GitHubIssues) *FileIssueTool {
+	return &FileIssueTool{help: help, issues: issues}
+}
+
+func (t *FileIssueTool) Name() string {
+	return "file_issue"
+}
+
+func (t *FileIssueTool) Category() string {
+	return "escalation/people"
+}
+
+func (t *FileIssueTool) Description() string {
+	return fmt.Sprintf("Open a GitHub issue in %s with the question, relevant code and the model's answer, to track a problem the escalation didn't settle", t.issues.Repo())
+}
+
+func (t *FileIssueTool) Schema() map[string]interface{} {
+	help := t.help.Schema()["properties"].(map[string]interface{})
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"question":      help["question"],
+			"summary":       help["summary"],
+			"relevant_code": help["relevant_code"],
+			"answer": map[string]interface{}{
+				"type":        "string",
+				"description": "The model's answer already received from get_help; when left out, get_help is asked first (optional)",
+			},
+			"title": map[string]interface{}{
+				"type":        "string",
+				"description": "Issue title (default: the question's first line)",
+			},
+			"labels": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "Labels added to the configured ones (optional)",
+			},
+		},
+		"required": []string{"question"},
+	}
+}
+
+func (t *FileIssueTool) Call(arguments map[string]interface{}) ([]map[string]interface{}, error) {
+	question, _ := arguments["question"].(string)
+	if strings.TrimSpace(question) == "" {
+		return textContent("Error: Missing required field: question"), fmt.Errorf("missing required fields")
+	}
+	summary, _ := arguments["summary"].(string)
+	code, _ := arguments["relevant_code"].(string)
+
+	answer, _ := arguments["answer"].(string)
+	confidence := ""
+	meta := map[string]interface{}{}
+	if strings.TrimSpace(answer) == "" {
+		asked := map[string]interface{}{}
+		for _, name := range []string{"question", "summary", "relevant_code"} {
+			if value, ok := arguments[name]; ok {
+				asked[name] = value
+			}
+		}
+		content, err := t.help.Call(asked)
+		structured := takeStructuredContent(content)
+		if usage, ok := takeMeta(content)["usage"]; ok {
+			meta["usage"] = usage
+		}
+		if err != nil {
+			slog.Warn("Couldn't get the model's answer before filing an issue", "tool", t.Name(), "error", err)
+		} else {
+			answer = contentText(content)
+			confidence, _ = structured["confidence"].(string)
+		}
+	}
+
+	title, _ := arguments["title"].(string)
+	if strings.TrimSpace(title) == "" {
+		title = issueTitle(question)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	issue, err := t.issues.Create(ctx, title, issueBody(question, summary, code, answer, confidence, ""), stringListArgument(arguments, "labels"))
+	if err != nil {
+		slog.Error("Couldn't file the issue", "tool", t.Name(), "error", err)
+		return textContent("Error: Couldn't open the GitHub issue. Please try again."), err
+	}
+	slog.Info("Filed an issue", "tool", t.Name(), "issue", issue.Number, "repo", t.issues.Repo())
+
+	meta["issue"] = issue
+	return withMeta(textContent(fmt.Sprintf("Filed issue #%d: %s", issue.Number, issue.URL)), meta), nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// listenAddress is the address the -sse server binds: listen, a host:port
+// or :port, or else the loopback address on port.
+func listenAddress(listen string, port int) (string, error) {
+	if listen == "" {
+		return net.JoinHostPort("127.0.0.1", strconv.Itoa(port)), nil
+	}
+	host, portText, err := net.SplitHostPort(listen)
+	if err != nil {
+		return "", fmt.Errorf("%q isn't a host:port address: %w", listen, err)
+	}
+	if n, err := strconv.Atoi(portText); err != nil || n < 0 || n > 65535 {
+		return "", fmt.Errorf("%q has an invalid port", listen)
+	}
+	if host != "" && host != "localhost" && net.ParseIP(host) == nil {
+		if _, err := net.LookupHost(host); err != nil {
+			return "", fmt.Errorf("%q: %w", listen, err)
+		}
+	}
+	return listen, nil
+}
+
+// isLoopback reports whether addr only accepts connections from this
+// machine. An empty or unspecified host, such as 0.0.0.0, listens on every
+// interface.
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// advertisedURL is the URL clients on this machine reach a server bound to
+// addr at, for defaults such as the OAuth resource.
+func advertisedURL(addr string, tls bool) string {
+	host, port, _ := net.SplitHostPort(addr)
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+	scheme := "http"
+	if tls {
+		scheme = "https"
+	}
+	return scheme + "://" + net.JoinHostPort(host, port)
+}
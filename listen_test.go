@@ -0,0 +1,37 @@
+package main
+
+import "testing"
+
+func TestListenAddress(t *testing.T) {
+	for _, tt := range []struct {
+		listen   string
+		want     string
+		loopback bool
+		url      string
+	}{
+		{"", "127.0.0.1:9001", true, "http://127.0.0.1:9001"},
+		{"0.0.0.0:8080", "0.0.0.0:8080", false, "http://127.0.0.1:8080"},
+		{":8080", ":8080", false, "http://127.0.0.1:8080"},
+		{"localhost:8080", "localhost:8080", true, "http://localhost:8080"},
+		{"[::1]:8080", "[::1]:8080", true, "http://[::1]:8080"},
+		{"10.0.0.5:8080", "10.0.0.5:8080", false, "http://10.0.0.5:8080"},
+	} {
+		addr, err := listenAddress(tt.listen, 9001)
+		if err != nil || addr != tt.want {
+			t.Errorf("listenAddress(%q) = %q, %v; want %q", tt.listen, addr, err, tt.want)
+			continue
+		}
+		if got := isLoopback(addr); got != tt.loopback {
+			t.Errorf("isLoopback(%q) = %v, want %v", addr, got, tt.loopback)
+		}
+		if got := advertisedURL(addr, false); got != tt.url {
+			t.Errorf("advertisedURL(%q) = %q, want %q", addr, got, tt.url)
+		}
+	}
+
+	for _, listen := range []string{"8080", "0.0.0.0", "0.0.0.0:http-alt", "0.0.0.0:70000"} {
+		if _, err := listenAddress(listen, 9001); err == nil {
+			t.Errorf("Expected %q to be refused", listen)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	defaultListEscalations = 20
+	maxListEscalations     = 100
+)
+
+// ListEscalationsTool lets agents look up past escalations so they can reuse
+// an earlier answer instead of asking the same question again.
+type ListEscalationsTool struct {
+	history *HistoryStore
+}
+
+func NewListEscalationsTool(history *HistoryStore) *ListEscalationsTool {
+	return &ListEscalationsTool{history: history}
+}
+
+func (t *ListEscalationsTool) Name() string {
+	return "list_escalations"
+}
+
+func (t *ListEscalationsTool) Category() string {
+	return "history"
+}
+
+func (t *ListEscalationsTool) Description() string {
+	return "List past escalations (newest first), optionally filtered by question text, or show one in full by ID"
+}
+
+func (t *ListEscalationsTool) Schema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"query": map[string]interface{}{
+				"type":        "string",
+				"description": "Only list escalations whose question contains this text (optional)",
+			},
+			"limit": map[string]interface{}{
+				"type":        "integer",
+				"description": fmt.Sprintf("Maximum number of escalations to list (default %d, max %d)", defaultListEscalations, maxListEscalations),
+			},
+			"id": map[string]interface{}{
+				"type":        "string",
+				"description": "Show the full question and answer of this escalation instead of listing (optional)",
+			},
+		},
+	}
+}
+
+func (t *ListEscalationsTool) Call(arguments map[string]interface{}) ([]map[string]interface{}, error) {
+	if id, _ := arguments["id"].(string); id != "" {
+		rec, err := t.history.Get(id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return textContent(fmt.Sprintf("Error: No escalation with ID %s", id)), err
+		}
+		if err != nil {
+			return textContent("Error: Couldn't read escalation history"), err
+		}
+		text := formatRecord(*rec)
+		if outcome, err := t.history.Outcome(rec.ID); err == nil && outcome != nil {
+			text += formatOutcome(outcome)
+		}
+		if rec.stale(time.Now()) {
+			reaskID := ""
+			if rec.Tool == "get_help" && rec.Arguments != nil {
+				reaskID = rec.ID
+			}
+			text += staleNotice(rec.CreatedAt, reaskID)
+		}
+		return textContent(text), nil
+	}
+
+	query, _ := arguments["query"].(string)
+	limit := clampInt(intArgument(arguments, "limit", defaultListEscalations), 1, maxListEscalations)
+
+	records, err := t.history.Recent(limit, query)
+	if err != nil {
+		return textContent("Error: Couldn't read escalation history"), err
+	}
+	if len(records) == 0 {
+		return textContent("No escalations found."), nil
+	}
+
+	lines := make([]string, len(records))
+	for i, rec := range records {
+		lines[i] = formatRecordLine(rec)
+	}
+	return textContent(strings.Join(lines, "\n")), nil
+}
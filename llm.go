@@ -0,0 +1,358 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/dratner/code-escalator/pkg/llm"
+	"github.com/sashabaranov/go-openai"
+)
+
+// LLM sends prompts to a Provider (OpenAI by default) with retries and model fallback. It is shared
+// by every tool that escalates to the architect model.
+type LLM struct {
+	modelName      string
+	clientOptions  ClientOptions
+	fallbackModels []string
+	budget         *Budget
+	provider       Provider
+	redactor       *Redactor
+	scrubber       *Redactor
+	approval       *ApprovalGate
+	tracker        *ErrorTracker
+	metrics        *Metrics
+	audit          *AuditLog
+	variants       *PromptVariants
+	watcher        *ModelWatcher
+	calls          *CallLimiter
+	breaker        *CircuitBreaker
+	retry          *RetryPolicy
+}
+
+func NewLLM(modelName string) *LLM {
+	return &LLM{modelName: modelName}
+}
+
+// WithClientOptions sets the options used to construct the OpenAI client.
+func (l *LLM) WithClientOptions(opts ClientOptions) *LLM {
+	l.clientOptions = opts
+	return l
+}
+
+// WithFallbackModels sets the models tried, in order, when the primary
+// model still fails after retries.
+func (l *LLM) WithFallbackModels(models []string) *LLM {
+	l.fallbackModels = models
+	return l
+}
+
+// WithProvider replaces the OpenAI client with another backend. The client
+// options are then unused.
+func (l *LLM) WithProvider(provider Provider) *LLM {
+	l.provider = provider
+	return l
+}
+
+// WithBudget makes every call count against budget, and refuses calls once
+// it is exhausted.
+func (l *LLM) WithBudget(budget *Budget) *LLM {
+	l.budget = budget
+	return l
+}
+
+// WithRedactor scans every request for secrets and redacts them before it
+// leaves the process.
+func (l *LLM) WithRedactor(redactor *Redactor) *LLM {
+	l.redactor = redactor
+	return l
+}
+
+// WithPIIScrubber masks personal data in every request, after secrets
+// are redacted.
+func (l *LLM) WithPIIScrubber(scrubber *Redactor) *LLM {
+	l.scrubber = scrubber
+	return l
+}
+
+// WithApproval holds requests that need approval until an approver
+// decides on them.
+func (l *LLM) WithApproval(gate *ApprovalGate) *LLM {
+	l.approval = gate
+	return l
+}
+
+// WithErrorTracker reports calls that fail on every model in the chain.
+func (l *LLM) WithErrorTracker(tracker *ErrorTracker) *LLM {
+	l.tracker = tracker
+	return l
+}
+
+// WithMetrics records each model's latency, retries, fallbacks and errors.
+func (l *LLM) WithMetrics(metrics *Metrics) *LLM {
+	l.metrics = metrics
+	return l
+}
+
+// WithAuditLog records every request sent to a model, and the reply.
+func (l *LLM) WithAuditLog(audit *AuditLog) *LLM {
+	l.audit = audit
+	return l
+}
+
+// WithModelWatcher sends calls to a retired model to the successor the
+// watcher migrated it to.
+func (l *LLM) WithModelWatcher(watcher *ModelWatcher) *LLM {
+	l.watcher = watcher
+	return l
+}
+
+// WithCallLimiter makes calls wait for a slot in limiter, which caps the
+// calls in flight across every backend sharing it.
+func (l *LLM) WithCallLimiter(limiter *CallLimiter) *LLM {
+	l.calls = limiter
+	return l
+}
+
+// WithCircuitBreaker stops calling models whose circuit the breaker has
+// opened, moving on to the next model in the chain.
+func (l *LLM) WithCircuitBreaker(breaker *CircuitBreaker) *LLM {
+	l.breaker = breaker
+	return l
+}
+
+// WithRetryPolicy replaces the default policy for retrying failed calls.
+func (l *LLM) WithRetryPolicy(policy RetryPolicy) *LLM {
+	l.retry = &policy
+	return l
+}
+
+// retryPolicy is the policy set with WithRetryPolicy, or the default.
+func (l *LLM) retryPolicy() RetryPolicy {
+	if l.retry == nil {
+		return defaultRetryPolicy
+	}
+	return *l.retry
+}
+
+// withPromptVariants returns a copy of the backend that adapts the prompt
+// to the family of each model it tries. Only get_help prompts are adapted,
+// so the variants aren't set on the shared backend itself.
+func (l *LLM) withPromptVariants(variants *PromptVariants) *LLM {
+	if variants == nil {
+		return l
+	}
+	adapted := *l
+	adapted.variants = variants
+	return &adapted
+}
+
+// ForModel returns a copy of the backend that uses only the given model,
+// sharing everything else but the fallback chain.
+func (l *LLM) ForModel(model string) *LLM {
+	c := *l
+	c.modelName = model
+	c.fallbackModels = nil
+	return &c
+}
+
+// WithPrimary returns a copy of the backend that uses model as the primary
+// model while keeping everything else, the fallback chain included.
+func (l *LLM) WithPrimary(model string) *LLM {
+	c := *l
+	c.modelName = model
+	return &c
+}
+
+// userRequest wraps a prompt in a single user message.
+func userRequest(prompt string) openai.ChatCompletionRequest {
+	return openai.ChatCompletionRequest{
+		Messages: []openai.ChatCompletionMessage{
+			{
+				Role:    openai.ChatMessageRoleUser,
+				Content: prompt,
+			},
+		},
+	}
+}
+
+// Ask sends a single user prompt, streaming the response through onDelta
+// when it is non-nil.
+func (l *LLM) Ask(ctx context.Context, prompt string, onDelta func(string)) (string, error) {
+	return l.Complete(ctx, userRequest(prompt), onDelta)
+}
+
+// Complete is Generate for callers that only need the answer text.
+func (l *LLM) Complete(ctx context.Context, req openai.ChatCompletionRequest, onDelta func(string)) (string, error) {
+	completion, err := l.Generate(ctx, req, onDelta)
+	if err != nil {
+		return "", err
+	}
+	return completion.Answer, nil
+}
+
+// Generate sends the request to each model in the chain until one answers.
+// The request's Model field is filled in per attempt. If the primary model
+// keeps failing after retries, each fallback model is tried in order.
+func (l *LLM) Generate(ctx context.Context, req openai.ChatCompletionRequest, onDelta func(string)) (*Completion, error) {
+	if l.budget != nil {
+		if err := l.budget.Check(); err != nil {
+			slog.WarnContext(ctx, "Refusing model call", "model", l.modelName, "error", err)
+			return nil, err
+		}
+	}
+
+	// masked counts what was replaced, by kind, for the audit log.
+	req, masked, err := l.mask(ctx, req)
+	if err != nil {
+		slog.WarnContext(ctx, "Refusing model call", "model", l.modelName, "error", err)
+		return nil, err
+	}
+
+	// Approvers see the request as it will be sent, secrets redacted.
+	if l.approval != nil {
+		if err := l.approval.Approve(ctx, l.modelName, req); err != nil {
+			slog.WarnContext(ctx, "Refusing model call", "model", l.modelName, "error", err)
+			return nil, err
+		}
+	}
+
+	provider := l.provider
+	if provider == nil {
+		provider = newOpenAIProvider(l.clientOptions)
+	}
+
+	release, err := l.calls.Acquire(ctx)
+	if err != nil {
+		slog.WarnContext(ctx, "Refusing model call", "model", l.modelName, "error", err)
+		return nil, err
+	}
+	defer release()
+
+	streamed := false
+	var forward func(string)
+	if onDelta != nil {
+		forward = func(delta string) {
+			streamed = true
+			onDelta(delta)
+		}
+	}
+
+	var lastErr error
+	for i, model := range l.modelChain() {
+		if i > 0 {
+			slog.WarnContext(ctx, "Falling back to another model", "model", model, "error", lastErr)
+			l.metrics.Fallback(l.modelChain()[i-1])
+		}
+
+		model = l.watcher.Resolve(model)
+		if err := l.breaker.Allow(model); err != nil {
+			slog.WarnContext(ctx, "Skipping a model whose circuit is open", "model", model, "error", err)
+			lastErr = err
+			continue
+		}
+		req.Model = model
+		attempt, err := l.variants.Adapt(model, req)
+		if err != nil {
+			slog.WarnContext(ctx, "Sending the prompt unadapted", "model", model, "error", err)
+			attempt = req
+		}
+		start := time.Now()
+		modelCtx, span := startSpan(ctx, "chat "+model, spanKindClient)
+		span.SetAttributes("gen_ai.operation.name", "chat", "gen_ai.system", "openai", "gen_ai.request.model", model)
+		retries := 0
+		completion, err := askModel(modelCtx, provider, attempt, forward, &streamed, l.retryPolicy(), func(err error) {
+			retries++
+			l.metrics.Retry(model, err)
+		})
+		l.metrics.ModelCall(model, time.Since(start), err)
+		l.breaker.Record(model, err)
+		l.audit.ModelCall(ctx, attempt, completion, masked, err)
+		span.SetAttributes("escalator.retries", retries)
+		if err == nil {
+			span.SetAttributes("gen_ai.response.model", completion.Model, "gen_ai.usage.input_tokens", completion.PromptTokens, "gen_ai.usage.output_tokens", completion.CompletionTokens)
+		}
+		span.End(err)
+		if err == nil {
+			if l.budget != nil {
+				l.budget.Spend(estimateCost(completion.Model, completion.PromptTokens, completion.CompletionTokens))
+			}
+			return completion, nil
+		}
+		lastErr = err
+
+		// Partial output has already reached the caller, and the context
+		// budget is shared by the whole chain.
+		if streamed || ctx.Err() != nil {
+			break
+		}
+	}
+
+	if ctx.Err() == nil && !errors.Is(lastErr, ErrCircuitOpen) {
+		l.tracker.ReportError(lastErr, map[string]string{"component": "provider", "model": l.modelName})
+	}
+	return nil, lastErr
+}
+
+// mask redacts secrets and masks personal data in req, returning the
+// request as it will be sent and what was replaced, by kind.
+func (l *LLM) mask(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionRequest, map[string]int, error) {
+	masked := make(map[string]int)
+	if l.redactor != nil {
+		var err error
+		var kinds map[string]int
+		if req, kinds, err = l.redactor.redactRequest(ctx, req); err != nil {
+			return req, nil, fmt.Errorf("couldn't scan the request for secrets: %w", err)
+		}
+		for kind, n := range kinds {
+			masked[kind] += n
+		}
+	}
+	if l.scrubber != nil {
+		var err error
+		var kinds map[string]int
+		if req, kinds, err = l.scrubber.redactRequest(ctx, req); err != nil {
+			return req, nil, fmt.Errorf("couldn't scan the request for PII: %w", err)
+		}
+		for kind, n := range kinds {
+			masked["pii:"+kind] += n
+		}
+	}
+	return req, masked, nil
+}
+
+// modelChain returns the primary model followed by the fallback models.
+func (l *LLM) modelChain() []string {
+	model := l.modelName
+	if model == "" {
+		model = "o3" // default
+	}
+	return append([]string{model}, l.fallbackModels...)
+}
+
+// askModel calls a single model, retrying attempts that failed in a way
+// that may pass, as the policy allows. retrying is told of each failed
+// attempt before it is retried.
+func askModel(ctx context.Context, provider Provider, req openai.ChatCompletionRequest, onDelta func(string), streamed *bool, policy RetryPolicy, retrying func(error)) (*Completion, error) {
+	attempts := max(policy.Attempts, 1)
+	for attempt := range attempts {
+		attemptCtx, retryAfter := withRetryAfter(ctx)
+		completion, err := llm.Generate(attemptCtx, provider, req, onDelta)
+		if err == nil {
+			return completion, nil
+		}
+
+		// Partial output has already reached the caller, so a retry
+		// would duplicate it.
+		if *streamed || attempt == attempts-1 || ctx.Err() != nil || !isRetryable(err) {
+			return nil, err
+		}
+		retrying(err)
+		if !sleepContext(ctx, policy.delay(attempt, *retryAfter)) {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("max retries exceeded")
+}
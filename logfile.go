@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// logFileStderr is the -log-file value that logs to stderr.
+const logFileStderr = "stderr"
+
+func defaultLogPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "escalator.log"
+	}
+	return filepath.Join(home, ".escalator", "escalator.log")
+}
+
+// RotatingFile is a log file that is rotated once it grows past a size:
+// escalator.log becomes escalator.log.1, escalator.log.1 becomes
+// escalator.log.2, and so on, keeping a fixed number of old files. When
+// several servers share one file, whichever passes the limit first rotates
+// it and the others follow on to the new file.
+type RotatingFile struct {
+	mu       sync.Mutex
+	path     string
+	maxBytes int64
+	keep     int
+	file     *os.File
+}
+
+// OpenRotatingFile opens path for appending, creating its directory. A
+// maxBytes of 0 never rotates.
+func OpenRotatingFile(path string, maxBytes int64, keep int) (*RotatingFile, error) {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, err
+		}
+	}
+	r := &RotatingFile{path: path, maxBytes: maxBytes, keep: keep}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *RotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	r.file = f
+	return nil
+}
+
+// Write appends p, rotating first if p would take the file past its limit.
+// The size is read from the file rather than counted, so writes by other
+// servers count too. A failed rotation is reported on stderr and the file
+// keeps growing, so entries are never lost to it.
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.maxBytes > 0 {
+		if info, err := r.file.Stat(); err == nil && info.Size() > 0 && info.Size()+int64(len(p)) > r.maxBytes {
+			if err := r.rotate(); err != nil {
+				fmt.Fprintf(os.Stderr, "Couldn't rotate the log file %s: %v\n", r.path, err)
+			}
+		}
+	}
+	return r.file.Write(p)
+}
+
+// rotate shifts the old files along and starts a new one. Files are closed
+// before they are renamed, which Windows requires.
+func (r *RotatingFile) rotate() error {
+	current, err := r.file.Stat()
+	if err != nil {
+		return err
+	}
+	if latest, err := os.Stat(r.path); err == nil && !os.SameFile(current, latest) {
+		// Another server already rotated it.
+		r.file.Close()
+		return r.open()
+	}
+
+	r.file.Close()
+	var renameErr error
+	if r.keep > 0 {
+		for i := r.keep - 1; i > 0; i-- {
+			os.Rename(r.backup(i), r.backup(i+1))
+		}
+		renameErr = os.Rename(r.path, r.backup(1))
+	} else {
+		renameErr = os.Truncate(r.path, 0)
+	}
+	if err := r.open(); err != nil {
+		return err
+	}
+	return renameErr
+}
+
+func (r *RotatingFile) backup(i int) string {
+	return fmt.Sprintf("%s.%d", r.path, i)
+}
+
+// Close closes the current file.
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.file.Close()
+}
+
+// openLogOutput resolves -log-file: stderr, or a rotating file at path. An
+// empty path means the default file in stdio mode and stderr with -sse,
+// since stdout carries the protocol in stdio mode.
+func openLogOutput(path string, sse bool, maxBytes int64, keep int) (io.Writer, error) {
+	if path == "" {
+		if sse {
+			return os.Stderr, nil
+		}
+		path = defaultLogPath()
+	}
+	if path == logFileStderr {
+		return os.Stderr, nil
+	}
+	return OpenRotatingFile(path, maxBytes, keep)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRotatingFile_Write(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "escalator.log")
+	file, err := OpenRotatingFile(path, 20, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	for _, line := range []string{"first entry\n", "second entry\n", "third entry\n", "fourth entry\n"} {
+		if _, err := file.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for path, want := range map[string]string{
+		path:        "fourth entry\n",
+		path + ".1": "third entry\n",
+		path + ".2": "second entry\n",
+	} {
+		if got, _ := os.ReadFile(path); string(got) != want {
+			t.Errorf("Expected %s to hold %q, got %q", filepath.Base(path), want, got)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("Expected only -log-max-files old files to be kept, got %v", err)
+	}
+}
+
+func TestRotatingFile_SharedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "escalator.log")
+	a, _ := OpenRotatingFile(path, 20, 1)
+	defer a.Close()
+	b, _ := OpenRotatingFile(path, 20, 1)
+	defer b.Close()
+
+	a.Write([]byte("a: first entry\n"))
+	a.Write([]byte("a: second entry\n"))
+	// b passes the limit next, after a already rotated the file.
+	b.Write([]byte("b: an entry that's long\n"))
+
+	got, _ := os.ReadFile(path)
+	if !strings.Contains(string(got), "a: second entry") || !strings.Contains(string(got), "b: an entry") {
+		t.Errorf("Expected b to follow a onto the new file, got %q", got)
+	}
+	if old, _ := os.ReadFile(path + ".1"); string(old) != "a: first entry\n" {
+		t.Errorf("Expected the rotated file to be kept, got %q", old)
+	}
+}
+
+func TestOpenLogOutput(t *testing.T) {
+	for _, c := range []struct {
+		path string
+		sse  bool
+	}{{"stderr", false}, {"", true}} {
+		if out, err := openLogOutput(c.path, c.sse, 0, 0); err != nil || out != os.Stderr {
+			t.Errorf("Expected stderr for %q (sse %v), got %v, %v", c.path, c.sse, out, err)
+		}
+	}
+	path := filepath.Join(t.TempDir(), "escalator.log")
+	out, err := openLogOutput(path, true, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out.(*RotatingFile).Close()
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("Expected the log file to be created, got %v", err)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// Log formats accepted by -log-format.
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// newLogHandler builds the handler every entry goes through: level is one
+// of debug, info, warn or error, and format is text (key=value pairs) or
+// json (one object per line).
+func newLogHandler(w io.Writer, level, format string) (slog.Handler, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("unknown log level %q (want debug, info, warn or error)", level)
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+	switch strings.ToLower(format) {
+	case logFormatText:
+		return callerHandler{slog.NewTextHandler(w, opts)}, nil
+	case logFormatJSON:
+		return callerHandler{slog.NewJSONHandler(w, opts)}, nil
+	}
+	return nil, fmt.Errorf("unknown log format %q (want text or json)", format)
+}
+
+// callerHandler adds the request_id and client of the tool call in the
+// context to entries logged with it (slog.InfoContext and the like), so
+// everything a tool and its model calls log can be matched to the call.
+type callerHandler struct {
+	slog.Handler
+}
+
+func (h callerHandler) Handle(ctx context.Context, r slog.Record) error {
+	if caller := callerFrom(ctx); caller.RequestID != "" {
+		r = r.Clone()
+		r.AddAttrs(slog.String("request_id", caller.RequestID), slog.String("client", caller.Client))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h callerHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return callerHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h callerHandler) WithGroup(name string) slog.Handler {
+	return callerHandler{h.Handler.WithGroup(name)}
+}
+
+// newRequestID identifies one tool call across its log entries.
+func newRequestID() string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// callLogger scopes entries to one tool call.
+func callLogger(requestID, client, toolName string) *slog.Logger {
+	return slog.With("request_id", requestID, "client", client, "tool", toolName)
+}
+
+// finishCall logs a tool call's outcome, with the model that answered when
+// the tool reported usage, records it in the metrics and ends the call's
+// span.
+func (s *MCPServer) finishCall(logger *slog.Logger, span *Span, toolName string, meta map[string]interface{}, elapsed time.Duration, err error) {
+	usage, _ := meta["usage"].(*TokenUsage)
+	s.metrics.ToolCall(toolName, elapsed, usage, err)
+	if usage != nil {
+		span.SetAttributes("gen_ai.usage.input_tokens", usage.PromptTokens, "gen_ai.usage.output_tokens", usage.CompletionTokens, "escalator.cached", usage.Cached)
+	}
+	span.End(err)
+	args := []any{"duration_ms", elapsed.Milliseconds()}
+	if usage != nil && usage.Model != "" {
+		args = append(args, "model", usage.Model)
+	}
+	if err != nil {
+		logger.Error("Tool call failed", append(args, "error", err)...)
+		return
+	}
+	logger.Info("Tool call completed", args...)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestNewLogHandler(t *testing.T) {
+	var out bytes.Buffer
+	handler, err := newLogHandler(&out, "WARN", logFormatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(handler)
+	logger.Info("Quiet")
+	logger.Warn("Loud", "tool", "get_help")
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &entry); err != nil {
+		t.Fatalf("Expected a single JSON entry, got %q: %v", out.String(), err)
+	}
+	if entry["msg"] != "Loud" || entry["level"] != "WARN" || entry["tool"] != "get_help" {
+		t.Errorf("Expected the warning with its fields, got %v", entry)
+	}
+
+	for _, args := range [][2]string{{"verbose", logFormatText}, {"info", "xml"}} {
+		if _, err := newLogHandler(&out, args[0], args[1]); err == nil {
+			t.Errorf("Expected an error for level %q, format %q", args[0], args[1])
+		}
+	}
+}
+
+func TestMCPServer_HandleToolsCall_Logs(t *testing.T) {
+	var out bytes.Buffer
+	handler, _ := newLogHandler(&out, "debug", logFormatJSON)
+	// Setting a handler redirects the log package too, and restoring the
+	// default logger doesn't undo that.
+	defer log.SetOutput(log.Writer())
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(handler))
+
+	tool := NewGetHelpTool("", "o3")
+	tool.LLM().WithProvider(CompletionFunc(func(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error) {
+		return &Completion{Answer: "Add an index.", Model: req.Model, PromptTokens: 100, CompletionTokens: 10}, nil
+	}))
+	server := NewMCPServer("test", "1.0.0")
+	server.RegisterTool(tool)
+	server.HandleToolsCall(json.RawMessage(`{"name":"get_help","arguments":{"question":"Why is the query slow?","summary":"s"}}`))
+
+	var requestID string
+	sawUsage := false
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("Expected JSON entries, got %q", line)
+		}
+		// Entries logged while the tool runs carry the request ID as well.
+		if entry["msg"] != "Tool call started" && entry["msg"] != "Tool call completed" && entry["msg"] != "Token usage" {
+			continue
+		}
+		id, _ := entry["request_id"].(string)
+		if id == "" || (requestID != "" && id != requestID) || entry["tool"] != "get_help" || entry["client"] == nil {
+			t.Errorf("Expected entries scoped to one request, got %v", entry)
+		}
+		requestID = id
+		sawUsage = sawUsage || entry["msg"] == "Token usage"
+		if entry["msg"] == "Tool call completed" && (entry["model"] != "o3" || entry["duration_ms"] == nil) {
+			t.Errorf("Expected the model and duration, got %v", entry)
+		}
+	}
+	if requestID == "" || !sawUsage {
+		t.Errorf("Expected the call and its token usage to be logged, got:\n%s", out.String())
+	}
+}
@@ -0,0 +1,607 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/textproto"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxLSPSymbols bounds how many symbols of a question are looked up.
+	maxLSPSymbols = 5
+	// maxLSPReferences bounds how many references of a symbol are listed.
+	maxLSPReferences = 10
+	// maxLSPDefinitionLines bounds how much of a definition is included.
+	maxLSPDefinitionLines = 80
+)
+
+// LSPClient asks a language server such as gopls about the symbols named
+// in a question. The server is started on the first lookup, in the
+// repository root, and restarted if it exits.
+type LSPClient struct {
+	command []string
+	root    string
+
+	mu   sync.Mutex
+	cmd  *exec.Cmd
+	conn *lspConn
+}
+
+// NewLSPClient runs command (split on spaces) as the language server of
+// the workspace at root.
+func NewLSPClient(command, root string) (*LSPClient, error) {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("empty language server command")
+	}
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	return &LSPClient{command: fields, root: abs}, nil
+}
+
+// SymbolInfo is what the language server knows about a symbol.
+type SymbolInfo struct {
+	Name string
+	Kind string
+	// Path is relative to the root, and Line starts at 1.
+	Path string
+	Line int
+	// Hover is the symbol's signature and documentation.
+	Hover string
+	// Definition is the source of the declaration.
+	Definition string
+	// References lists up to maxLSPReferences other uses as path:line, of
+	// ReferenceCount in all.
+	References     []string
+	ReferenceCount int
+}
+
+// Lookup resolves a symbol's definition, hover documentation and
+// references. It returns nil when the workspace has no such symbol.
+func (c *LSPClient) Lookup(ctx context.Context, name string) (*SymbolInfo, error) {
+	conn, err := c.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var symbols []lspSymbol
+	if err := conn.Call(ctx, "workspace/symbol", map[string]interface{}{"query": name}, &symbols); err != nil {
+		return nil, err
+	}
+	symbol := c.match(symbols, name)
+	if symbol == nil {
+		return nil, nil
+	}
+	path, inside := c.path(symbol.Location.URI)
+	file := path
+	if inside {
+		file = filepath.Join(c.root, path)
+	}
+	info := &SymbolInfo{
+		Name: symbol.Name,
+		Kind: lspSymbolKind(symbol.Kind),
+		Path: path,
+		Line: symbol.Location.Range.Start.Line + 1,
+	}
+	position := map[string]interface{}{
+		"textDocument": map[string]string{"uri": symbol.Location.URI},
+		"position":     symbol.Location.Range.Start,
+	}
+
+	var hover struct {
+		Contents json.RawMessage `json:"contents"`
+	}
+	if err := conn.Call(ctx, "textDocument/hover", position, &hover); err != nil {
+		return nil, err
+	}
+	info.Hover = lspHoverText(hover.Contents)
+
+	// The document's symbols span whole declarations, where the workspace
+	// symbol spans only the name.
+	var outline []lspDocumentSymbol
+	if err := conn.Call(ctx, "textDocument/documentSymbol", map[string]interface{}{"textDocument": map[string]string{"uri": symbol.Location.URI}}, &outline); err != nil {
+		return nil, err
+	}
+	declaration := symbol.Location.Range
+	if enclosing := enclosingSymbol(outline, symbol.Location.Range.Start); enclosing != nil {
+		declaration = enclosing.Range
+	}
+	info.Definition = readLines(file, declaration.Start.Line, declaration.End.Line)
+
+	var references []lspLocation
+	position["context"] = map[string]bool{"includeDeclaration": false}
+	if err := conn.Call(ctx, "textDocument/references", position, &references); err != nil {
+		return nil, err
+	}
+	info.ReferenceCount = len(references)
+	for _, reference := range references[:min(len(references), maxLSPReferences)] {
+		path, _ := c.path(reference.URI)
+		info.References = append(info.References, fmt.Sprintf("%s:%d", path, reference.Range.Start.Line+1))
+	}
+	return info, nil
+}
+
+// match picks the symbol named name, or Type.Method for name Method,
+// preferring symbols in the workspace over its dependencies.
+func (c *LSPClient) match(symbols []lspSymbol, name string) *lspSymbol {
+	var found *lspSymbol
+	for i, symbol := range symbols {
+		qualified := symbol.Name
+		if symbol.ContainerName != "" {
+			qualified = symbol.ContainerName + "." + symbol.Name
+		}
+		if symbol.Name != name && !strings.HasSuffix(qualified, "."+name) {
+			continue
+		}
+		if _, inside := c.path(symbol.Location.URI); inside {
+			return &symbols[i]
+		}
+		if found == nil {
+			found = &symbols[i]
+		}
+	}
+	return found
+}
+
+// path turns a file URI into a path relative to the root, reporting
+// whether the file is inside it. Files outside keep their absolute path.
+func (c *LSPClient) path(uri string) (string, bool) {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri, false
+	}
+	path := filepath.FromSlash(u.Path)
+	rel, err := filepath.Rel(c.root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return path, false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// connect returns the connection to the running server, starting it if
+// it isn't running.
+func (c *LSPClient) connect(ctx context.Context) (*lspConn, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn != nil && !c.conn.isClosed() {
+		return c.conn, nil
+	}
+
+	cmd := exec.Command(c.command[0], c.command[1:]...)
+	cmd.Dir = c.root
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("couldn't start language server %s: %w", c.command[0], err)
+	}
+	go cmd.Wait()
+
+	conn := newLSPConn(stdout, stdin)
+	rootURI := fileURI(c.root)
+	err = conn.Call(ctx, "initialize", map[string]interface{}{
+		"processId": os.Getpid(),
+		"rootUri":   rootURI,
+		"workspaceFolders": []map[string]string{
+			{"uri": rootURI, "name": filepath.Base(c.root)},
+		},
+		"capabilities": map[string]interface{}{
+			"textDocument": map[string]interface{}{
+				"hover":          map[string]interface{}{"contentFormat": []string{"markdown", "plaintext"}},
+				"documentSymbol": map[string]interface{}{"hierarchicalDocumentSymbolSupport": true},
+			},
+		},
+	}, nil)
+	if err == nil {
+		err = conn.Notify("initialized", map[string]interface{}{})
+	}
+	if err != nil {
+		cmd.Process.Kill()
+		return nil, fmt.Errorf("couldn't initialize language server %s: %w", c.command[0], err)
+	}
+	slog.Info("Started language server", "command", strings.Join(c.command, " "), "root", c.root)
+	c.cmd, c.conn = cmd, conn
+	return conn, nil
+}
+
+// Close asks the server to exit, killing it if it doesn't within a few
+// seconds.
+func (c *LSPClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil || c.conn.isClosed() {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := c.conn.Call(ctx, "shutdown", nil, nil); err == nil {
+		c.conn.Notify("exit", nil)
+	}
+	select {
+	case <-c.conn.closed:
+	case <-ctx.Done():
+		if c.cmd != nil {
+			c.cmd.Process.Kill()
+		}
+	}
+	c.conn = nil
+	return nil
+}
+
+func fileURI(path string) string {
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
+
+// readLines returns lines first to last (counted from 0) of a file, up to
+// maxLSPDefinitionLines of them.
+func readLines(path string, first, last int) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	lines := strings.Split(string(data), "\n")
+	if first < 0 || first >= len(lines) {
+		return ""
+	}
+	last = min(last, len(lines)-1)
+	if last-first >= maxLSPDefinitionLines {
+		return strings.Join(lines[first:first+maxLSPDefinitionLines], "\n") + "\n…"
+	}
+	return strings.Join(lines[first:last+1], "\n")
+}
+
+type lspPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type lspRange struct {
+	Start lspPosition `json:"start"`
+	End   lspPosition `json:"end"`
+}
+
+func (r lspRange) contains(p lspPosition) bool {
+	after := p.Line > r.Start.Line || p.Line == r.Start.Line && p.Character >= r.Start.Character
+	before := p.Line < r.End.Line || p.Line == r.End.Line && p.Character <= r.End.Character
+	return after && before
+}
+
+type lspLocation struct {
+	URI   string   `json:"uri"`
+	Range lspRange `json:"range"`
+}
+
+type lspSymbol struct {
+	Name          string      `json:"name"`
+	Kind          int         `json:"kind"`
+	ContainerName string      `json:"containerName"`
+	Location      lspLocation `json:"location"`
+}
+
+type lspDocumentSymbol struct {
+	Name           string              `json:"name"`
+	Range          lspRange            `json:"range"`
+	SelectionRange lspRange            `json:"selectionRange"`
+	Children       []lspDocumentSymbol `json:"children"`
+}
+
+// enclosingSymbol finds the innermost symbol whose name is at position.
+func enclosingSymbol(symbols []lspDocumentSymbol, position lspPosition) *lspDocumentSymbol {
+	for i, symbol := range symbols {
+		if !symbol.Range.contains(position) {
+			continue
+		}
+		if inner := enclosingSymbol(symbol.Children, position); inner != nil {
+			return inner
+		}
+		if symbol.SelectionRange.contains(position) {
+			return &symbols[i]
+		}
+	}
+	return nil
+}
+
+var lspSymbolKinds = map[int]string{
+	5: "class", 6: "method", 7: "property", 8: "field", 10: "enum", 11: "interface",
+	12: "function", 13: "variable", 14: "constant", 22: "enum member", 23: "struct", 26: "type parameter",
+}
+
+func lspSymbolKind(kind int) string {
+	if name, ok := lspSymbolKinds[kind]; ok {
+		return name
+	}
+	return "symbol"
+}
+
+// lspHoverText reads hover contents, which are markup, a plain string or
+// a list of strings and language-tagged code.
+func lspHoverText(raw json.RawMessage) string {
+	var markup struct {
+		Value    string `json:"value"`
+		Language string `json:"language"`
+	}
+	var text string
+	var parts []json.RawMessage
+	switch {
+	case json.Unmarshal(raw, &text) == nil:
+		return strings.TrimSpace(text)
+	case json.Unmarshal(raw, &parts) == nil:
+		var texts []string
+		for _, part := range parts {
+			if text := lspHoverText(part); text != "" {
+				texts = append(texts, text)
+			}
+		}
+		return strings.Join(texts, "\n\n")
+	case json.Unmarshal(raw, &markup) == nil:
+		if markup.Language != "" {
+			return "```" + markup.Language + "\n" + strings.TrimSpace(markup.Value) + "\n```"
+		}
+		return strings.TrimSpace(markup.Value)
+	}
+	return ""
+}
+
+var (
+	backtickPattern = regexp.MustCompile("`([A-Za-z_][A-Za-z0-9_.]*)(?:\\(\\))?`")
+	callPattern     = regexp.MustCompile(`\b([A-Za-z_][A-Za-z0-9_]*(?:\.[A-Za-z_][A-Za-z0-9_]*)?)\(`)
+	// camelPattern matches identifiers with an inner capital, such as
+	// GetHelpTool or newLSPConn, which are rarely plain English.
+	camelPattern = regexp.MustCompile(`\b(?:[A-Za-z_][A-Za-z0-9_]*\.)?[A-Za-z][a-z0-9]*[A-Z][A-Za-z0-9_]*\b`)
+)
+
+// questionSymbols returns the identifiers a question names: backquoted
+// ones, called ones and camel-cased ones, in order, up to maxLSPSymbols.
+func questionSymbols(question string) []string {
+	var symbols []string
+	seen := make(map[string]bool)
+	add := func(symbol string) {
+		if !seen[symbol] && len(symbols) < maxLSPSymbols {
+			seen[symbol] = true
+			symbols = append(symbols, symbol)
+		}
+	}
+	for _, m := range backtickPattern.FindAllStringSubmatch(question, -1) {
+		add(m[1])
+	}
+	for _, m := range callPattern.FindAllStringSubmatch(question, -1) {
+		add(m[1])
+	}
+	for _, m := range camelPattern.FindAllString(question, -1) {
+		add(m)
+	}
+	return symbols
+}
+
+// lspSource looks up the symbols named in the question with a language
+// server, so the prompt holds their exact definitions, documentation and
+// uses. It is best-effort.
+type lspSource struct {
+	client *LSPClient
+}
+
+func (s *lspSource) Name() string { return "lsp" }
+
+func (s *lspSource) Gather(ctx context.Context, question string, arguments map[string]interface{}) ([]ContextBlock, error) {
+	var blocks []ContextBlock
+	for _, name := range questionSymbols(question) {
+		info, err := s.client.Lookup(ctx, name)
+		if err != nil {
+			slog.Warn("Couldn't look up symbol with the language server", "symbol", name, "error", err)
+			return blocks, nil
+		}
+		if info == nil {
+			continue
+		}
+		location := fmt.Sprintf("%s:%d", info.Path, info.Line)
+		var text strings.Builder
+		fmt.Fprintf(&text, "**Symbol `%s` (%s), defined at %s:**", info.Name, info.Kind, location)
+		if info.Hover != "" {
+			text.WriteString("\n\n" + info.Hover)
+		}
+		if info.Definition != "" {
+			text.WriteString("\n\n```\n" + info.Definition + "\n```")
+		}
+		if len(info.References) > 0 {
+			text.WriteString("\n\nReferenced at " + strings.Join(info.References, ", "))
+			if more := info.ReferenceCount - len(info.References); more > 0 {
+				fmt.Fprintf(&text, " and %d more", more)
+			}
+			text.WriteString(".")
+		}
+		blocks = append(blocks, ContextBlock{
+			Name:       "symbol " + info.Name,
+			Text:       text.String(),
+			Priority:   PriorityDefault,
+			Provenance: fmt.Sprintf("LSP %s at %s (resolved just now)", info.Name, location),
+		})
+	}
+	return blocks, nil
+}
+
+// rpcReply is the answer to a request sent over JSON-RPC.
+type rpcReply struct {
+	result json.RawMessage
+	err    error
+}
+
+// lspConn is a JSON-RPC connection to a language server, with messages
+// framed by Content-Length headers.
+type lspConn struct {
+	w       io.Writer
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	nextID  int
+	pending map[int]chan rpcReply
+	closed  chan struct{}
+}
+
+func newLSPConn(r io.Reader, w io.Writer) *lspConn {
+	c := &lspConn{w: w, pending: make(map[int]chan rpcReply), closed: make(chan struct{})}
+	go c.read(bufio.NewReader(r))
+	return c
+}
+
+func (c *lspConn) isClosed() bool {
+	select {
+	case <-c.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *lspConn) write(message interface{}) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_, err = fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n%s", len(data), data)
+	return err
+}
+
+// Call sends a request and decodes its result into result, if not nil.
+func (c *lspConn) Call(ctx context.Context, method string, params, result interface{}) error {
+	c.mu.Lock()
+	c.nextID++
+	id := c.nextID
+	reply := make(chan rpcReply, 1)
+	c.pending[id] = reply
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	if err := c.write(map[string]interface{}{"jsonrpc": "2.0", "id": id, "method": method, "params": params}); err != nil {
+		return err
+	}
+	select {
+	case r := <-reply:
+		if r.err != nil {
+			return r.err
+		}
+		if result == nil || len(r.result) == 0 || string(r.result) == "null" {
+			return nil
+		}
+		return json.Unmarshal(r.result, result)
+	case <-c.closed:
+		return fmt.Errorf("language server exited")
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Notify sends a notification, which has no reply.
+func (c *lspConn) Notify(method string, params interface{}) error {
+	return c.write(map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params})
+}
+
+// read delivers replies to the calls waiting for them and answers the
+// server's own requests, until the server's output ends.
+func (c *lspConn) read(r *bufio.Reader) {
+	defer close(c.closed)
+	for {
+		data, err := readLSPMessage(r)
+		if err != nil {
+			if err != io.EOF {
+				slog.Warn("Couldn't read from the language server", "error", err)
+			}
+			return
+		}
+		var message struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+			Result json.RawMessage `json:"result"`
+			Error  *struct {
+				Code    int    `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal(data, &message); err != nil {
+			slog.Warn("Couldn't decode a language server message", "error", err)
+			continue
+		}
+
+		switch {
+		case message.Method != "" && len(message.ID) > 0:
+			// Answered aside, so a server that writes while we answer
+			// doesn't deadlock with us.
+			go c.answer(message.ID, message.Method, message.Params)
+		case message.Method != "":
+			// Notifications such as diagnostics and progress aren't needed.
+		default:
+			var id int
+			json.Unmarshal(message.ID, &id)
+			c.mu.Lock()
+			reply, ok := c.pending[id]
+			c.mu.Unlock()
+			if !ok {
+				continue
+			}
+			if message.Error != nil {
+				reply <- rpcReply{err: fmt.Errorf("language server error %d: %s", message.Error.Code, message.Error.Message)}
+			} else {
+				reply <- rpcReply{result: message.Result}
+			}
+		}
+	}
+}
+
+// answer replies to a request from the server. The client has no
+// settings to give and accepts whatever the server registers.
+func (c *lspConn) answer(id json.RawMessage, method string, params json.RawMessage) {
+	var result interface{}
+	if method == "workspace/configuration" {
+		var request struct {
+			Items []json.RawMessage `json:"items"`
+		}
+		json.Unmarshal(params, &request)
+		result = make([]interface{}, len(request.Items))
+	}
+	if err := c.write(map[string]interface{}{"jsonrpc": "2.0", "id": id, "result": result}); err != nil {
+		slog.Warn("Couldn't answer the language server", "method", method, "error", err)
+	}
+}
+
+// readLSPMessage reads one message body after its headers.
+func readLSPMessage(r *bufio.Reader) ([]byte, error) {
+	header, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		return nil, fmt.Errorf("bad Content-Length %q", header.Get("Content-Length"))
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
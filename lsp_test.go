@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestQuestionSymbols(t *testing.T) {
+	got := questionSymbols("Why does `cache.Get` race when GetHelpTool calls newLSPConn() and Store.Put()? The Cache is fine.")
+	want := []string{"cache.Get", "newLSPConn", "Store.Put", "GetHelpTool"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("questionSymbols = %v, want %v", got, want)
+	}
+}
+
+// fakeLanguageServer answers the requests a lookup makes for a symbol
+// Store.Put declared on lines 3-6 of store.go, after asking the client for
+// its configuration.
+func fakeLanguageServer(t *testing.T, root string, r io.Reader, w io.Writer) {
+	uri := fileURI(filepath.Join(root, "store.go"))
+	in := bufio.NewReader(r)
+	send := func(message map[string]interface{}) {
+		message["jsonrpc"] = "2.0"
+		data, _ := json.Marshal(message)
+		fmt.Fprintf(w, "Content-Length: %d\r\n\r\n%s", len(data), data)
+	}
+	send(map[string]interface{}{"id": "config", "method": "workspace/configuration", "params": map[string]interface{}{"items": []interface{}{map[string]string{"section": "gopls"}}}})
+	for {
+		data, err := readLSPMessage(in)
+		if err != nil {
+			return
+		}
+		var request struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+			Result json.RawMessage `json:"result"`
+		}
+		json.Unmarshal(data, &request)
+		var result interface{}
+		switch request.Method {
+		case "":
+			if string(request.Result) != "[null]" {
+				t.Errorf("Expected one empty setting for the configuration request, got %s", request.Result)
+			}
+			continue
+		case "workspace/symbol":
+			result = []map[string]interface{}{
+				{"name": "Put", "kind": 12, "containerName": "other", "location": map[string]interface{}{"uri": "file:///elsewhere/put.go", "range": lspRange{}}},
+				{"name": "Store.Put", "kind": 6, "containerName": "example.com/store", "location": map[string]interface{}{"uri": uri, "range": lspRange{Start: lspPosition{3, 15}, End: lspPosition{3, 18}}}},
+			}
+		case "textDocument/hover":
+			result = map[string]interface{}{"contents": map[string]string{"kind": "markdown", "value": "```go\nfunc (s *Store) Put(key string)\n```\n\nPut stores key."}}
+		case "textDocument/documentSymbol":
+			result = []map[string]interface{}{
+				{"name": "Store", "range": lspRange{Start: lspPosition{0, 0}, End: lspPosition{1, 1}}, "selectionRange": lspRange{Start: lspPosition{0, 5}, End: lspPosition{0, 10}}},
+				{"name": "(*Store).Put", "range": lspRange{Start: lspPosition{2, 0}, End: lspPosition{5, 1}}, "selectionRange": lspRange{Start: lspPosition{3, 15}, End: lspPosition{3, 18}}},
+			}
+		case "textDocument/references":
+			var refs []map[string]interface{}
+			for line := range 12 {
+				refs = append(refs, map[string]interface{}{"uri": fileURI(filepath.Join(root, "api.go")), "range": lspRange{Start: lspPosition{line, 0}}})
+			}
+			result = refs
+		}
+		send(map[string]interface{}{"id": request.ID, "result": result})
+	}
+}
+
+func TestLSPSource_Gather(t *testing.T) {
+	root := t.TempDir()
+	source := "// Put stores key.\nfunc (s *Store) Put(key string) {\n\ts.keys[key] = true\n}\n"
+	if err := os.WriteFile(filepath.Join(root, "store.go"), []byte("type Store struct {\n}\n"+source), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	clientOut, serverIn := io.Pipe()
+	serverOut, clientIn := io.Pipe()
+	go fakeLanguageServer(t, root, serverOut, serverIn)
+	defer clientIn.Close()
+	client, _ := NewLSPClient("gopls", root)
+	client.conn = newLSPConn(clientOut, clientIn)
+
+	blocks, err := (&lspSource{client: client}).Gather(context.Background(), "Why does Store.Put() drop keys?", nil)
+	if err != nil || len(blocks) != 1 {
+		t.Fatalf("Expected one block, got %v, %v", blocks, err)
+	}
+	text := blocks[0].Text
+	for _, want := range []string{
+		"**Symbol `Store.Put` (method), defined at store.go:4:**",
+		"Put stores key.",
+		"```\n" + strings.TrimSuffix(source, "\n") + "\n```",
+		"Referenced at api.go:1, api.go:2",
+		"api.go:10 and 2 more.",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Expected %q in the block, got:\n%s", want, text)
+		}
+	}
+	if blocks[0].Provenance != "LSP Store.Put at store.go:4 (resolved just now)" {
+		t.Errorf("Unexpected provenance %q", blocks[0].Provenance)
+	}
+}
+
+func TestLSPSource_Gather_ServerUnavailable(t *testing.T) {
+	client, _ := NewLSPClient("escalator-no-such-language-server", t.TempDir())
+	blocks, err := (&lspSource{client: client}).Gather(context.Background(), "Why does `Put` fail?", nil)
+	if err != nil || len(blocks) != 0 {
+		t.Errorf("Expected a missing language server to be skipped, got %v, %v", blocks, err)
+	}
+}
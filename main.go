@@ -1,184 +1,474 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
+
+	"github.com/dratner/code-escalator/pkg/mcp"
+)
+
+// The protocol types and tool interfaces live in pkg/mcp, so programs
+// embedding the escalator can implement tools; these names keep the
+// package's code as it was.
+type (
+	Tool                = mcp.Tool
+	StructuredTool      = mcp.StructuredTool
+	CategorizedTool     = mcp.CategorizedTool
+	ContextTool         = mcp.ContextTool
+	StreamingTool       = mcp.StreamingTool
+	JsonRPCRequest      = mcp.Request
+	JsonRPCResponse     = mcp.Response
+	JsonRPCNotification = mcp.Notification
 )
 
-// Tool interface for MCP tools
-type Tool interface {
-	Name() string
-	Description() string
-	Schema() map[string]interface{}
-	Call(arguments map[string]interface{}) ([]map[string]interface{}, error)
+func textContent(text string) []map[string]interface{} { return mcp.TextContent(text) }
+
+func withMeta(content []map[string]interface{}, meta map[string]interface{}) []map[string]interface{} {
+	return mcp.WithMeta(content, meta)
 }
 
-// JSON-RPC structures
-type JsonRPCRequest struct {
-	Jsonrpc string          `json:"jsonrpc"`
-	ID      int             `json:"id"`
-	Method  string          `json:"method"`
-	Params  json.RawMessage `json:"params"`
+func takeMeta(content []map[string]interface{}) map[string]interface{} { return mcp.TakeMeta(content) }
+
+func withStructuredContent(content []map[string]interface{}, structured map[string]interface{}) []map[string]interface{} {
+	return mcp.WithStructuredContent(content, structured)
 }
 
-type JsonRPCResponse struct {
-	Jsonrpc string      `json:"jsonrpc"`
-	ID      int         `json:"id"`
-	Result  interface{} `json:"result,omitempty"`
-	Error   interface{} `json:"error,omitempty"`
+func takeStructuredContent(content []map[string]interface{}) map[string]interface{} {
+	return mcp.TakeStructuredContent(content)
 }
 
-// MCP Server
+// MCPServer is the escalator's MCP server: a pkg/mcp server holding the
+// tools, with the client's session and the escalator's policies around it.
 type MCPServer struct {
-	tools      map[string]Tool
-	serverInfo map[string]string
+	server *mcp.Server
+
+	// notify sends a JSON-RPC notification to the client. It is nil when
+	// the transport cannot deliver notifications.
+	notify func(method string, params interface{})
+
+	// request sends a JSON-RPC request to the client and waits for the
+	// response. It is nil when the transport cannot carry client requests.
+	request func(ctx context.Context, method string, params interface{}) (json.RawMessage, error)
+
+	clientMu           sync.Mutex
+	clientCapabilities map[string]interface{}
+	clientName         string
+	protocolVersion    string
+	initialized        bool
+
+	signer   *Signer
+	monitor  *EscalationMonitor
+	rules    *ArgumentRules
+	tracker  *ErrorTracker
+	chunker  *AnswerChunker
+	features *FeatureFlags
+	webhook  *EscalationWebhook
+	metrics  *Metrics
+	tracer   *Tracer
+	audit    *AuditLog
+	history  *HistoryStore
+	cooldown *TopicCooldown
+	limiter  *RateLimiter
+
+	// warm makes initialize warm the tools in the background.
+	warm bool
+
+	// drain tracks the requests in flight for a graceful shutdown.
+	drain drainer
 }
 
 func NewMCPServer(name, version string) *MCPServer {
-	return &MCPServer{
-		tools: make(map[string]Tool),
-		serverInfo: map[string]string{
-			"name":    name,
-			"version": version,
-		},
-	}
+	s := &MCPServer{server: mcp.NewServer(name, version)}
+	s.server.Wrap(s.extendRequest)
+	s.server.Intercept(s.applyPolicies)
+	s.server.Use(s.recordEscalations)
+	return s
+}
+
+// WithSigner makes the server sign every successful tool answer and include
+// the signature in the result's _meta.
+func (s *MCPServer) WithSigner(signer *Signer) *MCPServer {
+	s.signer = signer
+	return s
+}
+
+// WithWarmStart warms the tools when a client initializes a session, so
+// its first call doesn't pay for cold-start setup.
+func (s *MCPServer) WithWarmStart(warm bool) *MCPServer {
+	s.warm = warm
+	return s
+}
+
+// WithMonitor makes the server watch each client's escalations for
+// anomalies such as an agent stuck in a loop.
+func (s *MCPServer) WithMonitor(monitor *EscalationMonitor) *MCPServer {
+	s.monitor = monitor
+	return s
+}
+
+// WithCooldown refuses escalations of a topic escalated too often lately,
+// unless the caller overrides the cooldown.
+func (s *MCPServer) WithCooldown(cooldown *TopicCooldown) *MCPServer {
+	s.cooldown = cooldown
+	return s
+}
+
+// WithRateLimiter refuses tool calls from a client over its rate limit.
+func (s *MCPServer) WithRateLimiter(limiter *RateLimiter) *MCPServer {
+	s.limiter = limiter
+	return s
+}
+
+// WithArgumentRules transforms tool arguments with rules before anything
+// else sees them.
+func (s *MCPServer) WithArgumentRules(rules *ArgumentRules) *MCPServer {
+	s.rules = rules
+	return s
+}
+
+// WithErrorTracker reports tool calls that panic before the panic goes on.
+func (s *MCPServer) WithErrorTracker(tracker *ErrorTracker) *MCPServer {
+	s.tracker = tracker
+	return s
+}
+
+// WithChunker delivers answers longer than the chunker's limit in parts.
+func (s *MCPServer) WithChunker(chunker *AnswerChunker) *MCPServer {
+	s.chunker = chunker
+	return s
+}
+
+// WithFeatures turns experimental capabilities off for the clients the
+// flags leave them off for.
+func (s *MCPServer) WithFeatures(features *FeatureFlags) *MCPServer {
+	s.features = features
+	return s
+}
+
+// WithEscalationWebhook posts an event for every answered escalation.
+func (s *MCPServer) WithEscalationWebhook(webhook *EscalationWebhook) *MCPServer {
+	s.webhook = webhook
+	return s
+}
+
+// WithMetrics counts requests, tool calls and errors.
+func (s *MCPServer) WithMetrics(metrics *Metrics) *MCPServer {
+	s.metrics = metrics
+	return s
+}
+
+// WithAuditLog records each tool call's arguments and answer with the
+// caller.
+func (s *MCPServer) WithAuditLog(audit *AuditLog) *MCPServer {
+	s.audit = audit
+	return s
+}
+
+// WithHistory records the escalations of tools that don't record their own,
+// with their usage, and returns their escalation_id.
+func (s *MCPServer) WithHistory(history *HistoryStore) *MCPServer {
+	s.history = history
+	return s
+}
+
+// WithTracer records a span for each request, tool call and model call.
+func (s *MCPServer) WithTracer(tracer *Tracer) *MCPServer {
+	s.tracer = tracer
+	return s
 }
 
 func (s *MCPServer) RegisterTool(tool Tool) {
-	s.tools[tool.Name()] = tool
+	s.server.RegisterTool(tool)
 }
 
-func (s *MCPServer) HandleInitialize() map[string]interface{} {
-	return map[string]interface{}{
-		"protocolVersion": "2025-03-26",
-		"capabilities": map[string]interface{}{
-			"tools": map[string]interface{}{},
-		},
-		"serverInfo": s.serverInfo,
+// extendRequest adds what the escalator serves beyond pkg/mcp's server:
+// the client's session and logging at initialize, the category filter of
+// tools/list, the chunked answers as resources, and the signing, chunking
+// and revision of tools/call results.
+func (s *MCPServer) extendRequest(next mcp.RequestHandler) mcp.RequestHandler {
+	return func(ctx context.Context, req JsonRPCRequest, notify func(method string, params interface{})) JsonRPCResponse {
+		resp := JsonRPCResponse{Jsonrpc: "2.0", ID: req.ID}
+		switch req.Method {
+		case "initialize":
+			s.recordClientCapabilities(req.Params)
+			s.warmTools()
+			resp = next(ctx, req, notify)
+			if result, ok := resp.Result.(*mcp.InitializeResult); ok {
+				result.Capabilities.Logging = &mcp.Capability{}
+				if s.chunker.servesResources() {
+					result.Capabilities.Resources = &mcp.Capability{}
+				}
+			}
+		case "tools/list":
+			categories, err := parseToolsListFilter(req.Params)
+			if err != nil {
+				slog.Warn("Failed to parse tools/list params", "error", err)
+				resp.Error = mcp.NewError(mcp.CodeInvalidParams, "Invalid params: "+err.Error())
+				break
+			}
+			resp = next(ctx, req, notify)
+			if result, ok := resp.Result.(*mcp.ListToolsResult); ok {
+				s.filterToolsList(result, categories)
+			}
+		case "tools/call":
+			resp = next(ctx, req, notify)
+			if result, ok := resp.Result.(*mcp.CallToolResult); ok && !result.IsError {
+				resp.Result = s.deliverResult(result)
+			}
+		case "resources/list":
+			if !s.chunker.servesResources() {
+				return next(ctx, req, notify)
+			}
+			resp.Result = &mcp.ListResourcesResult{Resources: s.chunker.Resources()}
+		case "resources/read":
+			if !s.chunker.servesResources() {
+				return next(ctx, req, notify)
+			}
+			result, errorResp := s.HandleResourcesRead(req.Params)
+			if errorResp != nil {
+				resp.Error = errorResp
+			} else {
+				resp.Result = result
+			}
+		default:
+			return next(ctx, req, notify)
+		}
+		return resp
 	}
 }
 
-func (s *MCPServer) HandleToolsList() map[string]interface{} {
-	tools := make([]map[string]interface{}, 0, len(s.tools))
-	
-	for _, tool := range s.tools {
-		tools = append(tools, map[string]interface{}{
-			"name":        tool.Name(),
-			"description": tool.Description(),
-			"inputSchema": tool.Schema(),
-		})
+// resourceLinksSupported reports whether the client's protocol version has
+// resource_link content blocks (2025-06-18 and later).
+func (s *MCPServer) resourceLinksSupported() bool {
+	return s.protocol().resourceLinks
+}
+
+// recordClientCapabilities remembers what the client declared during
+// initialize so tools can tell which client features are available.
+func (s *MCPServer) recordClientCapabilities(params json.RawMessage) {
+	var initParams struct {
+		ProtocolVersion string                 `json:"protocolVersion"`
+		Capabilities    map[string]interface{} `json:"capabilities"`
+		ClientInfo      struct {
+			Name string `json:"name"`
+		} `json:"clientInfo"`
 	}
-	
-	return map[string]interface{}{
-		"tools": tools,
+	if err := json.Unmarshal(params, &initParams); err != nil {
+		slog.Warn("Failed to parse initialize params", "error", err)
+		return
 	}
+
+	s.clientMu.Lock()
+	s.clientCapabilities = initParams.Capabilities
+	s.clientName = initParams.ClientInfo.Name
+	s.protocolVersion = initParams.ProtocolVersion
+	s.initialized = true
+	s.clientMu.Unlock()
 }
 
-func (s *MCPServer) HandleToolsCall(params json.RawMessage) (map[string]interface{}, map[string]interface{}) {
-	var callParams struct {
-		Name      string                 `json:"name"`
-		Arguments map[string]interface{} `json:"arguments"`
+// mcpClientName names the connected client for per-client tracking, as it
+// introduced itself during initialize.
+func (s *MCPServer) mcpClientName() string {
+	s.clientMu.Lock()
+	defer s.clientMu.Unlock()
+	if s.clientName == "" {
+		return "mcp"
 	}
-	
-	if err := json.Unmarshal(params, &callParams); err != nil {
-		log.Printf("Failed to parse tools/call params: %v", err)
-		return nil, map[string]interface{}{
-			"code":    -32602,
-			"message": "Invalid params",
+	return s.clientName
+}
+
+// clientSupports reports whether the client declared the named capability.
+func (s *MCPServer) clientSupports(capability string) bool {
+	s.clientMu.Lock()
+	defer s.clientMu.Unlock()
+	_, ok := s.clientCapabilities[capability]
+	return ok
+}
+
+// HandleToolsList answers a tools/list request without a filter.
+func (s *MCPServer) HandleToolsList() *mcp.ListToolsResult {
+	result, _ := s.server.Process(context.Background(), JsonRPCRequest{Jsonrpc: "2.0", Method: "tools/list"}, s.notify).Result.(*mcp.ListToolsResult)
+	return result
+}
+
+// filterToolsList keeps the tools in any of categories, or every tool when
+// categories is empty, adapts their entries to the client, and lists the
+// categories of all tools in _meta.
+func (s *MCPServer) filterToolsList(result *mcp.ListToolsResult, categories []string) {
+	tools := result.Tools[:0]
+	for _, entry := range result.Tools {
+		tool, _ := s.server.Tool(entry.Name)
+		category := toolCategory(tool)
+		if !inCategories(category, categories) {
+			continue
 		}
-	}
-	
-	tool, exists := s.tools[callParams.Name]
-	if !exists {
-		log.Printf("Unknown tool: %s", callParams.Name)
-		return nil, map[string]interface{}{
-			"code":    -32602,
-			"message": "Unknown tool",
+		if s.cooldown != nil && escalatingTools[entry.Name] {
+			entry.InputSchema = withCooldownOverride(entry.InputSchema)
+		}
+		entry.Meta = nil
+		if category != "" {
+			entry.Meta = map[string]interface{}{"category": category}
 		}
+		tools = append(tools, entry)
 	}
-	
-	content, err := tool.Call(callParams.Arguments)
-	if err != nil {
-		log.Printf("Tool call failed: %v", err)
-		return map[string]interface{}{
-			"content": content,
-			"isError": true,
-		}, nil
-	}
-	
-	return map[string]interface{}{
-		"content": content,
-	}, nil
-}
-
-func (s *MCPServer) ProcessRequest(req JsonRPCRequest) JsonRPCResponse {
-	var resp JsonRPCResponse
-	resp.Jsonrpc = "2.0"
-	resp.ID = req.ID
-
-	log.Printf("[%s] Got JSON-RPC request: method=%s, id=%d", time.Now().Format(time.RFC3339), req.Method, req.ID)
-
-	switch req.Method {
-	case "initialize":
-		log.Println("Handling initialize")
-		resp.Result = s.HandleInitialize()
-	case "tools/list":
-		log.Println("Handling tools/list")
-		resp.Result = s.HandleToolsList()
-	case "tools/call":
-		log.Println("Handling tools/call")
-		result, errorResp := s.HandleToolsCall(req.Params)
-		if errorResp != nil {
-			resp.Error = errorResp
-		} else {
-			resp.Result = result
+	s.adaptToolsList(tools)
+	result.Tools = tools
+	result.Meta = map[string]interface{}{"categories": s.toolCategories()}
+}
+
+// HandleToolsCall answers a tools/call request with params, within the
+// trace its _meta names.
+func (s *MCPServer) HandleToolsCall(params json.RawMessage) (*mcp.CallToolResult, *mcp.RPCError) {
+	ctx := withTraceparent(context.Background(), paramsTraceparent(params))
+	resp := s.server.Process(ctx, JsonRPCRequest{Jsonrpc: "2.0", Method: "tools/call", Params: params}, s.notify)
+	if resp.Error != nil {
+		return nil, resp.Error
+	}
+	return resp.Result.(*mcp.CallToolResult), nil
+}
+
+// applyPolicies applies the server's policies to the tool calls its client
+// makes: the session's rate limit, the argument rules, the escalation
+// monitor and feature flags, and the logging, tracing, audit and webhook of
+// every call.
+func (s *MCPServer) applyPolicies(next ToolHandler) ToolHandler {
+	return func(ctx context.Context, tool Tool, arguments map[string]interface{}, onDelta func(string)) ([]map[string]interface{}, error) {
+		client := s.mcpClientName()
+		if wait, ok := s.limiter.Allow("session:" + client); !ok {
+			return nil, rateLimitError(wait)
 		}
-	default:
-		log.Printf("Unknown method: %s", req.Method)
-		resp.Error = map[string]interface{}{
-			"code":    -32601,
-			"message": "Method not found",
+
+		defer s.tracker.Recover(map[string]string{"component": "tool", "tool": tool.Name()})
+		ctx, span := s.startToolSpan(ctx, tool.Name())
+		requestID := newRequestID()
+		ctx = withCaller(ctx, callerInfo{RequestID: requestID, Client: client, Tool: tool.Name()})
+		logger := callLogger(requestID, client, tool.Name())
+		if span != nil {
+			logger = logger.With("trace_id", span.TraceID())
+		}
+		logger.Debug("Tool call started")
+		arguments = s.rules.Apply(tool.Name(), arguments)
+		if errContent, err := s.observeEscalation(client, tool.Name(), arguments); err != nil {
+			span.End(err)
+			return errContent, err
+		}
+		arguments, errContent, err := s.gateFeatures(client, tool.Name(), arguments)
+		if err != nil {
+			span.End(err)
+			return errContent, err
+		}
+
+		start := time.Now()
+		content, err := next(ctx, tool, arguments, s.streamTo(tool, client, onDelta))
+		meta := takeMeta(content)
+		structured := takeStructuredContent(content)
+		s.finishCall(logger, span, tool.Name(), meta, time.Since(start), err)
+		s.audit.ToolCall(ctx, arguments, content, meta, err)
+		if err == nil {
+			s.reportEscalation(client, tool.Name(), arguments, contentText(content), meta, time.Since(start))
+		}
+		if structured != nil {
+			content = withStructuredContent(content, structured)
 		}
+		return withMeta(content, meta), err
 	}
+}
 
-	return resp
+// streamTo returns where a streaming tool's output goes: to progress, the
+// progress notifications pkg/mcp sends when the caller supplied a progress
+// token, and otherwise, or when the client's revision's progress
+// notifications can't carry a message, to logging notifications.
+func (s *MCPServer) streamTo(tool Tool, client string, progress func(string)) func(string) {
+	if _, ok := tool.(StreamingTool); !ok || s.notify == nil || !s.features.Enabled("streaming", client) {
+		return nil
+	}
+	if progress != nil && s.protocol().progressMessages {
+		return progress
+	}
+	return func(delta string) {
+		s.notify("notifications/message", map[string]interface{}{
+			"level":  "info",
+			"logger": tool.Name(),
+			"data":   delta,
+		})
+	}
 }
 
-func (s *MCPServer) RunStdio() {
-	decoder := json.NewDecoder(os.Stdin)
-	encoder := json.NewEncoder(os.Stdout)
-	encoder.SetEscapeHTML(false)
-	
-	for {
-		var req JsonRPCRequest
-		if err := decoder.Decode(&req); err != nil {
-			if err == io.EOF {
-				break
-			}
-			log.Printf("Error decoding JSON-RPC: %v", err)
-			continue
+// deliverResult signs a successful tools/call result, splits a long answer
+// into parts, and rewrites the result into the client's revision.
+func (s *MCPServer) deliverResult(result *mcp.CallToolResult) *mcp.CallToolResult {
+	meta := result.Meta
+	if meta == nil {
+		meta = make(map[string]interface{})
+	}
+	if s.signer != nil {
+		meta["signature"] = s.signer.Sign(contentText(result.Content))
+	}
+	// The signature covers the whole answer, however it's delivered.
+	if chunked, parts, uris := s.chunker.Chunk(result.Content, s.resourceLinksSupported()); len(parts) > 0 {
+		result.Content = chunked
+		meta["parts"] = len(parts)
+		if result.StructuredContent != nil && len(uris) > 0 {
+			result.StructuredContent["answer"] = parts[0]
+			result.StructuredContent["answer_parts"] = uris
 		}
+	}
+	if len(meta) > 0 {
+		result.Meta = meta
+	}
+	return s.adaptResult(result)
+}
 
-		resp := s.ProcessRequest(req)
-		
-		if err := encoder.Encode(resp); err != nil {
-			log.Printf("Failed to write JSON-RPC response: %v", err)
+// ProcessRequest answers a request from the client, counting and tracing
+// it.
+func (s *MCPServer) ProcessRequest(req JsonRPCRequest) (resp JsonRPCResponse) {
+	slog.Debug("Got JSON-RPC request", "method", req.Method, "id", req.ID)
+	s.metrics.Request(metricMethod(req.Method))
+	ctx, span := s.tracer.Start(withTraceparent(context.Background(), paramsTraceparent(req.Params)), metricMethod(req.Method), spanKindServer)
+	span.SetAttributes("rpc.system", "jsonrpc", "rpc.method", req.Method, "rpc.jsonrpc.request_id", req.ID)
+	defer func() {
+		var err error
+		if e := resp.Error; e != nil {
+			s.metrics.Error("jsonrpc", e.Code)
+			span.SetAttributes("rpc.jsonrpc.error_code", e.Code)
+			err = errors.New(e.Message)
 		}
-	}
+		span.End(err)
+	}()
+	return s.server.Process(ctx, req, s.notify)
+}
+
+func (s *MCPServer) RunStdio() {
+	s.Serve(os.Stdin, os.Stdout)
+}
+
+// Serve runs the MCP protocol over a pair of streams until r is exhausted,
+// on pkg/mcp's stdio transport.
+func (s *MCPServer) Serve(r io.Reader, w io.Writer) {
+	stream := mcp.NewStream(w)
+	s.notify = stream.Notify
+	s.request = stream.Request
+	stream.Serve(r, s)
 }
 
 // Legacy HTTP handler for backward compatibility
 func (s *MCPServer) HandleHTTP(w http.ResponseWriter, r *http.Request) {
-	log.Println("Got HTTP request")
-
 	if r.Method != http.MethodPost {
-		log.Println("Called with a GET")
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
@@ -187,75 +477,1049 @@ func (s *MCPServer) HandleHTTP(w http.ResponseWriter, r *http.Request) {
 	var arguments map[string]interface{}
 	decoder := json.NewDecoder(r.Body)
 	if err := decoder.Decode(&arguments); err != nil {
-		log.Println("Couldn't decode the JSON")
+		slog.Warn("Couldn't decode the HTTP request", "error", err)
 		http.Error(w, "malformed request", http.StatusBadRequest)
 		return
 	}
 
 	// Find the get_help tool (backward compatibility)
-	tool, exists := s.tools["get_help"]
+	tool, exists := s.server.Tool("get_help")
 	if !exists {
 		http.Error(w, `{"error":"Tool not available"}`, http.StatusServiceUnavailable)
 		return
 	}
 
-	content, err := tool.Call(arguments)
+	client := httpClientName(r)
+	defer s.tracker.Recover(map[string]string{"component": "http", "tool": tool.Name()})
+	requestID := r.Header.Get("X-Request-ID")
+	if requestID == "" {
+		requestID = newRequestID()
+	}
+	w.Header().Set("X-Request-ID", requestID)
+	ctx, span := s.startToolSpan(withTraceparent(context.Background(), r.Header.Get("traceparent")), tool.Name())
+	ctx = withCaller(ctx, callerInfo{RequestID: requestID, Client: client, Tool: tool.Name()})
+	logger := callLogger(requestID, client, tool.Name())
+	if span != nil {
+		logger = logger.With("trace_id", span.TraceID())
+	}
+	logger.Debug("Tool call started")
+	arguments = s.rules.Apply(tool.Name(), arguments)
+	if _, err := s.observeEscalation(client, tool.Name(), arguments); err != nil {
+		span.End(err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTooManyRequests)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	arguments, _, err := s.gateFeatures(client, tool.Name(), arguments)
 	if err != nil {
-		log.Printf("Tool call failed: %v", err)
-		http.Error(w, `{"error":"The architect is currently unavailable. Please try again later."}`, http.StatusServiceUnavailable)
+		span.End(err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
 		return
 	}
 
-	// Return legacy format
-	if len(content) > 0 && content[0]["type"] == "text" {
-		response := map[string]string{"answer": content[0]["text"].(string)}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(response)
+	// Callers accepting server-sent events get one "chunk" event per
+	// partial output and a final "answer" or "error" event.
+	var writeEvent func(event string, data interface{})
+	var onDelta func(string)
+	if _, ok := tool.(StreamingTool); ok && strings.Contains(r.Header.Get("Accept"), "text/event-stream") && s.features.Enabled("streaming", client) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			span.End(fmt.Errorf("streaming not supported"))
+			http.Error(w, `{"error":"Streaming not supported"}`, http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		writeEvent = func(event string, data interface{}) {
+			payload, _ := json.Marshal(data)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+			flusher.Flush()
+		}
+		onDelta = func(delta string) {
+			writeEvent("chunk", map[string]string{"delta": delta})
+		}
+	}
+
+	start := time.Now()
+	content, err := s.callTool(ctx, tool, arguments, onDelta)
+	meta := takeMeta(content)
+	s.finishCall(logger, span, tool.Name(), meta, time.Since(start), err)
+	s.audit.ToolCall(ctx, arguments, content, meta, err)
+	if err != nil {
+		switch {
+		case writeEvent != nil:
+			writeEvent("error", map[string]string{"error": "The architect is currently unavailable. Please try again later."})
+		case !writeCircuitOpen(w, err):
+			http.Error(w, `{"error":"The architect is currently unavailable. Please try again later."}`, http.StatusServiceUnavailable)
+		}
+		return
+	}
+
+	// Return legacy format, with any per-call metadata alongside the answer
+	s.reportEscalation(client, tool.Name(), arguments, contentText(content), meta, time.Since(start))
+	if len(content) == 0 || content[0]["type"] != "text" {
+		return
+	}
+	response := map[string]interface{}{"answer": content[0]["text"].(string)}
+	for key, value := range meta {
+		response[key] = value
+	}
+	if writeEvent != nil {
+		writeEvent("answer", response)
+		return
+	}
+	if s.signer != nil {
+		response["signature"] = s.signer.Sign(contentText(content))
 	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
 }
 
-func init() {
-	if os.Getenv("OPENAI_API_KEY") == "" {
-		log.Fatal("OPENAI_API_KEY environment variable is required")
+// httpClientName identifies a legacy HTTP caller by the API key or OAuth
+// client it authenticated with, its client certificate, its X-Client-Name
+// header, or else its address.
+func httpClientName(r *http.Request) string {
+	if principal := principalFrom(r.Context()); principal != "" {
+		return principal
+	}
+	if name := clientCertName(r); name != "" {
+		return name
+	}
+	if name := r.Header.Get("X-Client-Name"); name != "" {
+		return name
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
 	}
+	return host
+}
+
+// splitList parses a comma-separated flag value, dropping empty entries.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
 }
 
 func main() {
+	// Subcommands that don't talk to OpenAI run before the API key check.
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "prompts":
+			os.Exit(runPromptsCommand(os.Args[2:], os.Stdout))
+		case "history":
+			os.Exit(runHistoryCommand(os.Args[2:], os.Stdout))
+		case "explain":
+			os.Exit(runExplainCommand(os.Args[2:], os.Stdout))
+		case "doctor":
+			os.Exit(runDoctorCommand(os.Args[2:], os.Stdout))
+		case "init":
+			os.Exit(runInitCommand(os.Args[2:], os.Stdout))
+		case "index":
+			os.Exit(runIndexCommand(os.Args[2:], os.Stdout))
+		case "counters":
+			os.Exit(runCountersCommand(os.Args[2:], os.Stdout))
+		case "costs":
+			os.Exit(runCostsCommand(os.Args[2:], os.Stdout))
+		}
+	}
+
+	// exitCode is the status to exit with once the deferred closes have
+	// run.
+	exitCode := 0
+	defer func() {
+		if exitCode != 0 {
+			os.Exit(exitCode)
+		}
+	}()
 
+	configFlag := flag.String("config", "", "YAML or TOML file of settings for the flags not given on the command line or in ESCALATOR_ environment variables (default: $ESCALATOR_CONFIG)")
 	summaryFlag := flag.String("summary", "", "Path to project summary file (default: ./README.md)")
+	requireSummaryFlag := flag.Bool("require-summary", false, "Exit at startup if the summary file can't be read, instead of falling back to the caller's summary")
 	portFlag := flag.Int("port", 9001, "Port to listen on")
+	listenFlag := flag.String("listen", "", "Address the -sse server listens on, as host:port, e.g. 0.0.0.0:9001 to accept connections from other hosts (default: 127.0.0.1 on -port)")
+	allowUnauthenticatedFlag := flag.Bool("allow-unauthenticated", false, "Let -listen bind an address reachable from other hosts without -api-keys, -oauth-issuer or required client certificates, e.g. behind a service mesh that authenticates callers")
 	modelFlag := flag.String("model", "o3", "OpenAI model to use")
+	personaFlag := flag.String("persona", defaultPersona, "Persona get_help answers as: architect, security-reviewer, sre, or a file containing a system prompt")
+	promptTemplateFlag := flag.String("prompt-template", "", "text/template file rendering the get_help prompt instead of the built-in template (optional)")
+	promptVarFlags := promptVarFlag{}
+	reloadIntervalFlag := flag.Duration("reload-interval", 2*time.Second, "How often the -config file, -prompt-template and -persona files are checked for changes, which are applied without a restart; SIGHUP reloads at once (0 disables checking)")
+	flag.Var(promptVarFlags, "prompt-var", "Metadata value available to -prompt-template as .Metadata.name, in the form name=value (repeatable)")
+	promptVariantsFlag := flag.Bool("prompt-variants", false, "Adapt the get_help prompt to each model's family with the built-in variants: terse for reasoning models, step by step for small models")
+	toolModelFlags := toolModelFlag{}
+	flag.Var(toolModelFlags, "tool-model", "Model a tool uses instead of -model, in the form tool=model, e.g. security_audit=o3 (repeatable)")
+	promptVariantFlags := promptVariantFlag{}
+	flag.Var(promptVariantFlags, "prompt-variant", "text/template file wrapping {{.Prompt}} for a model family (reasoning, chat or small), in the form family=path; replaces the built-in variant (repeatable)")
+	responseFormatFlag := flag.String("response-format", responseFormatText, "Default get_help answer format: text, or json for a diagnosis, fix plan, risk level and confidence enforced with a JSON schema")
+	promptSoftLimitFlag := flag.Int("prompt-soft-limit", promptTokenBudget, "Estimated tokens a get_help prompt may reach before the context it gathered is trimmed, or the prompt refused unless the caller passes allow_large=true")
+	promptHardLimitFlag := flag.Int("prompt-hard-limit", defaultHardPromptLimit, "Estimated tokens a get_help prompt may reach when the caller passes allow_large=true; nothing larger is sent")
+	allowedModelsFlag := flag.String("allowed-models", "", "Comma-separated models callers may select per request with the model argument (e.g. o3,gpt-4o-mini)")
+	fallbackFlag := flag.String("fallback-models", "", "Comma-separated models to try in order when the primary model fails (e.g. gpt-4o,gpt-4o-mini)")
+	cascadeFlag := flag.String("cascade-model", "", "Cheap model that answers first; re-escalates to -model only when not confident (e.g. gpt-4o-mini)")
+	cascadeConfidenceFlag := flag.String("cascade-min-confidence", "high", "Minimum self-assessed confidence (low, medium, high) to accept the cascade model's answer")
+	translateFlag := flag.String("translate-model", "", "Cheap model that translates non-English questions to English and the answers back (e.g. gpt-4o-mini; empty disables)")
+	compressFlag := flag.String("compress-model", "", "Cheap model that condenses context too large for the prompt before it is sent to -model, instead of trimming it (e.g. gpt-4.1-mini; empty disables)")
+	modelCheckFlag := flag.Duration("model-check-interval", 6*time.Hour, "How often the configured models are checked against the provider's model list and known deprecations (0 disables)")
+	modelDeprecationsFlag := flag.String("model-deprecations", "", "JSON file of model deprecations, [{\"model\": ..., \"successor\": ..., \"retires\": \"YYYY-MM-DD\"}], adding to the built-in list (optional)")
+	modelAutoMigrateFlag := flag.Bool("model-auto-migrate", false, "Send calls to a retired or missing model to its successor instead of failing")
+	ensembleFlag := flag.String("ensemble-models", "o3,gpt-4o", "Comma-separated models consulted by get_second_opinion")
+	signingKeyFlag := flag.String("signing-key", "", "Path to a PEM ed25519 private key used to sign answers (optional)")
+	cacheSizeFlag := flag.Int("cache-size", 100, "Number of answers kept in the response cache (0 disables caching)")
+	cacheTTLFlag := flag.Duration("cache-ttl", time.Hour, "How long cached answers stay valid")
+	budgetDailyFlag := flag.Float64("budget-daily", 0, "Maximum estimated spend in USD per day; escalations are refused once it is reached (0 disables)")
+	budgetMonthlyFlag := flag.Float64("budget-monthly", 0, "Maximum estimated spend in USD per calendar month (0 disables)")
+	anomalyWindowFlag := flag.Duration("anomaly-window", 10*time.Minute, "Window over which each client's escalations are checked for anomalies")
+	anomalyMaxCallsFlag := flag.Int("anomaly-max-calls", 30, "Flag a client making this many escalations within -anomaly-window (0 disables)")
+	anomalyMaxSimilarFlag := flag.Int("anomaly-max-similar", 4, "Flag a client asking this many variations of one question within -anomaly-window, a sign of an agent stuck in a loop (0 disables)")
+	anomalyThrottleFlag := flag.Duration("anomaly-throttle", 0, "Pause a flagged client's escalations for this long (0 only warns)")
+	anomalyWebhookFlag := flag.String("anomaly-webhook", "", "URL that receives each anomaly as a JSON POST (optional)")
+	cooldownMaxFlag := flag.Int("cooldown-max", 0, "Refuse further escalations of a topic, across all clients, once it has been escalated this many times within -cooldown-window, unless the caller sets override_cooldown (0 disables)")
+	cooldownWindowFlag := flag.Duration("cooldown-window", time.Hour, "Window over which each topic's escalations are counted for -cooldown-max")
+	cooldownSimilarityFlag := flag.Float64("cooldown-similarity", loopSimilarityThreshold, "Keyword overlap (0-1) at which two questions count as one topic for -cooldown-max")
+	rateLimitFlag := flag.Float64("rate-limit", 0, "Tool calls each client may make per minute, with a token bucket per MCP session, API key, client certificate or IP address; calls over it are refused (0 disables)")
+	rateBurstFlag := flag.Int("rate-burst", 10, "Tool calls a client may make at once before -rate-limit applies")
+	maxModelCallsFlag := flag.Int("max-model-calls", 8, "Model calls in flight at once, across all clients and tools; further calls wait for a slot (0 is unlimited)")
+	circuitFailuresFlag := flag.Int("circuit-failures", 5, "Consecutive failed calls to a model, each already retried, after which its circuit opens and calls to it fail at once (0 disables)")
+	circuitCooldownFlag := flag.Duration("circuit-cooldown", 30*time.Second, "How long a model's circuit stays open before one call is let through to probe it")
+	retryAttemptsFlag := flag.Int("retry-attempts", defaultRetryPolicy.Attempts, "Attempts per model for calls failing with 429, 5xx or a network error; other errors aren't retried")
+	retryDelayFlag := flag.Duration("retry-base-delay", defaultRetryPolicy.BaseDelay, "Wait before the first retry of a failed model call, doubling with each retry after that, with jitter; a provider's Retry-After is honored instead")
+	escalationWebhookFlag := flag.String("escalation-webhook", "", "URL that receives an event for every escalation (question, answer hash, model, latency, cost) as a JSON POST, signed with ESCALATION_WEBHOOK_SECRET when set (optional)")
+	approvalCostFlag := flag.Float64("approval-cost", 0, "Hold model requests with an estimated cost of at least this many USD for human approval (0 disables)")
+	approvalPatternFlags := &patternFlag{}
+	flag.Var(approvalPatternFlags, "approval-pattern", "Hold model requests matching this regular expression for human approval (repeatable)")
+	approvalWaitFlag := flag.Duration("approval-wait", 2*time.Minute, "How long a request held for approval waits for a decision before the escalation is answered as pending")
+	approvalSlackFlag := flag.String("approval-slack-webhook", "", "Slack incoming webhook that receives approval requests with Approve and Deny buttons; clicks are verified with SLACK_SIGNING_SECRET (optional)")
+	approvalAddrFlag := flag.String("approval-addr", "", "Address serving the approval admin API and Slack endpoint, e.g. 127.0.0.1:9002 (default: the -sse server)")
+	humanSlackFlag := flag.String("human-slack-webhook", "", "Slack incoming webhook escalate_to_human posts problems to, with the model's best-effort answer (empty disables the tool)")
+	humanChannelFlag := flag.String("human-slack-channel", "", "Channel escalate_to_human posts to, e.g. #backend-help (default: the webhook's channel)")
+	githubRepoFlag := flag.String("github-repo", "", "GitHub repository, as owner/name, that file_issue opens issues in; uses GITHUB_TOKEN (empty disables the tool)")
+	githubAPIFlag := flag.String("github-api-url", defaultGitHubAPI, "GitHub API base URL, e.g. https://github.example.com/api/v3 for GitHub Enterprise")
+	githubLabelsFlag := flag.String("github-labels", "escalation", "Comma-separated labels added to every issue filed")
+	githubAutoFileFlag := flag.Bool("github-auto-file", false, "Also file an issue in -github-repo for every get_help answer the model rates low confidence")
+	sessionTTLFlag := flag.Duration("session-ttl", 30*time.Minute, "How long an idle get_help session keeps its conversation history")
+	draftTTLFlag := flag.Duration("draft-ttl", time.Hour, "How long a request drafted with get_help's draft argument can be sent with send_draft")
+	drainTimeoutFlag := flag.Duration("drain-timeout", 30*time.Second, "On SIGINT or SIGTERM, how long to wait for requests in flight to be answered before exiting")
+	historyDBFlag := flag.String("history-db", defaultHistoryPath(), "SQLite file recording every escalation (empty disables history)")
+	officeHoursFlag := flag.String("office-hours", "", "Recurring meeting to brief on escalations reported unresolved since the last one, e.g. \"Thu 15:00\", \"Mon,Thu 09:30\" or \"daily 16:00\" in local time (requires -history-db and -office-hours-slack-webhook or -office-hours-email)")
+	officeHoursLeadFlag := flag.Duration("office-hours-lead", time.Hour, "How long before each -office-hours meeting the digest is sent")
+	officeHoursSlackFlag := flag.String("office-hours-slack-webhook", "", "Slack incoming webhook the -office-hours digest is posted to")
+	officeHoursChannelFlag := flag.String("office-hours-slack-channel", "", "Channel the -office-hours digest is posted to (default: the webhook's channel)")
+	officeHoursEmailFlag := flag.String("office-hours-email", "", "Comma-separated addresses the -office-hours digest is emailed to, through SMTP_ADDR (host:port) as SMTP_FROM, authenticating with SMTP_USERNAME and SMTP_PASSWORD when set")
+	examplesFlag := flag.Int("examples", 0, "Past escalations, reported resolved by report_outcome, on a similar question added to each get_help prompt as examples (requires -history-db)")
+	countersDBFlag := flag.String("counters-db", defaultCountersPath(), "SQLite file keeping budget spend and each client's recent escalations across restarts (empty keeps them in memory)")
+	chunkSizeFlag := flag.Int("chunk-size", 0, "Deliver MCP tool answers longer than this many characters in parts, with an index first (0 disables; at least 1000)")
+	chunkModeFlag := flag.String("chunk-mode", chunkModeBlocks, "How parts of long answers are delivered: blocks (each part its own content block) or resources (the first part inline, the rest read with resources/read)")
 	sseFlag := flag.Bool("sse", false, "Run as HTTP server instead of stdio mode")
+	apiKeysFlag := flag.String("api-keys", "", "JSON file of API keys, [{\"name\": ..., \"key\": ...}], required as bearer tokens on the -sse server's endpoints (optional)")
+	oauthIssuerFlag := flag.String("oauth-issuer", "", "OAuth 2 authorization server whose access tokens the -sse server accepts, per the MCP authorization spec (optional)")
+	oauthIntrospectionFlag := flag.String("oauth-introspection-url", "", "Token introspection endpoint of -oauth-issuer (default: from the issuer's metadata); authenticates with OAUTH_CLIENT_ID and OAUTH_CLIENT_SECRET")
+	oauthResourceFlag := flag.String("oauth-resource", "", "URL clients reach the -sse server at, which access tokens must be issued for (default: http://127.0.0.1:<port>)")
+	tlsCertFlag := flag.String("tls-cert", "", "PEM certificate the HTTP listeners serve TLS with; reloaded when it changes (optional; needs -tls-key)")
+	tlsKeyFlag := flag.String("tls-key", "", "PEM private key for -tls-cert")
+	tlsClientCAFlag := flag.String("tls-client-ca", "", "PEM bundle of CAs that client certificates are verified against, for mutual TLS (optional; needs -tls-cert)")
+	tlsClientAuthFlag := flag.String("tls-client-auth", clientAuthRequire, "With -tls-client-ca: require a client certificate from every caller, or verify only those presented (require or optional)")
+	readOnlyFlag := flag.Bool("read-only", false, "Refuse flags that run commands or call webhooks, and write nothing to disk but the log (history and the code index are only read)")
+	baseURLFlag := flag.String("base-url", "", "OpenAI-compatible API base URL (default: https://api.openai.com/v1)")
+	orgFlag := flag.String("org", "", "OpenAI organization ID")
+	projectFlag := flag.String("project", "", "OpenAI project ID")
+	cassetteFlag := flag.String("cassette", "", "Record provider HTTP interactions to, or replay them from, this file (for integration tests)")
+	cassetteModeFlag := flag.String("cassette-mode", "replay", "Cassette mode: record or replay")
+	headerFlags := headerFlag{}
+	flag.Var(headerFlags, "header", "Extra HTTP header for API requests as \"Name: value\" (repeatable)")
+	repoFlag := flag.String("repo", "", "Repository root whose files callers may name with get_help's files argument (optional)")
+	verifyAnswersFlag := flag.String("verify-answers", "", "Check the files and symbols each get_help answer names against -repo: annotate notes those not found, regenerate asks the model once to revise the answer first (default: off)")
+	repoToolsFlag := flag.Bool("repo-tools", false, "Let the model read, list and search files under -repo with function calls while answering")
+	repoToolStepsFlag := flag.Int("repo-tool-steps", 8, "Rounds of function calls allowed with -repo-tools before the model must answer")
+	indexDBFlag := flag.String("index-db", "", "Code index built by the index subcommand; the chunks most relevant to each question are added to the prompt (empty disables retrieval)")
+	embeddingModelFlag := flag.String("embedding-model", defaultEmbeddingModel, "OpenAI embedding model the index was built with")
+	retrieveKFlag := flag.Int("retrieve-k", 5, "Number of indexed chunks added to each prompt")
+	lspCmdFlag := flag.String("lsp-cmd", "", "Language server command, e.g. gopls, run in -repo (or the working directory) to look up the symbols named in each question (optional)")
+	gitContextFlag := flag.Bool("git-context", false, "Include the git branch, uncommitted changes and recent commits of -repo (or the working directory) in every prompt")
+	gitCommitsFlag := flag.Int("git-commits", 5, "Number of recent commit messages included with -git-context")
+	secretScannersFlag := flag.String("secret-scanners", "regex", "Comma-separated built-in secret scanners (regex, entropy) run on every outbound request; secrets found are redacted (empty disables)")
+	secretPatternsFlag := flag.String("secret-patterns", "", "JSON file of extra secret patterns, [{\"kind\": ..., \"pattern\": ...}], redacted from every outbound request alongside -secret-scanners (optional)")
+	secretScannerCmdFlags := &commandFlag{}
+	piiScrubFlag := flag.String("pii-scrub", "", "Comma-separated built-in PII detectors (email, phone) whose findings are masked in every outbound request, after secret redaction (default: none)")
+	piiNamesFlag := flag.String("pii-names", "", "File of names, one per line, masked as PII in every outbound request (optional)")
+	piiPatternsFlag := flag.String("pii-patterns", "", "JSON file of PII patterns, [{\"kind\": ..., \"pattern\": ...}], masked in every outbound request (optional)")
+	flag.Var(secretScannerCmdFlags, "secret-scanner-cmd", "External secret scanner command that reads text on stdin and prints JSON findings, e.g. gitleaks (repeatable)")
+	argumentRulesFlag := flag.String("argument-rules", "", "JSON file of per-tool, per-argument rules (drop, mask, hash, replace) applied to tool arguments before they are logged, recorded or sent (optional)")
+	pullRequestsFlag := flag.Bool("pull-requests", false, "Let callers name a GitHub pull request or GitLab merge request with get_help's pull_request argument; the server fetches its diff and changed files (uses GITHUB_TOKEN and GITLAB_TOKEN)")
+	gitlabURLFlag := flag.String("gitlab-url", "https://gitlab.com", "GitLab instance merge requests are fetched from with -pull-requests")
+	webContextFlag := flag.Bool("web-context", false, "Let callers name web pages with get_help's urls argument; the server fetches them into the prompt")
+	contextSourceCmdFlags := &commandFlag{}
+	flag.Var(contextSourceCmdFlags, "context-source-cmd", "External context source command that reads the escalation as JSON on stdin and prints JSON context blocks (repeatable)")
+	confluenceURLFlag := flag.String("confluence-url", "", "Confluence base URL (e.g. https://example.atlassian.net/wiki) searched for pages matching each question; uses CONFLUENCE_USER and CONFLUENCE_TOKEN (optional)")
+	confluenceSpaceFlag := flag.String("confluence-space", "", "Confluence space key searched with -confluence-url (default: all spaces)")
+	wikiSearchURLFlag := flag.String("wiki-search-url", "", "Search API endpoint of another wiki, queried with ?q=...&limit=...; uses WIKI_SEARCH_TOKEN (optional)")
+	wikiPagesFlag := flag.Int("wiki-pages", 3, "Number of wiki pages whose excerpts are added to each prompt")
+	pipelinesFlag := flag.String("pipelines", "", "JSON file of pipelines, each exposed as a tool running other tools in sequence with earlier answers threaded into later steps (optional)")
+	expertsFlag := flag.String("experts", "", "JSON file of expert MCP servers that questions on their subject are forwarded to instead of -model (optional)")
+	expertClassifierFlag := flag.String("expert-classifier-model", "", "Cheap model that picks the expert for each question from their descriptions (default: match the experts' keywords)")
+	ollamaWarmFlag := flag.Bool("ollama-warm", false, "Load the local models into Ollama at startup, so the first escalation doesn't wait for them (requires -base-url pointing at Ollama)")
+	ollamaPullFlag := flag.Bool("ollama-pull", false, "Pull local models Ollama doesn't have at startup, before loading them")
+	ollamaKeepAliveFlag := flag.Duration("ollama-keepalive", 0, "Ping Ollama this often so the local models are never unloaded, e.g. 4m (default: 0, disabled)")
+	ollamaModelsFlag := flag.String("ollama-models", "", "Comma-separated models to prepare with -ollama-warm, -ollama-pull and -ollama-keepalive (default: -model and -cascade-model)")
+	warmFlag := flag.Bool("warm", true, "Load the summary and code index and open the model connection when a session starts (at startup with -sse)")
+	errorTrackerFlag := flag.String("error-tracker", "", "Report provider failures and crashes, scrubbed of escalation content, to sentry (uses SENTRY_DSN) or rollbar (uses ROLLBAR_ACCESS_TOKEN) (optional)")
+	errorTrackerEnvFlag := flag.String("error-tracker-environment", "production", "Environment reported with -error-tracker")
+	sentryURLFlag := flag.String("sentry-url", "https://sentry.io", "Sentry base URL used to fetch issues (requires SENTRY_AUTH_TOKEN)")
+	featuresFlag := flag.String("features", "", "JSON file of feature flags rolling experimental capabilities (consensus, streaming, web_context) out to some clients; admin API changes are saved back to it (optional)")
+	featuresAddrFlag := flag.String("features-addr", "", "Address serving the feature flag admin API, e.g. 127.0.0.1:9003 (default: the -sse server)")
+	logLevelFlag := flag.String("log-level", "info", "Minimum level of log entries: debug, info, warn or error")
+	logFormatFlag := flag.String("log-format", logFormatText, "Log entry format: text (key=value pairs) or json (one object per line)")
+	logFileFlag := flag.String("log-file", "", "File log entries are written to, or stderr (default: ~/.escalator/escalator.log in stdio mode, stderr with -sse)")
+	logMaxSizeFlag := flag.Int("log-max-size", 10, "Rotate -log-file once it reaches this many megabytes (0 disables rotation)")
+	logMaxFilesFlag := flag.Int("log-max-files", 3, "Rotated log files kept beside -log-file, as .1 (newest) to .N")
+	metricsFlag := flag.Bool("metrics", false, "Serve Prometheus metrics at /metrics on the -sse server or -metrics-addr")
+	metricsAddrFlag := flag.String("metrics-addr", "", "Address serving /metrics, e.g. 127.0.0.1:9090; implies -metrics, and is needed for it in stdio mode")
+	auditLogFlag := flag.String("audit-log", "", "File, or directory for one file per day, recording every escalation's full prompt, answer, model and caller as JSON lines (default: disabled)")
+	auditMaxSizeFlag := flag.Int("audit-max-size", 100, "Rotate an -audit-log file once it reaches this many megabytes (0 disables rotation)")
+	auditMaxFilesFlag := flag.Int("audit-max-files", 10, "Rotated -audit-log files kept")
+	auditScannersFlag := flag.String("audit-secret-scanners", "", "Comma-separated built-in secret scanners (regex, entropy) whose findings are redacted from -audit-log entries (default: none, entries are verbatim)")
+	otlpEndpointFlag := flag.String("otlp-endpoint", "", "OTLP/HTTP collector spans are exported to, e.g. http://localhost:4318 (default: $OTEL_EXPORTER_OTLP_ENDPOINT; tracing is off when neither is set)")
 
 	flag.Usage = func() {
 		fmt.Fprintf(flag.CommandLine.Output(), "Usage of %s:\n", "escalator")
 		fmt.Fprintf(flag.CommandLine.Output(), "  MCP Escalator - Routes unsolved problems to OpenAI for clarification\n\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "Subcommands:\n  serve           Serve MCP over stdio, or HTTP with -sse (the default)\n  ask [flags] question  Answer one question in the terminal, with code piped to stdin as relevant code\n  prompts test    Render and lint prompt templates against fixtures\n  history list    List recent escalations\n  history show    Show one escalation in full\n  history stats   Report context window utilization\n  history import  Merge JSONL escalation exports into the local history\n  history export  Write the local history as JSONL\n  history publish Render the history as a static, searchable HTML site\n  history digest  Print the office hours briefing of escalations reported unresolved\n  init            Write a starter config, prompt template and persona to ~/.escalator\n  doctor          Check the configuration and report problems\n  index           Embed a repository's files for retrieval with -index-db\n  counters        List and adjust the persisted budget spend and client throttles\n  config validate Check a -config file and the ESCALATOR_ environment\n\n")
 		flag.PrintDefaults()
 	}
 
-	flag.Parse()
+	// Checking a config file needs the flags it sets, so it runs once
+	// they're defined.
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		os.Exit(runConfigCommand(os.Args[2:], flag.CommandLine, os.Stdout))
+	}
+
+	// serve, the default, and ask take the server's flags, and run once the
+	// tools are set up.
+	command, args := "serve", os.Args[1:]
+	if len(args) > 0 && (args[0] == "serve" || args[0] == "ask") {
+		command, args = args[0], args[1:]
+	}
+	flag.CommandLine.Parse(args)
+	if command == "serve" && flag.NArg() > 0 {
+		log.Fatalf("Unknown subcommand %q", flag.Arg(0))
+	}
+
+	configPath := *configFlag
+	if configPath == "" {
+		configPath = os.Getenv(configEnvPrefix + "CONFIG")
+	}
+	// The flags given on the command line keep precedence when the
+	// config is reloaded, so they are noted before the config sets the
+	// others.
+	commandLine := givenFlags(flag.CommandLine)
+	if err := ApplyConfig(flag.CommandLine, configPath, os.LookupEnv); err != nil {
+		log.Fatal(err)
+	}
+
+	if *readOnlyFlag {
+		if err := checkReadOnly(flag.CommandLine, os.LookupEnv); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if _, err := newLogHandler(io.Discard, *logLevelFlag, *logFormatFlag); err != nil {
+		log.Fatal(err)
+	}
+	if *logMaxSizeFlag < 0 || *logMaxFilesFlag < 0 {
+		log.Fatal("-log-max-size and -log-max-files can't be negative")
+	}
+
+	// Set up logging before anything logs, so every entry has the chosen
+	// format and level. log.Fatal and any other log package output go
+	// through the same handler.
+	logOut, logErr := openLogOutput(*logFileFlag, *sseFlag, int64(*logMaxSizeFlag)<<20, *logMaxFilesFlag)
+	if logErr != nil {
+		if *logFileFlag != "" {
+			log.Fatalf("Couldn't open log file %s: %v", *logFileFlag, logErr)
+		}
+		// The default file is a convenience, so fall back to stderr.
+		logOut = os.Stderr
+	}
+	logHandler, _ := newLogHandler(logOut, *logLevelFlag, *logFormatFlag)
+	slog.SetDefault(slog.New(logHandler))
+	if file, ok := logOut.(*RotatingFile); ok {
+		defer file.Close()
+	}
+	if logErr != nil {
+		slog.Warn("Couldn't open the log file, logging to stderr", "path", defaultLogPath(), "error", logErr)
+	}
+
+	// Replaying a cassette never reaches the provider, so it needs no key.
+	replaying := *cassetteFlag != "" && *cassetteModeFlag == "replay"
+	if os.Getenv("OPENAI_API_KEY") == "" && !replaying {
+		log.Fatal("OPENAI_API_KEY environment variable is required")
+	}
+
+	var tracker *ErrorTracker
+	switch *errorTrackerFlag {
+	case "":
+	case "sentry":
+		sentry, err := NewSentryTracker(os.Getenv("SENTRY_DSN"))
+		if err != nil {
+			log.Fatalf("-error-tracker sentry needs SENTRY_DSN: %v", err)
+		}
+		tracker = sentry
+	case "rollbar":
+		token := os.Getenv("ROLLBAR_ACCESS_TOKEN")
+		if token == "" {
+			log.Fatal("-error-tracker rollbar needs ROLLBAR_ACCESS_TOKEN")
+		}
+		tracker = NewRollbarTracker(token)
+	default:
+		log.Fatalf("Unknown -error-tracker %q (want sentry or rollbar)", *errorTrackerFlag)
+	}
+	if tracker != nil {
+		tracker.WithEnvironment(*errorTrackerEnvFlag, "escalator@1.0.0")
+		defer tracker.Recover(map[string]string{"component": "main"})
+	}
 
 	// Create MCP server
-	server := NewMCPServer("escalator", "1.0.0")
-	
+	var metrics *Metrics
+	if *metricsFlag || *metricsAddrFlag != "" {
+		if *metricsAddrFlag == "" && !*sseFlag {
+			log.Fatal("-metrics needs -metrics-addr in stdio mode, so Prometheus has something to scrape")
+		}
+		metrics = NewMetrics()
+	}
+
+	addr, err := listenAddress(*listenFlag, *portFlag)
+	if err != nil {
+		log.Fatalf("-listen: %v", err)
+	}
+
+	var tlsConfig *tls.Config
+	if *tlsCertFlag != "" || *tlsKeyFlag != "" {
+		if *tlsCertFlag == "" || *tlsKeyFlag == "" {
+			log.Fatal("-tls-cert and -tls-key must be given together")
+		}
+		var err error
+		if tlsConfig, err = NewServerTLS(*tlsCertFlag, *tlsKeyFlag, *tlsClientCAFlag, *tlsClientAuthFlag); err != nil {
+			log.Fatalf("TLS: %v", err)
+		}
+	} else if *tlsClientCAFlag != "" {
+		log.Fatal("-tls-client-ca verifies clients over TLS, and needs -tls-cert and -tls-key")
+	}
+
+	var auth *HTTPAuth
+	if *apiKeysFlag != "" || *oauthIssuerFlag != "" {
+		if !*sseFlag {
+			log.Fatal("-api-keys and -oauth-issuer protect the HTTP endpoints, and need -sse")
+		}
+		auth = NewHTTPAuth().WithMetrics(metrics)
+		if *apiKeysFlag != "" {
+			keys, err := LoadAPIKeys(*apiKeysFlag)
+			if err != nil {
+				log.Fatalf("-api-keys: %v", err)
+			}
+			auth.WithKeys(keys)
+		}
+		if *oauthIssuerFlag != "" {
+			resource := *oauthResourceFlag
+			if resource == "" {
+				resource = advertisedURL(addr, tlsConfig != nil)
+			}
+			validator := NewOAuthValidator(*oauthIssuerFlag, resource).
+				WithIntrospection(*oauthIntrospectionFlag, os.Getenv("OAUTH_CLIENT_ID"), os.Getenv("OAUTH_CLIENT_SECRET"))
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			err := validator.Discover(ctx)
+			cancel()
+			if err != nil {
+				log.Fatalf("-oauth-issuer: %v", err)
+			}
+			auth.WithOAuth(validator)
+		}
+	}
+	if *sseFlag && !isLoopback(addr) {
+		clientCerts := tlsConfig != nil && tlsConfig.ClientAuth == tls.RequireAndVerifyClientCert
+		switch {
+		case auth == nil && !clientCerts && !*allowUnauthenticatedFlag:
+			log.Fatalf("-listen %s accepts connections from other hosts; authenticate callers with -api-keys, -oauth-issuer or -tls-client-ca, or pass -allow-unauthenticated if something in front of the server does", addr)
+		case auth == nil && !clientCerts:
+			slog.Warn("Serving unauthenticated escalations to other hosts", "addr", addr)
+		case tlsConfig == nil:
+			slog.Warn("Serving other hosts without TLS: keys and tokens cross the network in the clear", "addr", addr)
+		}
+	}
+
+	var tracer *Tracer
+	if endpoint := *otlpEndpointFlag; endpoint != "" || os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" {
+		if endpoint == "" {
+			endpoint = os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+		}
+		headers, err := parseOTLPHeaders(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		service := os.Getenv("OTEL_SERVICE_NAME")
+		if service == "" {
+			service = "escalator"
+		}
+		tracer = NewTracer(endpoint, service, "1.0.0").WithHeaders(headers)
+		go tracer.Run(context.Background())
+	}
+
+	var audit *AuditLog
+	if *auditLogFlag != "" {
+		if *auditMaxSizeFlag < 0 || *auditMaxFilesFlag < 0 {
+			log.Fatal("-audit-max-size and -audit-max-files can't be negative")
+		}
+		// Unlike the log, the audit log is never truncated to rotate it.
+		if *auditMaxSizeFlag > 0 && *auditMaxFilesFlag == 0 {
+			log.Fatal("-audit-max-files must be at least 1 when -audit-max-size rotates the audit log")
+		}
+		var err error
+		if audit, err = OpenAuditLog(*auditLogFlag, int64(*auditMaxSizeFlag)<<20, *auditMaxFilesFlag); err != nil {
+			log.Fatalf("Couldn't open the audit log %s: %v", *auditLogFlag, err)
+		}
+		var scanners []SecretScanner
+		for _, name := range splitList(*auditScannersFlag) {
+			scanner, err := secretScannerFor(name)
+			if err != nil {
+				log.Fatalf("-audit-secret-scanners: %v", err)
+			}
+			scanners = append(scanners, scanner)
+		}
+		if len(scanners) > 0 {
+			audit.WithRedactor(NewRedactor(scanners...))
+		}
+		defer audit.Close()
+	}
+
+	server := NewMCPServer("escalator", "1.0.0").WithErrorTracker(tracker).WithMetrics(metrics).WithTracer(tracer).WithAuditLog(audit)
+	if *signingKeyFlag != "" {
+		signer, err := LoadSigner(*signingKeyFlag)
+		if err != nil {
+			log.Fatalf("Couldn't load signing key: %v", err)
+		}
+		server.WithSigner(signer)
+	}
+	if *chunkSizeFlag > 0 {
+		chunker, err := NewAnswerChunker(*chunkSizeFlag, *chunkModeFlag)
+		if err != nil {
+			log.Fatal(err)
+		}
+		server.WithChunker(chunker)
+	}
+	if *argumentRulesFlag != "" {
+		rules, err := LoadArgumentRules(*argumentRulesFlag)
+		if err != nil {
+			log.Fatalf("Couldn't load argument rules %s: %v", *argumentRulesFlag, err)
+		}
+		server.WithArgumentRules(rules)
+	}
+	var features *FeatureFlags
+	if *featuresFlag != "" {
+		var err error
+		if features, err = LoadFeatureFlags(*featuresFlag); err != nil {
+			log.Fatalf("Couldn't load feature flags %s: %v", *featuresFlag, err)
+		}
+		features.WithAdminToken(os.Getenv("ESCALATOR_ADMIN_TOKEN"))
+		if !*readOnlyFlag {
+			features.WithFile(*featuresFlag)
+		}
+		server.WithFeatures(features)
+	}
+	var counters *CounterStore
+	if *countersDBFlag != "" && !*readOnlyFlag {
+		var err error
+		if counters, err = OpenCounters(*countersDBFlag); err != nil {
+			slog.Warn("Couldn't open counters, keeping them in memory", "path", *countersDBFlag, "error", err)
+		} else {
+			defer counters.Close()
+		}
+	}
+	if *anomalyMaxCallsFlag > 0 || *anomalyMaxSimilarFlag > 0 {
+		monitor := NewEscalationMonitor(*anomalyWindowFlag, *anomalyMaxCallsFlag, *anomalyMaxSimilarFlag).
+			WithThrottle(*anomalyThrottleFlag).
+			WithWebhook(*anomalyWebhookFlag)
+		if counters != nil {
+			monitor.WithStore(counters)
+		}
+		server.WithMonitor(monitor)
+	}
+	if *cooldownMaxFlag > 0 {
+		if *cooldownSimilarityFlag <= 0 || *cooldownSimilarityFlag > 1 {
+			log.Fatal("-cooldown-similarity must be greater than 0 and at most 1")
+		}
+		server.WithCooldown(NewTopicCooldown(*cooldownMaxFlag, *cooldownWindowFlag, *cooldownSimilarityFlag))
+	}
+	var limiter *RateLimiter
+	if *rateLimitFlag > 0 {
+		limiter = NewRateLimiter(*rateLimitFlag, *rateBurstFlag).WithMetrics(metrics)
+		server.WithRateLimiter(limiter)
+	}
+	var callLimiter *CallLimiter
+	if *maxModelCallsFlag > 0 {
+		callLimiter = NewCallLimiter(*maxModelCallsFlag)
+	}
+	var breaker *CircuitBreaker
+	if *circuitFailuresFlag > 0 {
+		breaker = NewCircuitBreaker(*circuitFailuresFlag, *circuitCooldownFlag).WithMetrics(metrics)
+	}
+	if *retryAttemptsFlag < 1 {
+		log.Fatal("-retry-attempts must be at least 1")
+	}
+	retryPolicy := RetryPolicy{Attempts: *retryAttemptsFlag, BaseDelay: *retryDelayFlag, MaxDelay: defaultRetryPolicy.MaxDelay}
+
+	// A cassette only holds the recorded calls, so don't add warm-up ones.
+	server.WithWarmStart(*warmFlag && *cassetteFlag == "")
+
 	// Register tools
-	helpTool := NewGetHelpTool(*summaryFlag, *modelFlag)
+	clientOpts := ClientOptions{
+		BaseURL: *baseURLFlag,
+		OrgID:   *orgFlag,
+		Project: *projectFlag,
+		Headers: headerFlags,
+	}
+	if *cassetteFlag != "" {
+		cassette, err := NewCassetteTransport(*cassetteFlag, *cassetteModeFlag)
+		if err != nil {
+			log.Fatalf("Couldn't open cassette: %v", err)
+		}
+		clientOpts.Transport = cassette
+	}
+	var scanners []SecretScanner
+	for _, name := range splitList(*secretScannersFlag) {
+		scanner, err := secretScannerFor(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		scanners = append(scanners, scanner)
+	}
+	if *secretPatternsFlag != "" {
+		scanner, err := LoadSecretPatterns(*secretPatternsFlag)
+		if err != nil {
+			log.Fatalf("-secret-patterns: %v", err)
+		}
+		scanners = append(scanners, scanner)
+	}
+	for _, command := range *secretScannerCmdFlags {
+		scanner, err := NewExecScanner(command)
+		if err != nil {
+			log.Fatal(err)
+		}
+		scanners = append(scanners, scanner)
+	}
+	var redactor *Redactor
+	if len(scanners) > 0 {
+		redactor = NewRedactor(scanners...)
+	}
+	var scrubber *Redactor
+	if *piiScrubFlag != "" || *piiNamesFlag != "" || *piiPatternsFlag != "" {
+		var extra []secretPattern
+		if *piiNamesFlag != "" {
+			names, err := LoadPIINames(*piiNamesFlag)
+			if err != nil {
+				log.Fatalf("-pii-names: %v", err)
+			}
+			extra = append(extra, names)
+		}
+		if *piiPatternsFlag != "" {
+			patterns, err := loadPatterns(*piiPatternsFlag)
+			if err != nil {
+				log.Fatalf("-pii-patterns: %v", err)
+			}
+			extra = append(extra, patterns...)
+		}
+		scanner, err := NewPIIScanner(splitList(*piiScrubFlag), extra...)
+		if err != nil {
+			log.Fatalf("-pii-scrub: %v", err)
+		}
+		scrubber = NewPIIScrubber(scanner)
+	}
+	if *escalationWebhookFlag != "" {
+		server.WithEscalationWebhook(NewEscalationWebhook(*escalationWebhookFlag).
+			WithSecret(os.Getenv("ESCALATION_WEBHOOK_SECRET")).
+			WithRedactor(redactor))
+	}
+
+	if *promptSoftLimitFlag < 1000 || *promptHardLimitFlag < *promptSoftLimitFlag {
+		log.Fatal("-prompt-soft-limit must be at least 1000 and -prompt-hard-limit at least -prompt-soft-limit")
+	}
+	helpTool := NewGetHelpTool(*summaryFlag, *modelFlag).
+		WithClientOptions(clientOpts).
+		WithPromptLimits(*promptSoftLimitFlag, *promptHardLimitFlag).
+		WithFallbackModels(splitList(*fallbackFlag)).
+		WithAllowedModels(splitList(*allowedModelsFlag)).
+		WithRequiredSummary(*requireSummaryFlag)
+	persona, err := LoadPersona(*personaFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	helpTool.WithPersona(persona)
+	if *responseFormatFlag != responseFormatText && *responseFormatFlag != responseFormatJSON {
+		log.Fatalf("Unknown -response-format %q (want text or json)", *responseFormatFlag)
+	}
+	helpTool.WithResponseFormat(*responseFormatFlag)
+	if *promptTemplateFlag != "" {
+		tmpl, err := LoadPromptTemplate(*promptTemplateFlag, promptVarFlags)
+		if err != nil {
+			log.Fatalf("Couldn't load prompt template %s: %v", *promptTemplateFlag, err)
+		}
+		helpTool.WithPromptTemplate(tmpl, promptVarFlags)
+	}
+	if *promptVariantsFlag || len(promptVariantFlags) > 0 {
+		variants, err := LoadPromptVariants(*promptVariantsFlag, promptVariantFlags)
+		if err != nil {
+			log.Fatalf("Couldn't load prompt variants: %v", err)
+		}
+		slog.Info("Adapting prompts for model families", "families", variants.Families())
+		helpTool.WithPromptVariants(variants)
+	}
+	if err := helpTool.CheckSummary(); err != nil {
+		if *requireSummaryFlag {
+			log.Fatalf("Couldn't read summary file %s: %v", helpTool.SummaryPath(), err)
+		}
+		slog.Warn("Couldn't read summary file; get_help will use only the caller-provided summary", "path", helpTool.SummaryPath(), "error", err)
+	}
+	if *cacheSizeFlag > 0 {
+		helpTool.WithCache(NewResponseCache(*cacheSizeFlag, *cacheTTLFlag))
+	}
+	var budget *Budget
+	if *budgetDailyFlag > 0 || *budgetMonthlyFlag > 0 {
+		budget = NewBudget(*budgetDailyFlag, *budgetMonthlyFlag)
+		if counters != nil {
+			budget.WithStore(counters)
+		}
+		helpTool.WithBudget(budget)
+	}
+	var approval *ApprovalGate
+	if *approvalCostFlag > 0 || len(*approvalPatternFlags) > 0 {
+		approval = NewApprovalGate(*approvalCostFlag, *approvalPatternFlags, *approvalWaitFlag).
+			WithAdminToken(os.Getenv("ESCALATOR_ADMIN_TOKEN"))
+		if *approvalSlackFlag != "" {
+			approval.WithSlack(*approvalSlackFlag, os.Getenv("SLACK_SIGNING_SECRET"))
+		}
+		if *approvalAddrFlag == "" && !*sseFlag {
+			log.Fatal("Approval needs -approval-addr in stdio mode, so approvers can reach the admin API or Slack endpoint")
+		}
+	}
+	var watcher *ModelWatcher
+	if *modelCheckFlag > 0 && *cassetteFlag == "" {
+		models := []string{*modelFlag, *cascadeFlag, *translateFlag, *compressFlag, *expertClassifierFlag}
+		models = append(models, splitList(*fallbackFlag)...)
+		models = append(models, splitList(*ensembleFlag)...)
+		models = append(models, splitList(*allowedModelsFlag)...)
+		for _, model := range toolModelFlags {
+			models = append(models, model)
+		}
+		watcher = NewModelWatcher(models, helpTool.LLM().ListModels).
+			WithAutoMigrate(*modelAutoMigrateFlag).
+			WithNotify(server.notifyWarning)
+		if *modelDeprecationsFlag != "" {
+			deprecations, err := LoadModelDeprecations(*modelDeprecationsFlag)
+			if err != nil {
+				log.Fatalf("-model-deprecations: %v", err)
+			}
+			watcher.WithDeprecations(deprecations)
+		}
+	}
+	// configureLLM applies the policies every model call is under: redaction,
+	// approval, error tracking, metrics, auditing, deprecation checks, call
+	// limits, the circuit breaker and retries.
+	configureLLM := func(l *LLM) *LLM {
+		return l.WithRedactor(redactor).WithPIIScrubber(scrubber).WithApproval(approval).WithErrorTracker(tracker).WithMetrics(metrics).WithAuditLog(audit).WithModelWatcher(watcher).WithCallLimiter(callLimiter).WithCircuitBreaker(breaker).WithRetryPolicy(retryPolicy)
+	}
+	configureLLM(helpTool.LLM())
+	if watcher != nil {
+		go watcher.Run(context.Background(), *modelCheckFlag)
+	}
+	if *cascadeFlag != "" {
+		helpTool.WithCascade(NewCascade(configureLLM(NewLLM(*cascadeFlag).WithClientOptions(clientOpts).WithBudget(budget)), *cascadeConfidenceFlag))
+	}
+	if *translateFlag != "" {
+		helpTool.WithTranslator(NewTranslator(configureLLM(NewLLM(*translateFlag).WithClientOptions(clientOpts).WithBudget(budget))))
+	}
+	if *compressFlag != "" {
+		helpTool.WithCompressor(NewCompressor(configureLLM(NewLLM(*compressFlag).WithClientOptions(clientOpts).WithBudget(budget))))
+	}
+	if *repoFlag != "" {
+		repo, err := OpenRepository(*repoFlag)
+		if err != nil {
+			log.Fatalf("Couldn't open repository %s: %v", *repoFlag, err)
+		}
+		helpTool.WithRepository(repo)
+		if *repoToolsFlag {
+			helpTool.WithRepoTools(NewRepoTools(repo, *repoToolStepsFlag))
+		}
+		if *verifyAnswersFlag != "" {
+			verifier, err := NewAnswerVerifier(repo, *verifyAnswersFlag)
+			if err != nil {
+				log.Fatal(err)
+			}
+			helpTool.WithVerifier(verifier)
+		}
+	} else if *repoToolsFlag || *verifyAnswersFlag != "" {
+		log.Fatal("-repo-tools and -verify-answers require -repo")
+	}
+	if *gitContextFlag {
+		dir := *repoFlag
+		if dir == "" {
+			dir = "."
+		}
+		helpTool.WithGitContext(NewGitContext(dir, *gitCommitsFlag))
+	}
+	if *lspCmdFlag != "" {
+		dir := *repoFlag
+		if dir == "" {
+			dir = "."
+		}
+		client, err := NewLSPClient(*lspCmdFlag, dir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer client.Close()
+		helpTool.WithLSP(client)
+	}
+	if *webContextFlag {
+		helpTool.WithWebSource(NewWebSource())
+	}
+	if *pullRequestsFlag {
+		fetcher, err := NewPullRequestFetcher(*githubAPIFlag, os.Getenv("GITHUB_TOKEN"), *gitlabURLFlag, os.Getenv("GITLAB_TOKEN"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		helpTool.WithPullRequests(fetcher)
+	}
+	for _, command := range *contextSourceCmdFlags {
+		source, err := NewExecContextSource(command)
+		if err != nil {
+			log.Fatal(err)
+		}
+		helpTool.WithContextSource(source)
+	}
+	if *confluenceURLFlag != "" {
+		searcher := NewConfluenceSearcher(*confluenceURLFlag, *confluenceSpaceFlag, os.Getenv("CONFLUENCE_USER"), os.Getenv("CONFLUENCE_TOKEN"))
+		helpTool.WithContextSource(NewWikiSource("confluence", searcher, *wikiPagesFlag))
+	}
+	if *wikiSearchURLFlag != "" {
+		searcher := NewSearchAPISearcher(*wikiSearchURLFlag, os.Getenv("WIKI_SEARCH_TOKEN"))
+		helpTool.WithContextSource(NewWikiSource("wiki", searcher, *wikiPagesFlag))
+	}
+	if *indexDBFlag != "" && *retrieveKFlag > 0 {
+		openIndex := OpenCodeIndex
+		if *readOnlyFlag {
+			openIndex = OpenCodeIndexReadOnly
+		}
+		index, err := openIndex(*indexDBFlag, NewOpenAIEmbedder(*embeddingModelFlag, clientOpts), *embeddingModelFlag)
+		if err != nil {
+			log.Fatalf("Couldn't open code index %s: %v", *indexDBFlag, err)
+		}
+		defer index.Close()
+		helpTool.WithIndex(index, *retrieveKFlag)
+	}
+	if token := os.Getenv("SENTRY_AUTH_TOKEN"); token != "" {
+		helpTool.WithSentry(NewSentryClient(*sentryURLFlag, token))
+	}
+	if *expertsFlag != "" {
+		router, err := LoadExperts(*expertsFlag)
+		if err != nil {
+			log.Fatalf("Couldn't load experts: %v", err)
+		}
+		defer router.Close()
+		if *expertClassifierFlag != "" {
+			router.WithClassifier(configureLLM(NewLLM(*expertClassifierFlag).WithClientOptions(clientOpts).WithBudget(budget)))
+		}
+		helpTool.WithExperts(router.WithRedactor(redactor).WithPIIScrubber(scrubber))
+		slog.Info("Forwarding questions to experts", "experts", router.Names())
+	}
+	sessions := NewSessionStore(*sessionTTLFlag)
+	drafts := NewDraftStore(*draftTTLFlag)
+	helpTool.WithResourceReader(server).WithSessions(sessions).WithDrafts(drafts)
 	server.RegisterTool(helpTool)
+	server.RegisterTool(NewSendDraftTool(helpTool, drafts))
+	server.RegisterTool(NewBrainstormTool(toolModelFlags.For("brainstorm_options", helpTool.LLM())))
+	server.RegisterTool(NewCompareApproachesTool(toolModelFlags.For("compare_approaches", helpTool.LLM())))
+	server.RegisterTool(NewSecondOpinionTool(helpTool, splitList(*ensembleFlag)))
+	server.RegisterTool(NewBatchHelpTool(helpTool))
+	server.RegisterTool(NewExplainFailureTool(helpTool))
+	server.RegisterTool(NewGenerateTestsTool(toolModelFlags.For("generate_tests", helpTool.LLM())).WithRepository(helpTool.repo))
+	server.RegisterTool(NewSecurityAuditTool(toolModelFlags.For("security_audit", helpTool.LLM())).WithRepository(helpTool.repo))
+	server.RegisterTool(NewResetSessionTool(sessions))
+	if *githubRepoFlag != "" {
+		issues, err := NewGitHubIssues(*githubRepoFlag, os.Getenv("GITHUB_TOKEN"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		issues.WithAPIURL(*githubAPIFlag).WithLabels(splitList(*githubLabelsFlag)).WithRedactor(redactor)
+		server.RegisterTool(NewFileIssueTool(helpTool, issues))
+		if *githubAutoFileFlag {
+			helpTool.WithAutoIssues(issues)
+		}
+	} else if *githubAutoFileFlag {
+		log.Fatal("-github-auto-file requires -github-repo")
+	}
+	if *humanSlackFlag != "" {
+		server.RegisterTool(NewHumanEscalationTool(helpTool, *humanSlackFlag).WithChannel(*humanChannelFlag).WithRedactor(redactor))
+	}
+	if *historyDBFlag != "" {
+		// Read-only, past escalations can still be listed and re-asked, but
+		// new ones aren't recorded.
+		openHistory := OpenHistory
+		if *readOnlyFlag {
+			openHistory = OpenHistoryReadOnly
+		}
+		history, err := openHistory(*historyDBFlag)
+		if err != nil {
+			slog.Warn("Couldn't open history, continuing without it", "path", *historyDBFlag, "error", err)
+		} else {
+			defer history.Close()
+			if !*readOnlyFlag {
+				helpTool.WithHistory(history)
+				server.WithHistory(history)
+				server.RegisterTool(NewReportOutcomeTool(history))
+			}
+			if *examplesFlag > 0 {
+				helpTool.WithExamples(history, *examplesFlag)
+			}
+			server.RegisterTool(NewListEscalationsTool(history))
+			server.RegisterTool(NewReaskEscalationTool(history, helpTool))
+			if *officeHoursFlag != "" && command == "serve" {
+				schedule, err := ParseOfficeHours(*officeHoursFlag)
+				if err != nil {
+					log.Fatal(err)
+				}
+				if *officeHoursSlackFlag == "" && *officeHoursEmailFlag == "" {
+					log.Fatal("-office-hours needs -office-hours-slack-webhook or -office-hours-email")
+				}
+				digest := NewOfficeHoursDigest(history, schedule).
+					WithLead(*officeHoursLeadFlag).
+					WithSlack(*officeHoursSlackFlag, *officeHoursChannelFlag).
+					WithRedactor(redactor)
+				if *officeHoursEmailFlag != "" {
+					if os.Getenv("SMTP_ADDR") == "" || os.Getenv("SMTP_FROM") == "" {
+						log.Fatal("-office-hours-email needs SMTP_ADDR and SMTP_FROM")
+					}
+					digest.WithEmail(splitList(*officeHoursEmailFlag), SMTPConfig{
+						Addr:     os.Getenv("SMTP_ADDR"),
+						From:     os.Getenv("SMTP_FROM"),
+						Username: os.Getenv("SMTP_USERNAME"),
+						Password: os.Getenv("SMTP_PASSWORD"),
+					})
+				}
+				go digest.Run(context.Background())
+			}
+		}
+	} else if *officeHoursFlag != "" {
+		log.Fatal("-office-hours requires -history-db")
+	}
+	// Pipelines run the tools registered above, so they come last.
+	if *pipelinesFlag != "" {
+		pipelines, err := LoadPipelines(*pipelinesFlag)
+		if err != nil {
+			log.Fatalf("Couldn't load pipelines: %v", err)
+		}
+		for _, pipeline := range pipelines {
+			tool, err := NewPipelineTool(pipeline, server)
+			if err != nil {
+				log.Fatal(err)
+			}
+			server.RegisterTool(tool)
+		}
+		slog.Info("Registered pipelines", "count", len(pipelines))
+	}
+	if err := applyExtensions(server, helpTool); err != nil {
+		log.Fatal(err)
+	}
 
-	// Setup logging
-	if !*sseFlag {
-		logFile, err := os.OpenFile("/tmp/escalator.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
-		if err == nil {
-			log.SetOutput(logFile)
+	if *ollamaWarmFlag || *ollamaPullFlag || *ollamaKeepAliveFlag > 0 {
+		if *baseURLFlag == "" {
+			log.Fatal("-ollama-warm, -ollama-pull and -ollama-keepalive require -base-url pointing at Ollama, e.g. http://localhost:11434/v1")
+		}
+		models := splitList(*ollamaModelsFlag)
+		if len(models) == 0 {
+			models = splitList(*modelFlag + "," + *cascadeFlag)
+		}
+		go NewOllamaRuntime(*baseURLFlag, models).
+			WithPull(*ollamaPullFlag).
+			WithKeepAlive(*ollamaKeepAliveFlag).
+			Run(context.Background())
+	}
+
+	if approval != nil && *approvalAddrFlag != "" {
+		go func() {
+			slog.Info("Serving the approval API", "addr", *approvalAddrFlag)
+			log.Fatal(listenAndServe(&http.Server{Addr: *approvalAddrFlag, Handler: approval.Handler()}, tlsConfig))
+		}()
+	}
+	if metrics != nil && *metricsAddrFlag != "" {
+		go func() {
+			slog.Info("Serving metrics", "addr", *metricsAddrFlag)
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", auth.Require(metrics.Handler().ServeHTTP))
+			log.Fatal(listenAndServe(&http.Server{Addr: *metricsAddrFlag, Handler: mux}, tlsConfig))
+		}()
+	}
+	if features != nil && *featuresAddrFlag != "" {
+		go func() {
+			slog.Info("Serving the feature flag API", "addr", *featuresAddrFlag)
+			log.Fatal(listenAndServe(&http.Server{Addr: *featuresAddrFlag, Handler: features.Handler()}, tlsConfig))
+		}()
+	}
+
+	if command == "ask" {
+		if code := runAsk(context.Background(), server, helpTool, flag.Args(), os.Stdin, os.Stdout, os.Stderr); code != 0 {
+			exitCode = code
 		}
+		tracer.Flush(5 * time.Second)
+		return
+	}
+
+	// The first SIGINT or SIGTERM shuts down gracefully; once it's
+	// stopped listening, a second one kills the server at once.
+	shutdown := make(chan os.Signal, 1)
+	signal.Notify(shutdown, syscall.SIGINT, syscall.SIGTERM)
+
+	// Reloading applies prompt and persona changes without tearing down
+	// the sessions of connected clients.
+	reloader := NewReloader(helpTool, flag.CommandLine, commandLine, configPath)
+	if *reloadIntervalFlag > 0 {
+		go reloader.Watch(context.Background(), *reloadIntervalFlag)
 	}
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	go func() {
+		for range hangup {
+			reloader.reloadAndLog()
+		}
+	}()
 
 	if *sseFlag {
 		// HTTP server mode
-		log.Println("Starting HTTP server mode...")
-		addr := fmt.Sprintf("127.0.0.1:%d", *portFlag)
+		slog.Info("Starting HTTP server mode")
+		// HTTP clients don't initialize a session, so warm up front.
+		server.warmTools()
 
-		http.HandleFunc("/get_help", server.HandleHTTP)
+		http.HandleFunc("/get_help", metrics.Instrument(auth.Require(limiter.Limit(server.HandleHTTP))))
+		if metrics != nil && *metricsAddrFlag == "" {
+			http.Handle("/metrics", auth.Require(metrics.Handler().ServeHTTP))
+		}
+		if auth != nil && auth.oauth != nil {
+			http.Handle(protectedResourcePath, auth.oauth.MetadataHandler())
+		}
+		if approval != nil && *approvalAddrFlag == "" {
+			handler := approval.Handler()
+			http.Handle("/approvals", handler)
+			http.Handle("/approvals/", handler)
+		}
+		if features != nil && *featuresAddrFlag == "" {
+			handler := features.Handler()
+			http.Handle("/features", handler)
+			http.Handle("/features/", handler)
+		}
 
 		httpServer := &http.Server{
 			Addr:         addr,
@@ -263,10 +1527,39 @@ func main() {
 			WriteTimeout: 4 * time.Minute,
 		}
 
-		log.Printf("Starting MCP Escalator server on %s (summary: %s, model: %s)\n", addr, *summaryFlag, *modelFlag)
-		log.Fatal(httpServer.ListenAndServe())
+		slog.Info("Starting MCP Escalator server", "addr", addr, "tls", tlsConfig != nil, "summary", *summaryFlag, "model", *modelFlag)
+		go func() {
+			if err := listenAndServe(httpServer, tlsConfig); err != http.ErrServerClosed {
+				log.Fatal(err)
+			}
+		}()
+		sig := <-shutdown
+		signal.Stop(shutdown)
+		slog.Info("Shutting down, draining requests in flight", "signal", sig.String(), "timeout", *drainTimeoutFlag)
+		ctx, cancel := context.WithTimeout(context.Background(), *drainTimeoutFlag)
+		if err := httpServer.Shutdown(ctx); err != nil {
+			slog.Warn("Requests were still in flight at the drain timeout", "error", err)
+		}
+		cancel()
 	} else {
 		// stdio mode (default) - MCP protocol
-		server.RunStdio()
+		done := make(chan struct{})
+		go func() {
+			server.RunStdio()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case sig := <-shutdown:
+			signal.Stop(shutdown)
+			slog.Info("Shutting down, draining requests in flight", "signal", sig.String(), "timeout", *drainTimeoutFlag)
+			if active := server.Drain(*drainTimeoutFlag); active > 0 {
+				slog.Warn("Requests were still in flight at the drain timeout", "active", active)
+			}
+		}
 	}
-}
\ No newline at end of file
+	// Returning runs the deferred closes, which flush the history, audit
+	// log and counters.
+	tracer.Flush(5 * time.Second)
+	slog.Info("Server stopped")
+}
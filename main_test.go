@@ -8,61 +8,81 @@ import (
 	"os"
 	"strings"
 	"testing"
+
+	"github.com/dratner/code-escalator/pkg/mcp"
 )
 
+// initialize answers an initialize request with params.
+func initialize(t *testing.T, server *MCPServer, params string) *mcp.InitializeResult {
+	t.Helper()
+	resp := server.ProcessRequest(JsonRPCRequest{Jsonrpc: "2.0", ID: 1, Method: "initialize", Params: json.RawMessage(params)})
+	result, ok := resp.Result.(*mcp.InitializeResult)
+	if !ok {
+		t.Fatalf("Expected an initialize result, got %+v", resp)
+	}
+	return result
+}
+
 func TestMCPServer_HandleInitialize(t *testing.T) {
 	server := NewMCPServer("test-server", "1.0.0")
-	result := server.HandleInitialize()
+	result := initialize(t, server, `{}`)
 
-	if result["protocolVersion"] != "2025-03-26" {
-		t.Errorf("Expected protocolVersion '2025-03-26', got %v", result["protocolVersion"])
+	if result.ProtocolVersion != "2025-03-26" {
+		t.Errorf("Expected protocolVersion '2025-03-26', got %v", result.ProtocolVersion)
 	}
 
-	serverInfo := result["serverInfo"].(map[string]string)
-	if serverInfo["name"] != "test-server" {
-		t.Errorf("Expected server name 'test-server', got %v", serverInfo["name"])
+	if result.ServerInfo.Name != "test-server" {
+		t.Errorf("Expected server name 'test-server', got %v", result.ServerInfo.Name)
 	}
-	if serverInfo["version"] != "1.0.0" {
-		t.Errorf("Expected server version '1.0.0', got %v", serverInfo["version"])
+	if result.ServerInfo.Version != "1.0.0" {
+		t.Errorf("Expected server version '1.0.0', got %v", result.ServerInfo.Version)
 	}
 }
 
 func TestMCPServer_RegisterTool(t *testing.T) {
 	server := NewMCPServer("test", "1.0.0")
 	tool := NewGetHelpTool("", "gpt-4o")
-	
+
 	server.RegisterTool(tool)
-	
-	if len(server.tools) != 1 {
-		t.Errorf("Expected 1 tool registered, got %d", len(server.tools))
+
+	if tools := server.server.Tools(); len(tools) != 1 {
+		t.Errorf("Expected 1 tool registered, got %d", len(tools))
 	}
-	
-	if server.tools["get_help"] == nil {
+
+	if _, ok := server.server.Tool("get_help"); !ok {
 		t.Error("Expected get_help tool to be registered")
 	}
 }
 
+func TestMCPServer_ProcessRequest_Ping(t *testing.T) {
+	server := NewMCPServer("test", "1.0.0")
+	resp := server.ProcessRequest(JsonRPCRequest{Jsonrpc: "2.0", ID: 1, Method: "ping"})
+	if resp.Error != nil || resp.Result == nil {
+		t.Errorf("Expected ping answered, got %+v", resp)
+	}
+}
+
 func TestMCPServer_HandleToolsList(t *testing.T) {
 	server := NewMCPServer("test", "1.0.0")
 	tool := NewGetHelpTool("", "gpt-4o")
 	server.RegisterTool(tool)
-	
+
 	result := server.HandleToolsList()
-	tools := result["tools"].([]map[string]interface{})
-	
+	tools := result.Tools
+
 	if len(tools) != 1 {
 		t.Errorf("Expected 1 tool in list, got %d", len(tools))
 	}
-	
-	if tools[0]["name"] != "get_help" {
-		t.Errorf("Expected tool name 'get_help', got %v", tools[0]["name"])
+
+	if tools[0].Name != "get_help" {
+		t.Errorf("Expected tool name 'get_help', got %v", tools[0].Name)
 	}
-	
-	if tools[0]["description"] == "" {
+
+	if tools[0].Description == "" {
 		t.Error("Expected non-empty description")
 	}
-	
-	schema := tools[0]["inputSchema"].(map[string]interface{})
+
+	schema := tools[0].InputSchema
 	if schema["type"] != "object" {
 		t.Errorf("Expected schema type 'object', got %v", schema["type"])
 	}
@@ -78,11 +98,11 @@ func TestGetHelpTool_Name(t *testing.T) {
 func TestGetHelpTool_Schema(t *testing.T) {
 	tool := NewGetHelpTool("", "gpt-4o")
 	schema := tool.Schema()
-	
+
 	if schema["type"] != "object" {
 		t.Errorf("Expected type 'object', got %v", schema["type"])
 	}
-	
+
 	props := schema["properties"].(map[string]interface{})
 	if props["question"] == nil {
 		t.Error("Expected 'question' property in schema")
@@ -90,7 +110,7 @@ func TestGetHelpTool_Schema(t *testing.T) {
 	if props["summary"] == nil {
 		t.Error("Expected 'summary' property in schema")
 	}
-	
+
 	required := schema["required"].([]string)
 	if len(required) != 2 {
 		t.Errorf("Expected 2 required fields, got %d", len(required))
@@ -99,25 +119,25 @@ func TestGetHelpTool_Schema(t *testing.T) {
 
 func TestGetHelpTool_Call_MissingFields(t *testing.T) {
 	tool := NewGetHelpTool("", "gpt-4o")
-	
+
 	// Test missing question
 	content, err := tool.Call(map[string]interface{}{
 		"summary": "test summary",
 	})
-	
+
 	if err == nil {
 		t.Error("Expected error for missing question")
 	}
-	
+
 	if len(content) == 0 || content[0]["type"] != "text" {
 		t.Error("Expected error message in content")
 	}
-	
+
 	// Test missing summary
 	content, err = tool.Call(map[string]interface{}{
 		"question": "test question",
 	})
-	
+
 	if err == nil {
 		t.Error("Expected error for missing summary")
 	}
@@ -126,11 +146,11 @@ func TestGetHelpTool_Call_MissingFields(t *testing.T) {
 func TestGetHelpTool_LoadSummary_Default(t *testing.T) {
 	tool := NewGetHelpTool("", "gpt-4o")
 	content, err := tool.loadSummary()
-	
+
 	if err != nil {
 		t.Errorf("Expected no error loading default summary, got: %v", err)
 	}
-	
+
 	if !strings.Contains(content, "MCP Escalator") {
 		t.Error("Expected content to contain 'MCP Escalator'")
 	}
@@ -143,20 +163,20 @@ func TestGetHelpTool_LoadSummary_Custom(t *testing.T) {
 		t.Fatal(err)
 	}
 	defer os.Remove(tmpFile.Name())
-	
+
 	testContent := "# Custom Summary\nThis is a test summary."
 	if _, err := tmpFile.WriteString(testContent); err != nil {
 		t.Fatal(err)
 	}
 	tmpFile.Close()
-	
+
 	tool := NewGetHelpTool(tmpFile.Name(), "gpt-4o")
 	content, err := tool.loadSummary()
-	
+
 	if err != nil {
 		t.Errorf("Expected no error, got: %v", err)
 	}
-	
+
 	if content != testContent {
 		t.Errorf("Expected %q, got %q", testContent, content)
 	}
@@ -165,7 +185,7 @@ func TestGetHelpTool_LoadSummary_Custom(t *testing.T) {
 func TestGetHelpTool_LoadSummary_Missing(t *testing.T) {
 	tool := NewGetHelpTool("nonexistent.md", "gpt-4o")
 	_, err := tool.loadSummary()
-	
+
 	if err == nil {
 		t.Error("Expected error for missing file")
 	}
@@ -173,18 +193,18 @@ func TestGetHelpTool_LoadSummary_Missing(t *testing.T) {
 
 func TestGetHelpTool_BuildPrompt(t *testing.T) {
 	tool := NewGetHelpTool("", "gpt-4o")
-	
+
 	summary := "# Test Project\nThis is a test."
 	question := "How do I test this?"
 	relevantCode := "func test() {}"
-	
+
 	prompt, err := tool.buildPrompt(summary, question, relevantCode)
 	if err != nil {
 		t.Errorf("Expected no error, got: %v", err)
 	}
-	
-	if !strings.Contains(prompt, "software architect") {
-		t.Error("Expected prompt to contain 'software architect'")
+
+	if !strings.Contains(prompt, "Help with this issue") {
+		t.Error("Expected prompt to ask for help with the issue")
 	}
 	if !strings.Contains(prompt, summary) {
 		t.Error("Expected prompt to contain summary")
@@ -199,15 +219,15 @@ func TestGetHelpTool_BuildPrompt(t *testing.T) {
 
 func TestGetHelpTool_BuildPrompt_TokenLimit(t *testing.T) {
 	tool := NewGetHelpTool("", "gpt-4o")
-	
+
 	// Create very long summary
 	longSummary := strings.Repeat("a", 85000)
-	
+
 	_, err := tool.buildPrompt(longSummary, "test", "test")
 	if err == nil {
 		t.Error("Expected error for prompt exceeding token limit")
 	}
-	
+
 	if !strings.Contains(err.Error(), "20,000 token limit") {
 		t.Errorf("Expected token limit error, got: %v", err)
 	}
@@ -217,15 +237,15 @@ func TestGetHelpTool_AskOpenAI_InvalidKey(t *testing.T) {
 	// Save original key
 	originalKey := os.Getenv("OPENAI_API_KEY")
 	defer os.Setenv("OPENAI_API_KEY", originalKey)
-	
+
 	// Set invalid key
 	os.Setenv("OPENAI_API_KEY", "invalid-key")
-	
+
 	tool := NewGetHelpTool("", "gpt-4o")
 	ctx := context.Background()
-	
+
 	_, err := tool.askOpenAI(ctx, "test prompt")
-	
+
 	if err == nil {
 		t.Error("Expected error with invalid API key")
 	}
@@ -235,12 +255,12 @@ func TestMCPServer_HTTPHandler_BadJSON(t *testing.T) {
 	server := NewMCPServer("test", "1.0.0")
 	tool := NewGetHelpTool("", "gpt-4o")
 	server.RegisterTool(tool)
-	
+
 	req := httptest.NewRequest(http.MethodPost, "/get_help", strings.NewReader("invalid json"))
 	w := httptest.NewRecorder()
-	
+
 	server.HandleHTTP(w, req)
-	
+
 	if w.Code != http.StatusBadRequest {
 		t.Errorf("Expected status 400, got %d", w.Code)
 	}
@@ -250,17 +270,17 @@ func TestMCPServer_HTTPHandler_ValidRequest(t *testing.T) {
 	server := NewMCPServer("test", "1.0.0")
 	tool := NewGetHelpTool("", "gpt-4o")
 	server.RegisterTool(tool)
-	
+
 	reqBody := `{
 		"question": "How do I test this?",
 		"summary": "Test project"
 	}`
-	
+
 	req := httptest.NewRequest(http.MethodPost, "/get_help", strings.NewReader(reqBody))
 	w := httptest.NewRecorder()
-	
+
 	server.HandleHTTP(w, req)
-	
+
 	// Should either succeed or fail gracefully
 	if w.Code != http.StatusOK && w.Code != http.StatusServiceUnavailable {
 		t.Errorf("Expected status 200 or 503, got %d", w.Code)
@@ -269,16 +289,16 @@ func TestMCPServer_HTTPHandler_ValidRequest(t *testing.T) {
 
 func TestMCPServer_ProcessRequest_Initialize(t *testing.T) {
 	server := NewMCPServer("test", "1.0.0")
-	
+
 	req := JsonRPCRequest{
 		Jsonrpc: "2.0",
 		ID:      1,
 		Method:  "initialize",
 		Params:  json.RawMessage(`{}`),
 	}
-	
+
 	resp := server.ProcessRequest(req)
-	
+
 	if resp.Jsonrpc != "2.0" {
 		t.Errorf("Expected jsonrpc '2.0', got %s", resp.Jsonrpc)
 	}
@@ -288,10 +308,10 @@ func TestMCPServer_ProcessRequest_Initialize(t *testing.T) {
 	if resp.Error != nil {
 		t.Errorf("Expected no error, got %v", resp.Error)
 	}
-	
-	result := resp.Result.(map[string]interface{})
-	if result["protocolVersion"] != "2025-03-26" {
-		t.Errorf("Expected protocolVersion '2025-03-26', got %v", result["protocolVersion"])
+
+	result := resp.Result.(*mcp.InitializeResult)
+	if result.ProtocolVersion != "2025-03-26" {
+		t.Errorf("Expected protocolVersion '2025-03-26', got %v", result.ProtocolVersion)
 	}
 }
 
@@ -299,28 +319,135 @@ func TestMCPServer_ProcessRequest_ToolsList(t *testing.T) {
 	server := NewMCPServer("test", "1.0.0")
 	tool := NewGetHelpTool("", "gpt-4o")
 	server.RegisterTool(tool)
-	
+
 	req := JsonRPCRequest{
 		Jsonrpc: "2.0",
 		ID:      2,
 		Method:  "tools/list",
 		Params:  json.RawMessage(`{}`),
 	}
-	
+
 	resp := server.ProcessRequest(req)
-	
+
 	if resp.Error != nil {
 		t.Errorf("Expected no error, got %v", resp.Error)
 	}
-	
-	result := resp.Result.(map[string]interface{})
-	tools := result["tools"].([]map[string]interface{})
-	
+
+	tools := resp.Result.(*mcp.ListToolsResult).Tools
+
 	if len(tools) != 1 {
 		t.Errorf("Expected 1 tool, got %d", len(tools))
 	}
-	
-	if tools[0]["name"] != "get_help" {
-		t.Errorf("Expected tool name 'get_help', got %v", tools[0]["name"])
+
+	if tools[0].Name != "get_help" {
+		t.Errorf("Expected tool name 'get_help', got %v", tools[0].Name)
 	}
-}
\ No newline at end of file
+}
+
+func TestGetHelpTool_AskOpenAI_FallbackChain(t *testing.T) {
+	withFastRetries(t)
+
+	var calls []string
+	srv := newFakeOpenAI(t, func(model string) string {
+		calls = append(calls, model)
+		if model == "backup" {
+			return "answer from backup"
+		}
+		return ""
+	})
+
+	tool := NewGetHelpTool("", "primary").
+		WithClientOptions(ClientOptions{BaseURL: srv.URL}).
+		WithFallbackModels([]string{"backup", "never-used"})
+
+	answer, err := tool.askOpenAI(context.Background(), "prompt")
+	if err != nil {
+		t.Fatalf("Expected fallback to succeed, got: %v", err)
+	}
+	if answer != "answer from backup" {
+		t.Errorf("Expected answer from backup, got %q", answer)
+	}
+
+	primaryCalls := 0
+	for _, model := range calls {
+		if model == "never-used" {
+			t.Error("Expected chain to stop at the first successful model")
+		}
+		if model == "primary" {
+			primaryCalls++
+		}
+	}
+	if primaryCalls != defaultRetryPolicy.Attempts {
+		t.Errorf("Expected primary to be retried %d times, got %d", defaultRetryPolicy.Attempts, primaryCalls)
+	}
+}
+
+func TestGetHelpTool_Call_ModelOverride(t *testing.T) {
+	var used []string
+	srv := newFakeOpenAI(t, func(model string) string {
+		used = append(used, model)
+		return "answer from " + model
+	})
+
+	tool := NewGetHelpTool("", "o3").
+		WithClientOptions(ClientOptions{BaseURL: srv.URL}).
+		WithAllowedModels([]string{"o3", "gpt-4o-mini"})
+
+	content, err := tool.Call(map[string]interface{}{
+		"question": "q",
+		"summary":  "s",
+		"model":    "gpt-4o-mini",
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if content[0]["text"] != "answer from gpt-4o-mini" {
+		t.Errorf("Expected answer from overridden model, got %v", content[0]["text"])
+	}
+
+	_, err = tool.Call(map[string]interface{}{
+		"question": "q",
+		"summary":  "s",
+		"model":    "gpt-4.5-preview",
+	})
+	if err == nil {
+		t.Error("Expected error for model outside the allowlist")
+	}
+	if len(used) != 1 {
+		t.Errorf("Expected disallowed model not to be called, got calls %v", used)
+	}
+}
+
+func TestGetHelpTool_Schema_ModelEnum(t *testing.T) {
+	props := NewGetHelpTool("", "o3").Schema()["properties"].(map[string]interface{})
+	if props["model"] != nil {
+		t.Error("Expected no model property without an allowlist")
+	}
+
+	props = NewGetHelpTool("", "o3").WithAllowedModels([]string{"o3", "gpt-4o"}).Schema()["properties"].(map[string]interface{})
+	model, ok := props["model"].(map[string]interface{})
+	if !ok {
+		t.Fatal("Expected model property with an allowlist")
+	}
+	if enum := model["enum"].([]string); len(enum) != 2 {
+		t.Errorf("Expected 2 allowed models in enum, got %v", enum)
+	}
+}
+
+func TestGetHelpTool_PreparePrompt_MissingSummaryFile(t *testing.T) {
+	tool := NewGetHelpTool("/nonexistent/summary.md", "o3")
+	args := map[string]interface{}{"question": "q", "summary": "Caller summary"}
+
+	prepared, _, err := tool.preparePrompt(context.Background(), args)
+	if err != nil {
+		t.Fatalf("Expected fallback to the caller's summary, got: %v", err)
+	}
+	if prompt := prepared.Text; !strings.Contains(prompt, "<summary>\nCaller summary\n</summary>") {
+		t.Errorf("Expected prompt to use the caller's summary, got %q", prompt)
+	}
+
+	tool.WithRequiredSummary(true)
+	if _, _, err := tool.preparePrompt(context.Background(), args); err == nil {
+		t.Error("Expected error when the summary file is required")
+	}
+}
@@ -0,0 +1,408 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/dratner/code-escalator/pkg/mcp"
+)
+
+// mcpTransport carries JSON-RPC messages to an MCP server.
+type mcpTransport interface {
+	call(ctx context.Context, method string, params interface{}) (json.RawMessage, error)
+	notify(ctx context.Context, method string, params interface{}) error
+	close() error
+}
+
+// rpcMessage is any JSON-RPC message an MCP server sends: a response to
+// one of ours, or a request or notification of its own.
+type rpcMessage struct {
+	ID     *json.RawMessage `json:"id,omitempty"`
+	Method string           `json:"method,omitempty"`
+	Result json.RawMessage  `json:"result,omitempty"`
+	Error  *mcp.RPCError    `json:"error,omitempty"`
+}
+
+func (m *rpcMessage) err() error {
+	if m.Error == nil {
+		return nil
+	}
+	return m.Error
+}
+
+// MCPClient calls the tools of another MCP server. It connects on first
+// use, and again after the connection fails.
+type MCPClient struct {
+	connect func() (mcpTransport, error)
+
+	mu        sync.Mutex
+	transport mcpTransport
+	tools     map[string]map[string]interface{}
+}
+
+// NewStdioMCPClient runs the server as a subprocess and talks to it over
+// its stdin and stdout. env is added to the escalator's environment.
+func NewStdioMCPClient(command []string, env map[string]string) *MCPClient {
+	return &MCPClient{connect: func() (mcpTransport, error) {
+		return startStdioTransport(command, env)
+	}}
+}
+
+// NewHTTPMCPClient talks to a server over MCP's streamable HTTP transport.
+func NewHTTPMCPClient(url string, headers map[string]string) *MCPClient {
+	return &MCPClient{connect: func() (mcpTransport, error) {
+		return &httpTransport{url: url, headers: headers, client: &http.Client{}}, nil
+	}}
+}
+
+// session returns the connection, connecting and initializing it first if
+// needed. The caller holds c.mu.
+func (c *MCPClient) session(ctx context.Context) (mcpTransport, error) {
+	if c.transport != nil {
+		return c.transport, nil
+	}
+	transport, err := c.connect()
+	if err != nil {
+		return nil, err
+	}
+	_, err = transport.call(ctx, "initialize", map[string]interface{}{
+		"protocolVersion": supportedProtocolVersions[len(supportedProtocolVersions)-1],
+		"capabilities":    map[string]interface{}{},
+		"clientInfo":      map[string]string{"name": "escalator", "version": "1.0.0"},
+	})
+	if err == nil {
+		err = transport.notify(ctx, "notifications/initialized", nil)
+	}
+	if err != nil {
+		transport.close()
+		return nil, fmt.Errorf("couldn't initialize: %w", err)
+	}
+	c.transport = transport
+	return transport, nil
+}
+
+// Tools lists the server's tools with their input schemas, by name.
+func (c *MCPClient) Tools(ctx context.Context) (map[string]map[string]interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.tools != nil {
+		return c.tools, nil
+	}
+	transport, err := c.session(ctx)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := transport.call(ctx, "tools/list", map[string]interface{}{})
+	if err != nil {
+		c.reset()
+		return nil, err
+	}
+	var listed mcp.ListToolsResult
+	if err := json.Unmarshal(raw, &listed); err != nil {
+		return nil, fmt.Errorf("couldn't parse tools/list: %w", err)
+	}
+	c.tools = make(map[string]map[string]interface{})
+	for _, tool := range listed.Tools {
+		c.tools[tool.Name] = tool.InputSchema
+	}
+	return c.tools, nil
+}
+
+// CallTool calls a tool and returns its content. A result flagged isError
+// is returned as an error carrying its text.
+func (c *MCPClient) CallTool(ctx context.Context, name string, arguments map[string]interface{}) ([]map[string]interface{}, error) {
+	c.mu.Lock()
+	transport, err := c.session(ctx)
+	c.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	raw, err := transport.call(ctx, "tools/call", map[string]interface{}{"name": name, "arguments": arguments})
+	if err != nil {
+		if ctx.Err() == nil {
+			c.mu.Lock()
+			c.reset()
+			c.mu.Unlock()
+		}
+		return nil, err
+	}
+	var result mcp.CallToolResult
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, fmt.Errorf("couldn't parse the %s result: %w", name, err)
+	}
+	if result.IsError {
+		return nil, fmt.Errorf("%s failed: %s", name, contentText(result.Content))
+	}
+	return result.Content, nil
+}
+
+// reset drops a failed connection so the next call reconnects. The caller
+// holds c.mu.
+func (c *MCPClient) reset() {
+	if c.transport != nil {
+		c.transport.close()
+	}
+	c.transport, c.tools = nil, nil
+}
+
+// Close shuts the connection down, stopping a stdio server.
+func (c *MCPClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.transport == nil {
+		return nil
+	}
+	err := c.transport.close()
+	c.transport = nil
+	return err
+}
+
+// stdioTransport exchanges newline-delimited JSON-RPC messages with a
+// subprocess.
+type stdioTransport struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+
+	mu      sync.Mutex
+	nextID  int
+	pending map[int]chan *rpcMessage
+	done    chan struct{}
+}
+
+func startStdioTransport(command []string, env map[string]string) (*stdioTransport, error) {
+	if len(command) == 0 {
+		return nil, errors.New("empty server command")
+	}
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Env = os.Environ()
+	for name, value := range env {
+		cmd.Env = append(cmd.Env, name+"="+value)
+	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	t := &stdioTransport{cmd: cmd, stdin: stdin, pending: make(map[int]chan *rpcMessage), done: make(chan struct{})}
+	go t.read(stdout)
+	return t, nil
+}
+
+// read dispatches the server's responses to their callers. Requests from
+// the server are refused, since the escalator offers no client features.
+func (t *stdioTransport) read(stdout io.Reader) {
+	defer close(t.done)
+	lines := bufio.NewScanner(stdout)
+	lines.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for lines.Scan() {
+		var msg rpcMessage
+		if err := json.Unmarshal(lines.Bytes(), &msg); err != nil || msg.ID == nil {
+			continue
+		}
+		if msg.Method != "" {
+			t.write(map[string]interface{}{
+				"jsonrpc": "2.0",
+				"id":      msg.ID,
+				"error":   mcp.NewError(mcp.CodeMethodNotFound, "Method not found"),
+			})
+			continue
+		}
+		var id int
+		if json.Unmarshal(*msg.ID, &id) != nil {
+			continue
+		}
+		t.mu.Lock()
+		reply, ok := t.pending[id]
+		delete(t.pending, id)
+		t.mu.Unlock()
+		if ok {
+			reply <- &msg
+		}
+	}
+}
+
+func (t *stdioTransport) write(msg interface{}) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, err = t.stdin.Write(append(data, '\n'))
+	return err
+}
+
+func (t *stdioTransport) call(ctx context.Context, method string, params interface{}) (json.RawMessage, error) {
+	reply := make(chan *rpcMessage, 1)
+	t.mu.Lock()
+	t.nextID++
+	id := t.nextID
+	t.pending[id] = reply
+	t.mu.Unlock()
+	defer func() {
+		t.mu.Lock()
+		delete(t.pending, id)
+		t.mu.Unlock()
+	}()
+
+	if err := t.write(map[string]interface{}{"jsonrpc": "2.0", "id": id, "method": method, "params": params}); err != nil {
+		return nil, err
+	}
+	select {
+	case msg := <-reply:
+		return msg.Result, msg.err()
+	case <-t.done:
+		return nil, errors.New("server exited")
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (t *stdioTransport) notify(ctx context.Context, method string, params interface{}) error {
+	msg := map[string]interface{}{"jsonrpc": "2.0", "method": method}
+	if params != nil {
+		msg["params"] = params
+	}
+	return t.write(msg)
+}
+
+func (t *stdioTransport) close() error {
+	t.stdin.Close()
+	if err := t.cmd.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		slog.Warn("Couldn't stop MCP server", "command", t.cmd.Path, "error", err)
+	}
+	return t.cmd.Wait()
+}
+
+// httpTransport posts each JSON-RPC message to the server's endpoint. The
+// reply is either JSON or an event stream whose message answering ours is
+// used.
+type httpTransport struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+
+	mu        sync.Mutex
+	nextID    int
+	sessionID string
+}
+
+func (t *httpTransport) post(ctx context.Context, msg map[string]interface{}) (*http.Response, error) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	for name, value := range t.headers {
+		req.Header.Set(name, value)
+	}
+	t.mu.Lock()
+	if t.sessionID != "" {
+		req.Header.Set("Mcp-Session-Id", t.sessionID)
+	}
+	t.mu.Unlock()
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if session := resp.Header.Get("Mcp-Session-Id"); session != "" {
+		t.mu.Lock()
+		t.sessionID = session
+		t.mu.Unlock()
+	}
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return resp, nil
+}
+
+func (t *httpTransport) call(ctx context.Context, method string, params interface{}) (json.RawMessage, error) {
+	t.mu.Lock()
+	t.nextID++
+	id := t.nextID
+	t.mu.Unlock()
+	resp, err := t.post(ctx, map[string]interface{}{"jsonrpc": "2.0", "id": id, "method": method, "params": params})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	answers := func(msg *rpcMessage) bool {
+		var got int
+		return msg.ID != nil && msg.Method == "" && json.Unmarshal(*msg.ID, &got) == nil && got == id
+	}
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		var msg rpcMessage
+		if err := json.NewDecoder(resp.Body).Decode(&msg); err != nil {
+			return nil, err
+		}
+		if !answers(&msg) {
+			return nil, errors.New("response doesn't answer the request")
+		}
+		return msg.Result, msg.err()
+	}
+
+	lines := bufio.NewScanner(resp.Body)
+	lines.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var data strings.Builder
+	for lines.Scan() {
+		line := lines.Text()
+		if payload, ok := strings.CutPrefix(line, "data:"); ok {
+			data.WriteString(strings.TrimPrefix(payload, " "))
+			continue
+		}
+		if line != "" || data.Len() == 0 {
+			continue
+		}
+		var msg rpcMessage
+		if json.Unmarshal([]byte(data.String()), &msg) == nil && answers(&msg) {
+			return msg.Result, msg.err()
+		}
+		data.Reset()
+	}
+	if err := lines.Err(); err != nil {
+		return nil, err
+	}
+	return nil, errors.New("event stream ended without a response")
+}
+
+func (t *httpTransport) notify(ctx context.Context, method string, params interface{}) error {
+	msg := map[string]interface{}{"jsonrpc": "2.0", "method": method}
+	if params != nil {
+		msg["params"] = params
+	}
+	resp, err := t.post(ctx, msg)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (t *httpTransport) close() error {
+	return nil
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// duplicateAnswerThreshold is the shingle similarity above which two answers
+// are treated as saying the same thing.
+const duplicateAnswerThreshold = 0.8
+
+// answerGroup is an answer together with the other models that gave a
+// near-identical one.
+type answerGroup struct {
+	modelAnswer
+	Also []string
+}
+
+// groupDuplicateAnswers collapses near-identical successful answers into the
+// first model's answer, preserving order. Failed answers are kept as-is.
+func groupDuplicateAnswers(answers []modelAnswer) []answerGroup {
+	var groups []answerGroup
+	for _, a := range answers {
+		merged := false
+		if a.Err == nil {
+			for i := range groups {
+				if groups[i].Err == nil && answerSimilarity(groups[i].Answer, a.Answer) >= duplicateAnswerThreshold {
+					groups[i].Also = append(groups[i].Also, a.Model)
+					merged = true
+					break
+				}
+			}
+		}
+		if !merged {
+			groups = append(groups, answerGroup{modelAnswer: a})
+		}
+	}
+	return groups
+}
+
+// answerSimilarity is the Jaccard similarity of the answers' word trigrams,
+// ignoring case and punctuation.
+func answerSimilarity(a, b string) float64 {
+	sa, sb := shingles(a), shingles(b)
+	if len(sa) == 0 || len(sb) == 0 {
+		if len(sa) == len(sb) {
+			return 1
+		}
+		return 0
+	}
+
+	shared := 0
+	for s := range sa {
+		if sb[s] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(sa)+len(sb)-shared)
+}
+
+func shingles(text string) map[string]bool {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !('a' <= r && r <= 'z' || '0' <= r && r <= '9')
+	})
+	set := make(map[string]bool)
+	if len(words) < 3 {
+		if len(words) > 0 {
+			set[strings.Join(words, " ")] = true
+		}
+		return set
+	}
+	for i := 0; i+3 <= len(words); i++ {
+		set[strings.Join(words[i:i+3], " ")] = true
+	}
+	return set
+}
+
+// MergedAnswer is the structured result of merging several models' answers:
+// advice they share once, genuine disagreements side by side, and points
+// only one model raised.
+type MergedAnswer struct {
+	Agreed        []string       `json:"agreed"`
+	Disagreements []Disagreement `json:"disagreements"`
+	Unique        []UniquePoint  `json:"unique"`
+}
+
+type Disagreement struct {
+	Topic     string     `json:"topic"`
+	Positions []Position `json:"positions"`
+}
+
+type Position struct {
+	Models   []string `json:"models"`
+	Position string   `json:"position"`
+}
+
+type UniquePoint struct {
+	Model string `json:"model"`
+	Point string `json:"point"`
+}
+
+// mergeAnswers asks the architect model to deduplicate the answers' advice
+// and separate agreement from disagreement. The completion is returned
+// whenever the model answered, even if its answer couldn't be parsed.
+func mergeAnswers(ctx context.Context, llm *LLM, question string, groups []answerGroup) (*MergedAnswer, *Completion, error) {
+	completion, err := llm.Generate(ctx, openai.ChatCompletionRequest{
+		Messages: []openai.ChatCompletionMessage{
+			{
+				Role:    openai.ChatMessageRoleUser,
+				Content: buildMergePrompt(question, groups),
+			},
+		},
+		ResponseFormat: &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject},
+	}, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	merged, err := parseMergedAnswer(completion.Answer)
+	return merged, completion, err
+}
+
+func buildMergePrompt(question string, groups []answerGroup) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "Several expert models independently answered the same software architecture question.\n\n**Question:** %s\n", question)
+	for _, g := range groups {
+		models := append([]string{g.Model}, g.Also...)
+		fmt.Fprintf(&b, "\n<answer models=\"%s\">\n%s\n</answer>\n", strings.Join(models, ","), g.Answer)
+	}
+	b.WriteString(`
+Merge these answers without repeating yourself. State each piece of advice the answers share exactly once, even if they word it differently. Only report a disagreement when the answers recommend genuinely different things, not when they merely emphasize different details.
+
+Respond with a JSON object of this exact shape:
+{
+  "agreed": ["advice shared by the answers"],
+  "disagreements": [
+    {"topic": "...", "positions": [{"models": ["..."], "position": "..."}]}
+  ],
+  "unique": [{"model": "...", "point": "advice only this model gave"}]
+}`)
+
+	return b.String()
+}
+
+func parseMergedAnswer(answer string) (*MergedAnswer, error) {
+	var merged MergedAnswer
+	if err := json.Unmarshal([]byte(answer), &merged); err != nil {
+		return nil, err
+	}
+	if len(merged.Agreed) == 0 && len(merged.Disagreements) == 0 && len(merged.Unique) == 0 {
+		return nil, fmt.Errorf("empty merged answer")
+	}
+	return &merged, nil
+}
+
+func formatMergedAnswer(merged *MergedAnswer) string {
+	var sections []string
+
+	if len(merged.Agreed) > 0 {
+		var b strings.Builder
+		b.WriteString("## Agreed\n")
+		for _, point := range merged.Agreed {
+			fmt.Fprintf(&b, "\n- %s", point)
+		}
+		sections = append(sections, b.String())
+	}
+
+	if len(merged.Disagreements) > 0 {
+		var b strings.Builder
+		b.WriteString("## Disagreements")
+		for _, d := range merged.Disagreements {
+			fmt.Fprintf(&b, "\n\n**%s**\n", d.Topic)
+			for _, p := range d.Positions {
+				fmt.Fprintf(&b, "\n- %s: %s", strings.Join(p.Models, ", "), p.Position)
+			}
+		}
+		sections = append(sections, b.String())
+	}
+
+	if len(merged.Unique) > 0 {
+		var b strings.Builder
+		b.WriteString("## Raised by one model\n")
+		for _, u := range merged.Unique {
+			fmt.Fprintf(&b, "\n- %s: %s", u.Model, u.Point)
+		}
+		sections = append(sections, b.String())
+	}
+
+	return strings.Join(sections, "\n\n")
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// Histogram buckets, in seconds. Escalations take seconds to minutes.
+var latencyBuckets = []float64{0.25, 0.5, 1, 2.5, 5, 10, 20, 30, 60, 120, 300}
+
+// metricFamily is one Prometheus metric with its labelled series.
+type metricFamily struct {
+	name, help, kind string
+	labels           []string
+	series           map[string]*metricSeries
+}
+
+type metricSeries struct {
+	labelValues []string
+	value       float64
+	// Histograms count observations per bucket, not cumulatively; the
+	// cumulative counts are summed when written.
+	buckets []uint64
+	count   uint64
+}
+
+// Metrics counts requests, tool calls, model calls and errors, and serves
+// them at /metrics in the Prometheus text format so operators can alert
+// when escalations start failing. A nil *Metrics records nothing.
+type Metrics struct {
+	mu       sync.Mutex
+	families map[string]*metricFamily
+}
+
+func NewMetrics() *Metrics {
+	m := &Metrics{families: make(map[string]*metricFamily)}
+	m.define("escalator_requests_total", "counter", "JSON-RPC requests by method, and legacy HTTP requests as method http.", "method")
+	m.define("escalator_tool_calls_total", "counter", "Tool calls by tool and outcome (ok or error).", "tool", "outcome")
+	m.define("escalator_tool_call_duration_seconds", "histogram", "Tool call latency.", "tool")
+	m.define("escalator_model_call_duration_seconds", "histogram", "Latency of each model's part in a model call, retries included.", "model")
+	m.define("escalator_model_retries_total", "counter", "Model calls retried after a failed attempt, by model and error code.", "model", "code")
+	m.define("escalator_model_fallbacks_total", "counter", "Model calls handed to a fallback model, by the model that failed.", "model")
+	m.define("escalator_tokens_total", "counter", "Tokens used by tool calls, by model and kind (prompt or completion).", "model", "kind")
+	m.define("escalator_cost_usd_total", "counter", "Estimated spend of tool calls in USD, by model.", "model")
+	m.define("escalator_cache_hits_total", "counter", "Tool calls answered from the response cache.", "tool")
+	m.define("escalator_errors_total", "counter", "Errors by source (jsonrpc, http or provider) and code.", "source", "code")
+	m.define("escalator_http_auth_total", "counter", "HTTP requests by authenticated caller (API key name or oauth:<client>, none when refused) and result (ok or denied).", "principal", "result")
+	m.define("escalator_circuit_events_total", "counter", "Model circuit breaker events by model and event (opened, short_circuited or closed).", "model", "event")
+	m.define("escalator_rate_limited_total", "counter", "Tool calls refused by the rate limiter, by how the client was identified (session, key, cert or ip).", "client")
+	return m
+}
+
+func (m *Metrics) define(name, kind, help string, labels ...string) {
+	m.families[name] = &metricFamily{name: name, help: help, kind: kind, labels: labels, series: make(map[string]*metricSeries)}
+}
+
+// get returns the series of family name for labelValues, creating it.
+// Callers hold m.mu.
+func (m *Metrics) get(name string, labelValues ...string) *metricSeries {
+	family := m.families[name]
+	key := strings.Join(labelValues, "\x00")
+	s, ok := family.series[key]
+	if !ok {
+		s = &metricSeries{labelValues: labelValues}
+		if family.kind == "histogram" {
+			s.buckets = make([]uint64, len(latencyBuckets))
+		}
+		family.series[key] = s
+	}
+	return s
+}
+
+func (m *Metrics) add(name string, value float64, labelValues ...string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.get(name, labelValues...).value += value
+}
+
+func (m *Metrics) observe(name string, d time.Duration, labelValues ...string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.get(name, labelValues...)
+	seconds := d.Seconds()
+	s.value += seconds
+	s.count++
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			s.buckets[i]++
+			break
+		}
+	}
+}
+
+// Request counts a request by method.
+func (m *Metrics) Request(method string) {
+	m.add("escalator_requests_total", 1, method)
+}
+
+// Error counts an error from source by its code.
+func (m *Metrics) Error(source string, code int) {
+	m.add("escalator_errors_total", 1, source, strconv.Itoa(code))
+}
+
+// ToolCall records a finished tool call with the usage it reported.
+func (m *Metrics) ToolCall(tool string, elapsed time.Duration, usage *TokenUsage, err error) {
+	outcome := "ok"
+	if err != nil {
+		outcome = "error"
+	}
+	m.add("escalator_tool_calls_total", 1, tool, outcome)
+	m.observe("escalator_tool_call_duration_seconds", elapsed, tool)
+	if usage == nil {
+		return
+	}
+	if usage.Cached {
+		m.add("escalator_cache_hits_total", 1, tool)
+		return
+	}
+	model := usage.Model
+	if model == "" {
+		model = "several"
+	}
+	m.add("escalator_tokens_total", float64(usage.PromptTokens), model, "prompt")
+	m.add("escalator_tokens_total", float64(usage.CompletionTokens), model, "completion")
+	m.add("escalator_cost_usd_total", usage.CostUSD, model)
+}
+
+// ModelCall records a model's part in a model call. A failed call counts
+// as a provider error.
+func (m *Metrics) ModelCall(model string, elapsed time.Duration, err error) {
+	m.observe("escalator_model_call_duration_seconds", elapsed, model)
+	if err != nil {
+		m.add("escalator_errors_total", 1, "provider", providerErrorCode(err))
+	}
+}
+
+// Retry counts a failed model attempt that will be retried.
+func (m *Metrics) Retry(model string, err error) {
+	m.add("escalator_model_retries_total", 1, model, providerErrorCode(err))
+}
+
+// Auth counts an HTTP request by the caller it authenticated as.
+func (m *Metrics) Auth(principal string, ok bool) {
+	result := "ok"
+	if !ok {
+		result = "denied"
+	}
+	m.add("escalator_http_auth_total", 1, principal, result)
+}
+
+// CircuitEvent counts a model's circuit opening or closing, or a call it
+// short-circuited.
+func (m *Metrics) CircuitEvent(model, event string) {
+	m.add("escalator_circuit_events_total", 1, model, event)
+}
+
+// RateLimited counts a tool call refused by the rate limiter.
+func (m *Metrics) RateLimited(client string) {
+	m.add("escalator_rate_limited_total", 1, client)
+}
+
+// Fallback counts a model call handed on to the next model in the chain.
+func (m *Metrics) Fallback(failed string) {
+	m.add("escalator_model_fallbacks_total", 1, failed)
+}
+
+// providerErrorCode is the HTTP status of a provider error, or a short
+// name for errors without one.
+func providerErrorCode(err error) string {
+	var apiErr *openai.APIError
+	var reqErr *openai.RequestError
+	switch {
+	case errors.As(err, &apiErr) && apiErr.HTTPStatusCode != 0:
+		return strconv.Itoa(apiErr.HTTPStatusCode)
+	case errors.As(err, &reqErr) && reqErr.HTTPStatusCode != 0:
+		return strconv.Itoa(reqErr.HTTPStatusCode)
+	case strings.Contains(err.Error(), "deadline exceeded"):
+		return "timeout"
+	}
+	return "other"
+}
+
+// metricMethod labels a JSON-RPC method, folding the ones the server
+// doesn't know into "other" so clients can't add series at will.
+func metricMethod(method string) string {
+	switch method {
+	case "initialize", "tools/list", "tools/call", "resources/list", "resources/read":
+		return method
+	}
+	return "other"
+}
+
+// Instrument counts legacy HTTP requests and the error statuses they're
+// answered with.
+func (m *Metrics) Instrument(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		m.Request("http")
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(rec, r)
+		if rec.status >= 400 {
+			m.Error("http", rec.status)
+		}
+	}
+}
+
+// statusRecorder remembers the status written through it, and passes
+// flushes on for streamed answers.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Handler serves the metrics in the Prometheus text exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		m.write(w)
+	})
+}
+
+func (m *Metrics) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	names := make([]string, 0, len(m.families))
+	for name := range m.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		family := m.families[name]
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, family.help, name, family.kind)
+		keys := make([]string, 0, len(family.series))
+		for key := range family.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			s := family.series[key]
+			labels := formatLabels(family.labels, s.labelValues)
+			if family.kind == "counter" {
+				fmt.Fprintf(w, "%s%s %s\n", name, labels, formatFloat(s.value))
+				continue
+			}
+			var cumulative uint64
+			for i, bound := range latencyBuckets {
+				cumulative += s.buckets[i]
+				fmt.Fprintf(w, "%s_bucket%s %d\n", name, bucketLabels(family, s, formatFloat(bound)), cumulative)
+			}
+			fmt.Fprintf(w, "%s_bucket%s %d\n", name, bucketLabels(family, s, "+Inf"), s.count)
+			fmt.Fprintf(w, "%s_sum%s %s\n", name, labels, formatFloat(s.value))
+			fmt.Fprintf(w, "%s_count%s %d\n", name, labels, s.count)
+		}
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = fmt.Sprintf(`%s="%s"`, name, labelEscaper.Replace(values[i]))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func bucketLabels(family *metricFamily, s *metricSeries, bound string) string {
+	return formatLabels(slices.Concat(family.labels, []string{"le"}), slices.Concat(s.labelValues, []string{bound}))
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
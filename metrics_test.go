@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func scrape(t *testing.T, metrics *Metrics) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	return rec.Body.String()
+}
+
+func TestMetrics_Handler(t *testing.T) {
+	metrics := NewMetrics()
+	metrics.ToolCall("get_help", 3*time.Second, &TokenUsage{Model: "o3", PromptTokens: 1000, CompletionTokens: 500, CostUSD: 0.006}, nil)
+	metrics.ToolCall("get_help", 0, &TokenUsage{Cached: true}, nil)
+	metrics.ToolCall("get_help", time.Second, nil, errors.New("down"))
+	metrics.Request(`odd"method`)
+
+	got := scrape(t, metrics)
+	for _, want := range []string{
+		"# TYPE escalator_tool_call_duration_seconds histogram",
+		`escalator_tool_calls_total{tool="get_help",outcome="ok"} 2`,
+		`escalator_tool_calls_total{tool="get_help",outcome="error"} 1`,
+		`escalator_tool_call_duration_seconds_bucket{tool="get_help",le="1"} 2`,
+		`escalator_tool_call_duration_seconds_bucket{tool="get_help",le="2.5"} 2`,
+		`escalator_tool_call_duration_seconds_bucket{tool="get_help",le="5"} 3`,
+		`escalator_tool_call_duration_seconds_bucket{tool="get_help",le="+Inf"} 3`,
+		`escalator_tool_call_duration_seconds_sum{tool="get_help"} 4`,
+		`escalator_tool_call_duration_seconds_count{tool="get_help"} 3`,
+		`escalator_tokens_total{model="o3",kind="prompt"} 1000`,
+		`escalator_cost_usd_total{model="o3"} 0.006`,
+		`escalator_cache_hits_total{tool="get_help"} 1`,
+		`escalator_requests_total{method="odd\"method"} 1`,
+	} {
+		if !strings.Contains(got, want+"\n") {
+			t.Errorf("Expected %q in:\n%s", want, got)
+		}
+	}
+}
+
+func TestMetrics_RetriesAndFallbacks(t *testing.T) {
+	withFastRetries(t)
+	srv := newFakeOpenAI(t, func(model string) string {
+		if model == "backup" {
+			return "answer from backup"
+		}
+		return ""
+	})
+	metrics := NewMetrics()
+	tool := NewGetHelpTool("", "primary").
+		WithClientOptions(ClientOptions{BaseURL: srv.URL}).
+		WithFallbackModels([]string{"backup"})
+	tool.LLM().WithMetrics(metrics)
+
+	if _, err := tool.askOpenAI(context.Background(), "prompt"); err != nil {
+		t.Fatal(err)
+	}
+	got := scrape(t, metrics)
+	for _, want := range []string{
+		`escalator_model_retries_total{model="primary",code="500"} 2`,
+		`escalator_model_fallbacks_total{model="primary"} 1`,
+		`escalator_errors_total{source="provider",code="500"} 1`,
+		`escalator_model_call_duration_seconds_count{model="backup"} 1`,
+	} {
+		if !strings.Contains(got, want+"\n") {
+			t.Errorf("Expected %q in:\n%s", want, got)
+		}
+	}
+}
+
+func TestMetrics_Requests(t *testing.T) {
+	metrics := NewMetrics()
+	server := NewMCPServer("test", "1.0.0").WithMetrics(metrics)
+	server.ProcessRequest(JsonRPCRequest{Jsonrpc: "2.0", ID: 1, Method: "tools/list"})
+	server.ProcessRequest(JsonRPCRequest{Jsonrpc: "2.0", ID: 2, Method: "no/such/method"})
+	server.ProcessRequest(JsonRPCRequest{Jsonrpc: "2.0", ID: 3, Method: "tools/call", Params: json.RawMessage(`{"name":"missing"}`)})
+
+	handler := metrics.Instrument(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "no", http.StatusBadRequest)
+	})
+	handler(httptest.NewRecorder(), httptest.NewRequest("POST", "/get_help", nil))
+
+	got := scrape(t, metrics)
+	for _, want := range []string{
+		`escalator_requests_total{method="tools/list"} 1`,
+		`escalator_requests_total{method="other"} 1`,
+		`escalator_requests_total{method="http"} 1`,
+		`escalator_errors_total{source="jsonrpc",code="-32601"} 1`,
+		`escalator_errors_total{source="http",code="400"} 1`,
+	} {
+		if !strings.Contains(got, want+"\n") {
+			t.Errorf("Expected %q in:\n%s", want, got)
+		}
+	}
+}
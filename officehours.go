@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/smtp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// digestThreads caps the threads listed in one digest, so a backlog
+// doesn't make it too long to read before a meeting (or for Slack to take).
+const digestThreads = 20
+
+// digestAnswerChars bounds each thread's analysis in the digest.
+const digestAnswerChars = 1500
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// OfficeHours is a recurring meeting: the days of the week it's held on
+// and its time of day, in local time.
+type OfficeHours struct {
+	days   [7]bool
+	hour   int
+	minute int
+}
+
+// ParseOfficeHours reads a schedule such as "Thu 15:00", "Mon,Thu 09:30",
+// "Mon-Fri 10:00" or "daily 16:00".
+func ParseOfficeHours(spec string) (*OfficeHours, error) {
+	dayList, clock, ok := strings.Cut(strings.TrimSpace(spec), " ")
+	if !ok {
+		return nil, fmt.Errorf("office hours %q: want days and a time, such as \"Thu 15:00\"", spec)
+	}
+	o := &OfficeHours{}
+	hour, minute, ok := strings.Cut(strings.TrimSpace(clock), ":")
+	var err error
+	if o.hour, err = strconv.Atoi(hour); !ok || err != nil || o.hour < 0 || o.hour > 23 {
+		return nil, fmt.Errorf("office hours %q: bad time %q (want HH:MM)", spec, clock)
+	}
+	if o.minute, err = strconv.Atoi(minute); err != nil || len(minute) != 2 || o.minute < 0 || o.minute > 59 {
+		return nil, fmt.Errorf("office hours %q: bad time %q (want HH:MM)", spec, clock)
+	}
+
+	if strings.EqualFold(dayList, "daily") {
+		o.days = [7]bool{true, true, true, true, true, true, true}
+		return o, nil
+	}
+	for _, item := range strings.Split(dayList, ",") {
+		first, last, isRange := strings.Cut(item, "-")
+		from, ok := weekdays[strings.ToLower(first)]
+		to := from
+		if isRange {
+			to, ok = weekdays[strings.ToLower(last)]
+		}
+		if !ok || (isRange && first == "") {
+			return nil, fmt.Errorf("office hours %q: unknown day %q (want Mon..Sun or daily)", spec, item)
+		}
+		for day := from; ; day = (day + 1) % 7 {
+			o.days[day] = true
+			if day == to {
+				break
+			}
+		}
+	}
+	return o, nil
+}
+
+// Next returns the first meeting after t.
+func (o *OfficeHours) Next(t time.Time) time.Time {
+	for i := 0; i <= 7; i++ {
+		day := t.AddDate(0, 0, i)
+		meeting := time.Date(day.Year(), day.Month(), day.Day(), o.hour, o.minute, 0, 0, t.Location())
+		if o.days[meeting.Weekday()] && meeting.After(t) {
+			return meeting
+		}
+	}
+	return time.Time{}
+}
+
+// Previous returns the last meeting before t.
+func (o *OfficeHours) Previous(t time.Time) time.Time {
+	for i := 0; i <= 7; i++ {
+		day := t.AddDate(0, 0, -i)
+		meeting := time.Date(day.Year(), day.Month(), day.Day(), o.hour, o.minute, 0, 0, t.Location())
+		if o.days[meeting.Weekday()] && meeting.Before(t) {
+			return meeting
+		}
+	}
+	return time.Time{}
+}
+
+// UnresolvedThread is an escalation reported failed or only partially
+// resolved, with the architect's answer.
+type UnresolvedThread struct {
+	Record  EscalationRecord
+	Outcome Outcome
+}
+
+// Unresolved returns the escalations reported failed or partially
+// resolved since since, oldest report first.
+func (h *HistoryStore) Unresolved(since time.Time) ([]UnresolvedThread, error) {
+	outcomes, err := h.Outcomes()
+	if err != nil {
+		return nil, err
+	}
+	var threads []UnresolvedThread
+	for id, outcome := range outcomes {
+		if outcome.Outcome == outcomeResolved || outcome.ReportedAt.Before(since) {
+			continue
+		}
+		rec, err := h.Get(id)
+		if err != nil {
+			// Outcomes can be reported for escalations pruned since.
+			continue
+		}
+		threads = append(threads, UnresolvedThread{Record: *rec, Outcome: outcome})
+	}
+	sort.Slice(threads, func(i, j int) bool {
+		a, b := threads[i], threads[j]
+		if !a.Outcome.ReportedAt.Equal(b.Outcome.ReportedAt) {
+			return a.Outcome.ReportedAt.Before(b.Outcome.ReportedAt)
+		}
+		return a.Record.ID < b.Record.ID
+	})
+	return threads, nil
+}
+
+// formatDigest renders the briefing for the meeting at meeting, covering
+// threads since since, as markdown.
+func formatDigest(threads []UnresolvedThread, since, meeting time.Time) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Office hours briefing, %s\n\n", meeting.Format("Mon 2 Jan 2006 15:04"))
+	if len(threads) == 0 {
+		fmt.Fprintf(&b, "No escalations were reported unresolved since %s.\n", since.Format("Mon 2 Jan 15:04"))
+		return b.String()
+	}
+	fmt.Fprintf(&b, "%d escalation(s) reported unresolved since %s. Each lists what the agent asked, what came of it, and the architect's analysis.\n", len(threads), since.Format("Mon 2 Jan 15:04"))
+	for i, thread := range threads {
+		if i == digestThreads {
+			fmt.Fprintf(&b, "\n…and %d more; see `escalator history list`.\n", len(threads)-digestThreads)
+			break
+		}
+		rec := thread.Record
+		fmt.Fprintf(&b, "\n## %d. %s\n\n", i+1, firstLine(rec.Question))
+		fmt.Fprintf(&b, "`%s`, asked %s of %s, reported **%s** %s.\n", rec.ID, rec.CreatedAt.Format("Mon 2 Jan 15:04"), rec.Model, thread.Outcome.Outcome, thread.Outcome.ReportedAt.Format("Mon 2 Jan 15:04"))
+		if thread.Outcome.Notes != "" {
+			fmt.Fprintf(&b, "\n**What happened:** %s\n", thread.Outcome.Notes)
+		}
+		fmt.Fprintf(&b, "\n**Architect's analysis:**\n\n%s\n", truncateMiddle(strings.TrimSpace(rec.Answer), digestAnswerChars))
+	}
+	return b.String()
+}
+
+func firstLine(text string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(text), "\n")
+	if len(line) > 120 {
+		line = line[:117] + "..."
+	}
+	return line
+}
+
+// SMTPConfig is the mail server the digest is emailed through.
+type SMTPConfig struct {
+	Addr     string
+	From     string
+	Username string
+	Password string
+}
+
+// OfficeHoursDigest sends a briefing of the escalations reported
+// unresolved since the last meeting, a lead time before each meeting, so
+// the team can take them up.
+type OfficeHoursDigest struct {
+	history  *HistoryStore
+	schedule *OfficeHours
+	lead     time.Duration
+
+	slackWebhook string
+	slackChannel string
+	emailTo      []string
+	smtp         SMTPConfig
+	redactor     *Redactor
+
+	client   *http.Client
+	sendMail func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+	now      func() time.Time
+}
+
+func NewOfficeHoursDigest(history *HistoryStore, schedule *OfficeHours) *OfficeHoursDigest {
+	return &OfficeHoursDigest{
+		history:  history,
+		schedule: schedule,
+		lead:     time.Hour,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		sendMail: smtp.SendMail,
+		now:      time.Now,
+	}
+}
+
+// WithLead sets how long before each meeting the digest is sent.
+func (d *OfficeHoursDigest) WithLead(lead time.Duration) *OfficeHoursDigest {
+	d.lead = lead
+	return d
+}
+
+// WithSlack posts the digest to a Slack incoming webhook, to channel when
+// it isn't empty.
+func (d *OfficeHoursDigest) WithSlack(webhook, channel string) *OfficeHoursDigest {
+	d.slackWebhook = webhook
+	d.slackChannel = channel
+	return d
+}
+
+// WithEmail emails the digest to the recipients through the SMTP server.
+func (d *OfficeHoursDigest) WithEmail(to []string, config SMTPConfig) *OfficeHoursDigest {
+	d.emailTo = to
+	d.smtp = config
+	return d
+}
+
+// WithRedactor redacts secrets from the digest before it's sent.
+func (d *OfficeHoursDigest) WithRedactor(redactor *Redactor) *OfficeHoursDigest {
+	d.redactor = redactor
+	return d
+}
+
+// Run sends the digest before each meeting until ctx is done.
+func (d *OfficeHoursDigest) Run(ctx context.Context) {
+	for {
+		meeting := d.schedule.Next(d.now().Add(d.lead))
+		wait := meeting.Add(-d.lead).Sub(d.now())
+		slog.Info("Office hours digest scheduled", "meeting", meeting, "send_in", wait.Round(time.Second))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		sendCtx, cancel := context.WithTimeout(ctx, time.Minute)
+		if err := d.Send(sendCtx, meeting); err != nil {
+			slog.Warn("Couldn't send the office hours digest", "meeting", meeting, "error", err)
+		}
+		cancel()
+	}
+}
+
+// Send builds the digest for the meeting at meeting, covering the threads
+// reported since the previous meeting, and sends it everywhere configured.
+func (d *OfficeHoursDigest) Send(ctx context.Context, meeting time.Time) error {
+	since := d.schedule.Previous(meeting)
+	threads, err := d.history.Unresolved(since)
+	if err != nil {
+		return fmt.Errorf("couldn't read unresolved escalations: %w", err)
+	}
+	text := formatDigest(threads, since, meeting)
+	if d.redactor != nil {
+		redacted, findings, err := d.redactor.Redact(ctx, text)
+		if err != nil {
+			return fmt.Errorf("couldn't scan for secrets: %w", err)
+		}
+		if len(findings) > 0 {
+			slog.Info("Redacted secrets from the office hours digest", "secrets", len(findings))
+		}
+		text = redacted
+	}
+
+	var errs []string
+	if d.slackWebhook != "" {
+		if err := d.postSlack(ctx, text); err != nil {
+			errs = append(errs, "slack: "+err.Error())
+		}
+	}
+	if len(d.emailTo) > 0 {
+		if err := d.email(text, meeting); err != nil {
+			errs = append(errs, "email: "+err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	slog.Info("Sent the office hours digest", "meeting", meeting, "threads", len(threads))
+	return nil
+}
+
+// postSlack posts the digest, each thread in its own section.
+func (d *OfficeHoursDigest) postSlack(ctx context.Context, text string) error {
+	header, _, _ := strings.Cut(text, "\n")
+	var blocks []map[string]interface{}
+	for i, part := range strings.Split(text, "\n## ") {
+		if i > 0 {
+			part = "*" + strings.Replace(part, "\n", "*\n", 1)
+		}
+		part = strings.ReplaceAll(strings.TrimPrefix(part, "# "), "**", "*")
+		blocks = append(blocks, slackSection(truncateMiddle(part, slackSectionChars)))
+	}
+	payload := map[string]interface{}{"text": strings.TrimPrefix(header, "# "), "blocks": blocks}
+	if d.slackChannel != "" {
+		payload["channel"] = d.slackChannel
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.slackWebhook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		reply, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("slack returned %s: %s", resp.Status, strings.TrimSpace(string(reply)))
+	}
+	return nil
+}
+
+// email sends the digest as a plain text message.
+func (d *OfficeHoursDigest) email(text string, meeting time.Time) error {
+	var auth smtp.Auth
+	if d.smtp.Username != "" {
+		host, _, _ := strings.Cut(d.smtp.Addr, ":")
+		auth = smtp.PlainAuth("", d.smtp.Username, d.smtp.Password, host)
+	}
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", d.smtp.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(d.emailTo, ", "))
+	fmt.Fprintf(&msg, "Subject: Office hours briefing, %s\r\n", meeting.Format("Mon 2 Jan 15:04"))
+	fmt.Fprintf(&msg, "Date: %s\r\n", d.now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(text, "\n", "\r\n"))
+	return d.sendMail(d.smtp.Addr, auth, d.smtp.From, d.emailTo, msg.Bytes())
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// Pulling a model downloads gigabytes, and loading one reads them into
+	// memory; both are slow on purpose-built hardware and slower elsewhere.
+	ollamaPullTimeout = 30 * time.Minute
+	ollamaLoadTimeout = 10 * time.Minute
+)
+
+// OllamaRuntime prepares models served by a local Ollama, which loads a
+// model's weights on first use and unloads them after a few idle minutes.
+// Either stalls an escalation for as long as loading takes, so models are
+// loaded at startup (pulled first if Ollama doesn't have them) and, with a
+// keepalive, pinged often enough never to be unloaded.
+type OllamaRuntime struct {
+	root      string
+	models    []string
+	pull      bool
+	keepAlive time.Duration
+	client    *http.Client
+}
+
+// NewOllamaRuntime manages models on the Ollama whose OpenAI-compatible
+// endpoint is baseURL (e.g. http://localhost:11434/v1).
+func NewOllamaRuntime(baseURL string, models []string) *OllamaRuntime {
+	root := strings.TrimSuffix(strings.TrimRight(baseURL, "/"), "/v1")
+	return &OllamaRuntime{root: root, models: models, client: &http.Client{}}
+}
+
+// WithPull pulls models Ollama doesn't have before loading them.
+func (o *OllamaRuntime) WithPull(pull bool) *OllamaRuntime {
+	o.pull = pull
+	return o
+}
+
+// WithKeepAlive pings the models every interval, asking Ollama to keep each
+// loaded for twice that, so one late ping doesn't unload it.
+func (o *OllamaRuntime) WithKeepAlive(interval time.Duration) *OllamaRuntime {
+	o.keepAlive = interval
+	return o
+}
+
+// Run loads the models, then keeps them loaded until ctx is done. Failures
+// are logged: the first escalation to a model simply loads it, as it would
+// have anyway.
+func (o *OllamaRuntime) Run(ctx context.Context) {
+	if err := o.Prepare(ctx); err != nil {
+		slog.Warn("Couldn't prepare every Ollama model", "error", err)
+	}
+	if o.keepAlive <= 0 {
+		return
+	}
+	ticker := time.NewTicker(o.keepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, model := range o.models {
+				if err := o.load(ctx, model); err != nil {
+					slog.Warn("Ollama keepalive failed", "model", model, "error", err)
+				}
+			}
+		}
+	}
+}
+
+// Prepare pulls (when enabled) and loads each model in turn. Models are
+// loaded one at a time so they don't compete for memory and bandwidth.
+func (o *OllamaRuntime) Prepare(ctx context.Context) error {
+	var errs []error
+	for _, model := range o.models {
+		if o.pull {
+			present, err := o.has(ctx, model)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", model, err))
+				continue
+			}
+			if !present {
+				start := time.Now()
+				slog.Info("Pulling model into Ollama", "model", model)
+				if err := o.pullModel(ctx, model); err != nil {
+					errs = append(errs, fmt.Errorf("%s: couldn't pull: %w", model, err))
+					continue
+				}
+				slog.Info("Pulled model", "model", model, "duration_ms", time.Since(start).Milliseconds())
+			}
+		}
+		start := time.Now()
+		if err := o.load(ctx, model); err != nil {
+			errs = append(errs, fmt.Errorf("%s: couldn't load: %w", model, err))
+			continue
+		}
+		slog.Info("Loaded model into Ollama", "model", model, "duration_ms", time.Since(start).Milliseconds())
+	}
+	return errors.Join(errs...)
+}
+
+// has reports whether Ollama has the model locally.
+func (o *OllamaRuntime) has(ctx context.Context, model string) (bool, error) {
+	status, body, err := o.post(ctx, "/api/show", map[string]interface{}{"model": model}, ollamaLoadTimeout)
+	if err != nil {
+		return false, err
+	}
+	switch status {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	return false, fmt.Errorf("status %d: %s", status, body)
+}
+
+func (o *OllamaRuntime) pullModel(ctx context.Context, model string) error {
+	status, body, err := o.post(ctx, "/api/pull", map[string]interface{}{"model": model, "stream": false}, ollamaPullTimeout)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("status %d: %s", status, body)
+	}
+	return nil
+}
+
+// load asks Ollama to load the model without generating anything, which a
+// generate request with no prompt does.
+func (o *OllamaRuntime) load(ctx context.Context, model string) error {
+	request := map[string]interface{}{"model": model}
+	if o.keepAlive > 0 {
+		request["keep_alive"] = int((2 * o.keepAlive).Seconds())
+	}
+	status, body, err := o.post(ctx, "/api/generate", request, ollamaLoadTimeout)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("status %d: %s", status, body)
+	}
+	return nil
+}
+
+func (o *OllamaRuntime) post(ctx context.Context, path string, request map[string]interface{}, timeout time.Duration) (int, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return 0, "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.root+path, bytes.NewReader(payload))
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return resp.StatusCode, strings.TrimSpace(string(body)), nil
+}
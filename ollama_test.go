@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeOllama serves Ollama's show, pull and generate endpoints with the
+// given models present, recording each request as "path model".
+func fakeOllama(t *testing.T, present ...string) (*httptest.Server, func() []string) {
+	var mu sync.Mutex
+	var calls []string
+	have := make(map[string]bool)
+	for _, model := range present {
+		have[model] = true
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&req)
+		model, _ := req["model"].(string)
+		mu.Lock()
+		defer mu.Unlock()
+		calls = append(calls, r.URL.Path+" "+model)
+		switch r.URL.Path {
+		case "/api/show":
+			if !have[model] {
+				http.Error(w, `{"error":"model not found"}`, http.StatusNotFound)
+			}
+		case "/api/pull":
+			if model == "missing:1b" {
+				http.Error(w, `{"error":"pull model manifest: file does not exist"}`, http.StatusInternalServerError)
+				return
+			}
+			have[model] = true
+		case "/api/generate":
+			if !have[model] {
+				http.Error(w, `{"error":"model not found"}`, http.StatusNotFound)
+				return
+			}
+			if keepAlive, ok := req["keep_alive"]; ok && keepAlive != float64(2) {
+				t.Errorf("Expected keep_alive of twice the interval, got %v", keepAlive)
+			}
+			w.Write([]byte(`{"done":true,"done_reason":"load"}`))
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), calls...)
+	}
+}
+
+func TestOllamaRuntime_Prepare(t *testing.T) {
+	srv, calls := fakeOllama(t, "llama3.1:8b")
+	runtime := NewOllamaRuntime(srv.URL+"/v1/", []string{"llama3.1:8b", "qwen2.5-coder:7b"}).WithPull(true)
+	if err := runtime.Prepare(context.Background()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	want := "/api/show llama3.1:8b,/api/generate llama3.1:8b,/api/show qwen2.5-coder:7b,/api/pull qwen2.5-coder:7b,/api/generate qwen2.5-coder:7b"
+	if got := strings.Join(calls(), ","); got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+
+	// Without pulling, missing models fail to load; failures don't stop
+	// the other models.
+	srv, calls = fakeOllama(t, "llama3.1:8b")
+	err := NewOllamaRuntime(srv.URL+"/v1", []string{"missing:1b", "llama3.1:8b"}).Prepare(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "missing:1b: couldn't load: status 404") {
+		t.Errorf("Expected a load error for the missing model, got %v", err)
+	}
+	if got := calls(); got[len(got)-1] != "/api/generate llama3.1:8b" {
+		t.Errorf("Expected the other model loaded, got %v", got)
+	}
+
+	err = NewOllamaRuntime(srv.URL+"/v1", []string{"missing:1b"}).WithPull(true).Prepare(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "couldn't pull") {
+		t.Errorf("Expected a pull error, got %v", err)
+	}
+}
+
+func TestOllamaRuntime_KeepAlive(t *testing.T) {
+	srv, calls := fakeOllama(t, "llama3.1:8b")
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		NewOllamaRuntime(srv.URL+"/v1", []string{"llama3.1:8b"}).WithKeepAlive(time.Second).Run(ctx)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(calls()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	cancel()
+	<-done
+	if got := calls(); len(got) < 2 || got[1] != "/api/generate llama3.1:8b" {
+		t.Errorf("Expected the model loaded and then pinged, got %v", got)
+	}
+}
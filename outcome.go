@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Outcomes an agent can report for an escalation.
+const (
+	outcomeResolved  = "resolved"
+	outcomePartially = "partially"
+	outcomeFailed    = "failed"
+)
+
+var outcomeLevels = []string{outcomeResolved, outcomePartially, outcomeFailed}
+
+// Outcome is what came of following an escalation's answer, as reported by
+// the agent that asked.
+type Outcome struct {
+	EscalationID string    `json:"escalation_id"`
+	Outcome      string    `json:"outcome"`
+	Notes        string    `json:"notes,omitempty"`
+	ReportedAt   time.Time `json:"reported_at"`
+}
+
+const outcomesSchema = `
+CREATE TABLE IF NOT EXISTS outcomes (
+	escalation_id TEXT PRIMARY KEY,
+	outcome       TEXT NOT NULL,
+	notes         TEXT NOT NULL DEFAULT '',
+	reported_at   TIMESTAMP NOT NULL
+);
+`
+
+// RecordOutcome stores an escalation's outcome, replacing any reported
+// before.
+func (h *HistoryStore) RecordOutcome(o Outcome) error {
+	_, err := h.db.Exec(`INSERT INTO outcomes (escalation_id, outcome, notes, reported_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (escalation_id) DO UPDATE SET outcome = excluded.outcome, notes = excluded.notes, reported_at = excluded.reported_at`,
+		o.EscalationID, o.Outcome, o.Notes, o.ReportedAt)
+	return err
+}
+
+// Outcomes returns every reported outcome by escalation ID. A history
+// opened read-only from before outcomes were tracked has none.
+func (h *HistoryStore) Outcomes() (map[string]Outcome, error) {
+	rows, err := h.db.Query(`SELECT escalation_id, outcome, notes, reported_at FROM outcomes`)
+	if err != nil {
+		if strings.Contains(err.Error(), "no such table") {
+			return map[string]Outcome{}, nil
+		}
+		return nil, err
+	}
+	defer rows.Close()
+	outcomes := make(map[string]Outcome)
+	for rows.Next() {
+		var o Outcome
+		if err := rows.Scan(&o.EscalationID, &o.Outcome, &o.Notes, &o.ReportedAt); err != nil {
+			return nil, err
+		}
+		outcomes[o.EscalationID] = o
+	}
+	return outcomes, rows.Err()
+}
+
+// Outcome returns an escalation's reported outcome, or nil.
+func (h *HistoryStore) Outcome(id string) (*Outcome, error) {
+	var o Outcome
+	err := h.db.QueryRow(`SELECT escalation_id, outcome, notes, reported_at FROM outcomes WHERE escalation_id = ?`, id).
+		Scan(&o.EscalationID, &o.Outcome, &o.Notes, &o.ReportedAt)
+	if errors.Is(err, sql.ErrNoRows) || (err != nil && strings.Contains(err.Error(), "no such table")) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+// Helpful returns up to limit of the most recent escalations reported
+// resolved or partially resolved, with their outcomes.
+func (h *HistoryStore) Helpful(limit int) ([]EscalationRecord, map[string]Outcome, error) {
+	rows, err := h.db.Query(`SELECT `+historyColumns+` FROM escalations
+		WHERE id IN (SELECT escalation_id FROM outcomes WHERE outcome IN (?, ?))
+		ORDER BY created_at DESC, id LIMIT ?`, outcomeResolved, outcomePartially, limit)
+	if err != nil {
+		return nil, nil, err
+	}
+	records, err := scanRecords(rows)
+	if err != nil {
+		return nil, nil, err
+	}
+	outcomes, err := h.Outcomes()
+	return records, outcomes, err
+}
+
+// formatOutcome renders an outcome for history show and list_escalations.
+func formatOutcome(o *Outcome) string {
+	s := fmt.Sprintf("\nOutcome:  %s (reported %s)\n", o.Outcome, o.ReportedAt.Local().Format("2006-01-02 15:04"))
+	if o.Notes != "" {
+		s += o.Notes + "\n"
+	}
+	return s
+}
+
+// formatOutcomeStats reports resolution rates overall, by tool and by model.
+func formatOutcomeStats(records []EscalationRecord, outcomes map[string]Outcome) string {
+	type counts struct {
+		escalations, reported int
+		by                    map[string]int
+	}
+	add := func(c *counts, outcome string) {
+		c.escalations++
+		if outcome != "" {
+			c.reported++
+			c.by[outcome]++
+		}
+	}
+	overall := &counts{by: map[string]int{}}
+	groups := map[string]*counts{}
+	var tools, models []string
+	for _, rec := range records {
+		outcome := outcomes[rec.ID].Outcome
+		add(overall, outcome)
+		for _, key := range []string{"tool " + rec.Tool, "model " + rec.Model} {
+			if _, ok := groups[key]; !ok {
+				groups[key] = &counts{by: map[string]int{}}
+				if strings.HasPrefix(key, "tool ") {
+					tools = append(tools, key)
+				} else {
+					models = append(models, key)
+				}
+			}
+			add(groups[key], outcome)
+		}
+	}
+	if overall.reported == 0 {
+		return "No outcomes reported.\n"
+	}
+
+	rate := func(c *counts, outcome string) string {
+		return fmt.Sprintf("%.0f%%", 100*float64(c.by[outcome])/float64(c.reported))
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Outcomes reported:  %d of %d escalations\n", overall.reported, overall.escalations)
+	fmt.Fprintf(&b, "Resolution rate:    %s resolved, %s partially, %s failed\n\n", rate(overall, outcomeResolved), rate(overall, outcomePartially), rate(overall, outcomeFailed))
+	fmt.Fprintf(&b, "%-28s %8s %9s %9s %9s\n", "BY", "REPORTED", "RESOLVED", "PARTIALLY", "FAILED")
+	for _, key := range append(tools, models...) {
+		c := groups[key]
+		if c.reported == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "%-28s %8d %9s %9s %9s\n", key, c.reported, rate(c, outcomeResolved), rate(c, outcomePartially), rate(c, outcomeFailed))
+	}
+	return b.String()
+}
+
+// ReportOutcomeTool lets the agent that asked record whether an answer
+// actually resolved its problem, feeding resolution rates and the choice of
+// past escalations shown to the model as examples.
+type ReportOutcomeTool struct {
+	history *HistoryStore
+}
+
+func NewReportOutcomeTool(history *HistoryStore) *ReportOutcomeTool {
+	return &ReportOutcomeTool{history: history}
+}
+
+func (t *ReportOutcomeTool) Name() string {
+	return "report_outcome"
+}
+
+func (t *ReportOutcomeTool) Category() string {
+	return "history"
+}
+
+func (t *ReportOutcomeTool) Description() string {
+	return "Report whether following an escalation's answer resolved the problem, after trying it; use the escalation_id returned with the answer"
+}
+
+func (t *ReportOutcomeTool) Schema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"escalation_id": map[string]interface{}{
+				"type":        "string",
+				"description": "ID of the escalation whose answer was tried (from the answer's escalation_id or list_escalations)",
+			},
+			"outcome": map[string]interface{}{
+				"type":        "string",
+				"enum":        outcomeLevels,
+				"description": "resolved if the advice fixed the problem, partially if it helped but more was needed, failed if it didn't help",
+			},
+			"notes": map[string]interface{}{
+				"type":        "string",
+				"description": "What worked, what didn't, or what the real cause turned out to be (optional)",
+			},
+		},
+		"required": []string{"escalation_id", "outcome"},
+	}
+}
+
+func (t *ReportOutcomeTool) Call(arguments map[string]interface{}) ([]map[string]interface{}, error) {
+	id, _ := arguments["escalation_id"].(string)
+	outcome, _ := arguments["outcome"].(string)
+	if id == "" || outcome == "" {
+		return textContent("Error: Missing required fields: escalation_id and outcome"), fmt.Errorf("missing required fields")
+	}
+	if !slices.Contains(outcomeLevels, outcome) {
+		return textContent(fmt.Sprintf("Error: outcome must be one of %s", strings.Join(outcomeLevels, ", "))), fmt.Errorf("invalid outcome %q", outcome)
+	}
+	if _, err := t.history.Get(id); errors.Is(err, sql.ErrNoRows) {
+		return textContent(fmt.Sprintf("Error: No escalation with ID %s", id)), err
+	} else if err != nil {
+		return textContent("Error: Couldn't read escalation history"), err
+	}
+
+	notes, _ := arguments["notes"].(string)
+	if err := t.history.RecordOutcome(Outcome{EscalationID: id, Outcome: outcome, Notes: strings.TrimSpace(notes), ReportedAt: time.Now()}); err != nil {
+		return textContent("Error: Couldn't record the outcome"), err
+	}
+	return textContent(fmt.Sprintf("Recorded escalation %s as %s.", id, outcome)), nil
+}
+
+// Few-shot examples are chosen among this many recent helpful escalations,
+// and must share this much of the question's keywords.
+const (
+	exampleCandidates    = 500
+	exampleMinSimilarity = 0.2
+	exampleMaxChars      = 4000
+)
+
+// exampleSource adds past escalations whose answers were reported to have
+// resolved a similar question, as worked examples. Failed answers are never
+// shown, and partial ones rank below resolved ones. It is best-effort.
+type exampleSource struct {
+	history *HistoryStore
+	k       int
+}
+
+func (s *exampleSource) Name() string { return "examples" }
+
+func (s *exampleSource) Gather(ctx context.Context, question string, arguments map[string]interface{}) ([]ContextBlock, error) {
+	keywords := questionKeywords(question)
+	if len(keywords) == 0 {
+		return nil, nil
+	}
+	records, outcomes, err := s.history.Helpful(exampleCandidates)
+	if err != nil {
+		slog.Warn("Couldn't read past escalations for examples", "error", err)
+		return nil, nil
+	}
+
+	type candidate struct {
+		rec   EscalationRecord
+		score float64
+	}
+	var candidates []candidate
+	for _, rec := range records {
+		similarity := keywordSimilarity(keywords, questionKeywords(rec.Question))
+		if similarity < exampleMinSimilarity || strings.TrimSpace(rec.Question) == strings.TrimSpace(question) {
+			continue
+		}
+		if outcomes[rec.ID].Outcome == outcomePartially {
+			similarity /= 2
+		}
+		candidates = append(candidates, candidate{rec, similarity})
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].score > candidates[j].score })
+
+	var blocks []ContextBlock
+	for _, c := range candidates[:min(s.k, len(candidates))] {
+		outcome := outcomes[c.rec.ID]
+		text := fmt.Sprintf("**A past escalation on a similar problem, whose answer was reported %s:**\n\nQuestion: %s\n\nAnswer:\n%s",
+			outcome.Outcome, c.rec.Question, truncateMiddle(c.rec.Answer, exampleMaxChars))
+		if outcome.Notes != "" {
+			text += "\n\nWhat the agent reported: " + outcome.Notes
+		}
+		blocks = append(blocks, ContextBlock{
+			Name:       "example " + c.rec.ID,
+			Text:       text,
+			Priority:   PriorityRetrieved,
+			Score:      c.score,
+			Provenance: fmt.Sprintf("PAST ESCALATION %s (answered %s)", c.rec.ID, describeAge(c.rec.CreatedAt)),
+		})
+	}
+	return blocks, nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestReportOutcomeTool_Call(t *testing.T) {
+	store := openTestHistory(t)
+	id := store.Record(EscalationRecord{Tool: "get_help", Question: "Why is the cache cold?"}, "prompt", &Completion{Answer: "Warm it.", Model: "o3"}, time.Second)
+	tool := NewReportOutcomeTool(store)
+
+	for _, arguments := range []map[string]interface{}{
+		{"outcome": "resolved"},
+		{"escalation_id": id, "outcome": "maybe"},
+		{"escalation_id": "0000000000000000", "outcome": "resolved"},
+	} {
+		if _, err := tool.Call(arguments); err == nil {
+			t.Errorf("Expected an error for %v", arguments)
+		}
+	}
+
+	content, err := tool.Call(map[string]interface{}{"escalation_id": id, "outcome": "failed"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !strings.Contains(contentText(content), "failed") {
+		t.Errorf("Expected a confirmation, got %q", contentText(content))
+	}
+	// A later report replaces the earlier one.
+	tool.Call(map[string]interface{}{"escalation_id": id, "outcome": "resolved", "notes": "Warming at startup fixed it."})
+
+	content, _ = NewListEscalationsTool(store).Call(map[string]interface{}{"id": id})
+	if text := contentText(content); !strings.Contains(text, "Outcome:  resolved") || !strings.Contains(text, "Warming at startup") {
+		t.Errorf("Expected the outcome with the escalation, got:\n%s", text)
+	}
+}
+
+func TestFormatOutcomeStats(t *testing.T) {
+	records := []EscalationRecord{
+		{ID: "a", Tool: "get_help", Model: "o3"},
+		{ID: "b", Tool: "get_help", Model: "o3"},
+		{ID: "c", Tool: "get_help", Model: "gpt-4o"},
+		{ID: "d", Tool: "brainstorm_options", Model: "gpt-4o"},
+	}
+	outcomes := map[string]Outcome{
+		"a": {Outcome: outcomeResolved},
+		"b": {Outcome: outcomeFailed},
+		"c": {Outcome: outcomeResolved},
+	}
+	stats := formatOutcomeStats(records, outcomes)
+	for _, want := range []string{"3 of 4 escalations", "67% resolved, 0% partially, 33% failed", "tool get_help", "model o3", "model gpt-4o"} {
+		if !strings.Contains(stats, want) {
+			t.Errorf("Expected the stats to contain %q, got:\n%s", want, stats)
+		}
+	}
+	if strings.Contains(stats, "brainstorm_options") {
+		t.Errorf("Expected groups without reports to be left out, got:\n%s", stats)
+	}
+	if stats := formatOutcomeStats(records, nil); stats != "No outcomes reported.\n" {
+		t.Errorf("Expected no stats without reports, got %q", stats)
+	}
+}
+
+func TestGetHelpTool_Call_Examples(t *testing.T) {
+	store := openTestHistory(t)
+	resolved := store.Record(EscalationRecord{Tool: "get_help", Question: "Why does the checkout handler deadlock on the inventory mutex?"}, "p", &Completion{Answer: "Take the locks in a fixed order.", Model: "o3"}, time.Second)
+	failed := store.Record(EscalationRecord{Tool: "get_help", Question: "Why does the checkout handler deadlock under load?"}, "p", &Completion{Answer: "Add more replicas.", Model: "o3"}, time.Second)
+	unrelated := store.Record(EscalationRecord{Tool: "get_help", Question: "Which logging library should we use?"}, "p", &Completion{Answer: "slog.", Model: "o3"}, time.Second)
+	for id, outcome := range map[string]string{resolved: outcomeResolved, failed: outcomeFailed, unrelated: outcomeResolved} {
+		store.RecordOutcome(Outcome{EscalationID: id, Outcome: outcome, ReportedAt: time.Now()})
+	}
+
+	var prompt string
+	tool := NewGetHelpTool(writeTestSummary(t), "o3").WithHistory(store).WithExamples(store, 2)
+	tool.LLM().WithProvider(CompletionFunc(func(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error) {
+		prompt = req.Messages[len(req.Messages)-1].Content
+		return &Completion{Answer: "Check the lock order.", Model: req.Model}, nil
+	}))
+
+	content, err := tool.Call(map[string]interface{}{"question": "The checkout handler deadlocks on the inventory mutex again", "summary": "A shop"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(prompt, "Take the locks in a fixed order.") {
+		t.Errorf("Expected the resolved escalation as an example, got:\n%s", prompt)
+	}
+	if strings.Contains(prompt, "Add more replicas.") || strings.Contains(prompt, "slog.") {
+		t.Errorf("Expected failed and unrelated escalations to be left out, got:\n%s", prompt)
+	}
+
+	id, _ := takeStructuredContent(content)["escalation_id"].(string)
+	if rec, err := store.Get(id); err != nil || rec.Answer != "Check the lock order." {
+		t.Errorf("Expected the answer's escalation ID, got %q (%v)", id, err)
+	}
+}
+
+func TestRunHistoryCommand_StatsOutcomes(t *testing.T) {
+	db := filepath.Join(t.TempDir(), "history.db")
+	store, err := OpenHistory(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := store.Record(EscalationRecord{Tool: "get_help", Question: "q"}, "p", &Completion{Answer: "a", Model: "o3"}, time.Second)
+	store.RecordOutcome(Outcome{EscalationID: id, Outcome: outcomePartially, ReportedAt: time.Now()})
+	store.Close()
+
+	var out bytes.Buffer
+	if code := runHistoryCommand([]string{"stats", "-db", db}, &out); code != 0 {
+		t.Fatalf("Expected stats to succeed, got %d: %s", code, out.String())
+	}
+	if !strings.Contains(out.String(), "0% resolved, 100% partially") {
+		t.Errorf("Expected resolution rates, got:\n%s", out.String())
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// Persona is the system prompt get_help answers with: the expertise and
+// voice of the engineer being escalated to.
+type Persona struct {
+	Name         string
+	Instructions string
+}
+
+const defaultPersona = "architect"
+
+var builtinPersonas = map[string]string{
+	"architect": `You are a senior software architect. Engineers, often AI coding agents, escalate to you when they are stuck on a problem in their project.
+
+Ground your answer in the project summary, the code and the other context provided. Explain the root cause before the fix, give concrete code-level guidance, and say what to check first when the context is not enough to be sure. Call out assumptions and trade-offs, and prefer the smallest change that solves the problem.`,
+
+	"security-reviewer": `You are a senior application security engineer. Engineers, often AI coding agents, escalate to you when they are stuck on a problem in their project.
+
+Answer the question, and review the code and context provided for vulnerabilities it touches: injection, broken authentication or authorization, secrets handling, unsafe deserialization, SSRF, path traversal and insecure defaults. For each issue, explain how it could be exploited, how severe it is, and the concrete fix. Do not invent issues the context doesn't support; say what you would need to see to be sure.`,
+
+	"sre": `You are a senior site reliability engineer. Engineers, often AI coding agents, escalate to you when they are stuck on a problem in their project.
+
+Answer with production in mind: failure modes, timeouts and retries, resource limits, concurrency under load, observability and safe rollout. When the question is about an incident, separate mitigating it now from fixing the root cause, and say which logs, metrics or traces would confirm the diagnosis. Give concrete code and configuration changes.`,
+}
+
+// LoadPersona returns the built-in persona named value, or reads the
+// persona from the file at value.
+func LoadPersona(value string) (*Persona, error) {
+	if value == "" {
+		value = defaultPersona
+	}
+	if instructions, ok := builtinPersonas[value]; ok {
+		return &Persona{Name: value, Instructions: instructions}, nil
+	}
+
+	data, err := os.ReadFile(value)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("unknown persona %q: want one of %s, or a file", value, strings.Join(personaNames(), ", "))
+		}
+		return nil, fmt.Errorf("couldn't read persona: %w", err)
+	}
+	instructions := strings.TrimSpace(string(data))
+	if instructions == "" {
+		return nil, fmt.Errorf("persona file %s is empty", value)
+	}
+	name := strings.TrimSuffix(filepath.Base(value), filepath.Ext(value))
+	return &Persona{Name: name, Instructions: instructions}, nil
+}
+
+func personaNames() []string {
+	names := make([]string, 0, len(builtinPersonas))
+	for name := range builtinPersonas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// promptRequest sends the persona's instructions as the system message,
+// followed by prior conversation messages and the prompt.
+func (p *Persona) promptRequest(prior []openai.ChatCompletionMessage, prompt string) openai.ChatCompletionRequest {
+	req := userRequest(prompt)
+	messages := []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleSystem, Content: p.Instructions}}
+	messages = append(messages, prior...)
+	req.Messages = append(messages, req.Messages...)
+	return req
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestLoadPersona(t *testing.T) {
+	persona, err := LoadPersona("")
+	if err != nil || persona.Name != "architect" || !strings.Contains(persona.Instructions, "software architect") {
+		t.Errorf("Expected the architect persona by default, got %+v, %v", persona, err)
+	}
+	if persona, err := LoadPersona("sre"); err != nil || !strings.Contains(persona.Instructions, "site reliability") {
+		t.Errorf("Expected the built-in sre persona, got %+v, %v", persona, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "payments-team.md")
+	os.WriteFile(path, []byte("You are a payments engineer. Mind PCI scope.\n"), 0644)
+	persona, err = LoadPersona(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if persona.Name != "payments-team" || persona.Instructions != "You are a payments engineer. Mind PCI scope." {
+		t.Errorf("Expected the persona from the file, got %+v", persona)
+	}
+
+	if _, err := LoadPersona("pirate"); err == nil || !strings.Contains(err.Error(), "security-reviewer") {
+		t.Errorf("Expected an unknown persona to list the built-in ones, got %v", err)
+	}
+	empty := filepath.Join(t.TempDir(), "empty.md")
+	os.WriteFile(empty, []byte("\n"), 0644)
+	if _, err := LoadPersona(empty); err == nil {
+		t.Error("Expected an empty persona file to be rejected")
+	}
+}
+
+func TestGetHelpTool_Call_Persona(t *testing.T) {
+	var messages []openai.ChatCompletionMessage
+	provider := CompletionFunc(func(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error) {
+		messages = req.Messages
+		return &Completion{Answer: "answer", Model: req.Model}, nil
+	})
+	persona, _ := LoadPersona("security-reviewer")
+	tool := NewGetHelpTool("", "o3").WithPersona(persona)
+	tool.LLM().WithProvider(provider)
+
+	if _, err := tool.Call(map[string]interface{}{"question": "Is this handler safe?", "summary": "s"}); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(messages) != 2 || messages[0].Role != openai.ChatMessageRoleSystem || messages[0].Content != persona.Instructions {
+		t.Fatalf("Expected the persona as the system message, got %+v", messages)
+	}
+	if messages[1].Role != openai.ChatMessageRoleUser || !strings.Contains(messages[1].Content, "Is this handler safe?") || strings.Contains(messages[1].Content, "security engineer") {
+		t.Errorf("Expected only the escalation in the user message, got %q", messages[1].Content)
+	}
+}
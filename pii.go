@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// piiLabel starts the replacement of personal data, as in [PII:email].
+const piiLabel = "PII"
+
+// NewPIIScrubber returns a Redactor that masks personal data rather than
+// credentials. It runs after secret redaction, and its replacements read
+// [PII:kind].
+func NewPIIScrubber(scanners ...SecretScanner) *Redactor {
+	return &Redactor{scanners: scanners, label: piiLabel}
+}
+
+// piiPatterns are the built-in PII detectors, by name.
+var piiPatterns = map[string]secretPattern{
+	"email": {"email", regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}\b`)},
+	"phone": {"phone", regexp.MustCompile(`(?:\+\d{1,3}[ .-]?(?:\(\d{1,4}\)|\d{1,4})(?:[ .-]?\d{2,4}){2,4}|\(\d{3}\) ?\d{3}-\d{4}|\b\d{3}[-.]\d{3}[-.]\d{4})\b`)},
+}
+
+// exampleEmailDomains are reserved for documentation (RFC 2606), so
+// addresses at them are placeholders rather than anyone's data.
+var exampleEmailDomains = []string{"example.com", "example.org", "example.net", "example", "test", "invalid", "localhost"}
+
+// piiScanner finds personal data: email addresses and phone numbers, the
+// names on a list, and a team's own patterns, such as customer IDs.
+type piiScanner struct {
+	patterns []secretPattern
+}
+
+// NewPIIScanner returns a scanner for the named built-in detectors (email,
+// phone) and the given extra patterns.
+func NewPIIScanner(builtins []string, extra ...secretPattern) (*piiScanner, error) {
+	scanner := &piiScanner{}
+	for _, name := range builtins {
+		pattern, ok := piiPatterns[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown PII detector %q (want email or phone)", name)
+		}
+		scanner.patterns = append(scanner.patterns, pattern)
+	}
+	scanner.patterns = append(scanner.patterns, extra...)
+	return scanner, nil
+}
+
+// LoadPIINames reads a list of names, one per line, ignoring blank lines
+// and # comments, into a pattern matching any of them as whole words in
+// any case.
+func LoadPIINames(path string) (secretPattern, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return secretPattern{}, err
+	}
+	defer file.Close()
+	var names []string
+	lines := bufio.NewScanner(file)
+	for lines.Scan() {
+		name := strings.TrimSpace(lines.Text())
+		if name == "" || strings.HasPrefix(name, "#") {
+			continue
+		}
+		names = append(names, regexp.QuoteMeta(name))
+	}
+	if err := lines.Err(); err != nil {
+		return secretPattern{}, err
+	}
+	if len(names) == 0 {
+		return secretPattern{}, fmt.Errorf("%s lists no names", path)
+	}
+	// Longer names first, so "Ann Lee" is masked whole rather than "Ann".
+	sort.Slice(names, func(i, j int) bool { return len(names[i]) > len(names[j]) })
+	return secretPattern{kind: "name", re: regexp.MustCompile(`(?i)\b(?:` + strings.Join(names, "|") + `)\b`)}, nil
+}
+
+func (s *piiScanner) Name() string { return "pii" }
+
+func (s *piiScanner) Scan(ctx context.Context, text string) ([]SecretFinding, error) {
+	findings := findPatterns(s.patterns, text)
+	kept := findings[:0]
+	for _, f := range findings {
+		if f.Kind == "email" && isExampleEmail(text[f.Start:f.End]) {
+			continue
+		}
+		kept = append(kept, f)
+	}
+	return kept, nil
+}
+
+func isExampleEmail(address string) bool {
+	domain := strings.ToLower(address[strings.LastIndex(address, "@")+1:])
+	for _, example := range exampleEmailDomains {
+		if domain == example || strings.HasSuffix(domain, "."+example) {
+			return true
+		}
+	}
+	return false
+}
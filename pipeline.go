@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Pipeline is a named sequence of tool calls exposed as one tool. Each
+// step is called with the pipeline's arguments plus its own, whose string
+// values are text/templates that can use the answers of earlier steps.
+type Pipeline struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Category    string          `json:"category"`
+	Inputs      []PipelineInput `json:"inputs"`
+	Steps       []*PipelineStep `json:"steps"`
+}
+
+// PipelineInput is an argument of the pipeline's tool.
+type PipelineInput struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Type is "string" (the default) or "array" of strings.
+	Type     string `json:"type"`
+	Required bool   `json:"required"`
+}
+
+// PipelineStep calls one tool. Name, by default the tool's name, is what
+// later steps refer to its answer by.
+type PipelineStep struct {
+	Name      string                 `json:"name"`
+	Tool      string                 `json:"tool"`
+	Arguments map[string]interface{} `json:"arguments"`
+
+	templates map[string]*template.Template
+}
+
+// PipelineData is what step arguments are rendered with.
+type PipelineData struct {
+	// Input holds the arguments the pipeline was called with.
+	Input map[string]interface{}
+	// Steps holds the answer of each earlier step, by step name.
+	Steps map[string]string
+	// Previous is the answer of the step before.
+	Previous string
+}
+
+var pipelineNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+var pipelineFuncs = template.FuncMap{
+	// join renders an array input as one string.
+	"join": func(value interface{}, sep string) string {
+		return strings.Join(stringListArgument(map[string]interface{}{"v": value}, "v"), sep)
+	},
+}
+
+// LoadPipelines reads a JSON array of pipelines and checks their templates,
+// so a typo fails at startup rather than halfway through a pipeline.
+func LoadPipelines(path string) ([]*Pipeline, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var pipelines []*Pipeline
+	if err := json.Unmarshal(data, &pipelines); err != nil {
+		return nil, fmt.Errorf("couldn't parse %s: %w", path, err)
+	}
+	if len(pipelines) == 0 {
+		return nil, fmt.Errorf("no pipelines in %s", path)
+	}
+	seen := make(map[string]bool)
+	for i, pipeline := range pipelines {
+		if !pipelineNamePattern.MatchString(pipeline.Name) {
+			return nil, fmt.Errorf("pipeline %d needs a name of lowercase letters, digits and underscores", i+1)
+		}
+		if seen[pipeline.Name] {
+			return nil, fmt.Errorf("two pipelines are named %q", pipeline.Name)
+		}
+		seen[pipeline.Name] = true
+		if err := pipeline.check(); err != nil {
+			return nil, fmt.Errorf("pipeline %s: %w", pipeline.Name, err)
+		}
+	}
+	return pipelines, nil
+}
+
+// check validates the pipeline and parses its step templates, rendering
+// each with empty values to find references to unknown inputs and to
+// steps that haven't run yet.
+func (p *Pipeline) check() error {
+	if len(p.Steps) == 0 {
+		return fmt.Errorf("no steps")
+	}
+	data := PipelineData{Input: make(map[string]interface{}), Steps: make(map[string]string)}
+	for i := range p.Inputs {
+		input := &p.Inputs[i]
+		if input.Name == "" {
+			return fmt.Errorf("input %d has no name", i+1)
+		}
+		switch input.Type {
+		case "":
+			input.Type = "string"
+		case "string", "array":
+		default:
+			return fmt.Errorf("input %s has type %q; want string or array", input.Name, input.Type)
+		}
+		data.Input[input.Name] = ""
+	}
+	for i, step := range p.Steps {
+		if step.Tool == "" {
+			return fmt.Errorf("step %d has no tool", i+1)
+		}
+		if step.Tool == p.Name {
+			return fmt.Errorf("step %d calls the pipeline itself", i+1)
+		}
+		if step.Name == "" {
+			step.Name = step.Tool
+		}
+		if _, ok := data.Steps[step.Name]; ok {
+			return fmt.Errorf("two steps are named %q; name them to tell them apart", step.Name)
+		}
+		step.templates = make(map[string]*template.Template)
+		for argument, value := range step.Arguments {
+			text, ok := value.(string)
+			if !ok {
+				continue
+			}
+			tmpl, err := template.New(step.Name + "." + argument).Funcs(pipelineFuncs).Option("missingkey=error").Parse(text)
+			if err != nil {
+				return fmt.Errorf("step %s: %w", step.Name, err)
+			}
+			if err := tmpl.Execute(new(bytes.Buffer), data); err != nil {
+				return fmt.Errorf("step %s: %w", step.Name, err)
+			}
+			step.templates[argument] = tmpl
+		}
+		data.Steps[step.Name] = ""
+	}
+	return nil
+}
+
+// arguments renders the step's arguments on top of the pipeline's.
+func (s *PipelineStep) arguments(data PipelineData) (map[string]interface{}, error) {
+	arguments := maps.Clone(data.Input)
+	for name, value := range s.Arguments {
+		tmpl, ok := s.templates[name]
+		if !ok {
+			arguments[name] = value
+			continue
+		}
+		var b strings.Builder
+		if err := tmpl.Execute(&b, data); err != nil {
+			return nil, err
+		}
+		arguments[name] = b.String()
+	}
+	return arguments, nil
+}
+
+// PipelineTool runs a pipeline's steps in order through the server, as if
+// each had been called on its own, and answers with every step's answer.
+type PipelineTool struct {
+	pipeline *Pipeline
+	server   *MCPServer
+}
+
+// NewPipelineTool binds a pipeline to the server's tools, which must
+// include every tool it calls.
+func NewPipelineTool(pipeline *Pipeline, server *MCPServer) (*PipelineTool, error) {
+	if _, ok := server.server.Tool(pipeline.Name); ok {
+		return nil, fmt.Errorf("pipeline %s has the name of a tool", pipeline.Name)
+	}
+	for _, step := range pipeline.Steps {
+		if _, ok := server.server.Tool(step.Tool); !ok {
+			return nil, fmt.Errorf("pipeline %s: step %s calls unknown tool %s", pipeline.Name, step.Name, step.Tool)
+		}
+	}
+	return &PipelineTool{pipeline: pipeline, server: server}, nil
+}
+
+func (t *PipelineTool) Name() string {
+	return t.pipeline.Name
+}
+
+func (t *PipelineTool) Category() string {
+	if t.pipeline.Category == "" {
+		return "pipeline"
+	}
+	return t.pipeline.Category
+}
+
+func (t *PipelineTool) Description() string {
+	if t.pipeline.Description != "" {
+		return t.pipeline.Description
+	}
+	tools := make([]string, len(t.pipeline.Steps))
+	for i, step := range t.pipeline.Steps {
+		tools[i] = step.Tool
+	}
+	return "Run " + strings.Join(tools, ", then ")
+}
+
+func (t *PipelineTool) Schema() map[string]interface{} {
+	properties := make(map[string]interface{})
+	required := []string{}
+	for _, input := range t.pipeline.Inputs {
+		property := map[string]interface{}{"type": "string", "description": input.Description}
+		if input.Type == "array" {
+			property["type"] = "array"
+			property["items"] = map[string]interface{}{"type": "string"}
+		}
+		properties[input.Name] = property
+		if input.Required {
+			required = append(required, input.Name)
+		}
+	}
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+		"required":   required,
+	}
+}
+
+func (t *PipelineTool) Call(arguments map[string]interface{}) ([]map[string]interface{}, error) {
+	return t.CallStream(arguments, nil)
+}
+
+// CallStream streams each step's answer as it arrives.
+func (t *PipelineTool) CallStream(arguments map[string]interface{}, onDelta func(string)) ([]map[string]interface{}, error) {
+	return t.CallContext(context.Background(), arguments, onDelta)
+}
+
+// CallContext runs the steps within the trace of ctx. A failed step stops
+// the pipeline; the answer then holds the steps before it and the error.
+func (t *PipelineTool) CallContext(ctx context.Context, arguments map[string]interface{}, onDelta func(string)) ([]map[string]interface{}, error) {
+	for _, input := range t.pipeline.Inputs {
+		if value, ok := arguments[input.Name]; input.Required && (!ok || value == "") {
+			return textContent("Error: Missing required field: " + input.Name), fmt.Errorf("missing required fields")
+		}
+	}
+
+	data := PipelineData{Input: make(map[string]interface{}), Steps: make(map[string]string)}
+	for _, input := range t.pipeline.Inputs {
+		if input.Type == "array" {
+			data.Input[input.Name] = stringListArgument(arguments, input.Name)
+		} else {
+			value, _ := arguments[input.Name].(string)
+			data.Input[input.Name] = value
+		}
+	}
+
+	usage := &TokenUsage{}
+	var steps []map[string]interface{}
+	var answer strings.Builder
+	for i, step := range t.pipeline.Steps {
+		if onDelta != nil {
+			onDelta(fmt.Sprintf("\n## %s\n\n", step.Name))
+		}
+		stepArguments, err := step.arguments(data)
+		var content []map[string]interface{}
+		start := time.Now()
+		if err == nil {
+			content, err = t.server.callStep(ctx, step.Tool, stepArguments, onDelta)
+		}
+		meta := takeMeta(content)
+		takeStructuredContent(content)
+		text := contentText(content)
+		info := map[string]interface{}{"step": step.Name, "tool": step.Tool, "duration_ms": time.Since(start).Milliseconds()}
+		if stepUsage, ok := meta["usage"].(*TokenUsage); ok {
+			usage.addUsage(stepUsage)
+			info["usage"] = stepUsage
+		}
+		if id, ok := meta["escalation_id"].(string); ok {
+			info["escalation_id"] = id
+		}
+		steps = append(steps, info)
+		if i > 0 {
+			answer.WriteString("\n\n")
+		}
+		fmt.Fprintf(&answer, "## %s\n\n%s", step.Name, text)
+		if err != nil {
+			slog.Warn("Pipeline step failed", "pipeline", t.Name(), "step", step.Name, "tool", step.Tool, "error", err)
+			info["error"] = err.Error()
+			if text == "" {
+				answer.WriteString("Error: " + capitalize(err.Error()))
+			}
+			fmt.Fprintf(&answer, "\n\nThe pipeline stopped at step %s of %d.", step.Name, len(t.pipeline.Steps))
+			return withMeta(textContent(answer.String()), map[string]interface{}{"steps": steps, "usage": usage}), fmt.Errorf("step %s: %w", step.Name, err)
+		}
+		data.Steps[step.Name] = text
+		data.Previous = text
+	}
+	return withMeta(textContent(answer.String()), map[string]interface{}{"steps": steps, "usage": usage}), nil
+}
+
+// callStep runs a tool as a step of a pipeline, applying its argument
+// rules as if it had been called directly.
+func (s *MCPServer) callStep(ctx context.Context, name string, arguments map[string]interface{}, onDelta func(string)) ([]map[string]interface{}, error) {
+	tool, _ := s.server.Tool(name)
+	ctx, span := startSpan(ctx, "execute_tool "+name, spanKindInternal)
+	content, err := s.callTool(ctx, tool, s.rules.Apply(name, arguments), onDelta)
+	span.End(err)
+	return content, err
+}
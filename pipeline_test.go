@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// recordingTool answers with its name, recording the arguments of each call.
+type recordingTool struct {
+	name  string
+	calls []map[string]interface{}
+	fail  bool
+}
+
+func (r *recordingTool) Name() string        { return r.name }
+func (r *recordingTool) Description() string { return "Records calls" }
+func (r *recordingTool) Schema() map[string]interface{} {
+	return map[string]interface{}{"type": "object"}
+}
+
+func (r *recordingTool) Call(arguments map[string]interface{}) ([]map[string]interface{}, error) {
+	r.calls = append(r.calls, arguments)
+	if r.fail {
+		return textContent("Error: down"), os.ErrDeadlineExceeded
+	}
+	return withMeta(textContent(r.name+" answer"), map[string]interface{}{"usage": usageOf(&Completion{Model: "o3", PromptTokens: 100})}), nil
+}
+
+func writePipelines(t *testing.T, pipelines string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "pipelines.json")
+	if err := os.WriteFile(path, []byte(pipelines), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPipelines_Invalid(t *testing.T) {
+	for _, pipelines := range []string{
+		`[]`,
+		`[{"name": "Audit", "steps": [{"tool": "security_audit"}]}]`,
+		`[{"name": "audit", "steps": []}]`,
+		`[{"name": "audit", "steps": [{"tool": "security_audit", "arguments": {"code": "{{.Input.files}}"}}]}]`,
+		`[{"name": "audit", "steps": [{"tool": "get_help", "arguments": {"question": "{{.Steps.security_audit}}"}}, {"tool": "security_audit"}]}]`,
+		`[{"name": "audit", "steps": [{"tool": "get_help"}, {"tool": "get_help"}]}]`,
+		`[{"name": "audit", "inputs": [{"name": "n", "type": "number"}], "steps": [{"tool": "get_help"}]}]`,
+	} {
+		if _, err := LoadPipelines(writePipelines(t, pipelines)); err == nil {
+			t.Errorf("Expected an error for %s", pipelines)
+		}
+	}
+}
+
+func TestPipelineTool_Call(t *testing.T) {
+	path := writePipelines(t, `[{
+		"name": "audit_and_fix",
+		"inputs": [
+			{"name": "files", "type": "array", "required": true},
+			{"name": "summary", "description": "Project summary"}
+		],
+		"steps": [
+			{"tool": "security_audit"},
+			{"name": "patch", "tool": "get_help", "arguments": {"question": "Propose a patch for {{join .Input.files \", \"}}:\n{{.Previous}}"}},
+			{"tool": "generate_tests", "arguments": {"code": "{{.Steps.patch}}", "max_tests": 3}}
+		]
+	}]`)
+	pipelines, err := LoadPipelines(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	audit := &recordingTool{name: "security_audit"}
+	help := &recordingTool{name: "get_help"}
+	tests := &recordingTool{name: "generate_tests"}
+	rules, _ := NewArgumentRules([]ArgumentRule{{Argument: "code", Tool: "generate_tests", Action: "mask"}})
+	server := NewMCPServer("test", "1.0.0").WithArgumentRules(rules)
+	for _, tool := range []Tool{audit, help, tests} {
+		server.RegisterTool(tool)
+	}
+	tool, err := NewPipelineTool(pipelines[0], server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.RegisterTool(tool)
+
+	result, rpcErr := server.HandleToolsCall(json.RawMessage(`{"name":"audit_and_fix","arguments":{"files":["a.go","b.go"],"summary":"s"}}`))
+	if rpcErr != nil || result.IsError {
+		t.Fatalf("Expected the pipeline to succeed, got %v %v", result, rpcErr)
+	}
+	if files := audit.calls[0]["files"]; len(files.([]string)) != 2 || audit.calls[0]["summary"] != "s" {
+		t.Errorf("Expected the pipeline's arguments passed to the first step, got %v", audit.calls[0])
+	}
+	if question := help.calls[0]["question"]; question != "Propose a patch for a.go, b.go:\nsecurity_audit answer" {
+		t.Errorf("Expected the audit threaded into the question, got %q", question)
+	}
+	if tests.calls[0]["code"] != "[REDACTED]" || tests.calls[0]["max_tests"] != float64(3) {
+		t.Errorf("Expected the step's argument rules and literal arguments applied, got %v", tests.calls[0])
+	}
+	text := result.Content[0]["text"].(string)
+	if !strings.Contains(text, "## patch\n\nget_help answer") || !strings.Contains(text, "## generate_tests\n\ngenerate_tests answer") {
+		t.Errorf("Expected every step's answer, got %q", text)
+	}
+	meta := result.Meta
+	if usage := meta["usage"].(*TokenUsage); usage.PromptTokens != 300 {
+		t.Errorf("Expected the steps' usage summed, got %+v", usage)
+	}
+
+	help.fail = true
+	result, _ = server.HandleToolsCall(json.RawMessage(`{"name":"audit_and_fix","arguments":{"files":["a.go"]}}`))
+	if !result.IsError || len(tests.calls) != 1 {
+		t.Errorf("Expected a failed step to stop the pipeline, got %v", result)
+	}
+	if result, _ := server.HandleToolsCall(json.RawMessage(`{"name":"audit_and_fix","arguments":{}}`)); !result.IsError {
+		t.Error("Expected an error without a required input")
+	}
+
+	if _, err := NewPipelineTool(&Pipeline{Name: "p", Steps: []*PipelineStep{{Name: "x", Tool: "missing"}}}, server); err == nil {
+		t.Error("Expected an error for a step calling an unknown tool")
+	}
+}
@@ -0,0 +1,200 @@
+// Package llm is the model provider layer of the escalator: the answer a
+// model gives, and the interface backends implement to give it, in the
+// OpenAI chat format.
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// Completion is a model's answer together with which model produced it and
+// the tokens it used.
+type Completion struct {
+	Answer           string
+	Model            string
+	PromptTokens     int
+	CompletionTokens int
+	// CachedPromptTokens of the prompt tokens were served from the
+	// provider's prompt cache.
+	CachedPromptTokens int
+
+	// ToolCalls are the functions the model asked to call instead of
+	// answering.
+	ToolCalls []openai.ToolCall
+
+	// Confidence is the model's self-assessed confidence in the answer
+	// ("high", "medium" or "low"), when it was asked for and gave one.
+	Confidence string
+}
+
+// Provider is a model backend. Every provider answers as a stream of deltas
+// so streaming, progress notifications and partial answers work the same
+// whichever backend is configured. Backends without native streaming are
+// wrapped with CompletionFunc.
+//
+// Requests use the OpenAI chat format, which the tools already build;
+// providers for other APIs translate it.
+type Provider interface {
+	Stream(ctx context.Context, req openai.ChatCompletionRequest) (DeltaStream, error)
+}
+
+// Completer is implemented by providers with a non-streaming call, used
+// when nobody is listening to the deltas.
+type Completer interface {
+	Complete(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error)
+}
+
+// DeltaStream yields a provider's answer incrementally. Recv returns io.EOF
+// once the answer is complete.
+type DeltaStream interface {
+	Recv() (Delta, error)
+	Close() error
+}
+
+// Delta is the next piece of an answer. The token counts are set on
+// whichever delta the provider reports usage in, usually the last. Tool
+// calls arrive in pieces too: pieces with the same Index belong to one
+// call, and their arguments are concatenated.
+type Delta struct {
+	Text             string
+	ToolCalls        []openai.ToolCall
+	PromptTokens     int
+	CompletionTokens int
+	// CachedPromptTokens of the prompt tokens were served from the
+	// provider's prompt cache.
+	CachedPromptTokens int
+}
+
+// CompletionFunc adapts a non-streaming backend to Provider: its stream
+// delivers the whole answer as a single delta.
+type CompletionFunc func(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error)
+
+func (f CompletionFunc) Complete(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error) {
+	return f(ctx, req)
+}
+
+func (f CompletionFunc) Stream(ctx context.Context, req openai.ChatCompletionRequest) (DeltaStream, error) {
+	completion, err := f(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	calls := make([]openai.ToolCall, len(completion.ToolCalls))
+	for i, call := range completion.ToolCalls {
+		call.Index = &i
+		calls[i] = call
+	}
+	return &completionStream{delta: Delta{
+		Text:               completion.Answer,
+		ToolCalls:          calls,
+		PromptTokens:       completion.PromptTokens,
+		CompletionTokens:   completion.CompletionTokens,
+		CachedPromptTokens: completion.CachedPromptTokens,
+	}}, nil
+}
+
+type completionStream struct {
+	delta Delta
+	done  bool
+}
+
+func (s *completionStream) Recv() (Delta, error) {
+	if s.done {
+		return Delta{}, io.EOF
+	}
+	s.done = true
+	return s.delta, nil
+}
+
+func (s *completionStream) Close() error {
+	return nil
+}
+
+// Generate asks the provider for a completion of req, streaming it
+// through onDelta when it is non-nil. Without a listener, providers that
+// implement Completer are asked without streaming.
+func Generate(ctx context.Context, provider Provider, req openai.ChatCompletionRequest, onDelta func(string)) (*Completion, error) {
+	if completer, ok := provider.(Completer); ok && onDelta == nil {
+		return completer.Complete(ctx, req)
+	}
+
+	stream, err := provider.Stream(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	completion := &Completion{Model: req.Model}
+	var answer strings.Builder
+	var calls []openai.ToolCall
+	for {
+		delta, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if delta.PromptTokens > 0 || delta.CompletionTokens > 0 {
+			completion.PromptTokens = delta.PromptTokens
+			completion.CompletionTokens = delta.CompletionTokens
+			completion.CachedPromptTokens = delta.CachedPromptTokens
+		}
+		calls = mergeToolCalls(calls, delta.ToolCalls)
+		if delta.Text == "" {
+			continue
+		}
+		answer.WriteString(delta.Text)
+		if onDelta != nil {
+			onDelta(delta.Text)
+		}
+	}
+
+	if answer.Len() == 0 && len(calls) == 0 {
+		return nil, fmt.Errorf("no response from model %s", req.Model)
+	}
+
+	completion.Answer = answer.String()
+	completion.ToolCalls = calls
+	return completion, nil
+}
+
+// mergeToolCalls adds streamed tool call pieces to calls.
+func mergeToolCalls(calls, pieces []openai.ToolCall) []openai.ToolCall {
+	for _, piece := range pieces {
+		index := len(calls)
+		if piece.Index != nil {
+			index = *piece.Index
+		}
+		for len(calls) <= index {
+			calls = append(calls, openai.ToolCall{Type: openai.ToolTypeFunction})
+		}
+		call := &calls[index]
+		if piece.ID != "" {
+			call.ID = piece.ID
+		}
+		call.Function.Name += piece.Function.Name
+		call.Function.Arguments += piece.Function.Arguments
+	}
+	return calls
+}
+
+type providerKey struct{}
+
+// NewContext returns a copy of ctx carrying provider, for tools that ask a
+// model without being given one, such as those served by an mcp.Server
+// built with mcp.WithProvider.
+func NewContext(ctx context.Context, provider Provider) context.Context {
+	return context.WithValue(ctx, providerKey{}, provider)
+}
+
+// FromContext returns the provider carried by ctx, if any.
+func FromContext(ctx context.Context) (Provider, bool) {
+	provider, ok := ctx.Value(providerKey{}).(Provider)
+	return provider, ok
+}
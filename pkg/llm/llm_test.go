@@ -0,0 +1,49 @@
+package llm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// completer answers without streaming, and fails if asked to stream.
+type completer struct {
+	CompletionFunc
+}
+
+func (completer) Stream(ctx context.Context, req openai.ChatCompletionRequest) (DeltaStream, error) {
+	panic("expected Complete without a listener")
+}
+
+func TestGenerate(t *testing.T) {
+	zero, one := 0, 1
+	provider := CompletionFunc(func(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error) {
+		return &Completion{Model: req.Model, PromptTokens: 7, ToolCalls: []openai.ToolCall{
+			{Index: &zero, ID: "a", Function: openai.FunctionCall{Name: "read_file", Arguments: `{"path":"go.mod"}`}},
+			{Index: &one, ID: "b", Function: openai.FunctionCall{Name: "search"}},
+		}}, nil
+	})
+	var deltas int
+	completion, err := Generate(context.Background(), provider, openai.ChatCompletionRequest{Model: "m"}, func(string) { deltas++ })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(completion.ToolCalls) != 2 || completion.ToolCalls[0].Function.Arguments != `{"path":"go.mod"}` || completion.PromptTokens != 7 || deltas != 0 {
+		t.Errorf("Expected the tool calls and usage of the stream, got %+v after %d deltas", completion, deltas)
+	}
+
+	answer := completer{CompletionFunc(func(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error) {
+		return &Completion{Answer: "ok", Model: req.Model}, nil
+	})}
+	if completion, err := Generate(context.Background(), answer, openai.ChatCompletionRequest{Model: "m"}, nil); err != nil || completion.Answer != "ok" {
+		t.Errorf("Expected the completer asked directly, got %+v, %v", completion, err)
+	}
+
+	empty := CompletionFunc(func(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error) {
+		return &Completion{}, nil
+	})
+	if _, err := Generate(context.Background(), empty, openai.ChatCompletionRequest{Model: "m"}, func(string) {}); err == nil {
+		t.Error("Expected an error for an empty answer")
+	}
+}
@@ -0,0 +1,84 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// OpenAI is the Provider for OpenAI or an OpenAI-compatible gateway.
+type OpenAI struct {
+	Client *openai.Client
+}
+
+// NewOpenAI returns a provider asking client.
+func NewOpenAI(client *openai.Client) *OpenAI {
+	return &OpenAI{Client: client}
+}
+
+func (p *OpenAI) Complete(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error) {
+	resp, err := p.Client.CreateChatCompletion(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("no response from OpenAI")
+	}
+
+	return &Completion{
+		Answer:             resp.Choices[0].Message.Content,
+		ToolCalls:          resp.Choices[0].Message.ToolCalls,
+		Model:              req.Model,
+		PromptTokens:       resp.Usage.PromptTokens,
+		CompletionTokens:   resp.Usage.CompletionTokens,
+		CachedPromptTokens: cachedTokens(resp.Usage),
+	}, nil
+}
+
+func (p *OpenAI) Stream(ctx context.Context, req openai.ChatCompletionRequest) (DeltaStream, error) {
+	req.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+	stream, err := p.Client.CreateChatCompletionStream(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return &openAIStream{stream: stream}, nil
+}
+
+// cachedTokens is how many prompt tokens OpenAI served from its prompt
+// cache, which it does for a prompt prefix it has seen recently, such as the
+// earlier turns of a session.
+func cachedTokens(usage openai.Usage) int {
+	if usage.PromptTokensDetails == nil {
+		return 0
+	}
+	return usage.PromptTokensDetails.CachedTokens
+}
+
+type openAIStream struct {
+	stream *openai.ChatCompletionStream
+}
+
+func (s *openAIStream) Recv() (Delta, error) {
+	chunk, err := s.stream.Recv()
+	if err != nil {
+		return Delta{}, err
+	}
+	var delta Delta
+	// With include_usage the final chunk carries only the usage.
+	if chunk.Usage != nil {
+		delta.PromptTokens = chunk.Usage.PromptTokens
+		delta.CompletionTokens = chunk.Usage.CompletionTokens
+		delta.CachedPromptTokens = cachedTokens(*chunk.Usage)
+	}
+	if len(chunk.Choices) > 0 {
+		delta.Text = chunk.Choices[0].Delta.Content
+		delta.ToolCalls = chunk.Choices[0].Delta.ToolCalls
+	}
+	return delta, nil
+}
+
+func (s *openAIStream) Close() error {
+	return s.stream.Close()
+}
@@ -0,0 +1,274 @@
+// Package mcp holds the Model Context Protocol pieces of the escalator that
+// other programs can build on: the tool interfaces, the content tools
+// return, the JSON-RPC messages, middleware around tool calls, and a
+// server with its stdio and HTTP transports.
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Tool is an MCP tool. Call returns the tool's content blocks; an error
+// marks the result as an error, with the content explaining it.
+type Tool interface {
+	Name() string
+	Description() string
+	Schema() map[string]interface{}
+	Call(arguments map[string]interface{}) ([]map[string]interface{}, error)
+}
+
+// TextContent wraps text in a single MCP text content block.
+func TextContent(text string) []map[string]interface{} {
+	return []map[string]interface{}{
+		{
+			"type": "text",
+			"text": text,
+		},
+	}
+}
+
+// WithMeta attaches per-call metadata to a tool's content. Tools return only
+// content, so the metadata rides on the first block until the server moves
+// it into the result's _meta.
+func WithMeta(content []map[string]interface{}, meta map[string]interface{}) []map[string]interface{} {
+	if len(content) > 0 {
+		content[0]["_meta"] = meta
+	}
+	return content
+}
+
+// TakeMeta removes the metadata attached with WithMeta and returns it.
+func TakeMeta(content []map[string]interface{}) map[string]interface{} {
+	meta := make(map[string]interface{})
+	for _, block := range content {
+		if m, ok := block["_meta"].(map[string]interface{}); ok {
+			for key, value := range m {
+				meta[key] = value
+			}
+			delete(block, "_meta")
+		}
+	}
+	return meta
+}
+
+// WithStructuredContent attaches a tool's structured content, which rides
+// on the first block like metadata until the server moves it into the
+// result.
+func WithStructuredContent(content []map[string]interface{}, structured map[string]interface{}) []map[string]interface{} {
+	if len(content) > 0 {
+		content[0]["_structuredContent"] = structured
+	}
+	return content
+}
+
+// TakeStructuredContent removes the structured content attached with
+// WithStructuredContent and returns it, or nil if there is none.
+func TakeStructuredContent(content []map[string]interface{}) map[string]interface{} {
+	var structured map[string]interface{}
+	for _, block := range content {
+		if s, ok := block["_structuredContent"].(map[string]interface{}); ok {
+			structured = s
+			delete(block, "_structuredContent")
+		}
+	}
+	return structured
+}
+
+// StructuredTool is implemented by tools whose results carry structured
+// content, described by an output schema, alongside the text.
+type StructuredTool interface {
+	Tool
+	OutputSchema() map[string]interface{}
+}
+
+// CategorizedTool is implemented by tools that belong to a category in
+// tools/list. Categories nest with slashes, as in "code/review", so clients
+// can list a whole namespace or one branch of it.
+type CategorizedTool interface {
+	Tool
+	Category() string
+}
+
+// ContextTool is implemented by tools whose model calls should join the
+// caller's trace. CallContext behaves like CallStream, a nil onDelta
+// disabling streaming, and is preferred to both Call and CallStream.
+type ContextTool interface {
+	Tool
+	CallContext(ctx context.Context, arguments map[string]interface{}, onDelta func(string)) ([]map[string]interface{}, error)
+}
+
+// StreamingTool is implemented by tools that can report partial output
+// while a call is in progress.
+type StreamingTool interface {
+	Tool
+	CallStream(arguments map[string]interface{}, onDelta func(string)) ([]map[string]interface{}, error)
+}
+
+// JSON-RPC messages.
+
+// Request is a JSON-RPC request from the client.
+type Request struct {
+	Jsonrpc string          `json:"jsonrpc"`
+	ID      int             `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+}
+
+// Response answers a Request with a result or an error.
+type Response struct {
+	Jsonrpc string      `json:"jsonrpc"`
+	ID      int         `json:"id"`
+	Result  interface{} `json:"result,omitempty"`
+	Error   *RPCError   `json:"error,omitempty"`
+}
+
+// JSON-RPC error codes, and those MCP adds.
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+	// CodeServerError is the first of the codes reserved for servers.
+	CodeServerError      = -32000
+	CodeResourceNotFound = -32002
+)
+
+// RPCError is the error of a Response.
+type RPCError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// NewError returns an RPCError without data.
+func NewError(code int, message string) *RPCError {
+	return &RPCError{Code: code, Message: message}
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("%s (code %d)", e.Message, e.Code)
+}
+
+// Notification is a JSON-RPC message that expects no response.
+type Notification struct {
+	Jsonrpc string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+}
+
+// MCP results.
+
+// Implementation names an MCP client or server and its version.
+type Implementation struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// Capability marks a feature in ServerCapabilities. None of the features
+// the escalator offers have options, so it is always empty.
+type Capability struct{}
+
+// ServerCapabilities lists what a server offers; a nil field is a feature
+// it doesn't.
+type ServerCapabilities struct {
+	Tools     *Capability `json:"tools,omitempty"`
+	Logging   *Capability `json:"logging,omitempty"`
+	Resources *Capability `json:"resources,omitempty"`
+}
+
+// InitializeResult answers initialize.
+type InitializeResult struct {
+	ProtocolVersion string             `json:"protocolVersion"`
+	Capabilities    ServerCapabilities `json:"capabilities"`
+	ServerInfo      Implementation     `json:"serverInfo"`
+}
+
+// ToolDescriptor describes a tool in tools/list.
+type ToolDescriptor struct {
+	Name         string                 `json:"name"`
+	Description  string                 `json:"description"`
+	InputSchema  map[string]interface{} `json:"inputSchema"`
+	OutputSchema map[string]interface{} `json:"outputSchema,omitempty"`
+	Meta         map[string]interface{} `json:"_meta,omitempty"`
+}
+
+// ListToolsResult answers tools/list.
+type ListToolsResult struct {
+	Tools []ToolDescriptor       `json:"tools"`
+	Meta  map[string]interface{} `json:"_meta,omitempty"`
+}
+
+// CallToolResult answers tools/call. A tool's failure is a result with
+// IsError set, not an RPCError, so the model can read what went wrong.
+type CallToolResult struct {
+	Content           []map[string]interface{} `json:"content"`
+	StructuredContent map[string]interface{}   `json:"structuredContent,omitempty"`
+	IsError           bool                     `json:"isError,omitempty"`
+	Meta              map[string]interface{}   `json:"_meta,omitempty"`
+}
+
+// ErrorResult is a CallToolResult for a failed call, explained by content.
+func ErrorResult(content []map[string]interface{}) *CallToolResult {
+	return &CallToolResult{Content: content, IsError: true}
+}
+
+// Resource describes a resource in resources/list.
+type Resource struct {
+	URI         string `json:"uri"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+}
+
+// ListResourcesResult answers resources/list.
+type ListResourcesResult struct {
+	Resources []Resource `json:"resources"`
+}
+
+// ResourceContents is the text of a resource.
+type ResourceContents struct {
+	URI      string `json:"uri"`
+	MimeType string `json:"mimeType,omitempty"`
+	Text     string `json:"text"`
+}
+
+// ReadResourceResult answers resources/read.
+type ReadResourceResult struct {
+	Contents []ResourceContents `json:"contents"`
+}
+
+// CallTool runs tool, passing ctx to tools that take one so their work
+// joins its trace and cancellation, and streaming its output to onDelta
+// when onDelta is non-nil and it streams.
+func CallTool(ctx context.Context, tool Tool, arguments map[string]interface{}, onDelta func(string)) ([]map[string]interface{}, error) {
+	if traced, ok := tool.(ContextTool); ok {
+		return traced.CallContext(ctx, arguments, onDelta)
+	}
+	if streamer, ok := tool.(StreamingTool); ok && onDelta != nil {
+		return streamer.CallStream(arguments, onDelta)
+	}
+	return tool.Call(arguments)
+}
+
+// ToolHandler runs a tool call, streaming to onDelta when it is non-nil.
+type ToolHandler func(ctx context.Context, tool Tool, arguments map[string]interface{}, onDelta func(string)) ([]map[string]interface{}, error)
+
+// ToolMiddleware wraps a tool call. It can inspect or rewrite the
+// arguments, refuse the call, or post-process the content.
+type ToolMiddleware func(next ToolHandler) ToolHandler
+
+// Chain wraps CallTool in middleware, the first outermost.
+func Chain(middleware ...ToolMiddleware) ToolHandler {
+	return wrapTool(CallTool, middleware)
+}
+
+// wrapTool wraps handler in middleware, the first outermost.
+func wrapTool(handler ToolHandler, middleware []ToolMiddleware) ToolHandler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return handler
+}
@@ -0,0 +1,92 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type echoTool struct{}
+
+func (echoTool) Name() string                   { return "echo" }
+func (echoTool) Description() string            { return "Echo the text" }
+func (echoTool) Schema() map[string]interface{} { return map[string]interface{}{"type": "object"} }
+
+func (echoTool) Call(arguments map[string]interface{}) ([]map[string]interface{}, error) {
+	text, _ := arguments["text"].(string)
+	return WithMeta(TextContent(text), map[string]interface{}{"length": len(text)}), nil
+}
+
+func TestChain(t *testing.T) {
+	var order []string
+	trace := func(name string) ToolMiddleware {
+		return func(next ToolHandler) ToolHandler {
+			return func(ctx context.Context, tool Tool, arguments map[string]interface{}, onDelta func(string)) ([]map[string]interface{}, error) {
+				order = append(order, name)
+				return next(ctx, tool, arguments, onDelta)
+			}
+		}
+	}
+	shout := func(next ToolHandler) ToolHandler {
+		return func(ctx context.Context, tool Tool, arguments map[string]interface{}, onDelta func(string)) ([]map[string]interface{}, error) {
+			if arguments["text"] == "" {
+				return TextContent("Error: nothing to echo"), errors.New("empty text")
+			}
+			content, err := next(ctx, tool, arguments, onDelta)
+			content[0]["text"] = content[0]["text"].(string) + "!"
+			return content, err
+		}
+	}
+	call := Chain(trace("outer"), shout, trace("inner"))
+
+	content, err := call(context.Background(), echoTool{}, map[string]interface{}{"text": "hi"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta := TakeMeta(content)
+	if content[0]["text"] != "hi!" || meta["length"] != 2 || content[0]["_meta"] != nil {
+		t.Errorf("Expected the echo post-processed and its meta taken, got %v, %v", content, meta)
+	}
+	if !reflect.DeepEqual(order, []string{"outer", "inner"}) {
+		t.Errorf("Expected the first middleware outermost, got %v", order)
+	}
+
+	order = nil
+	if _, err := call(context.Background(), echoTool{}, map[string]interface{}{"text": ""}, nil); err == nil || !reflect.DeepEqual(order, []string{"outer"}) {
+		t.Errorf("Expected the call refused before the inner middleware, got %v, %v", err, order)
+	}
+}
+
+func TestResultsMarshal(t *testing.T) {
+	for _, tt := range []struct {
+		value interface{}
+		want  string
+	}{
+		{
+			InitializeResult{ProtocolVersion: "2025-06-18", Capabilities: ServerCapabilities{Tools: &Capability{}}, ServerInfo: Implementation{Name: "escalator", Version: "1.0.0"}},
+			`{"protocolVersion":"2025-06-18","capabilities":{"tools":{}},"serverInfo":{"name":"escalator","version":"1.0.0"}}`,
+		},
+		{
+			CallToolResult{Content: TextContent("hi")},
+			`{"content":[{"text":"hi","type":"text"}]}`,
+		},
+		{
+			ErrorResult(TextContent("no")),
+			`{"content":[{"text":"no","type":"text"}],"isError":true}`,
+		},
+		{
+			Response{Jsonrpc: "2.0", ID: 1, Error: NewError(CodeMethodNotFound, "Method not found")},
+			`{"jsonrpc":"2.0","id":1,"error":{"code":-32601,"message":"Method not found"}}`,
+		},
+	} {
+		got, err := json.Marshal(tt.value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("Expected %s, got %s", tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,371 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/dratner/code-escalator/pkg/llm"
+)
+
+// ProtocolVersions are the MCP revisions spoken here, oldest first.
+var ProtocolVersions = []string{"2024-11-05", "2025-03-26", "2025-06-18"}
+
+// DefaultProtocolVersion answers clients that don't name a revision.
+const DefaultProtocolVersion = "2025-03-26"
+
+// NegotiateProtocol picks the revision to answer a client asking for
+// requested: that revision when it is one of ProtocolVersions,
+// DefaultProtocolVersion when the client didn't say, and otherwise the
+// latest.
+func NegotiateProtocol(requested string) string {
+	switch {
+	case requested == "":
+		return DefaultProtocolVersion
+	case !slices.Contains(ProtocolVersions, requested):
+		return ProtocolVersions[len(ProtocolVersions)-1]
+	}
+	return requested
+}
+
+// Server is an MCP server other programs can embed: it lists and calls the
+// tools registered with it, through its middleware, over the stdio
+// transport with Serve or streamable HTTP with ServeHTTP, or over the
+// transports it was built with, with Run. The escalator's own server is
+// one, adding its methods with Wrap and its policies, such as rate limits,
+// with Intercept.
+type Server struct {
+	info Implementation
+
+	mu           sync.RWMutex
+	tools        map[string]Tool
+	middleware   []ToolMiddleware
+	interceptors []ToolMiddleware
+	requests     []RequestMiddleware
+	provider     llm.Provider
+	transports   []Transport
+}
+
+// RequestHandler answers a JSON-RPC request, sending notifications with
+// notify when it is non-nil.
+type RequestHandler func(ctx context.Context, req Request, notify func(method string, params interface{})) Response
+
+// RequestMiddleware wraps the server's answer to every request. It can
+// answer methods the server doesn't, refuse a request, or adapt the
+// answer.
+type RequestMiddleware func(next RequestHandler) RequestHandler
+
+// An Option configures a Server built with NewServer.
+type Option func(*Server)
+
+// WithTool registers tool, replacing any tool of the same name.
+func WithTool(tool Tool) Option {
+	return func(s *Server) { s.tools[tool.Name()] = tool }
+}
+
+// WithMiddleware wraps every tool call in mw. Middleware added first runs
+// outermost.
+func WithMiddleware(mw ToolMiddleware) Option {
+	return func(s *Server) { s.middleware = append(s.middleware, mw) }
+}
+
+// WithProvider gives the server's tools a model backend: every tool call's
+// context carries provider, for tools to take with llm.FromContext.
+func WithProvider(provider llm.Provider) Option {
+	return func(s *Server) { s.provider = provider }
+}
+
+// WithTransport adds a transport for Run to serve. A server built without
+// one runs over Stdio.
+func WithTransport(transport Transport) Option {
+	return func(s *Server) { s.transports = append(s.transports, transport) }
+}
+
+// NewServer returns a server introducing itself to clients as name and
+// version, configured by opts.
+func NewServer(name, version string, opts ...Option) *Server {
+	s := &Server{
+		info:  Implementation{Name: name, Version: version},
+		tools: make(map[string]Tool),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// RegisterTool adds tool, replacing any tool of the same name.
+func (s *Server) RegisterTool(tool Tool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tools[tool.Name()] = tool
+}
+
+// Use wraps every tool call in mw. Middleware added first runs outermost.
+func (s *Server) Use(mw ToolMiddleware) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.middleware = append(s.middleware, mw)
+}
+
+// Intercept wraps the tool calls clients make in mw, outside the
+// middleware. Unlike middleware, interceptors don't see the calls made with
+// CallTool, such as those of a tool calling others. Interceptors added
+// first run outermost, and one failing a call with an *RPCError fails the
+// request with it.
+func (s *Server) Intercept(mw ToolMiddleware) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.interceptors = append(s.interceptors, mw)
+}
+
+// Wrap runs every request through mw. Middleware added first runs
+// outermost.
+func (s *Server) Wrap(mw RequestMiddleware) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, mw)
+}
+
+// Tool returns the tool registered as name.
+func (s *Server) Tool(name string) (Tool, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	tool, ok := s.tools[name]
+	return tool, ok
+}
+
+// Tools returns the registered tools, in name order.
+func (s *Server) Tools() []Tool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	tools := make([]Tool, 0, len(s.tools))
+	for _, tool := range s.tools {
+		tools = append(tools, tool)
+	}
+	sort.Slice(tools, func(i, j int) bool { return tools[i].Name() < tools[j].Name() })
+	return tools
+}
+
+// CallTool runs tool through the server's middleware, with the server's
+// provider in ctx.
+func (s *Server) CallTool(ctx context.Context, tool Tool, arguments map[string]interface{}, onDelta func(string)) ([]map[string]interface{}, error) {
+	s.mu.RLock()
+	handler := wrapTool(CallTool, s.middleware)
+	provider := s.provider
+	s.mu.RUnlock()
+	if provider != nil {
+		ctx = llm.NewContext(ctx, provider)
+	}
+	return handler(ctx, tool, arguments, onDelta)
+}
+
+// ProcessRequest answers initialize, ping, tools/list and tools/call.
+func (s *Server) ProcessRequest(req Request) Response {
+	return s.Process(context.Background(), req, nil)
+}
+
+// Process answers req through the server's request middleware, sending
+// progress notifications with notify when it is non-nil and the caller
+// asked for them.
+func (s *Server) Process(ctx context.Context, req Request, notify func(method string, params interface{})) Response {
+	s.mu.RLock()
+	handler := RequestHandler(s.process)
+	for i := len(s.requests) - 1; i >= 0; i-- {
+		handler = s.requests[i](handler)
+	}
+	s.mu.RUnlock()
+	return handler(ctx, req, notify)
+}
+
+// process answers the methods the server knows.
+func (s *Server) process(ctx context.Context, req Request, notify func(method string, params interface{})) Response {
+	resp := Response{Jsonrpc: "2.0", ID: req.ID}
+	switch req.Method {
+	case "initialize":
+		resp.Result = s.initialize(req.Params)
+	case "ping":
+		resp.Result = struct{}{}
+	case "tools/list":
+		resp.Result = s.listTools()
+	case "tools/call":
+		result, err := s.callTool(ctx, req.Params, notify)
+		if err != nil {
+			resp.Error = err
+		} else {
+			resp.Result = result
+		}
+	default:
+		resp.Error = NewError(CodeMethodNotFound, "Method not found")
+	}
+	return resp
+}
+
+// initialize answers in the revision NegotiateProtocol picks for the
+// client.
+func (s *Server) initialize(params json.RawMessage) *InitializeResult {
+	var initParams struct {
+		ProtocolVersion string `json:"protocolVersion"`
+	}
+	json.Unmarshal(params, &initParams)
+	return &InitializeResult{
+		ProtocolVersion: NegotiateProtocol(initParams.ProtocolVersion),
+		Capabilities:    ServerCapabilities{Tools: &Capability{}},
+		ServerInfo:      s.info,
+	}
+}
+
+// listTools describes every tool, in name order.
+func (s *Server) listTools() *ListToolsResult {
+	registered := s.Tools()
+	tools := make([]ToolDescriptor, 0, len(registered))
+	for _, tool := range registered {
+		entry := ToolDescriptor{
+			Name:        tool.Name(),
+			Description: tool.Description(),
+			InputSchema: tool.Schema(),
+		}
+		if structured, ok := tool.(StructuredTool); ok {
+			entry.OutputSchema = structured.OutputSchema()
+		}
+		if categorized, ok := tool.(CategorizedTool); ok && categorized.Category() != "" {
+			entry.Meta = map[string]interface{}{"category": categorized.Category()}
+		}
+		tools = append(tools, entry)
+	}
+	return &ListToolsResult{Tools: tools}
+}
+
+// callTool runs a tools/call request. A tool's failure is a result marked
+// as an error, so the model can read what went wrong.
+func (s *Server) callTool(ctx context.Context, params json.RawMessage, notify func(method string, params interface{})) (*CallToolResult, *RPCError) {
+	var callParams struct {
+		Name      string                 `json:"name"`
+		Arguments map[string]interface{} `json:"arguments"`
+		Meta      struct {
+			ProgressToken interface{} `json:"progressToken"`
+		} `json:"_meta"`
+	}
+	if err := json.Unmarshal(params, &callParams); err != nil {
+		return nil, NewError(CodeInvalidParams, "Invalid params")
+	}
+	tool, ok := s.Tool(callParams.Name)
+	if !ok {
+		return nil, NewError(CodeInvalidParams, "Unknown tool")
+	}
+
+	var onDelta func(string)
+	if notify != nil && callParams.Meta.ProgressToken != nil {
+		progress := 0
+		onDelta = func(delta string) {
+			progress++
+			notify("notifications/progress", map[string]interface{}{
+				"progressToken": callParams.Meta.ProgressToken,
+				"progress":      progress,
+				"message":       delta,
+			})
+		}
+	}
+	s.mu.RLock()
+	call := wrapTool(s.CallTool, s.interceptors)
+	s.mu.RUnlock()
+	content, err := call(ctx, tool, callParams.Arguments, onDelta)
+	meta := TakeMeta(content)
+	structured := TakeStructuredContent(content)
+	var rpcErr *RPCError
+	if errors.As(err, &rpcErr) {
+		return nil, rpcErr
+	}
+	if err != nil {
+		slog.WarnContext(ctx, "Tool call failed", "tool", tool.Name(), "error", err)
+		if len(content) == 0 {
+			content = TextContent("Error: " + err.Error())
+		}
+		return ErrorResult(content), nil
+	}
+
+	result := &CallToolResult{Content: content}
+	if _, ok := tool.(StructuredTool); ok {
+		result.StructuredContent = structured
+	}
+	if len(meta) > 0 {
+		result.Meta = meta
+	}
+	return result, nil
+}
+
+// Serve runs the server over a pair of streams, such as stdin and stdout,
+// until r is exhausted.
+func (s *Server) Serve(r io.Reader, w io.Writer) {
+	stream := NewStream(w)
+	stream.Serve(r, connection{server: s, stream: stream})
+}
+
+// connection answers the requests of one stdio client, sending it the
+// progress of its calls.
+type connection struct {
+	server *Server
+	stream *Stream
+}
+
+func (c connection) ProcessRequest(req Request) Response {
+	return c.server.Process(context.Background(), req, c.stream.Notify)
+}
+
+// ServeHTTP is MCP's streamable HTTP transport, without server-sent
+// events: each POST carries a message or a batch, and the answers to its
+// requests come back as JSON. A POST of only notifications or responses is
+// accepted with 202.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "malformed request", http.StatusBadRequest)
+		return
+	}
+
+	batch := jsonBatch(body)
+	messages := batch
+	if messages == nil {
+		messages = []json.RawMessage{body}
+	}
+	var responses []Response
+	for _, raw := range messages {
+		var req struct {
+			Request
+			RawID json.RawMessage `json:"id"`
+		}
+		if err := json.Unmarshal(raw, &req); err != nil {
+			responses = append(responses, Response{Jsonrpc: "2.0", Error: NewError(CodeParseError, "Parse error")})
+			continue
+		}
+		// Notifications carry no id, and responses no method; neither is
+		// answered.
+		if len(req.RawID) == 0 || req.Method == "" {
+			continue
+		}
+		json.Unmarshal(req.RawID, &req.ID)
+		responses = append(responses, s.Process(r.Context(), req.Request, nil))
+	}
+	if len(responses) == 0 {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if batch != nil {
+		json.NewEncoder(w).Encode(responses)
+		return
+	}
+	json.NewEncoder(w).Encode(responses[0])
+}
@@ -0,0 +1,293 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dratner/code-escalator/pkg/llm"
+	"github.com/sashabaranov/go-openai"
+)
+
+// streamingEcho echoes its text a word at a time before answering.
+type streamingEcho struct{ echoTool }
+
+func (streamingEcho) CallContext(ctx context.Context, arguments map[string]interface{}, onDelta func(string)) ([]map[string]interface{}, error) {
+	text, _ := arguments["text"].(string)
+	if text == "" {
+		return nil, errors.New("nothing to echo")
+	}
+	if onDelta != nil {
+		for _, word := range strings.Fields(text) {
+			onDelta(word)
+		}
+	}
+	return TextContent(text), nil
+}
+
+func TestServer_Serve(t *testing.T) {
+	server := NewServer("embedded", "1.0")
+	server.RegisterTool(streamingEcho{})
+
+	clientIn, serverOut := io.Pipe()
+	serverIn, clientOut := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		server.Serve(serverIn, serverOut)
+		serverOut.Close()
+		close(done)
+	}()
+	lines := bufio.NewScanner(clientIn)
+	send := func(message string) {
+		if _, err := io.WriteString(clientOut, message+"\n"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	next := func() map[string]interface{} {
+		if !lines.Scan() {
+			t.Fatalf("Expected a message, got %v", lines.Err())
+		}
+		var message map[string]interface{}
+		json.Unmarshal(lines.Bytes(), &message)
+		return message
+	}
+
+	send(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2024-11-05"}}`)
+	init := next()["result"].(map[string]interface{})
+	if init["protocolVersion"] != "2024-11-05" || init["serverInfo"].(map[string]interface{})["name"] != "embedded" {
+		t.Errorf("Expected the client's revision and the server's name, got %v", init)
+	}
+
+	send(`{"jsonrpc":"2.0","method":"notifications/initialized"}`)
+	send(`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`)
+	tools := next()["result"].(map[string]interface{})["tools"].([]interface{})
+	if len(tools) != 1 || tools[0].(map[string]interface{})["name"] != "echo" {
+		t.Errorf("Expected the echo tool listed, got %v", tools)
+	}
+
+	send(`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"echo","arguments":{"text":"hello there"},"_meta":{"progressToken":"p"}}}`)
+	var progress []string
+	for {
+		message := next()
+		if message["method"] == "notifications/progress" {
+			progress = append(progress, message["params"].(map[string]interface{})["message"].(string))
+			continue
+		}
+		text := message["result"].(map[string]interface{})["content"].([]interface{})[0].(map[string]interface{})["text"]
+		if text != "hello there" {
+			t.Errorf("Expected the echoed text, got %v", message)
+		}
+		break
+	}
+	if strings.Join(progress, " ") != "hello there" {
+		t.Errorf("Expected a progress notification per word, got %v", progress)
+	}
+
+	send(`{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"echo","arguments":{}}}`)
+	if result := next()["result"].(map[string]interface{}); result["isError"] != true {
+		t.Errorf("Expected a failed call to be an error result, got %v", result)
+	}
+
+	send(`{"jsonrpc":"2.0","id":5,"method":"tools/call","params":{"name":"missing"}}`)
+	if rpcErr := next()["error"].(map[string]interface{}); rpcErr["code"] != float64(CodeInvalidParams) {
+		t.Errorf("Expected an unknown tool to be invalid params, got %v", rpcErr)
+	}
+
+	clientOut.Close()
+	<-done
+}
+
+func TestServer_Middleware(t *testing.T) {
+	server := NewServer("embedded", "1.0")
+	server.RegisterTool(echoTool{})
+	server.Use(func(next ToolHandler) ToolHandler {
+		return func(ctx context.Context, tool Tool, arguments map[string]interface{}, onDelta func(string)) ([]map[string]interface{}, error) {
+			arguments["text"] = strings.ToUpper(arguments["text"].(string))
+			return next(ctx, tool, arguments, onDelta)
+		}
+	})
+
+	resp := server.ProcessRequest(Request{Jsonrpc: "2.0", ID: 1, Method: "tools/call", Params: json.RawMessage(`{"name":"echo","arguments":{"text":"quiet"}}`)})
+	result := resp.Result.(*CallToolResult)
+	if result.Content[0]["text"] != "QUIET" || result.Meta["length"] != 5 {
+		t.Errorf("Expected the middleware to rewrite the arguments and the meta to be kept, got %+v", result)
+	}
+}
+
+func TestServer_WrapAndIntercept(t *testing.T) {
+	server := NewServer("embedded", "1.0")
+	server.RegisterTool(echoTool{})
+	server.Wrap(func(next RequestHandler) RequestHandler {
+		return func(ctx context.Context, req Request, notify func(method string, params interface{})) Response {
+			if req.Method == "resources/list" {
+				return Response{Jsonrpc: "2.0", ID: req.ID, Result: &ListResourcesResult{}}
+			}
+			return next(ctx, req, notify)
+		}
+	})
+	server.Intercept(func(next ToolHandler) ToolHandler {
+		return func(ctx context.Context, tool Tool, arguments map[string]interface{}, onDelta func(string)) ([]map[string]interface{}, error) {
+			if arguments["text"] == "too much" {
+				return nil, &RPCError{Code: -32029, Message: "Rate limit exceeded"}
+			}
+			return next(ctx, tool, arguments, onDelta)
+		}
+	})
+
+	if resp := server.ProcessRequest(Request{Jsonrpc: "2.0", ID: 1, Method: "resources/list"}); resp.Error != nil {
+		t.Errorf("Expected the wrapped method answered, got %+v", resp.Error)
+	}
+	resp := server.ProcessRequest(Request{Jsonrpc: "2.0", ID: 2, Method: "tools/call", Params: json.RawMessage(`{"name":"echo","arguments":{"text":"too much"}}`)})
+	if resp.Error == nil || resp.Error.Code != -32029 {
+		t.Errorf("Expected the interceptor's error to fail the request, got %+v", resp)
+	}
+
+	// Calls made with CallTool skip the interceptors.
+	content, err := server.CallTool(context.Background(), echoTool{}, map[string]interface{}{"text": "too much"}, nil)
+	if err != nil || content[0]["text"] != "too much" {
+		t.Errorf("Expected CallTool to skip the interceptors, got %v, %v", content, err)
+	}
+}
+
+func TestNegotiateProtocol(t *testing.T) {
+	for requested, want := range map[string]string{
+		"2024-11-05": "2024-11-05",
+		"2099-01-01": "2025-06-18",
+		"":           DefaultProtocolVersion,
+	} {
+		if got := NegotiateProtocol(requested); got != want {
+			t.Errorf("Client asking for %q: expected %s, got %s", requested, want, got)
+		}
+	}
+}
+
+// modelTool answers with the model it was given through the context.
+type modelTool struct{ echoTool }
+
+func (modelTool) CallContext(ctx context.Context, arguments map[string]interface{}, onDelta func(string)) ([]map[string]interface{}, error) {
+	provider, ok := llm.FromContext(ctx)
+	if !ok {
+		return nil, errors.New("no provider")
+	}
+	completion, err := llm.Generate(ctx, provider, openai.ChatCompletionRequest{Model: "m"}, onDelta)
+	if err != nil {
+		return nil, err
+	}
+	return TextContent(completion.Answer), nil
+}
+
+func TestNewServer_Options(t *testing.T) {
+	provider := llm.CompletionFunc(func(ctx context.Context, req openai.ChatCompletionRequest) (*llm.Completion, error) {
+		return &llm.Completion{Answer: "from the model"}, nil
+	})
+	var calls []string
+	in := strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"echo","arguments":{}}}` + "\n")
+	var out strings.Builder
+	server := NewServer("embedded", "1.0",
+		WithTool(modelTool{}),
+		WithMiddleware(func(next ToolHandler) ToolHandler {
+			return func(ctx context.Context, tool Tool, arguments map[string]interface{}, onDelta func(string)) ([]map[string]interface{}, error) {
+				calls = append(calls, tool.Name())
+				return next(ctx, tool, arguments, onDelta)
+			}
+		}),
+		WithProvider(provider),
+		WithTransport(Streams(in, &out)),
+	)
+
+	if err := server.Run(context.Background()); err != nil {
+		t.Fatalf("Expected Run to stop cleanly once the input ends, got %v", err)
+	}
+	if !strings.Contains(out.String(), "from the model") || len(calls) != 1 {
+		t.Errorf("Expected the call answered by the provider through the middleware, got %q after %v", out.String(), calls)
+	}
+}
+
+func TestServer_ServeHTTP(t *testing.T) {
+	server := NewServer("embedded", "1.0")
+	server.RegisterTool(echoTool{})
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	post := func(body string) *http.Response {
+		resp, err := http.Post(ts.URL, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	resp := post(`{"jsonrpc":"2.0","id":7,"method":"tools/call","params":{"name":"echo","arguments":{"text":"over http"}}}`)
+	var answer Response
+	json.NewDecoder(resp.Body).Decode(&answer)
+	resp.Body.Close()
+	if answer.ID != 7 || !strings.Contains(jsonString(answer.Result), "over http") {
+		t.Errorf("Expected the call answered, got %+v", answer)
+	}
+
+	resp = post(`[{"jsonrpc":"2.0","id":1,"method":"ping"},{"jsonrpc":"2.0","id":2,"method":"nope"}]`)
+	var answers []Response
+	json.NewDecoder(resp.Body).Decode(&answers)
+	resp.Body.Close()
+	if len(answers) != 2 || answers[0].Error != nil || answers[1].Error == nil || answers[1].Error.Code != CodeMethodNotFound {
+		t.Errorf("Expected a batch answered in one array, got %+v", answers)
+	}
+
+	resp = post(`{"jsonrpc":"2.0","method":"notifications/initialized"}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Errorf("Expected a notification accepted with 202, got %d", resp.StatusCode)
+	}
+}
+
+func jsonString(v interface{}) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// refusingHandler refuses batches and drains, answering nothing itself.
+type refusingHandler struct{}
+
+func (refusingHandler) ProcessRequest(req Request) Response {
+	return Response{Jsonrpc: "2.0", ID: req.ID, Result: "ok"}
+}
+func (refusingHandler) AcceptsBatches() bool { return false }
+func (refusingHandler) BeginRequest() bool   { return false }
+func (refusingHandler) EndRequest()          {}
+
+func TestStream_Serve(t *testing.T) {
+	var out strings.Builder
+	in := strings.NewReader(`[{"jsonrpc":"2.0","id":1,"method":"ping"}]` + "\n" + `{"jsonrpc":"2.0","id":2,"method":"ping"}` + "\n")
+	NewStream(&out).Serve(in, refusingHandler{})
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], "Invalid Request") || !strings.Contains(lines[1], "Server is shutting down") {
+		t.Errorf("Expected the batch refused and the request turned away while draining, got %q", out.String())
+	}
+}
+
+func TestStream_Request(t *testing.T) {
+	clientIn, serverOut := io.Pipe()
+	serverIn, clientOut := io.Pipe()
+	stream := NewStream(serverOut)
+	go stream.Serve(serverIn, refusingHandler{})
+
+	// The client answers the server's request with the method it was sent.
+	go func() {
+		var req Request
+		json.NewDecoder(clientIn).Decode(&req)
+		io.WriteString(clientOut, `{"jsonrpc":"2.0","id":`+jsonString(req.ID)+`,"result":"`+req.Method+`"}`+"\n")
+	}()
+	result, err := stream.Request(context.Background(), "roots/list", nil)
+	if err != nil || string(result) != `"roots/list"` {
+		t.Errorf("Expected the client's response, got %s, %v", result, err)
+	}
+
+	clientOut.Close()
+}
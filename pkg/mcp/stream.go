@@ -0,0 +1,266 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+)
+
+// Handler answers the JSON-RPC requests a transport reads. Transports call
+// ProcessRequest concurrently, so a running tool can itself send requests
+// to the client and wait for the responses.
+type Handler interface {
+	ProcessRequest(req Request) Response
+}
+
+// BatchHandler is implemented by handlers that decide whether JSON-RPC
+// batches are accepted, as they are by revisions before 2025-06-18.
+// Batches are accepted from handlers without it.
+type BatchHandler interface {
+	Handler
+	AcceptsBatches() bool
+}
+
+// DrainingHandler is implemented by handlers that shut down gracefully.
+// BeginRequest reports false once the handler is draining, and the request
+// is answered with an error instead; EndRequest follows each request that
+// began.
+type DrainingHandler interface {
+	Handler
+	BeginRequest() bool
+	EndRequest()
+}
+
+// Stream is the stdio transport: JSON-RPC messages, one per line, over a
+// pair of streams. It carries the server's notifications and requests to
+// the client as well as the answers to the client's requests, and is safe
+// for concurrent use.
+type Stream struct {
+	writeMu sync.Mutex
+	encoder *json.Encoder
+
+	pendingMu sync.Mutex
+	pending   map[int]chan streamReply
+	nextID    int
+}
+
+// streamReply is the client's answer to a server-initiated request.
+type streamReply struct {
+	result json.RawMessage
+	err    error
+}
+
+// NewStream returns a Stream writing to w. Serve reads the other half.
+func NewStream(w io.Writer) *Stream {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	return &Stream{encoder: encoder, pending: make(map[int]chan streamReply)}
+}
+
+// Write sends one JSON-RPC message, or a batch of them.
+func (s *Stream) Write(v interface{}) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	return s.encoder.Encode(v)
+}
+
+// Notify sends a notification to the client, logging a failure to write it.
+func (s *Stream) Notify(method string, params interface{}) {
+	if err := s.Write(Notification{Jsonrpc: "2.0", Method: method, Params: params}); err != nil {
+		slog.Error("Failed to write JSON-RPC notification", "method", method, "error", err)
+	}
+}
+
+// Request sends a request to the client and waits for its response, until
+// ctx is done or the client disconnects.
+func (s *Stream) Request(ctx context.Context, method string, params interface{}) (json.RawMessage, error) {
+	rawParams, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+
+	s.pendingMu.Lock()
+	s.nextID++
+	id := s.nextID
+	reply := make(chan streamReply, 1)
+	s.pending[id] = reply
+	s.pendingMu.Unlock()
+
+	defer func() {
+		s.pendingMu.Lock()
+		delete(s.pending, id)
+		s.pendingMu.Unlock()
+	}()
+
+	if err := s.Write(Request{Jsonrpc: "2.0", ID: id, Method: method, Params: rawParams}); err != nil {
+		return nil, err
+	}
+
+	select {
+	case r := <-reply:
+		return r.result, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// route delivers a client's response to the request waiting for it and
+// drops notifications, returning the requests left to process.
+func (s *Stream) route(raw json.RawMessage) *Request {
+	var envelope struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+		Result json.RawMessage `json:"result"`
+		Error  *RPCError       `json:"error"`
+	}
+	if err := json.Unmarshal(raw, &envelope); err != nil {
+		slog.Warn("Error decoding JSON-RPC", "error", err)
+		return nil
+	}
+
+	// A message without a method is the client's response to one of our
+	// requests.
+	if envelope.Method == "" {
+		var id int
+		json.Unmarshal(envelope.ID, &id)
+		s.pendingMu.Lock()
+		reply, ok := s.pending[id]
+		s.pendingMu.Unlock()
+		if !ok {
+			slog.Warn("Got response for unknown request", "id", string(envelope.ID))
+			return nil
+		}
+		if envelope.Error != nil {
+			reply <- streamReply{err: fmt.Errorf("client error %d: %s", envelope.Error.Code, envelope.Error.Message)}
+		} else {
+			reply <- streamReply{result: envelope.Result}
+		}
+		return nil
+	}
+
+	// Notifications carry no id and must not be answered.
+	if len(envelope.ID) == 0 {
+		slog.Debug("Got notification", "method", envelope.Method)
+		return nil
+	}
+
+	var req Request
+	if err := json.Unmarshal(raw, &req); err != nil {
+		slog.Warn("Error decoding JSON-RPC", "error", err)
+		return nil
+	}
+	return &req
+}
+
+// Serve reads the client's messages from r until it is exhausted, answering
+// each request with h, then fails the requests still waiting on the client
+// and waits for the answers in progress.
+func (s *Stream) Serve(r io.Reader, h Handler) {
+	decoder := json.NewDecoder(r)
+	drainer, _ := h.(DrainingHandler)
+	begin := func() bool { return drainer == nil || drainer.BeginRequest() }
+	end := func() {
+		if drainer != nil {
+			drainer.EndRequest()
+		}
+	}
+
+	var wg sync.WaitGroup
+	for {
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			if err == io.EOF {
+				break
+			}
+			slog.Warn("Error decoding JSON-RPC", "error", err)
+			continue
+		}
+
+		// Revisions before 2025-06-18 may batch messages; the requests in
+		// a batch are answered together, in one array.
+		if batch := jsonBatch(raw); batch != nil {
+			if batcher, ok := h.(BatchHandler); len(batch) == 0 || ok && !batcher.AcceptsBatches() {
+				if err := s.Write(Response{Jsonrpc: "2.0", Error: NewError(CodeInvalidRequest, "Invalid Request")}); err != nil {
+					slog.Error("Failed to write JSON-RPC response", "error", err)
+				}
+				continue
+			}
+			started := begin()
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if started {
+					defer end()
+				}
+				var responses []Response
+				for _, raw := range batch {
+					if req := s.route(raw); req != nil && started {
+						responses = append(responses, h.ProcessRequest(*req))
+					} else if req != nil {
+						responses = append(responses, shuttingDown(*req))
+					}
+				}
+				if len(responses) == 0 {
+					return
+				}
+				if err := s.Write(responses); err != nil {
+					slog.Error("Failed to write JSON-RPC batch response", "error", err)
+				}
+			}()
+			continue
+		}
+
+		req := s.route(raw)
+		if req == nil {
+			continue
+		}
+
+		if !begin() {
+			if err := s.Write(shuttingDown(*req)); err != nil {
+				slog.Error("Failed to write JSON-RPC response", "method", req.Method, "error", err)
+			}
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer end()
+			resp := h.ProcessRequest(*req)
+			if err := s.Write(resp); err != nil {
+				slog.Error("Failed to write JSON-RPC response", "method", req.Method, "error", err)
+			}
+		}()
+	}
+
+	// The client is gone, so fail any request still waiting on it.
+	s.pendingMu.Lock()
+	for id, reply := range s.pending {
+		reply <- streamReply{err: fmt.Errorf("client disconnected")}
+		delete(s.pending, id)
+	}
+	s.pendingMu.Unlock()
+
+	wg.Wait()
+}
+
+// jsonBatch returns the messages of a JSON-RPC batch, or nil when raw is a
+// single message.
+func jsonBatch(raw []byte) []json.RawMessage {
+	if trimmed := bytes.TrimLeft(raw, " \t\r\n"); len(trimmed) == 0 || trimmed[0] != '[' {
+		return nil
+	}
+	var batch []json.RawMessage
+	if json.Unmarshal(raw, &batch) != nil {
+		return nil
+	}
+	return batch
+}
+
+// shuttingDown answers a request that arrived while the server drains.
+func shuttingDown(req Request) Response {
+	return Response{Jsonrpc: "2.0", ID: req.ID, Error: NewError(CodeServerError, "Server is shutting down")}
+}
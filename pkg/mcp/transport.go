@@ -0,0 +1,107 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+// A Transport carries a Server's messages to its clients. Serve runs until
+// the transport closes or ctx is done.
+type Transport interface {
+	Serve(ctx context.Context, server *Server) error
+}
+
+// Stdio serves one client over the process's stdin and stdout, the way
+// MCP clients run local servers.
+func Stdio() Transport {
+	return Streams(os.Stdin, os.Stdout)
+}
+
+// Streams serves one client over a pair of streams until r is exhausted.
+func Streams(r io.Reader, w io.Writer) Transport {
+	return streamTransport{r: r, w: w}
+}
+
+type streamTransport struct {
+	r io.Reader
+	w io.Writer
+}
+
+// Serve returns when r is exhausted, or without waiting for the read in
+// progress when ctx is done.
+func (t streamTransport) Serve(ctx context.Context, server *Server) error {
+	done := make(chan struct{})
+	go func() {
+		server.Serve(t.r, t.w)
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// HTTP serves MCP's streamable HTTP transport at /mcp on addr.
+func HTTP(addr string) Transport {
+	return httpTransport{addr: addr}
+}
+
+type httpTransport struct {
+	addr string
+}
+
+// httpShutdownTimeout is how long the calls in progress get to finish once
+// the HTTP transport is stopped.
+const httpShutdownTimeout = 10 * time.Second
+
+func (t httpTransport) Serve(ctx context.Context, server *Server) error {
+	mux := http.NewServeMux()
+	mux.Handle("/mcp", server)
+	httpServer := &http.Server{Addr: t.addr, Handler: mux}
+
+	stopped := make(chan error, 1)
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), httpShutdownTimeout)
+		defer cancel()
+		stopped <- httpServer.Shutdown(shutdownCtx)
+	}()
+	if err := httpServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return <-stopped
+}
+
+// Run serves the server over its transports, or Stdio if it was built
+// without any, until ctx is done or one of them stops, which stops the
+// others.
+func (s *Server) Run(ctx context.Context) error {
+	transports := s.transports
+	if len(transports) == 0 {
+		transports = []Transport{Stdio()}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stopped := make(chan error, len(transports))
+	for _, transport := range transports {
+		go func() {
+			stopped <- transport.Serve(ctx, s)
+		}()
+	}
+	err := <-stopped
+	cancel()
+	for range transports[1:] {
+		<-stopped
+	}
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
+}
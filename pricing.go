@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+)
+
+// modelPrice is the list price in US dollars per million tokens.
+type modelPrice struct {
+	input  float64
+	output float64
+}
+
+// modelPrices lists OpenAI list prices for common models. Dated snapshots
+// (e.g. gpt-4o-2024-08-06) are matched by their family prefix.
+var modelPrices = map[string]modelPrice{
+	"o3":           {2.00, 8.00},
+	"o3-mini":      {1.10, 4.40},
+	"o4-mini":      {1.10, 4.40},
+	"o1":           {15.00, 60.00},
+	"gpt-4o":       {2.50, 10.00},
+	"gpt-4o-mini":  {0.15, 0.60},
+	"gpt-4.1":      {2.00, 8.00},
+	"gpt-4.1-mini": {0.40, 1.60},
+	"gpt-4.1-nano": {0.10, 0.40},
+}
+
+// longestModelPrefix finds the longest key of table that names model or a
+// dated snapshot of it, so "gpt-4o-mini-2024-07-18" matches gpt-4o-mini
+// rather than gpt-4o. It returns "" when nothing matches.
+func longestModelPrefix[V any](model string, table map[string]V) string {
+	best := ""
+	for name := range table {
+		if (model == name || strings.HasPrefix(model, name+"-")) && len(name) > len(best) {
+			best = name
+		}
+	}
+	return best
+}
+
+// priceFor returns the price of model, if known.
+func priceFor(model string) (modelPrice, bool) {
+	name := longestModelPrefix(model, modelPrices)
+	if name == "" {
+		return modelPrice{}, false
+	}
+	return modelPrices[name], true
+}
+
+// estimateCost returns the estimated dollar cost of a call, or 0 for models
+// without a known price.
+func estimateCost(model string, promptTokens, completionTokens int) float64 {
+	price, ok := priceFor(model)
+	if !ok {
+		return 0
+	}
+	return (float64(promptTokens)*price.input + float64(completionTokens)*price.output) / 1_000_000
+}
+
+// TokenUsage is the token count and estimated cost of one tool call, which
+// may span several model calls.
+type TokenUsage struct {
+	Model            string  `json:"model,omitempty"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	TotalTokens      int     `json:"total_tokens"`
+	CostUSD          float64 `json:"cost_usd"`
+	Cached           bool    `json:"cached,omitempty"`
+	// CachedPromptTokens of the prompt tokens were served from the
+	// provider's prompt cache. The cost is at list price regardless.
+	CachedPromptTokens int `json:"cached_prompt_tokens,omitempty"`
+	// Shared is set when the answer came from an identical escalation
+	// already in flight, whose call the tokens are counted with.
+	Shared bool `json:"shared,omitempty"`
+
+	calls int
+}
+
+// add counts a model call towards the usage. The model is kept only while
+// every call used the same one.
+func (u *TokenUsage) add(c *Completion) {
+	if u.calls == 0 {
+		u.Model = c.Model
+	} else if u.Model != c.Model {
+		u.Model = ""
+	}
+	u.calls++
+	u.PromptTokens += c.PromptTokens
+	u.CachedPromptTokens += c.CachedPromptTokens
+	u.CompletionTokens += c.CompletionTokens
+	u.TotalTokens += c.PromptTokens + c.CompletionTokens
+	u.CostUSD += estimateCost(c.Model, c.PromptTokens, c.CompletionTokens)
+}
+
+// addUsage counts the model calls of another tool call towards u.
+func (u *TokenUsage) addUsage(other *TokenUsage) {
+	if other == nil || other.calls == 0 {
+		return
+	}
+	if u.calls == 0 {
+		u.Model = other.Model
+	} else if u.Model != other.Model {
+		u.Model = ""
+	}
+	u.calls += other.calls
+	u.PromptTokens += other.PromptTokens
+	u.CachedPromptTokens += other.CachedPromptTokens
+	u.CompletionTokens += other.CompletionTokens
+	u.TotalTokens += other.TotalTokens
+	u.CostUSD += other.CostUSD
+}
+
+// usageOf returns the usage of a single model call.
+func usageOf(c *Completion) *TokenUsage {
+	u := &TokenUsage{}
+	u.add(c)
+	return u
+}
+
+// severalModels stands in for the model of usage summed over calls to more
+// than one.
+const severalModels = "several models"
+
+// logUsage writes a tool call's token usage and estimated cost to the log.
+func logUsage(ctx context.Context, tool string, u *TokenUsage) {
+	model := u.Model
+	if model == "" {
+		model = severalModels
+	}
+	slog.InfoContext(ctx, "Token usage", "tool", tool, "model", model, "prompt_tokens", u.PromptTokens, "completion_tokens", u.CompletionTokens, "cost_usd", u.CostUSD)
+}
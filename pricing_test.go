@@ -0,0 +1,33 @@
+package main
+
+import "testing"
+
+func TestEstimateCost(t *testing.T) {
+	// o3: $2 per million prompt tokens, $8 per million completion tokens.
+	if got := estimateCost("o3", 1_000_000, 500_000); got != 6 {
+		t.Errorf("Expected $6, got %v", got)
+	}
+	// Dated snapshots are priced like their base model, and the longest
+	// prefix wins over shorter ones.
+	if got, want := estimateCost("gpt-4o-mini-2024-07-18", 1_000_000, 0), 0.15; got != want {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+	if got := estimateCost("unknown-model", 1000, 1000); got != 0 {
+		t.Errorf("Expected unknown models to cost 0, got %v", got)
+	}
+}
+
+func TestTokenUsage_Add(t *testing.T) {
+	usage := usageOf(&Completion{Model: "o3", PromptTokens: 1_000_000, CompletionTokens: 500_000})
+	if usage.Model != "o3" || usage.TotalTokens != 1_500_000 || usage.CostUSD != 6 {
+		t.Errorf("Unexpected usage: %+v", usage)
+	}
+
+	usage.add(&Completion{Model: "gpt-4o", PromptTokens: 1_000_000})
+	if usage.Model != "" {
+		t.Errorf("Expected model to be cleared for mixed calls, got %q", usage.Model)
+	}
+	if usage.PromptTokens != 2_000_000 || usage.CostUSD != 8.5 {
+		t.Errorf("Expected usage to accumulate, got %+v", usage)
+	}
+}
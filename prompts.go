@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// promptTokenBudget is the largest prompt, in estimated tokens, that a
+// template may render for a fixture.
+const promptTokenBudget = 20000
+
+// promptTemplate describes a prompt the escalator sends so it can be rendered
+// and linted against fixture inputs without calling a model.
+type promptTemplate struct {
+	name string
+	// required lists the fixture inputs that must appear in the rendered
+	// prompt; a missing one means a placeholder was dropped.
+	required []string
+	render   func(help *GetHelpTool, inputs map[string]string) (string, error)
+	// call runs the tool that sends the prompt, with help's model.
+	call func(help *GetHelpTool, inputs map[string]string) ([]map[string]interface{}, error)
+}
+
+var promptTemplates = []promptTemplate{
+	{
+		name:     "get_help",
+		required: []string{"summary", "question", "relevant_code"},
+		render: func(help *GetHelpTool, inputs map[string]string) (string, error) {
+			return help.buildPrompt(inputs["summary"], inputs["question"], inputs["relevant_code"])
+		},
+		call: func(help *GetHelpTool, inputs map[string]string) ([]map[string]interface{}, error) {
+			return help.Call(map[string]interface{}{"summary": inputs["summary"], "question": inputs["question"], "relevant_code": inputs["relevant_code"]})
+		},
+	},
+	{
+		name:     "brainstorm_options",
+		required: []string{"problem", "summary", "constraints"},
+		render: func(help *GetHelpTool, inputs map[string]string) (string, error) {
+			return buildBrainstormPrompt(inputs["problem"], inputs["summary"], inputs["constraints"], defaultBrainstormOptions), nil
+		},
+		call: func(help *GetHelpTool, inputs map[string]string) ([]map[string]interface{}, error) {
+			return NewBrainstormTool(help.LLM()).Call(map[string]interface{}{"problem": inputs["problem"], "summary": inputs["summary"], "constraints": inputs["constraints"]})
+		},
+	},
+}
+
+// promptFixture is one set of inputs for a template, loaded from a JSON file
+// in the fixtures directory. With a Response, the tool is also run against a
+// stub provider that gives that answer, to check what the tool makes of it.
+type promptFixture struct {
+	Name     string            `json:"name"`
+	Template string            `json:"template"`
+	Inputs   map[string]string `json:"inputs"`
+	Response string            `json:"response,omitempty"`
+}
+
+// defaultPromptFixtures are used when no fixtures directory is given.
+var defaultPromptFixtures = []promptFixture{
+	{
+		Name:     "basic",
+		Template: "get_help",
+		Inputs: map[string]string{
+			"summary":       "# Example Service\nA Go HTTP API backed by PostgreSQL.",
+			"question":      "Why does the connection pool run out under load?",
+			"relevant_code": "db.SetMaxOpenConns(5)",
+		},
+		Response: "Five connections can't serve the concurrent requests, so callers queue for one. Raise SetMaxOpenConns to match the request concurrency and set SetConnMaxIdleTime.\nCONFIDENCE: high",
+	},
+	{
+		Name:     "basic",
+		Template: "brainstorm_options",
+		Inputs: map[string]string{
+			"problem":     "How should we cache user profiles?",
+			"summary":     "A Go HTTP API backed by PostgreSQL.",
+			"constraints": "No new infrastructure",
+		},
+		Response: `{"options":[{"rank":1,"title":"In-process LRU","summary":"Cache profiles in memory per instance.","pros":["No new infrastructure"],"cons":["Per-instance staleness"]},{"rank":2,"title":"PostgreSQL materialized view","summary":"Precompute profile reads.","pros":["Uses the existing database"],"cons":["Refresh cost"]}],"recommendation":{"option":1,"rationale":"Fits the constraint."}}`,
+	},
+}
+
+// runPromptsCommand implements `escalator prompts test`.
+func runPromptsCommand(args []string, out io.Writer) int {
+	if len(args) == 0 || args[0] != "test" {
+		fmt.Fprintln(out, "Usage: escalator prompts test [-fixtures dir] [-golden dir] [-update] [-prompt-template file] [-prompt-var name=value]")
+		return 2
+	}
+
+	fs := flag.NewFlagSet("prompts test", flag.ContinueOnError)
+	fs.SetOutput(out)
+	fixturesDir := fs.String("fixtures", "", "Directory of JSON fixture files (default: built-in fixtures)")
+	goldenDir := fs.String("golden", "", "Directory of golden rendered prompts to compare against")
+	update := fs.Bool("update", false, "Rewrite golden files with the current rendering")
+	templatePath := fs.String("prompt-template", "", "get_help prompt template to render instead of the built-in one")
+	promptVars := promptVarFlag{}
+	fs.Var(promptVars, "prompt-var", "Metadata value for -prompt-template as name=value (repeatable)")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	// Fixtures with a response run the tools, whose routine entries about
+	// their model calls would bury the report.
+	defer slog.SetLogLoggerLevel(slog.SetLogLoggerLevel(slog.LevelWarn))
+
+	help := NewGetHelpTool("", "")
+	if *templatePath != "" {
+		tmpl, err := LoadPromptTemplate(*templatePath, promptVars)
+		if err != nil {
+			fmt.Fprintf(out, "Couldn't load prompt template: %v\n", err)
+			return 1
+		}
+		help.WithPromptTemplate(tmpl, promptVars)
+	}
+
+	fixtures := defaultPromptFixtures
+	if *fixturesDir != "" {
+		loaded, err := loadPromptFixtures(*fixturesDir)
+		if err != nil {
+			fmt.Fprintf(out, "Couldn't load fixtures: %v\n", err)
+			return 1
+		}
+		fixtures = loaded
+	}
+
+	failures := 0
+	for _, fixture := range fixtures {
+		problems := lintPrompt(help, fixture, *goldenDir, *update)
+		if len(problems) == 0 {
+			fmt.Fprintf(out, "PASS %s/%s\n", fixture.Template, fixture.Name)
+			continue
+		}
+		failures++
+		fmt.Fprintf(out, "FAIL %s/%s\n", fixture.Template, fixture.Name)
+		for _, problem := range problems {
+			fmt.Fprintf(out, "    %s\n", problem)
+		}
+	}
+
+	fmt.Fprintf(out, "%d fixtures, %d failed\n", len(fixtures), failures)
+	if failures > 0 {
+		return 1
+	}
+	return 0
+}
+
+// lintPrompt renders a fixture with help's prompt template and, when the
+// fixture has a response, runs the tool against it, returning every problem
+// found. Golden files hold the rendered prompt and the tool's output.
+func lintPrompt(help *GetHelpTool, fixture promptFixture, goldenDir string, update bool) []string {
+	tmpl, ok := findPromptTemplate(fixture.Template)
+	if !ok {
+		return []string{fmt.Sprintf("unknown template %q", fixture.Template)}
+	}
+
+	prompt, err := tmpl.render(help, fixture.Inputs)
+	if err != nil {
+		return []string{fmt.Sprintf("render failed: %v", err)}
+	}
+
+	var problems []string
+	for _, key := range tmpl.required {
+		value := fixture.Inputs[key]
+		if value == "" {
+			problems = append(problems, fmt.Sprintf("fixture is missing input %q", key))
+		} else if !strings.Contains(prompt, value) {
+			problems = append(problems, fmt.Sprintf("input %q does not appear in the rendered prompt", key))
+		}
+	}
+
+	for _, marker := range []string{"%!", "<no value>"} {
+		if strings.Contains(prompt, marker) {
+			problems = append(problems, fmt.Sprintf("rendered prompt contains unfilled placeholder marker %q", marker))
+		}
+	}
+
+	if tokens := estimateTokens(prompt); tokens > promptTokenBudget {
+		problems = append(problems, fmt.Sprintf("rendered prompt is ~%d tokens, over the %d token budget", tokens, promptTokenBudget))
+	}
+
+	golden := filepath.Join(goldenDir, fixture.Template+"_"+fixture.Name)
+	if goldenDir != "" {
+		if problem := checkGolden(golden+".golden", "rendered prompt", prompt, update); problem != "" {
+			problems = append(problems, problem)
+		}
+	}
+
+	if fixture.Response != "" {
+		output, err := answerFixture(help, tmpl, fixture)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("tool failed on the response: %v", err))
+		} else if goldenDir != "" {
+			if problem := checkGolden(golden+".output.golden", "tool output", output, update); problem != "" {
+				problems = append(problems, problem)
+			}
+		}
+	}
+
+	return problems
+}
+
+// answerFixture runs the fixture's tool with a stub provider that answers
+// every model call with the fixture's response, and returns its output. The
+// fixture's summary is read from a file, as get_help reads the project's.
+func answerFixture(help *GetHelpTool, tmpl promptTemplate, fixture promptFixture) (string, error) {
+	dir, err := os.MkdirTemp("", "escalator-prompts")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+	summaryPath := filepath.Join(dir, "summary.md")
+	if err := os.WriteFile(summaryPath, []byte(fixture.Inputs["summary"]), 0600); err != nil {
+		return "", err
+	}
+	previous := help.SummaryPath()
+	help.SetSummaryPath(summaryPath)
+	defer help.SetSummaryPath(previous)
+
+	help.LLM().WithProvider(CompletionFunc(func(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error) {
+		return &Completion{Answer: fixture.Response, Model: req.Model}, nil
+	}))
+	content, err := tmpl.call(help, fixture.Inputs)
+	if err != nil {
+		return "", err
+	}
+	return contentText(content), nil
+}
+
+// checkGolden compares got with the golden file at path, or rewrites the
+// file with update, and describes the problem if there is one.
+func checkGolden(path, what, got string, update bool) string {
+	if update {
+		if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+			return fmt.Sprintf("couldn't write golden file: %v", err)
+		}
+		return ""
+	}
+	golden, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Sprintf("couldn't read golden file: %v", err)
+	}
+	if string(golden) != got {
+		return fmt.Sprintf("%s differs from %s (rerun with -update to accept)", what, path)
+	}
+	return ""
+}
+
+func findPromptTemplate(name string) (promptTemplate, bool) {
+	for _, tmpl := range promptTemplates {
+		if tmpl.name == name {
+			return tmpl, true
+		}
+	}
+	return promptTemplate{}, false
+}
+
+func loadPromptFixtures(dir string) ([]promptFixture, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	fixtures := make([]promptFixture, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var fixture promptFixture
+		if err := json.Unmarshal(data, &fixture); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if fixture.Name == "" {
+			fixture.Name = strings.TrimSuffix(filepath.Base(path), ".json")
+		}
+		fixtures = append(fixtures, fixture)
+	}
+
+	if len(fixtures) == 0 {
+		return nil, fmt.Errorf("no *.json fixtures in %s", dir)
+	}
+	return fixtures, nil
+}
+
+// estimateTokens uses the same rough ~4 characters per token heuristic as
+// the prompt builder.
+func estimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunPromptsCommand_DefaultFixtures(t *testing.T) {
+	var out bytes.Buffer
+	code := runPromptsCommand([]string{"test"}, &out)
+
+	if code != 0 {
+		t.Errorf("Expected exit code 0, got %d. Output:\n%s", code, out.String())
+	}
+	if !strings.Contains(out.String(), "PASS get_help/basic") {
+		t.Errorf("Expected get_help fixture to pass, got:\n%s", out.String())
+	}
+}
+
+func TestRunPromptsCommand_Usage(t *testing.T) {
+	var out bytes.Buffer
+	if code := runPromptsCommand(nil, &out); code != 2 {
+		t.Errorf("Expected exit code 2 without subcommand, got %d", code)
+	}
+}
+
+func TestLintPrompt_Problems(t *testing.T) {
+	tests := []struct {
+		name    string
+		fixture promptFixture
+		want    string
+	}{
+		{
+			"unknown template",
+			promptFixture{Name: "x", Template: "nope"},
+			"unknown template",
+		},
+		{
+			"missing input",
+			promptFixture{Name: "x", Template: "get_help", Inputs: map[string]string{"summary": "s", "question": "q"}},
+			`missing input "relevant_code"`,
+		},
+		{
+			"over budget",
+			promptFixture{Name: "x", Template: "brainstorm_options", Inputs: map[string]string{
+				"problem": "p", "summary": strings.Repeat("a", 90000), "constraints": "c",
+			}},
+			"over the 20000 token budget",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problems := lintPrompt(NewGetHelpTool("", ""), tt.fixture, "", false)
+			if !strings.Contains(strings.Join(problems, "\n"), tt.want) {
+				t.Errorf("Expected a problem containing %q, got %v", tt.want, problems)
+			}
+		})
+	}
+}
+
+func TestLintPrompt_Golden(t *testing.T) {
+	dir := t.TempDir()
+	fixture := defaultPromptFixtures[0]
+
+	if problems := lintPrompt(NewGetHelpTool("", ""), fixture, dir, true); len(problems) != 0 {
+		t.Fatalf("Expected golden update to succeed, got %v", problems)
+	}
+	if problems := lintPrompt(NewGetHelpTool("", ""), fixture, dir, false); len(problems) != 0 {
+		t.Errorf("Expected rendering to match golden, got %v", problems)
+	}
+
+	path := filepath.Join(dir, fixture.Template+"_"+fixture.Name+".golden")
+	os.WriteFile(path, []byte("stale"), 0644)
+	if problems := lintPrompt(NewGetHelpTool("", ""), fixture, dir, false); len(problems) == 0 {
+		t.Error("Expected mismatch against stale golden file")
+	}
+
+	// The tool's answer to the stub response has a golden file of its own,
+	// without the confidence line get_help strips.
+	lintPrompt(NewGetHelpTool("", ""), fixture, dir, true)
+	output, err := os.ReadFile(filepath.Join(dir, fixture.Template+"_"+fixture.Name+".output.golden"))
+	if err != nil || !strings.HasPrefix(string(output), "Five connections") || strings.Contains(string(output), "CONFIDENCE") {
+		t.Fatalf("Expected the tool's output in a golden file, got %q, %v", output, err)
+	}
+	fixture.Response = "Raise the limit.\nCONFIDENCE: high"
+	problems := lintPrompt(NewGetHelpTool("", ""), fixture, dir, false)
+	if len(problems) != 1 || !strings.Contains(problems[0], "tool output differs") {
+		t.Errorf("Expected only the output to differ, got %v", problems)
+	}
+}
+
+func TestLintPrompt_MalformedResponse(t *testing.T) {
+	fixture := defaultPromptFixtures[1]
+	fixture.Response = "Here are some options: ..."
+
+	problems := lintPrompt(NewGetHelpTool("", ""), fixture, "", false)
+	if len(problems) != 1 || !strings.Contains(problems[0], "tool failed on the response") {
+		t.Errorf("Expected brainstorm_options to reject a response that isn't JSON, got %v", problems)
+	}
+}
+
+func TestLoadPromptFixtures(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "long_question.json"), []byte(`{"template":"get_help","inputs":{"question":"q"}}`), 0644)
+
+	fixtures, err := loadPromptFixtures(dir)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(fixtures) != 1 || fixtures[0].Name != "long_question" {
+		t.Errorf("Expected fixture named after file, got %+v", fixtures)
+	}
+
+	if _, err := loadPromptFixtures(t.TempDir()); err == nil {
+		t.Error("Expected error for empty fixtures directory")
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// PromptData is what the get_help prompt template is rendered with.
+type PromptData struct {
+	Summary string
+	// SummarySource labels the summary with where it came from and how
+	// fresh it is, such as "SUMMARY (README.md, updated 12 days ago)".
+	SummarySource string
+	Question      string
+	Code          string
+	// Context is the gathered context (resources, files, retrieved chunks,
+	// git state and plugin blocks), each block already formatted under a
+	// line naming its source.
+	Context []string
+	Persona *Persona
+	// Metadata holds the values set with -prompt-var.
+	Metadata map[string]string
+}
+
+const defaultPromptTemplateText = `Help with this issue:
+{{- if .SummarySource}}
+
+Each part of the context is labeled with its source and when it last changed. Where sources disagree, trust the fresher one: the summary is maintained by hand and can lag behind the code.
+
+Source: {{.SummarySource}}
+{{- end}}
+
+<summary>
+{{.Summary}}
+</summary>
+
+---
+**Question:** {{.Question}}
+
+**Relevant Code:** {{.Code}}
+{{- range .Context}}
+
+{{.}}
+{{- end}}`
+
+var defaultPromptTemplate = template.Must(parsePromptTemplate("default", defaultPromptTemplateText))
+
+// parsePromptTemplate parses a prompt template. Referring to a missing
+// metadata key is an error rather than an empty string, so typos show up
+// when the template is loaded.
+func parsePromptTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Option("missingkey=error").Parse(text)
+}
+
+// LoadPromptTemplate reads a text/template file for the get_help prompt and
+// checks that it renders with metadata, so a broken template fails at
+// startup instead of on the first escalation.
+func LoadPromptTemplate(path string, metadata map[string]string) (*template.Template, error) {
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := parsePromptTemplate(path, string(text))
+	if err != nil {
+		return nil, err
+	}
+	sample := PromptData{
+		Summary:       "summary",
+		SummarySource: "SUMMARY (README.md, updated 1 day ago)",
+		Question:      "question",
+		Code:          "code",
+		Context:       []string{"Source: FILE main.go lines 1–10 (modified 1 day ago)\ncontext"},
+		Persona:       &Persona{Name: defaultPersona, Instructions: builtinPersonas[defaultPersona]},
+		Metadata:      metadata,
+	}
+	if err := tmpl.Execute(&strings.Builder{}, sample); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// renderPrompt renders the prompt template.
+func (t *GetHelpTool) renderPrompt(summary, question, relevantCode string, sections ...string) (string, error) {
+	return t.renderPromptData(PromptData{Summary: summary, Question: question, Code: relevantCode, Context: sections})
+}
+
+// renderPromptData renders the prompt template with data, adding the
+// persona and prompt variables.
+func (t *GetHelpTool) renderPromptData(data PromptData) (string, error) {
+	t.promptMu.RLock()
+	data.Persona = t.persona
+	data.Metadata = t.promptVars
+	tmpl := t.template
+	t.promptMu.RUnlock()
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("couldn't render the prompt template: %w", err)
+	}
+	return b.String(), nil
+}
+
+// promptVarFlag collects repeated -prompt-var name=value flags.
+type promptVarFlag map[string]string
+
+func (p promptVarFlag) repeatable() {}
+
+func (p promptVarFlag) String() string {
+	pairs := make([]string, 0, len(p))
+	for name, value := range p {
+		pairs = append(pairs, name+"="+value)
+	}
+	return strings.Join(pairs, ", ")
+}
+
+func (p promptVarFlag) Set(value string) error {
+	name, val, ok := strings.Cut(value, "=")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" {
+		return fmt.Errorf("prompt variable must be in the form name=value, got %q", value)
+	}
+	p[name] = val
+	return nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestDefaultPromptTemplate(t *testing.T) {
+	prompt, err := NewGetHelpTool("", "o3").renderPrompt("sum", "why?", "code", "**File:** a.go", "**Git branch:** main")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	want := "Help with this issue:\n\n<summary>\nsum\n</summary>\n\n---\n**Question:** why?\n\n**Relevant Code:** code\n\n**File:** a.go\n\n**Git branch:** main"
+	if prompt != want {
+		t.Errorf("Expected %q, got %q", want, prompt)
+	}
+}
+
+func TestLoadPromptTemplate(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "prompt.tmpl")
+	os.WriteFile(path, []byte(`Team {{.Metadata.team}} ({{.Persona.Name}}) asks: {{.Question}}
+{{.Summary}}
+{{range .Context}}{{.}}
+{{end}}`), 0644)
+
+	if _, err := LoadPromptTemplate(path, nil); err == nil || !strings.Contains(err.Error(), "team") {
+		t.Errorf("Expected a missing metadata value to fail the load, got %v", err)
+	}
+	tmpl, err := LoadPromptTemplate(path, map[string]string{"team": "payments"})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	var prompt string
+	tool := NewGetHelpTool("", "o3").WithPromptTemplate(tmpl, map[string]string{"team": "payments"})
+	tool.LLM().WithProvider(CompletionFunc(func(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error) {
+		prompt = req.Messages[len(req.Messages)-1].Content
+		return &Completion{Answer: "answer", Model: req.Model}, nil
+	}))
+	if _, err := tool.Call(map[string]interface{}{"question": "Why the deadlock?", "summary": "Inventory service"}); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if !strings.HasPrefix(prompt, "Team payments (architect) asks: Why the deadlock?\n") {
+		t.Errorf("Expected the prompt rendered from the template, got %q", prompt)
+	}
+
+	broken := filepath.Join(dir, "broken.tmpl")
+	os.WriteFile(broken, []byte("{{.Question"), 0644)
+	if _, err := LoadPromptTemplate(broken, nil); err == nil {
+		t.Error("Expected a template that doesn't parse to be rejected")
+	}
+	unknown := filepath.Join(dir, "unknown.tmpl")
+	os.WriteFile(unknown, []byte("{{.Repository}}"), 0644)
+	if _, err := LoadPromptTemplate(unknown, nil); err == nil {
+		t.Error("Expected a template using an unknown field to be rejected")
+	}
+}
+
+func TestRunPromptsCommand_PromptTemplate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prompt.tmpl")
+	os.WriteFile(path, []byte("{{.Metadata.project}}: {{.Question}}\n{{.Summary}}"), 0644)
+
+	var out bytes.Buffer
+	if code := runPromptsCommand([]string{"test", "-prompt-template", path, "-prompt-var", "project=shop"}, &out); code != 1 {
+		t.Fatalf("Expected exit code 1, got %d. Output:\n%s", code, out.String())
+	}
+	if !strings.Contains(out.String(), `input "relevant_code" does not appear in the rendered prompt`) {
+		t.Errorf("Expected the template's dropped input to be reported, got:\n%s", out.String())
+	}
+}
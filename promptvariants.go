@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// Model families prompt variants are keyed by.
+const (
+	familyReasoning = "reasoning"
+	familyChat      = "chat"
+	familySmall     = "small"
+)
+
+var modelFamilies = []string{familyReasoning, familyChat, familySmall}
+
+var (
+	reasoningModelPattern = regexp.MustCompile(`^(?:o\d|gpt-5|deepseek-r1|qwq)|-reasoner\b|-thinking\b`)
+	localModelPattern     = regexp.MustCompile(`^(?:llama|codellama|mistral|mixtral|phi|gemma|codegemma|qwen|starcoder|tinyllama|smollm|deepseek-coder)`)
+	modelSizePattern      = regexp.MustCompile(`(?:^|[:\-_ ])(\d+(?:\.\d+)?)b\b`)
+)
+
+// maxSmallModelBillions is the largest model, in billions of parameters,
+// that counts as small.
+const maxSmallModelBillions = 14
+
+// modelFamily classifies a model by name: OpenAI's o-series and other
+// reasoning models, small models (14B parameters or fewer, or a local
+// model family without a size), and chat models otherwise. A provider
+// prefix such as "openai/" is ignored.
+func modelFamily(model string) string {
+	name := strings.ToLower(model)
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	if reasoningModelPattern.MatchString(name) {
+		return familyReasoning
+	}
+	if m := modelSizePattern.FindStringSubmatch(name); m != nil {
+		if size, err := strconv.ParseFloat(m[1], 64); err == nil {
+			if size <= maxSmallModelBillions {
+				return familySmall
+			}
+			return familyChat
+		}
+	}
+	if localModelPattern.MatchString(name) {
+		return familySmall
+	}
+	return familyChat
+}
+
+// PromptVariantData is what a prompt variant is rendered with.
+type PromptVariantData struct {
+	// Prompt is the get_help prompt as rendered by the prompt template.
+	Prompt string
+	Model  string
+	Family string
+	// JSON is set when the answer must be a JSON object (response_format
+	// json), which step-by-step scaffolding mustn't contradict.
+	JSON bool
+}
+
+// builtinPromptVariants adapt the prompt for the families one prompt serves
+// worst: reasoning models do better with terse instructions, and small
+// models with explicit steps. Chat models get the prompt as-is.
+var builtinPromptVariants = map[string]string{
+	familyReasoning: `Answer tersely: state the cause and the fix directly, without restating the question or walking through your reasoning.
+
+{{.Prompt}}`,
+	familySmall: `Work through this carefully, in order:
+1. Restate the problem in one sentence.
+2. List the most likely causes, using only the code and context given below.
+3. Pick the most likely cause and point to the code that shows it.
+4. Give the fix as concrete steps or code.
+Keep each step short. If something you need isn't shown, say so instead of guessing.
+{{- if .JSON}} Put the result of steps 2 and 3 in diagnosis and the steps of 4 in fix_plan.{{end}}
+
+{{.Prompt}}`,
+}
+
+// PromptVariants adapt the get_help prompt to the family of each model it
+// is sent to, including fallback and cascade models.
+type PromptVariants struct {
+	templates map[string]*template.Template
+}
+
+// LoadPromptVariants starts from the built-in variants when builtin is set
+// and adds or replaces a family's variant with each file in files, keyed
+// by family. Each variant must render and include the prompt.
+func LoadPromptVariants(builtin bool, files map[string]string) (*PromptVariants, error) {
+	texts := make(map[string]string)
+	if builtin {
+		for family, text := range builtinPromptVariants {
+			texts[family] = text
+		}
+	}
+	for family, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		texts[family] = string(data)
+	}
+	return newPromptVariants(texts)
+}
+
+func newPromptVariants(texts map[string]string) (*PromptVariants, error) {
+	variants := &PromptVariants{templates: make(map[string]*template.Template)}
+	for family, text := range texts {
+		if !slices.Contains(modelFamilies, family) {
+			return nil, fmt.Errorf("unknown model family %q (want %s)", family, strings.Join(modelFamilies, ", "))
+		}
+		tmpl, err := parsePromptTemplate(family, text)
+		if err != nil {
+			return nil, err
+		}
+		sample := PromptVariantData{Prompt: "<sample prompt>", Model: "model", Family: family}
+		var b strings.Builder
+		if err := tmpl.Execute(&b, sample); err != nil {
+			return nil, fmt.Errorf("%s variant: %w", family, err)
+		}
+		if !strings.Contains(b.String(), sample.Prompt) {
+			return nil, fmt.Errorf("%s variant doesn't include {{.Prompt}}", family)
+		}
+		variants.templates[family] = tmpl
+	}
+	return variants, nil
+}
+
+// Families lists the families with a variant, in order.
+func (v *PromptVariants) Families() []string {
+	families := make([]string, 0, len(v.templates))
+	for family := range v.templates {
+		families = append(families, family)
+	}
+	sort.Strings(families)
+	return families
+}
+
+// Adapt returns req with its last user message rendered through the
+// variant for model's family, or req unchanged when the family has none.
+// Earlier messages (the persona and a session's history) are left alone.
+func (v *PromptVariants) Adapt(model string, req openai.ChatCompletionRequest) (openai.ChatCompletionRequest, error) {
+	if v == nil {
+		return req, nil
+	}
+	family := modelFamily(model)
+	tmpl, ok := v.templates[family]
+	if !ok {
+		return req, nil
+	}
+	last := -1
+	for i, message := range req.Messages {
+		if message.Role == openai.ChatMessageRoleUser {
+			last = i
+		}
+	}
+	if last < 0 {
+		return req, nil
+	}
+
+	var b strings.Builder
+	err := tmpl.Execute(&b, PromptVariantData{
+		Prompt: req.Messages[last].Content,
+		Model:  model,
+		Family: family,
+		JSON:   req.ResponseFormat != nil,
+	})
+	if err != nil {
+		return req, fmt.Errorf("couldn't render the %s prompt variant: %w", family, err)
+	}
+	messages := make([]openai.ChatCompletionMessage, len(req.Messages))
+	copy(messages, req.Messages)
+	messages[last].Content = b.String()
+	req.Messages = messages
+	return req, nil
+}
+
+// promptVariantFlag collects repeated -prompt-variant family=path flags.
+type promptVariantFlag map[string]string
+
+func (p promptVariantFlag) repeatable() {}
+
+func (p promptVariantFlag) String() string {
+	pairs := make([]string, 0, len(p))
+	for family, path := range p {
+		pairs = append(pairs, family+"="+path)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ", ")
+}
+
+func (p promptVariantFlag) Set(value string) error {
+	family, path, ok := strings.Cut(value, "=")
+	family = strings.TrimSpace(family)
+	if !ok || path == "" {
+		return fmt.Errorf("prompt variant must be in the form family=path, got %q", value)
+	}
+	if !slices.Contains(modelFamilies, family) {
+		return fmt.Errorf("unknown model family %q (want %s)", family, strings.Join(modelFamilies, ", "))
+	}
+	p[family] = path
+	return nil
+}
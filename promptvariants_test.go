@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestModelFamily(t *testing.T) {
+	for model, want := range map[string]string{
+		"o3":                      familyReasoning,
+		"o4-mini":                 familyReasoning,
+		"openai/o1-preview":       familyReasoning,
+		"deepseek-reasoner":       familyReasoning,
+		"deepseek-r1:70b":         familyReasoning,
+		"gpt-4o":                  familyChat,
+		"gpt-4o-mini":             familyChat,
+		"claude-sonnet":           familyChat,
+		"llama3.1:70b":            familyChat,
+		"llama3.1:8b":             familySmall,
+		"qwen2.5-coder:7b":        familySmall,
+		"mistral":                 familySmall,
+		"meta-llama/Llama-3.2-3B": familySmall,
+	} {
+		if got := modelFamily(model); got != want {
+			t.Errorf("%s: expected %s, got %s", model, want, got)
+		}
+	}
+}
+
+func TestLoadPromptVariants(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, text string) string {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, []byte(text), 0644)
+		return path
+	}
+
+	variants, err := LoadPromptVariants(true, map[string]string{"chat": write("chat.tmpl", "Model {{.Model}}:\n{{.Prompt}}")})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if got := strings.Join(variants.Families(), " "); got != "chat reasoning small" {
+		t.Errorf("Expected variants for every family, got %q", got)
+	}
+
+	for _, tt := range []struct {
+		family, text, err string
+	}{
+		{"chat", "Be brief.", "doesn't include {{.Prompt}}"},
+		{"chat", "{{.Prompt}} {{.Nope}}", "chat variant"},
+		{"huge", "{{.Prompt}}", `unknown model family "huge"`},
+	} {
+		_, err := LoadPromptVariants(false, map[string]string{tt.family: write("variant.tmpl", tt.text)})
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%q: expected an error containing %q, got %v", tt.text, tt.err, err)
+		}
+	}
+}
+
+func TestGetHelpTool_PromptVariants(t *testing.T) {
+	withFastRetries(t)
+	variants, _ := LoadPromptVariants(true, nil)
+	prompts := make(map[string]string)
+	tool := NewGetHelpTool("", "o3").WithFallbackModels([]string{"qwen2.5-coder:7b", "gpt-4o"}).WithPromptVariants(variants)
+	tool.LLM().WithProvider(CompletionFunc(func(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error) {
+		prompts[req.Model] = req.Messages[len(req.Messages)-1].Content
+		if req.Model != "gpt-4o" {
+			return nil, fmt.Errorf("status code: 503")
+		}
+		return &Completion{Answer: "Take a lock.", Model: req.Model}, nil
+	}))
+
+	if _, err := tool.Call(map[string]interface{}{"question": "Why do reservations go negative?", "summary": "s"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !strings.HasPrefix(prompts["o3"], "Answer tersely") {
+		t.Errorf("Expected the reasoning variant for o3, got %q", prompts["o3"])
+	}
+	if !strings.HasPrefix(prompts["qwen2.5-coder:7b"], "Work through this carefully") || strings.Contains(prompts["qwen2.5-coder:7b"], "Put the result of steps") {
+		t.Errorf("Expected the small variant for the local model, got %q", prompts["qwen2.5-coder:7b"])
+	}
+	if !strings.HasPrefix(prompts["gpt-4o"], "Help with this issue") {
+		t.Errorf("Expected the chat model to get the prompt as-is, got %q", prompts["gpt-4o"])
+	}
+	for model, prompt := range prompts {
+		if !strings.Contains(prompt, "Why do reservations go negative?") || !strings.HasSuffix(prompt, confidenceInstruction) {
+			t.Errorf("%s: expected the adapted prompt to keep the question and end with the confidence instruction, got %q", model, prompt)
+		}
+	}
+
+	// Other tools sharing the backend get their prompts as written.
+	clear(prompts)
+	NewBrainstormTool(tool.LLM()).Call(map[string]interface{}{"problem": "Pick a cache"})
+	if strings.HasPrefix(prompts["o3"], "Answer tersely") {
+		t.Errorf("Expected brainstorm prompts unadapted, got %q", prompts["o3"])
+	}
+}
+
+func TestLLM_ForModel_KeepsPromptVariants(t *testing.T) {
+	variants, _ := LoadPromptVariants(true, nil)
+	var prompts []string
+	llm := NewLLM("gpt-4o").WithProvider(CompletionFunc(func(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error) {
+		prompts = append(prompts, req.Messages[len(req.Messages)-1].Content)
+		return &Completion{Answer: "ok", Model: req.Model}, nil
+	})).withPromptVariants(variants)
+
+	llm.ForModel("o3").Generate(context.Background(), userRequest("Why?"), nil)
+	llm.WithPrimary("o3").Generate(context.Background(), userRequest("Why?"), nil)
+	if len(prompts) != 2 || !strings.HasPrefix(prompts[0], "Answer tersely") || !strings.HasPrefix(prompts[1], "Answer tersely") {
+		t.Errorf("Expected the reasoning variant through ForModel and WithPrimary, got %q", prompts)
+	}
+}
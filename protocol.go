@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/dratner/code-escalator/pkg/mcp"
+)
+
+// supportedProtocolVersions are the MCP versions the server speaks, oldest
+// first, as listed by pkg/mcp. Each is answered in its own shapes,
+// described by its protocolRevision, so clients that haven't moved to the
+// latest spec keep working.
+var supportedProtocolVersions = mcp.ProtocolVersions
+
+// protocolRevision is what one MCP revision's messages may carry beyond
+// what 2024-11-05 defined.
+type protocolRevision struct {
+	// progressMessages: notifications/progress has a message (2025-03-26).
+	progressMessages bool
+	// audioContent: audio content blocks (2025-03-26).
+	audioContent bool
+	// batches: JSON-RPC batches, added in 2025-03-26 and dropped in
+	// 2025-06-18. 2024-11-05 clients send them as plain JSON-RPC 2.0.
+	batches bool
+	// structuredContent: structuredContent results and tools' outputSchema
+	// (2025-06-18).
+	structuredContent bool
+	// resourceLinks: resource_link content blocks (2025-06-18).
+	resourceLinks bool
+}
+
+var protocolRevisions = map[string]protocolRevision{
+	"2024-11-05": {batches: true},
+	"2025-03-26": {progressMessages: true, audioContent: true, batches: true},
+	"2025-06-18": {progressMessages: true, audioContent: true, structuredContent: true, resourceLinks: true},
+}
+
+// protocol describes the revision negotiated with the client. Before
+// initialize, as for legacy callers that never send it, nothing is held
+// back.
+func (s *MCPServer) protocol() protocolRevision {
+	s.clientMu.Lock()
+	defer s.clientMu.Unlock()
+	if !s.initialized {
+		return protocolRevisions[supportedProtocolVersions[len(supportedProtocolVersions)-1]]
+	}
+	return protocolRevisions[mcp.NegotiateProtocol(s.protocolVersion)]
+}
+
+// adaptToolsList drops what the client's revision can't describe from
+// tools/list entries.
+func (s *MCPServer) adaptToolsList(tools []mcp.ToolDescriptor) {
+	if s.protocol().structuredContent {
+		return
+	}
+	for i := range tools {
+		tools[i].OutputSchema = nil
+	}
+}
+
+// adaptResult rewrites a tools/call result into the client's revision:
+// structured content is left to the text blocks that carry the same
+// answer, and content blocks the revision lacks become text.
+func (s *MCPServer) adaptResult(result *mcp.CallToolResult) *mcp.CallToolResult {
+	revision := s.protocol()
+	if !revision.structuredContent {
+		result.StructuredContent = nil
+	}
+	content := result.Content
+	for i, block := range content {
+		switch block["type"] {
+		case "resource_link":
+			if !revision.resourceLinks {
+				content[i] = map[string]interface{}{"type": "text", "text": fmt.Sprintf("%v: %v", block["name"], block["uri"])}
+			}
+		case "audio":
+			if !revision.audioContent {
+				content[i] = map[string]interface{}{"type": "text", "text": fmt.Sprintf("[%v audio not supported by this client]", block["mimeType"])}
+			}
+		}
+	}
+	return result
+}
+
+// AcceptsBatches reports whether the client's revision may batch messages.
+func (s *MCPServer) AcceptsBatches() bool {
+	return s.protocol().batches
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/dratner/code-escalator/pkg/mcp"
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestMCPServer_OlderProtocol(t *testing.T) {
+	tool := NewGetHelpTool("", "o3")
+	tool.LLM().WithProvider(CompletionFunc(func(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error) {
+		return &Completion{Answer: "Add an index.", Model: req.Model}, nil
+	}))
+	server := NewMCPServer("test", "1.0.0")
+	server.RegisterTool(tool)
+	server.RegisterTool(&fakeStreamingTool{chunks: []string{"a", "b"}})
+	var methods []string
+	server.notify = func(method string, params interface{}) { methods = append(methods, method) }
+	if got := initialize(t, server, `{"protocolVersion":"2024-11-05","capabilities":{}}`).ProtocolVersion; got != "2024-11-05" {
+		t.Errorf("Expected the client's version, got %v", got)
+	}
+	for _, entry := range server.HandleToolsList().Tools {
+		if entry.OutputSchema != nil {
+			t.Errorf("Expected no output schemas for a 2024-11-05 client, got %v", entry)
+		}
+	}
+	result, _ := server.HandleToolsCall(json.RawMessage(`{"name":"get_help","arguments":{"question":"Why is it slow?","summary":"s"}}`))
+	if result.StructuredContent != nil || contentText(result.Content) == "" {
+		t.Errorf("Expected the answer as text only, got %+v", result)
+	}
+
+	// Progress notifications can't carry the output yet, so it is logged.
+	methods = nil
+	server.HandleToolsCall(json.RawMessage(`{"name":"fake_stream","arguments":{},"_meta":{"progressToken":"tok"}}`))
+	if len(methods) != 2 || methods[0] != "notifications/message" {
+		t.Errorf("Expected streamed output as log messages, got %v", methods)
+	}
+}
+
+func TestMCPServer_AdaptResult(t *testing.T) {
+	server := NewMCPServer("test", "1.0.0")
+	server.recordClientCapabilities(json.RawMessage(`{"protocolVersion":"2024-11-05"}`))
+	result := server.adaptResult(&mcp.CallToolResult{
+		Content: []map[string]interface{}{
+			{"type": "text", "text": "See part 2."},
+			{"type": "resource_link", "uri": "escalator://answers/1/part/2", "name": "Part 2"},
+			{"type": "audio", "data": "", "mimeType": "audio/wav"},
+		},
+	})
+	for _, block := range result.Content {
+		if block["type"] != "text" {
+			t.Errorf("Expected every block as text, got %v", block)
+		}
+	}
+}
+
+func TestMCPServer_Serve_Batch(t *testing.T) {
+	for version, batches := range map[string]bool{"2025-03-26": true, "2025-06-18": false} {
+		server := NewMCPServer("test", "1.0.0")
+		server.RegisterTool(&fakeStreamingTool{chunks: []string{"ok"}})
+
+		clientOut, serverIn := io.Pipe()
+		serverOut, clientIn := io.Pipe()
+		go func() {
+			server.Serve(clientOut, clientIn)
+			clientIn.Close()
+		}()
+		lines := bufio.NewScanner(serverOut)
+		// send returns the reply to msg, skipping notifications.
+		send := func(msg string) json.RawMessage {
+			io.WriteString(serverIn, msg+"\n")
+			for lines.Scan() {
+				var notification struct{ Method string }
+				if json.Unmarshal(lines.Bytes(), &notification); notification.Method == "" {
+					return json.RawMessage(lines.Text())
+				}
+			}
+			t.Fatal("Expected a reply from the server")
+			return nil
+		}
+
+		send(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"` + version + `","capabilities":{}}}`)
+		reply := send(`[{"jsonrpc":"2.0","method":"notifications/initialized"},` +
+			`{"jsonrpc":"2.0","id":2,"method":"tools/list"},` +
+			`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"fake_stream","arguments":{}}}]`)
+		serverIn.Close()
+
+		var responses []JsonRPCResponse
+		err := json.Unmarshal(reply, &responses)
+		if batches && (err != nil || len(responses) != 2 || responses[0].ID != 2 || responses[1].ID != 3) {
+			t.Errorf("%s: expected a response to each request in the batch, got %s", version, reply)
+		}
+		if !batches && !isInvalidRequest(reply) {
+			t.Errorf("%s: expected the batch to be refused, got %s", version, reply)
+		}
+	}
+}
+
+func isInvalidRequest(reply json.RawMessage) bool {
+	var resp struct {
+		Error struct {
+			Code int `json:"code"`
+		} `json:"error"`
+	}
+	return json.Unmarshal(reply, &resp) == nil && resp.Error.Code == -32600
+}
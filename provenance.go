@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Prompt sections are labeled with where they came from and how fresh they
+// are, such as "SUMMARY (README.md, updated 12 days ago)" or "FILE
+// api/http.go lines 1–95 (modified 3 hours ago)", and the default template
+// asks the model to prefer the fresher source when they disagree. A summary
+// written months ago is otherwise weighed the same as the code it describes.
+
+// provenanceNow is the clock freshness is measured against.
+var provenanceNow = time.Now
+
+// describeAge says how long ago t was, as "just now", "3 hours ago" or
+// "12 days ago".
+func describeAge(t time.Time) string {
+	age := provenanceNow().Sub(t)
+	switch {
+	case age < time.Minute:
+		return "just now"
+	case age < time.Hour:
+		return plural(int(age/time.Minute), "minute") + " ago"
+	case age < 24*time.Hour:
+		return plural(int(age/time.Hour), "hour") + " ago"
+	default:
+		return plural(int(age/(24*time.Hour)), "day") + " ago"
+	}
+}
+
+func plural(n int, unit string) string {
+	if n == 1 {
+		return "1 " + unit
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
+
+// lineRange describes lines start to end, as "lines 40–95" or "line 7".
+func lineRange(start, end int) string {
+	if start == end {
+		return fmt.Sprintf("line %d", start)
+	}
+	return fmt.Sprintf("lines %d–%d", start, end)
+}
+
+// lineCount is the number of lines in text.
+func lineCount(text string) int {
+	return strings.Count(strings.TrimSuffix(text, "\n"), "\n") + 1
+}
+
+// labeledText is the section as rendered in the prompt: its text under a
+// line naming its provenance, if it has one.
+func (s *promptSection) labeledText() string {
+	if s.Provenance == "" || s.Text == "" {
+		return s.Text
+	}
+	return "Source: " + s.Provenance + "\n" + s.Text
+}
+
+// summaryProvenance labels the summary file as last loaded.
+func (t *GetHelpTool) summaryProvenance() string {
+	t.summaryMu.Lock()
+	defer t.summaryMu.Unlock()
+	if t.summary == nil {
+		return ""
+	}
+	return fmt.Sprintf("SUMMARY (%s, updated %s)", filepath.Base(t.summary.path), describeAge(t.summary.modTime))
+}
+
+// provenance labels lines start to end of the repository file rel.
+func (r *Repository) provenance(rel string, start, end int) string {
+	return fmt.Sprintf("FILE %s %s (%s)", rel, lineRange(start, end), r.modified(rel))
+}
+
+// modified says when the repository file rel last changed.
+func (r *Repository) modified(rel string) string {
+	info, err := os.Stat(filepath.Join(r.root, filepath.FromSlash(rel)))
+	if err != nil {
+		return "modification time unknown"
+	}
+	return "modified " + describeAge(info.ModTime())
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// pinProvenanceClock makes freshness labels relative to now.
+func pinProvenanceClock(t *testing.T, now time.Time) {
+	t.Helper()
+	previous := provenanceNow
+	provenanceNow = func() time.Time { return now }
+	t.Cleanup(func() { provenanceNow = previous })
+}
+
+func TestDescribeAge(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	pinProvenanceClock(t, now)
+	for age, want := range map[time.Duration]string{
+		10 * time.Second:    "just now",
+		time.Minute:         "1 minute ago",
+		3 * time.Hour:       "3 hours ago",
+		36 * time.Hour:      "1 day ago",
+		12 * 24 * time.Hour: "12 days ago",
+	} {
+		if got := describeAge(now.Add(-age)); got != want {
+			t.Errorf("describeAge(%v) = %q, want %q", age, got, want)
+		}
+	}
+}
+
+func TestGetHelpTool_Call_LabelsProvenance(t *testing.T) {
+	now := time.Now()
+	pinProvenanceClock(t, now)
+	summaryPath := writeTestSummary(t)
+	os.Chtimes(summaryPath, now.Add(-12*24*time.Hour), now.Add(-12*24*time.Hour))
+	repo := testRepository(t)
+	os.Chtimes(filepath.Join(repo.Root(), "internal", "store", "a.go"), now.Add(-3*time.Hour), now.Add(-3*time.Hour))
+
+	var prompt string
+	tool := NewGetHelpTool(summaryPath, "o3").WithRepository(repo)
+	tool.LLM().WithProvider(CompletionFunc(func(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error) {
+		prompt = req.Messages[len(req.Messages)-1].Content
+		return &Completion{Answer: "answer", Model: req.Model}, nil
+	}))
+	if _, err := tool.Call(map[string]interface{}{
+		"question":  "Why does the store lose writes?",
+		"summary":   "s",
+		"files":     []interface{}{"internal/store/a.go"},
+		"selection": map[string]interface{}{"file": "internal/store/a.go", "start_line": 1.0, "text": "package store"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"trust the fresher one",
+		"Source: SUMMARY (PROJECT.md, updated 12 days ago)\n\n<summary>",
+		"Source: FILE internal/store/a.go line 1 (modified 3 hours ago)\n**File internal/store/a.go:**",
+		"Source: EDITOR internal/store/a.go line 1 (the caller's open buffer, current)\n**Selected code",
+	} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("Expected %q in the prompt, got %q", want, prompt)
+		}
+	}
+
+	// Without the summary file, the caller's summary is labeled as such.
+	tool = NewGetHelpTool(filepath.Join(t.TempDir(), "missing.md"), "o3")
+	tool.LLM().WithProvider(CompletionFunc(func(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error) {
+		prompt = req.Messages[len(req.Messages)-1].Content
+		return &Completion{Answer: "answer", Model: req.Model}, nil
+	}))
+	tool.Call(map[string]interface{}{"question": "q", "summary": "Caller summary"})
+	if !strings.Contains(prompt, "Source: SUMMARY (provided by the caller, age unknown)") {
+		t.Errorf("Expected the caller's summary labeled, got %q", prompt)
+	}
+}
+
+func TestExecContextSource_DefaultProvenance(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "wiki.sh")
+	os.WriteFile(script, []byte("#!/bin/sh\ncat >/dev/null\necho '[{\"name\": \"a\", \"text\": \"A\"}, {\"name\": \"b\", \"text\": \"B\", \"provenance\": \"WIKI Payments (edited 2 days ago)\"}]'\n"), 0755)
+	source, _ := NewExecContextSource(script)
+	blocks, err := source.Gather(context.Background(), "q", nil)
+	if err != nil || len(blocks) != 2 {
+		t.Fatalf("Expected two blocks, got %+v, %v", blocks, err)
+	}
+	if blocks[0].Provenance != "PLUGIN wiki.sh a" || blocks[1].Provenance != "WIKI Payments (edited 2 days ago)" {
+		t.Errorf("Expected the plugin's label kept and a default otherwise, got %+v", blocks)
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+import "github.com/dratner/code-escalator/pkg/llm"
+
+// The provider layer lives in pkg/llm, so programs embedding the escalator
+// can bring their own backend; these names keep the package's code as it
+// was.
+type (
+	Provider       = llm.Provider
+	Completer      = llm.Completer
+	DeltaStream    = llm.DeltaStream
+	Delta          = llm.Delta
+	CompletionFunc = llm.CompletionFunc
+	Completion     = llm.Completion
+)
+
+// openAIProvider talks to OpenAI or an OpenAI-compatible gateway, through
+// pkg/llm's provider. The escalator adds listing and warming on top.
+type openAIProvider struct {
+	*llm.OpenAI
+}
+
+func newOpenAIProvider(opts ClientOptions) *openAIProvider {
+	return &openAIProvider{llm.NewOpenAI(opts.NewClient())}
+}
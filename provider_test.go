@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// fakeStreamProvider streams a fixed answer word by word, reporting usage
+// on the last delta.
+type fakeStreamProvider struct {
+	answer string
+}
+
+func (p fakeStreamProvider) Stream(ctx context.Context, req openai.ChatCompletionRequest) (DeltaStream, error) {
+	var deltas []Delta
+	for _, word := range strings.SplitAfter(p.answer, " ") {
+		deltas = append(deltas, Delta{Text: word})
+	}
+	deltas = append(deltas, Delta{PromptTokens: 10, CompletionTokens: 5})
+	return &sliceStream{deltas: deltas}, nil
+}
+
+type sliceStream struct {
+	deltas []Delta
+}
+
+func (s *sliceStream) Recv() (Delta, error) {
+	if len(s.deltas) == 0 {
+		return Delta{}, io.EOF
+	}
+	delta := s.deltas[0]
+	s.deltas = s.deltas[1:]
+	return delta, nil
+}
+
+func (s *sliceStream) Close() error {
+	return nil
+}
+
+func TestLLM_Generate_StreamingProvider(t *testing.T) {
+	llm := NewLLM("local-model").WithProvider(fakeStreamProvider{answer: "use a mutex here"})
+
+	var deltas []string
+	completion, err := llm.Generate(context.Background(), userRequest("q"), func(delta string) {
+		deltas = append(deltas, delta)
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if completion.Answer != "use a mutex here" || len(deltas) != 4 {
+		t.Errorf("Expected the answer in 4 deltas, got %q in %q", completion.Answer, deltas)
+	}
+	if completion.Model != "local-model" || completion.PromptTokens != 10 || completion.CompletionTokens != 5 {
+		t.Errorf("Expected model and usage to be reported, got %+v", completion)
+	}
+
+	// Without a listener the stream is still collected.
+	answer, err := llm.Ask(context.Background(), "q", nil)
+	if err != nil || answer != "use a mutex here" {
+		t.Errorf("Expected the collected answer, got %q, %v", answer, err)
+	}
+}
+
+func TestCompletionFunc_StreamsSingleDelta(t *testing.T) {
+	provider := CompletionFunc(func(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error) {
+		return &Completion{Answer: "answer from " + req.Model, Model: req.Model, PromptTokens: 3}, nil
+	})
+	llm := NewLLM("m").WithProvider(provider)
+
+	var deltas []string
+	completion, err := llm.Generate(context.Background(), userRequest("q"), func(delta string) {
+		deltas = append(deltas, delta)
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(deltas) != 1 || deltas[0] != "answer from m" || completion.PromptTokens != 3 {
+		t.Errorf("Expected the whole answer as one delta, got %q (%+v)", deltas, completion)
+	}
+}
+
+func TestLLM_Generate_ProviderFallback(t *testing.T) {
+	withFastRetries(t)
+	provider := CompletionFunc(func(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error) {
+		if req.Model == "primary" {
+			return nil, fmt.Errorf("unavailable")
+		}
+		return &Completion{Answer: "ok", Model: req.Model}, nil
+	})
+
+	completion, err := NewLLM("primary").WithFallbackModels([]string{"backup"}).WithProvider(provider).
+		ForModel("primary").WithPrimary("primary").Generate(context.Background(), userRequest("q"), nil)
+	if err == nil {
+		t.Fatalf("Expected ForModel to drop the fallback chain, got %+v", completion)
+	}
+
+	completion, err = NewLLM("primary").WithFallbackModels([]string{"backup"}).WithProvider(provider).
+		Generate(context.Background(), userRequest("q"), func(string) {})
+	if err != nil || completion.Model != "backup" {
+		t.Errorf("Expected the fallback model to answer through the provider, got %+v, %v", completion, err)
+	}
+}
+
+func TestGetHelpTool_CallStream_Provider(t *testing.T) {
+	tool := NewGetHelpTool("", "local-model")
+	tool.LLM().WithProvider(fakeStreamProvider{answer: "stream me please"})
+
+	var deltas []string
+	content, err := tool.CallStream(map[string]interface{}{"question": "q", "summary": "s"}, func(delta string) {
+		deltas = append(deltas, delta)
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if content[0]["text"] != "stream me please" || len(deltas) != 3 {
+		t.Errorf("Expected get_help to stream through the provider, got %q in %q", content[0]["text"], deltas)
+	}
+}
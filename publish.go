@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxSearchChars caps how much of a thread's answers the index page
+// searches, keeping the page small for long histories.
+const maxSearchChars = 2000
+
+// Thread is a question and every answer it got, including re-asks, as
+// published by `history publish`.
+type Thread struct {
+	ID       string
+	Question string
+	Answers  []PublishedAnswer
+}
+
+// PublishedAnswer is one answer in a published thread, split into prose
+// and fenced code so the code can be shown as such.
+type PublishedAnswer struct {
+	EscalationRecord
+	Segments []answerSegment
+}
+
+type answerSegment struct {
+	Code bool
+	Text string
+}
+
+// Latest is the thread's most recent answer.
+func (t *Thread) Latest() PublishedAnswer {
+	return t.Answers[0]
+}
+
+// threadKey groups records asking the same question.
+func threadKey(question string) string {
+	normalized := strings.ToLower(strings.Join(strings.Fields(question), " "))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:6])
+}
+
+// buildThreads groups records into threads, each with its answers newest
+// first, and orders the threads by their latest answer, newest first.
+// Questions and answers are redacted on the way.
+func buildThreads(ctx context.Context, records []EscalationRecord, redactor *Redactor) ([]*Thread, error) {
+	byKey := make(map[string]*Thread)
+	var threads []*Thread
+	for _, rec := range records {
+		var err error
+		if rec.Question, err = redactText(ctx, redactor, rec.Question); err != nil {
+			return nil, err
+		}
+		if rec.Answer, err = redactText(ctx, redactor, rec.Answer); err != nil {
+			return nil, err
+		}
+		key := threadKey(rec.Question)
+		thread, ok := byKey[key]
+		if !ok {
+			thread = &Thread{ID: key, Question: rec.Question}
+			byKey[key] = thread
+			threads = append(threads, thread)
+		}
+		thread.Answers = append(thread.Answers, PublishedAnswer{EscalationRecord: rec, Segments: splitFences(rec.Answer)})
+	}
+	for _, thread := range threads {
+		sort.SliceStable(thread.Answers, func(i, j int) bool {
+			return thread.Answers[i].CreatedAt.After(thread.Answers[j].CreatedAt)
+		})
+	}
+	sort.SliceStable(threads, func(i, j int) bool {
+		return threads[i].Latest().CreatedAt.After(threads[j].Latest().CreatedAt)
+	})
+	return threads, nil
+}
+
+func redactText(ctx context.Context, redactor *Redactor, text string) (string, error) {
+	redacted, _, err := redactor.Redact(ctx, text)
+	if err != nil {
+		return "", fmt.Errorf("couldn't scan for secrets: %w", err)
+	}
+	return redacted, nil
+}
+
+// splitFences splits markdown into prose and the code in ``` fences. The
+// fence's language tag is dropped.
+func splitFences(text string) []answerSegment {
+	var segments []answerSegment
+	var current strings.Builder
+	code := false
+	flush := func() {
+		if s := strings.Trim(current.String(), "\n"); s != "" {
+			segments = append(segments, answerSegment{Code: code, Text: s})
+		}
+		current.Reset()
+	}
+	for _, line := range strings.SplitAfter(text, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			flush()
+			code = !code
+			continue
+		}
+		current.WriteString(line)
+	}
+	flush()
+	return segments
+}
+
+// searchText is what the index page's search matches a thread against.
+func (t *Thread) searchText() string {
+	var b strings.Builder
+	b.WriteString(t.Question)
+	for _, answer := range t.Answers {
+		if b.Len() >= maxSearchChars {
+			break
+		}
+		b.WriteString(" ")
+		b.WriteString(answer.Answer)
+	}
+	text := strings.ToLower(strings.Join(strings.Fields(b.String()), " "))
+	if len(text) > maxSearchChars {
+		text = text[:maxSearchChars]
+	}
+	return text
+}
+
+// PublishHistory renders threads as a static site in dir: an index page
+// with a search box and a page per thread. It needs no server, so the
+// directory can be opened from disk or served by any web server.
+func PublishHistory(threads []*Thread, dir, title string) error {
+	if err := os.MkdirAll(filepath.Join(dir, "threads"), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "style.css"), []byte(publishCSS), 0644); err != nil {
+		return err
+	}
+
+	type indexEntry struct {
+		*Thread
+		Search string
+	}
+	entries := make([]indexEntry, len(threads))
+	for i, thread := range threads {
+		entries[i] = indexEntry{Thread: thread, Search: thread.searchText()}
+	}
+	generated := time.Now()
+	if err := writeTemplate(filepath.Join(dir, "index.html"), publishIndexTemplate, map[string]interface{}{
+		"Title":     title,
+		"Threads":   entries,
+		"Generated": generated,
+	}); err != nil {
+		return err
+	}
+	for _, thread := range threads {
+		if err := writeTemplate(filepath.Join(dir, "threads", thread.ID+".html"), publishThreadTemplate, map[string]interface{}{
+			"Title":     title,
+			"Thread":    thread,
+			"Generated": generated,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeTemplate(path string, tmpl *template.Template, data interface{}) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := tmpl.Execute(file, data); err != nil {
+		file.Close()
+		return fmt.Errorf("couldn't render %s: %w", path, err)
+	}
+	return file.Close()
+}
+
+var publishFuncs = template.FuncMap{
+	"date": func(t time.Time) string { return t.Local().Format("2006-01-02 15:04") },
+	"excerpt": func(text string) string {
+		text = strings.Join(strings.Fields(text), " ")
+		if len(text) > 200 {
+			text = text[:197] + "..."
+		}
+		return text
+	},
+	"stale": func(rec EscalationRecord) bool { return rec.stale(time.Now()) },
+}
+
+var publishIndexTemplate = template.Must(template.New("index").Funcs(publishFuncs).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<link rel="stylesheet" href="style.css">
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p class="meta">{{len .Threads}} questions, generated {{date .Generated}}</p>
+<input id="search" type="search" placeholder="Search questions and answers" autofocus>
+<ul id="threads">
+{{- range .Threads}}
+<li data-search="{{.Search}}">
+<a href="threads/{{.ID}}.html">{{excerpt .Question}}</a>
+<span class="meta">{{date .Latest.CreatedAt}} &middot; {{.Latest.Model}}{{if gt (len .Answers) 1}} &middot; {{len .Answers}} answers{{end}}{{if stale .Latest.EscalationRecord}} &middot; <span class="stale">stale</span>{{end}}</span>
+</li>
+{{- end}}
+</ul>
+<p id="none" class="meta" hidden>No questions match.</p>
+<script>
+var search = document.getElementById("search");
+search.addEventListener("input", function () {
+  var words = search.value.toLowerCase().split(/\s+/).filter(Boolean);
+  var shown = 0;
+  document.querySelectorAll("#threads li").forEach(function (item) {
+    var text = item.dataset.search;
+    var match = words.every(function (word) { return text.indexOf(word) >= 0; });
+    item.hidden = !match;
+    if (match) shown++;
+  });
+  document.getElementById("none").hidden = shown > 0;
+});
+</script>
+</body>
+</html>
+`))
+
+var publishThreadTemplate = template.Must(template.New("thread").Funcs(publishFuncs).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{excerpt .Thread.Question}} &ndash; {{.Title}}</title>
+<link rel="stylesheet" href="../style.css">
+</head>
+<body>
+<p><a href="../index.html">&larr; {{.Title}}</a></p>
+<h1>Question</h1>
+<div class="question">{{.Thread.Question}}</div>
+{{- range $i, $answer := .Thread.Answers}}
+<h2>{{if eq $i 0}}Answer{{else}}Earlier answer{{end}}</h2>
+<p class="meta">{{date .CreatedAt}} &middot; {{.Tool}} &middot; {{.Model}}{{if .Source}} &middot; from {{.Source}}{{end}}{{if stale .EscalationRecord}} &middot; <span class="stale">stale: the code has probably changed since</span>{{end}}</p>
+<div class="answer">
+{{- range .Segments}}
+{{if .Code}}<pre><code>{{.Text}}</code></pre>{{else}}<p>{{.Text}}</p>{{end}}
+{{- end}}
+</div>
+{{- end}}
+<p class="meta">Generated {{date .Generated}}</p>
+</body>
+</html>
+`))
+
+const publishCSS = `body { font-family: system-ui, sans-serif; max-width: 60rem; margin: 2rem auto; padding: 0 1rem; line-height: 1.5; color: #222; }
+a { color: #0b57d0; text-decoration: none; }
+a:hover { text-decoration: underline; }
+#search { width: 100%; padding: 0.5rem; font-size: 1rem; margin-bottom: 1rem; box-sizing: border-box; }
+#threads { list-style: none; padding: 0; }
+#threads li { padding: 0.5rem 0; border-bottom: 1px solid #eee; }
+#threads li a { display: block; }
+.meta { color: #666; font-size: 0.875rem; }
+.stale { color: #b3261e; }
+.question, .answer p { white-space: pre-wrap; }
+pre { background: #f6f8fa; padding: 0.75rem; overflow-x: auto; border-radius: 4px; }
+`
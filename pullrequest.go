@@ -0,0 +1,331 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// maxPullRequestDiffChars caps the diff sent, about 25,000 tokens;
+	// maxPullRequestFileChars caps the changed files' contents sent with it.
+	maxPullRequestDiffChars = 100000
+	maxPullRequestFileChars = 80000
+	// maxPullRequestPatchChars caps a single file's diff, so one generated
+	// or vendored file can't crowd out the rest of the change.
+	maxPullRequestPatchChars = 20000
+	// maxPullRequestFiles is how many changed files are listed; GitHub
+	// and GitLab return at most this many in one page.
+	maxPullRequestFiles = 100
+)
+
+var (
+	githubPullPath  = regexp.MustCompile(`^/([^/]+)/([^/]+)/pull/(\d+)(?:/.*)?$`)
+	gitlabMergePath = regexp.MustCompile(`^/(.+?)/-/merge_requests/(\d+)(?:/.*)?$`)
+)
+
+// PullRequest is a GitHub pull request or GitLab merge request with its
+// changes.
+type PullRequest struct {
+	URL         string
+	Title       string
+	Description string
+	Base        string
+	Head        string
+	Files       []ChangedFile
+}
+
+// ChangedFile is one file a pull request changes, with its diff and, once
+// fetched, its contents after the change.
+type ChangedFile struct {
+	Path     string
+	Status   string
+	Patch    string
+	Contents string
+}
+
+// PullRequestFetcher fetches pull requests from GitHub and merge requests
+// from GitLab by their web URL. Only URLs on the configured hosts are
+// fetched, so the tokens are never sent anywhere else.
+type PullRequestFetcher struct {
+	githubAPI   string
+	githubHost  string
+	githubToken string
+	gitlabURL   string
+	gitlabHost  string
+	gitlabToken string
+	client      *http.Client
+}
+
+// NewPullRequestFetcher fetches from the GitHub API at githubAPI (e.g.
+// https://api.github.com) and the GitLab instance at gitlabURL (e.g.
+// https://gitlab.com). Either token may be empty for public repositories.
+func NewPullRequestFetcher(githubAPI, githubToken, gitlabURL, gitlabToken string) (*PullRequestFetcher, error) {
+	f := &PullRequestFetcher{
+		githubAPI:   strings.TrimRight(githubAPI, "/"),
+		githubToken: githubToken,
+		gitlabURL:   strings.TrimRight(gitlabURL, "/"),
+		gitlabToken: gitlabToken,
+		client:      &http.Client{Timeout: 30 * time.Second},
+	}
+	api, err := url.Parse(f.githubAPI)
+	if err != nil || api.Host == "" {
+		return nil, fmt.Errorf("invalid GitHub API URL %q", githubAPI)
+	}
+	// github.com's API has a host of its own; GitHub Enterprise serves it
+	// under /api/v3 on the same host as the web pages.
+	f.githubHost = strings.TrimPrefix(api.Host, "api.")
+	gitlab, err := url.Parse(f.gitlabURL)
+	if err != nil || gitlab.Host == "" {
+		return nil, fmt.Errorf("invalid GitLab URL %q", gitlabURL)
+	}
+	f.gitlabHost = gitlab.Host
+	return f, nil
+}
+
+// Fetch returns the pull request or merge request at the web URL raw, with
+// the contents of its changed files after the change.
+func (f *PullRequestFetcher) Fetch(ctx context.Context, raw string) (*PullRequest, error) {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("%q is not a pull request URL", raw)
+	}
+	switch {
+	case u.Host == f.githubHost && githubPullPath.MatchString(u.Path):
+		m := githubPullPath.FindStringSubmatch(u.Path)
+		return f.fetchGitHub(ctx, raw, m[1]+"/"+m[2], m[3])
+	case u.Host == f.gitlabHost && gitlabMergePath.MatchString(u.Path):
+		m := gitlabMergePath.FindStringSubmatch(u.Path)
+		return f.fetchGitLab(ctx, raw, m[1], m[2])
+	}
+	return nil, fmt.Errorf("%q is not a pull request on %s or a merge request on %s", raw, f.githubHost, f.gitlabHost)
+}
+
+func (f *PullRequestFetcher) fetchGitHub(ctx context.Context, raw, repo, number string) (*PullRequest, error) {
+	var pull struct {
+		Title string `json:"title"`
+		Body  string `json:"body"`
+		Base  struct {
+			Ref string `json:"ref"`
+		} `json:"base"`
+		Head struct {
+			Ref string `json:"ref"`
+			SHA string `json:"sha"`
+		} `json:"head"`
+	}
+	if err := f.getJSON(ctx, fmt.Sprintf("%s/repos/%s/pulls/%s", f.githubAPI, repo, number), f.githubHeaders(), &pull); err != nil {
+		return nil, err
+	}
+	var files []struct {
+		Filename string `json:"filename"`
+		Status   string `json:"status"`
+		Patch    string `json:"patch"`
+	}
+	if err := f.getJSON(ctx, fmt.Sprintf("%s/repos/%s/pulls/%s/files?per_page=%d", f.githubAPI, repo, number, maxPullRequestFiles), f.githubHeaders(), &files); err != nil {
+		return nil, err
+	}
+
+	pr := &PullRequest{URL: raw, Title: pull.Title, Description: pull.Body, Base: pull.Base.Ref, Head: pull.Head.Ref}
+	for _, file := range files {
+		pr.Files = append(pr.Files, ChangedFile{Path: file.Filename, Status: file.Status, Patch: file.Patch})
+	}
+	headers := f.githubHeaders()
+	headers["Accept"] = "application/vnd.github.raw+json"
+	f.fetchContents(ctx, pr, func(path string) string {
+		return fmt.Sprintf("%s/repos/%s/contents/%s?ref=%s", f.githubAPI, repo, escapePath(path), url.QueryEscape(pull.Head.SHA))
+	}, headers)
+	return pr, nil
+}
+
+func (f *PullRequestFetcher) fetchGitLab(ctx context.Context, raw, project, iid string) (*PullRequest, error) {
+	base := fmt.Sprintf("%s/api/v4/projects/%s/merge_requests/%s", f.gitlabURL, url.PathEscape(project), iid)
+	var merge struct {
+		Title        string `json:"title"`
+		Description  string `json:"description"`
+		SourceBranch string `json:"source_branch"`
+		TargetBranch string `json:"target_branch"`
+		SHA          string `json:"sha"`
+	}
+	if err := f.getJSON(ctx, base, f.gitlabHeaders(), &merge); err != nil {
+		return nil, err
+	}
+	var diffs []struct {
+		NewPath     string `json:"new_path"`
+		Diff        string `json:"diff"`
+		NewFile     bool   `json:"new_file"`
+		RenamedFile bool   `json:"renamed_file"`
+		DeletedFile bool   `json:"deleted_file"`
+	}
+	if err := f.getJSON(ctx, fmt.Sprintf("%s/diffs?per_page=%d", base, maxPullRequestFiles), f.gitlabHeaders(), &diffs); err != nil {
+		return nil, err
+	}
+
+	pr := &PullRequest{URL: raw, Title: merge.Title, Description: merge.Description, Base: merge.TargetBranch, Head: merge.SourceBranch}
+	for _, diff := range diffs {
+		status := "modified"
+		switch {
+		case diff.NewFile:
+			status = "added"
+		case diff.DeletedFile:
+			status = "removed"
+		case diff.RenamedFile:
+			status = "renamed"
+		}
+		pr.Files = append(pr.Files, ChangedFile{Path: diff.NewPath, Status: status, Patch: diff.Diff})
+	}
+	f.fetchContents(ctx, pr, func(path string) string {
+		return fmt.Sprintf("%s/api/v4/projects/%s/repository/files/%s/raw?ref=%s", f.gitlabURL, url.PathEscape(project), url.PathEscape(path), url.QueryEscape(merge.SHA))
+	}, f.gitlabHeaders())
+	return pr, nil
+}
+
+// fetchContents reads changed files after the change until their total
+// reaches maxPullRequestFileChars. Contents are helpful rather than
+// essential, so files that can't be read are left out.
+func (f *PullRequestFetcher) fetchContents(ctx context.Context, pr *PullRequest, endpoint func(path string) string, headers map[string]string) {
+	total := 0
+	for i, file := range pr.Files {
+		if file.Status == "removed" || total >= maxPullRequestFileChars {
+			continue
+		}
+		body, err := f.get(ctx, endpoint(file.Path), headers, maxPullRequestFileChars-total)
+		// Binary files are skipped, as the repository reader does.
+		if err != nil || strings.IndexByte(body[:min(len(body), 8000)], 0) >= 0 {
+			continue
+		}
+		pr.Files[i].Contents = body
+		total += len(body)
+	}
+}
+
+func (f *PullRequestFetcher) githubHeaders() map[string]string {
+	headers := map[string]string{"Accept": "application/vnd.github+json"}
+	if f.githubToken != "" {
+		headers["Authorization"] = "Bearer " + f.githubToken
+	}
+	return headers
+}
+
+func (f *PullRequestFetcher) gitlabHeaders() map[string]string {
+	headers := map[string]string{}
+	if f.gitlabToken != "" {
+		headers["PRIVATE-TOKEN"] = f.gitlabToken
+	}
+	return headers
+}
+
+func (f *PullRequestFetcher) getJSON(ctx context.Context, endpoint string, headers map[string]string, v interface{}) error {
+	body, err := f.get(ctx, endpoint, headers, 16*1024*1024)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(body), v)
+}
+
+// get reads at most limit bytes of the response; a longer body is cut off
+// rather than failing the fetch.
+func (f *PullRequestFetcher) get(ctx context.Context, endpoint string, headers map[string]string, limit int) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return "", err
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, int64(limit)))
+	return string(body), err
+}
+
+func escapePath(path string) string {
+	parts := strings.Split(path, "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	return strings.Join(parts, "/")
+}
+
+// pullRequestSource fetches the pull request named by pull_request. The
+// diff is named context; the changed files' contents come second, and are
+// trimmed first when the prompt is too long.
+type pullRequestSource struct {
+	fetcher *PullRequestFetcher
+}
+
+func (s *pullRequestSource) Name() string { return "pull_request" }
+
+func (s *pullRequestSource) Gather(ctx context.Context, question string, arguments map[string]interface{}) ([]ContextBlock, error) {
+	raw, _ := arguments["pull_request"].(string)
+	if raw == "" {
+		return nil, nil
+	}
+	if s.fetcher == nil {
+		return nil, fmt.Errorf("fetching pull requests is not configured (start the server with -pull-requests)")
+	}
+	pr, err := s.fetcher.Fetch(ctx, raw)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't fetch pull request %s: %w", raw, err)
+	}
+	provenance := fmt.Sprintf("PULL REQUEST %s (fetched just now)", pr.URL)
+	blocks := []ContextBlock{{Name: "pull_request " + raw, Text: pr.diffText(), Priority: PriorityNamed, Provenance: provenance}}
+	if contents := pr.contentsText(); contents != "" {
+		blocks = append(blocks, ContextBlock{Name: "pull_request_files " + raw, Text: contents, Priority: PriorityDefault, Provenance: provenance})
+	}
+	return blocks, nil
+}
+
+// diffText describes the pull request and its diff, file by file.
+func (pr *PullRequest) diffText() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "**Pull request %s:** %s\n", pr.URL, pr.Title)
+	if pr.Base != "" {
+		fmt.Fprintf(&b, "Merging %s into %s\n", pr.Head, pr.Base)
+	}
+	if description := strings.TrimSpace(pr.Description); description != "" {
+		fmt.Fprintf(&b, "\n%s\n", truncateMiddle(description, 4000))
+	}
+	fmt.Fprintf(&b, "\nChanged files (%d):\n", len(pr.Files))
+	for _, file := range pr.Files {
+		fmt.Fprintf(&b, "- %s (%s)\n", file.Path, file.Status)
+	}
+	var diff strings.Builder
+	for _, file := range pr.Files {
+		if file.Patch == "" {
+			continue
+		}
+		fmt.Fprintf(&diff, "--- %s\n%s\n", file.Path, truncateMiddle(strings.TrimRight(file.Patch, "\n"), maxPullRequestPatchChars))
+	}
+	if diff.Len() > 0 {
+		fmt.Fprintf(&b, "\n```diff\n%s```", truncateMiddle(diff.String(), maxPullRequestDiffChars))
+	}
+	return b.String()
+}
+
+// contentsText lists the changed files' contents after the change.
+func (pr *PullRequest) contentsText() string {
+	var blocks []string
+	for _, file := range pr.Files {
+		if file.Contents == "" {
+			continue
+		}
+		blocks = append(blocks, fmt.Sprintf("**File %s (after the change):**\n```\n%s\n```", file.Path, strings.TrimRight(file.Contents, "\n")))
+	}
+	if len(blocks) == 0 {
+		return ""
+	}
+	return strings.Join(blocks, "\n\n")
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// newFakeForge serves a GitHub pull request and a GitLab merge request,
+// checking each API's token.
+func newFakeForge(t *testing.T) *httptest.Server {
+	reply := func(w http.ResponseWriter, v interface{}) {
+		json.NewEncoder(w).Encode(v)
+	}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		github := r.Header.Get("Authorization") == "Bearer gh-token"
+		gitlab := r.Header.Get("PRIVATE-TOKEN") == "gl-token"
+		path := r.URL.EscapedPath()
+		switch {
+		case github && path == "/repos/acme/payments/pulls/7":
+			reply(w, map[string]interface{}{
+				"title": "Retry refunds", "body": "Adds retries to the refund client.",
+				"base": map[string]string{"ref": "main"}, "head": map[string]string{"ref": "retry-refunds", "sha": "abc123"},
+			})
+		case github && path == "/repos/acme/payments/pulls/7/files":
+			reply(w, []map[string]string{
+				{"filename": "refund/client.go", "status": "modified", "patch": "@@ -1 +1,2 @@\n+for attempt := 0; attempt < 3; attempt++ {"},
+				{"filename": "refund/old.go", "status": "removed", "patch": "@@ -1 +0,0 @@\n-package refund"},
+			})
+		case github && path == "/repos/acme/payments/contents/refund/client.go" && r.URL.Query().Get("ref") == "abc123":
+			w.Write([]byte("package refund\n\nfunc Refund() error { return retry(3) }\n"))
+		case gitlab && path == "/api/v4/projects/acme%2Fbilling/merge_requests/12":
+			reply(w, map[string]string{"title": "Split invoices", "description": "", "source_branch": "split", "target_branch": "main", "sha": "def456"})
+		case gitlab && path == "/api/v4/projects/acme%2Fbilling/merge_requests/12/diffs":
+			reply(w, []map[string]interface{}{{"new_path": "invoice.go", "diff": "+func Split() {}", "new_file": true}})
+		case gitlab && path == "/api/v4/projects/acme%2Fbilling/repository/files/invoice.go/raw":
+			w.Write([]byte("package billing\n\nfunc Split() {}\n"))
+		default:
+			http.Error(w, `{"message":"Not Found"}`, http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func testPullRequestFetcher(t *testing.T, forge string) *PullRequestFetcher {
+	fetcher, err := NewPullRequestFetcher(forge, "gh-token", forge, "gl-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fetcher
+}
+
+func TestPullRequestFetcher_GitHub(t *testing.T) {
+	forge := newFakeForge(t)
+	pr, err := testPullRequestFetcher(t, forge.URL).Fetch(context.Background(), forge.URL+"/acme/payments/pull/7/files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pr.Title != "Retry refunds" || pr.Base != "main" || len(pr.Files) != 2 {
+		t.Fatalf("Expected the pull request, got %+v", pr)
+	}
+	if !strings.Contains(pr.Files[0].Contents, "retry(3)") || pr.Files[1].Contents != "" {
+		t.Errorf("Expected the contents of the changed file but not the removed one, got %+v", pr.Files)
+	}
+
+	diff := pr.diffText()
+	for _, want := range []string{"Retry refunds", "Merging retry-refunds into main", "- refund/old.go (removed)", "--- refund/client.go", "+for attempt"} {
+		if !strings.Contains(diff, want) {
+			t.Errorf("Expected the diff to contain %q, got:\n%s", want, diff)
+		}
+	}
+	if contents := pr.contentsText(); !strings.Contains(contents, "**File refund/client.go (after the change):**") {
+		t.Errorf("Expected the file's contents, got:\n%s", contents)
+	}
+}
+
+func TestPullRequestFetcher_GitLab(t *testing.T) {
+	forge := newFakeForge(t)
+	pr, err := testPullRequestFetcher(t, forge.URL).Fetch(context.Background(), forge.URL+"/acme/billing/-/merge_requests/12")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pr.Title != "Split invoices" || len(pr.Files) != 1 || pr.Files[0].Status != "added" || !strings.Contains(pr.Files[0].Contents, "package billing") {
+		t.Errorf("Expected the merge request, got %+v", pr)
+	}
+}
+
+func TestPullRequestFetcher_OtherHosts(t *testing.T) {
+	fetcher, err := NewPullRequestFetcher(defaultGitHubAPI, "gh-token", "https://gitlab.com", "gl-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, raw := range []string{
+		"https://evil.example.com/acme/payments/pull/7",
+		"https://github.com/acme/payments/issues/7",
+		"ftp://github.com/acme/payments/pull/7",
+	} {
+		if _, err := fetcher.Fetch(context.Background(), raw); err == nil {
+			t.Errorf("Expected %s to be refused", raw)
+		}
+	}
+	if fetcher.githubHost != "github.com" {
+		t.Errorf("Expected github.com pull requests, got %s", fetcher.githubHost)
+	}
+}
+
+func TestGetHelpTool_Call_PullRequest(t *testing.T) {
+	forge := newFakeForge(t)
+	var prompt string
+	tool := NewGetHelpTool(writeTestSummary(t), "o3")
+	tool.LLM().WithProvider(CompletionFunc(func(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error) {
+		prompt = req.Messages[len(req.Messages)-1].Content
+		return &Completion{Answer: "Looks good.", Model: req.Model}, nil
+	}))
+
+	arguments := map[string]interface{}{"question": "Review this change", "summary": "A payments service", "pull_request": forge.URL + "/acme/payments/pull/7"}
+	if _, err := tool.Call(arguments); err == nil {
+		t.Error("Expected an error when pull requests aren't enabled")
+	}
+
+	tool.WithPullRequests(testPullRequestFetcher(t, forge.URL))
+	if _, ok := tool.Schema()["properties"].(map[string]interface{})["pull_request"]; !ok {
+		t.Error("Expected pull_request in the schema")
+	}
+	if _, err := tool.Call(arguments); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"+for attempt", "func Refund() error"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("Expected the prompt to contain %q, got:\n%s", want, prompt)
+		}
+	}
+
+	arguments["pull_request"] = forge.URL + "/acme/payments/pull/8"
+	if _, err := tool.Call(arguments); err == nil {
+		t.Error("Expected an error for a pull request that can't be fetched")
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dratner/code-escalator/pkg/mcp"
+)
+
+// rateLimitedCode is the JSON-RPC error for a tool call refused by the rate
+// limiter, in the implementation-defined server error range, echoing HTTP
+// 429.
+const rateLimitedCode = -32029
+
+// maxRateBuckets bounds how many clients' buckets are kept; past it, buckets
+// that have refilled are forgotten, since a full bucket is the same as none.
+const maxRateBuckets = 4096
+
+// RateLimiter limits how often each client may call tools, with a token
+// bucket per client: a client may make burst calls at once, and then
+// perMinute calls a minute. It stops a runaway agent loop from escalating
+// (and spending) without end. A nil *RateLimiter allows every call.
+type RateLimiter struct {
+	rate    float64 // tokens per second
+	burst   float64
+	now     func() time.Time
+	metrics *Metrics
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// NewRateLimiter allows each client perMinute calls a minute, in bursts of
+// up to burst calls.
+func NewRateLimiter(perMinute float64, burst int) *RateLimiter {
+	return &RateLimiter{
+		rate:    perMinute / 60,
+		burst:   float64(max(burst, 1)),
+		now:     time.Now,
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// WithMetrics counts refused calls by the kind of client key.
+func (l *RateLimiter) WithMetrics(metrics *Metrics) *RateLimiter {
+	l.metrics = metrics
+	return l
+}
+
+// Allow takes a token from key's bucket. When the bucket is empty it
+// reports false, with how long until a token is available.
+func (l *RateLimiter) Allow(key string) (time.Duration, bool) {
+	if l == nil {
+		return 0, true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	if len(l.buckets) >= maxRateBuckets {
+		l.forgetFull(now)
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, updated: now}
+		l.buckets[key] = b
+	}
+	b.tokens = min(l.burst, b.tokens+now.Sub(b.updated).Seconds()*l.rate)
+	b.updated = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, true
+	}
+
+	kind, _, _ := strings.Cut(key, ":")
+	l.metrics.RateLimited(kind)
+	slog.Warn("Rate limited a client", "client", key)
+	if l.rate <= 0 {
+		return time.Duration(math.MaxInt64), false
+	}
+	return time.Duration((1 - b.tokens) / l.rate * float64(time.Second)), false
+}
+
+// forgetFull drops the buckets that have refilled by now. Callers hold mu.
+func (l *RateLimiter) forgetFull(now time.Time) {
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.updated).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// Limit refuses HTTP requests over the caller's limit with 429 Too Many
+// Requests and a Retry-After header. It runs after authentication, so that
+// callers are limited by API key or client certificate where they have one
+// and by address otherwise.
+func (l *RateLimiter) Limit(next http.HandlerFunc) http.HandlerFunc {
+	if l == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if wait, ok := l.Allow(rateLimitKey(r)); !ok {
+			seconds := retryAfterSeconds(wait)
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusTooManyRequests)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error":               "Rate limit exceeded; try again later",
+				"retry_after_seconds": seconds,
+			})
+			return
+		}
+		next(w, r)
+	}
+}
+
+// rateLimitKey identifies an HTTP caller for rate limiting. Unlike
+// httpClientName it ignores X-Client-Name, which any caller can change
+// with every request.
+func rateLimitKey(r *http.Request) string {
+	if principal := principalFrom(r.Context()); principal != "" {
+		return "key:" + principal
+	}
+	if name := clientCertName(r); name != "" {
+		return name
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// retryAfterSeconds rounds a wait up to whole seconds.
+func retryAfterSeconds(wait time.Duration) int {
+	return int(math.Ceil(min(wait, 24*time.Hour).Seconds()))
+}
+
+// rateLimitError is the JSON-RPC error for a refused tool call.
+func rateLimitError(wait time.Duration) *mcp.RPCError {
+	seconds := retryAfterSeconds(wait)
+	return &mcp.RPCError{
+		Code:    rateLimitedCode,
+		Message: fmt.Sprintf("Rate limit exceeded; try again in %ds", seconds),
+		Data:    map[string]interface{}{"retry_after_seconds": seconds},
+	}
+}
+
+// CallLimiter caps how many model calls are in flight at once, across every
+// backend sharing it. Calls over the cap wait for a slot. A nil
+// *CallLimiter doesn't limit calls.
+type CallLimiter struct {
+	slots chan struct{}
+}
+
+func NewCallLimiter(n int) *CallLimiter {
+	return &CallLimiter{slots: make(chan struct{}, n)}
+}
+
+// Acquire waits for a slot until ctx is done, returning the function that
+// frees it.
+func (c *CallLimiter) Acquire(ctx context.Context) (func(), error) {
+	if c == nil {
+		return func() {}, nil
+	}
+	select {
+	case c.slots <- struct{}{}:
+		return func() { <-c.slots }, nil
+	default:
+	}
+	slog.Debug("Waiting for a model call slot", "limit", cap(c.slots))
+	select {
+	case c.slots <- struct{}{}:
+		return func() { <-c.slots }, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("waiting for a model call slot: %w", ctx.Err())
+	}
+}
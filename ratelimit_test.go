@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func newTestRateLimiter(perMinute float64, burst int) (*RateLimiter, *time.Time) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	limiter := NewRateLimiter(perMinute, burst)
+	limiter.now = func() time.Time { return now }
+	return limiter, &now
+}
+
+func TestRateLimiter_Allow(t *testing.T) {
+	limiter, now := newTestRateLimiter(30, 2)
+	for i := range 2 {
+		if _, ok := limiter.Allow("session:agent"); !ok {
+			t.Fatalf("Expected call %d within the burst allowed", i+1)
+		}
+	}
+	wait, ok := limiter.Allow("session:agent")
+	if ok || wait != 2*time.Second {
+		t.Fatalf("Expected a call over the burst refused for 2s, got %v, %v", wait, ok)
+	}
+	if _, ok := limiter.Allow("session:other"); !ok {
+		t.Error("Expected another client to have its own bucket")
+	}
+
+	*now = now.Add(time.Second)
+	if _, ok := limiter.Allow("session:agent"); ok {
+		t.Error("Expected half a token not to be enough")
+	}
+	*now = now.Add(time.Second)
+	if _, ok := limiter.Allow("session:agent"); !ok {
+		t.Error("Expected the bucket to refill at the rate")
+	}
+	if _, ok := (*RateLimiter)(nil).Allow("session:agent"); !ok {
+		t.Error("Expected a nil limiter to allow every call")
+	}
+}
+
+func TestMCPServer_HandleToolsCall_RateLimited(t *testing.T) {
+	calls := 0
+	tool := NewGetHelpTool("", "o3")
+	tool.LLM().WithProvider(CompletionFunc(func(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error) {
+		calls++
+		return &Completion{Answer: "answer", Model: req.Model}, nil
+	}))
+	limiter, _ := newTestRateLimiter(1, 1)
+	metrics := NewMetrics()
+	server := NewMCPServer("test", "1.0.0").WithRateLimiter(limiter.WithMetrics(metrics)).WithMetrics(metrics)
+	server.RegisterTool(tool)
+
+	call := func() JsonRPCResponse {
+		return server.ProcessRequest(JsonRPCRequest{Jsonrpc: "2.0", ID: 1, Method: "tools/call",
+			Params: json.RawMessage(`{"name":"get_help","arguments":{"question":"q","summary":"s","fresh":true}}`)})
+	}
+	if resp := call(); resp.Error != nil {
+		t.Fatalf("Expected the first call answered, got %+v", resp.Error)
+	}
+	resp := call()
+	if e := resp.Error; e == nil || e.Code != rateLimitedCode || e.Data.(map[string]interface{})["retry_after_seconds"] != 60 {
+		t.Fatalf("Expected a rate limit error, got %+v", resp)
+	}
+	if calls != 1 {
+		t.Errorf("Expected the refused call not to reach the model, got %d calls", calls)
+	}
+	if body := scrape(t, metrics); !strings.Contains(body, `escalator_rate_limited_total{client="session"} 1`) {
+		t.Errorf("Expected the refusal counted, got:\n%s", body)
+	}
+}
+
+func TestRateLimiter_Limit(t *testing.T) {
+	limiter, _ := newTestRateLimiter(6, 1)
+	handler := limiter.Limit(func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("ok")) })
+	get := func(remoteAddr, clientName string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/get_help", nil)
+		r.RemoteAddr = remoteAddr
+		r.Header.Set("X-Client-Name", clientName)
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+	}
+
+	if w := get("10.0.0.5:40000", "a"); w.Code != http.StatusOK {
+		t.Fatalf("Expected the first request served, got %d", w.Code)
+	}
+	// A new client name from the same address doesn't get a new bucket.
+	w := get("10.0.0.5:40001", "b")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "10" {
+		t.Errorf("Expected 429 with Retry-After, got %d %q", w.Code, w.Header().Get("Retry-After"))
+	}
+	if w := get("10.0.0.6:40000", "a"); w.Code != http.StatusOK {
+		t.Errorf("Expected another address served, got %d", w.Code)
+	}
+}
+
+func TestCallLimiter_CapsConcurrentModelCalls(t *testing.T) {
+	var inFlight, peak atomic.Int32
+	release := make(chan struct{})
+	llm := NewLLM("o3").WithCallLimiter(NewCallLimiter(2)).WithProvider(CompletionFunc(func(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		<-release
+		return &Completion{Answer: "ok", Model: req.Model}, nil
+	}))
+
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			llm.ForModel("o3").Generate(context.Background(), userRequest("q"), nil)
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if peak.Load() != 2 {
+		t.Errorf("Expected at most 2 calls in flight, got %d", peak.Load())
+	}
+
+	full := NewCallLimiter(1)
+	full.Acquire(context.Background())
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := full.Acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected waiting for a slot to end with the context, got %v", err)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+)
+
+// sideEffectFlags are the server flags that run commands, write files other
+// than the log, or send data anywhere but the model provider and the sources
+// named in a question.
+// -read-only refuses them rather than silently dropping them, so that a
+// deployment never runs with less than it was configured for (a missing
+// secret scanner, say) without noticing.
+var sideEffectFlags = map[string]string{
+	"secret-scanner-cmd":         "runs an external command",
+	"context-source-cmd":         "runs an external command",
+	"lsp-cmd":                    "runs an external command",
+	"anomaly-webhook":            "posts anomalies to a webhook",
+	"escalation-webhook":         "posts every escalation to a webhook",
+	"approval-slack-webhook":     "posts approval requests to Slack",
+	"error-tracker":              "reports errors to an error tracker",
+	"experts":                    "runs or calls external MCP servers",
+	"human-slack-webhook":        "posts escalations to Slack",
+	"github-repo":                "opens GitHub issues",
+	"office-hours-slack-webhook": "posts the office hours digest to Slack",
+	"office-hours-email":         "emails the office hours digest",
+	"audit-log":                  "writes every escalation to disk",
+	"otlp-endpoint":              "exports trace spans to a collector",
+	"ollama-pull":                "downloads models at startup",
+}
+
+// sideEffectEnv are the environment variables that turn on the same kind of
+// side effect as sideEffectFlags without a flag being set.
+var sideEffectEnv = map[string]string{
+	"OTEL_EXPORTER_OTLP_ENDPOINT": "exports trace spans to a collector",
+}
+
+// checkReadOnly reports the flags set on fs, and the environment variables
+// found by lookupEnv, that -read-only doesn't allow.
+func checkReadOnly(fs *flag.FlagSet, lookupEnv func(string) (string, bool)) error {
+	var problems []string
+	fs.Visit(func(f *flag.Flag) {
+		reason, ok := sideEffectFlags[f.Name]
+		// An empty value, or false for a switch, turns the side effect off.
+		if value := f.Value.String(); ok && value != "" && value != "false" {
+			problems = append(problems, fmt.Sprintf("-%s %s", f.Name, reason))
+		}
+	})
+	if cassette, mode := fs.Lookup("cassette"), fs.Lookup("cassette-mode"); cassette != nil && mode != nil &&
+		cassette.Value.String() != "" && mode.Value.String() == "record" {
+		problems = append(problems, "-cassette-mode record writes the cassette file")
+	}
+	for name, reason := range sideEffectEnv {
+		if value, ok := lookupEnv(name); ok && value != "" {
+			problems = append(problems, fmt.Sprintf("$%s %s", name, reason))
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	sort.Strings(problems)
+	return fmt.Errorf("-read-only doesn't allow side effects: %s", strings.Join(problems, "; "))
+}
+
+// openSQLiteReadOnly opens an existing SQLite database without the
+// ability to write to it or create it.
+func openSQLiteReadOnly(path string) (*sql.DB, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite", "file:"+(&url.URL{Path: path}).EscapedPath()+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckReadOnly(t *testing.T) {
+	newFlags := func() *flag.FlagSet {
+		fs := flag.NewFlagSet("escalator", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		fs.Var(&commandFlag{}, "secret-scanner-cmd", "")
+		fs.Var(&commandFlag{}, "context-source-cmd", "")
+		fs.String("lsp-cmd", "", "")
+		fs.String("audit-log", "", "")
+		fs.String("otlp-endpoint", "", "")
+		fs.Bool("ollama-pull", false, "")
+		fs.String("anomaly-webhook", "", "")
+		fs.String("approval-slack-webhook", "", "")
+		fs.String("cassette", "", "")
+		fs.String("cassette-mode", "replay", "")
+		fs.String("model", "o3", "")
+		return fs
+	}
+
+	tests := []struct {
+		args []string
+		env  map[string]string
+		want []string
+	}{
+		{[]string{"-model", "gpt-4o", "-anomaly-webhook", ""}, nil, nil},
+		{[]string{"-cassette", "c.json"}, nil, nil},
+		{[]string{"-cassette", "c.json", "-cassette-mode", "record"}, nil, []string{"-cassette-mode record"}},
+		{[]string{"-secret-scanner-cmd", "gitleaks stdin", "-anomaly-webhook", "https://hooks/x"}, nil, []string{"-anomaly-webhook posts", "-secret-scanner-cmd runs"}},
+		{[]string{"-context-source-cmd", "./adr.sh", "-approval-slack-webhook", "https://hooks.slack.com/x"}, nil, []string{"-approval-slack-webhook", "-context-source-cmd"}},
+		{[]string{"-lsp-cmd", "gopls"}, nil, []string{"-lsp-cmd runs an external command"}},
+		{[]string{"-audit-log", "audit/"}, nil, []string{"-audit-log writes"}},
+		{[]string{"-otlp-endpoint", "http://localhost:4318"}, nil, []string{"-otlp-endpoint exports"}},
+		{[]string{"-ollama-pull"}, nil, []string{"-ollama-pull downloads models"}},
+		{[]string{"-ollama-pull=false"}, nil, nil},
+		{nil, map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://localhost:4318"}, []string{"$OTEL_EXPORTER_OTLP_ENDPOINT exports"}},
+		{nil, map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": ""}, nil},
+	}
+	for _, tt := range tests {
+		fs := newFlags()
+		if err := fs.Parse(tt.args); err != nil {
+			t.Fatal(err)
+		}
+		err := checkReadOnly(fs, func(name string) (string, bool) {
+			value, ok := tt.env[name]
+			return value, ok
+		})
+		if tt.want == nil {
+			if err != nil {
+				t.Errorf("%v: expected no error, got %v", tt.args, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%v: expected an error", tt.args)
+			continue
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("%v: expected %q in %q", tt.args, want, err)
+			}
+		}
+	}
+}
+
+func TestOpenHistoryReadOnly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	writable, err := OpenHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writable.Insert(EscalationRecord{ID: "a1", Question: "Why?", Model: "o3", Answer: "Because."})
+	writable.Close()
+
+	history, err := OpenHistoryReadOnly(path)
+	if err != nil {
+		t.Fatalf("Expected the history to open, got: %v", err)
+	}
+	defer history.Close()
+	if rec, err := history.Get("a1"); err != nil || rec.Answer != "Because." {
+		t.Errorf("Expected the recorded escalation, got %+v, %v", rec, err)
+	}
+	if _, err := history.Insert(EscalationRecord{ID: "b2", Question: "Why not?"}); err == nil {
+		t.Error("Expected recording into a read-only history to fail")
+	}
+
+	missing := filepath.Join(t.TempDir(), "missing", "history.db")
+	if _, err := OpenHistoryReadOnly(missing); err == nil {
+		t.Error("Expected a missing history to fail to open")
+	}
+	if _, err := os.Stat(filepath.Dir(missing)); !os.IsNotExist(err) {
+		t.Error("Expected nothing to be created for a missing history")
+	}
+}
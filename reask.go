@@ -0,0 +1,74 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// ReaskEscalationTool re-asks a past get_help escalation with its original
+// arguments, re-reading referenced resources and bypassing the cache, so a
+// stale answer can be refreshed in one call.
+type ReaskEscalationTool struct {
+	history *HistoryStore
+	help    *GetHelpTool
+}
+
+func NewReaskEscalationTool(history *HistoryStore, help *GetHelpTool) *ReaskEscalationTool {
+	return &ReaskEscalationTool{history: history, help: help}
+}
+
+func (t *ReaskEscalationTool) Name() string {
+	return "reask_escalation"
+}
+
+func (t *ReaskEscalationTool) Category() string {
+	return "history"
+}
+
+func (t *ReaskEscalationTool) Description() string {
+	return "Re-ask a past get_help escalation with fresh context, e.g. when its answer is stale"
+}
+
+func (t *ReaskEscalationTool) Schema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"id": map[string]interface{}{
+				"type":        "string",
+				"description": "ID of the escalation to re-ask (from list_escalations or a stale answer)",
+			},
+		},
+		"required": []string{"id"},
+	}
+}
+
+func (t *ReaskEscalationTool) Call(arguments map[string]interface{}) ([]map[string]interface{}, error) {
+	return t.CallStream(arguments, nil)
+}
+
+// CallStream streams the fresh answer like get_help does.
+func (t *ReaskEscalationTool) CallStream(arguments map[string]interface{}, onDelta func(string)) ([]map[string]interface{}, error) {
+	id, _ := arguments["id"].(string)
+	if id == "" {
+		return textContent("Error: Missing required field: id"), fmt.Errorf("missing required fields")
+	}
+
+	rec, err := t.history.Get(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return textContent(fmt.Sprintf("Error: No escalation with ID %s", id)), err
+	}
+	if err != nil {
+		return textContent("Error: Couldn't read escalation history"), err
+	}
+	if rec.Tool != t.help.Name() || rec.Arguments == nil {
+		return textContent(fmt.Sprintf("Error: Escalation %s can't be re-asked; ask get_help again instead", id)), fmt.Errorf("escalation %s has no stored arguments", id)
+	}
+
+	reask := make(map[string]interface{}, len(rec.Arguments)+1)
+	for name, value := range rec.Arguments {
+		reask[name] = value
+	}
+	reask["fresh"] = true
+	return t.help.CallStream(reask, onDelta)
+}
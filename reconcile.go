@@ -0,0 +1,369 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BilledUsage is one row of a provider's usage or cost export.
+type BilledUsage struct {
+	// Day is the UTC day the usage was billed on, as 2006-01-02.
+	Day              string
+	Model            string
+	PromptTokens     int
+	CompletionTokens int
+	CostUSD          float64
+	// Estimated is set when the export had tokens but no amount, so the
+	// cost was priced from the tokens.
+	Estimated bool
+}
+
+// Export columns, by the names the provider's exports have used for them.
+var (
+	exportDayColumns        = []string{"start_time_iso", "date", "day", "timestamp", "start_time"}
+	exportModelColumns      = []string{"model", "snapshot_id", "line_item"}
+	exportCostColumns       = []string{"amount_value", "cost_usd", "cost", "amount"}
+	exportPromptColumns     = []string{"input_tokens", "prompt_tokens", "n_context_tokens_total"}
+	exportCompletionColumns = []string{"output_tokens", "completion_tokens", "n_generated_tokens_total"}
+	exportProjectColumns    = []string{"project_id", "project_name"}
+)
+
+// ParseUsageExport reads an OpenAI usage or cost CSV export. Cost exports
+// give an amount per line item, such as "o3-2025-04-16, input"; usage
+// exports give tokens per model, which are priced like the escalator prices
+// its own calls. Rows of other projects are skipped when project is set.
+func ParseUsageExport(r io.Reader, project string) ([]BilledUsage, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read the header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	find := func(names []string) int {
+		for _, name := range names {
+			if i, ok := columns[name]; ok {
+				return i
+			}
+		}
+		return -1
+	}
+	day, model, cost := find(exportDayColumns), find(exportModelColumns), find(exportCostColumns)
+	prompt, completion := find(exportPromptColumns), find(exportCompletionColumns)
+	if day < 0 || model < 0 || (cost < 0 && prompt < 0 && completion < 0) {
+		return nil, fmt.Errorf("not a usage or cost export: want a date column (%s), a model column (%s) and amounts (%s) or tokens (%s)",
+			strings.Join(exportDayColumns, ", "), strings.Join(exportModelColumns, ", "), strings.Join(exportCostColumns, ", "), strings.Join(exportPromptColumns, ", "))
+	}
+	var projectColumns []int
+	for _, name := range exportProjectColumns {
+		if i, ok := columns[name]; ok {
+			projectColumns = append(projectColumns, i)
+		}
+	}
+	if project != "" && len(projectColumns) == 0 {
+		return nil, fmt.Errorf("the export has no project column to filter on")
+	}
+
+	field := func(row []string, i int) string {
+		if i < 0 || i >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[i])
+	}
+	var usage []BilledUsage
+	for line := 2; ; line++ {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if project != "" && !matchesProject(row, projectColumns, project, field) {
+			continue
+		}
+		u := BilledUsage{Model: field(row, model)}
+		// Cost exports name the model and the kind of usage.
+		u.Model, _, _ = strings.Cut(u.Model, ",")
+		if u.Model == "" {
+			continue
+		}
+		if u.Day, err = exportDay(field(row, day)); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if u.PromptTokens, err = exportInt(field(row, prompt)); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if u.CompletionTokens, err = exportInt(field(row, completion)); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if amount := field(row, cost); amount != "" {
+			if u.CostUSD, err = strconv.ParseFloat(strings.TrimPrefix(amount, "$"), 64); err != nil {
+				return nil, fmt.Errorf("line %d: invalid amount %q", line, amount)
+			}
+		} else {
+			u.CostUSD = estimateCost(u.Model, u.PromptTokens, u.CompletionTokens)
+			u.Estimated = true
+		}
+		usage = append(usage, u)
+	}
+	return usage, nil
+}
+
+func matchesProject(row []string, columns []int, project string, field func([]string, int) string) bool {
+	for _, i := range columns {
+		if field(row, i) == project {
+			return true
+		}
+	}
+	return false
+}
+
+// exportDay reads a date, an RFC 3339 time or Unix seconds as a UTC day.
+func exportDay(value string) (string, error) {
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0).UTC().Format(time.DateOnly), nil
+	}
+	for _, layout := range []string{time.RFC3339, time.DateTime, time.DateOnly} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC().Format(time.DateOnly), nil
+		}
+	}
+	return "", fmt.Errorf("invalid date %q", value)
+}
+
+func exportInt(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid token count %q", value)
+	}
+	return int(n), nil
+}
+
+// datedSnapshot matches the date suffix of a model snapshot.
+var datedSnapshot = regexp.MustCompile(`-\d{4}-\d{2}-\d{2}$`)
+
+// billingModel folds a model's dated snapshots into the model, so the
+// escalator's "o3" lines up with the bill's "o3-2025-04-16".
+func billingModel(model string) string {
+	if name := longestModelPrefix(model, modelPrices); name != "" {
+		return name
+	}
+	return datedSnapshot.ReplaceAllString(model, "")
+}
+
+// CostLine compares a day's tracked and billed spend on one model.
+type CostLine struct {
+	Day             string
+	Model           string
+	Escalations     int
+	TrackedUSD      float64
+	BilledUSD       float64
+	TrackedTokens   int
+	BilledTokens    int
+	BilledEstimated bool
+}
+
+// Discrepant reports whether the tracked and billed spend differ by more
+// than tolerance, a fraction of the larger of the two, and at least a cent.
+func (l CostLine) Discrepant(tolerance float64) bool {
+	diff := math.Abs(l.TrackedUSD - l.BilledUSD)
+	return diff >= 0.01 && diff > tolerance*max(l.TrackedUSD, l.BilledUSD)
+}
+
+// Reconcile lines up the escalations recorded in history with billed usage
+// by day and model, over the days the export covers.
+func Reconcile(records []EscalationRecord, billed []BilledUsage) []CostLine {
+	if len(billed) == 0 {
+		return nil
+	}
+	from, to := billed[0].Day, billed[0].Day
+	lines := make(map[[2]string]*CostLine)
+	line := func(day, model string) *CostLine {
+		key := [2]string{day, billingModel(model)}
+		if lines[key] == nil {
+			lines[key] = &CostLine{Day: key[0], Model: key[1]}
+		}
+		return lines[key]
+	}
+	for _, u := range billed {
+		from, to = min(from, u.Day), max(to, u.Day)
+		l := line(u.Day, u.Model)
+		l.BilledUSD += u.CostUSD
+		l.BilledTokens += u.PromptTokens + u.CompletionTokens
+		l.BilledEstimated = l.BilledEstimated || u.Estimated
+	}
+	for _, rec := range records {
+		day := rec.CreatedAt.UTC().Format(time.DateOnly)
+		if day < from || day > to || rec.PromptTokens+rec.CompletionTokens == 0 {
+			continue
+		}
+		l := line(day, rec.Model)
+		l.Escalations++
+		l.TrackedUSD += rec.CostUSD
+		l.TrackedTokens += rec.PromptTokens + rec.CompletionTokens
+	}
+
+	result := make([]CostLine, 0, len(lines))
+	for _, l := range lines {
+		result = append(result, *l)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Day != result[j].Day {
+			return result[i].Day < result[j].Day
+		}
+		return result[i].Model < result[j].Model
+	})
+	return result
+}
+
+// formatReconciliation renders the comparison, marking discrepant lines,
+// and returns how many there were.
+func formatReconciliation(w io.Writer, lines []CostLine, tolerance float64) int {
+	fmt.Fprintf(w, "%-10s  %-16s %5s %10s %10s %9s %12s %12s\n", "DAY", "MODEL", "CALLS", "TRACKED", "BILLED", "DIFF", "TRACKED TOK", "BILLED TOK")
+	var tracked, billed float64
+	discrepancies := 0
+	for _, l := range lines {
+		tracked += l.TrackedUSD
+		billed += l.BilledUSD
+		diff := "-"
+		if l.BilledUSD > 0 {
+			diff = fmt.Sprintf("%+.1f%%", 100*(l.TrackedUSD-l.BilledUSD)/l.BilledUSD)
+		}
+		note := ""
+		switch {
+		case l.Discrepant(tolerance) && l.Escalations == 0:
+			note = "  <- billed, not tracked"
+			discrepancies++
+		case l.Discrepant(tolerance) && l.BilledUSD == 0:
+			note = "  <- tracked, not billed"
+			discrepancies++
+		case l.Discrepant(tolerance):
+			note = "  <- discrepancy"
+			discrepancies++
+		}
+		if l.BilledEstimated {
+			note += " (billed cost priced from tokens)"
+		}
+		fmt.Fprintf(w, "%-10s  %-16s %5d %10s %10s %9s %12d %12d%s\n",
+			l.Day, l.Model, l.Escalations, fmt.Sprintf("$%.4f", l.TrackedUSD), fmt.Sprintf("$%.4f", l.BilledUSD), diff, l.TrackedTokens, l.BilledTokens, note)
+	}
+	fmt.Fprintf(w, "\nTotal: tracked $%.4f, billed $%.4f", tracked, billed)
+	if billed > 0 {
+		fmt.Fprintf(w, " (%+.1f%%)", 100*(tracked-billed)/billed)
+	}
+	fmt.Fprintln(w)
+	return discrepancies
+}
+
+// runCostsCommand implements `escalator costs reconcile`.
+func runCostsCommand(args []string, out io.Writer) int {
+	usage := "Usage: escalator costs reconcile [-db path] [-counters path] [-project id] [-tolerance fraction] export.csv..."
+	if len(args) == 0 || args[0] != "reconcile" {
+		fmt.Fprintln(out, usage)
+		return 2
+	}
+	fs := flag.NewFlagSet("costs reconcile", flag.ContinueOnError)
+	fs.SetOutput(out)
+	dbPath := fs.String("db", defaultHistoryPath(), "Path to the history database")
+	countersPath := fs.String("counters", defaultCountersPath(), "Path to the counters database holding the budget's spend (skipped if missing)")
+	project := fs.String("project", "", "Only reconcile export rows of this project ID or name")
+	tolerance := fs.Float64("tolerance", 0.05, "Difference, as a fraction of the larger amount, reported as a discrepancy")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fmt.Fprintln(out, usage)
+		return 2
+	}
+
+	var billed []BilledUsage
+	for _, path := range fs.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintf(out, "Couldn't read %s: %v\n", path, err)
+			return 1
+		}
+		rows, err := ParseUsageExport(f, *project)
+		f.Close()
+		if err != nil {
+			fmt.Fprintf(out, "Couldn't parse %s: %v\n", path, err)
+			return 1
+		}
+		billed = append(billed, rows...)
+	}
+	if len(billed) == 0 {
+		fmt.Fprintln(out, "The exports have no usage to reconcile.")
+		return 1
+	}
+
+	store, err := OpenHistoryReadOnly(*dbPath)
+	if err != nil {
+		fmt.Fprintf(out, "Couldn't open history: %v\n", err)
+		return 1
+	}
+	defer store.Close()
+	records, err := store.All()
+	if err != nil {
+		fmt.Fprintf(out, "Couldn't query history: %v\n", err)
+		return 1
+	}
+
+	lines := Reconcile(records, billed)
+	fmt.Fprintf(out, "Escalation history against billed usage, %s to %s (UTC):\n\n", lines[0].Day, lines[len(lines)-1].Day)
+	discrepancies := formatReconciliation(out, lines, *tolerance)
+
+	if _, err := os.Stat(*countersPath); err == nil {
+		counters, err := OpenCounters(*countersPath)
+		if err != nil {
+			fmt.Fprintf(out, "Couldn't open counters: %v\n", err)
+			return 1
+		}
+		defer counters.Close()
+		days := make(map[string]float64)
+		var order []string
+		for _, l := range lines {
+			if _, ok := days[l.Day]; !ok {
+				order = append(order, l.Day)
+			}
+			days[l.Day] += l.BilledUSD
+		}
+		fmt.Fprintf(out, "\nBudget spend against billed usage (budget days are the server's local days):\n\n%-10s %10s %10s\n", "DAY", "BUDGET", "BILLED")
+		for _, day := range order {
+			spent, err := counters.Spent(day)
+			if err != nil {
+				fmt.Fprintf(out, "Couldn't query counters: %v\n", err)
+				return 1
+			}
+			note := ""
+			if l := (CostLine{TrackedUSD: spent, BilledUSD: days[day]}); l.Discrepant(*tolerance) {
+				note = "  <- discrepancy"
+				discrepancies++
+			}
+			fmt.Fprintf(out, "%-10s %10s %10s%s\n", day, fmt.Sprintf("$%.4f", spent), fmt.Sprintf("$%.4f", days[day]), note)
+		}
+	}
+
+	if discrepancies > 0 {
+		fmt.Fprintf(out, "\n%d discrepancies over %.0f%%. Usage billed but not tracked often comes from other applications sharing the API key (filter with -project), or from tools that don't record history; differences in amount usually mean the escalator's price table is out of date.\n", discrepancies, 100**tolerance)
+		return 1
+	}
+	fmt.Fprintf(out, "\nNo discrepancies over %.0f%%.\n", 100**tolerance)
+	return 0
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseUsageExport_CostExport(t *testing.T) {
+	export := "\ufeffstart_time_iso,end_time_iso,amount_value,amount_currency,line_item,project_id\n" +
+		"2025-03-10T00:00:00+00:00,2025-03-11T00:00:00+00:00,0.42,usd,\"o3-2025-04-16, input\",proj_a\n" +
+		"2025-03-10T00:00:00+00:00,2025-03-11T00:00:00+00:00,1.00,usd,\"o3-2025-04-16, output\",proj_b\n"
+	usage, err := ParseUsageExport(strings.NewReader(export), "proj_a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(usage) != 1 || usage[0].Day != "2025-03-10" || usage[0].Model != "o3-2025-04-16" || usage[0].CostUSD != 0.42 || usage[0].Estimated {
+		t.Errorf("Expected proj_a's o3 line item, got %+v", usage)
+	}
+}
+
+func TestParseUsageExport_UsageExport(t *testing.T) {
+	export := "start_time,model,input_tokens,output_tokens\n1741564800,gpt-4o-mini,1000000,0\n"
+	usage, err := ParseUsageExport(strings.NewReader(export), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(usage) != 1 || usage[0].Day != "2025-03-10" || usage[0].CostUSD != 0.15 || !usage[0].Estimated {
+		t.Errorf("Expected usage priced from tokens, got %+v", usage)
+	}
+
+	if _, err := ParseUsageExport(strings.NewReader("name,value\nx,1\n"), ""); err == nil {
+		t.Error("Expected an error for a CSV that isn't an export")
+	}
+	if _, err := ParseUsageExport(strings.NewReader(export), "proj_a"); err == nil {
+		t.Error("Expected an error filtering on a project the export doesn't have")
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	day := time.Date(2025, 3, 10, 15, 0, 0, 0, time.UTC)
+	records := []EscalationRecord{
+		{Model: "o3", CreatedAt: day, PromptTokens: 1000, CompletionTokens: 500, CostUSD: 0.40},
+		{Model: "o3", CreatedAt: day, PromptTokens: 1000, CompletionTokens: 500, CostUSD: 0.40},
+		// Outside the days the export covers.
+		{Model: "o3", CreatedAt: day.AddDate(0, 0, -1), PromptTokens: 1000, CostUSD: 9},
+		// Cached answers use no tokens.
+		{Model: "o3", CreatedAt: day},
+	}
+	billed := []BilledUsage{
+		{Day: "2025-03-10", Model: "o3-2025-04-16", CostUSD: 0.80, PromptTokens: 3000},
+		{Day: "2025-03-10", Model: "gpt-4o-mini", CostUSD: 0.50},
+	}
+	lines := Reconcile(records, billed)
+	if len(lines) != 2 {
+		t.Fatalf("Expected a line per model, got %+v", lines)
+	}
+	if l := lines[0]; l.Model != "gpt-4o-mini" || l.Escalations != 0 || !l.Discrepant(0.05) {
+		t.Errorf("Expected untracked usage to be discrepant, got %+v", l)
+	}
+	if l := lines[1]; l.Model != "o3" || l.Escalations != 2 || l.TrackedUSD != 0.80 || l.TrackedTokens != 3000 || l.Discrepant(0.05) {
+		t.Errorf("Expected the o3 snapshot to match the tracked o3 calls, got %+v", l)
+	}
+}
+
+func TestRunCostsCommand(t *testing.T) {
+	dir := t.TempDir()
+	db := filepath.Join(dir, "history.db")
+	history := filepath.Join(dir, "history.jsonl")
+	os.WriteFile(history, []byte(`{"id":"a1","created_at":"2025-03-10T15:00:00Z","question":"q","model":"o3","answer":"a","prompt_tokens":1000,"cost_usd":0.5}`+"\n"), 0644)
+	if code := runHistoryCommand([]string{"import", "-db", db, history}, new(bytes.Buffer)); code != 0 {
+		t.Fatalf("Expected import to succeed, got %d", code)
+	}
+	export := filepath.Join(dir, "costs.csv")
+	os.WriteFile(export, []byte("start_time_iso,amount_value,line_item\n2025-03-10T00:00:00Z,0.50,\"o3, input\"\n2025-03-10T00:00:00Z,2.00,\"gpt-4o, input\"\n"), 0644)
+
+	var out bytes.Buffer
+	code := runCostsCommand([]string{"reconcile", "-db", db, "-counters", filepath.Join(dir, "missing.db"), export}, &out)
+	if code != 1 {
+		t.Fatalf("Expected discrepancies to fail the command, got %d: %s", code, out.String())
+	}
+	if !strings.Contains(out.String(), "billed, not tracked") || !strings.Contains(out.String(), "1 discrepancies") {
+		t.Errorf("Expected the untracked gpt-4o usage to be reported, got %q", out.String())
+	}
+
+	if code := runCostsCommand([]string{"reconcile", "-db", db}, &out); code != 2 {
+		t.Errorf("Expected usage error without exports, got %d", code)
+	}
+}
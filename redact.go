@@ -0,0 +1,411 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// SecretScanner finds secrets in outbound text. Scanners are combined by a
+// Redactor, so teams can add their own detection rules next to the
+// built-in ones.
+type SecretScanner interface {
+	Name() string
+	Scan(ctx context.Context, text string) ([]SecretFinding, error)
+}
+
+// SecretFinding is a secret at text[Start:End].
+type SecretFinding struct {
+	Start int
+	End   int
+	Kind  string
+}
+
+// Redactor replaces the secrets its scanners find in every request sent to
+// a model. A scanner that fails stops the request: content is never sent
+// unscanned.
+type Redactor struct {
+	scanners []SecretScanner
+	// label starts each replacement, as in [REDACTED:aws-access-key].
+	label string
+}
+
+func NewRedactor(scanners ...SecretScanner) *Redactor {
+	return &Redactor{scanners: scanners, label: "REDACTED"}
+}
+
+// Redact returns text with each finding replaced by [REDACTED:kind], or
+// [PII:kind] for a PII scrubber, and the findings in order. Overlapping
+// findings are merged.
+func (r *Redactor) Redact(ctx context.Context, text string) (string, []SecretFinding, error) {
+	if text == "" {
+		return text, nil, nil
+	}
+	var findings []SecretFinding
+	for _, scanner := range r.scanners {
+		found, err := scanner.Scan(ctx, text)
+		if err != nil {
+			return "", nil, fmt.Errorf("%s: %w", scanner.Name(), err)
+		}
+		for _, f := range found {
+			if f.Start >= 0 && f.Start < f.End && f.End <= len(text) {
+				findings = append(findings, f)
+			}
+		}
+	}
+	if len(findings) == 0 {
+		return text, nil, nil
+	}
+
+	sort.Slice(findings, func(i, j int) bool { return findings[i].Start < findings[j].Start })
+	merged := findings[:1]
+	for _, f := range findings[1:] {
+		last := &merged[len(merged)-1]
+		if f.Start < last.End {
+			last.End = max(last.End, f.End)
+			continue
+		}
+		merged = append(merged, f)
+	}
+
+	var b strings.Builder
+	pos := 0
+	for _, f := range merged {
+		b.WriteString(text[pos:f.Start])
+		fmt.Fprintf(&b, "[%s:%s]", r.label, f.Kind)
+		pos = f.End
+	}
+	b.WriteString(text[pos:])
+	return b.String(), merged, nil
+}
+
+// redactRequest redacts every message of req, leaving the caller's
+// messages untouched, and counts what was replaced by kind.
+func (r *Redactor) redactRequest(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionRequest, map[string]int, error) {
+	messages := make([]openai.ChatCompletionMessage, len(req.Messages))
+	kinds := make(map[string]int)
+	for i, message := range req.Messages {
+		redacted, findings, err := r.Redact(ctx, message.Content)
+		if err != nil {
+			return req, nil, err
+		}
+		message.Content = redacted
+		for _, f := range findings {
+			kinds[f.Kind]++
+		}
+		if len(message.MultiContent) > 0 {
+			parts := make([]openai.ChatMessagePart, len(message.MultiContent))
+			for j, part := range message.MultiContent {
+				if part.Type == openai.ChatMessagePartTypeText {
+					redacted, findings, err := r.Redact(ctx, part.Text)
+					if err != nil {
+						return req, nil, err
+					}
+					part.Text = redacted
+					for _, f := range findings {
+						kinds[f.Kind]++
+					}
+				}
+				parts[j] = part
+			}
+			message.MultiContent = parts
+		}
+		messages[i] = message
+	}
+	if len(kinds) > 0 {
+		if r.label == piiLabel {
+			slog.Info("Scrubbed PII from an outbound request", "kinds", kinds)
+		} else {
+			slog.Info("Redacted secrets from an outbound request", "kinds", kinds)
+		}
+	}
+	req.Messages = messages
+	return req, kinds, nil
+}
+
+// secretPattern is a regular expression for one kind of secret. When the
+// expression has a group named secret, only that group is redacted.
+type secretPattern struct {
+	kind string
+	re   *regexp.Regexp
+}
+
+var secretPatterns = []secretPattern{
+	{"private-key", regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`)},
+	{"aws-access-key", regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"aws-secret-key", regexp.MustCompile(`(?i)\baws_?secret_?(?:access_?)?key["']?\s*[:=]\s*["']?(?P<secret>[A-Za-z0-9/+=]{40})\b`)},
+	{"github-token", regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`)},
+	{"openai-key", regexp.MustCompile(`\bsk-(?:proj-)?[A-Za-z0-9_-]{20,}`)},
+	{"slack-token", regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`)},
+	{"google-api-key", regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`)},
+	{"stripe-key", regexp.MustCompile(`\b[rs]k_live_[0-9A-Za-z]{24,}\b`)},
+	{"jwt", regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{8,}\.eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}`)},
+	{"url-password", regexp.MustCompile(`\b[a-zA-Z][a-zA-Z0-9+.-]*://[^:/\s@]+:(?P<secret>[^@/\s]+)@`)},
+	{"connection-string", regexp.MustCompile(`(?im)(?:^|[;"'])\s*(?:password|pwd)\s*=\s*(?P<secret>[^;"'\s]+)`)},
+	{"password", regexp.MustCompile(`(?i)\b(?:password|passwd|pwd|secret|api_?key|access_?token|auth_?token|client_?secret)["']?\s*[:=]\s*["'](?P<secret>[^"'\s]{8,})["']`)},
+}
+
+// regexScanner finds well-known credential formats.
+type regexScanner struct{}
+
+func (regexScanner) Name() string { return "regex" }
+
+func (regexScanner) Scan(ctx context.Context, text string) ([]SecretFinding, error) {
+	return findPatterns(secretPatterns, text), nil
+}
+
+// patternScanner finds secrets matching a team's own expressions, such as
+// the format of its internal tokens.
+type patternScanner struct {
+	patterns []secretPattern
+}
+
+// LoadSecretPatterns reads a JSON array of {"kind", "pattern"} objects. As
+// for the built-in patterns, a group named secret limits what's redacted to
+// that group.
+func LoadSecretPatterns(path string) (SecretScanner, error) {
+	patterns, err := loadPatterns(path)
+	if err != nil {
+		return nil, err
+	}
+	return &patternScanner{patterns: patterns}, nil
+}
+
+// loadPatterns reads a JSON array of {"kind", "pattern"} objects.
+func loadPatterns(path string) ([]secretPattern, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var entries []struct {
+		Kind    string `json:"kind"`
+		Pattern string `json:"pattern"`
+	}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("couldn't parse %s: %w", path, err)
+	}
+	var patterns []secretPattern
+	for i, entry := range entries {
+		if entry.Kind == "" || entry.Pattern == "" {
+			return nil, fmt.Errorf("%s: pattern %d needs a kind and a pattern", path, i+1)
+		}
+		re, err := regexp.Compile(entry.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s: pattern %q: %w", path, entry.Kind, err)
+		}
+		patterns = append(patterns, secretPattern{kind: entry.Kind, re: re})
+	}
+	return patterns, nil
+}
+
+func (s *patternScanner) Name() string { return "patterns" }
+
+func (s *patternScanner) Scan(ctx context.Context, text string) ([]SecretFinding, error) {
+	return findPatterns(s.patterns, text), nil
+}
+
+// findPatterns returns every match of patterns in text.
+func findPatterns(patterns []secretPattern, text string) []SecretFinding {
+	var findings []SecretFinding
+	for _, p := range patterns {
+		group := p.re.SubexpIndex("secret")
+		for _, m := range p.re.FindAllStringSubmatchIndex(text, -1) {
+			start, end := m[0], m[1]
+			if group > 0 && m[2*group] >= 0 {
+				start, end = m[2*group], m[2*group+1]
+			}
+			findings = append(findings, SecretFinding{Start: start, End: end, Kind: p.kind})
+		}
+	}
+	return findings
+}
+
+// entropyCandidate matches long unbroken tokens, the shape of generated
+// keys and passwords.
+var entropyCandidate = regexp.MustCompile(`[A-Za-z0-9+/=_-]{24,}`)
+
+// minSecretEntropy is the Shannon entropy, in bits per character, above
+// which a token looks random. Hex digests (at most 4 bits) stay below it,
+// so commit hashes and checksums aren't redacted.
+const minSecretEntropy = 4.3
+
+// entropyScanner finds random-looking tokens that no pattern knows about.
+type entropyScanner struct{}
+
+func (entropyScanner) Name() string { return "entropy" }
+
+func (entropyScanner) Scan(ctx context.Context, text string) ([]SecretFinding, error) {
+	var findings []SecretFinding
+	for _, m := range entropyCandidate.FindAllStringIndex(text, -1) {
+		token := text[m[0]:m[1]]
+		if looksRandom(token) {
+			findings = append(findings, SecretFinding{Start: m[0], End: m[1], Kind: "high-entropy"})
+		}
+	}
+	return findings, nil
+}
+
+// looksRandom reports whether token mixes letters and digits with high
+// entropy. Identifiers rarely contain digits throughout, and paths and
+// words have low entropy.
+func looksRandom(token string) bool {
+	var letters, digits int
+	counts := make(map[rune]int)
+	for _, r := range token {
+		counts[r]++
+		if unicode.IsDigit(r) {
+			digits++
+		} else if unicode.IsLetter(r) {
+			letters++
+		}
+	}
+	if letters == 0 || digits < 2 {
+		return false
+	}
+	entropy := 0.0
+	n := float64(len(token))
+	for _, c := range counts {
+		p := float64(c) / n
+		entropy -= p * math.Log2(p)
+	}
+	return entropy >= minSecretEntropy
+}
+
+// execScanner runs an external scanner such as gitleaks, which reads the
+// text on stdin and reports findings as JSON: an array or one object per
+// line, each with the secret under Secret (gitleaks) or Raw (trufflehog).
+type execScanner struct {
+	name    string
+	command []string
+}
+
+// NewExecScanner runs command (split on spaces) for every scan.
+func NewExecScanner(command string) (SecretScanner, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil, errors.New("empty scanner command")
+	}
+	return &execScanner{name: filepath.Base(args[0]), command: args}, nil
+}
+
+func (s *execScanner) Name() string { return s.name }
+
+func (s *execScanner) Scan(ctx context.Context, text string) ([]SecretFinding, error) {
+	cmd := exec.CommandContext(ctx, s.command[0], s.command[1:]...)
+	cmd.Stdin = strings.NewReader(text)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	runErr := cmd.Run()
+
+	// Scanners commonly exit non-zero when they find something, so the
+	// exit status only matters when there is no report.
+	reports, err := parseScannerReports(stdout.Bytes())
+	if runErr != nil && (err != nil || len(reports) == 0) {
+		return nil, fmt.Errorf("%v: %s", runErr, strings.TrimSpace(stderr.String()))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var findings []SecretFinding
+	for _, report := range reports {
+		secret := firstString(report, "Secret", "secret", "Raw", "raw")
+		if secret == "" {
+			continue
+		}
+		kind := firstString(report, "RuleID", "DetectorName", "rule", "kind")
+		if kind == "" {
+			kind = s.name
+		}
+		for offset := 0; ; {
+			i := strings.Index(text[offset:], secret)
+			if i < 0 {
+				break
+			}
+			start := offset + i
+			findings = append(findings, SecretFinding{Start: start, End: start + len(secret), Kind: kind})
+			offset = start + len(secret)
+		}
+	}
+	return findings, nil
+}
+
+// parseScannerReports decodes a JSON array of findings or one finding per
+// line.
+func parseScannerReports(out []byte) ([]map[string]interface{}, error) {
+	out = bytes.TrimSpace(out)
+	if len(out) == 0 {
+		return nil, nil
+	}
+	var reports []map[string]interface{}
+	if out[0] == '[' {
+		if err := json.Unmarshal(out, &reports); err != nil {
+			return nil, fmt.Errorf("couldn't parse scanner output: %w", err)
+		}
+		return reports, nil
+	}
+	for _, line := range bytes.Split(out, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 || line[0] != '{' {
+			continue
+		}
+		var report map[string]interface{}
+		if err := json.Unmarshal(line, &report); err != nil {
+			return nil, fmt.Errorf("couldn't parse scanner output: %w", err)
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+func firstString(report map[string]interface{}, keys ...string) string {
+	for _, key := range keys {
+		if s, ok := report[key].(string); ok && s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// secretScannerFor returns a built-in scanner by name.
+func secretScannerFor(name string) (SecretScanner, error) {
+	switch name {
+	case "regex":
+		return regexScanner{}, nil
+	case "entropy":
+		return entropyScanner{}, nil
+	default:
+		return nil, fmt.Errorf("unknown secret scanner %q (want regex or entropy)", name)
+	}
+}
+
+// commandFlag collects repeated flags whose values are whole commands.
+type commandFlag []string
+
+func (c *commandFlag) repeatable() {}
+
+func (c *commandFlag) String() string {
+	return strings.Join(*c, "; ")
+}
+
+func (c *commandFlag) Set(value string) error {
+	if strings.TrimSpace(value) == "" {
+		return errors.New("command must not be empty")
+	}
+	*c = append(*c, value)
+	return nil
+}
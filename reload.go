@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// reloadableSettings are the flags a reload applies to the running server.
+// The others configure things built once at startup, such as listeners and
+// stores, and take a restart.
+var reloadableSettings = []string{"summary", "persona", "prompt-template", "prompt-var"}
+
+// Reloader applies changes to the config file, prompt template and persona
+// without a restart, which would tear down the MCP sessions of connected
+// editors. The summary file needs no reloading; it is reread whenever it
+// changes.
+type Reloader struct {
+	help       *GetHelpTool
+	configPath string
+	lookupEnv  func(string) (string, bool)
+	// fixed holds the reloadable flags given on the command line, which
+	// keep precedence over the environment and the file.
+	fixed map[string][]string
+
+	mu sync.Mutex
+	// settings is every setting from the file as last read, to tell which
+	// changed.
+	settings map[string]string
+	// watched holds the modification times of the files the current
+	// settings were read from.
+	watched map[string]time.Time
+}
+
+// NewReloader returns a reloader for the get_help tool configured from fs,
+// the server flags, and the config file at configPath (if any). given names
+// the flags set on the command line, as givenFlags reported before
+// ApplyConfig set the others.
+func NewReloader(help *GetHelpTool, fs *flag.FlagSet, given map[string]bool, configPath string) *Reloader {
+	r := &Reloader{help: help, configPath: configPath, lookupEnv: os.LookupEnv, fixed: make(map[string][]string)}
+	for _, name := range reloadableSettings {
+		if f := fs.Lookup(name); f != nil && given[name] {
+			r.fixed[name] = flagValues(f)
+		}
+	}
+	r.settings, _ = r.fileSettings()
+	r.watched = r.stamps(r.resolve(r.settings))
+	return r
+}
+
+// givenFlags returns the names of the flags set on fs so far. Called
+// before ApplyConfig, they are the ones given on the command line.
+func givenFlags(fs *flag.FlagSet) map[string]bool {
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	return given
+}
+
+// flagValues returns a flag's values: one per item for -prompt-var, and
+// the value otherwise.
+func flagValues(f *flag.Flag) []string {
+	if vars, ok := f.Value.(promptVarFlag); ok {
+		var values []string
+		for name, value := range vars {
+			values = append(values, name+"="+value)
+		}
+		sort.Strings(values)
+		return values
+	}
+	return []string{f.Value.String()}
+}
+
+// fileSettings reads the config file's settings by flag name.
+func (r *Reloader) fileSettings() (map[string]string, error) {
+	settings := make(map[string]string)
+	if r.configPath == "" {
+		return settings, nil
+	}
+	loaded, err := LoadConfig(r.configPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, setting := range loaded {
+		settings[setting.Key] = strings.Join(setting.Values, "\x00")
+	}
+	return settings, nil
+}
+
+// resolve returns the reloadable settings in force: the command line's,
+// then the environment's, then the file's. Unset ones are missing.
+func (r *Reloader) resolve(file map[string]string) map[string][]string {
+	values := make(map[string][]string)
+	for _, name := range reloadableSettings {
+		if fixed, ok := r.fixed[name]; ok {
+			values[name] = fixed
+		} else if value, ok := r.lookupEnv(configEnvName(name)); ok {
+			values[name] = []string{value}
+		} else if value, ok := file[name]; ok {
+			values[name] = strings.Split(value, "\x00")
+		}
+	}
+	return values
+}
+
+// stamps returns the modification times of the config file and of the
+// prompt template and persona files named by values.
+func (r *Reloader) stamps(values map[string][]string) map[string]time.Time {
+	stamps := make(map[string]time.Time)
+	paths := []string{r.configPath, firstValue(values["prompt-template"])}
+	if persona := firstValue(values["persona"]); builtinPersonas[persona] == "" {
+		paths = append(paths, persona)
+	}
+	for _, path := range paths {
+		if path != "" {
+			stamps[path] = modTime(path)
+		}
+	}
+	return stamps
+}
+
+// modTime returns a file's modification time, or the zero time when it
+// doesn't exist.
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// firstValue returns the first of values, or "" when there are none.
+func firstValue(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// Reload rereads the config file and the files it names, and applies the
+// reloadable settings. Nothing is applied when any of them is invalid, so
+// a half-saved file leaves the server as it was.
+func (r *Reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	file, err := r.fileSettings()
+	if err != nil {
+		// Wait for the file to change again rather than failing on every
+		// check.
+		r.watched[r.configPath] = modTime(r.configPath)
+		return err
+	}
+	values := r.resolve(file)
+	// A failed reload is retried once a file changes again.
+	r.watched = r.stamps(values)
+
+	persona, err := LoadPersona(firstValue(values["persona"]))
+	if err != nil {
+		return err
+	}
+	vars := promptVarFlag{}
+	for _, value := range values["prompt-var"] {
+		if err := vars.Set(value); err != nil {
+			return fmt.Errorf("prompt-var: %w", err)
+		}
+	}
+	tmpl := defaultPromptTemplate
+	if path := firstValue(values["prompt-template"]); path != "" {
+		tmpl, err = LoadPromptTemplate(path, vars)
+		if err != nil {
+			return fmt.Errorf("couldn't load prompt template %s: %w", path, err)
+		}
+	}
+
+	r.help.SetSummaryPath(firstValue(values["summary"]))
+	r.help.WithPersona(persona)
+	r.help.WithPromptTemplate(tmpl, vars)
+
+	var restart []string
+	for key, value := range file {
+		if r.settings[key] != value && !slices.Contains(reloadableSettings, key) {
+			restart = append(restart, key)
+		}
+	}
+	for key := range r.settings {
+		if _, ok := file[key]; !ok && !slices.Contains(reloadableSettings, key) {
+			restart = append(restart, key)
+		}
+	}
+	if len(restart) > 0 {
+		sort.Strings(restart)
+		slog.Warn("Some changed settings take effect only after a restart", "settings", strings.Join(restart, ","))
+	}
+	r.settings = file
+	slog.Info("Reloaded configuration", "persona", persona.Name, "prompt_template", firstValue(values["prompt-template"]), "summary", r.help.SummaryPath())
+	return nil
+}
+
+// changed reports whether a watched file was modified, created or removed
+// since the settings were last applied.
+func (r *Reloader) changed() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for path, last := range r.watched {
+		if !modTime(path).Equal(last) {
+			return true
+		}
+	}
+	return false
+}
+
+// Watch reloads whenever a watched file changes, checking every interval,
+// until ctx is done. Failed reloads are logged and leave the settings as
+// they were.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if r.changed() {
+				r.reloadAndLog()
+			}
+		}
+	}
+}
+
+// reloadAndLog reloads, logging a failure.
+func (r *Reloader) reloadAndLog() {
+	if err := r.Reload(); err != nil {
+		slog.Warn("Couldn't reload the configuration; keeping the current one", "error", err)
+	}
+}
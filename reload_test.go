@@ -0,0 +1,116 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReloader_Reload(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, text string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	persona := write("reviewer.md", "Review the code.")
+	tmpl := write("prompt.tmpl", "Q: {{.Question}} for {{.Metadata.team}}")
+	config := write("escalator.yaml", "persona: "+persona+"\nprompt_template: "+tmpl+"\nprompt_var: [team=payments]\nmodel: o3\n")
+
+	help := NewGetHelpTool("", "o3")
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("summary", "", "")
+	fs.String("persona", defaultPersona, "")
+	fs.String("prompt-template", "", "")
+	fs.Var(promptVarFlag{}, "prompt-var", "(repeatable)")
+	fs.Parse([]string{"-summary", "PROJECT.md"})
+	reloader := NewReloader(help, fs, givenFlags(fs), config)
+	reloader.lookupEnv = func(string) (string, bool) { return "", false }
+
+	if err := reloader.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	prompt, err := help.renderPrompt("s", "Why?", "")
+	if err != nil || prompt != "Q: Why? for payments" || help.currentPersona().Instructions != "Review the code." {
+		t.Fatalf("Expected the file's template and persona, got %q, %v, %+v", prompt, err, help.currentPersona())
+	}
+	if help.SummaryPath() != "PROJECT.md" {
+		t.Errorf("Expected the command line's summary to win, got %s", help.SummaryPath())
+	}
+	if reloader.changed() {
+		t.Error("Expected no change right after a reload")
+	}
+
+	// A broken template leaves the last good settings in place.
+	os.WriteFile(tmpl, []byte("Q: {{.Question"), 0644)
+	os.Chtimes(tmpl, time.Now().Add(time.Minute), time.Now().Add(time.Minute))
+	if !reloader.changed() {
+		t.Fatal("Expected the template change to be noticed")
+	}
+	if err := reloader.Reload(); err == nil {
+		t.Error("Expected an error for a broken template")
+	}
+	if prompt, _ := help.renderPrompt("s", "Why?", ""); prompt != "Q: Why? for payments" {
+		t.Errorf("Expected the last good template kept, got %q", prompt)
+	}
+	if reloader.changed() {
+		t.Error("Expected a failed reload not to be retried until a file changes again")
+	}
+
+	// Dropping the settings from the file goes back to the defaults.
+	write("escalator.yaml", "model: gpt-4o\n")
+	if err := reloader.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if prompt, _ := help.renderPrompt("s", "Why?", ""); !strings.Contains(prompt, "Why?") || strings.HasPrefix(prompt, "Q:") || help.currentPersona().Name != defaultPersona {
+		t.Errorf("Expected the built-in template and persona, got %q, %+v", prompt, help.currentPersona())
+	}
+}
+
+func TestReloader_ReloadAfterApplyConfig(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, text string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	first := write("first.tmpl", "First: {{.Question}}")
+	second := write("second.tmpl", "Second: {{.Question}}")
+	config := write("escalator.yaml", "prompt_template: "+first+"\n")
+
+	help := NewGetHelpTool("", "o3")
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("summary", "", "")
+	fs.String("persona", defaultPersona, "")
+	fs.String("prompt-template", "", "")
+	fs.Var(promptVarFlag{}, "prompt-var", "")
+	fs.Parse([]string{"-summary", "PROJECT.md"})
+	noEnv := func(string) (string, bool) { return "", false }
+
+	// As at startup, the command line is noted before the config file sets
+	// the other flags.
+	given := givenFlags(fs)
+	if err := ApplyConfig(fs, config, noEnv); err != nil {
+		t.Fatal(err)
+	}
+	reloader := NewReloader(help, fs, given, config)
+	reloader.lookupEnv = noEnv
+
+	write("escalator.yaml", "prompt_template: "+second+"\nsummary: OTHER.md\n")
+	if err := reloader.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if prompt, err := help.renderPrompt("s", "Why?", ""); err != nil || prompt != "Second: Why?" {
+		t.Errorf("Expected the edited config's template, got %q, %v", prompt, err)
+	}
+	if help.SummaryPath() != "PROJECT.md" {
+		t.Errorf("Expected the command line's summary to win, got %s", help.SummaryPath())
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ANSI styles for answers rendered to a terminal.
+const (
+	ansiReset   = "\x1b[0m"
+	ansiBold    = "\x1b[1m"
+	ansiDim     = "\x1b[2m"
+	ansiKeyword = "\x1b[1;34m"
+	ansiString  = "\x1b[32m"
+	ansiComment = "\x1b[90m"
+	ansiNumber  = "\x1b[35m"
+	ansiCode    = "\x1b[36m"
+	ansiRemoved = "\x1b[31m"
+)
+
+// codeLanguage describes what highlighting and extraction need to know
+// about a fenced code block's language.
+type codeLanguage struct {
+	extension string
+	comment   string
+	keywords  []string
+}
+
+var codeLanguages = map[string]codeLanguage{
+	"go":         {".go", "//", []string{"break", "case", "chan", "const", "continue", "default", "defer", "else", "fallthrough", "for", "func", "go", "goto", "if", "import", "interface", "map", "nil", "package", "range", "return", "select", "struct", "switch", "type", "var"}},
+	"python":     {".py", "#", []string{"and", "as", "async", "await", "class", "def", "elif", "else", "except", "False", "finally", "for", "from", "if", "import", "in", "is", "lambda", "None", "not", "or", "pass", "raise", "return", "True", "try", "while", "with", "yield"}},
+	"javascript": {".js", "//", []string{"async", "await", "break", "case", "catch", "class", "const", "else", "export", "false", "for", "function", "if", "import", "let", "new", "null", "return", "switch", "this", "throw", "true", "try", "undefined", "var", "while"}},
+	"typescript": {".ts", "//", []string{"async", "await", "break", "case", "catch", "class", "const", "else", "export", "false", "for", "function", "if", "import", "interface", "let", "new", "null", "return", "switch", "this", "throw", "true", "try", "type", "undefined", "var", "while"}},
+	"sql":        {".sql", "--", []string{"AND", "AS", "BY", "CREATE", "DELETE", "FROM", "GROUP", "INDEX", "INSERT", "INTO", "JOIN", "LIMIT", "NOT", "NULL", "ON", "OR", "ORDER", "SELECT", "SET", "TABLE", "UPDATE", "VALUES", "WHERE"}},
+	"sh":         {".sh", "#", []string{"case", "do", "done", "elif", "else", "esac", "export", "fi", "for", "function", "if", "in", "then", "while"}},
+	"json":       {".json", "", []string{"false", "null", "true"}},
+	"yaml":       {".yaml", "#", []string{"false", "null", "true"}},
+	"diff":       {".diff", "", nil},
+}
+
+// languageAliases map fence info strings to codeLanguages.
+var languageAliases = map[string]string{
+	"golang": "go", "py": "python", "js": "javascript", "jsx": "javascript", "ts": "typescript", "tsx": "typescript",
+	"bash": "sh", "shell": "sh", "zsh": "sh", "console": "sh", "yml": "yaml", "patch": "diff", "postgresql": "sql", "mysql": "sql",
+}
+
+// lookupLanguage returns the language a fence names, or the zero
+// language, which highlights strings and numbers only.
+func lookupLanguage(info string) codeLanguage {
+	name := strings.ToLower(info)
+	if alias, ok := languageAliases[name]; ok {
+		name = alias
+	}
+	return codeLanguages[name]
+}
+
+// CodeBlock is a fenced code block of an answer.
+type CodeBlock struct {
+	Language string
+	Code     string
+}
+
+var fenceLine = regexp.MustCompile("^\\s*(```+|~~~+)\\s*([^`\\s]*)")
+
+// extractCodeBlocks returns the fenced code blocks of a markdown answer.
+func extractCodeBlocks(markdown string) []CodeBlock {
+	var blocks []CodeBlock
+	var current *CodeBlock
+	var fence string
+	for _, line := range strings.SplitAfter(markdown, "\n") {
+		m := fenceLine.FindStringSubmatch(line)
+		switch {
+		case current == nil && m != nil:
+			fence = m[1]
+			current = &CodeBlock{Language: strings.ToLower(m[2])}
+		case current != nil && m != nil && strings.HasPrefix(m[1], fence) && m[2] == "":
+			blocks = append(blocks, *current)
+			current = nil
+		case current != nil:
+			current.Code += line
+		}
+	}
+	return blocks
+}
+
+// saveCodeBlocks writes each code block of an answer to its own file in
+// dir, named after the escalation and numbered in order, and returns the
+// paths written.
+func saveCodeBlocks(dir, id string, blocks []CodeBlock) ([]string, error) {
+	if len(blocks) == 0 {
+		return nil, nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	var paths []string
+	for i, block := range blocks {
+		language := lookupLanguage(block.Language)
+		extension := language.extension
+		if extension == "" {
+			extension = ".txt"
+		}
+		path := filepath.Join(dir, fmt.Sprintf("%s-%d%s", id, i+1, extension))
+		if err := os.WriteFile(path, []byte(block.Code), 0644); err != nil {
+			return paths, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+var (
+	headingLine = regexp.MustCompile(`^#{1,6} .*$`)
+	inlineCode  = regexp.MustCompile("`[^`\n]+`")
+	boldText    = regexp.MustCompile(`\*\*[^*\n]+\*\*`)
+	numberToken = regexp.MustCompile(`^[0-9][0-9_.xXa-fA-F]*$`)
+)
+
+// renderMarkdown styles a markdown answer for a terminal: headings and
+// bold text in bold, inline code in color, and fenced code highlighted
+// for its language.
+func renderMarkdown(markdown string) string {
+	var b strings.Builder
+	var language *codeLanguage
+	var fence string
+	for _, line := range strings.SplitAfter(markdown, "\n") {
+		body := strings.TrimSuffix(line, "\n")
+		newline := line[len(body):]
+		m := fenceLine.FindStringSubmatch(body)
+		switch {
+		case language == nil && m != nil:
+			lang := lookupLanguage(m[2])
+			language, fence = &lang, m[1]
+			b.WriteString(ansiDim + body + ansiReset)
+		case language != nil && m != nil && strings.HasPrefix(m[1], fence) && m[2] == "":
+			language = nil
+			b.WriteString(ansiDim + body + ansiReset)
+		case language != nil:
+			b.WriteString(highlightCode(body, *language))
+		case headingLine.MatchString(body):
+			b.WriteString(ansiBold + body + ansiReset)
+		default:
+			body = boldText.ReplaceAllStringFunc(body, func(s string) string { return ansiBold + s + ansiReset })
+			body = inlineCode.ReplaceAllStringFunc(body, func(s string) string { return ansiCode + s + ansiReset })
+			b.WriteString(body)
+		}
+		b.WriteString(newline)
+	}
+	return b.String()
+}
+
+// codeToken splits a line of code into strings, words and everything else.
+var codeToken = regexp.MustCompile(`"(?:[^"\\]|\\.)*"?|'(?:[^'\\]|\\.)*'?|` + "`[^`]*`?" + `|[A-Za-z_][A-Za-z0-9_]*|[0-9][0-9_.xXa-fA-F]*|.`)
+
+// highlightCode colors one line of code: comments, strings, numbers and
+// the language's keywords. Diffs color added and removed lines instead.
+func highlightCode(line string, language codeLanguage) string {
+	if language.extension == ".diff" {
+		switch {
+		case strings.HasPrefix(line, "+"):
+			return ansiString + line + ansiReset
+		case strings.HasPrefix(line, "-"):
+			return ansiRemoved + line + ansiReset
+		case strings.HasPrefix(line, "@@"):
+			return ansiKeyword + line + ansiReset
+		}
+		return line
+	}
+	var b strings.Builder
+	for _, m := range codeToken.FindAllStringIndex(line, -1) {
+		if language.comment != "" && strings.HasPrefix(line[m[0]:], language.comment) {
+			b.WriteString(ansiComment + line[m[0]:] + ansiReset)
+			break
+		}
+		token := line[m[0]:m[1]]
+		switch {
+		case strings.ContainsAny(token[:1], "\"'`"):
+			b.WriteString(ansiString + token + ansiReset)
+		case numberToken.MatchString(token):
+			b.WriteString(ansiNumber + token + ansiReset)
+		case isKeyword(token, language):
+			b.WriteString(ansiKeyword + token + ansiReset)
+		default:
+			b.WriteString(token)
+		}
+	}
+	return b.String()
+}
+
+// isKeyword reports whether word is one of the language's keywords. SQL
+// keywords are matched in any case.
+func isKeyword(word string, language codeLanguage) bool {
+	for _, keyword := range language.keywords {
+		if word == keyword || (language.extension == ".sql" && strings.EqualFold(word, keyword)) {
+			return true
+		}
+	}
+	return false
+}
+
+// isTerminal reports whether w writes to a terminal.
+func isTerminal(w io.Writer) bool {
+	file, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// useColor decides whether to style output for mode auto, always or never.
+// Auto styles output to a terminal unless NO_COLOR is set or the terminal
+// is dumb.
+func useColor(mode string, out io.Writer) (bool, error) {
+	switch mode {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "", "auto":
+		return isTerminal(out) && os.Getenv("NO_COLOR") == "" && os.Getenv("TERM") != "dumb", nil
+	}
+	return false, fmt.Errorf("unknown color mode %q (want auto, always or never)", mode)
+}
+
+// pagerCommand is $ESCALATOR_PAGER or $PAGER, or less, which exits at once
+// when the text fits on one screen.
+func pagerCommand() []string {
+	for _, name := range []string{"ESCALATOR_PAGER", "PAGER"} {
+		if value, ok := os.LookupEnv(name); ok {
+			return strings.Fields(value)
+		}
+	}
+	return []string{"less", "-FRX"}
+}
+
+// pageOutput writes text to out, through the pager when out is a terminal
+// and paging is wanted. A pager that can't be started is skipped.
+func pageOutput(out io.Writer, text string, page bool) {
+	command := pagerCommand()
+	if page && isTerminal(out) && len(command) > 0 && command[0] != "cat" {
+		cmd := exec.Command(command[0], command[1:]...)
+		cmd.Stdin = strings.NewReader(text)
+		cmd.Stdout = out
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err == nil {
+			return
+		} else if _, ok := err.(*exec.ExitError); ok {
+			// The pager ran; quitting it early isn't a reason to print
+			// everything again.
+			return
+		}
+	}
+	io.WriteString(out, text)
+}
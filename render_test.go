@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const answerWithCode = "## Fix\n\nBatch the **queries**, with `IN`:\n\n```go\n// Load orders at once.\nrows, err := db.Query(\"SELECT * FROM orders WHERE id IN (?)\", ids)\nif err != nil {\n\treturn 0, err\n}\n```\n\n```sql\nCREATE INDEX orders_customer ON orders (customer_id);\n```\n"
+
+func TestExtractCodeBlocks(t *testing.T) {
+	blocks := extractCodeBlocks(answerWithCode)
+	if len(blocks) != 2 || blocks[0].Language != "go" || blocks[1].Language != "sql" {
+		t.Fatalf("Expected a Go and an SQL block, got %+v", blocks)
+	}
+	if !strings.HasPrefix(blocks[0].Code, "// Load orders") || !strings.HasSuffix(blocks[0].Code, "}\n") {
+		t.Errorf("Expected the block's code without its fences, got %q", blocks[0].Code)
+	}
+
+	paths, err := saveCodeBlocks(t.TempDir(), "abc", blocks)
+	if err != nil || len(paths) != 2 || filepath.Base(paths[0]) != "abc-1.go" || filepath.Base(paths[1]) != "abc-2.sql" {
+		t.Fatalf("Expected a file per block named after the escalation, got %v, %v", paths, err)
+	}
+	if code, _ := os.ReadFile(paths[1]); string(code) != blocks[1].Code {
+		t.Errorf("Expected the block's code in its file, got %q", code)
+	}
+}
+
+func TestRenderMarkdown(t *testing.T) {
+	got := renderMarkdown(answerWithCode)
+	for _, want := range []string{
+		ansiBold + "## Fix" + ansiReset,
+		ansiBold + "**queries**" + ansiReset,
+		ansiCode + "`IN`" + ansiReset,
+		ansiComment + "// Load orders at once." + ansiReset,
+		ansiKeyword + "if" + ansiReset,
+		ansiString + `"SELECT * FROM orders WHERE id IN (?)"` + ansiReset,
+		ansiNumber + "0" + ansiReset,
+		ansiKeyword + "CREATE" + ansiReset,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Expected %q in the rendered answer:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, ansiKeyword+"SELECT") {
+		t.Error("Expected keywords inside strings to be left as part of the string")
+	}
+}
+
+func TestRunHistoryCommand_ShowSavesCode(t *testing.T) {
+	db := filepath.Join(t.TempDir(), "history.db")
+	store, err := OpenHistory(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := store.Record(EscalationRecord{Tool: "get_help", Question: "Why is checkout slow?"}, "p", &Completion{Answer: answerWithCode, Model: "o3"}, time.Second)
+	store.Close()
+
+	dir := filepath.Join(t.TempDir(), "code")
+	var out bytes.Buffer
+	if code := runHistoryCommand([]string{"show", "-db", db, "-save-code", dir, id}, &out); code != 0 {
+		t.Fatalf("Expected show to succeed, got %d: %s", code, out.String())
+	}
+	if !strings.Contains(out.String(), "Saved 2 code blocks") || !strings.Contains(out.String(), filepath.Join(dir, id+"-1.go")) {
+		t.Errorf("Expected the saved files listed, got %q", out.String())
+	}
+	if strings.Contains(out.String(), "\x1b[") {
+		t.Error("Expected no color when the output isn't a terminal")
+	}
+
+	out.Reset()
+	runHistoryCommand([]string{"show", "-db", db, "-color", "always", id}, &out)
+	if !strings.Contains(out.String(), ansiKeyword+"if"+ansiReset) {
+		t.Errorf("Expected the answer highlighted with -color always, got %q", out.String())
+	}
+}
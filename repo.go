@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// maxRepoFileSize skips files too large to be useful context.
+	maxRepoFileSize = 1 << 20
+
+	// maxRepoFiles bounds a tree walk so a huge checkout can't stall a call.
+	maxRepoFiles = 50000
+)
+
+// Repository reads source files from a local checkout so agents can name
+// files instead of pasting their contents into relevant_code. Files
+// ignored by .gitignore, and the .git directory, are never read.
+type Repository struct {
+	root string
+}
+
+// OpenRepository opens the checkout at root.
+func OpenRepository(root string) (*Repository, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	if abs, err = filepath.EvalSymlinks(abs); err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", root)
+	}
+	return &Repository{root: abs}, nil
+}
+
+// Root returns the absolute path of the checkout.
+func (r *Repository) Root() string {
+	return r.root
+}
+
+// Files lists the repository's files that aren't ignored, as slash-separated
+// paths relative to the root, sorted.
+func (r *Repository) Files() ([]string, error) {
+	var files []string
+	err := r.walk(".", nil, &files)
+	sort.Strings(files)
+	return files, err
+}
+
+func (r *Repository) walk(dir string, rules []ignoreRule, files *[]string) error {
+	full := filepath.Join(r.root, filepath.FromSlash(dir))
+	if own, err := readIgnoreFile(filepath.Join(full, ".gitignore"), dir); err == nil {
+		rules = append(rules[:len(rules):len(rules)], own...)
+	}
+
+	entries, err := os.ReadDir(full)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		rel := path.Join(dir, entry.Name())
+		isDir := entry.IsDir()
+		if entry.Name() == ".git" || ignored(rules, rel, isDir) {
+			continue
+		}
+		if isDir {
+			if err := r.walk(rel, rules, files); err != nil {
+				return err
+			}
+			continue
+		}
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		if len(*files) >= maxRepoFiles {
+			return fmt.Errorf("repository has more than %d files", maxRepoFiles)
+		}
+		*files = append(*files, rel)
+	}
+	return nil
+}
+
+// Resolve expands paths and globs (relative to the root; ** matches any
+// number of directories) into the files they name, in order and without
+// duplicates. Each entry must name at least one file.
+func (r *Repository) Resolve(patterns []string) ([]string, error) {
+	var files, all []string
+	seen := make(map[string]bool)
+	for _, pattern := range patterns {
+		clean := path.Clean(strings.TrimPrefix(filepath.ToSlash(pattern), "/"))
+		if clean == ".." || strings.HasPrefix(clean, "../") {
+			return nil, fmt.Errorf("%s is outside the repository", pattern)
+		}
+
+		var matched []string
+		if strings.ContainsAny(clean, "*?[") {
+			if all == nil {
+				var err error
+				if all, err = r.Files(); err != nil {
+					return nil, err
+				}
+			}
+			for _, file := range all {
+				if matchGlob(clean, file) {
+					matched = append(matched, file)
+				}
+			}
+		} else if r.readable(clean) {
+			matched = []string{clean}
+		}
+		if len(matched) == 0 {
+			return nil, fmt.Errorf("no files match %s", pattern)
+		}
+
+		for _, file := range matched {
+			if !seen[file] {
+				seen[file] = true
+				files = append(files, file)
+			}
+		}
+	}
+	return files, nil
+}
+
+// readable reports whether rel is a regular file that isn't ignored.
+func (r *Repository) readable(rel string) bool {
+	full := filepath.Join(r.root, filepath.FromSlash(rel))
+	info, err := os.Stat(full)
+	if err != nil || !info.Mode().IsRegular() {
+		return false
+	}
+	// Symlinks mustn't lead out of the checkout.
+	real, err := filepath.EvalSymlinks(full)
+	if err != nil || !strings.HasPrefix(real, r.root+string(filepath.Separator)) {
+		return false
+	}
+
+	// Check every directory on the way down for ignore rules.
+	var rules []ignoreRule
+	dir := "."
+	for _, part := range strings.Split(rel, "/") {
+		if own, err := readIgnoreFile(filepath.Join(r.root, filepath.FromSlash(dir), ".gitignore"), dir); err == nil {
+			rules = append(rules, own...)
+		}
+		next := path.Join(dir, part)
+		if part == ".git" || ignored(rules, next, next != rel) {
+			return false
+		}
+		dir = next
+	}
+	return true
+}
+
+// ReadFile returns a file's contents, refusing binary and oversized files.
+func (r *Repository) ReadFile(rel string) (string, error) {
+	full := filepath.Join(r.root, filepath.FromSlash(rel))
+	info, err := os.Stat(full)
+	if err != nil {
+		return "", err
+	}
+	if info.Size() > maxRepoFileSize {
+		return "", fmt.Errorf("%s is larger than %d bytes", rel, maxRepoFileSize)
+	}
+	data, err := os.ReadFile(full)
+	if err != nil {
+		return "", err
+	}
+	if bytes.IndexByte(data[:min(len(data), 8000)], 0) >= 0 {
+		return "", fmt.Errorf("%s is a binary file", rel)
+	}
+	return string(data), nil
+}
+
+// ignoreRule is one .gitignore pattern, relative to the directory holding
+// the .gitignore.
+type ignoreRule struct {
+	base     string
+	pattern  string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+func readIgnoreFile(file, base string) ([]ignoreRule, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rules []ignoreRule
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule := ignoreRule{base: base}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+		line = strings.TrimPrefix(line, "\\")
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		// A slash anywhere but the end anchors the pattern to base.
+		if strings.Contains(line, "/") {
+			rule.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		if line != "" {
+			rule.pattern = line
+			rules = append(rules, rule)
+		}
+	}
+	return rules, scanner.Err()
+}
+
+// ignored applies the rules in order, so later (deeper) rules override
+// earlier ones, as in git.
+func ignored(rules []ignoreRule, rel string, isDir bool) bool {
+	result := false
+	for _, rule := range rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		sub := rel
+		if rule.base != "." {
+			var ok bool
+			if sub, ok = strings.CutPrefix(rel, rule.base+"/"); !ok {
+				continue
+			}
+		}
+		var match bool
+		if rule.anchored {
+			match = matchGlob(rule.pattern, sub)
+		} else {
+			match, _ = path.Match(rule.pattern, path.Base(sub))
+		}
+		if match {
+			result = !rule.negate
+		}
+	}
+	return result
+}
+
+// matchGlob matches a slash-separated path against a pattern in which **
+// stands for any number of directories and other segments follow
+// path.Match.
+func matchGlob(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
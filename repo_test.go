@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// writeTree creates files (slash-separated path to contents) under a new
+// temporary directory.
+func writeTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		full := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func testRepository(t *testing.T) *Repository {
+	t.Helper()
+	root := writeTree(t, map[string]string{
+		".gitignore":                    "*.log\nbuild/\n/secrets.env\n!keep.log\n",
+		"main.go":                       "package main\n",
+		"keep.log":                      "kept\n",
+		"debug.log":                     "ignored\n",
+		"secrets.env":                   "TOKEN=x\n",
+		"build/out.go":                  "package build\n",
+		"internal/store/a.go":           "package store\n",
+		"internal/store/b.go":           "package store\n",
+		"internal/store/.gitignore":     "generated_*.go\n",
+		"internal/store/generated_c.go": "package store\n",
+		"internal/api/handler.go":       "package api\n",
+		".git/config":                   "[core]\n",
+	})
+	repo, err := OpenRepository(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repo
+}
+
+func TestRepository_Files(t *testing.T) {
+	files, err := testRepository(t).Files()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	want := ".gitignore internal/api/handler.go internal/store/.gitignore internal/store/a.go internal/store/b.go keep.log main.go"
+	if got := strings.Join(files, " "); got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestRepository_Resolve(t *testing.T) {
+	repo := testRepository(t)
+
+	files, err := repo.Resolve([]string{"internal/store/*.go", "**/handler.go", "internal/store/a.go", "/main.go"})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if got := strings.Join(files, " "); got != "internal/store/a.go internal/store/b.go internal/api/handler.go main.go" {
+		t.Errorf("Expected ordered, deduplicated files, got %q", got)
+	}
+
+	for _, pattern := range []string{"../outside.go", "missing.go", "debug.log", "secrets.env", "build/out.go", ".git/config", "internal/store/generated_c.go", "**/*.rs"} {
+		if _, err := repo.Resolve([]string{pattern}); err == nil {
+			t.Errorf("Expected an error resolving %q", pattern)
+		}
+	}
+}
+
+func TestRepository_SymlinkOutside(t *testing.T) {
+	repo := testRepository(t)
+	outside := writeTree(t, map[string]string{"secret.txt": "secret"})
+	if err := os.Symlink(filepath.Join(outside, "secret.txt"), filepath.Join(repo.Root(), "link.txt")); err != nil {
+		t.Skip("symlinks not supported")
+	}
+	if _, err := repo.Resolve([]string{"link.txt"}); err == nil {
+		t.Error("Expected a symlink out of the repository to be refused")
+	}
+}
+
+func TestRepository_ReadFile_Binary(t *testing.T) {
+	repo, _ := OpenRepository(writeTree(t, map[string]string{"image.png": "\x89PNG\x00\x01"}))
+	if _, err := repo.ReadFile("image.png"); err == nil {
+		t.Error("Expected binary files to be refused")
+	}
+}
+
+func TestGetHelpTool_Call_Files(t *testing.T) {
+	var prompt string
+	tool := NewGetHelpTool("", "o3").WithRepository(testRepository(t))
+	tool.LLM().WithProvider(CompletionFunc(func(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error) {
+		prompt = req.Messages[len(req.Messages)-1].Content
+		return &Completion{Answer: "answer", Model: req.Model}, nil
+	}))
+
+	if _, ok := tool.Schema()["properties"].(map[string]interface{})["files"]; !ok {
+		t.Error("Expected the files argument in the schema")
+	}
+
+	content, err := tool.Call(map[string]interface{}{
+		"question": "q",
+		"summary":  "s",
+		"files":    []interface{}{"internal/store/*.go"},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if !strings.Contains(prompt, "**File internal/store/a.go:**\n```\npackage store\n") || !strings.Contains(prompt, "internal/store/b.go") {
+		t.Errorf("Expected the files in the prompt, got %q", prompt)
+	}
+	var names []string
+	for _, section := range content[0]["_meta"].(map[string]interface{})["context_usage"].(*ContextUsage).Sections {
+		names = append(names, section.Name)
+	}
+	if !strings.Contains(strings.Join(names, ","), "file internal/store/a.go,file internal/store/b.go") {
+		t.Errorf("Expected a section per file, got %v", names)
+	}
+
+	if _, err := tool.Call(map[string]interface{}{"question": "q", "summary": "s", "files": []interface{}{"nope/*.go"}}); err == nil {
+		t.Error("Expected an error for files matching nothing")
+	}
+	if _, err := NewGetHelpTool("", "o3").Call(map[string]interface{}{"question": "q", "summary": "s", "files": []interface{}{"a.go"}}); err == nil {
+		t.Error("Expected an error when no repository is configured")
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	// maxToolFileLines bounds how much of a file read_file returns at once;
+	// the model can ask for the rest by line range.
+	maxToolFileLines = 400
+	// maxToolGrepMatches bounds grep's output.
+	maxToolGrepMatches = 100
+	// maxToolDirEntries bounds list_dir's output.
+	maxToolDirEntries = 500
+)
+
+// RepoTools lets the architect model explore the repository itself with
+// function calls (read_file, list_dir and grep) instead of relying on the
+// files picked for the prompt. Calls run against the Repository, so the
+// same rules apply as for the files argument: nothing outside the
+// checkout, ignored by .gitignore, binary or oversized is read.
+type RepoTools struct {
+	repo     *Repository
+	maxSteps int
+}
+
+// NewRepoTools answers up to maxSteps rounds of tool calls before asking
+// the model to answer with what it has.
+func NewRepoTools(repo *Repository, maxSteps int) *RepoTools {
+	return &RepoTools{repo: repo, maxSteps: maxSteps}
+}
+
+var repoToolDefinitions = []openai.Tool{
+	{
+		Type: openai.ToolTypeFunction,
+		Function: &openai.FunctionDefinition{
+			Name:        "read_file",
+			Description: fmt.Sprintf("Read a file from the repository, with line numbers. At most %d lines are returned per call; use start_line to read further.", maxToolFileLines),
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"path":       map[string]interface{}{"type": "string", "description": "Path relative to the repository root"},
+					"start_line": map[string]interface{}{"type": "integer", "description": "First line to return, starting at 1 (optional)"},
+					"end_line":   map[string]interface{}{"type": "integer", "description": "Last line to return (optional)"},
+				},
+				"required": []string{"path"},
+			},
+		},
+	},
+	{
+		Type: openai.ToolTypeFunction,
+		Function: &openai.FunctionDefinition{
+			Name:        "list_dir",
+			Description: "List the files and directories in a repository directory. Directories end with a slash.",
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"path": map[string]interface{}{"type": "string", "description": "Directory relative to the repository root; empty or \".\" for the root"},
+				},
+			},
+		},
+	},
+	{
+		Type: openai.ToolTypeFunction,
+		Function: &openai.FunctionDefinition{
+			Name:        "grep",
+			Description: fmt.Sprintf("Search the repository's files for a regular expression (RE2 syntax). Returns up to %d matching lines as path:line: text.", maxToolGrepMatches),
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"pattern": map[string]interface{}{"type": "string", "description": "Regular expression to search for"},
+					"glob":    map[string]interface{}{"type": "string", "description": "Only search files matching this glob, e.g. \"**/*.go\" (optional)"},
+				},
+				"required": []string{"pattern"},
+			},
+		},
+	},
+}
+
+// Generate asks llm to answer req, running the tool calls it makes and
+// sending the results back until it answers. Token counts cover every
+// round.
+func (r *RepoTools) Generate(ctx context.Context, llm *LLM, req openai.ChatCompletionRequest, onDelta func(string)) (*Completion, error) {
+	req.Tools = repoToolDefinitions
+	req.Messages = append([]openai.ChatCompletionMessage(nil), req.Messages...)
+
+	var promptTokens, completionTokens int
+	for step := 0; ; step++ {
+		if step == r.maxSteps {
+			// Out of steps: the model has to answer with what it has.
+			req.ToolChoice = "none"
+		}
+		completion, err := llm.Generate(ctx, req, onDelta)
+		if err != nil {
+			return nil, err
+		}
+		promptTokens += completion.PromptTokens
+		completionTokens += completion.CompletionTokens
+		if len(completion.ToolCalls) == 0 || step == r.maxSteps {
+			completion.PromptTokens = promptTokens
+			completion.CompletionTokens = completionTokens
+			completion.ToolCalls = nil
+			return completion, nil
+		}
+
+		req.Messages = append(req.Messages, openai.ChatCompletionMessage{
+			Role:      openai.ChatMessageRoleAssistant,
+			Content:   completion.Answer,
+			ToolCalls: completion.ToolCalls,
+		})
+		for _, call := range completion.ToolCalls {
+			result := r.call(call.Function.Name, call.Function.Arguments)
+			req.Messages = append(req.Messages, openai.ChatCompletionMessage{
+				Role:       openai.ChatMessageRoleTool,
+				Content:    result,
+				ToolCallID: call.ID,
+			})
+		}
+	}
+}
+
+// call runs one tool call and returns its result. Errors are returned to
+// the model as text so it can correct itself.
+func (r *RepoTools) call(name, arguments string) string {
+	var args struct {
+		Path      string `json:"path"`
+		StartLine int    `json:"start_line"`
+		EndLine   int    `json:"end_line"`
+		Pattern   string `json:"pattern"`
+		Glob      string `json:"glob"`
+	}
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return fmt.Sprintf("Error: invalid arguments: %v", err)
+	}
+
+	var result string
+	var err error
+	switch name {
+	case "read_file":
+		result, err = r.readFile(args.Path, args.StartLine, args.EndLine)
+	case "list_dir":
+		result, err = r.listDir(args.Path)
+	case "grep":
+		result, err = r.grep(args.Pattern, args.Glob)
+	default:
+		err = fmt.Errorf("unknown tool %q", name)
+	}
+	slog.Debug("Model called a repository tool", "repo_tool", name, "arguments", arguments)
+	if err != nil {
+		return "Error: " + err.Error()
+	}
+	return result
+}
+
+func (r *RepoTools) readFile(file string, start, end int) (string, error) {
+	if file == "" || strings.ContainsAny(file, "*?[") {
+		return "", fmt.Errorf("path must name a single file")
+	}
+	files, err := r.repo.Resolve([]string{file})
+	if err != nil {
+		return "", err
+	}
+	content, err := r.repo.ReadFile(files[0])
+	if err != nil {
+		return "", err
+	}
+
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	start = max(start, 1)
+	if end <= 0 || end > len(lines) {
+		end = len(lines)
+	}
+	end = min(end, start+maxToolFileLines-1)
+	if start > len(lines) {
+		return "", fmt.Errorf("%s has only %d lines", files[0], len(lines))
+	}
+
+	var b strings.Builder
+	for i := start; i <= end; i++ {
+		fmt.Fprintf(&b, "%d\t%s\n", i, lines[i-1])
+	}
+	if end < len(lines) {
+		fmt.Fprintf(&b, "(%d more lines; read from start_line %d)\n", len(lines)-end, end+1)
+	}
+	return b.String(), nil
+}
+
+func (r *RepoTools) listDir(dir string) (string, error) {
+	dir = path.Clean(strings.TrimPrefix(dir, "/"))
+	if dir == ".." || strings.HasPrefix(dir, "../") {
+		return "", fmt.Errorf("%s is outside the repository", dir)
+	}
+	files, err := r.repo.Files()
+	if err != nil {
+		return "", err
+	}
+	prefix := dir + "/"
+	if dir == "." {
+		prefix = ""
+	}
+
+	seen := make(map[string]bool)
+	var entries []string
+	for _, file := range files {
+		rest, ok := strings.CutPrefix(file, prefix)
+		if !ok {
+			continue
+		}
+		entry := rest
+		if i := strings.IndexByte(rest, '/'); i >= 0 {
+			entry = rest[:i+1]
+		}
+		if !seen[entry] {
+			seen[entry] = true
+			entries = append(entries, entry)
+		}
+	}
+	if len(entries) == 0 {
+		return "", fmt.Errorf("no files in %s", dir)
+	}
+	sort.Strings(entries)
+	if len(entries) > maxToolDirEntries {
+		return strings.Join(entries[:maxToolDirEntries], "\n") + fmt.Sprintf("\n(%d more entries)", len(entries)-maxToolDirEntries), nil
+	}
+	return strings.Join(entries, "\n"), nil
+}
+
+func (r *RepoTools) grep(pattern, glob string) (string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", err
+	}
+	files, err := r.repo.Files()
+	if err != nil {
+		return "", err
+	}
+
+	var matches []string
+	for _, file := range files {
+		if glob != "" && !matchGlob(glob, file) {
+			continue
+		}
+		content, err := r.repo.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		for i, line := range strings.Split(content, "\n") {
+			if !re.MatchString(line) {
+				continue
+			}
+			if len(matches) == maxToolGrepMatches {
+				return strings.Join(matches, "\n") + "\n(more matches; narrow the pattern or glob)", nil
+			}
+			matches = append(matches, fmt.Sprintf("%s:%d: %s", file, i+1, truncateMiddle(line, 300)))
+		}
+	}
+	if len(matches) == 0 {
+		return "No matches.", nil
+	}
+	return strings.Join(matches, "\n"), nil
+}
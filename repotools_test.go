@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func toolCall(id, name, arguments string) openai.ToolCall {
+	return openai.ToolCall{
+		ID:       id,
+		Type:     openai.ToolTypeFunction,
+		Function: openai.FunctionCall{Name: name, Arguments: arguments},
+	}
+}
+
+func TestRepoTools_Call(t *testing.T) {
+	repo, err := OpenRepository(writeTree(t, map[string]string{
+		".gitignore":          "secrets.env\n",
+		"secrets.env":         "TOKEN=x\n",
+		"main.go":             "package main\n\nfunc main() {\n\treserve()\n}\n",
+		"internal/store/a.go": "package store\n\nfunc reserve() {}\n",
+		"internal/api/b.go":   "package api\n",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tools := NewRepoTools(repo, 8)
+
+	tests := []struct {
+		name, arguments, want string
+	}{
+		{"read_file", `{"path": "main.go"}`, "1\tpackage main\n2\t\n3\tfunc main() {\n4\t\treserve()\n5\t}\n"},
+		{"read_file", `{"path": "main.go", "start_line": 3, "end_line": 3}`, "3\tfunc main() {\n(2 more lines; read from start_line 4)\n"},
+		{"read_file", `{"path": "secrets.env"}`, "Error: "},
+		{"read_file", `{"path": "../outside.go"}`, "Error: "},
+		{"read_file", `{"path": "internal/*/a.go"}`, "Error: path must name a single file"},
+		{"list_dir", `{}`, ".gitignore\ninternal/\nmain.go"},
+		{"list_dir", `{"path": "internal"}`, "api/\nstore/"},
+		{"list_dir", `{"path": "../"}`, "Error: "},
+		{"grep", `{"pattern": "reserve\\("}`, "internal/store/a.go:3: func reserve() {}\nmain.go:4: \treserve()"},
+		{"grep", `{"pattern": "reserve", "glob": "internal/**"}`, "internal/store/a.go:3: func reserve() {}"},
+		{"grep", `{"pattern": "nothing here"}`, "No matches."},
+		{"grep", `{"pattern": "("}`, "Error: "},
+		{"delete_file", `{"path": "main.go"}`, `Error: unknown tool "delete_file"`},
+		{"read_file", `not json`, "Error: invalid arguments"},
+	}
+	for _, tt := range tests {
+		got := tools.call(tt.name, tt.arguments)
+		if strings.HasPrefix(tt.want, "Error: ") {
+			if !strings.HasPrefix(got, tt.want) {
+				t.Errorf("%s(%s): expected an error starting %q, got %q", tt.name, tt.arguments, tt.want, got)
+			}
+		} else if got != tt.want {
+			t.Errorf("%s(%s): expected %q, got %q", tt.name, tt.arguments, tt.want, got)
+		}
+	}
+}
+
+func TestGetHelpTool_Call_RepoTools(t *testing.T) {
+	repo, err := OpenRepository(writeTree(t, map[string]string{
+		"internal/store/reserve.go": "package store\n\nfunc Reserve() { mu.Lock(); db.Lock() }\n",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var requests []openai.ChatCompletionRequest
+	tool := NewGetHelpTool("", "o3").WithRepository(repo).WithRepoTools(NewRepoTools(repo, 8))
+	tool.LLM().WithProvider(CompletionFunc(func(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error) {
+		requests = append(requests, req)
+		if len(requests) == 1 {
+			return &Completion{
+				Model:            req.Model,
+				PromptTokens:     100,
+				CompletionTokens: 10,
+				ToolCalls: []openai.ToolCall{
+					toolCall("call_1", "grep", `{"pattern": "Lock"}`),
+					toolCall("call_2", "read_file", `{"path": "internal/store/reserve.go"}`),
+				},
+			}, nil
+		}
+		return &Completion{Answer: "Lock order differs.", Model: req.Model, PromptTokens: 200, CompletionTokens: 20}, nil
+	}))
+
+	content, err := tool.Call(map[string]interface{}{"question": "Why does Reserve deadlock?", "summary": "s"})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if !strings.Contains(content[0]["text"].(string), "Lock order differs.") {
+		t.Errorf("Expected the final answer, got %v", content)
+	}
+	if len(requests) != 2 || len(requests[0].Tools) != 3 {
+		t.Fatalf("Expected two requests offering the tools, got %d", len(requests))
+	}
+
+	messages := requests[1].Messages
+	n := len(messages)
+	if messages[n-3].Role != openai.ChatMessageRoleAssistant || len(messages[n-3].ToolCalls) != 2 {
+		t.Errorf("Expected the model's tool calls to be sent back, got %+v", messages[n-3])
+	}
+	grep, read := messages[n-2], messages[n-1]
+	if grep.Role != openai.ChatMessageRoleTool || grep.ToolCallID != "call_1" || grep.Content != "internal/store/reserve.go:3: func Reserve() { mu.Lock(); db.Lock() }" {
+		t.Errorf("Unexpected grep result %+v", grep)
+	}
+	if read.ToolCallID != "call_2" || !strings.HasPrefix(read.Content, "1\tpackage store\n") {
+		t.Errorf("Unexpected read_file result %+v", read)
+	}
+
+	usage := content[0]["_meta"].(map[string]interface{})["usage"].(*TokenUsage)
+	if usage.PromptTokens != 300 || usage.CompletionTokens != 30 {
+		t.Errorf("Expected the tokens of both rounds, got %+v", usage)
+	}
+}
+
+func TestRepoTools_Generate_MaxSteps(t *testing.T) {
+	repo := testRepository(t)
+	var choices []interface{}
+	llm := NewLLM("o3").WithProvider(CompletionFunc(func(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error) {
+		choices = append(choices, req.ToolChoice)
+		if req.ToolChoice == "none" {
+			return &Completion{Answer: "best guess", Model: req.Model}, nil
+		}
+		return &Completion{Model: req.Model, ToolCalls: []openai.ToolCall{toolCall("call", "list_dir", `{}`)}}, nil
+	}))
+
+	completion, err := NewRepoTools(repo, 2).Generate(context.Background(), llm, userRequest("q"), nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if completion.Answer != "best guess" || len(choices) != 3 || choices[2] != "none" {
+		t.Errorf("Expected an answer to be forced after two rounds, got %q after %v", completion.Answer, choices)
+	}
+}
+
+// toolCallStreamProvider streams one tool call split across deltas, as
+// OpenAI does.
+type toolCallStreamProvider struct{}
+
+func (toolCallStreamProvider) Stream(ctx context.Context, req openai.ChatCompletionRequest) (DeltaStream, error) {
+	zero := 0
+	return &sliceStream{deltas: []Delta{
+		{ToolCalls: []openai.ToolCall{{Index: &zero, ID: "call_1", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "read_file"}}}},
+		{ToolCalls: []openai.ToolCall{{Index: &zero, Function: openai.FunctionCall{Arguments: `{"path": `}}}},
+		{ToolCalls: []openai.ToolCall{{Index: &zero, Function: openai.FunctionCall{Arguments: `"main.go"}`}}}},
+		{PromptTokens: 10, CompletionTokens: 5},
+	}}, nil
+}
+
+func TestLLM_Generate_StreamedToolCalls(t *testing.T) {
+	llm := NewLLM("o3").WithProvider(toolCallStreamProvider{})
+	completion, err := llm.Generate(context.Background(), userRequest("q"), func(string) {})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	want := toolCall("call_1", "read_file", `{"path": "main.go"}`)
+	if len(completion.ToolCalls) != 1 || completion.ToolCalls[0].ID != want.ID || completion.ToolCalls[0].Function != want.Function {
+		t.Errorf("Expected the pieces merged into %+v, got %+v", want, completion.ToolCalls)
+	}
+}
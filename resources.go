@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ResourceReader reads resources exposed by the connected MCP client, such as
+// open editor files or the current selection.
+type ResourceReader interface {
+	ReadResource(ctx context.Context, uri string) (string, error)
+}
+
+// ReadResource asks the client for a resource over the protocol. It fails
+// when the transport cannot carry client requests or the client did not
+// declare the resources capability during initialize.
+func (s *MCPServer) ReadResource(ctx context.Context, uri string) (string, error) {
+	if s.request == nil {
+		return "", fmt.Errorf("transport does not support reading client resources")
+	}
+	if !s.clientSupports("resources") {
+		return "", fmt.Errorf("client does not expose resources")
+	}
+
+	raw, err := s.request(ctx, "resources/read", map[string]interface{}{"uri": uri})
+	if err != nil {
+		return "", err
+	}
+
+	var result struct {
+		Contents []struct {
+			URI  string `json:"uri"`
+			Text string `json:"text"`
+			Blob string `json:"blob"`
+		} `json:"contents"`
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return "", fmt.Errorf("couldn't decode resources/read result: %w", err)
+	}
+
+	var texts []string
+	for _, content := range result.Contents {
+		if content.Text != "" {
+			texts = append(texts, content.Text)
+		}
+	}
+	if len(texts) == 0 {
+		return "", fmt.Errorf("resource %s has no text content", uri)
+	}
+
+	return strings.Join(texts, "\n"), nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// resourceTool reads a resource from the client while it is being called.
+type resourceTool struct {
+	reader ResourceReader
+}
+
+func (r *resourceTool) Name() string        { return "read_it" }
+func (r *resourceTool) Description() string { return "Reads a client resource" }
+func (r *resourceTool) Schema() map[string]interface{} {
+	return map[string]interface{}{"type": "object"}
+}
+
+func (r *resourceTool) Call(arguments map[string]interface{}) ([]map[string]interface{}, error) {
+	text, err := r.reader.ReadResource(context.Background(), arguments["uri"].(string))
+	if err != nil {
+		return textContent(err.Error()), err
+	}
+	return textContent(text), nil
+}
+
+func TestMCPServer_ReadResource_RoundTrip(t *testing.T) {
+	server := NewMCPServer("test", "1.0.0")
+	server.RegisterTool(&resourceTool{reader: server})
+
+	clientOut, serverIn := io.Pipe()
+	serverOut, clientIn := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		server.Serve(clientOut, clientIn)
+		clientIn.Close()
+		close(done)
+	}()
+
+	send := func(msg string) {
+		if _, err := io.WriteString(serverIn, msg+"\n"); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+	}
+	lines := bufio.NewScanner(serverOut)
+	next := func() map[string]interface{} {
+		if !lines.Scan() {
+			t.Fatal("Expected another message from server")
+		}
+		var msg map[string]interface{}
+		json.Unmarshal(lines.Bytes(), &msg)
+		return msg
+	}
+
+	send(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"capabilities":{"resources":{}}}}`)
+	next()
+	send(`{"jsonrpc":"2.0","method":"notifications/initialized"}`)
+	send(`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"read_it","arguments":{"uri":"file:///main.go"}}}`)
+
+	// The tool's resource read arrives as a request to the client.
+	readReq := next()
+	if readReq["method"] != "resources/read" {
+		t.Fatalf("Expected resources/read request, got %v", readReq)
+	}
+	if readReq["params"].(map[string]interface{})["uri"] != "file:///main.go" {
+		t.Errorf("Expected uri file:///main.go, got %v", readReq["params"])
+	}
+	id, _ := json.Marshal(readReq["id"])
+	send(`{"jsonrpc":"2.0","id":` + string(id) + `,"result":{"contents":[{"uri":"file:///main.go","text":"package main"}]}}`)
+
+	resp := next()
+	if resp["id"] != float64(2) {
+		t.Fatalf("Expected response to request 2, got %v", resp)
+	}
+	content := resp["result"].(map[string]interface{})["content"].([]interface{})
+	if text := content[0].(map[string]interface{})["text"]; text != "package main" {
+		t.Errorf("Expected resource text in result, got %v", text)
+	}
+
+	serverIn.Close()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected Serve to return after input closed")
+	}
+}
+
+func TestMCPServer_ReadResource_NotSupported(t *testing.T) {
+	server := NewMCPServer("test", "1.0.0")
+
+	if _, err := server.ReadResource(context.Background(), "file:///a"); err == nil {
+		t.Error("Expected error without a bidirectional transport")
+	}
+
+	server.request = func(ctx context.Context, method string, params interface{}) (json.RawMessage, error) {
+		return nil, nil
+	}
+	_, err := server.ReadResource(context.Background(), "file:///a")
+	if err == nil || !strings.Contains(err.Error(), "does not expose resources") {
+		t.Errorf("Expected capability error, got %v", err)
+	}
+}
+
+func TestGetHelpTool_Call_ResourceWithoutReader(t *testing.T) {
+	tool := NewGetHelpTool("", "gpt-4o")
+
+	_, err := tool.Call(map[string]interface{}{
+		"question":      "q",
+		"summary":       "s",
+		"resource_uris": []interface{}{"file:///a.go"},
+	})
+	if err == nil {
+		t.Error("Expected error when resources cannot be read")
+	}
+}
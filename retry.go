@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// RetryPolicy decides which failed model calls are retried, and how long
+// to wait before each retry.
+type RetryPolicy struct {
+	// Attempts is the number of attempts made per model, including the
+	// first.
+	Attempts int
+	// BaseDelay is the wait before the first retry. It doubles with each
+	// retry after that, with jitter.
+	BaseDelay time.Duration
+	// MaxDelay caps the wait, including one a provider asks for with
+	// Retry-After (0 leaves it uncapped).
+	MaxDelay time.Duration
+}
+
+// defaultRetryPolicy makes three attempts per model, waiting about 2s and
+// 4s between them.
+var defaultRetryPolicy = RetryPolicy{Attempts: 3, BaseDelay: 2 * time.Second, MaxDelay: time.Minute}
+
+// delay is the wait before the given retry, counting from 0. A wait the
+// provider asked for is honored; otherwise the backoff is jittered, half
+// of it fixed and half random, so callers that failed together don't
+// retry together.
+func (p RetryPolicy) delay(retry int, retryAfter time.Duration) time.Duration {
+	wait := retryAfter
+	if wait <= 0 {
+		backoff := p.BaseDelay << retry
+		wait = backoff/2 + rand.N(backoff/2+1)
+	}
+	if p.MaxDelay > 0 {
+		wait = min(wait, p.MaxDelay)
+	}
+	return wait
+}
+
+// isRetryable reports whether a failed model call may succeed if it is
+// made again: the provider was rate limited, overloaded or unreachable.
+// Requests refused on their merits, such as a 400 or an invalid API key,
+// fail the same way every time, as does an exhausted quota.
+func isRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) && apiErr.Code == "insufficient_quota" {
+		return false
+	}
+	code, convErr := strconv.Atoi(providerErrorCode(err))
+	if convErr != nil {
+		// Network errors and timeouts have no status.
+		return true
+	}
+	return code == http.StatusRequestTimeout || code == http.StatusTooManyRequests || code >= 500
+}
+
+// sleepContext waits for d, reporting false if ctx is done first.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// retryAfterKey holds, in a model call's context, where the transport
+// notes the wait asked for by a failed response.
+type retryAfterKey struct{}
+
+// withRetryAfter returns a context in which the client's transport records
+// a Retry-After header into the returned duration. The client's errors
+// don't carry the response headers.
+func withRetryAfter(ctx context.Context) (context.Context, *time.Duration) {
+	wait := new(time.Duration)
+	return context.WithValue(ctx, retryAfterKey{}, wait), wait
+}
+
+// retryAfterTransport notes the Retry-After of failed responses for
+// askModel.
+type retryAfterTransport struct {
+	base http.RoundTripper
+}
+
+func (t *retryAfterTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.StatusCode < 400 {
+		return resp, err
+	}
+	if wait, ok := req.Context().Value(retryAfterKey{}).(*time.Duration); ok {
+		*wait = parseRetryAfter(resp.Header, time.Now())
+	}
+	return resp, nil
+}
+
+// parseRetryAfter reads the wait a response asks for: OpenAI's
+// retry-after-ms, or Retry-After in seconds or as an HTTP date. It returns
+// 0 when there is none.
+func parseRetryAfter(header http.Header, now time.Time) time.Duration {
+	if ms, err := strconv.ParseFloat(header.Get("Retry-After-Ms"), 64); err == nil && ms > 0 {
+		return time.Duration(ms * float64(time.Millisecond))
+	}
+	value := header.Get("Retry-After")
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+	return 0
+}
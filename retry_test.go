@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestIsRetryable(t *testing.T) {
+	cases := []struct {
+		err  error
+		want bool
+	}{
+		{&openai.APIError{HTTPStatusCode: 429}, true},
+		{&openai.APIError{HTTPStatusCode: 503}, true},
+		{&openai.APIError{HTTPStatusCode: 400}, false},
+		{&openai.APIError{HTTPStatusCode: 401}, false},
+		{&openai.APIError{HTTPStatusCode: 429, Code: "insufficient_quota"}, false},
+		{errors.New("connection reset by peer"), true},
+		{context.Canceled, false},
+	}
+	for _, c := range cases {
+		if got := isRetryable(c.err); got != c.want {
+			t.Errorf("isRetryable(%v) = %v, want %v", c.err, got, c.want)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	header := http.Header{}
+	if got := parseRetryAfter(header, now); got != 0 {
+		t.Errorf("Expected no wait without a header, got %v", got)
+	}
+	header.Set("Retry-After", "7")
+	if got := parseRetryAfter(header, now); got != 7*time.Second {
+		t.Errorf("Expected 7s, got %v", got)
+	}
+	header.Set("Retry-After", now.Add(30*time.Second).Format(http.TimeFormat))
+	if got := parseRetryAfter(header, now); got != 30*time.Second {
+		t.Errorf("Expected 30s from an HTTP date, got %v", got)
+	}
+	header.Set("Retry-After-Ms", "250")
+	if got := parseRetryAfter(header, now); got != 250*time.Millisecond {
+		t.Errorf("Expected retry-after-ms to take precedence, got %v", got)
+	}
+}
+
+func TestRetryPolicy_Delay(t *testing.T) {
+	policy := RetryPolicy{Attempts: 3, BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+	for retry := range 3 {
+		backoff := time.Second << retry
+		if got := policy.delay(retry, 0); got < backoff/2 || got > backoff {
+			t.Errorf("Expected retry %d to wait between %v and %v, got %v", retry, backoff/2, backoff, got)
+		}
+	}
+	if got := policy.delay(0, 3*time.Second); got != 3*time.Second {
+		t.Errorf("Expected Retry-After to be honored, got %v", got)
+	}
+	if got := policy.delay(0, time.Hour); got != 10*time.Second {
+		t.Errorf("Expected the wait to be capped, got %v", got)
+	}
+}
+
+func TestLLM_Generate_RetryPolicy(t *testing.T) {
+	status := http.StatusTooManyRequests
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Retry-After-Ms", "10")
+		http.Error(w, `{"error":{"message":"nope"}}`, status)
+	}))
+	defer srv.Close()
+
+	// The base delay would outlast the test; Retry-After is honored instead.
+	llm := NewLLM("o3").WithClientOptions(ClientOptions{BaseURL: srv.URL}).
+		WithRetryPolicy(RetryPolicy{Attempts: 4, BaseDelay: time.Hour})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := llm.Ask(ctx, "q", nil); err == nil {
+		t.Fatal("Expected the call to fail")
+	}
+	if calls != 4 {
+		t.Errorf("Expected a rate-limited call to be attempted 4 times, got %d", calls)
+	}
+
+	status, calls = http.StatusUnauthorized, 0
+	if _, err := llm.Ask(ctx, "q", nil); err == nil {
+		t.Fatal("Expected the call to fail")
+	}
+	if calls != 1 {
+		t.Errorf("Expected an invalid API key not to be retried, got %d attempts", calls)
+	}
+}
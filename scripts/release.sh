@@ -0,0 +1,36 @@
+#!/bin/bash
+
+# Build release binaries of the escalator for each supported platform.
+# SQLite is pure Go, so every target cross-compiles without cgo.
+
+set -e
+
+VERSION=${VERSION:-$(git describe --tags --always --dirty)}
+DIST=${DIST:-dist}
+PLATFORMS=${PLATFORMS:-"linux/amd64 linux/arm64 darwin/amd64 darwin/arm64 windows/amd64 windows/arm64"}
+
+mkdir -p "$DIST"
+for platform in $PLATFORMS; do
+    os=${platform%/*}
+    arch=${platform#*/}
+    name="escalator-$VERSION-$os-$arch"
+    binary=escalator
+    if [ "$os" = "windows" ]; then
+        binary=escalator.exe
+    fi
+
+    echo "Building $name..."
+    mkdir -p "$DIST/$name"
+    CGO_ENABLED=0 GOOS=$os GOARCH=$arch go build -trimpath -o "$DIST/$name/$binary" .
+    cp README.md LICENSE "$DIST/$name/"
+
+    if [ "$os" = "windows" ]; then
+        (cd "$DIST" && zip -qr "$name.zip" "$name")
+    else
+        tar -czf "$DIST/$name.tar.gz" -C "$DIST" "$name"
+    fi
+    rm -r "$DIST/$name"
+done
+
+(cd "$DIST" && sha256sum escalator-"$VERSION"-* > "escalator-$VERSION-checksums.txt")
+echo "Release artifacts are in $DIST"
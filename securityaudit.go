@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	maxAuditFiles = 10
+	// maxAuditChars caps the code sent, about 20,000 tokens.
+	maxAuditChars = 80000
+)
+
+// auditCategories are the classes of vulnerability security_audit looks
+// for, with what each covers.
+var auditCategories = map[string]string{
+	"injection": "SQL, command, template and log injection; XSS; unsafe deserialization",
+	"authz":     "broken authentication and authorization: missing checks, IDOR, privilege escalation, session handling",
+	"secrets":   "secrets handling: hard-coded credentials, secrets in logs or errors, weak storage",
+	"crypto":    "unsafe cryptography: weak algorithms, static IVs or nonces, predictable randomness, skipped TLS verification",
+	"ssrf":      "SSRF and path traversal: requests and file access built from user input",
+	"config":    "insecure defaults and configuration: permissive CORS, debug modes, missing limits",
+}
+
+var auditCategoryOrder = []string{"injection", "authz", "secrets", "crypto", "ssrf", "config"}
+
+// auditSeverities rank findings, most severe first.
+var auditSeverities = []string{"critical", "high", "medium", "low"}
+
+var cweLabel = regexp.MustCompile(`^CWE-\d+$`)
+
+const auditSystemPrompt = `You are a senior application security engineer reviewing code before it ships. Report only vulnerabilities the code shows: for each one, the weakness by its CWE ID, where it is, how an attacker would exploit it, and the concrete fix. Do not report style issues or hypothetical problems the code doesn't support, and don't pad the list; an empty list is a valid answer.`
+
+// SecurityAuditTool reviews code for vulnerabilities with a security
+// reviewer's prompt and returns the findings as JSON, labelled with CWE IDs
+// and ordered by severity.
+type SecurityAuditTool struct {
+	llm  *LLM
+	repo *Repository
+}
+
+func NewSecurityAuditTool(llm *LLM) *SecurityAuditTool {
+	return &SecurityAuditTool{llm: llm}
+}
+
+// WithRepository lets callers name the files to audit instead of pasting
+// them.
+func (t *SecurityAuditTool) WithRepository(repo *Repository) *SecurityAuditTool {
+	t.repo = repo
+	return t
+}
+
+// AuditResult is the JSON document returned by security_audit.
+type AuditResult struct {
+	Findings []AuditFinding `json:"findings"`
+	Summary  string         `json:"summary"`
+}
+
+type AuditFinding struct {
+	CWE         string `json:"cwe"`
+	Title       string `json:"title"`
+	Severity    string `json:"severity"`
+	Location    string `json:"location"`
+	Exploit     string `json:"exploit"`
+	Remediation string `json:"remediation"`
+}
+
+func (t *SecurityAuditTool) Name() string {
+	return "security_audit"
+}
+
+func (t *SecurityAuditTool) Category() string {
+	return "code/review"
+}
+
+func (t *SecurityAuditTool) Description() string {
+	return "Audit code for security vulnerabilities (injection, authorization, secrets handling, unsafe crypto): returns findings with CWE labels, severity and remediation (structured JSON)"
+}
+
+func (t *SecurityAuditTool) Schema() map[string]interface{} {
+	properties := map[string]interface{}{
+		"code": map[string]interface{}{
+			"type":        "string",
+			"description": "The code to audit",
+		},
+		"context": map[string]interface{}{
+			"type":        "string",
+			"description": "What the code does and who can reach it, e.g. \"public HTTP handler; callers are authenticated by middleware\" (optional)",
+		},
+		"focus": map[string]interface{}{
+			"type":        "array",
+			"items":       map[string]interface{}{"type": "string", "enum": auditCategoryOrder},
+			"description": "Classes of vulnerability to concentrate on (optional; all of them by default)",
+		},
+	}
+	required := []string{"code"}
+	if t.repo != nil {
+		properties["files"] = map[string]interface{}{
+			"type":        "array",
+			"items":       map[string]interface{}{"type": "string"},
+			"description": fmt.Sprintf("Repository files to audit, as paths or globs relative to the repository root (up to %d files), read by the server instead of pasted into code", maxAuditFiles),
+		}
+		required = nil
+	}
+	schema := map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+	if required != nil {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func (t *SecurityAuditTool) Call(arguments map[string]interface{}) ([]map[string]interface{}, error) {
+	return t.CallContext(context.Background(), arguments, nil)
+}
+
+// CallContext behaves like Call, with the model calls made under ctx, so
+// they join its trace and are logged with its caller.
+func (t *SecurityAuditTool) CallContext(ctx context.Context, arguments map[string]interface{}, _ func(string)) ([]map[string]interface{}, error) {
+	code, _ := arguments["code"].(string)
+	extra, _ := arguments["context"].(string)
+	patterns := stringListArgument(arguments, "files")
+
+	if strings.TrimSpace(code) == "" && len(patterns) == 0 {
+		return textContent("Error: Missing required field: code or files"), fmt.Errorf("missing required fields")
+	}
+	focus := stringListArgument(arguments, "focus")
+	for _, f := range focus {
+		if _, ok := auditCategories[f]; !ok {
+			return textContent(fmt.Sprintf("Error: Unknown focus %q", f)), fmt.Errorf("unknown focus %q", f)
+		}
+	}
+
+	var sources []string
+	if strings.TrimSpace(code) != "" {
+		sources = append(sources, fmt.Sprintf("```\n%s\n```", strings.TrimRight(code, "\n")))
+	}
+	if len(patterns) > 0 {
+		files, err := t.readFiles(patterns)
+		if err != nil {
+			return textContent("Error: " + err.Error()), err
+		}
+		sources = append(sources, files...)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Minute)
+	defer cancel()
+
+	completion, err := t.llm.Generate(ctx, openai.ChatCompletionRequest{
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: auditSystemPrompt},
+			{Role: openai.ChatMessageRoleUser, Content: buildAuditPrompt(strings.Join(sources, "\n\n"), extra, focus)},
+		},
+		ResponseFormat: &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject},
+	}, nil)
+	if err != nil {
+		slog.ErrorContext(ctx, "Security audit failed", "tool", "security_audit", "error", err)
+		return failureContent(err), err
+	}
+
+	usage := usageOf(completion)
+	logUsage(ctx, t.Name(), usage)
+
+	result, err := parseAuditResult(completion.Answer)
+	if err != nil {
+		slog.ErrorContext(ctx, "Couldn't parse audit result", "tool", "security_audit", "error", err)
+		return textContent("Error: The security reviewer returned malformed findings. Please try again."), err
+	}
+
+	formatted, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return textContent("Error: Couldn't encode audit result"), err
+	}
+
+	return withMeta(textContent(string(formatted)), map[string]interface{}{"usage": usage}), nil
+}
+
+// readFiles reads the repository files matching patterns, each as a
+// labelled code block.
+func (t *SecurityAuditTool) readFiles(patterns []string) ([]string, error) {
+	if t.repo == nil {
+		return nil, fmt.Errorf("reading repository files is not configured (start the server with -repo)")
+	}
+	files, err := t.repo.Resolve(patterns)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) > maxAuditFiles {
+		return nil, fmt.Errorf("files match %d files; audit at most %d at a time", len(files), maxAuditFiles)
+	}
+	var blocks []string
+	for _, file := range files {
+		text, err := t.repo.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't read %s: %w", file, err)
+		}
+		blocks = append(blocks, fmt.Sprintf("**File %s:**\n```\n%s\n```", file, strings.TrimRight(text, "\n")))
+	}
+	return blocks, nil
+}
+
+func buildAuditPrompt(code, extra string, focus []string) string {
+	var b strings.Builder
+
+	b.WriteString("Audit this code for security vulnerabilities. Look for:\n")
+	if len(focus) == 0 {
+		focus = auditCategoryOrder
+	}
+	for _, f := range focus {
+		fmt.Fprintf(&b, "- %s\n", auditCategories[f])
+	}
+	if extra != "" {
+		fmt.Fprintf(&b, "\n<context>\n%s\n</context>\n", extra)
+	}
+	fmt.Fprintf(&b, "\n%s\n", truncateMiddle(code, maxAuditChars))
+	fmt.Fprintf(&b, `
+Respond with a JSON object of this exact shape:
+{
+  "findings": [
+    {"cwe": "CWE-89", "title": "...", "severity": "high", "location": "...", "exploit": "...", "remediation": "..."}
+  ],
+  "summary": "..."
+}
+"cwe" is the most specific CWE ID that fits. "severity" is one of %s, judged by what an attacker gains and how easily. "location" names the file and function or line. "remediation" is the concrete fix, with code where it helps. "summary" is one or two sentences on the code's overall security.`, strings.Join(auditSeverities, ", "))
+
+	return b.String()
+}
+
+// parseAuditResult checks the findings' labels and orders them by severity.
+func parseAuditResult(answer string) (*AuditResult, error) {
+	var result AuditResult
+	if err := json.Unmarshal([]byte(answer), &result); err != nil {
+		return nil, err
+	}
+	if result.Findings == nil {
+		result.Findings = []AuditFinding{}
+	}
+	for i, finding := range result.Findings {
+		finding.CWE = strings.ToUpper(strings.TrimSpace(finding.CWE))
+		if !cweLabel.MatchString(finding.CWE) {
+			return nil, fmt.Errorf("finding %q has no CWE ID (got %q)", finding.Title, finding.CWE)
+		}
+		finding.Severity = strings.ToLower(finding.Severity)
+		if !slices.Contains(auditSeverities, finding.Severity) {
+			return nil, fmt.Errorf("finding %q has unknown severity %q", finding.Title, finding.Severity)
+		}
+		result.Findings[i] = finding
+	}
+	sort.SliceStable(result.Findings, func(i, j int) bool {
+		return slices.Index(auditSeverities, result.Findings[i].Severity) < slices.Index(auditSeverities, result.Findings[j].Severity)
+	})
+	return &result, nil
+}
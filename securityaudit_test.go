@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const testAuditAnswer = `{"findings":[` +
+	`{"cwe":"cwe-327","title":"MD5 password hashes","severity":"Medium","location":"auth.go: hashPassword","exploit":"offline cracking","remediation":"use bcrypt"},` +
+	`{"cwe":"CWE-89","title":"SQL injection","severity":"critical","location":"handler.go: Search","exploit":"q=' OR 1=1","remediation":"use a placeholder"}],` +
+	`"summary":"One injectable query."}`
+
+func TestSecurityAuditTool_Call(t *testing.T) {
+	var messages []openai.ChatCompletionMessage
+	tool := NewSecurityAuditTool(NewLLM("o3").WithProvider(CompletionFunc(func(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error) {
+		messages = req.Messages
+		return &Completion{Answer: testAuditAnswer, Model: req.Model}, nil
+	})))
+	repo := writeTree(t, map[string]string{
+		"internal/api/handler.go": "package api\n\nfunc Search(q string) { db.Query(\"SELECT * FROM items WHERE name = '\" + q + \"'\") }\n",
+	})
+	r, err := OpenRepository(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tool.WithRepository(r)
+
+	content, err := tool.Call(map[string]interface{}{
+		"code":    "func hashPassword(p string) string { return md5.Sum(p) }",
+		"files":   []interface{}{"internal/api/*.go"},
+		"context": "Public HTTP API",
+		"focus":   []interface{}{"injection", "crypto"},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var result AuditResult
+	if err := json.Unmarshal([]byte(content[0]["text"].(string)), &result); err != nil {
+		t.Fatalf("Expected a JSON result, got %v", err)
+	}
+	if len(result.Findings) != 2 || result.Findings[0].CWE != "CWE-89" || result.Findings[1].CWE != "CWE-327" || result.Findings[1].Severity != "medium" {
+		t.Errorf("Expected normalized findings, most severe first, got %+v", result.Findings)
+	}
+
+	if messages[0].Role != openai.ChatMessageRoleSystem || !strings.Contains(messages[0].Content, "application security engineer") {
+		t.Errorf("Expected the security reviewer's system prompt, got %v", messages[0])
+	}
+	prompt := messages[1].Content
+	for _, want := range []string{"md5.Sum", "**File internal/api/handler.go:**", "Public HTTP API", "SQL, command", "weak algorithms", `"cwe": "CWE-89"`} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("Expected the prompt to contain %q, got:\n%s", want, prompt)
+		}
+	}
+	if strings.Contains(prompt, "hard-coded credentials") {
+		t.Error("Expected only the requested focuses")
+	}
+}
+
+func TestSecurityAuditTool_Call_Invalid(t *testing.T) {
+	tool := NewSecurityAuditTool(NewLLM("o3"))
+	for _, arguments := range []map[string]interface{}{
+		{},
+		{"code": "x", "focus": []interface{}{"spelling"}},
+		{"files": []interface{}{"main.go"}},
+	} {
+		if _, err := tool.Call(arguments); err == nil {
+			t.Errorf("Expected an error for %v", arguments)
+		}
+	}
+}
+
+func TestParseAuditResult(t *testing.T) {
+	if result, err := parseAuditResult(`{"summary":"Nothing found."}`); err != nil || result.Findings == nil {
+		t.Errorf("Expected an empty list of findings, got %+v, %v", result, err)
+	}
+	for _, answer := range []string{
+		"not json",
+		`{"findings":[{"cwe":"SQL injection","severity":"high"}]}`,
+		`{"findings":[{"cwe":"CWE-89","severity":"urgent"}]}`,
+	} {
+		if _, err := parseAuditResult(answer); err == nil {
+			t.Errorf("Expected an error for %s", answer)
+		}
+	}
+}
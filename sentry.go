@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	maxSentryFrames      = 15
+	maxSentryBreadcrumbs = 10
+)
+
+// SentryClient fetches issue events from the Sentry API so production-error
+// escalations can include the actual crash data.
+type SentryClient struct {
+	baseURL    string
+	authToken  string
+	httpClient *http.Client
+}
+
+func NewSentryClient(baseURL, authToken string) *SentryClient {
+	if baseURL == "" {
+		baseURL = "https://sentry.io"
+	}
+	return &SentryClient{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		authToken:  authToken,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+type sentryEvent struct {
+	Title   string `json:"title"`
+	Culprit string `json:"culprit"`
+	Tags    []struct {
+		Key   string `json:"key"`
+		Value string `json:"value"`
+	} `json:"tags"`
+	Entries []struct {
+		Type string          `json:"type"`
+		Data json.RawMessage `json:"data"`
+	} `json:"entries"`
+}
+
+type sentryException struct {
+	Values []struct {
+		Type       string `json:"type"`
+		Value      string `json:"value"`
+		Stacktrace *struct {
+			Frames []struct {
+				Filename string `json:"filename"`
+				Function string `json:"function"`
+				LineNo   int    `json:"lineNo"`
+				InApp    bool   `json:"inApp"`
+			} `json:"frames"`
+		} `json:"stacktrace"`
+	} `json:"values"`
+}
+
+type sentryBreadcrumbs struct {
+	Values []struct {
+		Timestamp string `json:"timestamp"`
+		Category  string `json:"category"`
+		Level     string `json:"level"`
+		Message   string `json:"message"`
+	} `json:"values"`
+}
+
+// FetchIssue returns a condensed, prompt-ready description of the latest
+// event for the given issue.
+func (c *SentryClient) FetchIssue(ctx context.Context, issueID string) (string, error) {
+	endpoint := fmt.Sprintf("%s/api/0/issues/%s/events/latest/", c.baseURL, url.PathEscape(issueID))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.authToken)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("sentry returned status %d for issue %s", resp.StatusCode, issueID)
+	}
+
+	var event sentryEvent
+	if err := json.NewDecoder(resp.Body).Decode(&event); err != nil {
+		return "", fmt.Errorf("couldn't decode sentry event: %w", err)
+	}
+
+	return condenseSentryEvent(event), nil
+}
+
+func condenseSentryEvent(event sentryEvent) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "Title: %s\n", event.Title)
+	if event.Culprit != "" {
+		fmt.Fprintf(&b, "Culprit: %s\n", event.Culprit)
+	}
+
+	if len(event.Tags) > 0 {
+		tags := make([]string, 0, len(event.Tags))
+		for _, tag := range event.Tags {
+			tags = append(tags, tag.Key+"="+tag.Value)
+		}
+		fmt.Fprintf(&b, "Tags: %s\n", strings.Join(tags, ", "))
+	}
+
+	for _, entry := range event.Entries {
+		switch entry.Type {
+		case "exception":
+			var exc sentryException
+			if err := json.Unmarshal(entry.Data, &exc); err != nil {
+				continue
+			}
+			for _, value := range exc.Values {
+				fmt.Fprintf(&b, "\nException: %s: %s\n", value.Type, value.Value)
+				if value.Stacktrace == nil {
+					continue
+				}
+				// Sentry orders frames oldest first; the crash site is last.
+				frames := value.Stacktrace.Frames
+				if len(frames) > maxSentryFrames {
+					frames = frames[len(frames)-maxSentryFrames:]
+				}
+				for i := len(frames) - 1; i >= 0; i-- {
+					frame := frames[i]
+					marker := ""
+					if frame.InApp {
+						marker = " [app]"
+					}
+					fmt.Fprintf(&b, "  at %s (%s:%d)%s\n", frame.Function, frame.Filename, frame.LineNo, marker)
+				}
+			}
+		case "breadcrumbs":
+			var crumbs sentryBreadcrumbs
+			if err := json.Unmarshal(entry.Data, &crumbs); err != nil {
+				continue
+			}
+			values := crumbs.Values
+			if len(values) > maxSentryBreadcrumbs {
+				values = values[len(values)-maxSentryBreadcrumbs:]
+			}
+			if len(values) > 0 {
+				b.WriteString("\nBreadcrumbs (most recent last):\n")
+			}
+			for _, crumb := range values {
+				fmt.Fprintf(&b, "  %s [%s] %s: %s\n", crumb.Timestamp, crumb.Level, crumb.Category, crumb.Message)
+			}
+		}
+	}
+
+	return strings.TrimRight(b.String(), "\n")
+}
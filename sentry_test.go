@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testSentryEvent = `{
+	"title": "runtime error: invalid memory address or nil pointer dereference",
+	"culprit": "handlers.GetUser",
+	"tags": [{"key": "environment", "value": "production"}, {"key": "release", "value": "1.4.2"}],
+	"entries": [
+		{"type": "exception", "data": {"values": [{
+			"type": "panic",
+			"value": "nil pointer dereference",
+			"stacktrace": {"frames": [
+				{"filename": "net/http/server.go", "function": "serve", "lineNo": 2000, "inApp": false},
+				{"filename": "handlers/user.go", "function": "GetUser", "lineNo": 42, "inApp": true}
+			]}
+		}]}},
+		{"type": "breadcrumbs", "data": {"values": [
+			{"timestamp": "2025-01-01T00:00:00Z", "category": "http", "level": "info", "message": "GET /users/7"}
+		]}}
+	]
+}`
+
+func TestSentryClient_FetchIssue(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/0/issues/12345/events/latest/" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "Bearer token" {
+			t.Errorf("Expected bearer token, got %q", r.Header.Get("Authorization"))
+		}
+		w.Write([]byte(testSentryEvent))
+	}))
+	defer srv.Close()
+
+	client := NewSentryClient(srv.URL, "token")
+	condensed, err := client.FetchIssue(context.Background(), "12345")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	for _, want := range []string{
+		"Title: runtime error",
+		"Culprit: handlers.GetUser",
+		"environment=production",
+		"Exception: panic: nil pointer dereference",
+		"at GetUser (handlers/user.go:42) [app]",
+		"GET /users/7",
+	} {
+		if !strings.Contains(condensed, want) {
+			t.Errorf("Expected condensed event to contain %q, got:\n%s", want, condensed)
+		}
+	}
+
+	// The crash site should be listed before the outer frames.
+	if strings.Index(condensed, "GetUser (") > strings.Index(condensed, "serve (") {
+		t.Error("Expected innermost frame to be listed first")
+	}
+}
+
+func TestSentryClient_FetchIssue_NotFound(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	client := NewSentryClient(srv.URL, "token")
+	if _, err := client.FetchIssue(context.Background(), "missing"); err == nil {
+		t.Error("Expected error for missing issue")
+	}
+}
+
+func TestGetHelpTool_Call_SentryNotConfigured(t *testing.T) {
+	tool := NewGetHelpTool("", "gpt-4o")
+
+	content, err := tool.Call(map[string]interface{}{
+		"question":        "Why does this crash?",
+		"summary":         "test summary",
+		"sentry_issue_id": "12345",
+	})
+	if err == nil {
+		t.Error("Expected error when Sentry is not configured")
+	}
+	if len(content) == 0 || !strings.Contains(content[0]["text"].(string), "SENTRY_AUTH_TOKEN") {
+		t.Errorf("Expected configuration hint in content, got %v", content)
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// maxSessionTurns bounds how many question/answer pairs a session keeps. The
+// first turn, which carries the project context, is always kept.
+const maxSessionTurns = 10
+
+// maxSessionChars keeps a session's history within the prompt token limit
+// (~4 chars per token).
+const maxSessionChars = 80000
+
+// SessionStore keeps the message history of multi-turn get_help sessions in
+// memory. Sessions expire after ttl without use.
+type SessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]*session
+	ttl      time.Duration
+	now      func() time.Time
+}
+
+type session struct {
+	messages []openai.ChatCompletionMessage
+	lastUsed time.Time
+}
+
+func NewSessionStore(ttl time.Duration) *SessionStore {
+	return &SessionStore{
+		sessions: make(map[string]*session),
+		ttl:      ttl,
+		now:      time.Now,
+	}
+}
+
+// Messages returns a copy of the session's history, or nil when the session
+// doesn't exist or has expired.
+func (s *SessionStore) Messages(id string) []openai.ChatCompletionMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.sessions[id]
+	if !ok {
+		return nil
+	}
+	if s.expired(sess) {
+		delete(s.sessions, id)
+		return nil
+	}
+	return append([]openai.ChatCompletionMessage(nil), sess.messages...)
+}
+
+// Append adds a question and its answer to the session, creating it if
+// needed and dropping the oldest follow-ups when it grows too long.
+func (s *SessionStore) Append(id, question, answer string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, sess := range s.sessions {
+		if s.expired(sess) {
+			delete(s.sessions, key)
+		}
+	}
+
+	sess, ok := s.sessions[id]
+	if !ok {
+		sess = &session{}
+		s.sessions[id] = sess
+	}
+	sess.messages = append(sess.messages,
+		openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: question},
+		openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: answer},
+	)
+	for len(sess.messages) > 2 && (len(sess.messages) > 2*maxSessionTurns || sessionChars(sess.messages) > maxSessionChars) {
+		sess.messages = append(sess.messages[:2], sess.messages[4:]...)
+	}
+	sess.lastUsed = s.now()
+}
+
+// Reset forgets a session, reporting whether it existed.
+func (s *SessionStore) Reset(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.sessions[id]
+	delete(s.sessions, id)
+	return ok && !s.expired(sess)
+}
+
+func (s *SessionStore) expired(sess *session) bool {
+	return s.ttl > 0 && s.now().Sub(sess.lastUsed) > s.ttl
+}
+
+// unchangedContext stands in a follow-up for code or context an earlier
+// message of the session already carries.
+const unchangedContext = "(unchanged; as sent earlier in this conversation)"
+
+// sentEarlier reports whether one of the session's earlier prompts still
+// carries text whole. Turns dropped to bound the session no longer count,
+// and neither does text trimmed to fit, so both are sent again.
+func sentEarlier(prior []openai.ChatCompletionMessage, text string) bool {
+	if text == "" {
+		return false
+	}
+	for _, message := range prior {
+		if message.Role == openai.ChatMessageRoleUser && strings.Contains(message.Content, text) {
+			return true
+		}
+	}
+	return false
+}
+
+func sessionChars(messages []openai.ChatCompletionMessage) int {
+	total := 0
+	for _, m := range messages {
+		total += len(m.Content)
+	}
+	return total
+}
+
+// ResetSessionTool discards a get_help session so the next question with the
+// same session_id starts from scratch.
+type ResetSessionTool struct {
+	sessions *SessionStore
+}
+
+func NewResetSessionTool(sessions *SessionStore) *ResetSessionTool {
+	return &ResetSessionTool{sessions: sessions}
+}
+
+func (t *ResetSessionTool) Name() string {
+	return "reset_session"
+}
+
+func (t *ResetSessionTool) Category() string {
+	return "session"
+}
+
+func (t *ResetSessionTool) Description() string {
+	return "Forget the conversation history of a get_help session"
+}
+
+func (t *ResetSessionTool) Schema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"session_id": map[string]interface{}{
+				"type":        "string",
+				"description": "The session to reset",
+			},
+		},
+		"required": []string{"session_id"},
+	}
+}
+
+func (t *ResetSessionTool) Call(arguments map[string]interface{}) ([]map[string]interface{}, error) {
+	id, _ := arguments["session_id"].(string)
+	if id == "" {
+		return textContent("Error: Missing required field: session_id"), fmt.Errorf("missing required fields")
+	}
+	if !t.sessions.Reset(id) {
+		return textContent(fmt.Sprintf("Session %s not found (it may have expired).", id)), nil
+	}
+	return textContent(fmt.Sprintf("Session %s reset.", id)), nil
+}
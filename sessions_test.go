@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestSessionStore_TTL(t *testing.T) {
+	store := NewSessionStore(time.Minute)
+	now := time.Now()
+	store.now = func() time.Time { return now }
+
+	store.Append("s1", "q1", "a1")
+	if got := len(store.Messages("s1")); got != 2 {
+		t.Fatalf("Expected 2 messages, got %d", got)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if store.Messages("s1") != nil {
+		t.Error("Expected idle session to expire")
+	}
+}
+
+func TestSessionStore_KeepsFirstTurn(t *testing.T) {
+	store := NewSessionStore(time.Hour)
+	for i := 0; i < maxSessionTurns+5; i++ {
+		store.Append("s1", fmt.Sprintf("q%d", i), fmt.Sprintf("a%d", i))
+	}
+
+	messages := store.Messages("s1")
+	if len(messages) != 2*maxSessionTurns {
+		t.Fatalf("Expected %d messages, got %d", 2*maxSessionTurns, len(messages))
+	}
+	if messages[0].Content != "q0" {
+		t.Errorf("Expected the first turn to be kept, got %q", messages[0].Content)
+	}
+	if last := messages[len(messages)-1].Content; last != fmt.Sprintf("a%d", maxSessionTurns+4) {
+		t.Errorf("Expected the latest answer last, got %q", last)
+	}
+}
+
+func TestResetSessionTool_Call(t *testing.T) {
+	store := NewSessionStore(time.Hour)
+	store.Append("s1", "q", "a")
+	tool := NewResetSessionTool(store)
+
+	result, err := tool.Call(map[string]interface{}{"session_id": "s1"})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if result[0]["text"] != "Session s1 reset." {
+		t.Errorf("Unexpected result: %v", result[0]["text"])
+	}
+	if store.Messages("s1") != nil {
+		t.Error("Expected session to be forgotten")
+	}
+
+	result, _ = tool.Call(map[string]interface{}{"session_id": "s1"})
+	if !strings.Contains(result[0]["text"].(string), "not found") {
+		t.Errorf("Expected not found, got %v", result[0]["text"])
+	}
+	if _, err := tool.Call(map[string]interface{}{}); err == nil {
+		t.Error("Expected error without session_id")
+	}
+}
+
+func TestGetHelpTool_Call_Session(t *testing.T) {
+	var requests [][]openai.ChatCompletionMessage
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openai.ChatCompletionRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		requests = append(requests, req.Messages)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{
+				{"message": map[string]string{"role": "assistant", "content": fmt.Sprintf("answer %d", len(requests))}},
+			},
+		})
+	}))
+	defer srv.Close()
+
+	tool := NewGetHelpTool("", "o3").
+		WithClientOptions(ClientOptions{BaseURL: srv.URL}).
+		WithCache(NewResponseCache(10, time.Hour)).
+		WithSessions(NewSessionStore(time.Hour))
+
+	if _, err := tool.Call(map[string]interface{}{"question": "Which approach?", "summary": "s", "session_id": "s1"}); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	result, err := tool.Call(map[string]interface{}{"question": "What about error handling?", "session_id": "s1"})
+	if err != nil {
+		t.Fatalf("Expected follow-up without summary to succeed, got: %v", err)
+	}
+	if result[0]["text"] != "answer 2" {
+		t.Errorf("Expected a fresh answer for the follow-up, got %v", result[0]["text"])
+	}
+
+	followUp := requests[1]
+	if len(followUp) != 4 {
+		t.Fatalf("Expected the persona and the prior question and answer before the follow-up, got %d messages", len(followUp))
+	}
+	if followUp[0].Role != openai.ChatMessageRoleSystem {
+		t.Errorf("Expected the persona as the system message, got %+v", followUp[0])
+	}
+	if !strings.Contains(followUp[1].Content, "<summary>") || followUp[2].Content != "answer 1" {
+		t.Errorf("Expected the first turn to be replayed, got %+v", followUp[1:3])
+	}
+	if strings.Contains(followUp[3].Content, "<summary>") || !strings.Contains(followUp[3].Content, "What about error handling?") {
+		t.Errorf("Expected a follow-up prompt without the project summary, got %q", followUp[3].Content)
+	}
+
+	if _, err := NewGetHelpTool("", "o3").Call(map[string]interface{}{"question": "q", "summary": "s", "session_id": "s1"}); err == nil {
+		t.Error("Expected error when sessions are not enabled")
+	}
+}
+
+func TestGetHelpTool_Call_SessionDelta(t *testing.T) {
+	var requests [][]openai.ChatCompletionMessage
+	source := &staticSource{blocks: []ContextBlock{{Name: "wiki", Text: "Retries back off exponentially.", Provenance: "WIKI Retries"}}}
+	summary := filepath.Join(t.TempDir(), "SUMMARY.md")
+	os.WriteFile(summary, []byte("# Payments\n"), 0644)
+	tool := NewGetHelpTool(summary, "o3").WithContextSource(source).WithSessions(NewSessionStore(time.Hour))
+	tool.LLM().WithProvider(CompletionFunc(func(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error) {
+		requests = append(requests, req.Messages)
+		return &Completion{Answer: "answer", Model: req.Model, PromptTokens: 900, CachedPromptTokens: 768}, nil
+	}))
+
+	code := "func retry() { time.Sleep(d) }"
+	if _, err := tool.Call(map[string]interface{}{"question": "Why so slow?", "summary": "s", "relevant_code": code, "session_id": "s1"}); err != nil {
+		t.Fatal(err)
+	}
+	source.blocks = append(source.blocks, ContextBlock{Name: "wiki", Text: "Jitter is mandatory.", Provenance: "WIKI Jitter"})
+	result, err := tool.Call(map[string]interface{}{"question": "And the jitter?", "relevant_code": code, "session_id": "s1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	followUp := requests[1][len(requests[1])-1].Content
+	if strings.Contains(followUp, code) || strings.Contains(followUp, "back off exponentially") {
+		t.Errorf("Expected what the first turn sent to be referred to, got:\n%s", followUp)
+	}
+	for _, want := range []string{"**Relevant Code:** " + unchangedContext, "Source: WIKI Retries\n" + unchangedContext, "Source: WIKI Jitter\nJitter is mandatory."} {
+		if !strings.Contains(followUp, want) {
+			t.Errorf("Expected %q in the follow-up, got:\n%s", want, followUp)
+		}
+	}
+	meta := result[0]["_meta"].(map[string]interface{})
+	if _, ok := meta["context_omitted"]; ok {
+		t.Errorf("Expected referenced context not reported as omitted, got %v", meta["context_omitted"])
+	}
+	if usage := meta["usage"].(*TokenUsage); usage.CachedPromptTokens != 768 {
+		t.Errorf("Expected the cached prompt tokens reported, got %+v", usage)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// drainer tracks the requests a server is handling, so that a shutdown
+// can wait for them to be answered rather than drop answers whose tokens
+// were already paid for.
+type drainer struct {
+	mu       sync.Mutex
+	draining bool
+	active   int
+	// idle is closed when the last request ends while draining.
+	idle chan struct{}
+}
+
+// begin reports whether a new request may start, counting it if so.
+// Every started request must be ended.
+func (d *drainer) begin() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.draining {
+		return false
+	}
+	d.active++
+	return true
+}
+
+func (d *drainer) end() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.active--
+	if d.active == 0 && d.idle != nil {
+		close(d.idle)
+		d.idle = nil
+	}
+}
+
+// Drain stops new requests from starting and waits up to timeout for the
+// ones in flight to finish, returning how many were still running.
+func (s *MCPServer) Drain(timeout time.Duration) int {
+	d := &s.drain
+	d.mu.Lock()
+	d.draining = true
+	if d.active == 0 {
+		d.mu.Unlock()
+		return 0
+	}
+	if d.idle == nil {
+		d.idle = make(chan struct{})
+	}
+	idle := d.idle
+	d.mu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-idle:
+		return 0
+	case <-timer.C:
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		return d.active
+	}
+}
+
+// BeginRequest tracks a request for the graceful shutdown, reporting false
+// once the server drains.
+func (s *MCPServer) BeginRequest() bool {
+	return s.drain.begin()
+}
+
+// EndRequest marks a request begun with BeginRequest answered.
+func (s *MCPServer) EndRequest() {
+	s.drain.end()
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+)
+
+// blockingTool answers once it is released.
+type blockingTool struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingTool) Name() string        { return "slow" }
+func (b *blockingTool) Description() string { return "Answers when released" }
+func (b *blockingTool) Schema() map[string]interface{} {
+	return map[string]interface{}{"type": "object"}
+}
+
+func (b *blockingTool) Call(arguments map[string]interface{}) ([]map[string]interface{}, error) {
+	close(b.started)
+	<-b.release
+	return textContent("done"), nil
+}
+
+func TestMCPServer_Drain(t *testing.T) {
+	tool := &blockingTool{started: make(chan struct{}), release: make(chan struct{})}
+	server := NewMCPServer("test", "1.0.0")
+	server.RegisterTool(tool)
+
+	clientOut, serverIn := io.Pipe()
+	serverOut, clientIn := io.Pipe()
+	go server.Serve(clientOut, clientIn)
+	defer serverIn.Close()
+	send := func(msg string) {
+		if _, err := io.WriteString(serverIn, msg+"\n"); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+	}
+	lines := bufio.NewScanner(serverOut)
+	next := func() map[string]interface{} {
+		if !lines.Scan() {
+			t.Fatal("Expected another message from server")
+		}
+		var msg map[string]interface{}
+		json.Unmarshal(lines.Bytes(), &msg)
+		return msg
+	}
+
+	send(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"slow","arguments":{}}}`)
+	<-tool.started
+	if active := server.Drain(10 * time.Millisecond); active != 1 {
+		t.Errorf("Expected the call to be in flight at the timeout, got %d", active)
+	}
+
+	drained := make(chan int)
+	go func() { drained <- server.Drain(5 * time.Second) }()
+	send(`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`)
+	if resp := next(); resp["id"] != float64(2) || resp["error"] == nil {
+		t.Errorf("Expected a request while draining to be refused, got %v", resp)
+	}
+
+	close(tool.release)
+	if resp := next(); resp["id"] != float64(1) || resp["result"] == nil {
+		t.Errorf("Expected the call in flight to be answered, got %v", resp)
+	}
+	if active := <-drained; active != 0 {
+		t.Errorf("Expected the drain to finish with the call, got %d still active", active)
+	}
+}
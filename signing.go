@@ -0,0 +1,89 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Signer signs tool answers with an ed25519 key so systems that ingest them
+// into decision records can verify they weren't altered.
+type Signer struct {
+	key   ed25519.PrivateKey
+	keyID string
+}
+
+func NewSigner(key ed25519.PrivateKey) *Signer {
+	pub := key.Public().(ed25519.PublicKey)
+	sum := sha256.Sum256(pub)
+	return &Signer{key: key, keyID: hex.EncodeToString(sum[:8])}
+}
+
+// LoadSigner reads a PEM-encoded PKCS#8 ed25519 private key, as produced by
+// `openssl genpkey -algorithm ed25519`.
+func LoadSigner(path string) (*Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data found", path)
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	key, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an ed25519 private key", path)
+	}
+
+	return NewSigner(key), nil
+}
+
+// Sign returns signature metadata for the answer text.
+func (s *Signer) Sign(text string) map[string]interface{} {
+	return map[string]interface{}{
+		"algorithm":  "ed25519",
+		"key_id":     s.keyID,
+		"public_key": base64.StdEncoding.EncodeToString(s.key.Public().(ed25519.PublicKey)),
+		"value":      base64.StdEncoding.EncodeToString(ed25519.Sign(s.key, []byte(text))),
+	}
+}
+
+// VerifySignature checks a base64 signature produced by Sign.
+func VerifySignature(publicKey, text, signature string) bool {
+	pub, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return false
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	return ed25519.Verify(ed25519.PublicKey(pub), []byte(text), sig)
+}
+
+// contentText joins the text blocks of a tool result; this is the payload
+// that gets signed.
+func contentText(content []map[string]interface{}) string {
+	var texts []string
+	for _, block := range content {
+		if block["type"] == "text" {
+			if text, ok := block["text"].(string); ok {
+				texts = append(texts, text)
+			}
+		}
+	}
+	return strings.Join(texts, "\n")
+}
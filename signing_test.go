@@ -0,0 +1,82 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTestSigningKey(t *testing.T) string {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "signing.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadSigner(t *testing.T) {
+	signer, err := LoadSigner(writeTestSigningKey(t))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	sig := signer.Sign("the answer")
+	if sig["algorithm"] != "ed25519" || sig["key_id"] == "" {
+		t.Errorf("Unexpected signature metadata: %v", sig)
+	}
+	if !VerifySignature(sig["public_key"].(string), "the answer", sig["value"].(string)) {
+		t.Error("Expected signature to verify")
+	}
+	if VerifySignature(sig["public_key"].(string), "the answer, altered", sig["value"].(string)) {
+		t.Error("Expected altered text to fail verification")
+	}
+}
+
+func TestLoadSigner_Invalid(t *testing.T) {
+	if _, err := LoadSigner("nonexistent.pem"); err == nil {
+		t.Error("Expected error for missing key file")
+	}
+
+	path := filepath.Join(t.TempDir(), "bad.pem")
+	os.WriteFile(path, []byte("not pem"), 0600)
+	if _, err := LoadSigner(path); err == nil {
+		t.Error("Expected error for non-PEM key file")
+	}
+}
+
+func TestMCPServer_HandleToolsCall_Signed(t *testing.T) {
+	signer, err := LoadSigner(writeTestSigningKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := NewMCPServer("test", "1.0.0").WithSigner(signer)
+	server.RegisterTool(&fakeStreamingTool{chunks: []string{"signed ", "answer"}})
+
+	result, errResp := server.HandleToolsCall(json.RawMessage(`{"name":"fake_stream","arguments":{}}`))
+	if errResp != nil {
+		t.Fatalf("Expected no error, got %v", errResp)
+	}
+
+	meta := result.Meta
+	if meta == nil {
+		t.Fatal("Expected _meta in signed result")
+	}
+	sig := meta["signature"].(map[string]interface{})
+	if !VerifySignature(sig["public_key"].(string), "signed answer", sig["value"].(string)) {
+		t.Error("Expected result signature to verify against answer text")
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// fakeStreamingTool emits a fixed set of chunks and returns them joined.
+type fakeStreamingTool struct {
+	chunks []string
+	// name replaces the tool's name, fake_stream, when set.
+	name string
+}
+
+func (f *fakeStreamingTool) Name() string {
+	if f.name != "" {
+		return f.name
+	}
+	return "fake_stream"
+}
+
+func (f *fakeStreamingTool) Description() string { return "Streams fixed chunks" }
+func (f *fakeStreamingTool) Schema() map[string]interface{} {
+	return map[string]interface{}{"type": "object"}
+}
+
+func (f *fakeStreamingTool) Call(arguments map[string]interface{}) ([]map[string]interface{}, error) {
+	return f.CallStream(arguments, func(string) {})
+}
+
+func (f *fakeStreamingTool) CallStream(arguments map[string]interface{}, onDelta func(string)) ([]map[string]interface{}, error) {
+	for _, chunk := range f.chunks {
+		onDelta(chunk)
+	}
+	return []map[string]interface{}{{"type": "text", "text": strings.Join(f.chunks, "")}}, nil
+}
+
+func TestGetHelpTool_StreamOpenAI(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["stream"] != true {
+			t.Errorf("Expected stream=true in request, got %v", body["stream"])
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, part := range []string{"Hello", ", ", "world"} {
+			fmt.Fprintf(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":%q}}]}\n\n", part)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer srv.Close()
+
+	tool := NewGetHelpTool("", "gpt-4o").WithClientOptions(ClientOptions{BaseURL: srv.URL})
+
+	var deltas []string
+	answer, err := tool.streamOpenAI(context.Background(), "prompt", func(delta string) {
+		deltas = append(deltas, delta)
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if answer != "Hello, world" {
+		t.Errorf("Expected aggregated answer 'Hello, world', got %q", answer)
+	}
+	if len(deltas) != 3 {
+		t.Errorf("Expected 3 deltas, got %d", len(deltas))
+	}
+}
+
+func TestMCPServer_HandleToolsCall_ProgressNotifications(t *testing.T) {
+	server := NewMCPServer("test", "1.0.0")
+	server.RegisterTool(&fakeStreamingTool{chunks: []string{"a", "b"}})
+
+	var methods []string
+	var tokens []interface{}
+	server.notify = func(method string, params interface{}) {
+		methods = append(methods, method)
+		tokens = append(tokens, params.(map[string]interface{})["progressToken"])
+	}
+
+	result, errResp := server.HandleToolsCall(json.RawMessage(`{"name":"fake_stream","arguments":{},"_meta":{"progressToken":"tok-1"}}`))
+	if errResp != nil {
+		t.Fatalf("Expected no error, got %v", errResp)
+	}
+	if len(methods) != 2 || methods[0] != "notifications/progress" {
+		t.Errorf("Expected 2 progress notifications, got %v", methods)
+	}
+	if tokens[0] != "tok-1" {
+		t.Errorf("Expected progress token 'tok-1', got %v", tokens[0])
+	}
+
+	content := result.Content
+	if content[0]["text"] != "ab" {
+		t.Errorf("Expected final text 'ab', got %v", content[0]["text"])
+	}
+}
+
+func TestMCPServer_HandleToolsCall_LoggingNotificationsWithoutToken(t *testing.T) {
+	server := NewMCPServer("test", "1.0.0")
+	server.RegisterTool(&fakeStreamingTool{chunks: []string{"a"}})
+
+	var methods []string
+	server.notify = func(method string, params interface{}) {
+		methods = append(methods, method)
+	}
+
+	server.HandleToolsCall(json.RawMessage(`{"name":"fake_stream","arguments":{}}`))
+	if len(methods) != 1 || methods[0] != "notifications/message" {
+		t.Errorf("Expected a logging notification, got %v", methods)
+	}
+}
+
+func TestMCPServer_HTTPHandler_Streaming(t *testing.T) {
+	server := NewMCPServer("test", "1.0.0")
+	server.RegisterTool(&fakeStreamingTool{chunks: []string{"Hello", " world"}, name: "get_help"})
+
+	req := httptest.NewRequest(http.MethodPost, "/get_help", strings.NewReader(`{"question":"q","summary":"s"}`))
+	req.Header.Set("Accept", "text/event-stream")
+	w := httptest.NewRecorder()
+
+	server.HandleHTTP(w, req)
+
+	if w.Header().Get("Content-Type") != "text/event-stream" {
+		t.Errorf("Expected event-stream content type, got %q", w.Header().Get("Content-Type"))
+	}
+	body := w.Body.String()
+	if strings.Count(body, "event: chunk") != 2 {
+		t.Errorf("Expected 2 chunk events, got body:\n%s", body)
+	}
+	if !strings.Contains(body, `event: answer`+"\n"+`data: {"answer":"Hello world"}`) {
+		t.Errorf("Expected final answer event, got body:\n%s", body)
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// OutputSchema describes the structured content returned with every
+// get_help answer, so agent clients can act on it without parsing prose.
+func (t *GetHelpTool) OutputSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"answer": map[string]interface{}{
+				"type":        "string",
+				"description": "The architect's answer, as in the text content; only its first part when the rest is in answer_parts",
+			},
+			"answer_parts": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "URIs of the remaining parts of a long answer, in order, to read with resources/read",
+			},
+			"confidence": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"high", "medium", "low"},
+				"description": "The model's self-assessed confidence in the answer; absent when it gave none",
+			},
+			"suggested_next_steps": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "The steps the answer recommends, in order",
+			},
+			"references": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "Files, chunks, resources and URLs the answer was based on or links to",
+			},
+			"diagnosis": map[string]interface{}{
+				"type":        "string",
+				"description": "The root cause, for answers given with response_format json",
+			},
+			"risk_level": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"low", "medium", "high"},
+				"description": "Risk of the fix breaking something else, for answers given with response_format json",
+			},
+			"escalation_id": map[string]interface{}{
+				"type":        "string",
+				"description": "ID of the escalation in history, to pass to report_outcome once the advice has been tried",
+			},
+			"draft_id": map[string]interface{}{
+				"type":        "string",
+				"description": "ID of the draft to pass to send_draft, when draft was set; answer then holds the request instead",
+			},
+		},
+		"required": []string{"answer", "suggested_next_steps", "references"},
+	}
+}
+
+// structuredAnswer is get_help's structured content for an answer given
+// with the context in usage (nil for cached answers).
+func structuredAnswer(answer, confidence string, usage *ContextUsage) map[string]interface{} {
+	structured := map[string]interface{}{
+		"answer":               answer,
+		"suggested_next_steps": nextSteps(answer),
+		"references":           answerReferences(answer, usage),
+	}
+	if _, ok := confidenceLevels[confidence]; ok {
+		structured["confidence"] = confidence
+	}
+	return structured
+}
+
+// answerStructuredContent is get_help's structured content for an answer
+// in either format. JSON answers fill in the steps from their fix plan, and
+// add their diagnosis and risk level.
+func answerStructuredContent(answer, confidence string, jsonAnswer bool, usage *ContextUsage) map[string]interface{} {
+	structured := structuredAnswer(answer, confidence, usage)
+	if !jsonAnswer {
+		return structured
+	}
+	parsed, err := parseArchitectAnswer(answer)
+	if err != nil {
+		return structured
+	}
+	structured["confidence"] = parsed.Confidence
+	structured["suggested_next_steps"] = parsed.FixPlan
+	structured["diagnosis"] = parsed.Diagnosis
+	structured["risk_level"] = parsed.RiskLevel
+	return structured
+}
+
+var (
+	listItemPattern      = regexp.MustCompile(`^ {0,3}(?:[-*+]|(\d+)[.)])\s+(.*)$`)
+	nextStepsHeading     = regexp.MustCompile(`(?i)next steps?|recommend|action items|suggested|what to (?:do|check|try)|how to fix|the fix`)
+	answerURLPattern     = regexp.MustCompile(`https?://[^\s<>()\[\]"'` + "`" + `]+`)
+	referencedSectionTag = []string{"selection ", "file ", "retrieved ", "resource ", "url ", "pull_request "}
+)
+
+// nextSteps extracts the steps an answer recommends: the list following a
+// heading such as "Next steps" or "Recommended fix", or else the answer's
+// last numbered list.
+func nextSteps(answer string) []string {
+	lines := strings.Split(answer, "\n")
+	isHeading := func(line string) bool {
+		line = strings.TrimSpace(line)
+		return strings.HasPrefix(line, "#") || strings.HasSuffix(line, ":") || strings.HasSuffix(line, ":**") ||
+			(strings.HasPrefix(line, "**") && strings.HasSuffix(line, "**"))
+	}
+
+	for i, line := range lines {
+		if isHeading(line) && !listItemPattern.MatchString(line) && nextStepsHeading.MatchString(line) {
+			if steps, _ := listAt(lines, i+1); len(steps) > 0 {
+				return steps
+			}
+		}
+	}
+
+	steps := []string{}
+	for i := 0; i < len(lines); i++ {
+		if m := listItemPattern.FindStringSubmatch(lines[i]); m != nil && m[1] != "" {
+			var end int
+			steps, end = listAt(lines, i)
+			i = end
+		}
+	}
+	return steps
+}
+
+// listAt returns the items of the list starting at or after line start
+// (skipping blank lines), joining indented continuation lines onto their
+// item, and the index of the line after the list.
+func listAt(lines []string, start int) ([]string, int) {
+	i := start
+	for i < len(lines) && strings.TrimSpace(lines[i]) == "" {
+		i++
+	}
+	items := []string{}
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		if m := listItemPattern.FindStringSubmatch(line); m != nil {
+			items = append(items, strings.TrimSpace(m[2]))
+			continue
+		}
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			// A blank line ends the list unless another item follows.
+			if i+1 < len(lines) && listItemPattern.MatchString(lines[i+1]) {
+				continue
+			}
+			break
+		}
+		if len(items) == 0 || !strings.HasPrefix(line, " ") {
+			break
+		}
+		if !strings.HasPrefix(trimmed, "```") {
+			items[len(items)-1] += " " + trimmed
+		}
+	}
+	return items, i
+}
+
+// answerReferences lists the context the answer was based on (files,
+// retrieved chunks, client resources and fetched pages) followed by the
+// URLs the answer links to, without duplicates.
+func answerReferences(answer string, usage *ContextUsage) []string {
+	references := []string{}
+	seen := make(map[string]bool)
+	add := func(reference string) {
+		if reference != "" && !seen[reference] {
+			seen[reference] = true
+			references = append(references, reference)
+		}
+	}
+
+	if usage != nil {
+		for _, section := range usage.Sections {
+			for _, tag := range referencedSectionTag {
+				if reference, ok := strings.CutPrefix(section.Name, tag); ok {
+					add(reference)
+				}
+			}
+		}
+	}
+	for _, url := range answerURLPattern.FindAllString(answer, -1) {
+		add(strings.TrimRight(url, ".,;:!?*_"))
+	}
+	return references
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestNextSteps(t *testing.T) {
+	tests := []struct {
+		name, answer string
+		want         []string
+	}{
+		{
+			name: "heading",
+			answer: "The reconciler runs on every replica.\n\n1. Replicas race.\n2. Both decrement.\n\n" +
+				"## Next steps\n\n- Take an advisory lock\n  before reconciling.\n- Add a test.\n\nThat's all.",
+			want: []string{"Take an advisory lock before reconciling.", "Add a test."},
+		},
+		{
+			name:   "bold heading",
+			answer: "**Recommended fix:**\n1. Use `SELECT ... FOR UPDATE`.\n\n2. Retry on conflict.\nDone.",
+			want:   []string{"Use `SELECT ... FOR UPDATE`.", "Retry on conflict."},
+		},
+		{
+			name:   "last numbered list",
+			answer: "Causes:\n- a\n- b\n\nTry:\n1) Restart it\n2) Check the logs",
+			want:   []string{"Restart it", "Check the logs"},
+		},
+		{
+			name:   "prose",
+			answer: "Just use a mutex.",
+			want:   []string{},
+		},
+	}
+	for _, tt := range tests {
+		if got := nextSteps(tt.answer); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestAnswerReferences(t *testing.T) {
+	usage := &ContextUsage{Sections: []SectionUsage{
+		{Name: "summary"},
+		{Name: "file internal/store/a.go"},
+		{Name: "retrieved jobs/reconcile.go:1-60"},
+		{Name: "url https://pkg.go.dev/sync"},
+	}}
+	answer := "See https://pkg.go.dev/sync. and (https://www.postgresql.org/docs/current/explicit-locking.html)."
+	want := []string{"internal/store/a.go", "jobs/reconcile.go:1-60", "https://pkg.go.dev/sync", "https://www.postgresql.org/docs/current/explicit-locking.html"}
+	if got := answerReferences(answer, usage); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestMCPServer_StructuredContent(t *testing.T) {
+	var prompt string
+	tool := NewGetHelpTool("", "o3").WithCache(NewResponseCache(10, 0))
+	tool.LLM().WithProvider(CompletionFunc(func(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error) {
+		prompt = req.Messages[len(req.Messages)-1].Content
+		return &Completion{Answer: "Two replicas reconcile at once.\n\nNext steps:\n1. Take a lock.\n\nCONFIDENCE: medium", Model: req.Model}, nil
+	}))
+	server := NewMCPServer("test", "1.0.0")
+	server.RegisterTool(tool)
+	server.RegisterTool(NewResetSessionTool(NewSessionStore(0)))
+
+	for _, listed := range server.HandleToolsList().Tools {
+		if (listed.OutputSchema != nil) != (listed.Name == "get_help") {
+			t.Errorf("Expected only get_help to advertise an output schema, got %v", listed)
+		}
+	}
+
+	want := map[string]interface{}{
+		"answer":               "Two replicas reconcile at once.\n\nNext steps:\n1. Take a lock.",
+		"confidence":           "medium",
+		"suggested_next_steps": []string{"Take a lock."},
+		"references":           []string{},
+	}
+	for _, call := range []string{"asked", "cached"} {
+		result, _ := server.HandleToolsCall(json.RawMessage(`{"name":"get_help","arguments":{"question":"Why?","summary":"s"}}`))
+		if !reflect.DeepEqual(result.StructuredContent, want) {
+			t.Errorf("%s: expected structured content %v, got %v", call, want, result.StructuredContent)
+		}
+		content := result.Content
+		if content[0]["text"] != want["answer"] || len(content[0]) != 2 {
+			t.Errorf("%s: expected the text block without the confidence line, got %v", call, content)
+		}
+	}
+	if !strings.HasSuffix(prompt, confidenceInstruction) {
+		t.Errorf("Expected the model to be asked for its confidence, got %q", prompt)
+	}
+}
+
+func TestWithoutConfidenceLine(t *testing.T) {
+	var streamed strings.Builder
+	stream, flush := withoutConfidenceLine(func(delta string) { streamed.WriteString(delta) })
+	for _, delta := range []string{"Use a ", "lock.\n", "\nCONF", "IDENCE: ", "high"} {
+		stream(delta)
+	}
+	if streamed.String() != "Use a lock.\n\n" {
+		t.Errorf("Expected the confidence line to be held back, got %q", streamed.String())
+	}
+	flush()
+	if streamed.String() != "Use a lock.\n\n" {
+		t.Errorf("Expected the confidence line to be dropped, got %q", streamed.String())
+	}
+
+	streamed.Reset()
+	stream, flush = withoutConfidenceLine(func(delta string) { streamed.WriteString(delta) })
+	stream("Con")
+	stream("sider a lock")
+	flush()
+	if streamed.String() != "Consider a lock" {
+		t.Errorf("Expected other lines to be streamed, got %q", streamed.String())
+	}
+}
+
+func TestMCPServer_HandleInitialize_ProtocolVersion(t *testing.T) {
+	for requested, want := range map[string]string{
+		"2024-11-05": "2024-11-05",
+		"2025-03-26": "2025-03-26",
+		"2025-06-18": "2025-06-18",
+		"2099-01-01": "2025-06-18",
+		"":           "2025-03-26",
+	} {
+		server := NewMCPServer("test", "1.0.0")
+		if got := initialize(t, server, `{"protocolVersion":"`+requested+`"}`).ProtocolVersion; got != want {
+			t.Errorf("Client asking for %s: expected %s, got %v", requested, want, got)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Client certificate policies for -tls-client-auth.
+const (
+	clientAuthRequire  = "require"
+	clientAuthOptional = "optional"
+)
+
+// NewServerTLS returns the TLS configuration for the HTTP listeners, serving
+// the certificate and key in certFile and keyFile. With clientCAFile, client
+// certificates are verified against the CAs it holds: every client must
+// present one when clientAuth is "require", and those that present one are
+// verified when it is "optional".
+func NewServerTLS(certFile, keyFile, clientCAFile, clientAuth string) (*tls.Config, error) {
+	certs := &certReloader{certFile: certFile, keyFile: keyFile}
+	if _, err := certs.GetCertificate(nil); err != nil {
+		return nil, err
+	}
+	config := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: certs.GetCertificate,
+	}
+	if clientCAFile == "" {
+		return config, nil
+	}
+
+	pem, err := os.ReadFile(clientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("%s holds no PEM certificates", clientCAFile)
+	}
+	config.ClientCAs = pool
+	switch clientAuth {
+	case "", clientAuthRequire:
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	case clientAuthOptional:
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	default:
+		return nil, fmt.Errorf("unknown client certificate policy %q (want require or optional)", clientAuth)
+	}
+	return config, nil
+}
+
+// certReloader serves a certificate from disk, loading it again when the
+// files change, so a renewed certificate is picked up without a restart.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+	checked time.Time
+}
+
+// certCheckInterval is how often the certificate files are checked for
+// changes.
+const certCheckInterval = 10 * time.Second
+
+func (c *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cert != nil && time.Since(c.checked) < certCheckInterval {
+		return c.cert, nil
+	}
+	c.checked = time.Now()
+
+	modTime, err := latestModTime(c.certFile, c.keyFile)
+	if err != nil {
+		if c.cert != nil {
+			return c.cert, nil
+		}
+		return nil, err
+	}
+	if c.cert != nil && modTime.Equal(c.modTime) {
+		return c.cert, nil
+	}
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		if c.cert != nil {
+			// A renewal caught half-written keeps the old certificate
+			// until both files are in place.
+			return c.cert, nil
+		}
+		return nil, fmt.Errorf("couldn't load the TLS certificate: %w", err)
+	}
+	c.cert, c.modTime = &cert, modTime
+	return c.cert, nil
+}
+
+func latestModTime(paths ...string) (time.Time, error) {
+	var latest time.Time
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// listenAndServe serves server over TLS when config is non-nil, and plain
+// HTTP otherwise.
+func listenAndServe(server *http.Server, config *tls.Config) error {
+	if config == nil {
+		return server.ListenAndServe()
+	}
+	server.TLSConfig = config
+	return server.ListenAndServeTLS("", "")
+}
+
+// clientCertName names a caller by the verified client certificate it
+// presented, or returns "" when it presented none.
+func clientCertName(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	subject := r.TLS.VerifiedChains[0][0].Subject
+	if subject.CommonName == "" {
+		return ""
+	}
+	return "cert:" + subject.CommonName
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCert is a certificate and its key, signed by parent (or itself).
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+func newTestCert(t *testing.T, name string, parent *testCert, usage x509.ExtKeyUsage) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA, template.BasicConstraintsValid = true, true
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCert{cert: cert, key: key, der: der}
+}
+
+// write saves the certificate and key as PEM files in dir.
+func (c *testCert) write(t *testing.T, dir, name string) (certFile, keyFile string) {
+	t.Helper()
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile = filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der}), 0644)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	return certFile, keyFile
+}
+
+func (c *testCert) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.der}, PrivateKey: c.key}
+}
+
+func TestNewServerTLS_MutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "escalator-ca", nil, x509.ExtKeyUsageAny)
+	caFile, _ := ca.write(t, dir, "ca")
+	certFile, keyFile := newTestCert(t, "127.0.0.1", ca, x509.ExtKeyUsageServerAuth).write(t, dir, "server")
+	client := newTestCert(t, "ci-runner", ca, x509.ExtKeyUsageClientAuth)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	get := func(config *tls.Config, cert *testCert) (string, error) {
+		// httptest would serve its own certificate, so serve ours directly.
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		srv := &http.Server{TLSConfig: config, Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(httpClientName(r)))
+		})}
+		go srv.ServeTLS(ln, "", "")
+		defer srv.Close()
+		clientConfig := &tls.Config{RootCAs: roots}
+		if cert != nil {
+			clientConfig.Certificates = []tls.Certificate{cert.tlsCertificate()}
+		}
+		resp, err := (&http.Client{Transport: &http.Transport{TLSClientConfig: clientConfig}}).Get("https://" + ln.Addr().String())
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body := make([]byte, 64)
+		n, _ := resp.Body.Read(body)
+		return string(body[:n]), nil
+	}
+
+	config, err := NewServerTLS(certFile, keyFile, caFile, clientAuthRequire)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name, err := get(config, client); err != nil || name != "cert:ci-runner" {
+		t.Errorf("Expected the client named after its certificate, got %q, %v", name, err)
+	}
+	if _, err := get(config, nil); err == nil {
+		t.Error("Expected a client without a certificate refused")
+	}
+	stranger := newTestCert(t, "stranger", newTestCert(t, "other-ca", nil, x509.ExtKeyUsageAny), x509.ExtKeyUsageClientAuth)
+	if _, err := get(config, stranger); err == nil {
+		t.Error("Expected a certificate from another CA refused")
+	}
+
+	config, err = NewServerTLS(certFile, keyFile, caFile, clientAuthOptional)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name, err := get(config, nil); err != nil || name != "127.0.0.1" {
+		t.Errorf("Expected a client without a certificate let in by address, got %q, %v", name, err)
+	}
+
+	if _, err := NewServerTLS(certFile, keyFile, caFile, "sometimes"); err == nil {
+		t.Error("Expected an unknown client certificate policy refused")
+	}
+	if _, err := NewServerTLS(certFile, filepath.Join(dir, "missing.key"), "", ""); err == nil {
+		t.Error("Expected a missing key refused at startup")
+	}
+}
+
+func TestCertReloader_PicksUpRenewal(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "escalator-ca", nil, x509.ExtKeyUsageAny)
+	certFile, keyFile := newTestCert(t, "old", ca, x509.ExtKeyUsageServerAuth).write(t, dir, "server")
+	reloader := &certReloader{certFile: certFile, keyFile: keyFile}
+	if cert, err := reloader.GetCertificate(nil); err != nil || cert.Leaf.Subject.CommonName != "old" {
+		t.Fatalf("Expected the old certificate, got %v", err)
+	}
+
+	newTestCert(t, "renewed", ca, x509.ExtKeyUsageServerAuth).write(t, dir, "server")
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+	if cert, _ := reloader.GetCertificate(nil); cert.Leaf.Subject.CommonName != "old" {
+		t.Error("Expected the files checked at most every few seconds")
+	}
+	reloader.checked = time.Time{}
+	if cert, err := reloader.GetCertificate(nil); err != nil || cert.Leaf.Subject.CommonName != "renewed" {
+		t.Errorf("Expected the renewed certificate, got %v", err)
+	}
+
+	os.WriteFile(keyFile, []byte("half-written"), 0600)
+	os.Chtimes(keyFile, later.Add(time.Minute), later.Add(time.Minute))
+	reloader.checked = time.Time{}
+	if cert, err := reloader.GetCertificate(nil); err != nil || cert.Leaf.Subject.CommonName != "renewed" {
+		t.Errorf("Expected the last good certificate kept, got %v", err)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// modelTools are the tools that call the model with their own prompt and
+// so can have their own model. get_help and the tools that ask through it
+// use -model, and get_second_opinion uses -ensemble-models.
+var modelTools = []string{"brainstorm_options", "compare_approaches", "generate_tests", "security_audit"}
+
+// toolModelFlag collects repeated -tool-model tool=model flags: the model a
+// tool uses instead of -model, such as the strongest one for security
+// audits.
+type toolModelFlag map[string]string
+
+func (m toolModelFlag) repeatable() {}
+
+func (m toolModelFlag) String() string {
+	pairs := make([]string, 0, len(m))
+	for tool, model := range m {
+		pairs = append(pairs, tool+"="+model)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ", ")
+}
+
+func (m toolModelFlag) Set(value string) error {
+	tool, model, ok := strings.Cut(value, "=")
+	tool, model = strings.TrimSpace(tool), strings.TrimSpace(model)
+	if !ok || tool == "" || model == "" {
+		return fmt.Errorf("tool model must be in the form tool=model, got %q", value)
+	}
+	if !slices.Contains(modelTools, tool) {
+		return fmt.Errorf("tool %q can't have its own model (want %s)", tool, strings.Join(modelTools, ", "))
+	}
+	m[tool] = model
+	return nil
+}
+
+// For returns the backend tool should use: llm with the tool's model as
+// primary, keeping its fallbacks, budget and redaction, or llm itself when
+// the tool has no model of its own.
+func (m toolModelFlag) For(tool string, llm *LLM) *LLM {
+	if model, ok := m[tool]; ok {
+		return llm.WithPrimary(model)
+	}
+	return llm
+}
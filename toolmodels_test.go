@@ -0,0 +1,26 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestToolModelFlag(t *testing.T) {
+	models := toolModelFlag{}
+	if err := models.Set("security_audit = o3"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	for _, value := range []string{"security_audit", "get_help=o3", "security_audit="} {
+		if err := models.Set(value); err == nil {
+			t.Errorf("Expected an error for %q", value)
+		}
+	}
+
+	shared := NewLLM("gpt-4o").WithFallbackModels([]string{"gpt-4o-mini"})
+	if got := models.For("security_audit", shared).modelChain(); strings.Join(got, ",") != "o3,gpt-4o-mini" {
+		t.Errorf("Expected o3 with the shared fallbacks, got %v", got)
+	}
+	if models.For("brainstorm_options", shared) != shared {
+		t.Error("Expected tools without their own model to share the backend")
+	}
+}
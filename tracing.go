@@ -0,0 +1,366 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OTLP span kinds.
+const (
+	spanKindInternal = 1
+	spanKindServer   = 2
+	spanKindClient   = 3
+)
+
+// Spans are exported in batches of up to maxSpanBatch, and at least every
+// spanExportInterval while Run is running.
+const (
+	maxSpanBatch       = 64
+	spanExportInterval = 5 * time.Second
+)
+
+// Tracer records spans for JSON-RPC requests, tool calls and model calls
+// and exports them to an OpenTelemetry collector over OTLP/HTTP, so a slow
+// agent pipeline shows whether the time went to the escalator or the
+// model. A nil *Tracer records nothing.
+type Tracer struct {
+	endpoint   string
+	headers    map[string]string
+	service    string
+	version    string
+	httpClient *http.Client
+
+	mu      sync.Mutex
+	queue   []*Span
+	pending sync.WaitGroup
+}
+
+// NewTracer exports to the OTLP/HTTP collector at endpoint, e.g.
+// http://localhost:4318. The path /v1/traces is added unless endpoint
+// already names it.
+func NewTracer(endpoint, service, version string) *Tracer {
+	endpoint = strings.TrimRight(endpoint, "/")
+	if !strings.HasSuffix(endpoint, "/v1/traces") {
+		endpoint += "/v1/traces"
+	}
+	return &Tracer{
+		endpoint:   endpoint,
+		service:    service,
+		version:    version,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// WithHeaders sends headers, such as a collector's API key, with every
+// export.
+func (t *Tracer) WithHeaders(headers map[string]string) *Tracer {
+	t.headers = headers
+	return t
+}
+
+// parseOTLPHeaders parses OTEL_EXPORTER_OTLP_HEADERS: comma-separated
+// key=value pairs with URL-encoded values.
+func parseOTLPHeaders(value string) (map[string]string, error) {
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		key, val, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("invalid OTLP header %q: want key=value", pair)
+		}
+		decoded, err := url.QueryUnescape(strings.TrimSpace(val))
+		if err != nil {
+			return nil, fmt.Errorf("invalid OTLP header %q: %w", pair, err)
+		}
+		headers[strings.TrimSpace(key)] = decoded
+	}
+	return headers, nil
+}
+
+// Span is one timed operation in a trace.
+type Span struct {
+	tracer   *Tracer
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte
+	sampled  bool
+	name     string
+	kind     int
+	start    time.Time
+
+	mu    sync.Mutex
+	attrs []any
+	end   time.Time
+	err   error
+}
+
+type spanContextKey struct{}
+
+func spanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanContextKey{}).(*Span)
+	return span
+}
+
+// withTraceparent makes the span named by a W3C traceparent header, e.g.
+// 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01, the parent of
+// spans started from the returned context. An invalid header is ignored.
+func withTraceparent(ctx context.Context, traceparent string) context.Context {
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return ctx
+	}
+	if parts[0] == "00" && len(parts) != 4 {
+		return ctx
+	}
+	remote := &Span{}
+	traceID, err1 := hex.Decode(remote.traceID[:], []byte(parts[1]))
+	spanID, err2 := hex.Decode(remote.spanID[:], []byte(parts[2]))
+	flags, err3 := strconv.ParseUint(parts[3], 16, 8)
+	if err1 != nil || err2 != nil || err3 != nil || traceID != 16 || spanID != 8 ||
+		remote.traceID == [16]byte{} || remote.spanID == [8]byte{} {
+		return ctx
+	}
+	remote.sampled = flags&1 == 1
+	return context.WithValue(ctx, spanContextKey{}, remote)
+}
+
+// Start begins a span, a child of the span in ctx if there is one, and
+// returns a context carrying it.
+func (t *Tracer) Start(ctx context.Context, name string, kind int) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+	span := &Span{tracer: t, sampled: true, name: name, kind: kind, start: time.Now()}
+	if parent := spanFromContext(ctx); parent != nil {
+		span.traceID = parent.traceID
+		span.parentID = parent.spanID
+		span.sampled = parent.sampled
+	} else {
+		rand.Read(span.traceID[:])
+	}
+	rand.Read(span.spanID[:])
+	return context.WithValue(ctx, spanContextKey{}, span), span
+}
+
+// startSpan begins a child of the span in ctx, recorded by that span's
+// tracer. Without a local span in ctx it records nothing.
+func startSpan(ctx context.Context, name string, kind int) (context.Context, *Span) {
+	parent := spanFromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+	return parent.tracer.Start(ctx, name, kind)
+}
+
+// startToolSpan begins the span of a tool call, named and tagged as the
+// OpenTelemetry GenAI conventions name tool executions.
+func (s *MCPServer) startToolSpan(ctx context.Context, toolName string) (context.Context, *Span) {
+	ctx, span := s.tracer.Start(ctx, "execute_tool "+toolName, spanKindInternal)
+	span.SetAttributes("gen_ai.operation.name", "execute_tool", "gen_ai.tool.name", toolName, "mcp.client.name", s.mcpClientName())
+	return ctx, span
+}
+
+// paramsTraceparent returns the traceparent a client put in a request's
+// _meta, if any.
+func paramsTraceparent(params json.RawMessage) string {
+	var carrier struct {
+		Meta struct {
+			Traceparent string `json:"traceparent"`
+		} `json:"_meta"`
+	}
+	json.Unmarshal(params, &carrier)
+	return carrier.Meta.Traceparent
+}
+
+// SetAttributes records key/value pairs on the span, as for slog.
+func (s *Span) SetAttributes(args ...any) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attrs = append(s.attrs, args...)
+}
+
+// TraceID is the span's trace ID in hex, as collectors show it.
+func (s *Span) TraceID() string {
+	if s == nil {
+		return ""
+	}
+	return hex.EncodeToString(s.traceID[:])
+}
+
+// End finishes the span, marking it failed when err is non-nil, and queues
+// it for export.
+func (s *Span) End(err error) {
+	if s == nil || s.tracer == nil {
+		return
+	}
+	s.mu.Lock()
+	s.end = time.Now()
+	s.err = err
+	s.mu.Unlock()
+	if s.sampled {
+		s.tracer.enqueue(s)
+	}
+}
+
+func (t *Tracer) enqueue(span *Span) {
+	t.mu.Lock()
+	t.queue = append(t.queue, span)
+	full := len(t.queue) >= maxSpanBatch
+	t.mu.Unlock()
+	if full {
+		t.exportQueued()
+	}
+}
+
+// Run exports queued spans every few seconds until ctx is done.
+func (t *Tracer) Run(ctx context.Context) {
+	ticker := time.NewTicker(spanExportInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			t.exportQueued()
+		}
+	}
+}
+
+// Flush exports the queued spans and waits up to timeout for exports
+// still being sent.
+func (t *Tracer) Flush(timeout time.Duration) {
+	if t == nil {
+		return
+	}
+	t.exportQueued()
+	done := make(chan struct{})
+	go func() {
+		t.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		slog.Warn("Gave up waiting for spans to be exported", "timeout", timeout)
+	}
+}
+
+// exportQueued sends the queued spans in the background. A failed export
+// is logged and its spans dropped; tracing never holds up an escalation.
+func (t *Tracer) exportQueued() {
+	t.mu.Lock()
+	batch := t.queue
+	t.queue = nil
+	t.mu.Unlock()
+	if len(batch) == 0 {
+		return
+	}
+	t.pending.Add(1)
+	go func() {
+		defer t.pending.Done()
+		if err := t.export(batch); err != nil {
+			slog.Warn("Couldn't export spans", "endpoint", t.endpoint, "spans", len(batch), "error", err)
+		}
+	}()
+}
+
+func (t *Tracer) export(batch []*Span) error {
+	body, err := json.Marshal(t.payload(batch))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, t.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range t.headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("collector returned %s", resp.Status)
+	}
+	return nil
+}
+
+// payload shapes spans as an OTLP/JSON ExportTraceServiceRequest.
+func (t *Tracer) payload(batch []*Span) map[string]interface{} {
+	spans := make([]map[string]interface{}, 0, len(batch))
+	for _, s := range batch {
+		s.mu.Lock()
+		span := map[string]interface{}{
+			"traceId":           hex.EncodeToString(s.traceID[:]),
+			"spanId":            hex.EncodeToString(s.spanID[:]),
+			"name":              s.name,
+			"kind":              s.kind,
+			"startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(s.end.UnixNano(), 10),
+			"attributes":        otlpAttributes(s.attrs...),
+		}
+		if s.parentID != [8]byte{} {
+			span["parentSpanId"] = hex.EncodeToString(s.parentID[:])
+		}
+		if s.err != nil {
+			span["status"] = map[string]interface{}{"code": 2, "message": s.err.Error()}
+		}
+		s.mu.Unlock()
+		spans = append(spans, span)
+	}
+	return map[string]interface{}{
+		"resourceSpans": []map[string]interface{}{{
+			"resource": map[string]interface{}{
+				"attributes": otlpAttributes("service.name", t.service, "service.version", t.version),
+			},
+			"scopeSpans": []map[string]interface{}{{
+				"scope": map[string]interface{}{"name": "code-escalator", "version": t.version},
+				"spans": spans,
+			}},
+		}},
+	}
+}
+
+// otlpAttributes converts key/value pairs to OTLP attributes. Values that
+// aren't strings, integers, floats or booleans are formatted as strings.
+func otlpAttributes(args ...any) []map[string]interface{} {
+	attrs := make([]map[string]interface{}, 0, len(args)/2)
+	for i := 0; i+1 < len(args); i += 2 {
+		var value map[string]interface{}
+		switch v := args[i+1].(type) {
+		case string:
+			value = map[string]interface{}{"stringValue": v}
+		case int:
+			value = map[string]interface{}{"intValue": strconv.Itoa(v)}
+		case int64:
+			value = map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+		case float64:
+			value = map[string]interface{}{"doubleValue": v}
+		case bool:
+			value = map[string]interface{}{"boolValue": v}
+		default:
+			value = map[string]interface{}{"stringValue": fmt.Sprint(v)}
+		}
+		attrs = append(attrs, map[string]interface{}{"key": fmt.Sprint(args[i]), "value": value})
+	}
+	return attrs
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+type exportedSpan struct {
+	TraceID      string `json:"traceId"`
+	SpanID       string `json:"spanId"`
+	ParentSpanID string `json:"parentSpanId"`
+	Name         string `json:"name"`
+	Kind         int    `json:"kind"`
+	Attributes   []struct {
+		Key   string                 `json:"key"`
+		Value map[string]interface{} `json:"value"`
+	} `json:"attributes"`
+	Status *struct {
+		Code int `json:"code"`
+	} `json:"status"`
+}
+
+func (s exportedSpan) attribute(key string) interface{} {
+	for _, attr := range s.Attributes {
+		if attr.Key == key {
+			for _, value := range attr.Value {
+				return value
+			}
+		}
+	}
+	return nil
+}
+
+// newFakeCollector starts an OTLP/HTTP stub and returns it with a function
+// listing the spans exported to it by name.
+func newFakeCollector(t *testing.T) (*httptest.Server, func() map[string]exportedSpan) {
+	t.Helper()
+	var mu sync.Mutex
+	spans := make(map[string]exportedSpan)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Authorization") != "Bearer token" {
+			http.Error(w, "unexpected export", http.StatusBadRequest)
+			return
+		}
+		var payload struct {
+			ResourceSpans []struct {
+				ScopeSpans []struct {
+					Spans []exportedSpan `json:"spans"`
+				} `json:"scopeSpans"`
+			} `json:"resourceSpans"`
+		}
+		json.NewDecoder(r.Body).Decode(&payload)
+		mu.Lock()
+		defer mu.Unlock()
+		for _, resource := range payload.ResourceSpans {
+			for _, scope := range resource.ScopeSpans {
+				for _, span := range scope.Spans {
+					spans[span.Name] = span
+				}
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() map[string]exportedSpan {
+		mu.Lock()
+		defer mu.Unlock()
+		return spans
+	}
+}
+
+func TestTracer_ToolCall(t *testing.T) {
+	collector, exported := newFakeCollector(t)
+	tracer := NewTracer(collector.URL, "escalator", "1.0.0").WithHeaders(map[string]string{"Authorization": "Bearer token"})
+
+	tool := NewGetHelpTool("", "o3")
+	tool.LLM().WithProvider(CompletionFunc(func(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error) {
+		return &Completion{Answer: "Add an index.", Model: req.Model, PromptTokens: 1000, CompletionTokens: 500}, nil
+	}))
+	server := NewMCPServer("test", "1.0.0").WithTracer(tracer)
+	server.RegisterTool(tool)
+
+	server.ProcessRequest(JsonRPCRequest{Jsonrpc: "2.0", ID: 1, Method: "tools/call", Params: json.RawMessage(`{
+		"name": "get_help",
+		"arguments": {"question": "Why is it slow?", "summary": "s"},
+		"_meta": {"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}
+	}`)})
+	tracer.Flush(5 * time.Second)
+
+	spans := exported()
+	request, call, model := spans["tools/call"], spans["execute_tool get_help"], spans["chat o3"]
+	if request.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || request.ParentSpanID != "00f067aa0ba902b7" || request.Kind != spanKindServer {
+		t.Errorf("Expected the request span to continue the caller's trace, got %+v", request)
+	}
+	if call.ParentSpanID != request.SpanID || call.TraceID != request.TraceID {
+		t.Errorf("Expected the tool call span under the request span, got %+v", call)
+	}
+	if model.ParentSpanID != call.SpanID || model.Kind != spanKindClient {
+		t.Errorf("Expected the model call span under the tool call span, got %+v", model)
+	}
+	if got := model.attribute("gen_ai.usage.input_tokens"); got != "1000" {
+		t.Errorf("Expected the model span to carry token usage, got %v", got)
+	}
+}
+
+func TestTracer_FailedRequest(t *testing.T) {
+	collector, exported := newFakeCollector(t)
+	tracer := NewTracer(collector.URL+"/v1/traces", "escalator", "1.0.0").WithHeaders(map[string]string{"Authorization": "Bearer token"})
+	server := NewMCPServer("test", "1.0.0").WithTracer(tracer)
+
+	server.ProcessRequest(JsonRPCRequest{Jsonrpc: "2.0", ID: 1, Method: "tools/call", Params: json.RawMessage(`{"name":"missing"}`)})
+	tracer.Flush(5 * time.Second)
+
+	span := exported()["tools/call"]
+	if span.ParentSpanID != "" || span.TraceID == "" {
+		t.Errorf("Expected a new trace without a traceparent, got %+v", span)
+	}
+	if span.Status == nil || span.Status.Code != 2 || span.attribute("rpc.jsonrpc.error_code") != "-32602" {
+		t.Errorf("Expected the span to record the error, got %+v", span)
+	}
+}
+
+func TestWithTraceparent(t *testing.T) {
+	for header, valid := range map[string]bool{
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01":        true,
+		"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-future": true,
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra":  false,
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01":        false,
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01":        false,
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01":        false,
+		"00-4bf92f3577b34da6a3ce929d0e0e473z-00f067aa0ba902b7-01":        false,
+		"": false,
+	} {
+		if got := spanFromContext(withTraceparent(context.Background(), header)) != nil; got != valid {
+			t.Errorf("%q: expected valid %v, got %v", header, valid, got)
+		}
+	}
+
+	// Spans of an unsampled trace aren't exported.
+	tracer := NewTracer("http://127.0.0.1:0", "escalator", "1.0.0")
+	_, span := tracer.Start(withTraceparent(context.Background(), "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00"), "tools/call", spanKindServer)
+	span.End(nil)
+	if len(tracer.queue) != 0 {
+		t.Errorf("Expected an unsampled span to be dropped, got %d queued", len(tracer.queue))
+	}
+}
+
+func TestParseOTLPHeaders(t *testing.T) {
+	headers, err := parseOTLPHeaders("Authorization=Bearer%20token, x-team = platform")
+	if err != nil || headers["Authorization"] != "Bearer token" || headers["x-team"] != "platform" {
+		t.Errorf("Expected both headers decoded, got %v, %v", headers, err)
+	}
+	if _, err := parseOTLPHeaders("no-equals"); err == nil {
+		t.Error("Expected an error for a header without a value")
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// Translation records a question asked in another language: the language,
+// and the English question and answer exchanged with the architect model.
+type Translation struct {
+	Language string `json:"language"`
+	Question string `json:"question"`
+	Answer   string `json:"answer"`
+}
+
+// Translator uses a cheap model to ask non-English questions in English,
+// where the architect model answers best, and to translate the answers back.
+type Translator struct {
+	llm *LLM
+}
+
+func NewTranslator(llm *LLM) *Translator {
+	return &Translator{llm: llm}
+}
+
+// englishStopwords are common English words; questions without any are
+// probably in another language.
+var englishStopwords = map[string]bool{
+	"the": true, "a": true, "an": true, "is": true, "are": true, "was": true, "be": true,
+	"do": true, "does": true, "did": true, "how": true, "why": true, "what": true, "when": true,
+	"where": true, "which": true, "who": true, "should": true, "can": true, "could": true,
+	"would": true, "i": true, "we": true, "it": true, "this": true, "that": true, "to": true,
+	"of": true, "in": true, "on": true, "for": true, "with": true, "and": true, "or": true,
+	"not": true, "my": true, "our": true, "there": true, "from": true, "at": true, "by": true,
+}
+
+var codePattern = regexp.MustCompile("(?s)```.*?```|`[^`]*`")
+
+// mightBeNonEnglish is a cheap check that spares a model call for questions
+// that are clearly English. Code is ignored, since identifiers are English
+// whatever language the question is in.
+func mightBeNonEnglish(question string) bool {
+	prose := codePattern.ReplaceAllString(question, " ")
+
+	letters, foreign := 0, 0
+	for _, r := range prose {
+		if unicode.IsLetter(r) {
+			letters++
+			if r > unicode.MaxASCII {
+				foreign++
+			}
+		}
+	}
+	if letters == 0 {
+		return false
+	}
+	if float64(foreign)/float64(letters) > 0.1 {
+		return true
+	}
+
+	words := strings.FieldsFunc(strings.ToLower(prose), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	})
+	if len(words) < 4 {
+		return false
+	}
+	for _, word := range words {
+		if englishStopwords[word] {
+			return false
+		}
+	}
+	return true
+}
+
+// ToEnglish detects the question's language and translates it to English.
+// It returns a nil translation for English questions. The completion, when
+// non-nil, is the model call to count towards usage.
+func (t *Translator) ToEnglish(ctx context.Context, question string) (*Translation, *Completion, error) {
+	if !mightBeNonEnglish(question) {
+		return nil, nil, nil
+	}
+
+	completion, err := t.llm.Generate(ctx, openai.ChatCompletionRequest{
+		Messages: []openai.ChatCompletionMessage{
+			{
+				Role: openai.ChatMessageRoleUser,
+				Content: `Identify the language of the question below. If it isn't English, translate it into English, leaving code, identifiers, file paths, commands and error messages unchanged.
+
+Respond with a JSON object of this exact shape:
+{"language": "the question's language, named in English", "english": "the question in English"}
+
+<question>
+` + question + `
+</question>`,
+			},
+		},
+		ResponseFormat: &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject},
+	}, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var detected struct {
+		Language string `json:"language"`
+		English  string `json:"english"`
+	}
+	if err := json.Unmarshal([]byte(completion.Answer), &detected); err != nil {
+		return nil, completion, fmt.Errorf("couldn't parse language detection: %w", err)
+	}
+	if detected.Language == "" || strings.EqualFold(detected.Language, "english") || detected.English == "" {
+		return nil, completion, nil
+	}
+
+	slog.InfoContext(ctx, "Translated a question", "language", detected.Language)
+	return &Translation{Language: detected.Language, Question: detected.English}, completion, nil
+}
+
+// FromEnglish translates an answer into language.
+func (t *Translator) FromEnglish(ctx context.Context, answer, language string) (*Completion, error) {
+	return t.llm.Generate(ctx, userRequest(fmt.Sprintf(`Translate this answer into %s. Leave code blocks, identifiers, file paths, commands and error messages unchanged and keep the Markdown formatting. Respond with only the translation.
+
+%s`, language, answer)), nil)
+}
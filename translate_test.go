@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestMightBeNonEnglish(t *testing.T) {
+	tests := []struct {
+		question string
+		want     bool
+	}{
+		{"Why does the handler leak goroutines?", false},
+		{"¿Por qué se bloquea la reserva de stock?", true},
+		{"Pourquoi le cache renvoie toujours une ancienne valeur ?", true},
+		{"为什么这个函数会死锁？", true},
+		{"Warum `ctx.Done()` nie geschlossen wird", true},
+		{"mutex vs channel", false},
+		{"Should I use `sync.Map` here?", false},
+	}
+	for _, tt := range tests {
+		if got := mightBeNonEnglish(tt.question); got != tt.want {
+			t.Errorf("mightBeNonEnglish(%q) = %v, want %v", tt.question, got, tt.want)
+		}
+	}
+}
+
+// fakeTranslator answers language detection with a fixed translation and
+// translation requests by tagging the text.
+func fakeTranslator(language, english string) *Translator {
+	return NewTranslator(NewLLM("cheap").WithProvider(CompletionFunc(func(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error) {
+		prompt := req.Messages[0].Content
+		if req.ResponseFormat != nil {
+			return &Completion{Answer: `{"language": "` + language + `", "english": "` + english + `"}`, Model: req.Model, PromptTokens: 10, CompletionTokens: 10}, nil
+		}
+		answer := prompt[strings.LastIndex(prompt, "\n")+1:]
+		return &Completion{Answer: "[" + language + "] " + answer, Model: req.Model, PromptTokens: 10, CompletionTokens: 10}, nil
+	})))
+}
+
+func TestTranslator_ToEnglish(t *testing.T) {
+	translation, completion, err := fakeTranslator("Spanish", "Why?").ToEnglish(context.Background(), "¿Por qué falla la caché?")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if translation == nil || translation.Language != "Spanish" || translation.Question != "Why?" || completion == nil {
+		t.Errorf("Expected a Spanish translation, got %+v", translation)
+	}
+
+	translation, completion, _ = fakeTranslator("English", "Why?").ToEnglish(context.Background(), "Pourquoi pas maintenant alors")
+	if translation != nil || completion == nil {
+		t.Errorf("Expected no translation when the model says English, got %+v", translation)
+	}
+
+	translation, completion, _ = fakeTranslator("Spanish", "x").ToEnglish(context.Background(), "Why does this fail?")
+	if translation != nil || completion != nil {
+		t.Error("Expected obviously English questions to skip the model")
+	}
+}
+
+func TestGetHelpTool_Call_Translated(t *testing.T) {
+	var asked string
+	store := openTestHistory(t)
+	tool := NewGetHelpTool("", "o3").
+		WithHistory(store).
+		WithTranslator(fakeTranslator("Spanish", "How do I avoid double booking?"))
+	tool.LLM().WithProvider(CompletionFunc(func(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error) {
+		asked = req.Messages[len(req.Messages)-1].Content
+		return &Completion{Answer: "Use a transaction", Model: req.Model, PromptTokens: 100, CompletionTokens: 50}, nil
+	}))
+
+	var deltas []string
+	question := "¿Cómo evito las reservas dobles?"
+	content, err := tool.CallStream(map[string]interface{}{"question": question, "summary": "s"}, func(delta string) {
+		deltas = append(deltas, delta)
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if !strings.Contains(asked, "How do I avoid double booking?") || strings.Contains(asked, question) {
+		t.Errorf("Expected the architect to be asked in English, got %q", asked)
+	}
+	if content[0]["text"] != "[Spanish] Use a transaction" {
+		t.Errorf("Expected the answer translated back, got %q", content[0]["text"])
+	}
+	if len(deltas) != 1 || deltas[0] != "[Spanish] Use a transaction" {
+		t.Errorf("Expected only the translated answer to be streamed, got %q", deltas)
+	}
+
+	meta := content[0]["_meta"].(map[string]interface{})
+	if meta["language"] != "Spanish" {
+		t.Errorf("Expected the language in the metadata, got %v", meta["language"])
+	}
+	if usage := meta["usage"].(*TokenUsage); usage.PromptTokens != 120 {
+		t.Errorf("Expected translation calls to count towards usage, got %+v", usage)
+	}
+
+	records, _ := store.All()
+	if len(records) != 1 {
+		t.Fatalf("Expected one record, got %d", len(records))
+	}
+	rec := records[0]
+	if rec.Question != question || rec.Answer != "[Spanish] Use a transaction" || rec.Arguments["question"] != question {
+		t.Errorf("Expected the caller's question and answer in history, got %+v", rec)
+	}
+	if rec.Translation == nil || rec.Translation.Question != "How do I avoid double booking?" || rec.Translation.Answer != "Use a transaction" {
+		t.Errorf("Expected the English exchange in history, got %+v", rec.Translation)
+	}
+}
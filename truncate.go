@@ -0,0 +1,302 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// promptCharLimit is the default prompt budget in characters (~4 chars per
+// token).
+const promptCharLimit = promptTokenBudget * 4
+
+// promptTextLimit is the budget for the rendered prompt at the default soft
+// limit: the prompt budget less the confidence instruction added to every
+// request.
+const promptTextLimit = promptCharLimit - len(confidenceInstruction)
+
+// defaultHardPromptLimit is the largest prompt, in estimated tokens, sent
+// when a caller allows a large prompt.
+const defaultHardPromptLimit = 80000
+
+// promptTextBytes is the budget for the rendered prompt under a limit of
+// tokens (~4 chars per token), less the confidence instruction added to
+// every request.
+func promptTextBytes(tokens int) int {
+	return tokens*4 - len(confidenceInstruction)
+}
+
+// groupThousands formats n with commas, as in 20,000.
+func groupThousands(n int) string {
+	digits := strconv.Itoa(n)
+	for i := len(digits) - 3; i > 0; i -= 3 {
+		digits = digits[:i] + "," + digits[i:]
+	}
+	return digits
+}
+
+// promptSection is a piece of prompt context that may be trimmed to fit the
+// prompt budget. The question is never a promptSection: it is always sent
+// intact.
+type promptSection struct {
+	Name     string
+	Text     string
+	Priority int
+	// Source names where the section came from, and Score how relevant
+	// that source judged it, for the prompt's assembly record.
+	Source string
+	Score  float64
+	// Provenance labels the section in the prompt with its source and
+	// freshness, such as "FILE api/http.go lines 1–95 (modified 3 days ago)".
+	Provenance string
+	original   string
+	// referenced is set when the section is already in the conversation,
+	// and only referred to.
+	referenced bool
+}
+
+func newPromptSection(name, text string) *promptSection {
+	return &promptSection{Name: name, Text: text, original: text}
+}
+
+// trimmedTokens estimates how much of the section was trimmed.
+func (s *promptSection) trimmedTokens() int {
+	return estimateTokens(s.original) - estimateTokens(s.Text)
+}
+
+// fitContext trims excess characters from the prompt context. The summary's
+// sections least relevant to the question are dropped first, keeping its
+// opening; then the code and other context are truncated from the middle,
+// largest first. It reports how many characters it couldn't remove.
+func fitContext(excess int, question string, summary *promptSection, code []*promptSection) int {
+	if excess <= 0 {
+		return 0
+	}
+
+	if summary != nil {
+		before := len(summary.Text)
+		summary.Text = dropIrrelevantSections(summary.Text, question, len(summary.Text)-excess)
+		excess -= before - len(summary.Text)
+		if excess <= 0 {
+			return 0
+		}
+		code = append(code, summary)
+	}
+
+	total := 0
+	for _, s := range code {
+		total += len(s.Text)
+	}
+	if excess >= total {
+		for _, s := range code {
+			s.Text = ""
+		}
+		return excess - total
+	}
+
+	// Cut every section down to a common cap chosen so that exactly enough
+	// is removed, so small sections are left untouched.
+	limit := capFor(code, total-excess)
+	for _, s := range code {
+		before := len(s.Text)
+		s.Text = truncateMiddle(s.Text, limit)
+		excess -= before - len(s.Text)
+	}
+	return max(excess, 0)
+}
+
+// fitGathered is fitContext for the context the escalator gathered itself:
+// each priority tier below PriorityNamed, lowest first, is trimmed before
+// the next is touched, and then summary unless it is nil. What the caller
+// named or selected is left whole. It reports how many characters it
+// couldn't remove.
+func fitGathered(excess int, question string, summary *promptSection, code []*promptSection) int {
+	for _, tier := range sectionsByPriority(code) {
+		if excess <= 0 || tier[0].Priority >= PriorityNamed {
+			break
+		}
+		excess = fitContext(excess, question, nil, tier)
+	}
+	if excess > 0 && summary != nil {
+		excess = fitContext(excess, question, summary, nil)
+	}
+	return max(excess, 0)
+}
+
+// sectionsByPriority groups sections by priority, lowest first.
+func sectionsByPriority(sections []*promptSection) [][]*promptSection {
+	tiers := make(map[int][]*promptSection)
+	var priorities []int
+	for _, s := range sections {
+		if _, ok := tiers[s.Priority]; !ok {
+			priorities = append(priorities, s.Priority)
+		}
+		tiers[s.Priority] = append(tiers[s.Priority], s)
+	}
+	sort.Ints(priorities)
+	grouped := make([][]*promptSection, len(priorities))
+	for i, p := range priorities {
+		grouped[i] = tiers[p]
+	}
+	return grouped
+}
+
+// capFor returns the largest per-section length at which sections sum to at
+// most budget characters.
+func capFor(sections []*promptSection, budget int) int {
+	lengths := make([]int, len(sections))
+	for i, s := range sections {
+		lengths[i] = len(s.Text)
+	}
+	sort.Ints(lengths)
+
+	used := 0
+	for i, n := range lengths {
+		remaining := len(lengths) - i
+		if used+n*remaining > budget {
+			return (budget - used) / remaining
+		}
+		used += n
+	}
+	return lengths[len(lengths)-1]
+}
+
+// dropIrrelevantSections removes markdown sections from summary, least
+// relevant to the question first, until it is at most limit characters or
+// only its opening (the text before the second heading) is left.
+func dropIrrelevantSections(summary, question string, limit int) string {
+	sections := splitMarkdownSections(summary)
+	if len(sections) < 2 {
+		return summary
+	}
+
+	keywords := questionKeywords(question)
+	type candidate struct {
+		index int
+		score float64
+	}
+	candidates := make([]candidate, 0, len(sections)-1)
+	for i := 1; i < len(sections); i++ {
+		candidates = append(candidates, candidate{i, relevance(sections[i], keywords)})
+	}
+	// Least relevant first; among equals, later sections go first.
+	sort.SliceStable(candidates, func(a, b int) bool {
+		if candidates[a].score != candidates[b].score {
+			return candidates[a].score < candidates[b].score
+		}
+		return candidates[a].index > candidates[b].index
+	})
+
+	dropped := make([]bool, len(sections))
+	length := len(summary)
+	for _, c := range candidates {
+		if length <= limit {
+			break
+		}
+		dropped[c.index] = true
+		length -= len(sections[c.index])
+	}
+
+	var b strings.Builder
+	for i, section := range sections {
+		if !dropped[i] {
+			b.WriteString(section)
+		}
+	}
+	return b.String()
+}
+
+// splitMarkdownSections splits text before each heading line. Joining the
+// result gives back text.
+func splitMarkdownSections(text string) []string {
+	var sections []string
+	start := 0
+	inFence := false
+	for offset := 0; offset < len(text); {
+		end := strings.IndexByte(text[offset:], '\n')
+		if end < 0 {
+			end = len(text)
+		} else {
+			end += offset + 1
+		}
+		line := text[offset:end]
+		if strings.HasPrefix(line, "```") {
+			inFence = !inFence
+		} else if !inFence && strings.HasPrefix(line, "#") && offset > start {
+			sections = append(sections, text[start:offset])
+			start = offset
+		}
+		offset = end
+	}
+	return append(sections, text[start:])
+}
+
+// questionKeywords returns the distinct words of the question worth matching
+// against the summary.
+func questionKeywords(question string) []string {
+	seen := make(map[string]bool)
+	var keywords []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(question), func(r rune) bool {
+		return !('a' <= r && r <= 'z' || '0' <= r && r <= '9' || r == '_')
+	}) {
+		if len(word) < 4 || seen[word] {
+			continue
+		}
+		seen[word] = true
+		keywords = append(keywords, word)
+	}
+	return keywords
+}
+
+// relevance is the fraction of keywords that appear in the section.
+func relevance(section string, keywords []string) float64 {
+	if len(keywords) == 0 {
+		return 0
+	}
+	text := strings.ToLower(section)
+	found := 0
+	for _, keyword := range keywords {
+		if strings.Contains(text, keyword) {
+			found++
+		}
+	}
+	return float64(found) / float64(len(keywords))
+}
+
+// truncateMiddle shortens text to at most limit characters by removing its
+// middle, where code is usually least informative: the head keeps
+// signatures and setup, the tail keeps the end of the section (and any
+// closing fence). Cuts fall on line boundaries where possible.
+func truncateMiddle(text string, limit int) string {
+	if len(text) <= limit {
+		return text
+	}
+	// Reserve room for the longest marker; the real one can only be shorter.
+	keep := limit - len(trimMarker(len(text)))
+	if keep <= 0 {
+		return ""
+	}
+
+	headEnd := keep / 2
+	tailStart := len(text) - (keep - headEnd)
+	if i := strings.LastIndexByte(text[:headEnd], '\n'); i > 0 {
+		headEnd = i
+	}
+	if i := strings.IndexByte(text[tailStart:], '\n'); i >= 0 && tailStart+i < len(text)-1 {
+		tailStart += i + 1
+	}
+	return text[:headEnd] + trimMarker(tailStart-headEnd) + text[tailStart:]
+}
+
+func trimMarker(trimmed int) string {
+	return fmt.Sprintf("\n... [%d characters trimmed] ...\n", trimmed)
+}
+
+func sectionTexts(sections []*promptSection) []string {
+	texts := make([]string, len(sections))
+	for i, section := range sections {
+		texts[i] = section.labeledText()
+	}
+	return texts
+}
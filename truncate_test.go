@@ -0,0 +1,240 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestTruncateMiddle(t *testing.T) {
+	var lines []string
+	for i := 0; i < 200; i++ {
+		lines = append(lines, "line of code number "+strings.Repeat("x", i%7))
+	}
+	text := strings.Join(lines, "\n")
+
+	got := truncateMiddle(text, 1000)
+	if len(got) > 1000 {
+		t.Errorf("Expected at most 1000 chars, got %d", len(got))
+	}
+	if !strings.HasPrefix(got, lines[0]+"\n") || !strings.HasSuffix(got, "\n"+lines[199]) {
+		t.Errorf("Expected the head and tail to be kept, got %q", got)
+	}
+	if !strings.Contains(got, "characters trimmed]") {
+		t.Errorf("Expected a trim marker, got %q", got)
+	}
+
+	if truncateMiddle("short", 100) != "short" {
+		t.Error("Expected short text to be left alone")
+	}
+}
+
+func TestDropIrrelevantSections(t *testing.T) {
+	summary := "# Shop\nAn online shop.\n\n## Billing\nInvoices and payments via Stripe.\n\n## Inventory\nStock levels are reserved at checkout.\n\n## Deployment\nRuns on Kubernetes.\n"
+
+	got := dropIrrelevantSections(summary, "Why do stock reservations leak at checkout?", len(summary)-60)
+	if !strings.Contains(got, "# Shop") || !strings.Contains(got, "## Inventory") {
+		t.Errorf("Expected the opening and the relevant section to be kept, got %q", got)
+	}
+	if strings.Contains(got, "## Billing") || strings.Contains(got, "## Deployment") {
+		t.Errorf("Expected irrelevant sections to be dropped, got %q", got)
+	}
+
+	if got := dropIrrelevantSections(summary, "anything", len(summary)); got != summary {
+		t.Errorf("Expected a summary within the limit to be unchanged, got %q", got)
+	}
+}
+
+func TestSplitMarkdownSections_IgnoresFencedHeadings(t *testing.T) {
+	text := "# A\ntext\n```sh\n# not a heading\n```\n## B\nmore\n"
+	sections := splitMarkdownSections(text)
+	if len(sections) != 2 || strings.Join(sections, "") != text {
+		t.Errorf("Expected two sections that join back to the text, got %q", sections)
+	}
+}
+
+func TestFitContext(t *testing.T) {
+	summary := newPromptSection("summary", "# Project\nIntro.\n\n## Unrelated\n"+strings.Repeat("filler ", 100))
+	small := newPromptSection("relevant_code", "func small() {}")
+	large := newPromptSection("resource file:///big.go", strings.Repeat("big line of code\n", 500))
+
+	before := len(summary.Text) + len(small.Text) + len(large.Text)
+	if left := fitContext(3000, "question", summary, []*promptSection{small, large}); left != 0 {
+		t.Fatalf("Expected the excess to be removed, %d chars left", left)
+	}
+	after := len(summary.Text) + len(small.Text) + len(large.Text)
+	if before-after < 3000 {
+		t.Errorf("Expected at least 3000 chars trimmed, got %d", before-after)
+	}
+	if strings.Contains(summary.Text, "Unrelated") {
+		t.Error("Expected the irrelevant summary section to be dropped")
+	}
+	if small.Text != "func small() {}" || small.trimmedTokens() != 0 {
+		t.Error("Expected the small section to be left intact")
+	}
+	if large.trimmedTokens() == 0 {
+		t.Error("Expected the large section to be trimmed")
+	}
+
+	if left := fitContext(1000000, "question", newPromptSection("summary", "s"), nil); left == 0 {
+		t.Error("Expected an excess larger than the context to be reported")
+	}
+}
+
+func TestFitGathered(t *testing.T) {
+	summary := newPromptSection("summary", strings.Repeat("# Project\nIntro.\n", 200))
+	named := newPromptSection("file big.go", strings.Repeat("named line\n", 300))
+	named.Priority = PriorityNamed
+	retrieved := newPromptSection("retrieved other.go:1-60", strings.Repeat("retrieved line\n", 300))
+	retrieved.Priority = PriorityRetrieved
+
+	if left := fitGathered(2000, "question", summary, []*promptSection{named, retrieved}); left != 0 {
+		t.Fatalf("Expected the excess to be removed, %d chars left", left)
+	}
+	if named.trimmedTokens() != 0 || retrieved.trimmedTokens() == 0 || summary.trimmedTokens() != 0 {
+		t.Errorf("Expected only the retrieved section to be trimmed, got named -%d, retrieved -%d, summary -%d", named.trimmedTokens(), retrieved.trimmedTokens(), summary.trimmedTokens())
+	}
+
+	// Once the retrieved tier is gone, the summary is trimmed, but never
+	// what the caller named.
+	if left := fitGathered(len(retrieved.Text)+1000, "question", summary, []*promptSection{named, retrieved}); left != 0 {
+		t.Fatalf("Expected the excess to be removed, %d chars left", left)
+	}
+	if retrieved.Text != "" || summary.trimmedTokens() == 0 || named.trimmedTokens() != 0 {
+		t.Errorf("Expected the retrieved tier dropped and the summary trimmed, got named -%d, %q", named.trimmedTokens(), retrieved.Text)
+	}
+
+	if left := fitGathered(1000, "question", nil, []*promptSection{named}); left != 1000 {
+		t.Errorf("Expected the excess reported when only named context is left, got %d", left)
+	}
+}
+
+func TestGetHelpTool_Call_TrimsOversizedContext(t *testing.T) {
+	var prompt string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openai.ChatCompletionRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		prompt = req.Messages[len(req.Messages)-1].Content
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{
+				{"message": map[string]string{"role": "assistant", "content": "answer"}},
+			},
+		})
+	}))
+	defer srv.Close()
+	summary := filepath.Join(t.TempDir(), "summary.md")
+	os.WriteFile(summary, []byte(strings.Repeat("The service processes items one by one.\n", 3000)), 0o644)
+	tool := NewGetHelpTool(summary, "o3").WithClientOptions(ClientOptions{BaseURL: srv.URL})
+
+	question := "Why is this slow?"
+	content, err := tool.Call(map[string]interface{}{
+		"question":      question,
+		"summary":       "A service.",
+		"relevant_code": "for i := range items { process(i) }",
+	})
+	if err != nil {
+		t.Fatalf("Expected the summary file to be trimmed instead of an error, got: %v", err)
+	}
+	if len(prompt) > promptCharLimit || !strings.Contains(prompt, question) {
+		t.Errorf("Expected a prompt within the limit containing the question, got %d chars", len(prompt))
+	}
+
+	usage := content[0]["_meta"].(map[string]interface{})["context_usage"].(*ContextUsage)
+	trimmed := 0
+	for _, section := range usage.Sections {
+		if section.Name == "summary" {
+			trimmed = section.TrimmedTokens
+		}
+	}
+	if trimmed == 0 {
+		t.Errorf("Expected trimmed tokens to be reported, got %+v", usage.Sections)
+	}
+	omitted, _ := content[0]["_meta"].(map[string]interface{})["context_omitted"].([]ContextOmission)
+	var overview *ContextOmission
+	for i := range omitted {
+		if omitted[i].Section == "summary" {
+			overview = &omitted[i]
+		}
+	}
+	if overview == nil || overview.Action != omissionTruncated || overview.OmittedBytes == 0 || overview.OriginalBytes != 120000 {
+		t.Errorf("Expected the trimmed summary to be listed as omitted, got %+v", omitted)
+	}
+
+	_, err = tool.Call(map[string]interface{}{"question": strings.Repeat("why ", 25000), "summary": "s"})
+	if err == nil {
+		t.Error("Expected an error for a question longer than the limit")
+	}
+}
+
+func TestGetHelpTool_Call_SoftPromptLimit(t *testing.T) {
+	var prompt string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openai.ChatCompletionRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		prompt = req.Messages[len(req.Messages)-1].Content
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{
+				{"message": map[string]string{"role": "assistant", "content": "answer"}},
+			},
+		})
+	}))
+	defer srv.Close()
+	summary := filepath.Join(t.TempDir(), "summary.md")
+	os.WriteFile(summary, []byte("An inventory service."), 0o644)
+	tool := NewGetHelpTool(summary, "o3").WithClientOptions(ClientOptions{BaseURL: srv.URL}).WithPromptLimits(5000, 40000)
+	overSoft := strings.Repeat("for i := range items { process(i) }\n", 1000)
+	overHard := strings.Repeat("for i := range items { process(i) }\n", 5000)
+
+	tests := []struct {
+		name       string
+		code       string
+		allowLarge bool
+		wantErr    string
+		wantWarn   string
+	}{
+		{name: "under the soft limit", code: "process(items)"},
+		{name: "over the soft limit", code: overSoft, wantErr: "Pass allow_large=true"},
+		{name: "over the soft limit with allow_large", code: overSoft, allowLarge: true, wantWarn: "sent whole"},
+		{name: "over the hard limit", code: overHard, wantErr: "hard limit"},
+		{name: "over the hard limit with allow_large", code: overHard, allowLarge: true, wantErr: "hard limit"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prompt = ""
+			content, err := tool.Call(map[string]interface{}{
+				"question":      "Why is this slow?",
+				"summary":       "s",
+				"relevant_code": tt.code,
+				"allow_large":   tt.allowLarge,
+			})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(content[0]["text"].(string), tt.wantErr) || prompt != "" {
+					t.Errorf("Expected the prompt refused with %q, got %v and %v", tt.wantErr, content, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			warning, _ := content[0]["_meta"].(map[string]interface{})["prompt_warning"].(string)
+			if !strings.Contains(prompt, tt.code) || (tt.wantWarn == "") != (warning == "") || !strings.Contains(warning, tt.wantWarn) {
+				t.Errorf("Expected the code sent whole with warning %q, got %q", tt.wantWarn, warning)
+			}
+		})
+	}
+
+	// A question over the soft limit is the caller's too.
+	content, err := tool.Call(map[string]interface{}{"question": strings.Repeat("why ", 6000), "summary": "s"})
+	if err == nil || !strings.Contains(content[0]["text"].(string), "allow_large=true") {
+		t.Errorf("Expected a question over the soft limit to suggest allow_large, got %v", content)
+	}
+	if _, err := tool.Call(map[string]interface{}{"question": strings.Repeat("why ", 6000), "summary": "s", "allow_large": true}); err != nil {
+		t.Errorf("Expected allow_large to take the question, got %v", err)
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// Answer verification modes.
+const (
+	// VerifyAnnotate notes the references that weren't found under the
+	// answer.
+	VerifyAnnotate = "annotate"
+	// VerifyRegenerate asks the model once to revise an answer with
+	// references that weren't found, and annotates what's still missing.
+	VerifyRegenerate = "regenerate"
+)
+
+// verifyNamesTTL is how long the repository's identifiers are reused
+// between answers before they are read again.
+const verifyNamesTTL = time.Minute
+
+var (
+	// answerPathPattern matches repository paths with a source file
+	// extension, optionally followed by a line number. URLs don't match,
+	// since a path must start after a space, quote or bracket.
+	answerPathPattern = regexp.MustCompile("(?:^|[\\s`(\\[\"'])((?:[\\w.-]+/)*[\\w-][\\w.-]*\\.(?:go|py|js|jsx|ts|tsx|rb|rs|java|kt|c|h|cc|cpp|hpp|cs|php|swift|scala|sql|proto|ya?ml|json|toml|sh))(?::\\d+(?:-\\d+)?)?\\b")
+	// answerSymbolPattern matches backquoted identifiers, qualified or
+	// called.
+	answerSymbolPattern = regexp.MustCompile("`([A-Za-z_][A-Za-z0-9_]*(?:\\.[A-Za-z_][A-Za-z0-9_]*)*)(\\(\\))?`")
+	identifierPattern   = regexp.MustCompile(`[A-Za-z_][A-Za-z0-9_]*`)
+	// declarationPattern finds the names an answer declares in its code,
+	// which are new rather than missing.
+	declarationPattern = regexp.MustCompile(`\b(?:func|type|var|const|def|class|fn|struct|interface|enum)\s+(?:\([^)]*\)\s*)?([A-Za-z_][A-Za-z0-9_]*)`)
+)
+
+// AnswerVerifier checks the files and symbols an answer names against the
+// repository, catching the commonest hallucination: advice about code that
+// doesn't exist.
+type AnswerVerifier struct {
+	repo *Repository
+	mode string
+
+	mu      sync.Mutex
+	files   map[string]bool
+	names   map[string]bool
+	readAt  time.Time
+	readErr error
+}
+
+// NewAnswerVerifier verifies answers against repo in mode, annotate or
+// regenerate.
+func NewAnswerVerifier(repo *Repository, mode string) (*AnswerVerifier, error) {
+	if mode != VerifyAnnotate && mode != VerifyRegenerate {
+		return nil, fmt.Errorf("unknown verification mode %q; want %s or %s", mode, VerifyAnnotate, VerifyRegenerate)
+	}
+	return &AnswerVerifier{repo: repo, mode: mode}, nil
+}
+
+// UnverifiedReferences lists what an answer names that wasn't found.
+type UnverifiedReferences struct {
+	Files   []string `json:"files,omitempty"`
+	Symbols []string `json:"symbols,omitempty"`
+}
+
+func (u *UnverifiedReferences) list() string {
+	var names []string
+	for _, name := range append(append([]string{}, u.Files...), u.Symbols...) {
+		names = append(names, "`"+name+"`")
+	}
+	return strings.Join(names, ", ")
+}
+
+// note is added under an answer whose references weren't all found.
+func (u *UnverifiedReferences) note() string {
+	return "\n\n> **Unverified:** this answer names code that wasn't found in the repository: " + u.list() + ". It may be code the answer proposes to add; otherwise, check it before relying on it."
+}
+
+// correction asks the model to revise an answer.
+func (u *UnverifiedReferences) correction() string {
+	return "Your answer names code that doesn't exist in the repository: " + u.list() + ". Revise the answer so it relies only on code that exists, and say explicitly which code you propose adding."
+}
+
+// Check returns the files and symbols the answer names that aren't in the
+// repository, or nil if all of them are. Names the prompt mentions or the
+// answer declares are taken as known. Qualified names are checked only
+// when the qualifier looks like a type, such as Store.Put: strings.Cut or
+// s.Put may name a package or a variable the repository doesn't spell out.
+func (v *AnswerVerifier) Check(answer, prompt string) (*UnverifiedReferences, error) {
+	files, names, err := v.repository()
+	if err != nil {
+		return nil, err
+	}
+	declared := make(map[string]bool)
+	for _, m := range declarationPattern.FindAllStringSubmatch(answer, -1) {
+		declared[m[1]] = true
+	}
+
+	unverified := &UnverifiedReferences{}
+	seen := make(map[string]bool)
+	for _, m := range answerPathPattern.FindAllStringSubmatch(answer, -1) {
+		file := path.Clean(strings.TrimPrefix(m[1], "./"))
+		if seen[file] || strings.Contains(prompt, file) || v.fileExists(files, file) {
+			continue
+		}
+		seen[file] = true
+		unverified.Files = append(unverified.Files, file)
+	}
+	for _, m := range answerSymbolPattern.FindAllStringSubmatch(answer, -1) {
+		symbol := m[1]
+		parts := strings.Split(symbol, ".")
+		if seen[symbol] || answerPathPattern.MatchString(" "+symbol) {
+			continue
+		}
+		seen[symbol] = true
+		// Only calls, qualified names and camel case are taken as code;
+		// a lone word in backquotes is as likely a value or a term.
+		if m[2] == "" && len(parts) == 1 && !camelPattern.MatchString(symbol) {
+			continue
+		}
+		if len(parts) > 1 && !unicode.IsUpper(rune(parts[0][0])) {
+			continue
+		}
+		missing := false
+		for _, part := range parts {
+			if !names[part] && !declared[part] && !containsWord(prompt, part) {
+				missing = true
+			}
+		}
+		if missing {
+			unverified.Symbols = append(unverified.Symbols, symbol)
+		}
+	}
+	if len(unverified.Files) == 0 && len(unverified.Symbols) == 0 {
+		return nil, nil
+	}
+	return unverified, nil
+}
+
+// fileExists reports whether file is a repository path, or the end of one,
+// since answers often shorten paths.
+func (v *AnswerVerifier) fileExists(files map[string]bool, file string) bool {
+	if files[file] {
+		return true
+	}
+	for f := range files {
+		if strings.HasSuffix(f, "/"+file) {
+			return true
+		}
+	}
+	return false
+}
+
+// repository returns the repository's files and the identifiers in them,
+// read again once they are older than verifyNamesTTL.
+func (v *AnswerVerifier) repository() (map[string]bool, map[string]bool, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if !v.readAt.IsZero() && time.Since(v.readAt) < verifyNamesTTL {
+		return v.files, v.names, v.readErr
+	}
+	files := make(map[string]bool)
+	names := make(map[string]bool)
+	list, err := v.repo.Files()
+	for _, file := range list {
+		files[file] = true
+		content, err := v.repo.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		for _, name := range identifierPattern.FindAllString(content, -1) {
+			names[name] = true
+		}
+	}
+	v.files, v.names, v.readAt, v.readErr = files, names, time.Now(), err
+	return files, names, err
+}
+
+func containsWord(text, word string) bool {
+	return regexp.MustCompile(`\b` + regexp.QuoteMeta(word) + `\b`).MatchString(text)
+}
+
+// verifyAnswer checks the completion's references and, in regenerate
+// mode, asks for a revision when some weren't found. Streamed answers
+// can't be taken back, so they are only annotated. It returns the
+// completion to deliver, what's still unverified, and the revision call.
+func (t *GetHelpTool) verifyAnswer(ctx context.Context, override *LLM, prior []openai.ChatCompletionMessage, prompt string, jsonAnswer, streamed bool, completion *Completion) (*Completion, *UnverifiedReferences, *Completion) {
+	unverified, err := t.verifier.Check(completion.Answer, prompt)
+	if err != nil {
+		slog.WarnContext(ctx, "Couldn't verify the answer against the repository", "tool", t.Name(), "error", err)
+		return completion, nil, nil
+	}
+	if unverified == nil {
+		return completion, nil, nil
+	}
+	slog.InfoContext(ctx, "Answer names code that wasn't found", "tool", t.Name(), "model", completion.Model, "files", unverified.Files, "symbols", unverified.Symbols)
+
+	var revision *Completion
+	if t.verifier.mode == VerifyRegenerate && !streamed {
+		conversation := append(append([]openai.ChatCompletionMessage{}, prior...),
+			openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: prompt},
+			openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: completion.Answer},
+		)
+		revised, err := t.generate(ctx, override, conversation, unverified.correction(), jsonAnswer, nil)
+		if err != nil {
+			slog.WarnContext(ctx, "Couldn't revise the answer, annotating it instead", "tool", t.Name(), "error", err)
+		} else {
+			revision = revised
+			completion = revised
+			if unverified, err = t.verifier.Check(completion.Answer, prompt); err != nil || unverified == nil {
+				return completion, nil, revision
+			}
+		}
+	}
+
+	// A note would break a JSON answer; _meta still tells.
+	if !jsonAnswer {
+		annotated := *completion
+		annotated.Answer += unverified.note()
+		completion = &annotated
+	}
+	return completion, unverified, revision
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func verifierRepo(t *testing.T, mode string) *AnswerVerifier {
+	t.Helper()
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "internal", "store"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	code := "package store\n\ntype Store struct{}\n\nfunc (s *Store) Put(key string) { strings.TrimSpace(key) }\n"
+	if err := os.WriteFile(filepath.Join(root, "internal", "store", "store.go"), []byte(code), 0644); err != nil {
+		t.Fatal(err)
+	}
+	repo, err := OpenRepository(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, err := NewAnswerVerifier(repo, mode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return verifier
+}
+
+func TestAnswerVerifier_Check(t *testing.T) {
+	verifier := verifierRepo(t, VerifyAnnotate)
+	answer := "In `store/store.go:5`, `Store.Put` should call `Store.Flush()` and `validateKey()`, as `cmd/server.go` does. " +
+		"Add `newLock()`:\n\n```go\nfunc newLock() *sync.Mutex { return &sync.Mutex{} }\n```\n\n" +
+		"Use `strings.Cut` or `errors.Join`, set `timeout` and see https://go.dev/doc/effective_go.go and `retryPolicy` from the question."
+	unverified, err := verifier.Check(answer, "Question: Why does retryPolicy drop keys?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &UnverifiedReferences{Files: []string{"cmd/server.go"}, Symbols: []string{"Store.Flush", "validateKey"}}
+	if !reflect.DeepEqual(unverified, want) {
+		t.Errorf("Check = %+v, want %+v", unverified, want)
+	}
+
+	if unverified, _ := verifier.Check("Call `Store.Put` in internal/store/store.go.", ""); unverified != nil {
+		t.Errorf("Expected existing code to verify, got %+v", unverified)
+	}
+	if _, err := NewAnswerVerifier(verifier.repo, "fix"); err == nil {
+		t.Error("Expected an error for an unknown mode")
+	}
+}
+
+func TestGetHelpTool_Call_VerifiesAnswer(t *testing.T) {
+	answers := []string{
+		"Call `Store.Flush()` after `Store.Put`.\nCONFIDENCE: high",
+		"Call `Store.Put` once per key.\nCONFIDENCE: medium",
+	}
+	var requests []openai.ChatCompletionRequest
+	tool := NewGetHelpTool("", "o3").WithVerifier(verifierRepo(t, VerifyRegenerate))
+	tool.LLM().WithProvider(CompletionFunc(func(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error) {
+		requests = append(requests, req)
+		answer := answers[min(len(requests), len(answers))-1]
+		return &Completion{Answer: answer, Model: req.Model, PromptTokens: 1000, CompletionTokens: 100}, nil
+	}))
+
+	result, err := tool.Call(map[string]interface{}{"question": "Why are keys lost?", "summary": "s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text := result[0]["text"]; text != "Call `Store.Put` once per key." {
+		t.Errorf("Expected the revised answer, got %q", text)
+	}
+	last := requests[1].Messages[len(requests[1].Messages)-1].Content
+	if len(requests) != 2 || !strings.Contains(last, "`Store.Flush`") {
+		t.Errorf("Expected one revision naming the missing code, got %d requests ending %q", len(requests), last)
+	}
+	if usage := result[0]["_meta"].(map[string]interface{})["usage"].(*TokenUsage); usage.PromptTokens != 2000 {
+		t.Errorf("Expected the revision's tokens counted, got %+v", usage)
+	}
+
+	// A revision that still names missing code is annotated.
+	answers[1] = answers[0]
+	requests = nil
+	result, _ = tool.Call(map[string]interface{}{"question": "Why are keys dropped?", "summary": "s"})
+	text := result[0]["text"].(string)
+	if !strings.Contains(text, "**Unverified:**") || !strings.Contains(text, "`Store.Flush`") {
+		t.Errorf("Expected the answer annotated, got %q", text)
+	}
+	meta := result[0]["_meta"].(map[string]interface{})
+	if unverified := meta["unverified_references"].(*UnverifiedReferences); !reflect.DeepEqual(unverified.Symbols, []string{"Store.Flush"}) {
+		t.Errorf("Expected the missing symbol in _meta, got %+v", unverified)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Warmer is implemented by providers, tools and stores that can do their
+// slow one-off setup ahead of the first call: reading files, loading
+// indexes and opening connections.
+type Warmer interface {
+	Warm(ctx context.Context) error
+}
+
+// warmTimeout bounds warming so a slow or unreachable provider only delays
+// the first call, as it would have anyway.
+const warmTimeout = 30 * time.Second
+
+// Warm opens a connection to the model API. The connection stays in the
+// HTTP client's pool, so the first escalation skips the DNS lookup and TLS
+// handshake.
+func (p *openAIProvider) Warm(ctx context.Context) error {
+	_, err := p.Client.ListModels(ctx)
+	return err
+}
+
+// Warm warms the provider, if it supports it.
+func (l *LLM) Warm(ctx context.Context) error {
+	provider := l.provider
+	if provider == nil {
+		provider = newOpenAIProvider(l.clientOptions)
+	}
+	if warmer, ok := provider.(Warmer); ok {
+		return warmer.Warm(ctx)
+	}
+	return nil
+}
+
+// Warm loads the chunks into memory and opens a connection to the
+// embeddings API with a tiny request.
+func (x *CodeIndex) Warm(ctx context.Context) error {
+	if _, err := x.load(); err != nil {
+		return err
+	}
+	_, err := x.embedder.Embed(ctx, []string{"warm up"})
+	return err
+}
+
+// Warm reads the summary file into the cache, loads the code index and
+// opens the model connection concurrently. Failures are reported but
+// harmless: each step is simply done again by the first call.
+func (t *GetHelpTool) Warm(ctx context.Context) error {
+	steps := map[string]func(context.Context) error{
+		"summary": func(context.Context) error {
+			_, err := t.loadSummary()
+			return err
+		},
+		"model": t.llm.Warm,
+	}
+	if t.index != nil {
+		steps["index"] = t.index.Warm
+	}
+
+	var mu sync.Mutex
+	var errs []error
+	var wg sync.WaitGroup
+	for name, step := range steps {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := step(ctx); err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// warmTools warms every registered tool that supports it, in the
+// background, so the client isn't kept waiting.
+func (s *MCPServer) warmTools() {
+	if !s.warm {
+		return
+	}
+	for _, tool := range s.server.Tools() {
+		name := tool.Name()
+		warmer, ok := tool.(Warmer)
+		if !ok {
+			continue
+		}
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), warmTimeout)
+			defer cancel()
+			start := time.Now()
+			if err := warmer.Warm(ctx); err != nil {
+				slog.Warn("Couldn't fully warm tool", "tool", name, "error", err)
+				return
+			}
+			slog.Info("Warmed tool", "tool", name, "duration_ms", time.Since(start).Milliseconds())
+		}()
+	}
+}
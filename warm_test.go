@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// warmingProvider is a fake provider that records being warmed.
+type warmingProvider struct {
+	CompletionFunc
+	warmed chan struct{}
+}
+
+func (p *warmingProvider) Warm(ctx context.Context) error {
+	close(p.warmed)
+	return nil
+}
+
+func newWarmingProvider() *warmingProvider {
+	return &warmingProvider{
+		CompletionFunc: func(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error) {
+			return &Completion{Answer: "answer", Model: req.Model}, nil
+		},
+		warmed: make(chan struct{}),
+	}
+}
+
+func TestGetHelpTool_Warm(t *testing.T) {
+	summaryPath := filepath.Join(t.TempDir(), "summary.md")
+	os.WriteFile(summaryPath, []byte("First summary"), 0644)
+
+	provider := newWarmingProvider()
+	index := openTestIndex(t, &hashEmbedder{})
+	tool := NewGetHelpTool(summaryPath, "o3").WithIndex(index, 3)
+	tool.LLM().WithProvider(provider)
+
+	if err := tool.Warm(context.Background()); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	select {
+	case <-provider.warmed:
+	default:
+		t.Error("Expected the provider to be warmed")
+	}
+	if tool.summary == nil || tool.summary.text != "First summary" {
+		t.Errorf("Expected the summary to be loaded, got %+v", tool.summary)
+	}
+	if index.chunks == nil {
+		t.Error("Expected the index chunks to be loaded")
+	}
+
+	// An edited summary file is read again.
+	os.WriteFile(summaryPath, []byte("Second, longer summary"), 0644)
+	if summary, _ := tool.loadSummary(); summary != "Second, longer summary" {
+		t.Errorf("Expected the edited summary, got %q", summary)
+	}
+
+	// Missing files are reported but don't stop the other steps.
+	missing := NewGetHelpTool(filepath.Join(t.TempDir(), "missing.md"), "o3")
+	missingProvider := newWarmingProvider()
+	missing.LLM().WithProvider(missingProvider)
+	if err := missing.Warm(context.Background()); err == nil {
+		t.Error("Expected an error for a missing summary file")
+	}
+	select {
+	case <-missingProvider.warmed:
+	default:
+		t.Error("Expected the provider to be warmed despite the missing summary")
+	}
+}
+
+func TestMCPServer_Initialize_WarmsTools(t *testing.T) {
+	provider := newWarmingProvider()
+	tool := NewGetHelpTool("", "o3")
+	tool.LLM().WithProvider(provider)
+	server := NewMCPServer("test", "1.0.0").WithWarmStart(true)
+	server.RegisterTool(tool)
+
+	server.ProcessRequest(JsonRPCRequest{Jsonrpc: "2.0", ID: 1, Method: "initialize", Params: json.RawMessage(`{}`)})
+	select {
+	case <-provider.warmed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected initialize to warm the tools")
+	}
+}
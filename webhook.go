@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// webhookAttempts is how many times an event is posted before it's dropped.
+const webhookAttempts = 3
+
+// EscalationEvent is the payload posted for each answered escalation. The
+// answer itself isn't sent, only its hash, so receivers can correlate
+// answers without holding them.
+type EscalationEvent struct {
+	Event            string    `json:"event"`
+	At               time.Time `json:"at"`
+	Client           string    `json:"client"`
+	Tool             string    `json:"tool"`
+	Question         string    `json:"question,omitempty"`
+	AnswerSHA256     string    `json:"answer_sha256"`
+	Model            string    `json:"model,omitempty"`
+	LatencyMS        int64     `json:"latency_ms"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	CostUSD          float64   `json:"cost_usd"`
+	Cached           bool      `json:"cached,omitempty"`
+}
+
+// EscalationWebhook posts an EscalationEvent for every escalation, signed
+// with HMAC-SHA256 when a secret is set, so platform teams can feed
+// escalation activity into their own observability and governance systems.
+// Events are posted in the background and never delay an answer.
+type EscalationWebhook struct {
+	url      string
+	secret   []byte
+	redactor *Redactor
+	client   *http.Client
+	backoff  time.Duration
+}
+
+func NewEscalationWebhook(url string) *EscalationWebhook {
+	return &EscalationWebhook{url: url, client: &http.Client{Timeout: 10 * time.Second}, backoff: time.Second}
+}
+
+// WithSecret signs each event's body with HMAC-SHA256 under secret, sent as
+// X-Escalator-Signature: sha256=<hex>.
+func (w *EscalationWebhook) WithSecret(secret string) *EscalationWebhook {
+	if secret != "" {
+		w.secret = []byte(secret)
+	}
+	return w
+}
+
+// WithRedactor redacts secrets from the question before it is posted.
+func (w *EscalationWebhook) WithRedactor(redactor *Redactor) *EscalationWebhook {
+	w.redactor = redactor
+	return w
+}
+
+// Sign is the signature header value for body.
+func (w *EscalationWebhook) Sign(body []byte) string {
+	mac := hmac.New(sha256.New, w.secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Send posts event in the background, retrying failed deliveries.
+func (w *EscalationWebhook) Send(event EscalationEvent) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		if w.redactor != nil && event.Question != "" {
+			question, _, err := w.redactor.Redact(ctx, event.Question)
+			if err != nil {
+				// Fail closed: the event goes out without the question.
+				slog.Warn("Couldn't scan the escalation event for secrets, dropping the question", "tool", event.Tool, "error", err)
+				question = ""
+			}
+			event.Question = question
+		}
+		body, err := json.Marshal(event)
+		if err != nil {
+			slog.Error("Couldn't encode the escalation event", "tool", event.Tool, "error", err)
+			return
+		}
+		for attempt := 1; ; attempt++ {
+			err = w.post(ctx, body)
+			if err == nil || attempt == webhookAttempts {
+				break
+			}
+			select {
+			case <-ctx.Done():
+			case <-time.After(w.backoff * time.Duration(attempt)):
+			}
+		}
+		if err != nil {
+			slog.Warn("Couldn't post the escalation event to the webhook", "tool", event.Tool, "error", err)
+		}
+	}()
+}
+
+func (w *EscalationWebhook) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.secret != nil {
+		req.Header.Set("X-Escalator-Signature", w.Sign(body))
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// reportEscalation posts a successful call to the escalation webhook when
+// it escalated to a model (or an expert), as a tool reporting usage did.
+func (s *MCPServer) reportEscalation(client, toolName string, arguments map[string]interface{}, answer string, meta map[string]interface{}, latency time.Duration) {
+	usage, _ := meta["usage"].(*TokenUsage)
+	if s.webhook == nil || (usage == nil && !escalatingTools[toolName]) {
+		return
+	}
+	sum := sha256.Sum256([]byte(answer))
+	event := EscalationEvent{
+		Event:        "escalation",
+		At:           time.Now().UTC(),
+		Client:       client,
+		Tool:         toolName,
+		Question:     escalationQuestion(arguments),
+		AnswerSHA256: hex.EncodeToString(sum[:]),
+		LatencyMS:    latency.Milliseconds(),
+	}
+	if usage != nil {
+		event.Model = usage.Model
+		event.PromptTokens = usage.PromptTokens
+		event.CompletionTokens = usage.CompletionTokens
+		event.CostUSD = usage.CostUSD
+		event.Cached = usage.Cached
+	}
+	if expert, ok := meta["expert"].(string); ok {
+		event.Model = "expert:" + expert
+	}
+	s.webhook.Send(event)
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// maxWikiExcerpt is the longest excerpt included from one page.
+	maxWikiExcerpt = 2000
+	// maxWikiQueryKeywords bounds the search query; long questions make
+	// full-text searches match nothing.
+	maxWikiQueryKeywords = 8
+)
+
+// WikiPage is a page found by a wiki search, with its text.
+type WikiPage struct {
+	Title string
+	URL   string
+	Text  string
+}
+
+// WikiSearcher searches a wiki for pages matching a query.
+type WikiSearcher interface {
+	Search(ctx context.Context, query string, limit int) ([]WikiPage, error)
+}
+
+// WikiSource searches an internal wiki for pages matching the question and
+// includes an excerpt of each, with a link, because much architectural
+// context (design docs, runbooks, decision records) lives outside the
+// repository. Wiki search is best-effort.
+type WikiSource struct {
+	name     string
+	searcher WikiSearcher
+	pages    int
+}
+
+// NewWikiSource includes up to pages pages found by searcher.
+func NewWikiSource(name string, searcher WikiSearcher, pages int) *WikiSource {
+	return &WikiSource{name: name, searcher: searcher, pages: pages}
+}
+
+func (s *WikiSource) Name() string { return s.name }
+
+func (s *WikiSource) Gather(ctx context.Context, question string, arguments map[string]interface{}) ([]ContextBlock, error) {
+	keywords := questionKeywords(question)
+	if len(keywords) == 0 || s.pages <= 0 {
+		return nil, nil
+	}
+	query := strings.Join(keywords[:min(len(keywords), maxWikiQueryKeywords)], " ")
+	pages, err := s.searcher.Search(ctx, query, s.pages)
+	if err != nil {
+		slog.Warn("Couldn't search the wiki", "source", s.name, "error", err)
+		return nil, nil
+	}
+
+	var blocks []ContextBlock
+	for _, page := range pages[:min(len(pages), s.pages)] {
+		excerpt := wikiExcerpt(page.Text, keywords, maxWikiExcerpt)
+		if excerpt == "" {
+			continue
+		}
+		blocks = append(blocks, ContextBlock{
+			Name:       s.name + " " + page.Title,
+			Text:       fmt.Sprintf("**Wiki page: %s** (%s)\n\n%s", page.Title, page.URL, excerpt),
+			Priority:   PriorityRetrieved,
+			Provenance: fmt.Sprintf("WIKI %s (%s, last edit unknown)", page.Title, page.URL),
+		})
+	}
+	return blocks, nil
+}
+
+// wikiExcerpt keeps the paragraphs of text most relevant to the keywords,
+// in page order, up to limit characters. Skipped paragraphs are marked
+// with an ellipsis.
+func wikiExcerpt(text string, keywords []string, limit int) string {
+	text = strings.TrimSpace(text)
+	if len(text) <= limit {
+		return text
+	}
+
+	var paragraphs []string
+	for _, paragraph := range strings.Split(text, "\n\n") {
+		if paragraph = strings.TrimSpace(paragraph); paragraph != "" {
+			paragraphs = append(paragraphs, truncateMiddle(paragraph, limit))
+		}
+	}
+	order := make([]int, len(paragraphs))
+	for i := range order {
+		order[i] = i
+	}
+	// Most relevant first; among equals, earlier paragraphs first, since
+	// pages usually open with an overview.
+	sort.SliceStable(order, func(a, b int) bool {
+		return relevance(paragraphs[order[a]], keywords) > relevance(paragraphs[order[b]], keywords)
+	})
+
+	kept := make([]bool, len(paragraphs))
+	length := 0
+	for _, i := range order {
+		if length+len(paragraphs[i])+2 > limit {
+			continue
+		}
+		kept[i] = true
+		length += len(paragraphs[i]) + 2
+	}
+
+	var parts []string
+	skipped := false
+	for i, paragraph := range paragraphs {
+		if !kept[i] {
+			skipped = true
+			continue
+		}
+		if skipped && len(parts) > 0 {
+			parts = append(parts, "…")
+		}
+		parts = append(parts, paragraph)
+		skipped = false
+	}
+	if skipped {
+		parts = append(parts, "…")
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// ConfluenceSearcher searches Confluence pages with CQL.
+type ConfluenceSearcher struct {
+	baseURL string
+	space   string
+	user    string
+	token   string
+	client  *http.Client
+}
+
+// NewConfluenceSearcher searches the Confluence site at baseURL (for
+// Confluence Cloud, https://<site>.atlassian.net/wiki), limited to space
+// when it isn't empty. With a user the token is an API token sent with
+// basic auth, as Confluence Cloud expects; without one it is sent as a
+// bearer personal access token, as Confluence Server and Data Center
+// expect.
+func NewConfluenceSearcher(baseURL, space, user, token string) *ConfluenceSearcher {
+	return &ConfluenceSearcher{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		space:   space,
+		user:    user,
+		token:   token,
+		client:  &http.Client{Timeout: 20 * time.Second},
+	}
+}
+
+type confluenceSearchResponse struct {
+	Results []struct {
+		Title string `json:"title"`
+		Body  struct {
+			View struct {
+				Value string `json:"value"`
+			} `json:"view"`
+		} `json:"body"`
+		Links struct {
+			WebUI string `json:"webui"`
+		} `json:"_links"`
+	} `json:"results"`
+	Links struct {
+		Base string `json:"base"`
+	} `json:"_links"`
+}
+
+func (c *ConfluenceSearcher) Search(ctx context.Context, query string, limit int) ([]WikiPage, error) {
+	cql := fmt.Sprintf("type = page AND text ~ %s", cqlString(query))
+	if c.space != "" {
+		cql += " AND space = " + cqlString(c.space)
+	}
+	params := url.Values{
+		"cql":    {cql},
+		"limit":  {fmt.Sprint(limit)},
+		"expand": {"body.view"},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/rest/api/content/search?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.user != "" {
+		req.SetBasicAuth(c.user, c.token)
+	} else if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	var response confluenceSearchResponse
+	if err := doWikiRequest(c.client, req, &response); err != nil {
+		return nil, err
+	}
+	base := response.Links.Base
+	if base == "" {
+		base = c.baseURL
+	}
+	pages := make([]WikiPage, 0, len(response.Results))
+	for _, result := range response.Results {
+		pages = append(pages, WikiPage{
+			Title: result.Title,
+			URL:   base + result.Links.WebUI,
+			Text:  htmlText(result.Body.View.Value),
+		})
+	}
+	return pages, nil
+}
+
+var cqlEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// cqlString quotes s as a CQL string literal.
+func cqlString(s string) string {
+	return `"` + cqlEscaper.Replace(s) + `"`
+}
+
+// SearchAPISearcher searches any wiki or documentation site through a
+// simple search API: GET endpoint?q=<query>&limit=<n>, answered with
+// {"results": [{"title", "url", "text"}]} or a bare array of results. A
+// result may carry html instead of text.
+type SearchAPISearcher struct {
+	endpoint string
+	token    string
+	client   *http.Client
+}
+
+// NewSearchAPISearcher queries endpoint, sending token as a bearer token
+// when it isn't empty.
+func NewSearchAPISearcher(endpoint, token string) *SearchAPISearcher {
+	return &SearchAPISearcher{endpoint: endpoint, token: token, client: &http.Client{Timeout: 20 * time.Second}}
+}
+
+type searchAPIResult struct {
+	Title string `json:"title"`
+	URL   string `json:"url"`
+	Text  string `json:"text"`
+	HTML  string `json:"html"`
+}
+
+func (s *SearchAPISearcher) Search(ctx context.Context, query string, limit int) ([]WikiPage, error) {
+	u, err := url.Parse(s.endpoint)
+	if err != nil {
+		return nil, err
+	}
+	params := u.Query()
+	params.Set("q", query)
+	params.Set("limit", fmt.Sprint(limit))
+	u.RawQuery = params.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	var raw json.RawMessage
+	if err := doWikiRequest(s.client, req, &raw); err != nil {
+		return nil, err
+	}
+	var results []searchAPIResult
+	if trimmed := bytes.TrimSpace(raw); len(trimmed) > 0 && trimmed[0] == '[' {
+		err = json.Unmarshal(trimmed, &results)
+	} else {
+		var wrapped struct {
+			Results []searchAPIResult `json:"results"`
+		}
+		err = json.Unmarshal(trimmed, &wrapped)
+		results = wrapped.Results
+	}
+	if err != nil {
+		return nil, fmt.Errorf("couldn't decode search results: %w", err)
+	}
+
+	pages := make([]WikiPage, 0, len(results))
+	for _, result := range results {
+		text := result.Text
+		if text == "" {
+			text = htmlText(result.HTML)
+		}
+		pages = append(pages, WikiPage{Title: result.Title, URL: result.URL, Text: text})
+	}
+	return pages, nil
+}
+
+// doWikiRequest sends req and decodes the JSON response into v.
+func doWikiRequest(client *http.Client, req *http.Request, v interface{}) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("search returned %s: %s", resp.Status, strings.Join(strings.Fields(string(body)), " "))
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxWebPageSize*4)).Decode(v); err != nil {
+		return fmt.Errorf("couldn't decode search results: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestConfluenceSearcher(t *testing.T) {
+	var cql, auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/wiki/rest/api/content/search" {
+			http.NotFound(w, r)
+			return
+		}
+		cql = r.URL.Query().Get("cql")
+		auth = r.Header.Get("Authorization")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"results": []map[string]interface{}{{
+				"title":  "Stock reservations",
+				"body":   map[string]interface{}{"view": map[string]string{"value": "<h1>Design</h1><p>Reservations expire after <b>15 minutes</b>.</p>"}},
+				"_links": map[string]string{"webui": "/spaces/INV/pages/42/Stock+reservations"},
+			}},
+			"_links": map[string]string{"base": "https://example.atlassian.net/wiki"},
+		})
+	}))
+	defer srv.Close()
+
+	pages, err := NewConfluenceSearcher(srv.URL+"/wiki/", "INV", "me@example.com", "token").Search(context.Background(), `stock "reservation"`, 3)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if cql != `type = page AND text ~ "stock \"reservation\"" AND space = "INV"` {
+		t.Errorf("Unexpected CQL %q", cql)
+	}
+	if !strings.HasPrefix(auth, "Basic ") {
+		t.Errorf("Expected basic auth with a user, got %q", auth)
+	}
+	if len(pages) != 1 || pages[0].URL != "https://example.atlassian.net/wiki/spaces/INV/pages/42/Stock+reservations" || pages[0].Text != "Design\nReservations expire after 15 minutes." {
+		t.Errorf("Unexpected pages %+v", pages)
+	}
+
+	NewConfluenceSearcher(srv.URL+"/wiki", "", "", "pat").Search(context.Background(), "stock", 3)
+	if auth != "Bearer pat" || strings.Contains(cql, "space") {
+		t.Errorf("Expected a bearer token and no space filter, got %q and %q", auth, cql)
+	}
+}
+
+func TestSearchAPISearcher(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("team") != "inventory" || r.URL.Query().Get("q") != "deadlock" || r.URL.Query().Get("limit") != "2" {
+			http.Error(w, "bad query "+r.URL.RawQuery, http.StatusBadRequest)
+			return
+		}
+		if r.URL.Path == "/array" {
+			w.Write([]byte(`[{"title": "Runbook", "url": "https://wiki/runbook", "html": "<p>Restart the <i>reconciler</i></p>"}]`))
+			return
+		}
+		w.Write([]byte(`{"results": [{"title": "ADR 7", "url": "https://wiki/adr-7", "text": "Use advisory locks."}]}`))
+	}))
+	defer srv.Close()
+
+	pages, err := NewSearchAPISearcher(srv.URL+"/search?team=inventory", "").Search(context.Background(), "deadlock", 2)
+	if err != nil || len(pages) != 1 || pages[0].Title != "ADR 7" || pages[0].Text != "Use advisory locks." {
+		t.Errorf("Unexpected pages %+v, %v", pages, err)
+	}
+	pages, err = NewSearchAPISearcher(srv.URL+"/array?team=inventory", "").Search(context.Background(), "deadlock", 2)
+	if err != nil || len(pages) != 1 || pages[0].Text != "Restart the reconciler" {
+		t.Errorf("Unexpected pages %+v, %v", pages, err)
+	}
+	if _, err := NewSearchAPISearcher(srv.URL+"/search", "").Search(context.Background(), "deadlock", 2); err == nil || !strings.Contains(err.Error(), "bad query") {
+		t.Errorf("Expected the server's error, got %v", err)
+	}
+}
+
+func TestWikiExcerpt(t *testing.T) {
+	text := "Overview of the inventory service.\n\n" +
+		strings.Repeat("Unrelated billing notes. ", 40) + "\n\n" +
+		"Reservations deadlock when two replicas reconcile at once.\n\n" +
+		strings.Repeat("More billing notes. ", 40)
+	excerpt := wikiExcerpt(text, questionKeywords("Why do reservations deadlock?"), 200)
+	want := "Overview of the inventory service.\n\n…\n\nReservations deadlock when two replicas reconcile at once.\n\n…"
+	if excerpt != want {
+		t.Errorf("Expected %q, got %q", want, excerpt)
+	}
+	if short := wikiExcerpt(" short page ", nil, 200); short != "short page" {
+		t.Errorf("Expected a short page whole, got %q", short)
+	}
+}
+
+type wikiSearcherFunc func(ctx context.Context, query string, limit int) ([]WikiPage, error)
+
+func (f wikiSearcherFunc) Search(ctx context.Context, query string, limit int) ([]WikiPage, error) {
+	return f(ctx, query, limit)
+}
+
+func TestGetHelpTool_Call_Wiki(t *testing.T) {
+	var query string
+	searcher := wikiSearcherFunc(func(ctx context.Context, q string, limit int) ([]WikiPage, error) {
+		query = q
+		return []WikiPage{{Title: "Stock reservations", URL: "https://wiki/42", Text: "Reservations expire after 15 minutes."}}, nil
+	})
+	var prompt string
+	tool := NewGetHelpTool(writeTestSummary(t), "o3").WithContextSource(NewWikiSource("confluence", searcher, 3))
+	tool.LLM().WithProvider(CompletionFunc(func(ctx context.Context, req openai.ChatCompletionRequest) (*Completion, error) {
+		prompt = req.Messages[len(req.Messages)-1].Content
+		return &Completion{Answer: "answer", Model: req.Model}, nil
+	}))
+
+	content, err := tool.Call(map[string]interface{}{"question": "Why do stock reservations expire early?", "summary": "s"})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if query != "stock reservations expire early" {
+		t.Errorf("Expected the question's keywords as the query, got %q", query)
+	}
+	if !strings.Contains(prompt, "**Wiki page: Stock reservations** (https://wiki/42)\n\nReservations expire after 15 minutes.") {
+		t.Errorf("Expected the excerpt with its link in the prompt, got %q", prompt)
+	}
+	var found bool
+	for _, section := range content[0]["_meta"].(map[string]interface{})["context_usage"].(*ContextUsage).Sections {
+		found = found || section.Name == "confluence Stock reservations"
+	}
+	if !found {
+		t.Error("Expected the page in the context usage")
+	}
+
+	// A failing search doesn't fail the escalation.
+	failing := wikiSearcherFunc(func(ctx context.Context, q string, limit int) ([]WikiPage, error) {
+		return nil, context.DeadlineExceeded
+	})
+	tool.sources = nil
+	tool.WithContextSource(NewWikiSource("confluence", failing, 3))
+	if _, err := tool.Call(map[string]interface{}{"question": "Why do stock reservations expire early?", "summary": "s"}); err != nil {
+		t.Errorf("Expected the question to be asked without the wiki, got: %v", err)
+	}
+}